@@ -1529,9 +1529,7 @@ func TestMcpProxyServerSessionManagement(t *testing.T) {
 
 // BenchmarkRestMCPServer 性能基准测试
 func BenchmarkRestMCPServer(b *testing.B) {
-	host, status := test.NewTestHost(restMCPServerConfig)
-	defer host.Reset()
-	require.Equal(b, types.OnPluginStartStatusOK, status)
+	host := test.NewBenchHost(b, restMCPServerConfig)
 
 	toolsListRequest := `{
 		"jsonrpc": "2.0",
@@ -1540,8 +1538,8 @@ func BenchmarkRestMCPServer(b *testing.B) {
 		"params": {}
 	}`
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
+	// Every iteration is a request of its own, the MCP context of a request does not carry over
+	host.Run(func() {
 		host.InitHttp()
 		host.CallOnHttpRequestHeaders([][2]string{
 			{":authority", "mcp-server.example.com"},
@@ -1551,7 +1549,7 @@ func BenchmarkRestMCPServer(b *testing.B) {
 		})
 		host.CallOnHttpRequestBody([]byte(toolsListRequest))
 		host.CompleteHttp()
-	}
+	})
 }
 
 // TestMcpProxyServerAllowTools 测试MCP代理服务器allowTools功能
@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCookie is returned for cookies that are malformed or not signed with the cookie secret
+	ErrInvalidCookie = errors.New("invalid cookie")
+	// ErrExpiredCookie is returned for cookies after their expiry
+	ErrExpiredCookie = errors.New("cookie is expired")
+)
+
+// CookieCodec signs the values kept in cookies with HMAC-SHA256, so that clients can read but not
+// forge the state of a login or a session
+type CookieCodec struct {
+	key []byte
+}
+
+// cookiePayload is the signed content of a cookie
+type cookiePayload struct {
+	Expiry int64           `json:"exp"`
+	Value  json.RawMessage `json:"v"`
+}
+
+// NewCookieCodec creates a codec signing with a key derived from secret
+func NewCookieCodec(secret []byte) *CookieCodec {
+	key := sha256.Sum256(append([]byte("oidc-cookie:"), secret...))
+	return &CookieCodec{key: key[:]}
+}
+
+// Encode returns the signed cookie value of v, valid until expiry
+func (c *CookieCodec) Encode(v interface{}, expiry time.Time) (string, error) {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(cookiePayload{Expiry: expiry.Unix(), Value: value})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded)), nil
+}
+
+// Decode verifies a cookie value encoded by Encode at a time and decodes it into v, numbers are
+// decoded as json.Number
+func (c *CookieCodec) Decode(value string, now time.Time, v interface{}) error {
+	encoded, signature, found := strings.Cut(value, ".")
+	if !found {
+		return ErrInvalidCookie
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, c.sign(encoded)) {
+		return ErrInvalidCookie
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+	var payload cookiePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return ErrInvalidCookie
+	}
+	if now.Unix() >= payload.Expiry {
+		return ErrExpiredCookie
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload.Value))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return ErrInvalidCookie
+	}
+	return nil
+}
+
+func (c *CookieCodec) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// randomString returns a URL safe random string of n random bytes, for states and nonces
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieCodec(t *testing.T) {
+	now := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	codec := NewCookieCodec([]byte("0123456789abcdef"))
+	value, err := codec.Encode(Session{Claims: map[string]interface{}{"sub": "user-1", "exp": 1700000000}}, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.NotContains(t, value, ";")
+
+	var session Session
+	require.NoError(t, codec.Decode(value, now, &session))
+	assert.Equal(t, "user-1", session.Claims["sub"])
+	assert.Equal(t, json.Number("1700000000"), session.Claims["exp"])
+
+	assert.ErrorIs(t, codec.Decode(value, now.Add(time.Minute), &session), ErrExpiredCookie)
+	assert.ErrorIs(t, NewCookieCodec([]byte("another secret!!")).Decode(value, now, &session), ErrInvalidCookie)
+	payload, signature, _ := strings.Cut(value, ".")
+	assert.ErrorIs(t, codec.Decode(payload+"x."+signature, now, &session), ErrInvalidCookie)
+	assert.ErrorIs(t, codec.Decode(payload, now, &session), ErrInvalidCookie)
+	assert.ErrorIs(t, codec.Decode("", now, &session), ErrInvalidCookie)
+}
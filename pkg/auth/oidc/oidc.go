@@ -0,0 +1,508 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc is the relying party of the OpenID Connect authorization code flow. A relying party
+// is configured as:
+//
+//	{
+//	  "issuer": "https://idp.example.com",
+//	  "authorizationEndpoint": "https://idp.example.com/authorize",
+//	  "tokenEndpoint": {"uri": "https://idp.example.com/token", "fqdn": "idp.dns", "port": 443},
+//	  "jwks": {"uri": "https://idp.example.com/.well-known/jwks.json", "fqdn": "idp.dns", "port": 443},
+//	  "clientId": "gateway",
+//	  "clientSecret": "secret",
+//	  "redirectUri": "https://gateway.example.com/oauth2/callback",
+//	  "scopes": ["openid", "email"],
+//	  "cookieSecret": "a long random string",
+//	  "consumerClaim": "sub"
+//	}
+//
+// Browsers without a session are redirected to the authorization endpoint, with the state and nonce
+// of the login kept in a signed state cookie. The code received on the redirect URI is exchanged at
+// the token endpoint, the ID token is verified with the JWKS, or with the client secret for HS256
+// when jwks is not set, and a signed session cookie holding its claims is issued before redirecting
+// back to the page the login started from. The session lasts sessionDuration seconds, 3600 by
+// default, at most until the ID token expires. Usage in onHttpRequestHeaders:
+//
+//	if action := config.oidc.Check(ctx); action != types.ActionContinue {
+//		return action
+//	}
+//	claims := jwt.Claims(ctx)
+//
+// The pieces of the flow, e.g. LoginRedirect, ExchangeCode and VerifyIDToken, may be used by plugins
+// driving the flow themselves.
+package oidc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/jwt"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	// FailureTokenEndpoint is the dependency of the failures to reach the token endpoint, see wrapper.WithFailurePolicy
+	FailureTokenEndpoint = "oidc_token_endpoint"
+	// SchemeOIDC is the scheme of the consumers set from the session claims
+	SchemeOIDC = "oidc"
+
+	defaultSessionCookie   = "oidc_session"
+	defaultStateCookie     = "oidc_state"
+	defaultSessionDuration = 3600 * time.Second
+	defaultStateDuration   = 600 * time.Second
+	defaultTokenTimeout    = 5000
+)
+
+// Client authentication methods at the token endpoint
+const (
+	ClientSecretBasic = "client_secret_basic"
+	ClientSecretPost  = "client_secret_post"
+)
+
+var (
+	// ErrInvalidState is returned for callbacks whose state does not match the state cookie
+	ErrInvalidState = errors.New("invalid state")
+	// ErrInvalidNonce is returned for ID tokens whose nonce does not match the state cookie
+	ErrInvalidNonce = errors.New("invalid nonce")
+)
+
+var defaultSessionClaims = []string{"sub", "email", "name", "preferred_username"}
+
+// State is the state of a login, kept in the state cookie during the redirect to the identity provider
+type State struct {
+	State string `json:"s"`
+	Nonce string `json:"n"`
+	// ReturnTo is the path and query the login started from
+	ReturnTo string `json:"r"`
+}
+
+// Session is the session of a logged in user, kept in the session cookie
+type Session struct {
+	Claims map[string]interface{} `json:"c"`
+}
+
+// RelyingParty drives the authorization code flow with an identity provider
+type RelyingParty struct {
+	authorizationEndpoint string
+	tokenURI              string
+	tokenClient           wrapper.HttpClient
+	tokenTimeout          uint32
+	clientID              string
+	clientSecret          string
+	clientAuth            string
+	redirectURI           string
+	redirectPath          string
+	scopes                []string
+	verifier              *jwt.Verifier
+	cookies               *CookieCodec
+	sessionCookie         string
+	stateCookie           string
+	sessionDuration       time.Duration
+	stateDuration         time.Duration
+	sessionClaims         []string
+	consumerClaim         string
+	now                   func() time.Time
+}
+
+// Parse parses a relying party from a config
+func Parse(json gjson.Result) (*RelyingParty, error) {
+	rp := &RelyingParty{
+		authorizationEndpoint: json.Get("authorizationEndpoint").String(),
+		clientID:              json.Get("clientId").String(),
+		clientSecret:          json.Get("clientSecret").String(),
+		clientAuth:            ClientSecretBasic,
+		redirectURI:           json.Get("redirectUri").String(),
+		scopes:                []string{"openid"},
+		sessionCookie:         defaultSessionCookie,
+		stateCookie:           defaultStateCookie,
+		sessionDuration:       defaultSessionDuration,
+		stateDuration:         defaultStateDuration,
+		sessionClaims:         defaultSessionClaims,
+		consumerClaim:         json.Get("consumerClaim").String(),
+		now:                   time.Now,
+	}
+	issuer := json.Get("issuer").String()
+	if issuer == "" {
+		return nil, configerr.Errorf("/issuer", "non-empty string", "the issuer is not set")
+	}
+	if u, err := url.Parse(rp.authorizationEndpoint); err != nil || u.Host == "" {
+		return nil, configerr.Errorf("/authorizationEndpoint", "absolute URL", "invalid authorization endpoint %q", rp.authorizationEndpoint)
+	}
+	if rp.clientID == "" {
+		return nil, configerr.Errorf("/clientId", "non-empty string", "the client id is not set")
+	}
+	redirect, err := url.Parse(rp.redirectURI)
+	if err != nil || redirect.Host == "" {
+		return nil, configerr.Errorf("/redirectUri", "absolute URL", "invalid redirect uri %q", rp.redirectURI)
+	}
+	rp.redirectPath = redirect.Path
+	cookieSecret := json.Get("cookieSecret").String()
+	if len(cookieSecret) < 16 {
+		return nil, configerr.Errorf("/cookieSecret", "string of at least 16 characters", "the cookie secret is too short")
+	}
+	rp.cookies = NewCookieCodec([]byte(cookieSecret))
+	if err := rp.parseTokenEndpoint(json.Get("tokenEndpoint")); err != nil {
+		return nil, err
+	}
+	if auth := json.Get("clientAuth"); auth.Exists() {
+		if auth.Str != ClientSecretBasic && auth.Str != ClientSecretPost {
+			return nil, configerr.Errorf("/clientAuth", "client_secret_basic or client_secret_post", "got %s", auth.Raw)
+		}
+		rp.clientAuth = auth.Str
+	}
+	if scopes := json.Get("scopes"); scopes.Exists() {
+		rp.scopes = nil
+		for i, scope := range scopes.Array() {
+			if scope.Type != gjson.String || scope.Str == "" {
+				return nil, configerr.Errorf(configerr.Pointer("scopes", i), "non-empty string", "got %s", scope.Raw)
+			}
+			rp.scopes = append(rp.scopes, scope.Str)
+		}
+		if !contains(rp.scopes, "openid") {
+			rp.scopes = append([]string{"openid"}, rp.scopes...)
+		}
+	}
+	if claims := json.Get("sessionClaims"); claims.Exists() {
+		rp.sessionClaims = nil
+		for _, claim := range claims.Array() {
+			rp.sessionClaims = append(rp.sessionClaims, claim.String())
+		}
+	}
+	if rp.consumerClaim != "" && !contains(rp.sessionClaims, rp.consumerClaim) {
+		rp.sessionClaims = append(rp.sessionClaims, rp.consumerClaim)
+	}
+	for name, field := range map[string]*string{"sessionCookie": &rp.sessionCookie, "stateCookie": &rp.stateCookie} {
+		if value := json.Get(name); value.Exists() {
+			if value.Str == "" || (&http.Cookie{Name: value.Str, Value: "v"}).String() == "" {
+				return nil, configerr.Errorf("/"+name, "cookie name", "got %s", value.Raw)
+			}
+			*field = value.Str
+		}
+	}
+	for name, field := range map[string]*time.Duration{"sessionDuration": &rp.sessionDuration, "stateDuration": &rp.stateDuration} {
+		if value := json.Get(name); value.Exists() {
+			if value.Type != gjson.Number || value.Int() <= 0 {
+				return nil, configerr.Errorf("/"+name, "positive seconds", "got %s", value.Raw)
+			}
+			*field = time.Duration(value.Int()) * time.Second
+		}
+	}
+	return rp, rp.parseVerifier(json, issuer)
+}
+
+// parseTokenEndpoint parses the token endpoint and the cluster it is called through
+func (rp *RelyingParty) parseTokenEndpoint(json gjson.Result) error {
+	rp.tokenURI = json.Get("uri").String()
+	u, err := url.Parse(rp.tokenURI)
+	if err != nil || u.Host == "" {
+		return configerr.Errorf("/tokenEndpoint/uri", "absolute URL", "invalid token endpoint %q", rp.tokenURI)
+	}
+	fqdn := json.Get("fqdn").String()
+	if fqdn == "" {
+		return configerr.Errorf("/tokenEndpoint/fqdn", "non-empty string", "the cluster of the token endpoint is not set")
+	}
+	port := json.Get("port").Int()
+	if port == 0 {
+		port = 443
+		if u.Scheme == "http" {
+			port = 80
+		}
+	}
+	rp.tokenTimeout = defaultTokenTimeout
+	if t := json.Get("timeout").Uint(); t > 0 {
+		rp.tokenTimeout = uint32(t)
+	}
+	rp.tokenClient = wrapper.NewClusterClient(wrapper.FQDNCluster{FQDN: fqdn, Host: u.Host, Port: port})
+	return nil
+}
+
+// parseVerifier creates the verifier of the ID tokens, issued by issuer for the client. Without jwks,
+// ID tokens are signed with HS256 and the client secret.
+func (rp *RelyingParty) parseVerifier(json gjson.Result, issuer string) error {
+	config, _ := sjson.Set("{}", "issuer", issuer)
+	config, _ = sjson.Set(config, "audiences", []string{rp.clientID})
+	if jwks := json.Get("jwks"); jwks.Exists() {
+		config, _ = sjson.SetRaw(config, "jwks", jwks.Raw)
+	} else if rp.clientSecret != "" {
+		config, _ = sjson.Set(config, "secret", rp.clientSecret)
+	} else {
+		return configerr.Errorf("/jwks", "jwks with keys or uri", "no keys to verify ID tokens are configured")
+	}
+	if algorithms := json.Get("algorithms"); algorithms.Exists() {
+		config, _ = sjson.SetRaw(config, "algorithms", algorithms.Raw)
+	}
+	verifier, err := jwt.Parse(gjson.Parse(config))
+	if err != nil {
+		return err
+	}
+	rp.verifier = verifier
+	return nil
+}
+
+// UnmarshalJSON parses the relying party of a config bound with encoding/json or wrapper.BindConfig
+func (rp *RelyingParty) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(gjson.ParseBytes(data))
+	if err != nil {
+		return err
+	}
+	*rp = *parsed
+	return nil
+}
+
+// SetHttpClient sets the client calling the token endpoint, e.g. a client with retries
+func (rp *RelyingParty) SetHttpClient(client wrapper.HttpClient) {
+	rp.tokenClient = client
+}
+
+// Warmup fetches the JWKS of the ID tokens, for wrapper.OnPluginWarmup
+func (rp *RelyingParty) Warmup(done func(err error)) {
+	rp.verifier.Warmup(done)
+}
+
+// RedirectPath returns the path of the redirect URI, where the identity provider sends the code
+func (rp *RelyingParty) RedirectPath() string {
+	return rp.redirectPath
+}
+
+// NewState creates the state of a login starting from returnTo, the path and query of the request
+func NewState(returnTo string) (*State, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	return &State{State: state, Nonce: nonce, ReturnTo: returnTo}, nil
+}
+
+// AuthorizationURL returns the URL of the authorization endpoint starting a login with state
+func (rp *RelyingParty) AuthorizationURL(state *State) string {
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {rp.clientID},
+		"redirect_uri":  {rp.redirectURI},
+		"scope":         {strings.Join(rp.scopes, " ")},
+		"state":         {state.State},
+		"nonce":         {state.Nonce},
+	}
+	separator := "?"
+	if strings.Contains(rp.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return rp.authorizationEndpoint + separator + query.Encode()
+}
+
+// LoginRedirect returns the redirect to the authorization endpoint starting a login from returnTo,
+// setting the state cookie
+func (rp *RelyingParty) LoginRedirect(returnTo string) (*wrapper.AuthDecision, error) {
+	state, err := NewState(returnTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login state: %v", err)
+	}
+	value, err := rp.cookies.Encode(state, rp.now().Add(rp.stateDuration))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode login state: %v", err)
+	}
+	cookie := wrapper.StateCookie(rp.stateCookie, value, rp.redirectPath, rp.stateDuration)
+	return wrapper.Redirect(rp.AuthorizationURL(state), cookie).WithDetail("oidc.login"), nil
+}
+
+// SessionCookie returns the session cookie of a verified ID token, expiring after sessionDuration or
+// when the token expires
+func (rp *RelyingParty) SessionCookie(token *jwt.Token) (*http.Cookie, error) {
+	now := rp.now()
+	expiry := now.Add(rp.sessionDuration)
+	if exp, ok := token.Claims["exp"].(interface{ Int64() (int64, error) }); ok {
+		if seconds, err := exp.Int64(); err == nil && time.Unix(seconds, 0).Before(expiry) {
+			expiry = time.Unix(seconds, 0)
+		}
+	}
+	session := Session{Claims: map[string]interface{}{}}
+	for _, claim := range rp.sessionClaims {
+		if value, ok := token.Claims[claim]; ok {
+			session.Claims[claim] = value
+		}
+	}
+	value, err := rp.cookies.Encode(session, expiry)
+	if err != nil {
+		return nil, err
+	}
+	return wrapper.StateCookie(rp.sessionCookie, value, "/", expiry.Sub(now)), nil
+}
+
+// Session returns the session of the current request
+func (rp *RelyingParty) Session() (*Session, error) {
+	value := wrapper.GetRequestCookie(rp.sessionCookie)
+	if value == "" {
+		return nil, http.ErrNoCookie
+	}
+	var session Session
+	if err := rp.cookies.Decode(value, rp.now(), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Check lets the requests of a session through, setting its claims in the context, and its consumer
+// if consumerClaim is set. The callbacks of the identity provider on the redirect URI complete the
+// login. Other GET requests are redirected to the identity provider, other methods are rejected with
+// 401. The failures to reach the token endpoint fail closed unless the failure policy of
+// FailureTokenEndpoint explicitly sets FailOpen.
+func (rp *RelyingParty) Check(ctx wrapper.HttpContext) types.Action {
+	path, _ := proxywasm.GetHttpRequestHeader(":path")
+	u, err := url.Parse(path)
+	if err != nil {
+		return wrapper.Unauthorized().WithDetail("oidc.invalid_path").Send()
+	}
+	if u.Path == rp.redirectPath {
+		return rp.handleCallback(ctx, u.Query())
+	}
+	session, err := rp.Session()
+	if err == nil {
+		ctx.SetContext(jwt.CtxKeyClaims, session.Claims)
+		if rp.consumerClaim != "" {
+			if name, _ := session.Claims[rp.consumerClaim].(string); name != "" {
+				ctx.SetConsumer(&wrapper.Consumer{Name: name, Scheme: SchemeOIDC, Claims: session.Claims})
+			} else {
+				ctx.SetConsumer(nil)
+			}
+		}
+		return types.ActionContinue
+	}
+	if rp.consumerClaim != "" {
+		ctx.SetConsumer(nil)
+	}
+	log.Debugf("no oidc session: %v", err)
+	if method := ctx.Method(); method != "GET" && method != "HEAD" {
+		return wrapper.Unauthorized().WithDetail("oidc.unauthorized").Send()
+	}
+	decision, err := rp.LoginRedirect(path)
+	if err != nil {
+		log.Errorf("%v", err)
+		return wrapper.Unauthorized().WithDetail("oidc.unauthorized").Send()
+	}
+	return decision.Send()
+}
+
+// handleCallback completes the login of a callback of the identity provider
+func (rp *RelyingParty) handleCallback(ctx wrapper.HttpContext, query url.Values) types.Action {
+	clearState := wrapper.ClearCookie(rp.stateCookie, rp.redirectPath)
+	if e := query.Get("error"); e != "" {
+		log.Infof("oidc login failed: %s %s", e, query.Get("error_description"))
+		return wrapper.Unauthorized().WithCookies(clearState).WithDetail("oidc.login_error").Send()
+	}
+	var state State
+	if err := rp.cookies.Decode(wrapper.GetRequestCookie(rp.stateCookie), rp.now(), &state); err != nil ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		log.Infof("oidc callback rejected: %v", ErrInvalidState)
+		return wrapper.Unauthorized().WithCookies(clearState).WithDetail("oidc.invalid_state").Send()
+	}
+	code := query.Get("code")
+	if code == "" {
+		return wrapper.Unauthorized().WithCookies(clearState).WithDetail("oidc.no_code").Send()
+	}
+	done, pending := false, false
+	action := types.ActionContinue
+	finish := func(a types.Action) {
+		done, action = true, a
+		if pending && action == types.ActionContinue {
+			_ = proxywasm.ResumeHttpRequest()
+		}
+	}
+	err := rp.ExchangeCode(code, func(idToken string, err error) {
+		if err != nil {
+			finish(rp.handleExchangeError(ctx, err, clearState))
+			return
+		}
+		rp.VerifyIDToken(idToken, state.Nonce, func(token *jwt.Token, err error) {
+			if err != nil {
+				log.Infof("oidc ID token rejected: %v", err)
+				finish(wrapper.Unauthorized().WithCookies(clearState).WithDetail("oidc.invalid_id_token").Send())
+				return
+			}
+			finish(rp.completeLogin(token, &state, clearState))
+		})
+	})
+	if err != nil {
+		return rp.handleExchangeError(ctx, err, clearState)
+	}
+	if done {
+		return action
+	}
+	// The token endpoint or the JWKS is being called, the request waits for the callback
+	pending = true
+	return types.HeaderStopAllIterationAndWatermark
+}
+
+// handleExchangeError rejects the callback when the code is refused, and follows the failure policy
+// when the token endpoint cannot be reached: the callback is rejected with the status of the policy,
+// 503 by default, unless the policy explicitly sets FailOpen, which continues it without identity
+func (rp *RelyingParty) handleExchangeError(ctx wrapper.HttpContext, err error, clearState *http.Cookie) types.Action {
+	var unavailable *tokenEndpointError
+	if errors.As(err, &unavailable) {
+		if ctx.HandleSecurityFailure(FailureTokenEndpoint, unavailable.err) == wrapper.FailClosed {
+			return types.ActionPause
+		}
+		// The identity sent by the client must not reach the upstream
+		if rp.consumerClaim != "" {
+			ctx.SetConsumer(nil)
+		}
+		return types.ActionContinue
+	}
+	log.Infof("oidc code exchange failed: %v", err)
+	return wrapper.Unauthorized().WithCookies(clearState).WithDetail("oidc.code_exchange_failed").Send()
+}
+
+// completeLogin issues the session cookie and redirects back to the page the login started from
+func (rp *RelyingParty) completeLogin(token *jwt.Token, state *State, clearState *http.Cookie) types.Action {
+	session, err := rp.SessionCookie(token)
+	if err != nil {
+		log.Errorf("failed to encode oidc session: %v", err)
+		return wrapper.Unauthorized().WithCookies(clearState).WithDetail("oidc.session_error").Send()
+	}
+	return wrapper.Redirect(safeReturnTo(state.ReturnTo), session, clearState).WithDetail("oidc.logged_in").Send()
+}
+
+// safeReturnTo returns the local path to return to after a login, so that the state cannot redirect
+// to another site
+func safeReturnTo(returnTo string) string {
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		return "/"
+	}
+	return returnTo
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/jwt"
+)
+
+// tokenEndpointError is a failure to reach the token endpoint, as opposed to a code it refused
+type tokenEndpointError struct {
+	err error
+}
+
+func (e *tokenEndpointError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tokenEndpointError) Unwrap() error {
+	return e.err
+}
+
+// ExchangeCode exchanges an authorization code for an ID token at the token endpoint. The callback is
+// called when the token endpoint responds, the returned error is set when it cannot be called.
+func (rp *RelyingParty) ExchangeCode(code string, callback func(idToken string, err error)) error {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {rp.redirectURI},
+	}
+	headers := [][2]string{
+		{"content-type", "application/x-www-form-urlencoded"},
+		{"accept", "application/json"},
+	}
+	if rp.clientAuth == ClientSecretPost {
+		form.Set("client_id", rp.clientID)
+		form.Set("client_secret", rp.clientSecret)
+	} else {
+		// The credentials are form encoded before the basic encoding (RFC 6749 section 2.3.1)
+		credentials := url.QueryEscape(rp.clientID) + ":" + url.QueryEscape(rp.clientSecret)
+		headers = append(headers, [2]string{"authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))})
+	}
+	err := rp.tokenClient.Post(rp.tokenURI, headers, []byte(form.Encode()), func(statusCode int, _ http.Header, body []byte) {
+		if statusCode == 0 || statusCode >= http.StatusInternalServerError {
+			callback("", &tokenEndpointError{fmt.Errorf("token endpoint %s responded with status %d", rp.tokenURI, statusCode)})
+			return
+		}
+		response := gjson.ParseBytes(body)
+		if statusCode != http.StatusOK {
+			callback("", fmt.Errorf("code exchange rejected with status %d: %s", statusCode, response.Get("error").String()))
+			return
+		}
+		idToken := response.Get("id_token").String()
+		if idToken == "" {
+			callback("", fmt.Errorf("no id_token in the response of the token endpoint"))
+			return
+		}
+		callback(idToken, nil)
+	}, rp.tokenTimeout)
+	if err != nil {
+		return &tokenEndpointError{fmt.Errorf("failed to call token endpoint %s: %v", rp.tokenURI, err)}
+	}
+	return nil
+}
+
+// VerifyIDToken verifies the signature, issuer, audience and expiry of an ID token, and that it was
+// issued for the login of nonce
+func (rp *RelyingParty) VerifyIDToken(raw, nonce string, callback func(token *jwt.Token, err error)) {
+	rp.verifier.Verify(raw, func(token *jwt.Token, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+		claim, _ := token.Claims["nonce"].(string)
+		if subtle.ConstantTimeCompare([]byte(claim), []byte(nonce)) != 1 {
+			callback(nil, ErrInvalidNonce)
+			return
+		}
+		callback(token, nil)
+	})
+}
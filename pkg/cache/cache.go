@@ -0,0 +1,223 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache stores typed values in the shared data of the plugin VMs, so that the worker threads
+// of a gateway share state such as quotas or the nonces already seen:
+//
+//	nonces := cache.NewSharedCache[bool]("my-plugin:nonces", 5*time.Minute)
+//	if added, err := nonces.Add(nonce, true); err == nil && !added {
+//		// replayed request
+//	}
+//
+// Values are stored as JSON with their expiry time. Updates read the value and write it back with its
+// CAS, and are retried when another VM wrote it in between, missing keys included. Shared data entries cannot be removed,
+// expired and deleted entries keep their key with an empty value until they are set again, so keys
+// should be taken from a bounded set.
+//
+// Fetcher deduplicates and throttles the fetches of values cached by a single VM.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// maxCasRetries bounds the read-modify-write retries on concurrent updates from other VMs
+const maxCasRetries = 10
+
+// missingCas is the CAS of a missing key. It fails once another VM created the key, while CAS 0 would
+// overwrite it unconditionally.
+const missingCas = math.MaxUint32
+
+// entry is the value stored in shared data
+type entry[T any] struct {
+	Value T `json:"v"`
+	// ExpiresAt is the expiry time in Unix milliseconds, 0 if the value does not expire
+	ExpiresAt int64 `json:"e,omitempty"`
+}
+
+// SharedCache stores values of type T under the keys of a namespace, e.g. the name of the plugin
+type SharedCache[T any] struct {
+	namespace string
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// NewSharedCache creates a cache whose values expire after ttl, or never if ttl is 0
+func NewSharedCache[T any](namespace string, ttl time.Duration) *SharedCache[T] {
+	return &SharedCache[T]{namespace: namespace, ttl: ttl, now: time.Now}
+}
+
+func (c *SharedCache[T]) sharedDataKey(key string) string {
+	return c.namespace + ":" + key
+}
+
+// load reads the entry of a key and its CAS, the entry is nil if the key is missing or expired
+func (c *SharedCache[T]) load(key string) (*entry[T], uint32, error) {
+	data, cas, err := proxywasm.GetSharedData(c.sharedDataKey(key))
+	if err != nil {
+		if errors.Is(err, types.ErrorStatusNotFound) {
+			return nil, missingCas, nil
+		}
+		return nil, 0, fmt.Errorf("failed to get %s from shared data: %v", key, err)
+	}
+	if len(data) == 0 {
+		return nil, cas, nil
+	}
+	var e entry[T]
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Warnf("discarding malformed value of %s in shared data: %v", key, err)
+		return nil, cas, nil
+	}
+	if e.ExpiresAt > 0 && c.now().UnixMilli() >= e.ExpiresAt {
+		return nil, cas, nil
+	}
+	return &e, cas, nil
+}
+
+// store writes the entry of a key, an empty value for a nil entry, and tells whether the CAS matched
+func (c *SharedCache[T]) store(key string, e *entry[T], cas uint32) (bool, error) {
+	var data []byte
+	if e != nil {
+		var err error
+		if data, err = json.Marshal(e); err != nil {
+			return false, fmt.Errorf("failed to marshal %s: %v", key, err)
+		}
+	}
+	err := proxywasm.SetSharedData(c.sharedDataKey(key), data, cas)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, types.ErrorStatusCasMismatch) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to set %s to shared data: %v", key, err)
+}
+
+// expiresAt returns the expiry time of a value written now with ttl
+func (c *SharedCache[T]) expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return c.now().Add(ttl).UnixMilli()
+}
+
+// Get returns the value of a key, false if it is missing or expired
+func (c *SharedCache[T]) Get(key string) (T, bool, error) {
+	var zero T
+	e, _, err := c.load(key)
+	if err != nil || e == nil {
+		return zero, false, err
+	}
+	return e.Value, true, nil
+}
+
+// Set sets the value of a key with the TTL of the cache
+func (c *SharedCache[T]) Set(key string, value T) error {
+	return c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL sets the value of a key expiring after ttl, or never if ttl is 0
+func (c *SharedCache[T]) SetWithTTL(key string, value T, ttl time.Duration) error {
+	_, err := c.modify(key, func(*entry[T]) (*entry[T], error) {
+		return &entry[T]{Value: value, ExpiresAt: c.expiresAt(ttl)}, nil
+	})
+	return err
+}
+
+// Add sets the value of a key with the TTL of the cache unless the key already has a value that has
+// not expired, and tells whether it did
+func (c *SharedCache[T]) Add(key string, value T) (bool, error) {
+	added := false
+	_, err := c.modify(key, func(current *entry[T]) (*entry[T], error) {
+		if current != nil {
+			added = false
+			return current, nil
+		}
+		added = true
+		return &entry[T]{Value: value, ExpiresAt: c.expiresAt(c.ttl)}, nil
+	})
+	return added && err == nil, err
+}
+
+// Update replaces the value of a key with the value returned by f, which is given the current value
+// and whether there is one. A value that has not expired keeps its expiry time, a new value expires
+// with the TTL of the cache. f may be called several times when other VMs update the key
+// concurrently, and nothing is written if it returns an error. Update returns the value written.
+func (c *SharedCache[T]) Update(key string, f func(value T, ok bool) (T, error)) (T, error) {
+	return c.UpdateWithTTL(key, c.ttl, f)
+}
+
+// UpdateWithTTL is Update with the TTL of a new value
+func (c *SharedCache[T]) UpdateWithTTL(key string, ttl time.Duration, f func(value T, ok bool) (T, error)) (T, error) {
+	var zero T
+	e, err := c.modify(key, func(current *entry[T]) (*entry[T], error) {
+		var value T
+		next := &entry[T]{ExpiresAt: c.expiresAt(ttl)}
+		if current != nil {
+			value, next.ExpiresAt = current.Value, current.ExpiresAt
+		}
+		var err error
+		if next.Value, err = f(value, current != nil); err != nil {
+			return nil, err
+		}
+		return next, nil
+	})
+	if err != nil || e == nil {
+		return zero, err
+	}
+	return e.Value, nil
+}
+
+// Delete removes the value of a key, a missing key is left as is
+func (c *SharedCache[T]) Delete(key string) error {
+	_, err := c.modify(key, func(*entry[T]) (*entry[T], error) {
+		return nil, nil
+	})
+	return err
+}
+
+// modify writes the entry returned by f for the current entry of a key, retrying on concurrent updates
+func (c *SharedCache[T]) modify(key string, f func(current *entry[T]) (*entry[T], error)) (*entry[T], error) {
+	for i := 0; i < maxCasRetries; i++ {
+		current, cas, err := c.load(key)
+		if err != nil {
+			return nil, err
+		}
+		next, err := f(current)
+		if err != nil {
+			return nil, err
+		}
+		if next == current {
+			// Nothing to write, e.g. a missing key is deleted
+			return current, nil
+		}
+		ok, err := c.store(key, next, cas)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return next, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to update %s after %d retries due to concurrent updates", key, maxCasRetries)
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+type quota struct {
+	Used  int64  `json:"used"`
+	Owner string `json:"owner"`
+}
+
+func newTestHost() func() {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("cache-test")))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	return reset
+}
+
+func TestSharedCache(t *testing.T) {
+	defer newTestHost()()
+	now := time.UnixMilli(1_800_000_000_000)
+	c := NewSharedCache[quota]("test:quotas", time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, ok, err := c.Get("alice")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Set("alice", quota{Used: 1, Owner: "alice"}))
+	value, ok, err := c.Get("alice")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, quota{Used: 1, Owner: "alice"}, value)
+	data, _, err := proxywasm.GetSharedData("test:quotas:alice")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"v":{"used":1,"owner":"alice"},"e":1800000060000}`, string(data))
+
+	// Namespaces are separate
+	other := NewSharedCache[quota]("test:other", 0)
+	_, ok, err = other.Get("alice")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	now = now.Add(time.Minute)
+	_, ok, err = c.Get("alice")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.SetWithTTL("bob", quota{Used: 2}, 0))
+	now = now.Add(time.Hour)
+	_, ok, err = c.Get("bob")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, c.Delete("bob"))
+	_, ok, err = c.Get("bob")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Deleting a missing key writes nothing
+	require.NoError(t, c.Delete("carol"))
+	_, _, err = proxywasm.GetSharedData("test:quotas:carol")
+	assert.ErrorIs(t, err, types.ErrorStatusNotFound)
+}
+
+func TestSharedCacheAdd(t *testing.T) {
+	defer newTestHost()()
+	now := time.UnixMilli(1_800_000_000_000)
+	nonces := NewSharedCache[bool]("test:nonces", 5*time.Minute)
+	nonces.now = func() time.Time { return now }
+
+	added, err := nonces.Add("n1", true)
+	require.NoError(t, err)
+	assert.True(t, added)
+	added, err = nonces.Add("n1", true)
+	require.NoError(t, err)
+	assert.False(t, added)
+
+	now = now.Add(5 * time.Minute)
+	added, err = nonces.Add("n1", true)
+	require.NoError(t, err)
+	assert.True(t, added)
+}
+
+func TestSharedCacheUpdate(t *testing.T) {
+	defer newTestHost()()
+	now := time.UnixMilli(1_800_000_000_000)
+	c := NewSharedCache[int64]("test:counters", time.Minute)
+	c.now = func() time.Time { return now }
+	incr := func(value int64, ok bool) (int64, error) { return value + 1, nil }
+
+	value, err := c.Update("k", incr)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+
+	// The update keeps the expiry time of the value
+	now = now.Add(30 * time.Second)
+	value, err = c.Update("k", incr)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+	now = now.Add(30 * time.Second)
+	value, err = c.Update("k", incr)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+
+	// A new value expires with the TTL of the update
+	value, err = c.UpdateWithTTL("short", time.Second, incr)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+	now = now.Add(time.Second)
+	_, ok, err := c.Get("short")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Concurrent updates of another VM are retried on
+	calls := 0
+	value, err = c.Update("k", func(value int64, ok bool) (int64, error) {
+		calls++
+		if calls == 1 {
+			require.NoError(t, c.Set("k", 10))
+		}
+		return value + 1, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), value)
+	assert.Equal(t, 2, calls)
+
+	// So is a missing key created by another VM in the meantime, which is written with a CAS that fails
+	// once the key exists
+	_, cas, err := c.load("new")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(missingCas), cas)
+	calls = 0
+	value, err = c.Update("new", func(value int64, ok bool) (int64, error) {
+		calls++
+		if calls == 1 {
+			assert.False(t, ok)
+			require.NoError(t, c.Set("new", 10))
+		}
+		return value + 1, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), value)
+	assert.Equal(t, 2, calls)
+
+	_, err = c.Update("k", func(value int64, ok bool) (int64, error) {
+		require.NoError(t, c.Set("k", value))
+		return value + 1, nil
+	})
+	assert.ErrorContains(t, err, "after 10 retries")
+
+	failed := errors.New("quota exceeded")
+	_, err = c.Update("k", func(int64, bool) (int64, error) { return 0, failed })
+	assert.ErrorIs(t, err, failed)
+	value, _, _ = c.Get("k")
+	assert.Equal(t, int64(11), value)
+
+	// Malformed values are discarded
+	_, cas, _ = proxywasm.GetSharedData("test:counters:k")
+	require.NoError(t, proxywasm.SetSharedData("test:counters:k", []byte("{"), cas))
+	_, ok, err = c.Get("k")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, c.Set("k", 3))
+}
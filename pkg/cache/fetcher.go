@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import "time"
+
+// Fetcher runs the fetches of a value cached by a VM, e.g. the keys of a JWKS or an access token. The
+// callers waiting for the value share a single fetch in flight, fetches are started at least
+// minInterval apart, and a failed fetch falls back to the previous value while it is still usable.
+// The cached value itself and when it must be fetched again are left to the owner of the Fetcher.
+type Fetcher[T any] struct {
+	minInterval time.Duration
+	now         func() time.Time
+	// fallback returns the value passed to the waiters of a failed fetch, false if there is none
+	fallback func(err error) (T, bool)
+
+	// attemptedAt is the start of the last fetch, and lastErr its error
+	attemptedAt time.Time
+	lastErr     error
+	fetching    bool
+	waiters     []func(value T, err error)
+}
+
+// NewFetcher creates a Fetcher whose fetches start at least minInterval apart on the clock now.
+// fallback is called when a fetch fails, it returns the value to use instead, typically the previous
+// value if it has not expired, or false to pass the error to the waiters.
+func NewFetcher[T any](minInterval time.Duration, now func() time.Time, fallback func(err error) (T, bool)) *Fetcher[T] {
+	return &Fetcher[T]{minInterval: minInterval, now: now, fallback: fallback}
+}
+
+// CanFetch tells whether a fetch is in flight or may be started
+func (f *Fetcher[T]) CanFetch() bool {
+	return f.fetching || f.now().Sub(f.attemptedAt) >= f.minInterval
+}
+
+// Err returns the error of the last fetch, nil if it succeeded
+func (f *Fetcher[T]) Err() error {
+	return f.lastErr
+}
+
+// Fetch calls callback with the result of the fetch in flight, or of a fetch started with start.
+// callback may be nil for a refresh in the background. start must call done exactly once, with the
+// fetched value or the error of the fetch.
+func (f *Fetcher[T]) Fetch(callback func(value T, err error), start func(done func(value T, err error))) {
+	if callback != nil {
+		f.waiters = append(f.waiters, callback)
+	}
+	if f.fetching {
+		return
+	}
+	f.fetching = true
+	f.attemptedAt = f.now()
+	start(f.done)
+}
+
+// done calls the waiters of a fetch, with the fallback value if the fetch failed
+func (f *Fetcher[T]) done(value T, err error) {
+	f.fetching = false
+	f.lastErr = err
+	if err != nil {
+		if previous, ok := f.fallback(err); ok {
+			value, err = previous, nil
+		}
+	}
+	waiters := f.waiters
+	f.waiters = nil
+	for _, waiter := range waiters {
+		waiter(value, err)
+	}
+}
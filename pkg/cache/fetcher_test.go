@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetcher(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	previous := ""
+	f := NewFetcher(time.Minute, func() time.Time { return now }, func(err error) (string, bool) {
+		return previous, previous != ""
+	})
+	var pending []func(value string, err error)
+	start := func(done func(value string, err error)) { pending = append(pending, done) }
+	type result struct {
+		value string
+		err   error
+	}
+	var results []result
+	callback := func(value string, err error) { results = append(results, result{value, err}) }
+
+	// Concurrent callers share a single fetch
+	assert.True(t, f.CanFetch())
+	f.Fetch(callback, start)
+	f.Fetch(callback, start)
+	f.Fetch(nil, start)
+	require.Len(t, pending, 1)
+	assert.True(t, f.CanFetch(), "the fetch in flight can be waited for")
+	pending[0]("v1", nil)
+	assert.Equal(t, []result{{"v1", nil}, {"v1", nil}}, results)
+	assert.NoError(t, f.Err())
+
+	// Fetches start at least the minimum interval apart
+	assert.False(t, f.CanFetch())
+	now = now.Add(time.Minute)
+	assert.True(t, f.CanFetch())
+
+	// A failed fetch returns its error without a previous value to fall back to
+	results = nil
+	fetchErr := errors.New("unavailable")
+	f.Fetch(callback, start)
+	require.Len(t, pending, 2)
+	pending[1]("", fetchErr)
+	assert.Equal(t, []result{{"", fetchErr}}, results)
+	assert.Equal(t, fetchErr, f.Err())
+	assert.False(t, f.CanFetch())
+
+	// and the previous value otherwise, the error is kept for the callers that cannot fetch
+	results = nil
+	previous = "v1"
+	now = now.Add(time.Minute)
+	f.Fetch(callback, start)
+	pending[2]("", fetchErr)
+	assert.Equal(t, []result{{"v1", nil}}, results)
+	assert.Equal(t, fetchErr, f.Err())
+
+	// A fetch failing at once still calls its waiters
+	results = nil
+	now = now.Add(time.Minute)
+	previous = ""
+	f.Fetch(callback, func(done func(value string, err error)) { done("", fetchErr) })
+	assert.Equal(t, []result{{"", fetchErr}}, results)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configerr reports plugin configuration errors together with the JSON pointer
+// (RFC 6901) of the offending field and the expected type, so that an invalid field
+// can be located directly from the error logged at plugin start.
+package configerr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is matched by every configuration error, errors.Is(err, ErrInvalid) tells configuration
+// errors apart from other failures
+var ErrInvalid = errors.New("invalid config")
+
+// Error is a configuration error located by a JSON pointer
+type Error struct {
+	Pointer  string // JSON pointer of the offending field, empty for the document root
+	Expected string // Expected JSON type or value, empty when not applicable
+	Err      error
+}
+
+// New creates a configuration error for the field at pointer
+func New(pointer, expected string, err error) *Error {
+	return &Error{Pointer: pointer, Expected: expected, Err: err}
+}
+
+// Errorf creates a configuration error for the field at pointer with a formatted message
+func Errorf(pointer, expected, format string, args ...interface{}) *Error {
+	return New(pointer, expected, fmt.Errorf(format, args...))
+}
+
+func (e *Error) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	var sb strings.Builder
+	sb.WriteString("invalid config at ")
+	sb.WriteString(strconv.Quote(pointer))
+	if e.Expected != "" {
+		sb.WriteString(", expected ")
+		sb.WriteString(e.Expected)
+	}
+	if e.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInvalid, so that errors.Is(err, ErrInvalid) holds for every configuration
+// error however it is wrapped
+func (e *Error) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+var tokenEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// Join appends reference tokens to a JSON pointer, escaping them as required by RFC 6901.
+// Tokens may be strings or integers (array indexes).
+func Join(pointer string, tokens ...interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(pointer)
+	for _, token := range tokens {
+		sb.WriteByte('/')
+		switch t := token.(type) {
+		case string:
+			sb.WriteString(tokenEscaper.Replace(t))
+		default:
+			sb.WriteString(fmt.Sprint(t))
+		}
+	}
+	return sb.String()
+}
+
+// Pointer builds a JSON pointer from reference tokens, e.g. Pointer("server", "tools", 0) is "/server/tools/0"
+func Pointer(tokens ...interface{}) string {
+	return Join("", tokens...)
+}
+
+// Prefix locates err under the field at pointer. A configuration error keeps its relative pointer
+// below pointer; any other error is reported at pointer itself. Return configuration errors to
+// the caller unwrapped so that enclosing fields can be prefixed. Nil errors stay nil.
+func Prefix(pointer string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if cfgErr, ok := err.(*Error); ok {
+		return &Error{Pointer: pointer + cfgErr.Pointer, Expected: cfgErr.Expected, Err: cfgErr.Err}
+	}
+	return New(pointer, "", err)
+}
+
+// DecodeJSON unmarshals the config field at pointer into v. Type mismatches are reported at
+// the pointer of the mismatched nested field along with the JSON type the field should have.
+func DecodeJSON(pointer string, data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		fieldPointer := pointer
+		if typeErr.Field != "" {
+			for _, token := range strings.Split(typeErr.Field, ".") {
+				fieldPointer = Join(fieldPointer, token)
+			}
+		}
+		return Errorf(fieldPointer, jsonTypeName(typeErr.Type), "got %s", typeErr.Value)
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return New(pointer, "valid JSON", err)
+	}
+	return New(pointer, "", err)
+}
+
+// jsonTypeName returns the JSON type that decodes into the given Go type
+func jsonTypeName(t reflect.Type) string {
+	if t == nil {
+		return ""
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "base64 string"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	}
+	return t.String()
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configerr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPointer(t *testing.T) {
+	assert.Equal(t, "/server/tools/0/name", Pointer("server", "tools", 0, "name"))
+	assert.Equal(t, "/headers/a~1b/c~0d", Pointer("headers", "a/b", "c~d"))
+	assert.Equal(t, "/server/timeout", Join("/server", "timeout"))
+	assert.Equal(t, "", Pointer())
+}
+
+func TestError(t *testing.T) {
+	err := New("/server/timeout", "integer", errors.New("got string"))
+	assert.Equal(t, `invalid config at "/server/timeout", expected integer: got string`, err.Error())
+	assert.Equal(t, `invalid config at "/": missing server`, New("", "", errors.New("missing server")).Error())
+}
+
+func TestPrefix(t *testing.T) {
+	assert.Nil(t, Prefix("/server", nil))
+
+	err := Prefix("/server", New("/backendSession/persist", "boolean", errors.New("got string")))
+	assert.Equal(t, `invalid config at "/server/backendSession/persist", expected boolean: got string`, err.Error())
+	err = Prefix("/_rules_/0", err)
+	assert.Equal(t, `invalid config at "/_rules_/0/server/backendSession/persist", expected boolean: got string`, err.Error())
+
+	plain := errors.New("tool name is required")
+	err = Prefix("/tools/1", plain)
+	var cfgErr *Error
+	assert.True(t, errors.As(err, &cfgErr))
+	assert.Equal(t, "/tools/1", cfgErr.Pointer)
+	assert.ErrorIs(t, err, plain)
+}
+
+func TestDecodeJSON(t *testing.T) {
+	type arg struct {
+		Name     string `json:"name"`
+		Required bool   `json:"required"`
+	}
+	type tool struct {
+		Name    string            `json:"name"`
+		Timeout int               `json:"timeout"`
+		Args    []arg             `json:"args"`
+		Headers map[string]string `json:"headers"`
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		pointer  string
+		expected string
+	}{
+		{"valid", `{"name": "weather", "timeout": 1000}`, "", ""},
+		{"top level field", `{"timeout": "1s"}`, "/tools/0/timeout", "integer"},
+		{"nested struct field", `{"args": [{"required": "yes"}]}`, "/tools/0/args/0/required", "boolean"},
+		{"array field", `{"args": {"name": "city"}}`, "/tools/0/args", "array"},
+		{"map value", `{"headers": {"x-api-key": 1}}`, "/tools/0/headers/x-api-key", "string"},
+		{"root value", `[]`, "/tools/0", "object"},
+		{"syntax error", `{"name": }`, "/tools/0", "valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v tool
+			err := DecodeJSON("/tools/0", []byte(tt.data), &v)
+			if tt.pointer == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var cfgErr *Error
+			if assert.True(t, errors.As(err, &cfgErr), "unexpected error: %v", err) {
+				assert.Equal(t, tt.pointer, cfgErr.Pointer)
+				assert.Equal(t, tt.expected, cfgErr.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consumer authenticates the consumers of a plugin config by their credentials: API keys,
+// Basic credentials, JWTs signed with HS256 or HMAC signatures. The consumers are configured as:
+//
+//	{
+//	  "keySources": [{"in": "header", "name": "x-api-key"}],
+//	  "consumers": [
+//	    {"name": "alice", "keys": ["sk-alice"]},
+//	    {"name": "bob", "basic": {"username": "bob", "password": "secret"}},
+//	    {"name": "svc", "jwt": {"issuer": "https://idp.example.com", "secret": "...", "audience": "gateway"}},
+//	    {"name": "partner", "hmac": {"accessKey": "ak", "secretKey": "sk"}}
+//	  ]
+//	}
+//
+// API keys are read from the key sources, Authorization: Bearer <key> and x-api-key by default. The
+// consumer of an authenticated request is set with HttpContext.SetConsumer, so that handlers and
+// later plugins get it from HttpContext.Consumer() and the x-mse-consumer header. Usage in
+// onHttpRequestHeaders:
+//
+//	if action := config.consumers.Check(ctx); action != types.ActionContinue {
+//		return action
+//	}
+package consumer
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// Schemes of the credentials
+const (
+	SchemeKey   = "key"
+	SchemeBasic = "basic"
+	SchemeJWT   = "jwt"
+	SchemeHMAC  = "hmac"
+)
+
+const (
+	// UnauthorizedStatus is the status of the requests rejected by Check
+	UnauthorizedStatus = 401
+	// defaultClockSkew is the tolerance of the times of JWTs and signed dates
+	defaultClockSkew = 5 * time.Minute
+)
+
+var (
+	// ErrNoCredential is returned for requests without any credential
+	ErrNoCredential = errors.New("no credential")
+	// ErrInvalidCredential is returned for requests whose credential matches no consumer
+	ErrInvalidCredential = errors.New("invalid credential")
+)
+
+// KeySource is where API keys are read from
+type KeySource struct {
+	// In is header or query
+	In   string `json:"in"`
+	Name string `json:"name"`
+	// Prefix is removed from the value, e.g. "Bearer "
+	Prefix string `json:"prefix,omitempty"`
+}
+
+var defaultKeySources = []KeySource{
+	{In: "header", Name: "authorization", Prefix: "Bearer "},
+	{In: "header", Name: "x-api-key"},
+}
+
+// BasicCredential is the username and password of a consumer
+type BasicCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// JWTCredential identifies a consumer by the JWTs of an issuer signed with HS256
+type JWTCredential struct {
+	Issuer string `json:"issuer"`
+	Secret string `json:"secret"`
+	// Audience, if set, must be in the aud claim of the tokens
+	Audience string `json:"audience,omitempty"`
+}
+
+// HMACCredential identifies a consumer by the HMAC signatures of its requests
+type HMACCredential struct {
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+// ConsumerConfig is a consumer and its credentials
+type ConsumerConfig struct {
+	Name  string           `json:"name"`
+	Keys  []string         `json:"keys,omitempty"`
+	Basic *BasicCredential `json:"basic,omitempty"`
+	JWT   *JWTCredential   `json:"jwt,omitempty"`
+	HMAC  *HMACCredential  `json:"hmac,omitempty"`
+}
+
+// Authenticator matches the credentials of requests with the consumers
+type Authenticator struct {
+	keySources []KeySource
+	clockSkew  time.Duration
+	keys       map[string]string
+	basic      map[string]*ConsumerConfig
+	jwt        map[string][]*ConsumerConfig // by issuer
+	hmac       map[string]*ConsumerConfig   // by access key
+	now        func() time.Time
+}
+
+// Parse parses the consumers of a config
+func Parse(json gjson.Result) (*Authenticator, error) {
+	a := &Authenticator{
+		keySources: defaultKeySources,
+		clockSkew:  defaultClockSkew,
+		keys:       map[string]string{},
+		basic:      map[string]*ConsumerConfig{},
+		jwt:        map[string][]*ConsumerConfig{},
+		hmac:       map[string]*ConsumerConfig{},
+		now:        time.Now,
+	}
+	if sources := json.Get("keySources"); sources.Exists() {
+		a.keySources = nil
+		if err := configerr.DecodeJSON("/keySources", []byte(sources.Raw), &a.keySources); err != nil {
+			return nil, err
+		}
+		for i, source := range a.keySources {
+			if source.In != "header" && source.In != "query" {
+				return nil, configerr.Errorf(configerr.Pointer("keySources", i, "in"), "header or query", "unknown key source %q", source.In)
+			}
+			if source.Name == "" {
+				return nil, configerr.Errorf(configerr.Pointer("keySources", i, "name"), "non-empty string", "key source has no name")
+			}
+		}
+	}
+	if skew := json.Get("clockSkew"); skew.Exists() {
+		if skew.Type != gjson.Number || skew.Int() < 0 {
+			return nil, configerr.Errorf("/clockSkew", "seconds of at least 0", "got %s", skew.Raw)
+		}
+		a.clockSkew = time.Duration(skew.Int()) * time.Second
+	}
+	for i, item := range json.Get("consumers").Array() {
+		pointer := configerr.Pointer("consumers", i)
+		consumer := &ConsumerConfig{}
+		if err := configerr.DecodeJSON(pointer, []byte(item.Raw), consumer); err != nil {
+			return nil, err
+		}
+		if err := a.add(consumer); err != nil {
+			return nil, configerr.Prefix(pointer, err)
+		}
+	}
+	return a, nil
+}
+
+// add indexes the credentials of a consumer
+func (a *Authenticator) add(c *ConsumerConfig) error {
+	if c.Name == "" {
+		return configerr.Errorf("/name", "non-empty string", "consumer has no name")
+	}
+	for i, key := range c.Keys {
+		if key == "" {
+			return configerr.Errorf(configerr.Pointer("keys", i), "non-empty string", "empty key")
+		}
+		if other, ok := a.keys[key]; ok {
+			return configerr.Errorf(configerr.Pointer("keys", i), "unique key", "key of %s is also the key of %s", c.Name, other)
+		}
+		a.keys[key] = c.Name
+	}
+	if c.Basic != nil {
+		if c.Basic.Username == "" {
+			return configerr.Errorf("/basic/username", "non-empty string", "basic credential has no username")
+		}
+		if _, ok := a.basic[c.Basic.Username]; ok {
+			return configerr.Errorf("/basic/username", "unique username", "username %s is used by several consumers", c.Basic.Username)
+		}
+		a.basic[c.Basic.Username] = c
+	}
+	if c.JWT != nil {
+		if c.JWT.Secret == "" {
+			return configerr.Errorf("/jwt/secret", "non-empty string", "jwt credential has no secret")
+		}
+		a.jwt[c.JWT.Issuer] = append(a.jwt[c.JWT.Issuer], c)
+	}
+	if c.HMAC != nil {
+		if c.HMAC.AccessKey == "" || c.HMAC.SecretKey == "" {
+			return configerr.Errorf("/hmac", "accessKey and secretKey", "hmac credential is incomplete")
+		}
+		if _, ok := a.hmac[c.HMAC.AccessKey]; ok {
+			return configerr.Errorf("/hmac/accessKey", "unique access key", "access key %s is used by several consumers", c.HMAC.AccessKey)
+		}
+		a.hmac[c.HMAC.AccessKey] = c
+	}
+	return nil
+}
+
+// UnmarshalJSON parses the consumers of a config bound with encoding/json or wrapper.BindConfig
+func (a *Authenticator) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(gjson.ParseBytes(data))
+	if err != nil {
+		return err
+	}
+	*a = *parsed
+	return nil
+}
+
+// Authenticate returns the consumer of the credential of the current request, ErrNoCredential if it
+// has none, or ErrInvalidCredential if it matches no consumer
+func (a *Authenticator) Authenticate() (*wrapper.Consumer, error) {
+	authorization, _ := proxywasm.GetHttpRequestHeader("authorization")
+	scheme, credential, _ := strings.Cut(authorization, " ")
+	switch {
+	case strings.EqualFold(scheme, "Basic") && len(a.basic) > 0:
+		return a.authenticateBasic(strings.TrimSpace(credential))
+	case strings.EqualFold(scheme, "Signature") && len(a.hmac) > 0:
+		return a.authenticateHMAC(credential)
+	case strings.EqualFold(scheme, "Bearer") && len(a.jwt) > 0 && isJWT(strings.TrimSpace(credential)):
+		return a.authenticateJWT(strings.TrimSpace(credential))
+	}
+	if len(a.keys) == 0 {
+		return nil, ErrNoCredential
+	}
+	found := false
+	for _, source := range a.keySources {
+		key := a.key(source)
+		if key == "" {
+			continue
+		}
+		found = true
+		if name, ok := a.keys[key]; ok {
+			return &wrapper.Consumer{Name: name, Scheme: SchemeKey}, nil
+		}
+	}
+	if found {
+		return nil, ErrInvalidCredential
+	}
+	return nil, ErrNoCredential
+}
+
+// key reads the API key of a source
+func (a *Authenticator) key(source KeySource) string {
+	var value string
+	if source.In == "query" {
+		path, _ := proxywasm.GetHttpRequestHeader(":path")
+		if u, err := url.Parse(path); err == nil {
+			value = u.Query().Get(source.Name)
+		}
+	} else {
+		value, _ = proxywasm.GetHttpRequestHeader(source.Name)
+	}
+	if source.Prefix != "" {
+		if len(value) < len(source.Prefix) || !strings.EqualFold(value[:len(source.Prefix)], source.Prefix) {
+			return ""
+		}
+		value = value[len(source.Prefix):]
+	}
+	return strings.TrimSpace(value)
+}
+
+func (a *Authenticator) authenticateBasic(credential string) (*wrapper.Consumer, error) {
+	decoded, err := base64.StdEncoding.DecodeString(credential)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	c, found := a.basic[username]
+	if !ok || !found || subtle.ConstantTimeCompare([]byte(password), []byte(c.Basic.Password)) != 1 {
+		return nil, ErrInvalidCredential
+	}
+	return &wrapper.Consumer{Name: c.Name, Scheme: SchemeBasic}, nil
+}
+
+// Check authenticates the current request and sets its consumer. Requests without a valid credential
+// are rejected with 401, and the x-mse-consumer header they may carry is removed.
+func (a *Authenticator) Check(ctx wrapper.HttpContext) types.Action {
+	consumer, err := a.Authenticate()
+	if err != nil {
+		ctx.SetConsumer(nil)
+		log.Debugf("consumer authentication failed: %v", err)
+		return wrapper.Unauthorized(a.challenges()...).WithDetail("consumer.unauthorized").Send()
+	}
+	ctx.SetConsumer(consumer)
+	return types.ActionContinue
+}
+
+// challenges returns the WWW-Authenticate challenges of the configured schemes
+func (a *Authenticator) challenges() []wrapper.Challenge {
+	var challenges []wrapper.Challenge
+	if len(a.basic) > 0 {
+		challenges = append(challenges, wrapper.Challenge{Scheme: "Basic", Params: [][2]string{{"realm", "gateway"}}})
+	}
+	if len(a.keys) > 0 || len(a.jwt) > 0 {
+		challenges = append(challenges, wrapper.BearerChallenge("gateway", "", ""))
+	}
+	if len(a.hmac) > 0 {
+		challenges = append(challenges, wrapper.Challenge{Scheme: "Signature", Params: [][2]string{{"realm", "gateway"}, {"headers", "@request-target date"}}})
+	}
+	return challenges
+}
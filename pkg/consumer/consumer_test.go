@@ -0,0 +1,159 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const testConfig = `{
+	"consumers": [
+		{"name": "alice", "keys": ["sk-alice", "sk-alice-2"]},
+		{"name": "bob", "basic": {"username": "bob", "password": "secret"}},
+		{"name": "svc", "jwt": {"issuer": "https://idp.example.com", "secret": "jwt-secret", "audience": "gateway"}},
+		{"name": "partner", "hmac": {"accessKey": "ak", "secretKey": "sk"}}
+	]
+}`
+
+var testNow = time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+func newTestAuthenticator(t *testing.T, config string) *Authenticator {
+	a, err := Parse(gjson.Parse(config))
+	require.NoError(t, err)
+	a.now = func() time.Time { return testNow }
+	return a
+}
+
+// authenticate authenticates a request with the headers in a new emulator
+func authenticate(t *testing.T, a *Authenticator, headers ...[2]string) (*wrapper.Consumer, error) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("consumer-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, append([][2]string{{":authority", "example.com"}, {":method", "GET"}, {":path", "/v1/items?limit=10"}}, headers...), false)
+	return a.Authenticate()
+}
+
+func TestParse(t *testing.T) {
+	a := newTestAuthenticator(t, testConfig)
+	assert.Equal(t, defaultKeySources, a.keySources)
+	assert.Equal(t, map[string]string{"sk-alice": "alice", "sk-alice-2": "alice"}, a.keys)
+
+	for config, message := range map[string]string{
+		`{"consumers": [{"keys": ["k"]}]}`:                                            `invalid config at "/consumers/0/name"`,
+		`{"consumers": [{"name": "a", "keys": ["k"]}, {"name": "b", "keys": ["k"]}]}`: `invalid config at "/consumers/1/keys/0", expected unique key`,
+		`{"consumers": [{"name": "a", "basic": {"password": "p"}}]}`:                  `invalid config at "/consumers/0/basic/username"`,
+		`{"consumers": [{"name": "a", "jwt": {"issuer": "i"}}]}`:                      `invalid config at "/consumers/0/jwt/secret"`,
+		`{"consumers": [{"name": "a", "hmac": {"accessKey": "ak"}}]}`:                 `invalid config at "/consumers/0/hmac"`,
+		`{"keySources": [{"in": "cookie", "name": "k"}]}`:                             `invalid config at "/keySources/0/in"`,
+		`{"clockSkew": -1}`: `invalid config at "/clockSkew"`,
+	} {
+		_, err := Parse(gjson.Parse(config))
+		assert.ErrorContains(t, err, message, config)
+	}
+}
+
+func TestAuthenticateKey(t *testing.T) {
+	a := newTestAuthenticator(t, testConfig)
+	consumer, err := authenticate(t, a, [2]string{"authorization", "Bearer sk-alice"})
+	require.NoError(t, err)
+	assert.Equal(t, &wrapper.Consumer{Name: "alice", Scheme: SchemeKey}, consumer)
+	consumer, err = authenticate(t, a, [2]string{"x-api-key", "sk-alice-2"})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", consumer.Name)
+
+	_, err = authenticate(t, a, [2]string{"x-api-key", "sk-mallory"})
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+	_, err = authenticate(t, a)
+	assert.ErrorIs(t, err, ErrNoCredential)
+
+	a = newTestAuthenticator(t, `{"keySources": [{"in": "query", "name": "api_key"}], "consumers": [{"name": "alice", "keys": ["sk-alice"]}]}`)
+	_, err = authenticate(t, a, [2]string{"x-api-key", "sk-alice"})
+	assert.ErrorIs(t, err, ErrNoCredential)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("consumer-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	host.CallOnRequestHeaders(host.InitializeHttpContext(), [][2]string{{":path", "/v1?api_key=sk-alice"}}, false)
+	consumer, err = a.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, "alice", consumer.Name)
+}
+
+func TestAuthenticateBasic(t *testing.T) {
+	a := newTestAuthenticator(t, testConfig)
+	basic := func(credential string) [2]string {
+		return [2]string{"authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(credential))}
+	}
+	consumer, err := authenticate(t, a, basic("bob:secret"))
+	require.NoError(t, err)
+	assert.Equal(t, &wrapper.Consumer{Name: "bob", Scheme: SchemeBasic}, consumer)
+	for _, credential := range []string{"bob:wrong", "bob", "alice:secret"} {
+		_, err = authenticate(t, a, basic(credential))
+		assert.ErrorIs(t, err, ErrInvalidCredential, credential)
+	}
+	_, err = authenticate(t, a, [2]string{"authorization", "Basic !!"})
+	assert.ErrorIs(t, err, ErrInvalidCredential)
+}
+
+func TestCheck(t *testing.T) {
+	a := newTestAuthenticator(t, testConfig)
+	var consumer *wrapper.Consumer
+	vm := wrapper.NewCommonVmCtx("consumer-check-test",
+		wrapper.ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			if action := a.Check(ctx); action != types.ActionContinue {
+				return action
+			}
+			consumer = ctx.Consumer()
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"x-api-key", "sk-alice"}, {"x-mse-consumer", "mallory"}}, true)
+	assert.Nil(t, host.GetSentLocalResponse(id))
+	assert.Equal(t, &wrapper.Consumer{Name: "alice", Scheme: SchemeKey}, consumer)
+	assert.Contains(t, host.GetCurrentRequestHeaders(id), [2]string{"x-mse-consumer", "alice"})
+	host.CompleteHttpContext(id)
+
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"x-mse-consumer", "mallory"}}, true)
+	response := host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(UnauthorizedStatus), response.StatusCode)
+	assert.Equal(t, [][2]string{
+		{"WWW-Authenticate", `Basic realm="gateway"`},
+		{"WWW-Authenticate", `Bearer realm="gateway"`},
+		{"WWW-Authenticate", `Signature realm="gateway",headers="@request-target date"`},
+	}, response.Headers)
+	assert.NotContains(t, host.GetCurrentRequestHeaders(id), [2]string{"x-mse-consumer", "mallory"})
+	host.CompleteHttpContext(id)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// parseSignatureParams parses the parameters of an Authorization: Signature header, e.g.
+// keyId="ak",algorithm="hmac-sha256",headers="@request-target date",signature="..."
+func parseSignatureParams(credential string) map[string]string {
+	params := map[string]string{}
+	for _, param := range strings.Split(credential, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return params
+}
+
+// SigningString returns the string signed for the headers of a request, one "name: value" line per
+// header, where @request-target is the lower-cased method and the path
+func SigningString(method, path string, headers []string, get func(name string) string) string {
+	lines := make([]string, 0, len(headers))
+	for _, name := range headers {
+		name = strings.ToLower(name)
+		value := get(name)
+		if name == "@request-target" {
+			value = strings.ToLower(method) + " " + path
+		}
+		lines = append(lines, name+": "+value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sign returns the HMAC-SHA256 signature of a signing string
+func Sign(secretKey, signingString string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(signingString))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authenticateHMAC verifies the signature of the request, which must sign the request target and a
+// date within the clock skew
+func (a *Authenticator) authenticateHMAC(credential string) (*wrapper.Consumer, error) {
+	params := parseSignatureParams(credential)
+	c, ok := a.hmac[params["keyid"]]
+	if !ok || params["signature"] == "" {
+		return nil, ErrInvalidCredential
+	}
+	if algorithm := params["algorithm"]; algorithm != "" && algorithm != "hmac-sha256" {
+		return nil, ErrInvalidCredential
+	}
+	headers := strings.Fields(strings.ToLower(params["headers"]))
+	signsTarget, signsDate := false, false
+	for _, name := range headers {
+		signsTarget = signsTarget || name == "@request-target"
+		signsDate = signsDate || name == "date"
+	}
+	if !signsTarget || !signsDate {
+		return nil, ErrInvalidCredential
+	}
+	date, _ := proxywasm.GetHttpRequestHeader("date")
+	signedAt, err := http.ParseTime(date)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	if skew := a.now().Sub(signedAt); skew > a.clockSkew || skew < -a.clockSkew {
+		return nil, ErrInvalidCredential
+	}
+	method, _ := proxywasm.GetHttpRequestHeader(":method")
+	path, _ := proxywasm.GetHttpRequestHeader(":path")
+	signingString := SigningString(method, path, headers, func(name string) string {
+		value, _ := proxywasm.GetHttpRequestHeader(name)
+		return value
+	})
+	if !hmac.Equal([]byte(Sign(c.HMAC.SecretKey, signingString)), []byte(params["signature"])) {
+		return nil, ErrInvalidCredential
+	}
+	return &wrapper.Consumer{Name: c.Name, Scheme: SchemeHMAC}, nil
+}
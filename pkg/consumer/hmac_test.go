@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningString(t *testing.T) {
+	headers := map[string]string{"date": "Fri, 16 Oct 2026 08:00:00 GMT", "x-tenant": "t1"}
+	assert.Equal(t,
+		"@request-target: post /v1/items?limit=10\ndate: Fri, 16 Oct 2026 08:00:00 GMT\nx-tenant: t1",
+		SigningString("POST", "/v1/items?limit=10", []string{"@request-target", "Date", "x-tenant"}, func(name string) string { return headers[name] }))
+}
+
+func TestAuthenticateHMAC(t *testing.T) {
+	a := newTestAuthenticator(t, testConfig)
+	date := testNow.Format(http.TimeFormat)
+	signature := func(secretKey, date string, headers ...string) string {
+		values := map[string]string{"date": date, "x-tenant": "t1"}
+		return Sign(secretKey, SigningString("GET", "/v1/items?limit=10", headers, func(name string) string { return values[name] }))
+	}
+	authorization := func(keyID, signed, signature string) [2]string {
+		return [2]string{"authorization", fmt.Sprintf(`Signature keyId="%s",algorithm="hmac-sha256",headers="%s",signature="%s"`, keyID, signed, signature)}
+	}
+
+	consumer, err := authenticate(t, a,
+		authorization("ak", "@request-target date x-tenant", signature("sk", date, "@request-target", "date", "x-tenant")),
+		[2]string{"date", date}, [2]string{"x-tenant", "t1"})
+	require.NoError(t, err)
+	assert.Equal(t, "partner", consumer.Name)
+	assert.Equal(t, SchemeHMAC, consumer.Scheme)
+
+	old := testNow.Add(-10 * time.Minute).Format(http.TimeFormat)
+	for name, headers := range map[string][][2]string{
+		"wrong secret":    {authorization("ak", "@request-target date", signature("other", date, "@request-target", "date")), {"date", date}},
+		"unknown key":     {authorization("ak2", "@request-target date", signature("sk", date, "@request-target", "date")), {"date", date}},
+		"date not signed": {authorization("ak", "@request-target", signature("sk", date, "@request-target")), {"date", date}},
+		"old date":        {authorization("ak", "@request-target date", signature("sk", old, "@request-target", "date")), {"date", old}},
+		"tampered header": {authorization("ak", "@request-target date x-tenant", signature("sk", date, "@request-target", "date", "x-tenant")), {"date", date}, {"x-tenant", "t2"}},
+	} {
+		_, err := authenticate(t, a, headers...)
+		assert.ErrorIs(t, err, ErrInvalidCredential, name)
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/jwt"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// isJWT tells whether a bearer token looks like a JWT rather than an API key
+func isJWT(token string) bool {
+	header, _, ok := strings.Cut(token, ".")
+	if !ok || strings.Count(token, ".") != 2 {
+		return false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(header)
+	return err == nil && gjson.GetBytes(decoded, "alg").Exists()
+}
+
+// authenticateJWT verifies a token signed with HS256 by the consumers of its issuer
+func (a *Authenticator) authenticateJWT(raw string) (*wrapper.Consumer, error) {
+	token, err := jwt.ParseUnverified(raw)
+	if err != nil {
+		return nil, ErrInvalidCredential
+	}
+	issuer, _ := token.Claims["iss"].(string)
+	for _, c := range a.jwt[issuer] {
+		if token.Verify(jwt.NewSecretKey([]byte(c.JWT.Secret))) != nil {
+			continue
+		}
+		policy := jwt.ClaimsPolicy{ClockSkew: a.clockSkew}
+		if c.JWT.Audience != "" {
+			policy.Audiences = []string{c.JWT.Audience}
+		}
+		if policy.Validate(token, a.now()) != nil {
+			return nil, ErrInvalidCredential
+		}
+		return &wrapper.Consumer{Name: c.Name, Scheme: SchemeJWT, Claims: token.Claims}, nil
+	}
+	return nil, ErrInvalidCredential
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signJWT(alg, secret string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	a := newTestAuthenticator(t, testConfig)
+	now := testNow.Unix()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": "https://idp.example.com", "sub": "svc-1", "aud": []string{"gateway"}, "exp": now + 60, "nbf": now - 60}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+	bearer := func(token string) [2]string { return [2]string{"authorization", "Bearer " + token} }
+
+	consumer, err := authenticate(t, a, bearer(signJWT("HS256", "jwt-secret", claims(nil))))
+	require.NoError(t, err)
+	assert.Equal(t, "svc", consumer.Name)
+	assert.Equal(t, SchemeJWT, consumer.Scheme)
+	assert.Equal(t, "svc-1", consumer.Claims["sub"])
+	assert.Equal(t, json.Number("1792137660"), consumer.Claims["exp"])
+
+	// Within the clock skew
+	_, err = authenticate(t, a, bearer(signJWT("HS256", "jwt-secret", claims(map[string]interface{}{"exp": now - 60, "aud": "gateway"}))))
+	assert.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"wrong secret":    signJWT("HS256", "other", claims(nil)),
+		"expired":         signJWT("HS256", "jwt-secret", claims(map[string]interface{}{"exp": now - 600})),
+		"not yet valid":   signJWT("HS256", "jwt-secret", claims(map[string]interface{}{"nbf": now + 600})),
+		"wrong audience":  signJWT("HS256", "jwt-secret", claims(map[string]interface{}{"aud": "other"})),
+		"unknown issuer":  signJWT("HS256", "jwt-secret", claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"other algorithm": signJWT("HS384", "jwt-secret", claims(nil)),
+	} {
+		_, err := authenticate(t, a, bearer(token))
+		assert.ErrorIs(t, err, ErrInvalidCredential, name)
+	}
+
+	// Bearer tokens that are not JWTs are API keys
+	assert.False(t, isJWT("sk-alice"))
+	assert.False(t, isJWT("a.b.c"))
+	consumer, err = authenticate(t, a, bearer("sk-alice"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice", consumer.Name)
+}
@@ -14,6 +14,11 @@
 
 package iface
 
+import (
+	"strings"
+	"time"
+)
+
 type RouteResponseCallback func(statusCode int, responseHeaders [][2]string, responseBody []byte)
 
 type HTTPExecutionPhase int
@@ -36,6 +41,8 @@ type PluginContext interface {
 	GetFingerPrint() string
 	DoLeaderElection()
 	IsLeader() bool
+	// Check if the warm-up registered with wrapper.OnPluginWarmup is done, always true without warm-up.
+	IsWarmedUp() bool
 }
 
 type HttpContext interface {
@@ -66,6 +73,9 @@ type HttpContext interface {
 	BufferRequestBody()
 	// If the onHttpStreamingResponseBody handle is not set, and the onHttpResponseBody handle is set, the response body will be buffered by default
 	BufferResponseBody()
+	// Decompress gzip and deflate response bodies before they are passed to the response body handler,
+	// the response is then sent to the client uncompressed. It must be called before the response headers phase.
+	EnableAutoDecompressResponse()
 	// This extension adds support for pausing and modifying streaming HTTP responses
 	// using external HTTP service calls during the response body phase.
 	//
@@ -80,6 +90,7 @@ type HttpContext interface {
 	//
 	// This mechanism enables real-time transformation or inspection of
 	// streaming response data, with external service involvement.
+	// wrapper.StreamPauser wraps this flow and tracks pending callouts and buffered data.
 	NeedPauseStreamingResponse()
 	// Push data to inner buffer queue
 	PushBuffer(buffer []byte)
@@ -115,4 +126,146 @@ type HttpContext interface {
 	// Check if the response body is binary content.
 	// This method uses cached header values from the header phase and can be called at any time.
 	IsBinaryResponseBody() bool
+	// Get the feature flags configured in the metadata of the matched route.
+	// Flags are read lazily and cached for the lifetime of the request.
+	FeatureFlags() FlagSet
+	// Get the config of the rule matching the request, merged onto the global config when the plugin
+	// uses WithMergedRuleConfig. It is the PluginConfig passed to the handlers, nil before the config is matched.
+	EffectiveConfig() any
+	// Get the durations of the phases and callouts of the request in the order they started,
+	// recorded when the plugin uses wrapper.WithRequestTimings, nil otherwise.
+	GetTimings() []PhaseTiming
+	// Get the bytes of the headers and bodies of the request and of its response as received and as forwarded by
+	// the plugin, counted when the plugin uses wrapper.WithTrafficAccounting, nil otherwise.
+	GetTrafficSize() *TrafficSize
+	// Get the TLS details of the downstream connection of the request, nil for a plaintext connection. They are read once
+	// per connection and shared by the requests it carries.
+	DownstreamTLS() *DownstreamTLS
+	// Get the trace id of the trace context propagated with the request in traceparent or b3 headers, empty if there is none.
+	TraceID() string
+	// Get the span id of the trace context propagated with the request. Callouts of a traced request carry its trace
+	// headers unchanged and are recorded as "callout" span events.
+	SpanID() string
+	// Set an attribute of the span of the request, written by WriteUserAttributeToTrace. Values other than scalars are written as JSON.
+	SetSpanAttribute(key string, value interface{})
+	// Add a timestamped event to the span of the request, written by WriteUserAttributeToTrace as a JSON array in the "events" tag.
+	AddSpanEvent(name string, attributes map[string]interface{})
+	// Check if the warm-up of the plugin registered with wrapper.OnPluginWarmup is done, always true without warm-up.
+	IsWarmedUp() bool
+	// Apply the policy set with wrapper.WithFailurePolicy after a dependency of the request failed, e.g. "redis":
+	// the failure is logged and the request is rejected when it fails closed. Handlers stop processing the
+	// request on FailClosed, FailOpen is returned without a policy.
+	HandleFailure(dependency string, err error) FailureMode
+	// Apply the failure policy after a dependency of the authentication or authorization of the request failed,
+	// e.g. "jwks". Unlike HandleFailure the request is rejected unless the policy of the dependency or the
+	// feature flag of the route sets FailOpen, the mode of the plugin-wide policy does not apply.
+	HandleSecurityFailure(dependency string, err error) FailureMode
+	// Get the consumer of the request, set with SetConsumer or else read from the x-mse-consumer header set by
+	// the authentication plugins of the gateway, nil if the request has no consumer.
+	Consumer() *Consumer
+	// Set the consumer authenticated by the plugin, which is written to the x-mse-consumer request header and
+	// the "consumer" user attribute. Call it in the request header phase.
+	SetConsumer(consumer *Consumer)
+}
+
+// Consumer is the authenticated caller of a request
+type Consumer struct {
+	Name string
+	// Scheme is the credential the consumer was authenticated with, e.g. key, basic, jwt or hmac, empty if it
+	// was read from the x-mse-consumer header
+	Scheme string
+	// Claims are the claims of the JWT of the consumer, nil for other schemes
+	Claims map[string]interface{}
+}
+
+// FailureMode is how a request proceeds when a dependency of the plugin fails
+type FailureMode string
+
+const (
+	FailOpen    FailureMode = "open"
+	FailClosed  FailureMode = "closed"
+	FailDegrade FailureMode = "degrade"
+)
+
+// PhaseTiming is the time spent in a phase of a request, e.g. "request_headers", or waiting for a
+// callout, e.g. "callout:outbound|80||auth.example.com". A phase called several times for the
+// chunks of a body holds the total.
+type PhaseTiming struct {
+	Name     string
+	Duration time.Duration
+}
+
+// TrafficSize is the size in bytes of a request and of its response. The In sizes are those received by the
+// plugin and the Out sizes those it forwards, after its transformations. The size of headers is the total
+// length of their names and values. Bodies are not read back to be counted: the Out size of a body follows
+// the chunks replaced by streaming body handlers, a buffered body is counted as received.
+type TrafficSize struct {
+	RequestHeadersIn   int64
+	RequestHeadersOut  int64
+	RequestBodyIn      int64
+	RequestBodyOut     int64
+	ResponseHeadersIn  int64
+	ResponseHeadersOut int64
+	ResponseBodyIn     int64
+	ResponseBodyOut    int64
+}
+
+// DownstreamTLS are the TLS details of a downstream connection
+type DownstreamTLS struct {
+	// ServerName is the SNI sent by the client, empty if it sent none
+	ServerName string
+	// Version is the TLS version, e.g. TLSv1.3
+	Version string
+	// CipherSuite is the negotiated cipher suite, e.g. TLS_AES_128_GCM_SHA256, empty if the host does not expose it
+	CipherSuite string
+	// PeerCertificate is the certificate the client presented, nil if it presented none
+	PeerCertificate *PeerCertificate
+}
+
+// PeerCertificate is the certificate of the client of a downstream TLS connection
+type PeerCertificate struct {
+	Subject string
+	// DNSSAN and URISAN are the first DNS and URI entries of the subject alternative names
+	DNSSAN string
+	URISAN string
+	// SHA256Digest is the hex encoded SHA-256 fingerprint of the certificate, used for certificate pinning
+	SHA256Digest string
+	// Presented reports whether the host considers the connection mutual TLS, i.e. the client presented this
+	// certificate, from the connection.mtls attribute of Envoy. It does not tell whether the certificate was
+	// verified: the host exposes no verification state, and a listener configured to accept untrusted
+	// certificates presents them as well. Authorize on the certificate itself, e.g. with MatchesFingerprint,
+	// only behind a listener that requires and verifies client certificates.
+	Presented bool
+}
+
+// MatchesFingerprint reports whether the certificate has one of the SHA-256 fingerprints, which may be written in
+// upper case and with colons, as printed by openssl x509 -fingerprint -sha256
+func (c *PeerCertificate) MatchesFingerprint(fingerprints ...string) bool {
+	if c == nil || c.SHA256Digest == "" {
+		return false
+	}
+	for _, fingerprint := range fingerprints {
+		if strings.EqualFold(strings.ReplaceAll(fingerprint, ":", ""), c.SHA256Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// FlagSet provides typed access to per-route feature flags. Getters return the default value
+// when the flag is not set on the route or its value cannot be converted to the requested type.
+type FlagSet interface {
+	// Has reports whether the flag is set on the route.
+	Has(name string) bool
+	// Enabled is a shorthand for Bool(name, false).
+	Enabled(name string) bool
+	// Bool returns the flag as a boolean, accepting true/false, on/off, yes/no, 1/0 and enabled/disabled,
+	// or defaultValue when it is not set or not a boolean.
+	Bool(name string, defaultValue bool) bool
+	// String returns the flag as is, or defaultValue when it is not set.
+	String(name, defaultValue string) string
+	// Int returns the flag as a decimal integer, or defaultValue when it is not set or not an integer.
+	Int(name string, defaultValue int64) int64
+	// Float returns the flag as a number, or defaultValue when it is not set or not a number.
+	Float(name string, defaultValue float64) float64
 }
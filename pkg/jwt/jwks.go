@@ -0,0 +1,280 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/higress-group/wasm-go/pkg/cache"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// Key is a verification key of a key set
+type Key struct {
+	ID string
+	// Algorithm, if set, is the only algorithm the key verifies
+	Algorithm string
+	// key is a *rsa.PublicKey, an *ecdsa.PublicKey or the []byte secret of HS256
+	key interface{}
+}
+
+// NewSecretKey returns the key of the tokens signed with HS256 and a secret
+func NewSecretKey(secret []byte) *Key {
+	return &Key{Algorithm: HS256, key: secret}
+}
+
+// KeySet is a set of verification keys, e.g. a JWKS
+type KeySet struct {
+	Keys []*Key
+}
+
+// jwk is a JSON Web Key of a JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JWKS. The RSA, P-256 EC and symmetric keys are kept, other keys and the keys
+// used for encryption are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %v", err)
+	}
+	set := &KeySet{}
+	for i, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %d of jwks: %v", i, err)
+		}
+		if key != nil {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	return set, nil
+}
+
+// parse returns the key of a JWK, nil if its type is not supported
+func (k *jwk) parse() (*Key, error) {
+	key := &Key{ID: k.Kid, Algorithm: k.Alg}
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid e: %s", k.E)
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key of %d bits is too small", n.BitLen())
+		}
+		key.key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 point")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		// ecdh validates that the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid P-256 point: %v", err)
+		}
+		key.key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid k")
+		}
+		key.key = secret
+	default:
+		return nil, nil
+	}
+	return key, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Find returns the keys that may verify a token, those of its kid if it has one
+func (s *KeySet) Find(t *Token) []*Key {
+	var keys []*Key
+	kid, alg := t.KeyID(), t.Algorithm()
+	for _, key := range s.Keys {
+		if (kid != "" && key.ID != kid) || (key.Algorithm != "" && key.Algorithm != alg) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+const (
+	defaultJWKSCacheDuration = 5 * time.Minute
+	defaultJWKSTimeout       = 3000
+	// minJWKSRefetchInterval bounds the fetches of a JWKS for tokens of unknown keys
+	minJWKSRefetchInterval = 30 * time.Second
+)
+
+// jwksEntry is a JWKS shared by the VMs
+type jwksEntry struct {
+	JWKS      json.RawMessage `json:"jwks"`
+	FetchedAt int64           `json:"fetchedAt"`
+}
+
+// jwksSource fetches a JWKS and caches it in the VM and in shared data. Keys older than the cache
+// duration are refreshed: they are still used by the request that starts the refresh, and kept when
+// the refresh fails.
+type jwksSource struct {
+	client        wrapper.HttpClient
+	uri           string
+	cacheDuration time.Duration
+	timeout       uint32
+	shared        *cache.SharedCache[jwksEntry]
+	now           func() time.Time
+
+	keys      *KeySet
+	fetchedAt time.Time
+	fetcher   *cache.Fetcher[*KeySet]
+}
+
+func newJWKSSource(client wrapper.HttpClient, uri string, cacheDuration time.Duration, timeout uint32) *jwksSource {
+	s := &jwksSource{
+		client:        client,
+		uri:           uri,
+		cacheDuration: cacheDuration,
+		timeout:       timeout,
+		// The entries stay in shared data for the VMs whose refresh fails
+		shared: cache.NewSharedCache[jwksEntry]("jwt:jwks", 0),
+		now:    time.Now,
+	}
+	s.fetcher = cache.NewFetcher(minJWKSRefetchInterval, func() time.Time { return s.now() }, s.previousKeys)
+	return s
+}
+
+// get calls callback with the keys, at once if they are cached or later once they are fetched. The
+// keys are fetched again if they are stale, or if refresh is set, e.g. for the token of an unknown
+// key. Fetches are at least minJWKSRefetchInterval apart, unless another VM fetched the keys.
+func (s *jwksSource) get(refresh bool, callback func(keys *KeySet, err error)) {
+	if s.keys == nil || s.stale() {
+		s.loadShared()
+	}
+	canFetch := s.fetcher.CanFetch()
+	switch {
+	case s.keys == nil && !canFetch:
+		callback(nil, s.fetcher.Err())
+	case s.keys == nil, refresh && canFetch:
+		s.fetch(callback)
+	case s.stale() && canFetch:
+		keys := s.keys
+		s.fetch(nil)
+		callback(keys, nil)
+	default:
+		callback(s.keys, nil)
+	}
+}
+
+func (s *jwksSource) stale() bool {
+	return s.now().Sub(s.fetchedAt) >= s.cacheDuration
+}
+
+// loadShared takes the keys fetched by another VM if they are newer
+func (s *jwksSource) loadShared() {
+	entry, ok, err := s.shared.Get(s.uri)
+	if err != nil || !ok {
+		return
+	}
+	fetchedAt := time.UnixMilli(entry.FetchedAt)
+	if s.keys != nil && !fetchedAt.After(s.fetchedAt) {
+		return
+	}
+	keys, err := ParseJWKS(entry.JWKS)
+	if err != nil {
+		log.Warnf("discarding the jwks of %s in shared data: %v", s.uri, err)
+		return
+	}
+	s.keys, s.fetchedAt = keys, fetchedAt
+}
+
+// fetch fetches the JWKS, callback may be nil for a refresh in the background
+func (s *jwksSource) fetch(callback func(keys *KeySet, err error)) {
+	s.fetcher.Fetch(callback, func(done func(keys *KeySet, err error)) {
+		err := s.client.Get(s.uri, [][2]string{{"accept", "application/json"}}, func(statusCode int, _ http.Header, body []byte) {
+			if statusCode != http.StatusOK {
+				done(nil, fmt.Errorf("failed to fetch jwks from %s: status %d", s.uri, statusCode))
+				return
+			}
+			keys, err := ParseJWKS(body)
+			if err != nil {
+				done(nil, err)
+				return
+			}
+			now := s.now()
+			if err := s.shared.Set(s.uri, jwksEntry{JWKS: body, FetchedAt: now.UnixMilli()}); err != nil {
+				log.Warnf("failed to share the jwks of %s: %v", s.uri, err)
+			}
+			s.keys, s.fetchedAt = keys, now
+			done(keys, nil)
+		}, s.timeout)
+		if err != nil {
+			done(nil, fmt.Errorf("failed to fetch jwks from %s: %v", s.uri, err))
+		}
+	})
+}
+
+// previousKeys returns the keys fetched before a fetch that failed
+func (s *jwksSource) previousKeys(err error) (*KeySet, bool) {
+	if s.keys == nil {
+		return nil, false
+	}
+	log.Warnf("%v, using the keys fetched at %s", err, s.fetchedAt.Format(time.RFC3339))
+	return s.keys, true
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "alg": RS256, "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func jwksJSON(keys ...map[string]string) []byte {
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	set, err := ParseJWKS(jwksJSON(
+		rsaJWK("rsa-1", &testRSAKey.PublicKey),
+		ecJWK("ec-1", &testECKey.PublicKey),
+		map[string]string{"kty": "oct", "kid": "hs-1", "k": base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+		map[string]string{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": "AA"},
+		map[string]string{"kty": "EC", "kid": "ec-384", "crv": "P-384"},
+		map[string]string{"kty": "RSA", "kid": "enc-1", "use": "enc"},
+	))
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 3)
+	assert.Equal(t, "rsa-1", set.Keys[0].ID)
+	assert.Equal(t, RS256, set.Keys[0].Algorithm)
+
+	token, _ := ParseUnverified(sign(t, ES256, "ec-1", testECKey, testClaims(nil)))
+	keys := set.Find(token)
+	require.Len(t, keys, 1)
+	assert.NoError(t, token.Verify(keys[0]))
+	token, _ = ParseUnverified(sign(t, RS256, "", testRSAKey, testClaims(nil)))
+	assert.Len(t, set.Find(token), 3, "tokens without kid may be verified by every key")
+
+	smallKey := rsaJWK("small", &testRSAKey.PublicKey)
+	smallKey["n"] = base64.RawURLEncoding.EncodeToString(testRSAKey.N.Bytes()[:64])
+	offCurve := ecJWK("off", &testECKey.PublicKey)
+	offCurve["y"] = offCurve["x"]
+	for name, data := range map[string][]byte{
+		"not json":     []byte("{"),
+		"small RSA":    jwksJSON(smallKey),
+		"off curve":    jwksJSON(offCurve),
+		"empty secret": jwksJSON(map[string]string{"kty": "oct"}),
+	} {
+		_, err := ParseJWKS(data)
+		assert.Error(t, err, name)
+	}
+}
+
+// stubClient answers the GET requests of a jwksSource when respond is called
+type stubClient struct {
+	wrapper.HttpClient
+	requests  int
+	callbacks []wrapper.ResponseCallback
+}
+
+func (c *stubClient) Get(rawURL string, headers [][2]string, cb wrapper.ResponseCallback, timeoutMillisecond ...uint32) error {
+	c.requests++
+	c.callbacks = append(c.callbacks, cb)
+	return nil
+}
+
+func (c *stubClient) respond(statusCode int, body []byte) {
+	callbacks := c.callbacks
+	c.callbacks = nil
+	for _, cb := range callbacks {
+		cb(statusCode, http.Header{}, body)
+	}
+}
+
+func startTestPlugin(t *testing.T) func() {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("jwt-test")))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	return reset
+}
+
+func TestJWKSSource(t *testing.T) {
+	defer startTestPlugin(t)()
+	client := &stubClient{}
+	now := testNow
+	source := newJWKSSource(client, "https://idp.example.com/jwks", time.Minute, 1000)
+	source.now = func() time.Time { return now }
+
+	var got []*KeySet
+	collect := func(keys *KeySet, err error) {
+		assert.NoError(t, err)
+		got = append(got, keys)
+	}
+	// Concurrent requests share a fetch
+	source.get(false, collect)
+	source.get(false, collect)
+	assert.Equal(t, 1, client.requests)
+	assert.Empty(t, got)
+	client.respond(http.StatusOK, jwksJSON(rsaJWK("rsa-1", &testRSAKey.PublicKey)))
+	require.Len(t, got, 2)
+	assert.Same(t, got[0], got[1])
+
+	// Cached keys, then a refresh in the background once they are stale
+	source.get(false, collect)
+	assert.Equal(t, 1, client.requests)
+	now = now.Add(time.Minute)
+	source.get(false, collect)
+	assert.Equal(t, 2, client.requests)
+	require.Len(t, got, 4)
+	assert.Same(t, got[0], got[3], "stale keys are used during the refresh")
+
+	// A failed refresh keeps the keys
+	client.respond(http.StatusInternalServerError, nil)
+	source.get(false, collect)
+	assert.Equal(t, 2, client.requests, "fetches are at least 30s apart")
+	assert.Same(t, got[0], got[4])
+
+	// Another VM finds the keys in shared data
+	other := newJWKSSource(&stubClient{}, "https://idp.example.com/jwks", time.Minute, 1000)
+	other.now = func() time.Time { return testNow }
+	other.get(false, collect)
+	require.Len(t, got, 6)
+	assert.Equal(t, "rsa-1", got[5].Keys[0].ID)
+
+	// A refresh for an unknown key
+	now = now.Add(time.Minute)
+	source.get(true, collect)
+	client.respond(http.StatusOK, jwksJSON(rsaJWK("rsa-2", &testRSAKey.PublicKey)))
+	require.Len(t, got, 7)
+	assert.Equal(t, "rsa-2", got[6].Keys[0].ID)
+}
+
+func TestJWKSSourceFailure(t *testing.T) {
+	defer startTestPlugin(t)()
+	client := &stubClient{}
+	now := testNow
+	source := newJWKSSource(client, "https://idp.example.com/jwks", time.Minute, 1000)
+	source.now = func() time.Time { return now }
+
+	var errs []error
+	collect := func(keys *KeySet, err error) {
+		assert.Nil(t, keys)
+		errs = append(errs, err)
+	}
+	source.get(false, collect)
+	client.respond(http.StatusNotFound, nil)
+	require.Len(t, errs, 1)
+	assert.EqualError(t, errs[0], "failed to fetch jwks from https://idp.example.com/jwks: status 404")
+
+	// The error is returned without fetching again for a while
+	source.get(false, collect)
+	assert.Equal(t, 1, client.requests)
+	assert.Equal(t, errs[0], errs[1])
+	now = now.Add(minJWKSRefetchInterval)
+	source.get(false, collect)
+	assert.Equal(t, 2, client.requests)
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Signing algorithms of the tokens
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+var (
+	// ErrMalformed is returned for tokens that are not JWS compact serializations
+	ErrMalformed = errors.New("malformed token")
+	// ErrAlgorithm is returned for tokens signed with an algorithm that is not accepted
+	ErrAlgorithm = errors.New("unsupported algorithm")
+	// ErrUnknownKey is returned for tokens whose key is not in the key set
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrSignature is returned for tokens whose signature does not match
+	ErrSignature = errors.New("invalid signature")
+	// ErrExpired is returned for tokens after their exp claim
+	ErrExpired = errors.New("token is expired")
+	// ErrNotYetValid is returned for tokens before their nbf claim
+	ErrNotYetValid = errors.New("token is not valid yet")
+	// ErrIssuer is returned for tokens of another issuer
+	ErrIssuer = errors.New("invalid issuer")
+	// ErrAudience is returned for tokens of another audience
+	ErrAudience = errors.New("invalid audience")
+)
+
+// Token is a JWT, its claims are decoded with json.Number for numbers
+type Token struct {
+	Raw    string
+	Header map[string]interface{}
+	Claims map[string]interface{}
+
+	signingInput string
+	signature    []byte
+}
+
+// ParseUnverified decodes a token without verifying its signature or claims
+func ParseUnverified(raw string) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	t := &Token{Raw: raw, signingInput: parts[0] + "." + parts[1]}
+	if err := decodeSegment(parts[0], &t.Header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformed, err)
+	}
+	if err := decodeSegment(parts[1], &t.Claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformed, err)
+	}
+	t.signature = signature
+	return t, nil
+}
+
+func decodeSegment(segment string, v *map[string]interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if *v == nil {
+		return errors.New("not an object")
+	}
+	return nil
+}
+
+// Algorithm returns the alg header
+func (t *Token) Algorithm() string {
+	alg, _ := t.Header["alg"].(string)
+	return alg
+}
+
+// KeyID returns the kid header
+func (t *Token) KeyID() string {
+	kid, _ := t.Header["kid"].(string)
+	return kid
+}
+
+// Subject returns the sub claim
+func (t *Token) Subject() string {
+	sub, _ := t.Claims["sub"].(string)
+	return sub
+}
+
+// Verify checks the signature of the token with a key
+func (t *Token) Verify(key *Key) error {
+	alg := t.Algorithm()
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return ErrAlgorithm
+	}
+	digest := sha256.Sum256([]byte(t.signingInput))
+	switch alg {
+	case RS256:
+		public, ok := key.key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], t.signature) != nil {
+			return ErrSignature
+		}
+	case ES256:
+		public, ok := key.key.(*ecdsa.PublicKey)
+		if !ok || len(t.signature) != 64 {
+			return ErrSignature
+		}
+		r := new(big.Int).SetBytes(t.signature[:32])
+		s := new(big.Int).SetBytes(t.signature[32:])
+		if !ecdsa.Verify(public, digest[:], r, s) {
+			return ErrSignature
+		}
+	case HS256:
+		secret, ok := key.key.([]byte)
+		if !ok {
+			return ErrSignature
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(t.signingInput))
+		if !hmac.Equal(mac.Sum(nil), t.signature) {
+			return ErrSignature
+		}
+	default:
+		return ErrAlgorithm
+	}
+	return nil
+}
+
+// ClaimsPolicy is what the claims of a verified token are checked against
+type ClaimsPolicy struct {
+	// Issuer, if set, must be the iss claim
+	Issuer string
+	// Audiences, if set, must contain one of the aud claim
+	Audiences []string
+	// ClockSkew is the tolerance of exp and nbf
+	ClockSkew time.Duration
+}
+
+// Validate checks the exp, nbf, iss and aud claims of the token at a time
+func (p *ClaimsPolicy) Validate(t *Token, now time.Time) error {
+	if exp, ok := numericDate(t.Claims["exp"]); ok && !now.Before(exp.Add(p.ClockSkew)) {
+		return ErrExpired
+	}
+	if nbf, ok := numericDate(t.Claims["nbf"]); ok && now.Add(p.ClockSkew).Before(nbf) {
+		return ErrNotYetValid
+	}
+	if p.Issuer != "" && t.Claims["iss"] != p.Issuer {
+		return ErrIssuer
+	}
+	if len(p.Audiences) == 0 {
+		return nil
+	}
+	var audiences []interface{}
+	switch aud := t.Claims["aud"].(type) {
+	case string:
+		audiences = []interface{}{aud}
+	case []interface{}:
+		audiences = aud
+	}
+	for _, aud := range audiences {
+		for _, expected := range p.Audiences {
+			if aud == expected {
+				return nil
+			}
+		}
+	}
+	return ErrAudience
+}
+
+// numericDate converts a NumericDate claim, the seconds since the epoch
+func numericDate(value interface{}) (time.Time, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(seconds * 1000)), true
+}
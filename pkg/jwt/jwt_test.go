@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	testECKey, _  = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testNow       = time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+)
+
+// sign signs a token with a *rsa.PrivateKey, an *ecdsa.PrivateKey or a []byte secret
+func sign(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signingInput))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testClaims(changes map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": "https://idp.example.com",
+		"sub": "user-1",
+		"aud": []string{"gateway"},
+		"exp": testNow.Add(time.Hour).Unix(),
+		"nbf": testNow.Add(-time.Hour).Unix(),
+	}
+	for k, v := range changes {
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestParseUnverified(t *testing.T) {
+	token, err := ParseUnverified(sign(t, HS256, "k1", []byte("secret"), testClaims(nil)))
+	require.NoError(t, err)
+	assert.Equal(t, HS256, token.Algorithm())
+	assert.Equal(t, "k1", token.KeyID())
+	assert.Equal(t, "user-1", token.Subject())
+	assert.Equal(t, json.Number("1792141200"), token.Claims["exp"])
+
+	for _, raw := range []string{"", "a.b", "a.b.c.d", "!!.e30.", "e30.!!.", "e30.e30.!!", "bnVsbA.e30."} {
+		_, err := ParseUnverified(raw)
+		assert.ErrorIs(t, err, ErrMalformed, raw)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey := &Key{key: &testRSAKey.PublicKey}
+	ecKey := &Key{key: &testECKey.PublicKey}
+	secretKey := NewSecretKey([]byte("secret"))
+	otherRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	for name, tc := range map[string]struct {
+		token string
+		key   *Key
+		err   error
+	}{
+		"RS256":            {sign(t, RS256, "", testRSAKey, testClaims(nil)), rsaKey, nil},
+		"ES256":            {sign(t, ES256, "", testECKey, testClaims(nil)), ecKey, nil},
+		"HS256":            {sign(t, HS256, "", []byte("secret"), testClaims(nil)), secretKey, nil},
+		"other RSA key":    {sign(t, RS256, "", otherRSAKey, testClaims(nil)), rsaKey, ErrSignature},
+		"other secret":     {sign(t, HS256, "", []byte("other"), testClaims(nil)), secretKey, ErrSignature},
+		"HS256 with RSA":   {sign(t, HS256, "", []byte("secret"), testClaims(nil)), rsaKey, ErrSignature},
+		"RS256 with EC":    {sign(t, RS256, "", testRSAKey, testClaims(nil)), ecKey, ErrSignature},
+		"key algorithm":    {sign(t, HS256, "", []byte("secret"), testClaims(nil)), &Key{Algorithm: RS256, key: []byte("secret")}, ErrAlgorithm},
+		"unsupported none": {"eyJhbGciOiJub25lIn0.e30.", &Key{}, ErrAlgorithm},
+	} {
+		token, err := ParseUnverified(tc.token)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.err, token.Verify(tc.key), name)
+	}
+
+	// A tampered payload invalidates the signature
+	token, _ := ParseUnverified(sign(t, ES256, "", testECKey, testClaims(nil)))
+	token.signingInput += "x"
+	assert.ErrorIs(t, token.Verify(ecKey), ErrSignature)
+	token.signature = new(big.Int).SetInt64(1).Bytes()
+	assert.ErrorIs(t, token.Verify(ecKey), ErrSignature)
+}
+
+func TestClaimsPolicy(t *testing.T) {
+	policy := &ClaimsPolicy{Issuer: "https://idp.example.com", Audiences: []string{"gateway", "admin"}, ClockSkew: time.Minute}
+	validate := func(changes map[string]interface{}) error {
+		token, err := ParseUnverified(sign(t, HS256, "", []byte("secret"), testClaims(changes)))
+		require.NoError(t, err)
+		return policy.Validate(token, testNow)
+	}
+	assert.NoError(t, validate(nil))
+	assert.NoError(t, validate(map[string]interface{}{"aud": "admin"}))
+	assert.NoError(t, validate(map[string]interface{}{"exp": testNow.Add(-30 * time.Second).Unix()}), "within the clock skew")
+	assert.Equal(t, ErrExpired, validate(map[string]interface{}{"exp": testNow.Add(-time.Minute).Unix()}))
+	assert.Equal(t, ErrNotYetValid, validate(map[string]interface{}{"nbf": testNow.Add(2 * time.Minute).Unix()}))
+	assert.Equal(t, ErrIssuer, validate(map[string]interface{}{"iss": "https://evil.example.com"}))
+	assert.Equal(t, ErrAudience, validate(map[string]interface{}{"aud": []string{"other"}}))
+	assert.Equal(t, ErrAudience, validate(map[string]interface{}{"aud": nil}))
+
+	policy = &ClaimsPolicy{}
+	assert.NoError(t, validate(map[string]interface{}{"aud": nil, "iss": nil, "exp": nil}))
+}
@@ -0,0 +1,406 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwt verifies the JWTs of requests, signed with RS256, ES256 or HS256. A verifier is
+// configured as:
+//
+//	{
+//	  "issuer": "https://idp.example.com",
+//	  "audiences": ["gateway"],
+//	  "jwks": {"uri": "https://idp.example.com/.well-known/jwks.json", "fqdn": "idp.dns", "port": 443},
+//	  "fromHeaders": [{"name": "authorization", "prefix": "Bearer "}],
+//	  "fromParams": ["access_token"],
+//	  "consumerClaim": "sub"
+//	}
+//
+// The keys are given inline with "jwks": {"keys": [...]}, fetched from a JWKS URI through the
+// cluster of fqdn and port, or given with "secret" for HS256. Fetched keys are cached in the VM
+// and in shared data for cacheDuration seconds, 300 by default, then refreshed in the background
+// while the cached keys are still used. Tokens of unknown keys refetch the JWKS, at most every 30
+// seconds. The exp and nbf claims are checked with a clockSkew of 60 seconds by default. Usage in
+// onHttpRequestHeaders:
+//
+//	if action := config.verifier.Check(ctx); action != types.ActionContinue {
+//		return action
+//	}
+//	claims := jwt.Claims(ctx)
+//
+// The keys may be fetched before serving traffic with Warmup in wrapper.OnPluginWarmup.
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	// CtxKeyClaims holds the claims of the token verified by Check
+	CtxKeyClaims = "jwt_claims"
+	// FailureJWKS is the dependency of the failures to fetch the JWKS, see wrapper.WithFailurePolicy
+	FailureJWKS = "jwks"
+	// UnauthorizedStatus is the status of the requests rejected by Check
+	UnauthorizedStatus = 401
+	// SchemeJWT is the scheme of the consumers set from the claims
+	SchemeJWT = "jwt"
+
+	defaultClockSkew = 60 * time.Second
+)
+
+// ErrNoToken is returned for requests without a token
+var ErrNoToken = errors.New("no token")
+
+// TokenSource is a header a token is read from
+type TokenSource struct {
+	Name string `json:"name"`
+	// Prefix is removed from the value, e.g. "Bearer "
+	Prefix string `json:"prefix,omitempty"`
+}
+
+var defaultTokenSources = []TokenSource{{Name: "authorization", Prefix: "Bearer "}}
+
+// Verifier verifies the tokens of requests
+type Verifier struct {
+	policy        ClaimsPolicy
+	algorithms    map[string]bool
+	fromHeaders   []TokenSource
+	fromParams    []string
+	consumerClaim string
+	// keys are the static keys, jwks fetches the keys otherwise
+	keys *KeySet
+	jwks *jwksSource
+	now  func() time.Time
+}
+
+// Parse parses a verifier from a config
+func Parse(json gjson.Result) (*Verifier, error) {
+	v := &Verifier{
+		policy: ClaimsPolicy{
+			Issuer:    json.Get("issuer").String(),
+			ClockSkew: defaultClockSkew,
+		},
+		algorithms:    map[string]bool{},
+		fromHeaders:   defaultTokenSources,
+		consumerClaim: json.Get("consumerClaim").String(),
+		now:           time.Now,
+	}
+	for i, aud := range json.Get("audiences").Array() {
+		if aud.Type != gjson.String || aud.Str == "" {
+			return nil, configerr.Errorf(configerr.Pointer("audiences", i), "non-empty string", "got %s", aud.Raw)
+		}
+		v.policy.Audiences = append(v.policy.Audiences, aud.Str)
+	}
+	if skew := json.Get("clockSkew"); skew.Exists() {
+		if skew.Type != gjson.Number || skew.Int() < 0 {
+			return nil, configerr.Errorf("/clockSkew", "seconds of at least 0", "got %s", skew.Raw)
+		}
+		v.policy.ClockSkew = time.Duration(skew.Int()) * time.Second
+	}
+	if headers := json.Get("fromHeaders"); headers.Exists() {
+		v.fromHeaders = nil
+		if err := configerr.DecodeJSON("/fromHeaders", []byte(headers.Raw), &v.fromHeaders); err != nil {
+			return nil, err
+		}
+		for i, source := range v.fromHeaders {
+			if source.Name == "" {
+				return nil, configerr.Errorf(configerr.Pointer("fromHeaders", i, "name"), "non-empty string", "token header has no name")
+			}
+		}
+	}
+	for i, param := range json.Get("fromParams").Array() {
+		if param.Str == "" {
+			return nil, configerr.Errorf(configerr.Pointer("fromParams", i), "non-empty string", "got %s", param.Raw)
+		}
+		v.fromParams = append(v.fromParams, param.Str)
+	}
+	if err := v.parseKeys(json); err != nil {
+		return nil, err
+	}
+	algorithms := json.Get("algorithms")
+	if !algorithms.Exists() {
+		// Without algorithms, the secret only accepts HS256 and key sets only accept the asymmetric algorithms
+		if json.Get("secret").Exists() {
+			v.algorithms[HS256] = true
+		} else {
+			v.algorithms[RS256], v.algorithms[ES256] = true, true
+		}
+	}
+	for i, alg := range algorithms.Array() {
+		switch alg.Str {
+		case RS256, ES256, HS256:
+			v.algorithms[alg.Str] = true
+		default:
+			return nil, configerr.Errorf(configerr.Pointer("algorithms", i), "RS256, ES256 or HS256", "unsupported algorithm %s", alg.Raw)
+		}
+	}
+	return v, nil
+}
+
+// parseKeys parses the secret, the inline JWKS or the JWKS URI of a config
+func (v *Verifier) parseKeys(json gjson.Result) error {
+	secret, jwks := json.Get("secret"), json.Get("jwks")
+	switch {
+	case secret.Exists() && jwks.Exists():
+		return configerr.Errorf("/secret", "secret or jwks", "secret and jwks are both set")
+	case secret.Exists():
+		if secret.Str == "" {
+			return configerr.Errorf("/secret", "non-empty string", "got %s", secret.Raw)
+		}
+		v.keys = &KeySet{Keys: []*Key{NewSecretKey([]byte(secret.Str))}}
+	case jwks.Get("keys").Exists():
+		keys, err := ParseJWKS([]byte(jwks.Raw))
+		if err != nil {
+			return configerr.New("/jwks", "JWKS", err)
+		}
+		v.keys = keys
+	case jwks.Get("uri").Exists():
+		uri := jwks.Get("uri").String()
+		u, err := url.Parse(uri)
+		if err != nil || u.Host == "" {
+			return configerr.Errorf("/jwks/uri", "absolute URL", "invalid jwks uri %q", uri)
+		}
+		fqdn := jwks.Get("fqdn").String()
+		if fqdn == "" {
+			return configerr.Errorf("/jwks/fqdn", "non-empty string", "the cluster of the jwks uri is not set")
+		}
+		port := jwks.Get("port").Int()
+		if port == 0 {
+			port = 443
+			if u.Scheme == "http" {
+				port = 80
+			}
+		}
+		cacheDuration := defaultJWKSCacheDuration
+		if d := jwks.Get("cacheDuration"); d.Exists() {
+			if d.Type != gjson.Number || d.Int() <= 0 {
+				return configerr.Errorf("/jwks/cacheDuration", "positive seconds", "got %s", d.Raw)
+			}
+			cacheDuration = time.Duration(d.Int()) * time.Second
+		}
+		timeout := uint32(defaultJWKSTimeout)
+		if t := jwks.Get("timeout").Uint(); t > 0 {
+			timeout = uint32(t)
+		}
+		client := wrapper.NewClusterClient(wrapper.FQDNCluster{FQDN: fqdn, Host: u.Host, Port: port})
+		v.jwks = newJWKSSource(client, uri, cacheDuration, timeout)
+	default:
+		return configerr.Errorf("/jwks", "jwks with keys or uri, or secret", "no keys are configured")
+	}
+	return nil
+}
+
+// UnmarshalJSON parses the verifier of a config bound with encoding/json or wrapper.BindConfig
+func (v *Verifier) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(gjson.ParseBytes(data))
+	if err != nil {
+		return err
+	}
+	*v = *parsed
+	return nil
+}
+
+// SetHttpClient sets the client fetching the JWKS, e.g. a client with retries
+func (v *Verifier) SetHttpClient(client wrapper.HttpClient) {
+	if v.jwks != nil {
+		v.jwks.client = client
+	}
+}
+
+// Warmup fetches the JWKS, for wrapper.OnPluginWarmup
+func (v *Verifier) Warmup(done func(err error)) {
+	if v.jwks == nil {
+		done(nil)
+		return
+	}
+	v.jwks.get(false, func(_ *KeySet, err error) {
+		done(err)
+	})
+}
+
+// Token returns the token of the current request
+func (v *Verifier) Token() (string, error) {
+	for _, source := range v.fromHeaders {
+		value, _ := proxywasm.GetHttpRequestHeader(source.Name)
+		if source.Prefix != "" {
+			if len(value) < len(source.Prefix) || !strings.EqualFold(value[:len(source.Prefix)], source.Prefix) {
+				continue
+			}
+			value = value[len(source.Prefix):]
+		}
+		if value = strings.TrimSpace(value); value != "" {
+			return value, nil
+		}
+	}
+	if len(v.fromParams) > 0 {
+		path, _ := proxywasm.GetHttpRequestHeader(":path")
+		if u, err := url.Parse(path); err == nil {
+			query := u.Query()
+			for _, param := range v.fromParams {
+				if value := query.Get(param); value != "" {
+					return value, nil
+				}
+			}
+		}
+	}
+	return "", ErrNoToken
+}
+
+// Verify verifies a token and calls callback with it, at once with static keys or once the JWKS is
+// fetched. The errors of the token are wrapped by the error of callback. An error fetching the JWKS
+// is returned as is.
+func (v *Verifier) Verify(raw string, callback func(token *Token, err error)) {
+	token, err := ParseUnverified(raw)
+	if err != nil {
+		callback(nil, err)
+		return
+	}
+	if !v.algorithms[token.Algorithm()] {
+		callback(nil, ErrAlgorithm)
+		return
+	}
+	if v.jwks == nil {
+		callback(token, v.verify(token, v.keys))
+		return
+	}
+	v.jwks.get(false, func(keys *KeySet, err error) {
+		if err != nil {
+			callback(nil, &jwksError{err})
+			return
+		}
+		if len(keys.Find(token)) > 0 {
+			callback(token, v.verify(token, keys))
+			return
+		}
+		// The key may have been rotated since the JWKS was fetched
+		v.jwks.get(true, func(keys *KeySet, err error) {
+			if err != nil {
+				callback(nil, &jwksError{err})
+				return
+			}
+			callback(token, v.verify(token, keys))
+		})
+	})
+}
+
+// jwksError is the failure to fetch the JWKS, as opposed to an invalid token
+type jwksError struct {
+	err error
+}
+
+func (e *jwksError) Error() string {
+	return e.err.Error()
+}
+
+func (e *jwksError) Unwrap() error {
+	return e.err
+}
+
+// verify checks the signature of a token with the keys and its claims
+func (v *Verifier) verify(token *Token, keys *KeySet) error {
+	candidates := keys.Find(token)
+	if len(candidates) == 0 {
+		return ErrUnknownKey
+	}
+	err := ErrSignature
+	for _, key := range candidates {
+		if err = token.Verify(key); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return v.policy.Validate(token, v.now())
+}
+
+// Check verifies the token of the current request and sets its claims in the context, and its
+// consumer if consumerClaim is set. Requests without a valid token are rejected with 401. The
+// failures to fetch the JWKS reject requests with the status of the failure policy of FailureJWKS,
+// 503 by default, unless the policy explicitly sets FailOpen, which continues requests without a
+// consumer.
+func (v *Verifier) Check(ctx wrapper.HttpContext) types.Action {
+	raw, err := v.Token()
+	if err != nil {
+		return v.reject(ctx, err)
+	}
+	done, pending := false, false
+	action := types.ActionContinue
+	v.Verify(raw, func(token *Token, err error) {
+		done = true
+		action = v.handleResult(ctx, token, err)
+		if pending && action == types.ActionContinue {
+			_ = proxywasm.ResumeHttpRequest()
+		}
+	})
+	if done {
+		return action
+	}
+	// The JWKS is being fetched, the request waits for the callback
+	pending = true
+	return types.HeaderStopAllIterationAndWatermark
+}
+
+func (v *Verifier) handleResult(ctx wrapper.HttpContext, token *Token, err error) types.Action {
+	var fetchErr *jwksError
+	if errors.As(err, &fetchErr) {
+		// The request is not authenticated even when it fails open
+		if v.consumerClaim != "" {
+			ctx.SetConsumer(nil)
+		}
+		if ctx.HandleSecurityFailure(FailureJWKS, fetchErr.err) == wrapper.FailClosed {
+			return types.ActionPause
+		}
+		return types.ActionContinue
+	}
+	if err != nil {
+		return v.reject(ctx, err)
+	}
+	if v.consumerClaim != "" {
+		name, _ := token.Claims[v.consumerClaim].(string)
+		if name == "" {
+			return v.reject(ctx, fmt.Errorf("no %s claim", v.consumerClaim))
+		}
+		ctx.SetConsumer(&wrapper.Consumer{Name: name, Scheme: SchemeJWT, Claims: token.Claims})
+	}
+	ctx.SetContext(CtxKeyClaims, token.Claims)
+	return types.ActionContinue
+}
+
+func (v *Verifier) reject(ctx wrapper.HttpContext, err error) types.Action {
+	if v.consumerClaim != "" {
+		ctx.SetConsumer(nil)
+	}
+	log.Debugf("jwt verification failed: %v", err)
+	challenge := wrapper.BearerChallenge("gateway", "", "")
+	if !errors.Is(err, ErrNoToken) {
+		challenge = wrapper.BearerChallenge("gateway", "invalid_token", "")
+	}
+	return wrapper.Unauthorized(challenge).WithDetail("jwt.unauthorized").Send()
+}
+
+// Claims returns the claims of the token verified by Check, nil if there is none
+func Claims(ctx wrapper.HttpContext) map[string]interface{} {
+	claims, _ := ctx.GetContext(CtxKeyClaims).(map[string]interface{})
+	return claims
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse(gjson.Parse(`{"secret": "s"}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{HS256: true}, v.algorithms)
+	assert.Equal(t, defaultTokenSources, v.fromHeaders)
+
+	v, err = Parse(gjson.Parse(`{"jwks": {"uri": "https://idp.example.com/jwks", "fqdn": "idp.dns"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{RS256: true, ES256: true}, v.algorithms)
+	assert.Equal(t, "outbound|443||idp.dns", v.jwks.client.ClusterName())
+	assert.Equal(t, defaultJWKSCacheDuration, v.jwks.cacheDuration)
+
+	for config, message := range map[string]string{
+		`{}`:                                    `invalid config at "/jwks"`,
+		`{"secret": "s", "jwks": {"keys": []}}`: `invalid config at "/secret"`,
+		`{"jwks": {"keys": [{"kty": "oct"}]}}`:  `invalid config at "/jwks"`,
+		`{"jwks": {"uri": "/jwks", "fqdn": "idp.dns"}}`:                        `invalid config at "/jwks/uri"`,
+		`{"jwks": {"uri": "https://idp.example.com/jwks"}}`:                    `invalid config at "/jwks/fqdn"`,
+		`{"secret": "s", "algorithms": ["none"]}`:                              `invalid config at "/algorithms/0"`,
+		`{"secret": "s", "audiences": [""]}`:                                   `invalid config at "/audiences/0"`,
+		`{"secret": "s", "fromHeaders": [{"prefix": "Bearer "}]}`:              `invalid config at "/fromHeaders/0/name"`,
+		`{"secret": "s", "clockSkew": "1m"}`:                                   `invalid config at "/clockSkew"`,
+		`{"jwks": {"uri": "https://a/jwks", "fqdn": "a", "cacheDuration": 0}}`: `invalid config at "/jwks/cacheDuration"`,
+	} {
+		_, err := Parse(gjson.Parse(config))
+		assert.ErrorContains(t, err, message, config)
+	}
+}
+
+// newTestHost starts a plugin checking requests with the verifier
+func newTestHost(t *testing.T, v *Verifier, options ...wrapper.CtxOption[struct{}]) (proxytest.HostEmulator, *map[string]interface{}, *wrapper.Consumer, func()) {
+	claims := &map[string]interface{}{}
+	consumer := &wrapper.Consumer{}
+	options = append(options,
+		wrapper.ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			action := v.Check(ctx)
+			*claims = Claims(ctx)
+			if c := ctx.Consumer(); c != nil {
+				*consumer = *c
+			}
+			return action
+		}),
+		wrapper.ProcessResponseHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			*claims = Claims(ctx)
+			if c := ctx.Consumer(); c != nil {
+				*consumer = *c
+			}
+			return types.ActionContinue
+		}),
+	)
+	vm := wrapper.NewCommonVmCtx("jwt-check-test", options...)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	return host, claims, consumer, reset
+}
+
+func TestCheck(t *testing.T) {
+	v, err := Parse(gjson.Parse(`{"issuer": "https://idp.example.com", "audiences": ["gateway"], "consumerClaim": "sub", "fromParams": ["access_token"], "jwks": ` + string(jwksJSON(
+		rsaJWK("rsa-1", &testRSAKey.PublicKey), ecJWK("ec-1", &testECKey.PublicKey))) + `}`))
+	require.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	host, claims, consumer, reset := newTestHost(t, v)
+	defer reset()
+
+	check := func(headers ...[2]string) (types.Action, *proxytest.LocalHttpResponse) {
+		id := host.InitializeHttpContext()
+		defer host.CompleteHttpContext(id)
+		*claims = nil
+		if len(headers) == 0 || headers[0][0] != ":path" {
+			headers = append([][2]string{{":path", "/"}}, headers...)
+		}
+		action := host.CallOnRequestHeaders(id, append([][2]string{{":authority", "example.com"}}, headers...), true)
+		return action, host.GetSentLocalResponse(id)
+	}
+
+	action, response := check([2]string{"authorization", "Bearer " + sign(t, ES256, "ec-1", testECKey, testClaims(nil))})
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Nil(t, response)
+	assert.Equal(t, "user-1", (*claims)["sub"])
+	assert.Equal(t, wrapper.Consumer{Name: "user-1", Scheme: SchemeJWT, Claims: *claims}, *consumer)
+
+	action, response = check([2]string{":path", "/?access_token=" + sign(t, RS256, "rsa-1", testRSAKey, testClaims(map[string]interface{}{"sub": "user-2"}))})
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Nil(t, response)
+	assert.Equal(t, "user-2", consumer.Name)
+
+	for name, headers := range map[string][][2]string{
+		"no token":     nil,
+		"expired":      {{"authorization", "Bearer " + sign(t, RS256, "rsa-1", testRSAKey, testClaims(map[string]interface{}{"exp": testNow.Unix() - 3600}))}},
+		"wrong aud":    {{"authorization", "Bearer " + sign(t, RS256, "rsa-1", testRSAKey, testClaims(map[string]interface{}{"aud": "other"}))}},
+		"HS256":        {{"authorization", "Bearer " + sign(t, HS256, "rsa-1", []byte("secret"), testClaims(nil))}},
+		"unknown key":  {{"authorization", "Bearer " + sign(t, RS256, "rsa-9", testRSAKey, testClaims(nil))}},
+		"no sub claim": {{"authorization", "Bearer " + sign(t, RS256, "rsa-1", testRSAKey, testClaims(map[string]interface{}{"sub": nil}))}},
+		"not a jwt":    {{"authorization", "Bearer sk-123"}},
+		"basic":        {{"authorization", "Basic dXNlcjpwYXNz"}},
+	} {
+		action, response := check(headers...)
+		assert.Equal(t, types.ActionPause, action, name)
+		require.NotNil(t, response, name)
+		assert.Equal(t, uint32(UnauthorizedStatus), response.StatusCode, name)
+		assert.Nil(t, *claims, name)
+	}
+	_, response = check()
+	assert.Equal(t, [][2]string{{"WWW-Authenticate", `Bearer realm="gateway"`}}, response.Headers)
+	_, response = check([2]string{"authorization", "Bearer sk-123"})
+	assert.Equal(t, [][2]string{{"WWW-Authenticate", `Bearer realm="gateway",error="invalid_token"`}}, response.Headers)
+}
+
+func TestCheckJWKSURI(t *testing.T) {
+	v, err := Parse(gjson.Parse(`{"jwks": {"uri": "https://idp.example.com/.well-known/jwks.json", "fqdn": "idp.dns"}}`))
+	require.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	v.jwks.now = v.now
+	host, claims, _, reset := newTestHost(t, v,
+		wrapper.WithFailurePolicy[struct{}](wrapper.FailurePolicy{Mode: wrapper.FailOpen}, map[string]wrapper.FailurePolicy{FailureJWKS: {Mode: wrapper.FailClosed}}))
+	defer reset()
+	token := sign(t, RS256, "rsa-1", testRSAKey, testClaims(nil))
+
+	// The JWKS cannot be fetched
+	id := host.InitializeHttpContext()
+	action := host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"authorization", "Bearer " + token}}, true)
+	assert.Equal(t, types.HeaderStopAllIterationAndWatermark, action)
+	callouts := host.GetCalloutAttributesFromContext(id)
+	require.Len(t, callouts, 1)
+	assert.Equal(t, "outbound|443||idp.dns", callouts[0].Upstream)
+	host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "503"}}, nil, nil)
+	response := host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(503), response.StatusCode)
+	assert.Equal(t, "dependency_failure.jwks", response.StatusCodeDetail)
+	host.CompleteHttpContext(id)
+
+	// The JWKS is fetched for the next request once the refetch interval is over
+	v.jwks.now = func() time.Time { return time.Now().Add(minJWKSRefetchInterval) }
+	id = host.InitializeHttpContext()
+	action = host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"authorization", "Bearer " + token}}, true)
+	assert.Equal(t, types.HeaderStopAllIterationAndWatermark, action)
+	callouts = host.GetCalloutAttributesFromContext(id)
+	require.Len(t, callouts, 1)
+	host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, jwksJSON(rsaJWK("rsa-1", &testRSAKey.PublicKey)))
+	assert.Nil(t, host.GetSentLocalResponse(id))
+	assert.Equal(t, types.ActionContinue, host.GetCurrentHttpStreamAction(id))
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, false)
+	assert.Equal(t, "user-1", (*claims)["sub"])
+	host.CompleteHttpContext(id)
+
+	// The keys are cached
+	id = host.InitializeHttpContext()
+	action = host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"authorization", "Bearer " + token}}, true)
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id))
+	host.CompleteHttpContext(id)
+}
+
+func TestCheckJWKSFailure(t *testing.T) {
+	token := sign(t, RS256, "rsa-1", testRSAKey, testClaims(nil))
+	check := func(options ...wrapper.CtxOption[struct{}]) (types.Action, *proxytest.LocalHttpResponse, [][2]string) {
+		v, err := Parse(gjson.Parse(`{"consumerClaim": "sub", "jwks": {"uri": "https://idp.example.com/jwks", "fqdn": "idp.dns"}}`))
+		require.NoError(t, err)
+		host, _, _, reset := newTestHost(t, v, options...)
+		defer reset()
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"authorization", "Bearer " + token}, {"x-mse-consumer", "admin"}}, true)
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "500"}}, nil, nil)
+		return host.GetCurrentHttpStreamAction(id), host.GetSentLocalResponse(id), host.GetCurrentRequestHeaders(id)
+	}
+
+	// Without a policy, even a plugin-wide open one, the request is rejected
+	for _, options := range [][]wrapper.CtxOption[struct{}]{
+		nil,
+		{wrapper.WithFailurePolicy[struct{}](wrapper.FailurePolicy{Mode: wrapper.FailOpen}, nil)},
+		{wrapper.WithFailurePolicy[struct{}](wrapper.FailurePolicy{}, map[string]wrapper.FailurePolicy{FailureJWKS: {Mode: wrapper.FailDegrade}})},
+	} {
+		_, response, _ := check(options...)
+		require.NotNil(t, response)
+		assert.Equal(t, uint32(503), response.StatusCode)
+		assert.Equal(t, "dependency_failure.jwks", response.StatusCodeDetail)
+	}
+
+	// An explicit open policy continues the request without its consumer
+	action, response, headers := check(wrapper.WithFailurePolicy[struct{}](wrapper.FailurePolicy{}, map[string]wrapper.FailurePolicy{FailureJWKS: {Mode: wrapper.FailOpen}}))
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Nil(t, response)
+	for _, h := range headers {
+		assert.NotEqual(t, "x-mse-consumer", h[0])
+	}
+}
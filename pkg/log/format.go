@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is the format of the logs of the plugin
+type Format int
+
+const (
+	// TextFormat logs plain messages prefixed with [plugin name] [plugin id] [request id]
+	TextFormat Format = iota
+	// JSONFormat logs a JSON object per message, e.g.
+	// {"level":"info","plugin":"ai-proxy","request_id":"...","route":"...","msg":"...","model":"qwen"}
+	JSONFormat
+)
+
+var format = TextFormat
+
+// SetFormat sets the format of the logs of the plugin
+func SetFormat(f Format) {
+	format = f
+}
+
+// GetFormat returns the format of the logs of the plugin
+func GetFormat() Format {
+	return format
+}
+
+// Field is a key-value pair added to logs with With
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// FieldLog is a Log able to add fields to its logs, like the log of the wrapper package
+type FieldLog interface {
+	Log
+	WithFields(fields ...Field) Log
+}
+
+// With returns the log of the plugin adding the key-value pairs to every log, as fields of the
+// object in JSON format and as key=value after the message in text format:
+//
+//	log.With("consumer", consumer, "model", model).Infof("request rejected: %v", err)
+//
+// A key without value gets the value nil, keys that are not strings are formatted with %v.
+func With(kvs ...interface{}) Log {
+	fields := make([]Field, 0, (len(kvs)+1)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		field := Field{Key: fmt.Sprint(kvs[i])}
+		if key, ok := kvs[i].(string); ok {
+			field.Key = key
+		}
+		if i+1 < len(kvs) {
+			field.Value = kvs[i+1]
+		}
+		fields = append(fields, field)
+	}
+	if l, ok := pluginLog.(FieldLog); ok {
+		return l.WithFields(fields...)
+	}
+	return &textFieldLog{Log: pluginLog, suffix: FormatFields(fields)}
+}
+
+// FormatFields formats the fields as they are appended to messages in text format, e.g. " consumer=alice model=qwen"
+func FormatFields(fields []Field) string {
+	var b strings.Builder
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", field.Key, value)
+	}
+	return b.String()
+}
+
+// textFieldLog appends fields to the messages of a log without field support
+type textFieldLog struct {
+	Log
+	suffix string
+}
+
+func (l *textFieldLog) Trace(msg string) { l.Log.Trace(msg + l.suffix) }
+func (l *textFieldLog) Tracef(format string, args ...interface{}) {
+	l.Log.Trace(fmt.Sprintf(format, args...) + l.suffix)
+}
+func (l *textFieldLog) Debug(msg string) { l.Log.Debug(msg + l.suffix) }
+func (l *textFieldLog) Debugf(format string, args ...interface{}) {
+	l.Log.Debug(fmt.Sprintf(format, args...) + l.suffix)
+}
+func (l *textFieldLog) Info(msg string) { l.Log.Info(msg + l.suffix) }
+func (l *textFieldLog) Infof(format string, args ...interface{}) {
+	l.Log.Info(fmt.Sprintf(format, args...) + l.suffix)
+}
+func (l *textFieldLog) Warn(msg string) { l.Log.Warn(msg + l.suffix) }
+func (l *textFieldLog) Warnf(format string, args ...interface{}) {
+	l.Log.Warn(fmt.Sprintf(format, args...) + l.suffix)
+}
+func (l *textFieldLog) Error(msg string) { l.Log.Error(msg + l.suffix) }
+func (l *textFieldLog) Errorf(format string, args ...interface{}) {
+	l.Log.Error(fmt.Sprintf(format, args...) + l.suffix)
+}
+func (l *textFieldLog) Critical(msg string) { l.Log.Critical(msg + l.suffix) }
+func (l *textFieldLog) Criticalf(format string, args ...interface{}) {
+	l.Log.Critical(fmt.Sprintf(format, args...) + l.suffix)
+}
@@ -14,6 +14,8 @@
 
 package log
 
+import "fmt"
+
 type Log interface {
 	Trace(msg string)
 	Tracef(format string, args ...interface{})
@@ -104,13 +106,15 @@ func Criticalf(format string, args ...interface{}) {
 // When safe log mode is enabled, the message is downgraded to Debug level
 // with a leading newline, so that line-based log collectors cannot capture
 // the complete sensitive information in a single entry.
+// The matches of the patterns of the redaction set with SetRedaction are masked
+// in either case.
 func UnsafeInfo(msg string) {
 	if safeLogEnabled {
 		// In safe mode, downgrade to Debug level with leading newline
 		// to prevent log collectors from capturing complete sensitive data
-		pluginLog.Debug("\n" + msg)
+		pluginLog.Debug("\n" + RedactString(msg))
 	} else {
-		pluginLog.Info(msg)
+		pluginLog.Info(RedactString(msg))
 	}
 }
 
@@ -118,12 +122,18 @@ func UnsafeInfo(msg string) {
 // When safe log mode is enabled, the message is downgraded to Debug level
 // with a leading newline, so that line-based log collectors cannot capture
 // the complete sensitive information in a single entry.
+// The matches of the patterns of the redaction set with SetRedaction are masked
+// in either case.
 func UnsafeInfof(format string, args ...interface{}) {
-	if safeLogEnabled {
-		// In safe mode, downgrade to Debug level with leading newline
-		// to prevent log collectors from capturing complete sensitive data
-		pluginLog.Debugf("\n"+format, args...)
-	} else {
-		pluginLog.Infof(format, args...)
+	if redaction == nil {
+		if safeLogEnabled {
+			// In safe mode, downgrade to Debug level with leading newline
+			// to prevent log collectors from capturing complete sensitive data
+			pluginLog.Debugf("\n"+format, args...)
+		} else {
+			pluginLog.Infof(format, args...)
+		}
+		return
 	}
+	UnsafeInfo(fmt.Sprintf(format, args...))
 }
@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// maskedPrefixLen is the number of leading characters kept by Mask, e.g. the "sk-" of API keys
+const maskedPrefixLen = 3
+
+// Redaction masks sensitive values in logs, on top of the downgrade of safe log mode
+type Redaction struct {
+	// Headers are the names of headers whose values are masked, case-insensitive
+	Headers []string
+	// BodyPaths are the paths of values masked in JSON bodies and user attributes, in gjson syntax
+	// where # stands for every element of an array, e.g. "api_key" or "messages.#.content"
+	BodyPaths []string
+	// Patterns are masked wherever they match, e.g. sk-[A-Za-z0-9]{20,}
+	Patterns []*regexp.Regexp
+}
+
+var redaction *Redaction
+
+// NewRedaction creates a redaction from its config, compiling the patterns
+func NewRedaction(headers, bodyPaths, patterns []string) (*Redaction, error) {
+	r := &Redaction{Headers: headers, BodyPaths: bodyPaths}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err)
+		}
+		r.Patterns = append(r.Patterns, re)
+	}
+	return r, nil
+}
+
+// SetRedaction sets the redaction of the logs of HTTP and route calls, and of user attributes written
+// to the access log. Safe log mode still downgrades the messages of UnsafeInfo to Debug level.
+func SetRedaction(r *Redaction) {
+	redaction = r
+}
+
+// GetRedaction returns the redaction set with SetRedaction, nil if there is none
+func GetRedaction() *Redaction {
+	return redaction
+}
+
+// Mask hides a value, keeping a few leading characters of long values, e.g. "sk-***"
+func Mask(value string) string {
+	if len(value) <= 2*maskedPrefixLen {
+		return "***"
+	}
+	return value[:maskedPrefixLen] + "***"
+}
+
+// RedactString masks the matches of the patterns of the redaction
+func RedactString(s string) string {
+	if redaction == nil {
+		return s
+	}
+	for _, pattern := range redaction.Patterns {
+		s = pattern.ReplaceAllStringFunc(s, Mask)
+	}
+	return s
+}
+
+// RedactHeaders returns a copy of the headers with the values of redacted headers masked
+func RedactHeaders(headers [][2]string) [][2]string {
+	if redaction == nil {
+		return headers
+	}
+	redacted := make([][2]string, len(headers))
+	for i, header := range headers {
+		redacted[i] = [2]string{header[0], RedactString(header[1])}
+		for _, name := range redaction.Headers {
+			if strings.EqualFold(header[0], name) {
+				redacted[i][1] = Mask(header[1])
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// RedactBody masks the values at the body paths of a JSON body and the matches of the patterns,
+// bodies that are not JSON only get the patterns masked
+func RedactBody(body []byte) []byte {
+	if redaction == nil || len(body) == 0 {
+		return body
+	}
+	if gjson.ValidBytes(body) {
+		for _, path := range redaction.BodyPaths {
+			for _, p := range expandPath(body, path) {
+				value := gjson.GetBytes(body, p)
+				if !value.Exists() {
+					continue
+				}
+				masked := Mask(value.String())
+				if value.Type != gjson.String {
+					masked = "***"
+				}
+				if b, err := sjson.SetBytes(body, p, masked); err == nil {
+					body = b
+				}
+			}
+		}
+	}
+	return []byte(RedactString(string(body)))
+}
+
+// expandPath expands every # of the path into the indexes of the array it stands for
+func expandPath(body []byte, path string) []string {
+	prefix, rest, found := strings.Cut(path, "#")
+	if !found {
+		return []string{path}
+	}
+	array := strings.TrimSuffix(prefix, ".")
+	n := int(gjson.GetBytes(body, array+".#").Int())
+	var paths []string
+	for i := 0; i < n; i++ {
+		paths = append(paths, expandPath(body, prefix+strconv.Itoa(i)+rest)...)
+	}
+	return paths
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLog struct {
+	Log
+	infos, debugs []string
+}
+
+func (l *recordingLog) Info(msg string)  { l.infos = append(l.infos, msg) }
+func (l *recordingLog) Debug(msg string) { l.debugs = append(l.debugs, msg) }
+
+func TestRedaction(t *testing.T) {
+	r, err := NewRedaction([]string{"Authorization"}, []string{"api_key", "messages.#.content", "nested.secret"}, []string{`sk-[A-Za-z0-9]{8,}`})
+	require.NoError(t, err)
+	SetRedaction(r)
+	defer SetRedaction(nil)
+
+	assert.Equal(t, [][2]string{{"authorization", "Bea***"}, {"x-token", "key sk-***"}, {"accept", "*/*"}},
+		RedactHeaders([][2]string{{"authorization", "Bearer abcdef"}, {"x-token", "key sk-abcdefgh12"}, {"accept", "*/*"}}))
+	assert.JSONEq(t, `{"api_key":"***","messages":[{"content":"hel***"},{"content":"***"}],"nested":{"secret":"***"},"model":"sk-***"}`,
+		string(RedactBody([]byte(`{"api_key":"abc","messages":[{"content":"hello world"},{"content":"hi"}],"nested":{"secret":42},"model":"sk-0123456789"}`))))
+	assert.Equal(t, "token=sk-***", string(RedactBody([]byte("token=sk-0123456789"))))
+
+	l := &recordingLog{}
+	SetPluginLog(l)
+	defer SetPluginLog(nil)
+	SetSafeLogEnabled(true)
+	defer SetSafeLogEnabled(false)
+	UnsafeInfof("call with %s", "sk-0123456789")
+	assert.Empty(t, l.infos, "safe log mode applies before the redaction")
+	assert.Equal(t, []string{"\ncall with sk-***"}, l.debugs)
+	SetSafeLogEnabled(false)
+	UnsafeInfo("call with sk-0123456789")
+	assert.Equal(t, []string{"call with sk-***"}, l.infos)
+
+	_, err = NewRedaction(nil, nil, []string{"("})
+	assert.Error(t, err)
+}
+
+func TestRedactionUnset(t *testing.T) {
+	headers := [][2]string{{"authorization", "Bearer abcdef"}}
+	assert.Equal(t, headers, RedactHeaders(headers))
+	assert.Equal(t, `{"api_key":"abc"}`, string(RedactBody([]byte(`{"api_key":"abc"}`))))
+	assert.Equal(t, "***", Mask("abcdef"))
+	assert.Equal(t, "abc***", Mask("abcdefg"))
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import "time"
+
+// Sampler decides which lines of a level are logged, so that plugins serving many requests do not
+// flood the logs: it keeps 1 of every N lines, then limits the kept lines with a token bucket.
+type Sampler struct {
+	every     uint64
+	perSecond float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+	seen      uint64
+	dropped   uint64
+	// unreported are the lines dropped since the last logged line
+	unreported uint64
+	now        func() time.Time
+}
+
+// NewSampler creates a sampler logging 1 of every lines, at most perSecond lines per second on
+// average with bursts of burst lines. every of 0 or 1 keeps all lines, perSecond of 0 is unlimited
+// and burst defaults to perSecond, at least 1.
+func NewSampler(every uint64, perSecond float64, burst int) *Sampler {
+	s := &Sampler{every: every, perSecond: perSecond, burst: float64(burst), now: time.Now}
+	if s.burst <= 0 {
+		s.burst = perSecond
+	}
+	if s.burst < 1 {
+		s.burst = 1
+	}
+	s.tokens = s.burst
+	return s
+}
+
+// Allow tells whether to log a line. When it does, it also returns the number of lines dropped
+// since the last logged line, which the caller should report.
+func (s *Sampler) Allow() (bool, uint64) {
+	s.seen++
+	if s.every > 1 && (s.seen-1)%s.every != 0 {
+		return s.drop()
+	}
+	if s.perSecond > 0 {
+		now := s.now()
+		if !s.last.IsZero() {
+			s.tokens += now.Sub(s.last).Seconds() * s.perSecond
+			if s.tokens > s.burst {
+				s.tokens = s.burst
+			}
+		}
+		s.last = now
+		if s.tokens < 1 {
+			return s.drop()
+		}
+		s.tokens--
+	}
+	unreported := s.unreported
+	s.unreported = 0
+	return true, unreported
+}
+
+func (s *Sampler) drop() (bool, uint64) {
+	s.dropped++
+	s.unreported++
+	return false, 0
+}
+
+// Dropped returns the number of lines dropped so far
+func (s *Sampler) Dropped() uint64 {
+	return s.dropped
+}
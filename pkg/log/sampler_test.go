@@ -0,0 +1,72 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplerRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewSampler(0, 2, 0)
+	s.now = func() time.Time { return now }
+
+	allow := func() bool {
+		allowed, _ := s.Allow()
+		return allowed
+	}
+	assert.True(t, allow())
+	assert.True(t, allow())
+	assert.False(t, allow())
+	assert.False(t, allow())
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, unreported := s.Allow()
+	assert.True(t, allowed)
+	assert.Equal(t, uint64(2), unreported)
+	assert.False(t, allow())
+
+	// The bucket refills up to the burst
+	now = now.Add(time.Minute)
+	assert.True(t, allow())
+	assert.True(t, allow())
+	assert.False(t, allow())
+	assert.Equal(t, uint64(4), s.Dropped())
+}
+
+func TestSamplerEveryAndRate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewSampler(2, 1, 1)
+	s.now = func() time.Time { return now }
+
+	var allowed []bool
+	for i := 0; i < 6; i++ {
+		ok, _ := s.Allow()
+		allowed = append(allowed, ok)
+	}
+	// Lines 0, 2 and 4 are sampled, only the first fits in the bucket
+	assert.Equal(t, []bool{true, false, false, false, false, false}, allowed)
+
+	now = now.Add(time.Second)
+	ok, unreported := s.Allow()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), unreported)
+	ok, unreported = s.Allow()
+	assert.False(t, ok)
+	assert.Equal(t, uint64(0), unreported)
+}
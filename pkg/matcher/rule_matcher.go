@@ -24,6 +24,7 @@ import (
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
 	"github.com/tidwall/gjson"
 
+	"github.com/higress-group/wasm-go/pkg/configerr"
 	"github.com/higress-group/wasm-go/pkg/iface"
 	"github.com/higress-group/wasm-go/pkg/log"
 )
@@ -179,6 +180,11 @@ func (m RuleMatcher[PluginConfig]) GetMatchConfig() (*PluginConfig, error) {
 	return nil, nil
 }
 
+// GetGlobalConfig returns the config outside of _rules_, false if the plugin only has rule configs
+func (m RuleMatcher[PluginConfig]) GetGlobalConfig() (PluginConfig, bool) {
+	return m.globalConfig, m.hasGlobalConfig
+}
+
 func (m *RuleMatcher[PluginConfig]) ParseRuleConfig(context iface.PluginContext, config gjson.Result,
 	parsePluginConfig func(gjson.Result, *PluginConfig) error,
 	parseOverrideConfig func(gjson.Result, PluginConfig, *PluginConfig) error) error {
@@ -217,7 +223,7 @@ func (m *RuleMatcher[PluginConfig]) ParseRuleConfig(context iface.PluginContext,
 	var successfulRules []RuleConfig[PluginConfig]
 	var hasAnyRuleParseError bool
 
-	for _, ruleJson := range rules {
+	for i, ruleJson := range rules {
 		var (
 			rule RuleConfig[PluginConfig]
 			err  error
@@ -254,6 +260,7 @@ func (m *RuleMatcher[PluginConfig]) ParseRuleConfig(context iface.PluginContext,
 		}
 
 		if err != nil {
+			err = locateRuleError(i, err)
 			hasAnyRuleParseError = true
 			if isRuleLevelIsolation {
 				log.Warnf("parse rule config failed for rule %s: %v, trying to load from backup", ruleJson.Raw, err)
@@ -304,6 +311,14 @@ func (m *RuleMatcher[PluginConfig]) ParseRuleConfig(context iface.PluginContext,
 	return nil
 }
 
+// locateRuleError rebases the JSON pointer of a configuration error onto the rule it was found in
+func locateRuleError(index int, err error) error {
+	if _, ok := err.(*configerr.Error); !ok {
+		return err
+	}
+	return configerr.Prefix(configerr.Pointer(RULES_KEY, index), err)
+}
+
 func (m RuleMatcher[PluginConfig]) parseRouteMatchConfig(config gjson.Result) map[string]struct{} {
 	keys := config.Get(MATCH_ROUTE_KEY).Array()
 	routes := make(map[string]struct{})
@@ -81,6 +81,7 @@ func (c *mockPluginContext) GetFingerPrint() string { return "" }
 
 func (c *mockPluginContext) DoLeaderElection() {}
 func (c *mockPluginContext) IsLeader() bool    { return true }
+func (c *mockPluginContext) IsWarmedUp() bool  { return true }
 
 func parseConfig(json gjson.Result, config *customConfig) error {
 	config.name = json.Get("name").String()
@@ -5,7 +5,10 @@ import (
 	"github.com/higress-group/wasm-go/pkg/mcp/server"
 )
 
-var _ server.Server = &MCPServer{}
+var (
+	_ server.ResourceServer = &MCPServer{}
+	_ server.PromptServer   = &MCPServer{}
+)
 
 // MCPServer implements the Server interface using BaseMCPServer
 type MCPServer struct {
@@ -42,6 +45,39 @@ func (s *MCPServer) GetMCPTools() map[string]server.Tool {
 	return s.base.GetMCPTools()
 }
 
+// AddMCPResource implements ResourceServer interface
+func (s *MCPServer) AddMCPResource(resource server.Resource) server.Server {
+	s.base.AddMCPResource(resource)
+	return s
+}
+
+// GetMCPResources implements ResourceServer interface
+func (s *MCPServer) GetMCPResources() map[string]server.Resource {
+	return s.base.GetMCPResources()
+}
+
+// AddMCPResourceTemplate implements ResourceServer interface
+func (s *MCPServer) AddMCPResourceTemplate(template server.ResourceTemplate) server.Server {
+	s.base.AddMCPResourceTemplate(template)
+	return s
+}
+
+// GetMCPResourceTemplates implements ResourceServer interface
+func (s *MCPServer) GetMCPResourceTemplates() []server.ResourceTemplate {
+	return s.base.GetMCPResourceTemplates()
+}
+
+// AddMCPPrompt implements PromptServer interface
+func (s *MCPServer) AddMCPPrompt(prompt server.Prompt) server.Server {
+	s.base.AddMCPPrompt(prompt)
+	return s
+}
+
+// GetMCPPrompts implements PromptServer interface
+func (s *MCPServer) GetMCPPrompts() map[string]server.Prompt {
+	return s.base.GetMCPPrompts()
+}
+
 // SetConfig implements Server interface
 func (s *MCPServer) SetConfig(config []byte) {
 	s.base.SetConfig(config)
@@ -54,6 +90,8 @@ var (
 	InitMCPServer = server.Initialize
 
 	AddMCPServer = server.AddMCPServer
+
+	OnMCPStreamDone = server.OnStreamDone
 )
 
 // mcp filter function
@@ -0,0 +1,494 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/consts"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// AggregateBackend is a backend MCP server of an McpAggregateServer, its tools are exposed with their
+// names prefixed with ToolPrefix
+type AggregateBackend struct {
+	Name       string
+	ToolPrefix string
+	Server     *McpProxyServer // Connection and upstream security settings of the backend
+}
+
+// McpAggregateServer implements Server interface for a composite toolset of several backend MCP servers.
+// tools/list is fanned out to all backends and their tools are merged with the names prefixed per backend,
+// tools/call is routed to the backend owning the prefix of the tool name.
+type McpAggregateServer struct {
+	Name                      string
+	base                      BaseMCPServer
+	backends                  []*AggregateBackend
+	securitySchemes           map[string]SecurityScheme
+	defaultDownstreamSecurity SecurityRequirement // Client-to-gateway authentication of all tools
+	passthroughAuthHeader     bool                // If true, pass through Authorization header even without downstream security
+}
+
+// NewMcpAggregateServer creates a new MCP aggregate server
+func NewMcpAggregateServer(name string) *McpAggregateServer {
+	return &McpAggregateServer{
+		Name:            name,
+		base:            NewBaseMCPServer(),
+		securitySchemes: make(map[string]SecurityScheme),
+	}
+}
+
+// AddBackend adds a backend, its tools are exposed as toolPrefix + the name of the tool on the backend
+func (s *McpAggregateServer) AddBackend(name, toolPrefix string, server *McpProxyServer) {
+	s.backends = append(s.backends, &AggregateBackend{Name: name, ToolPrefix: toolPrefix, Server: server})
+}
+
+// GetBackends returns the backends in the order their tools are listed
+func (s *McpAggregateServer) GetBackends() []*AggregateBackend {
+	return s.backends
+}
+
+// AddSecurityScheme adds a security scheme for the downstream security
+func (s *McpAggregateServer) AddSecurityScheme(scheme SecurityScheme) {
+	s.securitySchemes[scheme.ID] = scheme
+}
+
+// GetSecurityScheme retrieves a security scheme by its ID
+func (s *McpAggregateServer) GetSecurityScheme(id string) (SecurityScheme, bool) {
+	scheme, ok := s.securitySchemes[id]
+	return scheme, ok
+}
+
+// SetDefaultDownstreamSecurity sets the downstream security of all tools
+func (s *McpAggregateServer) SetDefaultDownstreamSecurity(security SecurityRequirement) {
+	s.defaultDownstreamSecurity = security
+}
+
+// GetDefaultDownstreamSecurity gets the downstream security of all tools
+func (s *McpAggregateServer) GetDefaultDownstreamSecurity() SecurityRequirement {
+	return s.defaultDownstreamSecurity
+}
+
+// SetPassthroughAuthHeader sets the passthrough auth header flag
+func (s *McpAggregateServer) SetPassthroughAuthHeader(passthrough bool) {
+	s.passthroughAuthHeader = passthrough
+}
+
+// GetPassthroughAuthHeader gets the passthrough auth header flag
+func (s *McpAggregateServer) GetPassthroughAuthHeader() bool {
+	return s.passthroughAuthHeader
+}
+
+// AddMCPTool implements Server interface
+func (s *McpAggregateServer) AddMCPTool(name string, tool Tool) Server {
+	s.base.AddMCPTool(name, tool)
+	return s
+}
+
+// GetMCPTools implements Server interface, the tools of the backends are only known by listing them
+func (s *McpAggregateServer) GetMCPTools() map[string]Tool {
+	return s.base.GetMCPTools()
+}
+
+// SetConfig implements Server interface
+func (s *McpAggregateServer) SetConfig(config []byte) {
+	s.base.SetConfig(config)
+}
+
+// GetConfig implements Server interface
+func (s *McpAggregateServer) GetConfig(v any) {
+	s.base.GetConfig(v)
+}
+
+// Clone implements Server interface
+func (s *McpAggregateServer) Clone() Server {
+	newServer := &McpAggregateServer{
+		Name:                      s.Name,
+		base:                      s.base.CloneBase(),
+		backends:                  make([]*AggregateBackend, len(s.backends)),
+		securitySchemes:           cloneSecuritySchemes(s.securitySchemes),
+		defaultDownstreamSecurity: s.defaultDownstreamSecurity,
+		passthroughAuthHeader:     s.passthroughAuthHeader,
+	}
+	for i, backend := range s.backends {
+		cloned := *backend
+		cloned.Server = backend.Server.Clone().(*McpProxyServer)
+		newServer.backends[i] = &cloned
+	}
+	return newServer
+}
+
+// backendOf returns the backend owning a tool and the name of the tool on the backend, the longest
+// matching prefix wins
+func (s *McpAggregateServer) backendOf(toolName string) (*AggregateBackend, string, bool) {
+	var owner *AggregateBackend
+	for _, backend := range s.backends {
+		if strings.HasPrefix(toolName, backend.ToolPrefix) && len(toolName) > len(backend.ToolPrefix) &&
+			(owner == nil || len(backend.ToolPrefix) > len(owner.ToolPrefix)) {
+			owner = backend
+		}
+	}
+	if owner == nil {
+		return nil, "", false
+	}
+	return owner, strings.TrimPrefix(toolName, owner.ToolPrefix), true
+}
+
+// upstreamAuthInfo returns the gateway-to-backend authentication of a backend
+func upstreamAuthInfo(backend *AggregateBackend, passthroughCredential string) *ProxyAuthInfo {
+	upstreamSecurity := backend.Server.GetDefaultUpstreamSecurity()
+	if upstreamSecurity.ID == "" {
+		return nil
+	}
+	return &ProxyAuthInfo{
+		SecuritySchemeID:      upstreamSecurity.ID,
+		PassthroughCredential: passthroughCredential,
+		Server:                backend.Server,
+	}
+}
+
+// ForwardToolsList lists the tools of all backends and responds with the merged list. A backend that
+// fails is left out of the list, the request only fails when no backend could be listed.
+func (s *McpAggregateServer) ForwardToolsList(ctx wrapper.HttpContext) error {
+	passthroughCredential := extractDownstreamCredential(s.GetDefaultDownstreamSecurity(), s.GetSecurityScheme, s.GetPassthroughAuthHeader(), "tools/list request")
+
+	listed := make([][][]byte, len(s.backends))
+	pending := len(s.backends)
+	var lastErr error
+	finish := func() {
+		tools := []byte{'['}
+		succeeded := 0
+		for _, backendTools := range listed {
+			if backendTools == nil {
+				continue
+			}
+			succeeded++
+			for _, tool := range backendTools {
+				if len(tools) > 1 {
+					tools = append(tools, ',')
+				}
+				tools = append(tools, tool...)
+			}
+		}
+		tools = append(tools, ']')
+		if succeeded == 0 {
+			utils.OnMCPResponseError(ctx, fmt.Errorf("no backend tools/list succeeded: %w", lastErr), utils.CalloutErrorCode(lastErr), "mcp-aggregate:tools/list:backend_error")
+			return
+		}
+		result := gjson.Parse(`{"tools":` + string(tools) + `}`)
+		utils.OnMCPResponseRawSuccess(ctx, filterAllowedTools(result, effectiveAllowTools(ctx), toolPermissionsOf(ctx)), "mcp-aggregate:tools/list:success")
+	}
+
+	for i, backend := range s.backends {
+		done := func(tools gjson.Result, err error) {
+			pending--
+			if err != nil {
+				log.Warnf("Leaving backend %s out of the tools/list of %s: %v", backend.Name, s.Name, err)
+				lastErr = err
+			} else {
+				listed[i] = prefixTools(tools, backend.ToolPrefix)
+			}
+			if pending == 0 {
+				finish()
+			}
+		}
+		handler := backend.Server.newProtocolHandler()
+		if err := handler.listTools(ctx, upstreamAuthInfo(backend, passthroughCredential), done); err != nil {
+			done(gjson.Result{}, err)
+		}
+	}
+	return nil
+}
+
+// ForwardToolsCall calls a tool on the backend owning it
+func (s *McpAggregateServer) ForwardToolsCall(ctx wrapper.HttpContext, backend *AggregateBackend, toolName string, arguments map[string]interface{}) error {
+	passthroughCredential := extractDownstreamCredential(s.GetDefaultDownstreamSecurity(), s.GetSecurityScheme, s.GetPassthroughAuthHeader(), "tool "+backend.ToolPrefix+toolName)
+	handler := backend.Server.newProtocolHandler()
+	return handler.ForwardToolsCall(ctx, toolName, arguments, upstreamAuthInfo(backend, passthroughCredential))
+}
+
+// prefixTools returns the raw tools of a tools/list result with their names prefixed
+func prefixTools(tools gjson.Result, prefix string) [][]byte {
+	prefixed := [][]byte{}
+	for _, tool := range tools.Array() {
+		name := tool.Get("name")
+		if name.Type != gjson.String {
+			continue
+		}
+		raw, err := sjson.SetBytes([]byte(tool.Raw), "name", prefix+name.String())
+		if err != nil {
+			log.Warnf("Failed to prefix tool %s: %v", name.String(), err)
+			continue
+		}
+		prefixed = append(prefixed, raw)
+	}
+	return prefixed
+}
+
+// listTools negotiates a new session with the backend and lists its tools. Unlike ForwardToolsList it
+// keeps no state in the request context, so that one request can list several backends. callback is
+// called with the tools or the error once done, unless the first request cannot be sent.
+func (h *McpProtocolHandler) listTools(ctx wrapper.HttpContext, authInfo *ProxyAuthInfo, callback func(tools gjson.Result, err error)) error {
+	fail := func(err error) {
+		callback(gjson.Result{}, err)
+	}
+	initBody, _ := json.Marshal(h.createInitializeRequest())
+	return h.sendMcpRequest(ctx, initBody, authInfo, func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+		result, err := backendResult(statusCode, responseHeaders, responseBody)
+		if err != nil {
+			fail(fmt.Errorf("initialize: %w", err))
+			return
+		}
+		h.protocolVersion = result.Get("protocolVersion").String()
+		for _, header := range responseHeaders {
+			if strings.EqualFold(header[0], "Mcp-Session-Id") {
+				h.sessionID = header[1]
+				break
+			}
+		}
+		h.scheduleSessionDelete(ctx)
+
+		notificationBody, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/initialized",
+		})
+		err = h.sendMcpRequest(ctx, notificationBody, authInfo, func(statusCode int, _ [][2]string, responseBody []byte) {
+			if statusCode >= 300 {
+				log.Warnf("Initialized notification to %s failed with status %d: %s", h.backendURL, statusCode, string(responseBody))
+			}
+			listBody, _ := json.Marshal(h.createToolsListRequest(nil))
+			err := h.sendMcpRequest(ctx, listBody, authInfo, func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+				result, err := backendResult(statusCode, responseHeaders, responseBody)
+				if err != nil {
+					fail(fmt.Errorf("tools/list: %w", err))
+					return
+				}
+				callback(result.Get("tools"), nil)
+			})
+			if err != nil {
+				fail(err)
+			}
+		})
+		if err != nil {
+			fail(err)
+		}
+	})
+}
+
+// backendResult returns the result of a JSON-RPC response of the backend
+func backendResult(statusCode int, responseHeaders [][2]string, responseBody []byte) (gjson.Result, error) {
+	if statusCode != 200 {
+		return gjson.Result{}, fmt.Errorf("backend responded with status %d", statusCode)
+	}
+	jsonResponseBody, err := decodeBackendResponse(responseHeaders, responseBody)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	if !gjson.ValidBytes(jsonResponseBody) {
+		return gjson.Result{}, errors.New("invalid JSON response")
+	}
+	response := gjson.ParseBytes(jsonResponseBody)
+	if errorObj := response.Get("error"); errorObj.Exists() {
+		return gjson.Result{}, fmt.Errorf("backend error %d: %s", errorObj.Get("code").Int(), errorObj.Get("message").String())
+	}
+	result := response.Get("result")
+	if !result.IsObject() {
+		return gjson.Result{}, errors.New("invalid response")
+	}
+	return result, nil
+}
+
+// CreateMcpAggregateMethodHandlers creates JSON-RPC method handlers for MCP aggregate operations
+func CreateMcpAggregateMethodHandlers(server *McpAggregateServer, allowTools *map[string]struct{}) utils.MethodHandlers {
+	return utils.MethodHandlers{
+		"tools/list": func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+			// allowTools and the header hold the prefixed names of the tools
+			allowToolsHeaderStr, _ := proxywasm.GetHttpRequestHeader("x-envoy-allow-mcp-tools")
+			proxywasm.RemoveHttpRequestHeader("x-envoy-allow-mcp-tools")
+			ctx.SetContext("mcp_proxy_effective_allow_tools", computeEffectiveAllowToolsFromHeader(allowTools, allowToolsHeaderStr, allowToolsHeaderStr != ""))
+
+			if err := server.ForwardToolsList(ctx); err != nil {
+				return err
+			}
+			ctx.SetContext(utils.CtxNeedPause, true)
+			return nil
+		},
+		"tools/call": func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+			toolName := params.Get("name").String()
+			if toolName == "" {
+				return fmt.Errorf("missing tool name")
+			}
+
+			effectiveAllowTools := computeEffectiveAllowTools(allowTools)
+			if effectiveAllowTools != nil {
+				if _, allow := (*effectiveAllowTools)[toolName]; !allow {
+					utils.OnMCPResponseError(ctx, fmt.Errorf("Tool not allowed: %s", toolName), utils.ErrInvalidParams, fmt.Sprintf("mcp-aggregate:%s:tools/call:tool_not_allowed", server.Name))
+					return nil
+				}
+			}
+
+			backend, backendToolName, ok := server.backendOf(toolName)
+			if !ok {
+				utils.OnMCPResponseError(ctx, fmt.Errorf("unknown tool: %s", toolName), utils.ErrInvalidParams, fmt.Sprintf("mcp-aggregate:%s:tools/call:unknown_tool", server.Name))
+				return nil
+			}
+
+			arguments := make(map[string]interface{})
+			argsResult := params.Get("arguments")
+			if argsResult.Exists() {
+				if err := utils.UnmarshalJSON([]byte(argsResult.Raw), &arguments); err != nil {
+					return fmt.Errorf("invalid arguments: %v", err)
+				}
+			}
+
+			proxywasm.SetProperty([]string{"mcp_server_name"}, []byte(server.Name))
+			proxywasm.SetProperty([]string{"mcp_tool_name"}, []byte(toolName))
+			log.Debugf("Tool call [%s] on server [%s] routed to backend [%s]", toolName, server.Name, backend.Name)
+
+			if err := server.ForwardToolsCall(ctx, backend, backendToolName, arguments); err != nil {
+				return err
+			}
+			ctx.SetContext(utils.CtxNeedPause, true)
+			return nil
+		},
+	}
+}
+
+// backendClusters returns the config of a backend with a single mcpServerURL turned into a pool of one
+// backend called through its cluster, so that every backend is reached through a cluster of its own
+// rather than through the cluster of the route: the one set by cluster, or the one of the URL. The
+// cluster of the backends of a list is set per entry, and a URL without a host is rejected as it
+// could only be resolved against the route.
+func backendClusters(pointer string, backendJson gjson.Result) (string, error) {
+	mcpServerURLJson := backendJson.Get("mcpServerURL")
+	clusterJson := backendJson.Get("cluster")
+	backendRaw, _ := sjson.Delete(backendJson.Raw, "cluster")
+	if mcpServerURLJson.IsArray() {
+		if clusterJson.Exists() {
+			return "", configerr.New(pointer+"/cluster", "", errors.New("cluster is ambiguous with a list of backends, set the cluster of every mcpServerURL entry instead"))
+		}
+		return backendRaw, nil
+	}
+	if clusterJson.Exists() && (clusterJson.Type != gjson.String || clusterJson.String() == "") {
+		return "", configerr.Errorf(pointer+"/cluster", "non-empty string", "got %s", clusterJson.Raw)
+	}
+	if !mcpServerURLJson.Exists() {
+		return backendRaw, nil
+	}
+	if backendJson.Get("loadBalancing").Exists() {
+		return "", configerr.New(pointer+"/loadBalancing", "", errors.New("loadBalancing requires mcpServerURL to list the backends"))
+	}
+	mcpServerURL := mcpServerURLJson.String()
+	if err := validateURL(mcpServerURL); err != nil {
+		return "", configerr.Errorf(pointer+"/mcpServerURL", "http or https URL", "invalid mcpServerURL: %v", err)
+	}
+	if parsed, _ := url.Parse(mcpServerURL); parsed.Host == "" {
+		return "", configerr.Errorf(pointer+"/mcpServerURL", "http or https URL", "mcp-aggregate backends need a URL with a host, got %s", mcpServerURL)
+	}
+	entry := map[string]string{"url": mcpServerURL}
+	if clusterJson.Exists() {
+		entry["cluster"] = clusterJson.String()
+	}
+	return sjson.Set(backendRaw, "mcpServerURL", []map[string]string{entry})
+}
+
+// setupMcpAggregateServer creates and configures an MCP aggregate server. Every backend is configured like
+// an mcp-proxy server with the http transport, and its tools are prefixed with toolPrefix, by default
+// its name followed by "___". Two backends may not share a URL and cluster.
+func setupMcpAggregateServer(serverName string, serverJson gjson.Result, serverConfigJsonForInstance string) (*McpAggregateServer, error) {
+	aggregateServer := NewMcpAggregateServer(serverName)
+	aggregateServer.SetConfig([]byte(serverConfigJsonForInstance))
+	aggregateServer.SetPassthroughAuthHeader(serverJson.Get("passthroughAuthHeader").Bool())
+
+	for i, schemeJson := range serverJson.Get("securitySchemes").Array() {
+		var scheme SecurityScheme
+		if err := configerr.DecodeJSON(configerr.Pointer("securitySchemes", i), []byte(schemeJson.Raw), &scheme); err != nil {
+			return nil, err
+		}
+		if scheme.Type == "oauth2" {
+			return nil, configerr.Errorf(configerr.Pointer("securitySchemes", i, "type"), "apiKey or http", "oauth2 security schemes are only supported by REST servers")
+		}
+		aggregateServer.AddSecurityScheme(scheme)
+	}
+	if defaultDownstreamSecurityJson := serverJson.Get("defaultDownstreamSecurity"); defaultDownstreamSecurityJson.Exists() {
+		var defaultDownstreamSecurity SecurityRequirement
+		if err := configerr.DecodeJSON("/defaultDownstreamSecurity", []byte(defaultDownstreamSecurityJson.Raw), &defaultDownstreamSecurity); err != nil {
+			return nil, err
+		}
+		aggregateServer.SetDefaultDownstreamSecurity(defaultDownstreamSecurity)
+	}
+
+	backendsJson := serverJson.Get("backends")
+	if len(backendsJson.Array()) == 0 {
+		return nil, configerr.New("/backends", "non-empty array", errors.New("backends is required for mcp-aggregate server type"))
+	}
+	prefixes := make(map[string]string)
+	targets := make(map[string]string)
+	for i, backendJson := range backendsJson.Array() {
+		pointer := configerr.Pointer("backends", i)
+		name := backendJson.Get("name").String()
+		if name == "" {
+			return nil, configerr.New(pointer+"/name", "string", errors.New("backend name is required"))
+		}
+		toolPrefix := name + consts.ToolSetNameSplitter
+		if toolPrefixJson := backendJson.Get("toolPrefix"); toolPrefixJson.Exists() {
+			toolPrefix = toolPrefixJson.String()
+		}
+		if toolPrefix == "" {
+			return nil, configerr.New(pointer+"/toolPrefix", "non-empty string", errors.New("toolPrefix must not be empty"))
+		}
+		if other, exists := prefixes[toolPrefix]; exists {
+			return nil, configerr.Errorf(pointer+"/toolPrefix", "unique prefix", "toolPrefix %s is already used by backend %s", toolPrefix, other)
+		}
+		prefixes[toolPrefix] = name
+
+		backendRaw, err := backendClusters(pointer, backendJson)
+		if err != nil {
+			return nil, err
+		}
+		if transport := backendJson.Get("transport"); !transport.Exists() {
+			backendRaw, _ = sjson.Set(backendRaw, "transport", string(TransportHTTP))
+		} else if TransportProtocol(transport.String()) != TransportHTTP {
+			return nil, configerr.Errorf(pointer+"/transport", `"http"`, "mcp-aggregate backends only support http transport")
+		}
+		if backendJson.Get("toolsListCache").Exists() {
+			return nil, configerr.New(pointer+"/toolsListCache", "", errors.New("toolsListCache is not supported by mcp-aggregate backends"))
+		}
+		backendServer, err := setupMcpProxyServer(serverName+"/"+name, gjson.Parse(backendRaw), "")
+		if err != nil {
+			return nil, configerr.Prefix(pointer, err)
+		}
+		for _, backend := range backendServer.GetBackendPool().Backends() {
+			target := backend.Cluster + " " + backend.URL
+			if other, exists := targets[target]; exists {
+				return nil, configerr.Errorf(pointer+"/mcpServerURL", "unique backend", "%s through cluster %s is already a backend of %s", backend.URL, backend.Cluster, other)
+			}
+			targets[target] = name
+		}
+		aggregateServer.AddBackend(name, toolPrefix, backendServer)
+	}
+	return aggregateServer, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// TestParseMcpAggregateServer tests the backends of an mcp-aggregate server and the routing of tool names
+func TestParseMcpAggregateServer(t *testing.T) {
+	server, err := setupMcpAggregateServer("all-tools", gjson.Parse(`{
+		"defaultDownstreamSecurity": {"id": "client"},
+		"securitySchemes": [{"id": "client", "type": "http", "scheme": "bearer"}],
+		"backends": [
+			{"name": "weather", "mcpServerURL": "http://weather/mcp", "timeout": 1000},
+			{"name": "maps", "toolPrefix": "maps_", "mcpServerURL": ["http://maps-a/mcp", "http://maps-b/mcp"]},
+			{"name": "maps-admin", "toolPrefix": "maps_admin_", "transport": "http", "mcpServerURL": "http://maps-admin/mcp", "cluster": "outbound|80||maps-admin.dns"}
+		]
+	}`), "")
+	require.NoError(t, err)
+	backends := server.GetBackends()
+	require.Len(t, backends, 3)
+	assert.Equal(t, "weather___", backends[0].ToolPrefix)
+	assert.Equal(t, TransportHTTP, backends[0].Server.GetTransport())
+	assert.Equal(t, 1000, backends[0].Server.GetTimeout())
+	assert.NotNil(t, backends[1].Server.GetBackendPool())
+	// Every backend is called through a cluster of its own, never through the cluster of the route
+	assert.Equal(t, "http://weather/mcp", backends[0].Server.GetMcpServerURL())
+	assert.Equal(t, "outbound|80||weather", backends[0].Server.newProtocolHandler().backendClient().ClusterName())
+	assert.Equal(t, "outbound|80||maps-admin.dns", backends[2].Server.newProtocolHandler().backendClient().ClusterName())
+	_, ok := server.GetSecurityScheme("client")
+	assert.True(t, ok)
+
+	for toolName, expected := range map[string][2]string{
+		"weather___forecast": {"weather", "forecast"},
+		"maps_route":         {"maps", "route"},
+		"maps_admin_reset":   {"maps-admin", "reset"},
+	} {
+		backend, backendToolName, ok := server.backendOf(toolName)
+		require.True(t, ok, toolName)
+		assert.Equal(t, expected, [2]string{backend.Name, backendToolName})
+	}
+	for _, toolName := range []string{"forecast", "maps_", "weather__forecast"} {
+		_, _, ok := server.backendOf(toolName)
+		assert.False(t, ok, toolName)
+	}
+	assert.Equal(t, backends, server.Clone().(*McpAggregateServer).GetBackends())
+
+	for config, message := range map[string]string{
+		`{}`: `invalid config at "/backends"`,
+		`{"backends": [{"mcpServerURL": "http://a/mcp"}]}`:                                    `invalid config at "/backends/0/name"`,
+		`{"backends": [{"name": "a", "transport": "sse", "mcpServerURL": "http://a/sse"}]}`:   `invalid config at "/backends/0/transport"`,
+		`{"backends": [{"name": "a", "mcpServerURL": "ftp://a/mcp"}]}`:                        `invalid config at "/backends/0/mcpServerURL"`,
+		`{"backends": [{"name": "a", "mcpServerURL": "http://a/mcp", "toolsListCache": {}}]}`: `invalid config at "/backends/0/toolsListCache"`,
+		`{"backends": [{"name": "a", "toolPrefix": "", "mcpServerURL": "http://a/mcp"}]}`:     `invalid config at "/backends/0/toolPrefix"`,
+		`{"backends": [{"name": "a", "toolPrefix": "x_", "mcpServerURL": "http://a/mcp"},
+			{"name": "b", "toolPrefix": "x_", "mcpServerURL": "http://b/mcp"}]}`: `invalid config at "/backends/1/toolPrefix"`,
+		`{"backends": [{"name": "a", "mcpServerURL": "/mcp"}]}`:                                        `invalid config at "/backends/0/mcpServerURL"`,
+		`{"backends": [{"name": "a", "mcpServerURL": "http://a/mcp", "cluster": ""}]}`:                 `invalid config at "/backends/0/cluster"`,
+		`{"backends": [{"name": "a", "mcpServerURL": ["http://a/mcp"], "cluster": "outbound|80||a"}]}`: `invalid config at "/backends/0/cluster"`,
+		`{"backends": [{"name": "a", "mcpServerURL": "http://a/mcp", "loadBalancing": {}}]}`:           `invalid config at "/backends/0/loadBalancing"`,
+		`{"backends": [{"name": "a", "mcpServerURL": "http://a/mcp"},
+			{"name": "b", "mcpServerURL": ["http://b/mcp", {"url": "http://a/mcp", "cluster": "outbound|80||a"}]}]}`: `invalid config at "/backends/1/mcpServerURL"`,
+	} {
+		_, err := setupMcpAggregateServer("all-tools", gjson.Parse(config), "")
+		assert.ErrorContains(t, err, message, config)
+	}
+}
+
+// TestMcpAggregateToolsList tests that tools/list merges the tools of the backends that answered
+func TestMcpAggregateToolsList(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("aggregate-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+
+	server, err := setupMcpAggregateServer("all-tools", gjson.Parse(`{"backends": [
+		{"name": "weather", "mcpServerURL": "http://weather/mcp"},
+		{"name": "maps", "mcpServerURL": "http://maps/mcp"},
+		{"name": "broken", "mcpServerURL": "http://broken/mcp"}
+	]}`), "")
+	require.NoError(t, err)
+	toolsOf := map[string]string{
+		"weather": `[{"name":"forecast","inputSchema":{"type":"object"}}]`,
+		"maps":    `[{"name":"route"},{"name":"geocode"}]`,
+	}
+
+	list := func(allowTools *map[string]struct{}) gjson.Result {
+		contextID := host.InitializeHttpContext()
+		defer host.CompleteHttpContext(contextID)
+		host.CallOnRequestHeaders(contextID, [][2]string{{":authority", "gateway"}, {":path", "/mcp"}, {":method", "POST"}}, false)
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{
+			utils.CtxJsonRpcID:                utils.JsonRpcID{IntValue: 1},
+			"mcp_proxy_effective_allow_tools": allowTools,
+		}}}
+		require.NoError(t, server.ForwardToolsList(ctx))
+
+		sessions := map[string]string{}
+		for callouts := host.GetCalloutAttributesFromContext(contextID); len(callouts) > 0; callouts = host.GetCalloutAttributesFromContext(contextID) {
+			callout := callouts[0]
+			var backend, sessionID string
+			for _, h := range callout.Headers {
+				switch h[0] {
+				case ":authority":
+					backend = h[1]
+				case "Mcp-Session-Id":
+					sessionID = h[1]
+				}
+			}
+			request := gjson.ParseBytes(callout.Body)
+			switch {
+			case backend == "broken":
+				host.CallOnHttpCallResponse(callout.CalloutID, [][2]string{{":status", "503"}}, nil, nil)
+			case request.Get("method").String() == "initialize":
+				sessions[backend] = backend + "-session"
+				host.CallOnHttpCallResponse(callout.CalloutID, [][2]string{{":status", "200"}, {"Mcp-Session-Id", sessions[backend]}},
+					nil, []byte(`{"jsonrpc":"2.0","id":1,"result":{"protocolVersion":"2025-03-26"}}`))
+			case request.Get("method").String() == "notifications/initialized":
+				host.CallOnHttpCallResponse(callout.CalloutID, [][2]string{{":status", "202"}}, nil, nil)
+			default:
+				assert.Equal(t, "tools/list", request.Get("method").String())
+				assert.Equal(t, sessions[backend], sessionID)
+				host.CallOnHttpCallResponse(callout.CalloutID, [][2]string{{":status", "200"}, {"Content-Type", "text/event-stream"}},
+					nil, []byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":2,\"result\":{\"tools\":"+toolsOf[backend]+"}}\n\n"))
+			}
+		}
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response)
+	}
+
+	response := list(nil)
+	assert.Equal(t, `[{"name":"weather___forecast","inputSchema":{"type":"object"}},{"name":"maps___route"},{"name":"maps___geocode"}]`,
+		response.Get("result.tools").Raw)
+
+	response = list(&map[string]struct{}{"maps___geocode": {}})
+	assert.Equal(t, `[{"name":"maps___geocode"}]`, response.Get("result.tools").Raw)
+
+	// Invalid results leave the backends out as well
+	toolsOf = map[string]string{}
+	response = list(nil)
+	assert.Equal(t, int64(utils.ErrInternalError), response.Get("error.code").Int())
+	assert.Contains(t, response.Get("error.message").String(), "no backend tools/list succeeded")
+}
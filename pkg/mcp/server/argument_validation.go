@@ -0,0 +1,391 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// ArgumentError is an argument of tools/call that does not match the input schema of the tool
+type ArgumentError struct {
+	Pointer string // JSON pointer of the argument below the arguments object, empty for the object itself
+	Message string
+}
+
+func (e *ArgumentError) Error() string {
+	pointer := e.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Sprintf("invalid argument at %q: %s", pointer, e.Message)
+}
+
+// argumentsValidator is implemented by the servers that can be configured to validate the arguments of
+// tools/call with validateArguments
+type argumentsValidator interface {
+	ValidatesArguments() bool
+}
+
+// parseValidateArguments parses the validateArguments flag of a server config
+func parseValidateArguments(serverJson gjson.Result) (bool, error) {
+	flag := serverJson.Get("validateArguments")
+	if flag.Exists() && !flag.IsBool() {
+		return false, configerr.Errorf("/validateArguments", "boolean", "got %s", flag.Raw)
+	}
+	return flag.Bool(), nil
+}
+
+// schemaPatterns holds the compiled patterns of the schemas of a tool by expression. They are compiled with the
+// config of the tool and dropped with it.
+type schemaPatterns map[string]*regexp.Regexp
+
+// patternsOf returns the compiled patterns of a tool, nil for tools without a config compiling them
+func patternsOf(tool Tool) schemaPatterns {
+	if t, ok := tool.(interface{ schemaPatterns() schemaPatterns }); ok {
+		return t.schemaPatterns()
+	}
+	return nil
+}
+
+// compile compiles the patterns of a schema and of the schemas nested in it into patterns, so
+// that a tool with an invalid pattern is rejected with its config rather than accepting any value
+func (patterns schemaPatterns) compile(schema gjson.Result, pointer string) error {
+	if !schema.IsObject() {
+		return nil
+	}
+	if pattern := schema.Get("pattern"); pattern.Exists() {
+		if pattern.Type != gjson.String {
+			return configerr.Errorf(pointer+"/pattern", "regular expression", "got %s", pattern.Raw)
+		}
+		if _, ok := patterns[pattern.Str]; !ok {
+			re, err := regexp.Compile(pattern.Str)
+			if err != nil {
+				return configerr.Errorf(pointer+"/pattern", "regular expression", "failed to compile pattern: %v", err)
+			}
+			patterns[pattern.Str] = re
+		}
+	}
+	if err := patterns.compile(schema.Get("items"), pointer+"/items"); err != nil {
+		return err
+	}
+	if err := patterns.compile(schema.Get("additionalProperties"), pointer+"/additionalProperties"); err != nil {
+		return err
+	}
+	var err error
+	schema.Get("properties").ForEach(func(name, property gjson.Result) bool {
+		err = patterns.compile(property, configerr.Join(pointer+"/properties", name.String()))
+		return err == nil
+	})
+	return err
+}
+
+// compileToolPatterns compiles the patterns of the arguments and of the output schema of a tool config
+func compileToolPatterns(args interface{}, outputSchema map[string]any) (schemaPatterns, error) {
+	patterns := schemaPatterns{}
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	for i, arg := range gjson.ParseBytes(raw).Array() {
+		if err := patterns.compile(arg, configerr.Pointer("args", i)); err != nil {
+			return nil, err
+		}
+	}
+	if len(outputSchema) == 0 {
+		return patterns, nil
+	}
+	if raw, err = json.Marshal(outputSchema); err != nil {
+		return nil, err
+	}
+	if err := patterns.compile(gjson.ParseBytes(raw), "/outputSchema"); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// validateToolArguments validates the arguments of a call of the tool against its input schema. Sealed values
+// of its sensitive arguments are skipped, they are validated by validateUnsealedArgument once decrypted.
+func validateToolArguments(tool Tool, arguments gjson.Result) error {
+	schemaBytes, err := json.Marshal(tool.InputSchema())
+	if err != nil {
+		return nil
+	}
+	if !arguments.Exists() {
+		arguments = gjson.Parse("{}")
+	}
+	sealed := map[string]bool{}
+	for _, name := range sensitiveArgsOf(tool) {
+		if value := arguments.Get(gjson.Escape(name)); value.Type == gjson.String && strings.HasPrefix(value.Str, SealedPrefix) {
+			sealed[configerr.Pointer(name)] = true
+		}
+	}
+	return validateSchema(gjson.ParseBytes(schemaBytes), arguments, "", sealed, patternsOf(tool))
+}
+
+// validateUnsealedArgument validates the decrypted value of a sealed argument of the tool against the schema of
+// the argument in its input schema
+func validateUnsealedArgument(tool Tool, name string, value interface{}) error {
+	schemaBytes, err := json.Marshal(tool.InputSchema())
+	if err != nil {
+		return nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	schema := gjson.GetBytes(schemaBytes, "properties."+gjson.Escape(name))
+	return validateSchema(schema, gjson.ParseBytes(raw), configerr.Pointer(name), nil, patternsOf(tool))
+}
+
+// validateProxiedArguments validates the arguments of a proxied call, after the injected arguments are merged
+func validateProxiedArguments(tool Tool, arguments map[string]interface{}) error {
+	if tool == nil {
+		return nil
+	}
+	raw, err := json.Marshal(arguments)
+	if err != nil {
+		return nil
+	}
+	return validateToolArguments(tool, gjson.ParseBytes(raw))
+}
+
+// validateSchema validates a value against the subset of JSON Schema used by tool input schemas: type,
+// required, properties, additionalProperties, items, enum, const, minimum, maximum, exclusiveMinimum,
+// exclusiveMaximum, minLength, maxLength, pattern, minItems and maxItems. Other keywords are ignored. The
+// patterns are taken from the compiled patterns of the tool.
+func validateSchema(schema, value gjson.Result, pointer string, skip map[string]bool, patterns schemaPatterns) error {
+	if !schema.IsObject() || skip[pointer] {
+		return nil
+	}
+	fail := func(format string, args ...interface{}) error {
+		return &ArgumentError{Pointer: pointer, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if types := schema.Get("type"); types.Exists() {
+		matched := false
+		for _, t := range typeNames(types) {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("expected %s, got %s", strings.Join(typeNames(types), " or "), jsonTypeOf(value))
+		}
+	}
+	if constant := schema.Get("const"); constant.Exists() && !jsonEqual(constant, value) {
+		return fail("expected %s", constant.Raw)
+	}
+	if enum := schema.Get("enum"); enum.IsArray() {
+		matched := false
+		for _, item := range enum.Array() {
+			if jsonEqual(item, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fail("expected one of %s", enum.Raw)
+		}
+	}
+
+	switch value.Type {
+	case gjson.Number:
+		if minimum := schema.Get("minimum"); minimum.Type == gjson.Number && value.Num < minimum.Num {
+			return fail("expected a value of at least %s", minimum.Raw)
+		}
+		if maximum := schema.Get("maximum"); maximum.Type == gjson.Number && value.Num > maximum.Num {
+			return fail("expected a value of at most %s", maximum.Raw)
+		}
+		if minimum := schema.Get("exclusiveMinimum"); minimum.Type == gjson.Number && value.Num <= minimum.Num {
+			return fail("expected a value greater than %s", minimum.Raw)
+		}
+		if maximum := schema.Get("exclusiveMaximum"); maximum.Type == gjson.Number && value.Num >= maximum.Num {
+			return fail("expected a value less than %s", maximum.Raw)
+		}
+	case gjson.String:
+		length := utf8.RuneCountInString(value.Str)
+		if minLength := schema.Get("minLength"); minLength.Type == gjson.Number && length < int(minLength.Int()) {
+			return fail("expected at least %d characters", minLength.Int())
+		}
+		if maxLength := schema.Get("maxLength"); maxLength.Type == gjson.Number && length > int(maxLength.Int()) {
+			return fail("expected at most %d characters", maxLength.Int())
+		}
+		if pattern := schema.Get("pattern"); pattern.Type == gjson.String {
+			re, ok := patterns[pattern.Str]
+			if !ok {
+				// Schemas without a config compiling them, e.g. those of tools added in code, are compiled for the
+				// call and not kept, an invalid pattern is not the fault of the caller
+				re, _ = regexp.Compile(pattern.Str)
+			}
+			if re != nil && !re.MatchString(value.Str) {
+				return fail("expected a value matching %s", pattern.Str)
+			}
+		}
+	}
+
+	if value.IsArray() {
+		items := value.Array()
+		if minItems := schema.Get("minItems"); minItems.Type == gjson.Number && len(items) < int(minItems.Int()) {
+			return fail("expected at least %d items", minItems.Int())
+		}
+		if maxItems := schema.Get("maxItems"); maxItems.Type == gjson.Number && len(items) > int(maxItems.Int()) {
+			return fail("expected at most %d items", maxItems.Int())
+		}
+		for i, item := range items {
+			if err := validateSchema(schema.Get("items"), item, configerr.Join(pointer, i), skip, patterns); err != nil {
+				return err
+			}
+		}
+	}
+
+	if value.IsObject() {
+		for _, name := range schema.Get("required").Array() {
+			if !value.Get(gjson.Escape(name.String())).Exists() {
+				return &ArgumentError{Pointer: configerr.Join(pointer, name.String()), Message: "required argument is missing"}
+			}
+		}
+		properties := schema.Get("properties")
+		additional := schema.Get("additionalProperties")
+		var err error
+		value.ForEach(func(name, property gjson.Result) bool {
+			propertyPointer := configerr.Join(pointer, name.String())
+			if propertySchema := properties.Get(gjson.Escape(name.String())); propertySchema.Exists() {
+				err = validateSchema(propertySchema, property, propertyPointer, skip, patterns)
+			} else if additional.Type == gjson.False {
+				err = &ArgumentError{Pointer: propertyPointer, Message: "unknown argument"}
+			} else {
+				err = validateSchema(additional, property, propertyPointer, skip, patterns)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typeNames returns the types of the type keyword, a string or an array of strings
+func typeNames(types gjson.Result) []string {
+	if !types.IsArray() {
+		return []string{types.String()}
+	}
+	var names []string
+	for _, t := range types.Array() {
+		names = append(names, t.String())
+	}
+	return names
+}
+
+func matchesType(name string, value gjson.Result) bool {
+	switch name {
+	case "string":
+		return value.Type == gjson.String
+	case "number":
+		return value.Type == gjson.Number
+	case "integer":
+		return value.Type == gjson.Number && value.Num == math.Trunc(value.Num)
+	case "boolean":
+		return value.IsBool()
+	case "array":
+		return value.IsArray()
+	case "object":
+		return value.IsObject()
+	case "null":
+		return value.Type == gjson.Null && value.Exists()
+	default:
+		// Unknown types are not enforced
+		return true
+	}
+}
+
+func jsonTypeOf(value gjson.Result) string {
+	switch {
+	case value.IsArray():
+		return "array"
+	case value.IsObject():
+		return "object"
+	case value.IsBool():
+		return "boolean"
+	case value.Type == gjson.Number:
+		return "number"
+	case value.Type == gjson.String:
+		return "string"
+	default:
+		return "null"
+	}
+}
+
+// jsonEqual reports whether two JSON values are equal, numbers are compared by value and objects regardless
+// of the order of their keys
+func jsonEqual(a, b gjson.Result) bool {
+	switch {
+	case a.Type == gjson.Number || b.Type == gjson.Number:
+		return a.Type == b.Type && a.Num == b.Num
+	case a.IsArray() || b.IsArray():
+		if !a.IsArray() || !b.IsArray() {
+			return false
+		}
+		itemsA, itemsB := a.Array(), b.Array()
+		if len(itemsA) != len(itemsB) {
+			return false
+		}
+		for i := range itemsA {
+			if !jsonEqual(itemsA[i], itemsB[i]) {
+				return false
+			}
+		}
+		return true
+	case a.IsObject() || b.IsObject():
+		if !a.IsObject() || !b.IsObject() {
+			return false
+		}
+		mapA, mapB := a.Map(), b.Map()
+		if len(mapA) != len(mapB) {
+			return false
+		}
+		for key, valueA := range mapA {
+			valueB, ok := mapB[key]
+			if !ok || !jsonEqual(valueA, valueB) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Type == b.Type && a.Str == b.Str
+	}
+}
+
+// onInvalidArguments answers a tools/call whose arguments do not match the input schema of the tool with an
+// invalid params error whose data locates the argument
+func onInvalidArguments(ctx wrapper.HttpContext, debugPrefix string, err error) {
+	data := map[string]any{}
+	if argErr, ok := err.(*ArgumentError); ok {
+		data["path"] = argErr.Pointer
+	}
+	utils.OnJsonRpcResponseErrorWithData(ctx, err, utils.ErrInvalidParams, data, debugPrefix+":tools/call:invalid_arguments")
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+)
+
+// TestValidateSchema tests the keywords of the argument validation
+func TestValidateSchema(t *testing.T) {
+	schema := gjson.Parse(`{
+		"type": "object",
+		"required": ["query"],
+		"properties": {
+			"query": {"type": "string", "minLength": 1, "maxLength": 8, "pattern": "^[a-z ]+$"},
+			"limit": {"type": "integer", "minimum": 1, "maximum": 100},
+			"ratio": {"type": "number", "exclusiveMinimum": 0},
+			"mode": {"enum": ["fast", 1, {"a": [1, 2]}]},
+			"version": {"const": 2},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+			"filters": {"type": "array", "items": {
+				"type": "object",
+				"required": ["field"],
+				"additionalProperties": false,
+				"properties": {"field": {"type": "string"}, "op": {"enum": ["eq", "ne"]}}
+			}},
+			"owner/id": {"type": ["string", "null"]}
+		}
+	}`)
+	patterns := schemaPatterns{}
+	require.NoError(t, patterns.compile(schema, ""))
+	assert.Contains(t, patterns, "^[a-z ]+$")
+
+	for args, expected := range map[string]string{
+		`{"query": "red shoes"}`: `invalid argument at "/query": expected at most 8 characters`,
+		`{"query": "shoes", "limit": 20, "ratio": 0.5, "mode": {"a": [1, 2]}, "version": 2.0, "tags": ["x"], "owner/id": null}`: "",
+		`{"query": "shoes", "mode": 1.0}`:         "",
+		`{"limit": 1}`:                            `invalid argument at "/query": required argument is missing`,
+		`{"query": ""}`:                           `invalid argument at "/query": expected at least 1 characters`,
+		`{"query": "Shoes"}`:                      `invalid argument at "/query": expected a value matching ^[a-z ]+$`,
+		`{"query": 1}`:                            `invalid argument at "/query": expected string, got number`,
+		`{"query": "a", "limit": 2.5}`:            `invalid argument at "/limit": expected integer, got number`,
+		`{"query": "a", "limit": 0}`:              `invalid argument at "/limit": expected a value of at least 1`,
+		`{"query": "a", "limit": 101}`:            `invalid argument at "/limit": expected a value of at most 100`,
+		`{"query": "a", "ratio": 0}`:              `invalid argument at "/ratio": expected a value greater than 0`,
+		`{"query": "a", "mode": "slow"}`:          `invalid argument at "/mode": expected one of ["fast", 1, {"a": [1, 2]}]`,
+		`{"query": "a", "version": "2"}`:          `invalid argument at "/version": expected 2`,
+		`{"query": "a", "tags": ["x", 1]}`:        `invalid argument at "/tags/1": expected string, got number`,
+		`{"query": "a", "tags": ["x", "y", "z"]}`: `invalid argument at "/tags": expected at most 2 items`,
+		`{"query": "a", "filters": [{"field": "x", "op": "eq"}, {"op": "gt"}]}`: `invalid argument at "/filters/1/field": required argument is missing`,
+		`{"query": "a", "filters": [{"field": "x", "op": "gt"}]}`:               `invalid argument at "/filters/0/op": expected one of ["eq", "ne"]`,
+		`{"query": "a", "filters": [{"field": "x", "value": 1}]}`:               `invalid argument at "/filters/0/value": unknown argument`,
+		`{"query": "a", "owner/id": 7}`:                                         `invalid argument at "/owner~1id": expected string or null, got number`,
+		`[]`:                                                                    `invalid argument at "/": expected object, got array`,
+	} {
+		// Patterns missing from the compiled patterns are compiled for the call
+		for _, patterns := range []schemaPatterns{patterns, nil} {
+			err := validateSchema(schema, gjson.Parse(args), "", nil, patterns)
+			if expected == "" {
+				assert.NoError(t, err, args)
+			} else {
+				assert.EqualError(t, err, expected, args)
+			}
+		}
+	}
+}
+
+// TestValidateArguments tests that REST tools/call arguments are validated when validateArguments is set
+func TestValidateArguments(t *testing.T) {
+	defer startTestHttpContext("validate-arguments-test")()
+
+	parse := func(validate bool) *McpServerConfig {
+		config := &McpServerConfig{}
+		serverJson := `{"name": "shop", "dryRun": "always"}`
+		if validate {
+			serverJson = `{"name": "shop", "dryRun": "always", "validateArguments": true}`
+		}
+		require.NoError(t, parseConfigCore(gjson.Parse(`{
+			"server": `+serverJson+`,
+			"tools": [{
+				"name": "search",
+				"args": [
+					{"name": "query", "description": "Keywords", "required": true, "pattern": "^[a-z]+$"},
+					{"name": "limit", "description": "Page size", "type": "integer", "minimum": 1, "maximum": 50}
+				],
+				"requestTemplate": {"url": "http://shop.example.com/search", "method": "GET"}
+			}]
+		}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+		return config
+	}
+	call := func(config *McpServerConfig, args string) gjson.Result {
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}
+		require.NoError(t, config.methodHandlers["tools/call"](ctx, utils.JsonRpcID{IntValue: 1}, gjson.Parse(`{"name": "search", "arguments": `+args+`}`)))
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response)
+	}
+
+	config := parse(true)
+	assert.Contains(t, patternsOf(config.server.GetMCPTools()["search"]), "^[a-z]+$", "the patterns are compiled with the tool")
+	assert.True(t, call(config, `{"query": "shoes", "limit": 10}`).Get("result").Exists())
+	response := call(config, `{"query": "shoes", "limit": 100}`)
+	assert.Equal(t, int64(utils.ErrInvalidParams), response.Get("error.code").Int())
+	assert.Equal(t, `invalid argument at "/limit": expected a value of at most 50`, response.Get("error.message").String())
+	assert.Equal(t, "/limit", response.Get("error.data.path").String())
+	assert.Equal(t, "/query", call(config, `{}`).Get("error.data.path").String())
+
+	assert.True(t, call(parse(false), `{"query": "shoes", "limit": 100}`).Get("result").Exists(), "arguments are not validated by default")
+
+	err := parseConfigCore(gjson.Parse(`{"server": {"name": "shop", "validateArguments": "yes"}, "tools": [{"name": "a", "requestTemplate": {"url": "http://a", "method": "GET"}}]}`),
+		&McpServerConfig{}, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+	assert.ErrorContains(t, err, `invalid config at "/server/validateArguments", expected boolean`)
+
+	// Invalid patterns are rejected with the config instead of accepting any value
+	for tool, pointer := range map[string]string{
+		`{"name": "a", "args": [{"name": "q", "pattern": "[a-"}]}`:                                                    "/tools/0/args/0/pattern",
+		`{"name": "a", "args": [{"name": "q", "type": "array", "items": {"type": "string", "pattern": "(?<x>"}}]}`:    "/tools/0/args/0/items/pattern",
+		`{"name": "a", "outputSchema": {"type": "object", "properties": {"id": {"type": "string", "pattern": "*"}}}}`: "/tools/0/outputSchema/properties/id/pattern",
+	} {
+		tool = tool[:len(tool)-1] + `, "requestTemplate": {"url": "http://a", "method": "GET"}}`
+		err := parseConfigCore(gjson.Parse(`{"server": {"name": "shop"}, "tools": [`+tool+`]}`),
+			&McpServerConfig{}, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+		assert.ErrorContains(t, err, `invalid config at "`+pointer+`", expected regular expression`, tool)
+	}
+	server := NewMcpProxyServer("validate-proxy-test")
+	err = server.AddProxyTool(McpProxyToolConfig{Name: "a", OutputSchema: map[string]any{"pattern": "[a-"}})
+	assert.ErrorContains(t, err, `invalid config at "/outputSchema/pattern"`)
+}
+
+// TestValidateSealedArguments tests that the sealed values of sensitive arguments are validated once unsealed
+func TestValidateSealedArguments(t *testing.T) {
+	defer startTestHttpContext("validate-sealed-test")()
+
+	config := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(`{
+		"server": {"name": "payments", "dryRun": "always", "validateArguments": true, "argSealKey": "`+base64.StdEncoding.EncodeToString(testArgSealKey)+`"},
+		"tools": [{
+			"name": "pay",
+			"args": [
+				{"name": "card", "type": "string", "sensitive": true, "pattern": "^[0-9 ]{12,19}$"},
+				{"name": "amount", "type": "number", "minimum": 0}
+			],
+			"requestTemplate": {"url": "https://pay.example.com/v1/charges", "method": "POST", "argsToJsonBody": true}
+		}]
+	}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+	sealer := config.server.(*RestMCPServer).GetArgSealer()
+	call := func(args string) gjson.Result {
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}
+		require.NoError(t, config.methodHandlers["tools/call"](ctx, utils.JsonRpcID{IntValue: 1}, gjson.Parse(`{"name": "pay", "arguments": `+args+`}`)))
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response)
+	}
+
+	valid, _ := sealer.Seal("pay", "card", "4111 1111 1111 1111")
+	assert.True(t, call(`{"card": "`+valid+`", "amount": 1}`).Get("result").Exists())
+
+	invalid, _ := sealer.Seal("pay", "card", "not a card")
+	response := call(`{"card": "` + invalid + `", "amount": 1}`)
+	assert.Equal(t, int64(utils.ErrInvalidParams), response.Get("error.code").Int())
+	assert.Equal(t, "/card", response.Get("error.data.path").String())
+	assert.NotContains(t, response.Raw, "not a card", "the unsealed value is not echoed")
+}
+
+// TestValidateProxiedArguments tests the validation of the arguments of configured mcp-proxy tools
+func TestValidateProxiedArguments(t *testing.T) {
+	server := NewMcpProxyServer("validate-proxy-test")
+	require.NoError(t, server.AddProxyTool(McpProxyToolConfig{Name: "query", Args: []ToolArg{
+		{Name: "tenantId", Type: "string", Required: true},
+		{Name: "region", Type: "string", Enum: []interface{}{"cn", "us"}},
+	}}))
+	tool := server.GetMCPTools()["query"]
+	assert.NoError(t, validateProxiedArguments(tool, map[string]interface{}{"tenantId": "acme", "region": "cn"}))
+	assert.EqualError(t, validateProxiedArguments(tool, map[string]interface{}{"region": "cn"}), `invalid argument at "/tenantId": required argument is missing`)
+	assert.EqualError(t, validateProxiedArguments(tool, map[string]interface{}{"tenantId": "acme", "region": "eu"}), `invalid argument at "/region": expected one of ["cn","us"]`)
+	assert.NoError(t, validateProxiedArguments(nil, map[string]interface{}{"any": 1}))
+}
@@ -47,11 +47,20 @@ func setOrReplaceHeader(headers *[][2]string, key, value string) {
 // SecurityScheme defines a security scheme for the REST API
 type SecurityScheme struct {
 	ID                string `json:"id"`
-	Type              string `json:"type"`             // http, apiKey
+	Type              string `json:"type"`             // http, apiKey, oauth2
 	Scheme            string `json:"scheme,omitempty"` // basic, bearer (for type: http)
 	In                string `json:"in,omitempty"`     // header, query (for type: apiKey)
 	Name              string `json:"name,omitempty"`   // Header or query parameter name (for type: apiKey)
 	DefaultCredential string `json:"defaultCredential,omitempty"`
+
+	// For type: oauth2, a bearer token is acquired from the token endpoint with the client credentials grant
+	TokenURL         string   `json:"tokenUrl,omitempty"`
+	ClientID         string   `json:"clientId,omitempty"`
+	ClientSecret     string   `json:"clientSecret,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+	Audience         string   `json:"audience,omitempty"`
+	TokenServiceFQDN string   `json:"tokenServiceFqdn,omitempty"` // Cluster of the token endpoint, defaults to its host
+	TokenServicePort int64    `json:"tokenServicePort,omitempty"`
 }
 
 // SecurityRequirement specifies a security scheme requirement for a tool
@@ -68,6 +77,7 @@ type AuthRequestContext struct {
 	ParsedURL             *url.URL    // Pointer to allow modification (e.g., RawQuery)
 	RequestBody           []byte      // For future security types that might inspect the body
 	PassthroughCredential string      // Credential extracted from client request for passthrough
+	OAuth2Token           string      // Access token acquired for an oauth2 scheme
 }
 
 // SecuritySchemeProvider provides access to security schemes
@@ -83,6 +93,10 @@ func ExtractAndRemoveIncomingCredential(scheme SecurityScheme) (string, error) {
 	credentialValue := ""
 	var err error
 
+	if scheme.Type == "oauth2" {
+		// Clients of oauth2 schemes send bearer tokens
+		scheme.Type, scheme.Scheme = "http", "bearer"
+	}
 	switch scheme.Type {
 	case "http":
 		authHeader, _ := proxywasm.GetHttpRequestHeader("Authorization") // Error ignored, check content
@@ -168,6 +182,18 @@ func ApplySecurity(securityConfig SecurityRequirement, provider SecuritySchemePr
 	}
 
 	var credentialToUse string
+	if upstreamScheme.Type == "oauth2" {
+		// The acquired token is used unless the client credential is passed through
+		credentialToUse = reqCtx.PassthroughCredential
+		if credentialToUse == "" {
+			credentialToUse = reqCtx.OAuth2Token
+		}
+		if credentialToUse == "" {
+			return fmt.Errorf("no access token was acquired for oauth2 security scheme '%s'", upstreamScheme.ID)
+		}
+		setOrReplaceHeader(&reqCtx.Headers, "Authorization", "Bearer "+credentialToUse)
+		return nil
+	}
 	if reqCtx.PassthroughCredential != "" {
 		// Use the passthrough credential value.
 		// The upstreamScheme dictates how this value is formatted and applied.
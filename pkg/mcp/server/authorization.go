@@ -0,0 +1,206 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	defaultScopeClaim = "scope"
+	// ctxKeyToolPermissions holds the toolPermissions of the caller of a tools/list or tools/call request
+	ctxKeyToolPermissions = "mcp_tool_permissions"
+)
+
+// AuthorizationConfig grants scopes to the callers of a server, the tools configured with scopes can
+// only be listed and called by the callers granted all of them. The scopes are only taken from the
+// identity authenticated by the gateway, never from values the client sends.
+type AuthorizationConfig struct {
+	Consumers     map[string][]string `json:"consumers"`     // Scopes granted to the consumers by name, the consumer is the one authenticated by the gateway
+	ScopeClaim    string              `json:"scopeClaim"`    // Claim holding the scopes of JWT consumers, defaults to scope
+	DefaultScopes []string            `json:"defaultScopes"` // Scopes granted to every caller, including anonymous ones
+}
+
+// ToolWithScopes is implemented by tools that can only be listed and called by the callers granted
+// their scopes
+type ToolWithScopes interface {
+	Scopes() []string
+}
+
+// scopesOf returns the scopes required by a tool
+func scopesOf(tool Tool) []string {
+	if t, ok := tool.(ToolWithScopes); ok {
+		return t.Scopes()
+	}
+	return nil
+}
+
+// ToolAuthorization enforces the scopes of the tools of a server
+type ToolAuthorization struct {
+	config     AuthorizationConfig
+	toolScopes map[string][]string // Scopes required by the tools configured with scopes
+	// composed is the composed server of a toolSet, whose tools require the scopes of the tools they
+	// are taken from, read from the tool registry on every request as the servers may be configured later
+	composed Server
+}
+
+// toolPermissions are the scopes granted to the caller of a request
+type toolPermissions struct {
+	consumer   string
+	scopes     map[string]struct{}
+	toolScopes map[string][]string
+}
+
+// parseAuthorization validates the authorization config, toolScopes are the scopes of the tools
+func parseAuthorization(authorizationJson gjson.Result, toolScopes map[string][]string) (*ToolAuthorization, error) {
+	var config AuthorizationConfig
+	if authorizationJson.Exists() {
+		if err := configerr.DecodeJSON("", []byte(authorizationJson.Raw), &config); err != nil {
+			return nil, err
+		}
+	}
+	for consumer, scopes := range config.Consumers {
+		for i, scope := range scopes {
+			if scope == "" {
+				return nil, configerr.Errorf(configerr.Pointer("consumers", consumer, i), "non-empty string", "scope of consumer %s is empty", consumer)
+			}
+		}
+	}
+	if config.ScopeClaim == "" {
+		config.ScopeClaim = defaultScopeClaim
+	}
+	return &ToolAuthorization{config: config, toolScopes: toolScopes}, nil
+}
+
+// scopes returns the scopes required by the tools configured with scopes
+func (a *ToolAuthorization) scopes() map[string][]string {
+	if a.composed == nil {
+		return a.toolScopes
+	}
+	toolScopes := make(map[string][]string)
+	for name, tool := range a.composed.GetMCPTools() {
+		if scopes := scopesOf(tool); len(scopes) > 0 {
+			toolScopes[name] = scopes
+		}
+	}
+	return toolScopes
+}
+
+// permissions returns the scopes granted to the caller of the current request: the default scopes,
+// the scopes of its consumer and of the scope claim of its JWT
+func (a *ToolAuthorization) permissions(ctx wrapper.HttpContext) *toolPermissions {
+	p := &toolPermissions{scopes: make(map[string]struct{}), toolScopes: a.scopes()}
+	grant := func(scopes ...string) {
+		for _, scope := range scopes {
+			p.scopes[scope] = struct{}{}
+		}
+	}
+	grant(a.config.DefaultScopes...)
+	if consumer := ctx.Consumer(); consumer != nil {
+		p.consumer = consumer.Name
+		grant(a.config.Consumers[consumer.Name]...)
+		grant(claimScopes(consumer.Claims[a.config.ScopeClaim])...)
+	}
+	return p
+}
+
+// claimScopes returns the scopes of a claim, a space-separated string (RFC 8693) or an array of strings
+func claimScopes(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var scopes []string
+		for _, v := range value {
+			if scope, ok := v.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// missingScopes returns the sorted scopes of a tool the caller is not granted
+func (p *toolPermissions) missingScopes(tool string) []string {
+	if p == nil {
+		return nil
+	}
+	var missing []string
+	for _, scope := range p.toolScopes[tool] {
+		if _, ok := p.scopes[scope]; !ok {
+			missing = append(missing, scope)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// allows tells whether the caller may list and call a tool, a nil toolPermissions allows every tool
+func (p *toolPermissions) allows(tool string) bool {
+	return len(p.missingScopes(tool)) == 0
+}
+
+// toolPermissionsOf returns the toolPermissions of the request, nil if the server has no authorization
+func toolPermissionsOf(ctx wrapper.HttpContext) *toolPermissions {
+	p, _ := ctx.GetContext(ctxKeyToolPermissions).(*toolPermissions)
+	return p
+}
+
+// wrap sets the permissions of the caller for the tools/list handler, which hides the tools the
+// caller may not call, and rejects the tools/call requests of tools the caller is not granted the
+// scopes of with a permission denied error
+func (a *ToolAuthorization) wrap(handlers utils.MethodHandlers) {
+	if list := handlers["tools/list"]; list != nil {
+		handlers["tools/list"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+			ctx.SetContext(ctxKeyToolPermissions, a.permissions(ctx))
+			return list(ctx, id, params)
+		}
+	}
+	if call := handlers["tools/call"]; call != nil {
+		handlers["tools/call"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+			permissions := a.permissions(ctx)
+			ctx.SetContext(ctxKeyToolPermissions, permissions)
+			tool := params.Get("name").String()
+			if missing := permissions.missingScopes(tool); len(missing) > 0 {
+				a.reject(ctx, permissions, tool, missing)
+				return nil
+			}
+			return call(ctx, id, params)
+		}
+	}
+}
+
+// reject answers the call of a tool the caller is not granted the scopes of
+func (a *ToolAuthorization) reject(ctx wrapper.HttpContext, permissions *toolPermissions, tool string, missing []string) {
+	consumer := permissions.consumer
+	if consumer == "" {
+		consumer = anonymousConsumer
+	}
+	log.Debugf("consumer %s is denied tool %s, missing scopes %s", consumer, tool, strings.Join(missing, " "))
+	data := map[string]any{"tool": tool, "requiredScopes": permissions.toolScopes[tool], "missingScopes": missing}
+	message := fmt.Sprintf("permission denied: tool %s requires scopes %s", tool, strings.Join(missing, " "))
+	utils.OnJsonRpcResponseErrorWithData(ctx, errors.New(message), utils.ErrPermissionDenied, data, "mcp:tools/call:permission_denied")
+}
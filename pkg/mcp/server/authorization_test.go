@@ -0,0 +1,176 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// consumerContextStub is a phaseContextStub with the consumer of the request
+type consumerContextStub struct {
+	phaseContextStub
+	consumer *wrapper.Consumer
+}
+
+func (c *consumerContextStub) Consumer() *wrapper.Consumer {
+	return c.consumer
+}
+
+// TestParseAuthorization tests validation of the authorization config
+func TestParseAuthorization(t *testing.T) {
+	authorization, err := parseAuthorization(gjson.Parse(`{}`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultScopeClaim, authorization.config.ScopeClaim)
+
+	var cfgErr *configerr.Error
+	_, err = parseAuthorization(gjson.Parse(`{"consumers": {"alice": ["read", ""]}}`), nil)
+	if assert.ErrorAs(t, err, &cfgErr) {
+		assert.Equal(t, "/consumers/alice/1", cfgErr.Pointer)
+	}
+	_, err = parseAuthorization(gjson.Parse(`{"defaultScopes": "read"}`), nil)
+	if assert.ErrorAs(t, err, &cfgErr) {
+		assert.Equal(t, "/defaultScopes", cfgErr.Pointer)
+	}
+}
+
+// TestClaimScopes tests reading the scopes of space-separated and array claims
+func TestClaimScopes(t *testing.T) {
+	assert.Equal(t, []string{"read", "write"}, claimScopes("read  write"))
+	assert.Equal(t, []string{"read", "write"}, claimScopes([]interface{}{"read", 1, "write"}))
+	assert.Nil(t, claimScopes(nil))
+}
+
+// TestToolAuthorization tests that tools/list hides and tools/call rejects the tools the caller is not granted the scopes of
+func TestToolAuthorization(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("authorization-test")))
+	defer func() {
+		reset()
+		log.SetPluginLog(&testLogger{})
+	}()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	contextID := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(contextID, [][2]string{{":path", "/mcp"}, {"x-scopes", "admin,audit"}}, false)
+
+	config := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(`{
+		"server": {"name": "weather-server", "mock": "always", "authorization": {
+			"consumers": {"alice": ["weather:write"]},
+			"defaultScopes": ["weather:read"]
+		}},
+		"tools": [
+			{"name": "get_weather", "scopes": ["weather:read"], "requestTemplate": {"url": "http://weather.example.com/now", "method": "GET"}, "mockResponse": "sunny"},
+			{"name": "set_alert", "scopes": ["weather:read", "weather:write"], "requestTemplate": {"url": "http://weather.example.com/alerts", "method": "POST"}, "mockResponse": "ok"},
+			{"name": "purge_cache", "scopes": ["admin"], "requestTemplate": {"url": "http://weather.example.com/cache", "method": "DELETE"}, "mockResponse": "ok"},
+			{"name": "get_time", "requestTemplate": {"url": "http://weather.example.com/time", "method": "GET"}, "mockResponse": "noon"}
+		]
+	}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+
+	request := func(consumer *wrapper.Consumer, method, params string) gjson.Result {
+		ctx := &consumerContextStub{phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}, consumer}
+		require.NoError(t, config.methodHandlers[method](ctx, utils.JsonRpcID{IntValue: 1}, gjson.Parse(params)))
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response)
+	}
+	listed := func(consumer *wrapper.Consumer) []string {
+		var names []string
+		for _, tool := range request(consumer, "tools/list", `{}`).Get("result.tools.#.name").Array() {
+			names = append(names, tool.String())
+		}
+		return names
+	}
+
+	alice := &wrapper.Consumer{Name: "alice"}
+	assert.ElementsMatch(t, []string{"get_weather", "set_alert", "get_time"}, listed(alice))
+	assert.ElementsMatch(t, []string{"get_weather", "get_time"}, listed(nil))
+	bob := &wrapper.Consumer{Name: "bob", Scheme: "jwt", Claims: map[string]interface{}{"scope": "weather:write"}}
+	assert.ElementsMatch(t, []string{"get_weather", "set_alert", "get_time"}, listed(bob))
+
+	response := request(alice, "tools/call", `{"name": "set_alert", "arguments": {}}`)
+	assert.Equal(t, "ok", response.Get("result.content.0.text").String())
+
+	response = request(nil, "tools/call", `{"name": "set_alert", "arguments": {}}`)
+	assert.Equal(t, int64(utils.ErrPermissionDenied), response.Get("error.code").Int())
+	assert.Equal(t, "permission denied: tool set_alert requires scopes weather:write", response.Get("error.message").String())
+	assert.JSONEq(t, `["weather:read", "weather:write"]`, response.Get("error.data.requiredScopes").Raw)
+	assert.JSONEq(t, `["weather:write"]`, response.Get("error.data.missingScopes").Raw)
+
+	// Scopes sent by the client are ignored
+	response = request(alice, "tools/call", `{"name": "purge_cache", "arguments": {}}`)
+	assert.Equal(t, int64(utils.ErrPermissionDenied), response.Get("error.code").Int())
+	assert.NotContains(t, listed(nil), "purge_cache")
+
+	// Unknown tools only suggest the tools the caller may call
+	response = request(nil, "tools/call", `{"name": "set_alerts", "arguments": {}}`)
+	assert.JSONEq(t, `["get_time", "get_weather"]`, response.Get("error.data.availableTools").Raw)
+}
+
+// TestToolSetAuthorization tests that the tools of a toolSet require the scopes of the tools they are taken from
+func TestToolSetAuthorization(t *testing.T) {
+	defer startTestHttpContext("toolset-authorization-test")()
+
+	registry := newTestToolRegistry()
+	toolSet := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(`{
+		"toolSet": {"name": "ops", "serverTools": [{"serverName": "weather-server", "tools": ["get_weather", "purge_cache"]}],
+			"authorization": {"consumers": {"alice": ["admin"]}}}
+	}`), toolSet, &ConfigOptions{ToolRegistry: registry}))
+	// The server is configured after the toolSet
+	require.NoError(t, parseConfigCore(gjson.Parse(`{
+		"server": {"name": "weather-server"},
+		"tools": [
+			{"name": "get_weather", "requestTemplate": {"url": "http://weather.example.com/now", "method": "GET"}},
+			{"name": "purge_cache", "scopes": ["admin"], "requestTemplate": {"url": "http://weather.example.com/cache", "method": "DELETE"}}
+		]
+	}`), &McpServerConfig{}, &ConfigOptions{ToolRegistry: registry}))
+
+	listed := func(consumer *wrapper.Consumer) []string {
+		ctx := &consumerContextStub{phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}, consumer}
+		require.NoError(t, toolSet.methodHandlers["tools/list"](ctx, utils.JsonRpcID{IntValue: 1}, gjson.Parse(`{}`)))
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		var names []string
+		for _, tool := range gjson.GetBytes(response, "result.tools.#.name").Array() {
+			names = append(names, tool.String())
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []string{"weather-server___get_weather", "weather-server___purge_cache"}, listed(&wrapper.Consumer{Name: "alice"}))
+	assert.ElementsMatch(t, []string{"weather-server___get_weather"}, listed(nil))
+
+	err := parseConfigCore(gjson.Parse(`{"toolSet": {"name": "ops", "authorization": {"consumers": []}}}`), &McpServerConfig{}, &ConfigOptions{ToolRegistry: registry})
+	var cfgErr *configerr.Error
+	if assert.ErrorAs(t, err, &cfgErr) {
+		assert.Equal(t, "/toolSet/authorization/consumers", cfgErr.Pointer)
+	}
+}
+
+// TestFilterAuthorizedTools tests that proxied tools/list results hide the tools the caller is not granted the scopes of
+func TestFilterAuthorizedTools(t *testing.T) {
+	result := gjson.Parse(`{"tools": [{"name": "get_weather"}, {"name": "delete_file"}]}`)
+	permissions := &toolPermissions{scopes: map[string]struct{}{"read": {}}, toolScopes: map[string][]string{"delete_file": {"write"}}}
+	assert.JSONEq(t, `{"tools": [{"name": "get_weather"}]}`, string(filterAllowedTools(result, nil, permissions)))
+	allowTools := map[string]struct{}{"delete_file": {}}
+	assert.JSONEq(t, `{"tools": []}`, string(filterAllowedTools(result, &allowTools, permissions)))
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	LoadBalanceRoundRobin   = "round_robin"   // Backends take turns
+	LoadBalanceLeastFailure = "least_failure" // The backend with the fewest consecutive failures is preferred
+
+	defaultUnhealthyThreshold = 3
+	defaultUnhealthyDuration  = 30 * 1000 // 30 seconds
+)
+
+// LoadBalancingConfig configures how an mcp-proxy server picks one of its backends, e.g.
+//
+//	{"policy": "least_failure", "unhealthyThreshold": 3, "unhealthyDuration": 30000}
+//
+// A backend failing unhealthyThreshold requests in a row, i.e. with a 5xx status or no response, is
+// skipped for unhealthyDuration milliseconds. The health of the backends is tracked by every worker VM.
+type LoadBalancingConfig struct {
+	Policy             string `json:"policy"`             // round_robin (default) or least_failure
+	UnhealthyThreshold int    `json:"unhealthyThreshold"` // Consecutive failures marking a backend unhealthy, defaults to 3
+	UnhealthyDuration  int    `json:"unhealthyDuration"`  // Milliseconds an unhealthy backend is skipped, defaults to 30 seconds
+}
+
+// McpBackend is one of the identical backend MCP servers of a BackendPool
+type McpBackend struct {
+	URL     string
+	Cluster string // Cluster the backend is called through, resolved from the URL when not configured
+	host    string
+
+	failures       int       // Consecutive failed requests
+	unhealthyUntil time.Time // The backend is skipped until then
+}
+
+// BackendPool balances the requests of an mcp-proxy server over its backends. A request talks to a
+// single backend from initialize to its result.
+type BackendPool struct {
+	backends  []*McpBackend
+	policy    string
+	threshold int
+	duration  time.Duration
+	next      int
+	now       func() time.Time
+}
+
+// parseBackendPool parses the list form of mcpServerURL, whose entries are URLs or objects with a url
+// and an optional cluster, e.g.
+//
+//	["http://mcp-a.default.svc.cluster.local/mcp", {"url": "http://mcp-b/mcp", "cluster": "outbound|80||mcp-b.dns"}]
+//
+// A backend without a cluster is called through the outbound cluster of the FQDN and port of its URL,
+// every backend of a pool is thus reached through a cluster of its own rather than through the route.
+func parseBackendPool(backendsJson gjson.Result, loadBalancingJson gjson.Result) (*BackendPool, error) {
+	var config LoadBalancingConfig
+	if loadBalancingJson.Exists() {
+		if err := configerr.DecodeJSON("/loadBalancing", []byte(loadBalancingJson.Raw), &config); err != nil {
+			return nil, err
+		}
+	}
+	switch config.Policy {
+	case "":
+		config.Policy = LoadBalanceRoundRobin
+	case LoadBalanceRoundRobin, LoadBalanceLeastFailure:
+	default:
+		return nil, configerr.Errorf("/loadBalancing/policy", `"round_robin" or "least_failure"`, "unknown load balancing policy: %s", config.Policy)
+	}
+	if config.UnhealthyThreshold < 0 {
+		return nil, configerr.Errorf("/loadBalancing/unhealthyThreshold", "non-negative integer", "got %d", config.UnhealthyThreshold)
+	}
+	if config.UnhealthyThreshold == 0 {
+		config.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	if config.UnhealthyDuration < 0 {
+		return nil, configerr.Errorf("/loadBalancing/unhealthyDuration", "non-negative integer", "got %d", config.UnhealthyDuration)
+	}
+	if config.UnhealthyDuration == 0 {
+		config.UnhealthyDuration = defaultUnhealthyDuration
+	}
+
+	pool := &BackendPool{
+		policy:    config.Policy,
+		threshold: config.UnhealthyThreshold,
+		duration:  time.Duration(config.UnhealthyDuration) * time.Millisecond,
+		now:       time.Now,
+	}
+	entries := backendsJson.Array()
+	if len(entries) == 0 {
+		return nil, configerr.New("/mcpServerURL", "non-empty array", errors.New("mcpServerURL must list at least one backend"))
+	}
+	for i, entry := range entries {
+		backend := &McpBackend{URL: entry.String()}
+		pointer := configerr.Pointer("mcpServerURL", i)
+		if entry.IsObject() {
+			backend.URL = entry.Get("url").String()
+			backend.Cluster = entry.Get("cluster").String()
+			pointer = configerr.Pointer("mcpServerURL", i, "url")
+		} else if entry.Type != gjson.String {
+			return nil, configerr.Errorf(pointer, "URL string or object", "got %s", entry.Raw)
+		}
+		if backend.URL == "" {
+			return nil, configerr.Errorf(pointer, "string", "backend url is required")
+		}
+		if err := validateURL(backend.URL); err != nil {
+			return nil, configerr.Errorf(pointer, "http or https URL", "invalid backend url: %v", err)
+		}
+		parsed, err := url.Parse(backend.URL)
+		if err != nil {
+			return nil, configerr.Errorf(pointer, "http or https URL", "invalid backend url: %v", err)
+		}
+		backend.host = parsed.Host
+		if backend.Cluster == "" {
+			backend.Cluster = urlCluster(parsed).ClusterName()
+		}
+		pool.backends = append(pool.backends, backend)
+	}
+	return pool, nil
+}
+
+// urlCluster returns the outbound cluster of the FQDN and port of a backend URL
+func urlCluster(u *url.URL) wrapper.FQDNCluster {
+	port, _ := strconv.ParseInt(u.Port(), 10, 64)
+	if port == 0 {
+		port = 80
+		if u.Scheme == "https" {
+			port = 443
+		}
+	}
+	return wrapper.FQDNCluster{FQDN: u.Hostname(), Host: u.Host, Port: port}
+}
+
+// Backends returns the backends of the pool
+func (p *BackendPool) Backends() []*McpBackend {
+	return p.backends
+}
+
+// Select picks the backend of a request among the healthy ones, or the one that recovers first when
+// none is healthy
+func (p *BackendPool) Select() *McpBackend {
+	now := p.now()
+	selected := -1
+	for i := range p.backends {
+		index := (p.next + i) % len(p.backends)
+		backend := p.backends[index]
+		if now.Before(backend.unhealthyUntil) {
+			continue
+		}
+		if selected < 0 || (p.policy == LoadBalanceLeastFailure && backend.failures < p.backends[selected].failures) {
+			selected = index
+		}
+		if p.policy == LoadBalanceRoundRobin || p.backends[selected].failures == 0 {
+			break
+		}
+	}
+	if selected < 0 {
+		for index, backend := range p.backends {
+			if selected < 0 || backend.unhealthyUntil.Before(p.backends[selected].unhealthyUntil) {
+				selected = index
+			}
+		}
+		log.Warnf("All MCP backends are unhealthy, using %s", p.backends[selected].URL)
+	}
+	// The turn of the skipped backends is passed
+	p.next = (selected + 1) % len(p.backends)
+	return p.backends[selected]
+}
+
+// Report records the outcome of a request to a backend, statusCode is 0 when no response was received
+func (p *BackendPool) Report(backend *McpBackend, statusCode int) {
+	if statusCode > 0 && statusCode < http.StatusInternalServerError {
+		backend.failures = 0
+		return
+	}
+	backend.failures++
+	if backend.failures >= p.threshold && !p.now().Before(backend.unhealthyUntil) {
+		backend.unhealthyUntil = p.now().Add(p.duration)
+		log.Warnf("MCP backend %s failed %d requests in a row, marked unhealthy for %s", backend.URL, backend.failures, p.duration)
+	}
+}
+
+// client returns a client calling the backend through its cluster
+func (b *McpBackend) client() wrapper.HttpClient {
+	return wrapper.NewClusterClient(wrapper.TargetCluster{Cluster: b.Cluster, Host: b.host})
+}
+
+// backendClient returns the client calling the backend of the request
+func (h *McpProtocolHandler) backendClient() wrapper.HttpClient {
+	if h.backend == nil {
+		return wrapper.NewClusterClient(wrapper.RouteCluster{})
+	}
+	return h.backend.client()
+}
+
+// sessionCluster returns the cluster and authority the session of the request is reached through
+// outside of the request, e.g. by keep-alive pings
+func (h *McpProtocolHandler) sessionCluster() wrapper.TargetCluster {
+	if h.backend == nil {
+		return wrapper.TargetCluster{Cluster: wrapper.RouteCluster{}.ClusterName(), Host: wrapper.GetRequestHost()}
+	}
+	return wrapper.TargetCluster{Cluster: h.backend.Cluster, Host: h.backend.host}
+}
+
+// reportBackend reports the outcome of a request to the backend of the request to its pool
+func (h *McpProtocolHandler) reportBackend(statusCode int) {
+	if h.pool != nil && h.backend != nil {
+		h.pool.Report(h.backend, statusCode)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// TestParseBackendPool tests the list form of mcpServerURL and the loadBalancing option
+func TestParseBackendPool(t *testing.T) {
+	server, err := setupMcpProxyServer("pool-test", gjson.Parse(`{
+		"transport": "http",
+		"mcpServerURL": ["http://mcp-a/mcp", {"url": "http://mcp-b/mcp", "cluster": "outbound|80||mcp-b.dns"}, "https://mcp-c.default.svc.cluster.local/mcp", "http://mcp-d:8080/mcp"],
+		"loadBalancing": {"policy": "least_failure", "unhealthyDuration": 1000}
+	}`), "")
+	require.NoError(t, err)
+	pool := server.GetBackendPool()
+	require.NotNil(t, pool)
+	assert.Equal(t, "http://mcp-a/mcp", server.GetMcpServerURL())
+	require.Len(t, pool.Backends(), 4)
+	// Backends without a cluster are called through the cluster of their URL, not through the route
+	assert.Equal(t, "outbound|80||mcp-a", pool.Backends()[0].Cluster)
+	assert.Equal(t, "outbound|443||mcp-c.default.svc.cluster.local", pool.Backends()[2].Cluster)
+	assert.Equal(t, "outbound|8080||mcp-d", pool.Backends()[3].Cluster)
+	assert.Equal(t, "mcp-d:8080", pool.Backends()[3].host)
+	assert.Equal(t, "outbound|80||mcp-b.dns", pool.Backends()[1].Cluster)
+	assert.Equal(t, "mcp-b", pool.Backends()[1].host)
+	assert.Equal(t, LoadBalanceLeastFailure, pool.policy)
+	assert.Equal(t, defaultUnhealthyThreshold, pool.threshold)
+	assert.Equal(t, time.Second, pool.duration)
+	assert.Same(t, pool, server.Clone().(*McpProxyServer).GetBackendPool())
+
+	server, err = setupMcpProxyServer("pool-test", gjson.Parse(`{"transport": "http", "mcpServerURL": "http://mcp-a/mcp"}`), "")
+	require.NoError(t, err)
+	assert.Nil(t, server.GetBackendPool())
+
+	for config, message := range map[string]string{
+		`{"transport": "sse", "mcpServerURL": ["http://mcp-a/sse"]}`:                                         `invalid config at "/mcpServerURL"`,
+		`{"transport": "http", "mcpServerURL": []}`:                                                          `invalid config at "/mcpServerURL"`,
+		`{"transport": "http", "mcpServerURL": ["http://mcp-a/mcp", "ftp://mcp-b/mcp"]}`:                     `invalid config at "/mcpServerURL/1"`,
+		`{"transport": "http", "mcpServerURL": [{"cluster": "outbound|80||mcp-b.dns"}]}`:                     `invalid config at "/mcpServerURL/0/url"`,
+		`{"transport": "http", "mcpServerURL": [1]}`:                                                         `invalid config at "/mcpServerURL/0"`,
+		`{"transport": "http", "mcpServerURL": ["http://mcp-a/mcp"], "loadBalancing": {"policy": "random"}}`: `invalid config at "/loadBalancing/policy"`,
+		`{"transport": "http", "mcpServerURL": "http://mcp-a/mcp", "loadBalancing": {}}`:                     `invalid config at "/loadBalancing"`,
+	} {
+		_, err := setupMcpProxyServer("pool-test", gjson.Parse(config), "")
+		assert.ErrorContains(t, err, message, config)
+	}
+}
+
+// TestBackendPoolSelect tests round robin and least failure selection with unhealthy backends skipped
+func TestBackendPoolSelect(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	newPool := func(policy string) *BackendPool {
+		pool, err := parseBackendPool(gjson.Parse(`["http://a/mcp", "http://b/mcp", "http://c/mcp"]`),
+			gjson.Parse(`{"policy": "`+policy+`", "unhealthyThreshold": 2, "unhealthyDuration": 10000}`))
+		require.NoError(t, err)
+		pool.now = func() time.Time { return now }
+		return pool
+	}
+	selectURLs := func(pool *BackendPool, n int) []string {
+		var urls []string
+		for i := 0; i < n; i++ {
+			urls = append(urls, pool.Select().URL)
+		}
+		return urls
+	}
+
+	pool := newPool(LoadBalanceRoundRobin)
+	a, b, c := pool.backends[0], pool.backends[1], pool.backends[2]
+	assert.Equal(t, []string{"http://a/mcp", "http://b/mcp", "http://c/mcp", "http://a/mcp"}, selectURLs(pool, 4))
+
+	pool.Report(b, 503)
+	assert.Equal(t, 1, b.failures)
+	pool.Report(b, 0)
+	assert.True(t, now.Before(b.unhealthyUntil), "b failed twice in a row")
+	assert.Equal(t, []string{"http://c/mcp", "http://a/mcp", "http://c/mcp"}, selectURLs(pool, 3))
+
+	pool.Report(a, 404)
+	pool.Report(c, 200)
+	assert.Zero(t, a.failures, "client errors do not count as failures")
+
+	// b is selected again once its unhealthy duration is over, and ejected again on the next failure
+	now = now.Add(10 * time.Second)
+	assert.Contains(t, selectURLs(pool, 3), "http://b/mcp")
+	pool.Report(b, 500)
+	assert.True(t, now.Before(b.unhealthyUntil))
+	pool.Report(b, 200)
+	assert.Zero(t, b.failures)
+
+	// The backend recovering first is used when all are unhealthy
+	for _, backend := range []*McpBackend{a, b, c} {
+		backend.unhealthyUntil = now.Add(time.Minute)
+	}
+	c.unhealthyUntil = now.Add(time.Second)
+	assert.Equal(t, "http://c/mcp", pool.Select().URL)
+
+	pool = newPool(LoadBalanceLeastFailure)
+	a, b, c = pool.backends[0], pool.backends[1], pool.backends[2]
+	pool.Report(a, 502)
+	assert.Equal(t, []string{"http://b/mcp", "http://c/mcp", "http://b/mcp"}, selectURLs(pool, 3))
+	pool.Report(b, 502)
+	pool.Report(c, 502)
+	pool.Report(c, 502)
+	assert.Equal(t, []string{"http://a/mcp", "http://b/mcp", "http://a/mcp"}, selectURLs(pool, 3))
+}
+
+// TestBackendPoolHandler tests that every protocol handler talks to the backend selected for it
+func TestBackendPoolHandler(t *testing.T) {
+	server, err := setupMcpProxyServer("pool-test", gjson.Parse(`{
+		"transport": "http",
+		"mcpServerURL": ["http://mcp-a/mcp", {"url": "http://mcp-b/mcp", "cluster": "outbound|80||mcp-b.dns"}]
+	}`), "")
+	require.NoError(t, err)
+
+	first := server.newProtocolHandler()
+	assert.Equal(t, "http://mcp-a/mcp", first.backendURL)
+	assert.Equal(t, "outbound|80||mcp-a", first.backendClient().ClusterName())
+	second := server.newProtocolHandler()
+	assert.Equal(t, "http://mcp-b/mcp", second.backendURL)
+	assert.Equal(t, "outbound|80||mcp-b.dns", second.sessionCluster().Cluster)
+	assert.Equal(t, "mcp-b", second.sessionCluster().Host)
+	assert.Equal(t, "outbound|80||mcp-b.dns", second.backendClient().ClusterName())
+
+	second.reportBackend(503)
+	assert.Equal(t, 1, second.backend.failures)
+}
@@ -14,8 +14,10 @@
 package server
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"slices"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
 
@@ -24,14 +26,20 @@ import (
 
 // BaseMCPServer provides common functionality for MCP servers
 type BaseMCPServer struct {
-	tools  map[string]Tool
-	config []byte
+	tools             map[string]Tool
+	resources         map[string]Resource
+	resourceTemplates []ResourceTemplate
+	uriTemplates      []*uriTemplate // Parsed URI templates of resourceTemplates, in the same order
+	prompts           map[string]Prompt
+	config            []byte
 }
 
 // NewBaseMCPServer creates a new BaseMCPServer
 func NewBaseMCPServer() BaseMCPServer {
 	return BaseMCPServer{
-		tools: make(map[string]Tool),
+		tools:     make(map[string]Tool),
+		resources: make(map[string]Resource),
+		prompts:   make(map[string]Prompt),
 	}
 }
 
@@ -50,6 +58,73 @@ func (s *BaseMCPServer) GetMCPTools() map[string]Tool {
 	return s.tools
 }
 
+// AddMCPResource adds a resource to the server
+func (s *BaseMCPServer) AddMCPResource(resource Resource) Server {
+	uri := resource.Info().URI
+	if _, exist := s.resources[uri]; exist {
+		log.Errorf("Conflict! There is a resource with the same uri:%s", uri)
+		return s
+	}
+	if s.resources == nil {
+		s.resources = make(map[string]Resource)
+	}
+	s.resources[uri] = resource
+	return s
+}
+
+// GetMCPResources returns all resources registered with the server
+func (s *BaseMCPServer) GetMCPResources() map[string]Resource {
+	return s.resources
+}
+
+// AddMCPResourceTemplate adds a resource template to the server
+// Templates are matched in the order they are added
+func (s *BaseMCPServer) AddMCPResourceTemplate(template ResourceTemplate) Server {
+	parsed, err := parseURITemplate(template.Info().URITemplate)
+	if err != nil {
+		log.Errorf("Invalid resource template %s: %v", template.Info().Name, err)
+		return s
+	}
+	s.resourceTemplates = append(s.resourceTemplates, template)
+	s.uriTemplates = append(s.uriTemplates, parsed)
+	return s
+}
+
+// matchResourceTemplate returns the first resource template matching the URI and the values of its
+// variables, using the URI templates parsed when the templates were added
+func (s *BaseMCPServer) matchResourceTemplate(uri string) (ResourceTemplate, map[string]string, bool) {
+	for i, parsed := range s.uriTemplates {
+		if params, ok := parsed.match(uri); ok {
+			return s.resourceTemplates[i], params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// GetMCPResourceTemplates returns all resource templates registered with the server
+func (s *BaseMCPServer) GetMCPResourceTemplates() []ResourceTemplate {
+	return s.resourceTemplates
+}
+
+// AddMCPPrompt adds a prompt to the server
+func (s *BaseMCPServer) AddMCPPrompt(prompt Prompt) Server {
+	name := prompt.Info().Name
+	if _, exist := s.prompts[name]; exist {
+		log.Errorf("Conflict! There is a prompt with the same name:%s", name)
+		return s
+	}
+	if s.prompts == nil {
+		s.prompts = make(map[string]Prompt)
+	}
+	s.prompts[name] = prompt
+	return s
+}
+
+// GetMCPPrompts returns all prompts registered with the server
+func (s *BaseMCPServer) GetMCPPrompts() map[string]Prompt {
+	return s.prompts
+}
+
 // SetConfig sets the server configuration
 func (s *BaseMCPServer) SetConfig(config []byte) {
 	s.config = config
@@ -82,7 +157,7 @@ func (s *BaseMCPServer) GetConfig(v any) {
 }
 
 // Clone creates a copy of the server
-// This method should be overridden by derived types
+// This method should be overridden by derived types, see Server.Clone for its contract
 func (s *BaseMCPServer) Clone() Server {
 	panic("Clone method must be implemented by derived types")
 }
@@ -90,11 +165,21 @@ func (s *BaseMCPServer) Clone() Server {
 // CloneBase creates a copy of the base server
 func (s *BaseMCPServer) CloneBase() BaseMCPServer {
 	newServer := BaseMCPServer{
-		tools:  make(map[string]Tool),
-		config: s.config,
+		tools:             make(map[string]Tool),
+		resources:         make(map[string]Resource),
+		resourceTemplates: slices.Clone(s.resourceTemplates),
+		uriTemplates:      slices.Clone(s.uriTemplates),
+		prompts:           make(map[string]Prompt),
+		config:            bytes.Clone(s.config),
 	}
 	for k, v := range s.tools {
 		newServer.tools[k] = v
 	}
+	for k, v := range s.resources {
+		newServer.resources[k] = v
+	}
+	for k, v := range s.prompts {
+		newServer.prompts[k] = v
+	}
 	return newServer
 }
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+)
+
+// The helpers below implement the deep copies required by the contract of Server.Clone for the config types
+// shared by the servers of this package.
+
+// cloneJSON returns a deep copy of a value decoded from JSON, maps and slices are copied recursively
+func cloneJSON(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		return cloneJSONObject(value)
+	case []any:
+		if value == nil {
+			return value
+		}
+		cloned := make([]any, len(value))
+		for i, item := range value {
+			cloned[i] = cloneJSON(item)
+		}
+		return cloned
+	case json.RawMessage:
+		return json.RawMessage(bytes.Clone(value))
+	default:
+		return v
+	}
+}
+
+func cloneJSONObject(object map[string]any) map[string]any {
+	if object == nil {
+		return nil
+	}
+	cloned := make(map[string]any, len(object))
+	for key, value := range object {
+		cloned[key] = cloneJSON(value)
+	}
+	return cloned
+}
+
+func cloneJSONArray(array []interface{}) []interface{} {
+	cloned, _ := cloneJSON(array).([]interface{})
+	return cloned
+}
+
+func cloneFloat(f *float64) *float64 {
+	if f == nil {
+		return nil
+	}
+	cloned := *f
+	return &cloned
+}
+
+// cloneSecuritySchemes returns a copy of the security schemes of a server, it is never nil
+func cloneSecuritySchemes(schemes map[string]SecurityScheme) map[string]SecurityScheme {
+	cloned := make(map[string]SecurityScheme, len(schemes))
+	for id, scheme := range schemes {
+		scheme.Scopes = slices.Clone(scheme.Scopes)
+		cloned[id] = scheme
+	}
+	return cloned
+}
+
+// clone returns a deep copy of the tool config, the parsed templates and field projection are shared as they
+// are never modified once parsed
+func (t RestTool) clone() RestTool {
+	t.Scopes = slices.Clone(t.Scopes)
+	t.Args = slices.Clone(t.Args)
+	for i := range t.Args {
+		arg := &t.Args[i]
+		arg.Default = cloneJSON(arg.Default)
+		arg.Enum = cloneJSONArray(arg.Enum)
+		arg.Minimum = cloneFloat(arg.Minimum)
+		arg.Maximum = cloneFloat(arg.Maximum)
+		arg.Items = cloneJSON(arg.Items)
+		arg.Properties = cloneJSON(arg.Properties)
+	}
+	t.OutputSchema = cloneJSONObject(t.OutputSchema)
+	t.RequestTemplate.Headers = slices.Clone(t.RequestTemplate.Headers)
+	t.ResponseTemplate.Mappings = slices.Clone(t.ResponseTemplate.Mappings)
+	for i := range t.ResponseTemplate.Mappings {
+		t.ResponseTemplate.Mappings[i].Value = cloneJSON(t.ResponseTemplate.Mappings[i].Value)
+	}
+	t.ResponseTemplate.Fields = slices.Clone(t.ResponseTemplate.Fields)
+	t.MockResponse = bytes.Clone(t.MockResponse)
+	t.parsedHeaderTemplates = maps.Clone(t.parsedHeaderTemplates)
+	t.argPositions = maps.Clone(t.argPositions)
+	return t
+}
+
+// clone returns a deep copy of the tool config, the parsed templates of injected arguments are shared
+func (c McpProxyToolConfig) clone() McpProxyToolConfig {
+	c.Scopes = slices.Clone(c.Scopes)
+	c.Args = slices.Clone(c.Args)
+	for i := range c.Args {
+		c.Args[i].Default = cloneJSON(c.Args[i].Default)
+		c.Args[i].Enum = cloneJSONArray(c.Args[i].Enum)
+	}
+	c.OutputSchema = cloneJSONObject(c.OutputSchema)
+	if c.DescriptionOverride != nil {
+		override := *c.DescriptionOverride
+		override.Args = maps.Clone(override.Args)
+		c.DescriptionOverride = &override
+	}
+	c.InjectArgs = slices.Clone(c.InjectArgs)
+	for i := range c.InjectArgs {
+		c.InjectArgs[i].Value = cloneJSON(c.InjectArgs[i].Value)
+	}
+	return c
+}
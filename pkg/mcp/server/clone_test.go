@@ -0,0 +1,227 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	template "github.com/higress-group/gjson_template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+// cloneSharedTypes are the types of the values the copies made by Server.Clone may share, because they are
+// never modified once parsed or are runtime state the copies are meant to share
+var cloneSharedTypes = map[reflect.Type]bool{
+	reflect.TypeOf(&RestMCPTool{}):                  true,
+	reflect.TypeOf(&McpProxyTool{}):                 true,
+	reflect.TypeOf(&template.Template{}):            true,
+	reflect.TypeOf(fieldProjection{}):               true,
+	reflect.TypeOf(&ArgSealer{}):                    true,
+	reflect.TypeOf(&McpSessionManagerImpl{}):        true,
+	reflect.TypeOf(&ToolsListCache{}):               true,
+	reflect.TypeOf(&BackendPool{}):                  true,
+	reflect.TypeOf(&GlobalToolRegistry{}):           true,
+	reflect.TypeOf(map[string]*oauth2TokenSource{}): true,
+	reflect.TypeOf(&cloneConformanceTool{}):         true,
+	reflect.TypeOf(&StaticResource{}):               true,
+	reflect.TypeOf(&RestResource{}):                 true,
+	reflect.TypeOf(&RestResourceTemplate{}):         true,
+	reflect.TypeOf(&uriTemplate{}):                  true,
+	reflect.TypeOf(&TemplatePrompt{}):               true,
+}
+
+// cloneConformanceTool is a Go-based tool
+type cloneConformanceTool struct {
+	Query string `json:"query"`
+}
+
+func (t *cloneConformanceTool) Create(params []byte) Tool { return &cloneConformanceTool{} }
+
+func (t *cloneConformanceTool) Call(httpCtx HttpContext, server Server) error { return nil }
+
+func (t *cloneConformanceTool) Description() string { return "conformance tool" }
+
+func (t *cloneConformanceTool) InputSchema() map[string]any { return ToInputSchema(t) }
+
+// cloneConformanceServer is a Go-based server built on BaseMCPServer, as registered with AddMCPServer
+type cloneConformanceServer struct {
+	BaseMCPServer
+	Limits map[string]int
+}
+
+func (s *cloneConformanceServer) Clone() Server {
+	limits := make(map[string]int, len(s.Limits))
+	for k, v := range s.Limits {
+		limits[k] = v
+	}
+	return &cloneConformanceServer{BaseMCPServer: s.CloneBase(), Limits: limits}
+}
+
+// assertIndependent fails when the two values share a map, a slice or a pointer of a type that is not in
+// cloneSharedTypes, i.e. when changing one of them could change the other
+func assertIndependent(t *testing.T, path string, a, b reflect.Value, visited map[uintptr]bool) {
+	t.Helper()
+	if !a.IsValid() || !b.IsValid() || a.Kind() != b.Kind() || cloneSharedTypes[a.Type()] {
+		return
+	}
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			return
+		}
+		if a.Pointer() == b.Pointer() {
+			t.Errorf("%s: the copies share a %s", path, a.Type())
+			return
+		}
+		if visited[a.Pointer()] {
+			return
+		}
+		visited[a.Pointer()] = true
+		assertIndependent(t, path, a.Elem(), b.Elem(), visited)
+	case reflect.Interface:
+		assertIndependent(t, path, a.Elem(), b.Elem(), visited)
+	case reflect.Map:
+		if a.Len() > 0 && a.Pointer() == b.Pointer() {
+			t.Errorf("%s: the copies share a %s", path, a.Type())
+			return
+		}
+		for _, key := range a.MapKeys() {
+			assertIndependent(t, fmt.Sprintf("%s[%v]", path, key), a.MapIndex(key), b.MapIndex(key), visited)
+		}
+	case reflect.Slice:
+		if a.Len() > 0 && b.Len() > 0 && a.Pointer() == b.Pointer() {
+			t.Errorf("%s: the copies share a %s", path, a.Type())
+			return
+		}
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			assertIndependent(t, fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i), visited)
+		}
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			assertIndependent(t, path+"."+a.Type().Field(i).Name, a.Field(i), b.Field(i), visited)
+		}
+	}
+}
+
+// TestServerCloneConformance tests the contract of Server.Clone for every server implementation: the copy has
+// the configuration of the original, and configuring one of them does not change the other
+func TestServerCloneConformance(t *testing.T) {
+	defer startTestHttpContext("clone-conformance-test")()
+
+	parse := func(configJson string) Server {
+		config := &McpServerConfig{}
+		require.NoError(t, parseConfigCore(gjson.Parse(configJson), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+		return config.server
+	}
+	goServer := &cloneConformanceServer{BaseMCPServer: NewBaseMCPServer(), Limits: map[string]int{"search": 10}}
+	goServer.AddMCPTool("search", &cloneConformanceTool{})
+	goServer.SetConfig([]byte(`{"apiKey": "key"}`))
+
+	servers := map[string]Server{
+		"rest": parse(`{
+			"server": {
+				"name": "shop",
+				"config": {"apiKey": "key"},
+				"securitySchemes": [{"id": "idp", "type": "oauth2", "tokenUrl": "https://idp/token", "clientId": "c", "clientSecret": "s", "scopes": ["read"]},
+					{"id": "client", "type": "http", "scheme": "bearer"}],
+				"defaultDownstreamSecurity": {"id": "client", "passthrough": true},
+				"defaultUpstreamSecurity": {"id": "idp"},
+				"passthroughAuthHeader": true,
+				"errorCodeMapping": {"404": -32002},
+				"validateArguments": true
+			},
+			"tools": [{
+				"name": "search",
+				"scopes": ["shop:read"],
+				"args": [
+					{"name": "query", "description": "Keywords", "required": true, "enum": ["a", {"b": [1]}], "default": "a"},
+					{"name": "limit", "description": "Page size", "type": "integer", "minimum": 1, "maximum": 50},
+					{"name": "filters", "description": "Filters", "type": "array", "items": {"type": "object", "properties": {"op": {"type": "string"}}}}
+				],
+				"outputSchema": {"type": "object", "properties": {"items": {"type": "array"}}},
+				"requestTemplate": {"url": "http://shop/search", "method": "GET", "headers": [{"key": "x-shop", "value": "{{.config.apiKey}}"}]},
+				"responseTemplate": {"contentType": "json", "mappings": [{"path": "items", "from": "data", "value": [1]}], "fields": ["data"]},
+				"mockResponse": {"data": []}
+			}],
+			"resources": [{"uri": "shop://catalog", "name": "catalog", "text": "catalog"}],
+			"resourceTemplates": [{"uriTemplate": "shop://items/{id}", "name": "item", "text": "{{.params.id}}"}],
+			"prompts": [{"name": "greet", "messages": [{"role": "user", "text": "hello"}]}]
+		}`),
+		"mcp-proxy": parse(`{
+			"server": {
+				"name": "weather",
+				"type": "mcp-proxy",
+				"transport": "http",
+				"mcpServerURL": "http://weather/mcp",
+				"timeout": 3000,
+				"passthroughAuthHeader": true,
+				"securitySchemes": [{"id": "backend", "type": "apiKey", "in": "header", "name": "x-api-key", "defaultCredential": "key"}],
+				"defaultUpstreamSecurity": {"id": "backend"},
+				"errorCodeMapping": {"5xx": -32603},
+				"validateArguments": true
+			},
+			"tools": [{
+				"name": "forecast",
+				"exposeAs": "weather_forecast",
+				"descriptionOverride": {"description": "Forecast", "args": {"city": "City"}},
+				"scopes": ["weather:read"],
+				"args": [{"name": "city", "type": "string", "required": true, "enum": ["a", "b"], "default": "a"}],
+				"outputSchema": {"type": "object"},
+				"injectArgs": [{"name": "tenant", "value": {"id": [1]}}, {"name": "region", "template": "{{.config.region}}"}]
+			}]
+		}`),
+		"mcp-aggregate": parse(`{
+			"server": {
+				"name": "all-tools",
+				"type": "mcp-aggregate",
+				"defaultDownstreamSecurity": {"id": "client"},
+				"securitySchemes": [{"id": "client", "type": "http", "scheme": "bearer"}],
+				"backends": [
+					{"name": "weather", "mcpServerURL": "http://weather/mcp", "timeout": 1000},
+					{"name": "maps", "toolPrefix": "maps_", "mcpServerURL": ["http://maps-a/mcp", "http://maps-b/mcp"]}
+				]
+			}
+		}`),
+		"composed": NewComposedMCPServer("toolset", []ServerToolConfig{{ServerName: "shop", Tools: []string{"search"}}}, newTestToolRegistry()),
+		"go":       goServer,
+	}
+	servers["composed"].SetConfig([]byte(`{"apiKey": "key"}`))
+
+	for name, original := range servers {
+		t.Run(name, func(t *testing.T) {
+			require.NotNil(t, original)
+			var originalConfig map[string]any
+			original.GetConfig(&originalConfig)
+
+			clone := original.Clone()
+			require.IsType(t, original, clone)
+			assert.NotSame(t, original, clone)
+			assert.True(t, reflect.DeepEqual(original, clone), "the copy must have every setting of the original")
+			assertIndependent(t, name, reflect.ValueOf(original), reflect.ValueOf(clone), map[uintptr]bool{})
+
+			clone.SetConfig([]byte(`{"apiKey": "other"}`))
+			var config map[string]any
+			original.GetConfig(&config)
+			assert.Equal(t, originalConfig, config)
+			tools := len(original.GetMCPTools())
+			clone.AddMCPTool("added", &cloneConformanceTool{})
+			assert.Len(t, original.GetMCPTools(), tools)
+		})
+	}
+}
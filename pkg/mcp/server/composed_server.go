@@ -1,7 +1,9 @@
 package server
 
 import (
+	"bytes"
 	"fmt"
+	"slices"
 
 	"github.com/higress-group/wasm-go/pkg/log"
 	"github.com/higress-group/wasm-go/pkg/mcp/consts"
@@ -54,6 +56,7 @@ func (cs *ComposedMCPServer) GetMCPTools() map[string]Tool {
 				description:  toolInfo.Description,
 				inputSchema:  toolInfo.InputSchema,
 				outputSchema: toolInfo.OutputSchema, // New field for MCP Protocol Version 2025-06-18
+				scopes:       toolInfo.Scopes,
 			}
 		}
 	}
@@ -81,8 +84,13 @@ func (cs *ComposedMCPServer) GetConfig(v any) {
 
 // Clone creates a new instance of the ComposedMCPServer with the same configuration.
 func (cs *ComposedMCPServer) Clone() Server {
-	cloned := NewComposedMCPServer(cs.name, cs.serverTools, cs.registry)
-	cloned.SetConfig(cs.config)
+	serverTools := slices.Clone(cs.serverTools)
+	for i := range serverTools {
+		serverTools[i].Tools = slices.Clone(serverTools[i].Tools)
+	}
+	// The registry is shared, it holds the tools of all servers
+	cloned := NewComposedMCPServer(cs.name, serverTools, cs.registry)
+	cloned.SetConfig(bytes.Clone(cs.config))
 	return cloned
 }
 
@@ -92,6 +100,7 @@ type DescriptiveTool struct {
 	description  string
 	inputSchema  map[string]any
 	outputSchema map[string]any // New field for MCP Protocol Version 2025-06-18
+	scopes       []string       // Scopes of the tool it describes
 }
 
 // Create for DescriptiveTool should not be called.
@@ -102,6 +111,7 @@ func (dt *DescriptiveTool) Create(params []byte) Tool {
 		description:  dt.description,
 		inputSchema:  dt.inputSchema,
 		outputSchema: dt.outputSchema,
+		scopes:       dt.scopes,
 	}
 }
 
@@ -125,3 +135,8 @@ func (dt *DescriptiveTool) InputSchema() map[string]any {
 func (dt *DescriptiveTool) OutputSchema() map[string]any {
 	return dt.outputSchema
 }
+
+// Scopes implements ToolWithScopes interface
+func (dt *DescriptiveTool) Scopes() []string {
+	return dt.scopes
+}
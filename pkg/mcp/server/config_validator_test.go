@@ -154,6 +154,40 @@ func TestMcpProxyConfigValidation(t *testing.T) {
 			shouldErr: true,
 			errMsg:    "mcpServerURL is required",
 		},
+		{
+			name: "mistyped tool arg field reports its JSON pointer",
+			config: `{
+				"server": {
+					"name": "typed-proxy",
+					"type": "mcp-proxy",
+					"transport": "http",
+					"mcpServerURL": "http://backend.example.com/mcp"
+				},
+				"tools": [
+					{
+						"name": "test-tool",
+						"description": "Test tool",
+						"args": [{"name": "input", "required": "yes"}]
+					}
+				]
+			}`,
+			shouldErr: true,
+			errMsg:    `invalid config at "/tools/0/args/0/required", expected boolean`,
+		},
+		{
+			name: "invalid backend session reports its JSON pointer",
+			config: `{
+				"server": {
+					"name": "session-proxy",
+					"type": "mcp-proxy",
+					"transport": "sse",
+					"mcpServerURL": "http://backend.example.com/sse",
+					"backendSession": {"persist": true}
+				}
+			}`,
+			shouldErr: true,
+			errMsg:    `invalid config at "/server/backendSession/persist"`,
+		},
 		{
 			name: "invalid server type should use default REST handling",
 			config: `{
@@ -236,6 +270,27 @@ func TestSecuritySchemeValidation(t *testing.T) {
 			},
 			shouldErr: false,
 		},
+		{
+			name: "valid OAuth2 scheme",
+			scheme: SecurityScheme{
+				ID:           "OAuth2",
+				Type:         "oauth2",
+				TokenURL:     "https://idp.example.com/oauth/token",
+				ClientID:     "gateway",
+				ClientSecret: "secret",
+			},
+			shouldErr: false,
+		},
+		{
+			name: "invalid scheme - missing client secret for oauth2",
+			scheme: SecurityScheme{
+				ID:       "OAuth2",
+				Type:     "oauth2",
+				TokenURL: "https://idp.example.com/oauth/token",
+				ClientID: "gateway",
+			},
+			shouldErr: true,
+		},
 		{
 			name: "invalid scheme - missing ID",
 			scheme: SecurityScheme{
@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// DryRunHeader makes a tools/call return the rendered backend request instead of sending it,
+// when the server's dryRun mode is DryRunHeader.
+const DryRunHeader = "x-mcp-dry-run"
+
+const redactedValue = "REDACTED"
+
+// DryRunMode controls whether REST tools are executed or only rendered
+type DryRunMode string
+
+const (
+	DryRunOff      DryRunMode = ""       // Always execute tools
+	DryRunByHeader DryRunMode = "header" // Render only when the request carries DryRunHeader: true
+	DryRunAlways   DryRunMode = "always" // Never execute tools
+)
+
+// ParseDryRunMode validates a dryRun config value
+func ParseDryRunMode(mode string) (DryRunMode, error) {
+	switch DryRunMode(mode) {
+	case DryRunOff, DryRunByHeader, DryRunAlways:
+		return DryRunMode(mode), nil
+	case "off":
+		return DryRunOff, nil
+	}
+	return DryRunOff, fmt.Errorf("unknown dryRun mode: %s", mode)
+}
+
+// isDryRun reports whether the current tools/call should be rendered only. The dry-run header is
+// always removed, so it never reaches the backend of tools that are executed.
+func isDryRun(mode DryRunMode) bool {
+	value, _ := proxywasm.GetHttpRequestHeader(DryRunHeader)
+	if value != "" {
+		proxywasm.RemoveHttpRequestHeader(DryRunHeader)
+	}
+	switch mode {
+	case DryRunAlways:
+		return true
+	case DryRunByHeader:
+		return strings.EqualFold(value, "true") || value == "1"
+	}
+	return false
+}
+
+// DryRunRequest is the backend request a tool would have sent
+type DryRunRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers [][2]string `json:"headers"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// credentialNames returns the lower-cased header names and the query parameters that carry credentials,
+// which are the well-known authentication headers plus those used by apiKey security schemes
+func credentialNames(schemes map[string]SecurityScheme) (headers map[string]bool, params map[string]bool) {
+	headers = map[string]bool{"authorization": true, "proxy-authorization": true, "cookie": true}
+	params = map[string]bool{}
+	for _, scheme := range schemes {
+		if scheme.Type != "apiKey" || scheme.Name == "" {
+			continue
+		}
+		if scheme.In == "query" {
+			params[scheme.Name] = true
+		} else {
+			headers[strings.ToLower(scheme.Name)] = true
+		}
+	}
+	return headers, params
+}
+
+// redactHeaders returns a copy of headers with the values of the sensitive (lower-cased) names hidden
+func redactHeaders(headers [][2]string, sensitive map[string]bool) [][2]string {
+	redacted := make([][2]string, len(headers))
+	for i, h := range headers {
+		redacted[i] = h
+		if sensitive[strings.ToLower(h[0])] {
+			redacted[i][1] = redactedValue
+		}
+	}
+	return redacted
+}
+
+// redact hides credentials in well-known headers and in the headers or query parameters used by the security schemes
+func (r *DryRunRequest) redact(schemes map[string]SecurityScheme) {
+	sensitiveHeaders, sensitiveParams := credentialNames(schemes)
+	r.Headers = redactHeaders(r.Headers, sensitiveHeaders)
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return
+	}
+	if u.User != nil {
+		u.User = url.User(redactedValue)
+	}
+	if len(sensitiveParams) > 0 && u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			if sensitiveParams[name] {
+				query.Set(name, redactedValue)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	r.URL = u.String()
+}
+
+// sendDryRunResult responds to the tools/call with the redacted request instead of executing it,
+// the values of sensitive arguments are hidden wherever they are
+func sendDryRunResult(ctx wrapper.HttpContext, toolName string, request DryRunRequest, schemes map[string]SecurityScheme, sensitive []string) {
+	request.redact(schemes)
+	request.redactValues(sensitive)
+	structured, err := json.Marshal(request)
+	if err != nil {
+		utils.OnMCPToolCallError(ctx, fmt.Errorf("failed to marshal dry-run request: %v", err))
+		return
+	}
+	log.Infof("dry-run of tool %s: %s %s", toolName, request.Method, request.URL)
+	// The rendered request is not an output of the tool
+	utils.SetResultFilter(ctx, nil)
+	utils.SendMCPToolTextResultWithStructuredContent(ctx, string(structured), structured, fmt.Sprintf("mcp:tools/call:%s:dry_run", toolName))
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	template "github.com/higress-group/gjson_template"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+// InjectConflictPolicy decides what happens when the client supplies an argument the gateway injects
+type InjectConflictPolicy string
+
+const (
+	InjectOverride InjectConflictPolicy = "override" // The injected value replaces the value of the client
+	InjectReject   InjectConflictPolicy = "reject"   // The call is rejected unless the client value equals the injected one
+	InjectKeep     InjectConflictPolicy = "keep"     // The value of the client is kept, the injected value is a default
+)
+
+// InjectedArg is an argument merged into the arguments of a proxied tools/call, e.g.
+//
+//	{"name": "tenantId", "fromHeader": "x-tenant-id", "onConflict": "reject"}
+//	{"name": "region", "value": "cn-hangzhou", "onConflict": "keep"}
+//
+// Exactly one of value, fromHeader and template sets the injected value. A template is rendered with the
+// config of the server and the arguments of the client, as the templates of REST tools are.
+type InjectedArg struct {
+	Name       string               `json:"name"`
+	Value      any                  `json:"value,omitempty"`      // Fixed JSON value
+	FromHeader string               `json:"fromHeader,omitempty"` // Request header the string value is read from
+	Template   string               `json:"template,omitempty"`   // Template rendering the string value
+	OnConflict InjectConflictPolicy `json:"onConflict,omitempty"` // Defaults to override
+
+	parsedTemplate *template.Template
+}
+
+// errArgumentConflict is returned when a client supplies an argument injected with the reject policy
+var errArgumentConflict = errors.New("argument conflicts with the injected value")
+
+// parseInjectedArgs validates the injected arguments of a tool and parses their templates, errors are located
+// relative to the config of the tool
+func parseInjectedArgs(args []InjectedArg) error {
+	names := make(map[string]bool, len(args))
+	for i := range args {
+		arg := &args[i]
+		pointer := configerr.Pointer("injectArgs", i)
+		if arg.Name == "" {
+			return configerr.New(pointer+"/name", "non-empty string", errors.New("injected argument name is required"))
+		}
+		if names[arg.Name] {
+			return configerr.Errorf(pointer+"/name", "unique name", "argument %s is injected more than once", arg.Name)
+		}
+		names[arg.Name] = true
+
+		sources := 0
+		for _, set := range []bool{arg.Value != nil, arg.FromHeader != "", arg.Template != ""} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return configerr.Errorf(pointer, "exactly one of value, fromHeader or template", "argument %s has %d value sources", arg.Name, sources)
+		}
+
+		switch arg.OnConflict {
+		case "":
+			arg.OnConflict = InjectOverride
+		case InjectOverride, InjectReject, InjectKeep:
+		default:
+			return configerr.Errorf(pointer+"/onConflict", `"override", "reject" or "keep"`, "unknown conflict policy: %s", arg.OnConflict)
+		}
+
+		if arg.Template != "" {
+			tmpl, err := template.New("inject_" + arg.Name).Funcs(templateFuncs()).Parse(arg.Template)
+			if err != nil {
+				return configerr.New(pointer+"/template", "", fmt.Errorf("error parsing template: %v", err))
+			}
+			arg.parsedTemplate = tmpl
+		}
+	}
+	return nil
+}
+
+// resolve returns the value injected for the current request, false when it has none because the request
+// header is absent
+func (a *InjectedArg) resolve(server *McpProxyServer, arguments map[string]interface{}) (any, bool, error) {
+	switch {
+	case a.FromHeader != "":
+		value, err := proxywasm.GetHttpRequestHeader(a.FromHeader)
+		if err != nil || value == "" {
+			return nil, false, nil
+		}
+		return value, true, nil
+	case a.parsedTemplate != nil:
+		var serverConfig map[string]interface{}
+		server.GetConfig(&serverConfig)
+		var templateDataBytes []byte
+		templateDataBytes, _ = sjson.SetBytes(templateDataBytes, "config", serverConfig)
+		templateDataBytes, _ = sjson.SetBytes(templateDataBytes, "args", arguments)
+		value, err := executeTemplate(a.parsedTemplate, templateDataBytes)
+		if err != nil {
+			return nil, false, fmt.Errorf("error executing template of argument %s: %v", a.Name, err)
+		}
+		return value, true, nil
+	default:
+		return a.Value, true, nil
+	}
+}
+
+// injectArguments merges the injected arguments of a tool into the arguments of the client. An argument owned
+// by the gateway, i.e. not injected with the keep policy, is removed when the request has no value for it so
+// that clients cannot supply it in place of the gateway. The arguments are read as the client sent them, so a
+// template does not see the values injected before it.
+func injectArguments(server *McpProxyServer, injected []InjectedArg, arguments map[string]interface{}) error {
+	clientArguments := make(map[string]interface{}, len(arguments))
+	for name, value := range arguments {
+		clientArguments[name] = value
+	}
+	for i := range injected {
+		arg := &injected[i]
+		value, ok, err := arg.resolve(server, clientArguments)
+		if err != nil {
+			return err
+		}
+		clientValue, supplied := clientArguments[arg.Name]
+		switch {
+		case !ok:
+			if arg.OnConflict != InjectKeep {
+				delete(arguments, arg.Name)
+			}
+		case !supplied || arg.OnConflict == InjectOverride:
+			arguments[arg.Name] = value
+		case arg.OnConflict == InjectReject && !sameJSON(clientValue, value):
+			return fmt.Errorf("%w: %s", errArgumentConflict, arg.Name)
+		}
+	}
+	return nil
+}
+
+// sameJSON reports whether two values have the same JSON encoding
+func sameJSON(a, b any) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(rawA, rawB)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// MockHeader makes a tools/call return the mockResponse of the tool instead of calling its backend,
+// when the server's mock mode is MockByHeader.
+const MockHeader = "x-mcp-mock"
+
+// ctxKeyMockHeader holds the value of MockHeader, taken from the request headers
+const ctxKeyMockHeader = "mcp_mock_header"
+
+// MockMode controls whether REST tools call their backend or return their mockResponse
+type MockMode string
+
+const (
+	MockOff      MockMode = ""       // Always call the backend
+	MockByHeader MockMode = "header" // Mock only when the request carries MockHeader: true
+	MockAlways   MockMode = "always" // Never call the backend
+)
+
+// ParseMockMode validates a mock config value
+func ParseMockMode(mode string) (MockMode, error) {
+	switch MockMode(mode) {
+	case MockOff, MockByHeader, MockAlways:
+		return MockMode(mode), nil
+	case "off":
+		return MockOff, nil
+	}
+	return MockOff, fmt.Errorf("unknown mock mode: %s", mode)
+}
+
+// takeMockHeader keeps the value of the mock header for isMock and removes the header in the request
+// header phase, so it never reaches the backend of tools that are called
+func takeMockHeader(ctx wrapper.HttpContext) {
+	value, _ := proxywasm.GetHttpRequestHeader(MockHeader)
+	if value == "" {
+		return
+	}
+	ctx.SetContext(ctxKeyMockHeader, value)
+	proxywasm.RemoveHttpRequestHeader(MockHeader)
+}
+
+// isMock reports whether the current tools/call should be answered with the mock response
+func isMock(ctx wrapper.HttpContext, mode MockMode) bool {
+	value, _ := ctx.GetContext(ctxKeyMockHeader).(string)
+	switch mode {
+	case MockAlways:
+		return true
+	case MockByHeader:
+		return strings.EqualFold(value, "true") || value == "1"
+	}
+	return false
+}
+
+// mockBody returns the backend response body a mockResponse stands for: a string is the body itself,
+// e.g. text or markdown, any other JSON value is a JSON body
+func mockBody(mockResponse json.RawMessage) []byte {
+	value := gjson.ParseBytes(mockResponse)
+	if value.Type == gjson.String {
+		return []byte(value.Str)
+	}
+	return mockResponse
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// phaseContextStub answers tools/call in the request header phase
+type phaseContextStub struct {
+	contextStub
+}
+
+func (c *phaseContextStub) GetBoolContext(key string, defaultValue bool) bool {
+	if value, ok := c.values[key].(bool); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func (c *phaseContextStub) GetExecutionPhase() iface.HTTPExecutionPhase {
+	return iface.DecodeHeader
+}
+
+// TestParseMockMode tests validation of the mock option
+func TestParseMockMode(t *testing.T) {
+	for value, expected := range map[string]MockMode{"": MockOff, "off": MockOff, "header": MockByHeader, "always": MockAlways} {
+		mode, err := ParseMockMode(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, mode)
+	}
+	_, err := ParseMockMode("never")
+	assert.Error(t, err)
+}
+
+// TestMockResponse tests that tools return their mock response, rendered like a backend response, in mock mode
+func TestMockResponse(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("mock-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+
+	server := NewRestMCPServer("demo")
+	require.NoError(t, server.AddRestTool(RestTool{
+		Name:             "get_weather",
+		RequestTemplate:  RestToolRequestTemplate{URL: "http://weather.example.com/v1/{{.args.city}}", Method: "GET"},
+		ResponseTemplate: RestToolResponseTemplate{Body: "{{.city}}: {{.temp}}°C"},
+		MockResponse:     json.RawMessage(`{"city": "Hangzhou", "temp": 21}`),
+	}))
+	require.NoError(t, server.AddRestTool(RestTool{
+		Name:            "get_news",
+		RequestTemplate: RestToolRequestTemplate{URL: "http://news.example.com/v1", Method: "GET"},
+		MockResponse:    json.RawMessage(`"# Headlines"`),
+	}))
+	require.NoError(t, server.AddRestTool(RestTool{
+		Name:            "get_stock",
+		RequestTemplate: RestToolRequestTemplate{URL: "http://stock.example.com/v1", Method: "GET"},
+	}))
+
+	call := func(headers [][2]string, tool string) (gjson.Result, error) {
+		contextID := host.InitializeHttpContext()
+		defer host.CompleteHttpContext(contextID)
+		host.CallOnRequestHeaders(contextID, append([][2]string{{":path", "/mcp"}}, headers...), false)
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1, IsString: false}}}}
+		takeMockHeader(ctx)
+		assert.Empty(t, headerValue(host.GetCurrentRequestHeaders(contextID), MockHeader), "the mock header is removed with the headers")
+		err := server.GetMCPTools()[tool].Create([]byte(`{"city": "Hangzhou"}`)).Call(ctx, server)
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response), err
+	}
+
+	server.SetMockMode(MockAlways)
+	response, err := call(nil, "get_weather")
+	require.NoError(t, err)
+	assert.Equal(t, "Hangzhou: 21°C", response.Get("result.content.0.text").String())
+	response, err = call(nil, "get_news")
+	require.NoError(t, err)
+	assert.Equal(t, "# Headlines", response.Get("result.content.0.text").String())
+	_, err = call(nil, "get_stock")
+	assert.ErrorContains(t, err, "get_stock has no mockResponse")
+
+	server.SetMockMode(MockByHeader)
+	response, err = call([][2]string{{MockHeader, "true"}}, "get_weather")
+	require.NoError(t, err)
+	assert.Equal(t, "Hangzhou: 21°C", response.Get("result.content.0.text").String())
+	assert.Equal(t, MockByHeader, server.Clone().(*RestMCPServer).GetMockMode())
+}
+
+func headerValue(headers [][2]string, name string) string {
+	for _, h := range headers {
+		if h[0] == name {
+			return h[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/cache"
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	defaultOAuth2TokenTimeout  = 3000
+	defaultOAuth2TokenLifetime = 5 * time.Minute
+	// maxOAuth2RefreshMargin bounds how long before its expiry a token is refreshed
+	maxOAuth2RefreshMargin = time.Minute
+	// minOAuth2RefetchInterval bounds the fetches of a token endpoint that fails
+	minOAuth2RefetchInterval = 5 * time.Second
+)
+
+// oauth2TokenSource acquires the access tokens of an oauth2 security scheme with the client
+// credentials grant. A token is refreshed in the background shortly before it expires, and fetches
+// of concurrent tool calls are deduplicated.
+type oauth2TokenSource struct {
+	client   wrapper.HttpClient
+	tokenURL string
+	body     []byte
+	headers  [][2]string
+	timeout  uint32
+	now      func() time.Time
+
+	token     string
+	refreshAt time.Time
+	expiresAt time.Time
+	fetcher   *cache.Fetcher[string]
+}
+
+// newOAuth2TokenSource creates the token source of an oauth2 security scheme, the token endpoint is
+// called through the cluster of tokenServiceFqdn and tokenServicePort, by default its host and port
+func newOAuth2TokenSource(scheme SecurityScheme) (*oauth2TokenSource, error) {
+	u, err := url.Parse(scheme.TokenURL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, configerr.Errorf("/tokenUrl", "absolute URL", "invalid oauth2 token url %q", scheme.TokenURL)
+	}
+	if scheme.ClientID == "" {
+		return nil, configerr.Errorf("/clientId", "non-empty string", "oauth2 security scheme requires a clientId")
+	}
+	if scheme.ClientSecret == "" {
+		return nil, configerr.Errorf("/clientSecret", "non-empty string", "oauth2 security scheme requires a clientSecret")
+	}
+	fqdn := scheme.TokenServiceFQDN
+	if fqdn == "" {
+		fqdn = u.Hostname()
+	}
+	port := scheme.TokenServicePort
+	if port == 0 {
+		if port, err = parsePort(u); err != nil {
+			return nil, configerr.New("/tokenUrl", "absolute URL", err)
+		}
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(scheme.Scopes) > 0 {
+		form.Set("scope", strings.Join(scheme.Scopes, " "))
+	}
+	if scheme.Audience != "" {
+		form.Set("audience", scheme.Audience)
+	}
+	// client_secret_basic, the credentials are form-encoded before they are joined
+	credentials := url.QueryEscape(scheme.ClientID) + ":" + url.QueryEscape(scheme.ClientSecret)
+	s := &oauth2TokenSource{
+		client:   wrapper.NewClusterClient(wrapper.FQDNCluster{FQDN: fqdn, Host: u.Host, Port: port}),
+		tokenURL: scheme.TokenURL,
+		body:     []byte(form.Encode()),
+		headers: [][2]string{
+			{"Content-Type", "application/x-www-form-urlencoded"},
+			{"Accept", "application/json"},
+			{"Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))},
+		},
+		timeout: defaultOAuth2TokenTimeout,
+		now:     time.Now,
+	}
+	s.fetcher = cache.NewFetcher(minOAuth2RefetchInterval, func() time.Time { return s.now() }, s.validToken)
+	return s, nil
+}
+
+func parsePort(u *url.URL) (int64, error) {
+	if p := u.Port(); p != "" {
+		port, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("invalid port %q", p)
+		}
+		return port, nil
+	}
+	if u.Scheme == "http" {
+		return 80, nil
+	}
+	return 443, nil
+}
+
+// get calls callback with an access token, at once if it is cached or later once it is fetched
+func (s *oauth2TokenSource) get(callback func(token string, err error)) {
+	now := s.now()
+	valid := s.token != "" && now.Before(s.expiresAt)
+	canFetch := s.fetcher.CanFetch()
+	switch {
+	case valid && !now.Before(s.refreshAt) && canFetch:
+		token := s.token
+		s.fetch(nil)
+		callback(token, nil)
+	case valid:
+		callback(s.token, nil)
+	case canFetch:
+		s.fetch(callback)
+	default:
+		callback("", s.fetcher.Err())
+	}
+}
+
+// fetch requests a token, callback may be nil for a refresh in the background
+func (s *oauth2TokenSource) fetch(callback func(token string, err error)) {
+	s.fetcher.Fetch(callback, func(done func(token string, err error)) {
+		err := s.client.Post(s.tokenURL, s.headers, s.body, func(statusCode int, _ http.Header, body []byte) {
+			if statusCode != http.StatusOK {
+				done("", fmt.Errorf("token endpoint %s returned status %d", s.tokenURL, statusCode))
+				return
+			}
+			response := gjson.ParseBytes(body)
+			token := response.Get("access_token").String()
+			if token == "" {
+				done("", fmt.Errorf("token endpoint %s returned no access_token", s.tokenURL))
+				return
+			}
+			if tokenType := response.Get("token_type").String(); tokenType != "" && !strings.EqualFold(tokenType, "bearer") {
+				done("", fmt.Errorf("token endpoint %s returned unsupported token_type %s", s.tokenURL, tokenType))
+				return
+			}
+			lifetime := defaultOAuth2TokenLifetime
+			if expiresIn := response.Get("expires_in").Int(); expiresIn > 0 {
+				lifetime = time.Duration(expiresIn) * time.Second
+			}
+			now := s.now()
+			s.token = token
+			s.expiresAt = now.Add(lifetime)
+			s.refreshAt = s.expiresAt.Add(-min(maxOAuth2RefreshMargin, lifetime/10))
+			done(token, nil)
+		}, s.timeout)
+		if err != nil {
+			done("", fmt.Errorf("failed to call token endpoint %s: %v", s.tokenURL, err))
+		}
+	})
+}
+
+// validToken returns the token fetched before a fetch that failed, if it has not expired
+func (s *oauth2TokenSource) validToken(err error) (string, bool) {
+	if s.token == "" || !s.now().Before(s.expiresAt) {
+		return "", false
+	}
+	log.Warnf("%v, using the token expiring at %s", err, s.expiresAt.Format(time.RFC3339))
+	return s.token, true
+}
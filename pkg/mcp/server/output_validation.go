@@ -0,0 +1,225 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// errMissingStructuredContent is returned for a successful result without structuredContent of a tool with an
+// output schema
+var errMissingStructuredContent = errors.New("result has no structuredContent")
+
+// structuredOutputVersion is the first protocol version with structured tool output
+const structuredOutputVersion = "2025-06-18"
+
+// ToolOutputValidator checks the structuredContent of tools/call results against the output schemas of the
+// tools, as clients of protocol 2025-06-18 rely on it. A result that does not conform is replaced with an
+// error result, so that clients never receive structured data breaking the declared schema. Results for
+// clients of earlier protocol versions are not checked.
+type ToolOutputValidator struct {
+	// Coerce converts scalar values to the types of the schema where this is lossless, e.g. "42" to 42 for
+	// an integer, and strips the properties of objects that are not declared by the schema before validating
+	Coerce bool
+}
+
+// parseOutputValidation parses the validateOutput and coerceOutput flags of a server config, it returns nil when
+// the results are not validated
+func parseOutputValidation(serverJson gjson.Result) (*ToolOutputValidator, error) {
+	validate := serverJson.Get("validateOutput")
+	if validate.Exists() && !validate.IsBool() {
+		return nil, configerr.Errorf("/validateOutput", "boolean", "got %s", validate.Raw)
+	}
+	coerce := serverJson.Get("coerceOutput")
+	if coerce.Exists() && !coerce.IsBool() {
+		return nil, configerr.Errorf("/coerceOutput", "boolean", "got %s", coerce.Raw)
+	}
+	if coerce.Bool() && !validate.Bool() {
+		return nil, configerr.Errorf("/coerceOutput", "", "coerceOutput requires validateOutput")
+	}
+	if !validate.Bool() {
+		return nil, nil
+	}
+	return &ToolOutputValidator{Coerce: coerce.Bool()}, nil
+}
+
+// wrap checks the result of the called tool, when it declares an output schema and the client negotiated
+// structured output
+func (v *ToolOutputValidator) wrap(server Server, handler utils.JsonRpcMethodHandler) utils.JsonRpcMethodHandler {
+	return func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		if requestProtocolVersion(ctx) < structuredOutputVersion {
+			return handler(ctx, id, params)
+		}
+		name := params.Get("name").String()
+		if tool, ok := server.GetMCPTools()[name].(ToolWithOutputSchema); ok && len(tool.OutputSchema()) > 0 {
+			schemaBytes, err := json.Marshal(tool.OutputSchema())
+			if err == nil {
+				schema := gjson.ParseBytes(schemaBytes)
+				patterns := patternsOf(tool)
+				utils.SetResultFilter(ctx, func(result []byte) []byte {
+					return v.filter(name, schema, patterns, result)
+				})
+			}
+		}
+		return handler(ctx, id, params)
+	}
+}
+
+// filter returns the result with its structuredContent coerced, or an error result when it does not match
+// the schema. Error results of the tool are returned as they are.
+func (v *ToolOutputValidator) filter(toolName string, schema gjson.Result, patterns schemaPatterns, result []byte) []byte {
+	parsed := gjson.ParseBytes(result)
+	if parsed.Get("isError").Bool() {
+		return result
+	}
+	result, err := v.check(schema, patterns, parsed)
+	if err == nil {
+		return result
+	}
+	log.Warnf("Result of tool %s does not match its output schema: %v", toolName, err)
+	errorResult, _ := json.Marshal(map[string]any{
+		"content": []map[string]any{{
+			"type": "text",
+			"text": fmt.Sprintf("output of tool %s does not match its output schema: %v", toolName, err),
+		}},
+		"isError": true,
+	})
+	return errorResult
+}
+
+func (v *ToolOutputValidator) check(schema gjson.Result, patterns schemaPatterns, result gjson.Result) ([]byte, error) {
+	structured := result.Get("structuredContent")
+	if !structured.Exists() {
+		return nil, errMissingStructuredContent
+	}
+	raw := []byte(result.Raw)
+	if v.Coerce {
+		var value any
+		if err := utils.UnmarshalJSON([]byte(structured.Raw), &value); err != nil {
+			return nil, err
+		}
+		coerced, err := json.Marshal(coerceSchema(schema, value))
+		if err != nil {
+			return nil, err
+		}
+		// The text content serializing the structured content is kept in sync with it
+		for i, content := range result.Get("content").Array() {
+			text := content.Get("text")
+			if content.Get("type").String() == "text" && gjson.Valid(text.Str) && jsonEqual(gjson.Parse(text.Str), structured) {
+				raw, _ = sjson.SetBytes(raw, fmt.Sprintf("content.%d.text", i), string(coerced))
+			}
+		}
+		raw, _ = sjson.SetRawBytes(raw, "structuredContent", coerced)
+		structured = gjson.ParseBytes(coerced)
+	}
+	if err := validateSchema(schema, structured, "", nil, patterns); err != nil {
+		if argErr, ok := err.(*ArgumentError); ok {
+			pointer := argErr.Pointer
+			if pointer == "" {
+				pointer = "/"
+			}
+			return nil, fmt.Errorf("invalid structuredContent at %q: %s", pointer, argErr.Message)
+		}
+		return nil, err
+	}
+	return raw, nil
+}
+
+// coerceSchema returns the value converted to the types of the schema where this is lossless, with the object
+// properties not declared by the schema removed. Values that cannot be converted are returned as they are and
+// left to the validation.
+func coerceSchema(schema gjson.Result, value any) any {
+	if !schema.IsObject() {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		properties := schema.Get("properties")
+		additional := schema.Get("additionalProperties")
+		for name, property := range v {
+			if propertySchema := properties.Get(gjson.Escape(name)); propertySchema.Exists() {
+				v[name] = coerceSchema(propertySchema, property)
+			} else if additional.IsObject() {
+				v[name] = coerceSchema(additional, property)
+			} else if properties.Exists() && additional.Type != gjson.True {
+				delete(v, name)
+			}
+		}
+		return v
+	case []any:
+		items := schema.Get("items")
+		for i, item := range v {
+			v[i] = coerceSchema(items, item)
+		}
+		return v
+	}
+	if !schema.Get("type").Exists() {
+		return value
+	}
+	types := typeNames(schema.Get("type"))
+	raw, _ := json.Marshal(value)
+	for _, t := range types {
+		if matchesType(t, gjson.ParseBytes(raw)) {
+			return value
+		}
+	}
+	for _, t := range types {
+		if coerced, ok := coerceScalar(t, value); ok {
+			return coerced
+		}
+	}
+	return value
+}
+
+// coerceScalar converts a scalar to the type, false when it cannot be converted without losing information
+func coerceScalar(typeName string, value any) (any, bool) {
+	switch v := value.(type) {
+	case string:
+		switch typeName {
+		case "number":
+			if number := gjson.Parse(v); number.Type == gjson.Number && number.Raw == v && json.Valid([]byte(v)) {
+				return json.Number(v), true
+			}
+		case "integer":
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, true
+			}
+		case "boolean":
+			if v == "true" || v == "false" {
+				return v == "true", true
+			}
+		}
+	case json.Number:
+		if typeName == "string" {
+			return v.String(), true
+		}
+	case bool:
+		if typeName == "string" {
+			return strconv.FormatBool(v), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+)
+
+// TestCoerceSchema tests the lossless conversions and the stripping of undeclared properties
+func TestCoerceSchema(t *testing.T) {
+	schema := gjson.Parse(`{
+		"type": "object",
+		"properties": {
+			"count": {"type": "integer"},
+			"price": {"type": "number"},
+			"active": {"type": "boolean"},
+			"code": {"type": "string"},
+			"id": {"type": ["string", "integer"]},
+			"items": {"type": "array", "items": {"type": "object", "properties": {"qty": {"type": "integer"}}}},
+			"extra": {"type": "object", "additionalProperties": true}
+		}
+	}`)
+	for value, expected := range map[string]string{
+		`{"count": "42", "price": "1.5e3", "active": "true", "code": 7}`: `{"count": 42, "price": 1.5e3, "active": true, "code": "7"}`,
+		`{"count": "4.2", "price": "NaN", "active": "yes"}`:              `{"count": "4.2", "price": "NaN", "active": "yes"}`,
+		`{"id": "42"}`: `{"id": "42"}`,
+		`{"items": [{"qty": "2", "sku": "a"}], "unknown": 1}`: `{"items": [{"qty": 2}]}`,
+		`{"extra": {"a": 1}, "code": false}`:                  `{"extra": {"a": 1}, "code": "false"}`,
+	} {
+		var decoded any
+		require.NoError(t, utils.UnmarshalJSON([]byte(value), &decoded))
+		coerced, err := json.Marshal(coerceSchema(schema, decoded))
+		require.NoError(t, err)
+		assert.JSONEq(t, expected, string(coerced), value)
+	}
+
+	var decoded any
+	require.NoError(t, utils.UnmarshalJSON([]byte(`{"count": 12345678901234567890}`), &decoded))
+	coerced, _ := json.Marshal(coerceSchema(schema, decoded))
+	assert.Equal(t, `{"count":12345678901234567890}`, string(coerced), "large integers are kept as they are")
+}
+
+// TestValidateOutput tests that the structured results of tools with an output schema are checked when
+// validateOutput is set
+func TestValidateOutput(t *testing.T) {
+	defer startTestHttpContext("validate-output-test")()
+
+	parse := func(flags string) *McpServerConfig {
+		config := &McpServerConfig{}
+		require.NoError(t, parseConfigCore(gjson.Parse(`{
+			"server": {"name": "stock"`+flags+`},
+			"tools": [{
+				"name": "level",
+				"args": [{"name": "count", "description": "Count"}, {"name": "note", "description": "Note"}],
+				"outputSchema": {"type": "object", "properties": {"count": {"type": "integer"}}, "required": ["count"]},
+				"responseTemplate": {"body": "{\"count\": {{toJson .args.count}}, \"note\": \"{{.args.note}}\"}"}
+			}, {
+				"name": "plain",
+				"responseTemplate": {"body": "not json"}
+			}]
+		}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+		return config
+	}
+	version := "2025-06-18"
+	call := func(config *McpServerConfig, name, args string) gjson.Result {
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}
+		if version != "" {
+			ctx.values[ctxKeyProtocolVersion] = version
+		}
+		require.NoError(t, config.methodHandlers["tools/call"](ctx, utils.JsonRpcID{IntValue: 1}, gjson.Parse(`{"name": "`+name+`", "arguments": `+args+`}`)))
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response).Get("result")
+	}
+
+	config := parse(`, "validateOutput": true`)
+	result := call(config, "level", `{"count": 3, "note": "ok"}`)
+	assert.False(t, result.Get("isError").Bool())
+	assert.Equal(t, int64(3), result.Get("structuredContent.count").Int())
+	assert.Equal(t, "ok", result.Get("structuredContent.note").String())
+
+	result = call(config, "level", `{"count": "3"}`)
+	assert.True(t, result.Get("isError").Bool())
+	assert.False(t, result.Get("structuredContent").Exists())
+	assert.Equal(t, `output of tool level does not match its output schema: invalid structuredContent at "/count": expected integer, got string`, result.Get("content.0.text").String())
+
+	result = call(config, "plain", `{}`)
+	assert.False(t, result.Get("isError").Bool(), "tools without an output schema are not checked")
+	assert.Equal(t, "not json", result.Get("content.0.text").String())
+
+	config = parse(`, "validateOutput": true, "coerceOutput": true`)
+	result = call(config, "level", `{"count": "3", "note": "ok"}`)
+	assert.False(t, result.Get("isError").Bool())
+	assert.JSONEq(t, `{"count": 3}`, result.Get("structuredContent").Raw)
+	assert.JSONEq(t, `{"count": 3}`, result.Get("content.0.text").String())
+	assert.True(t, call(config, "level", `{"count": "three"}`).Get("isError").Bool())
+
+	assert.False(t, call(parse(""), "level", `{"count": "3"}`).Get("isError").Bool(), "results are not checked by default")
+
+	// Clients of earlier protocol versions do not negotiate structured output
+	config = parse(`, "validateOutput": true`)
+	for _, version = range []string{"2025-03-26", ""} {
+		result = call(config, "level", `{"count": "3"}`)
+		assert.False(t, result.Get("isError").Bool(), version)
+		assert.Equal(t, "3", result.Get("structuredContent.count").String(), version)
+	}
+
+	for flags, expected := range map[string]string{
+		`, "validateOutput": "yes"`: `invalid config at "/server/validateOutput", expected boolean`,
+		`, "coerceOutput": true`:    `invalid config at "/server/coerceOutput"`,
+	} {
+		err := parseConfigCore(gjson.Parse(`{"server": {"name": "stock"`+flags+`}, "tools": [{"name": "a", "requestTemplate": {"url": "http://a", "method": "GET"}}]}`),
+			&McpServerConfig{}, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+		assert.ErrorContains(t, err, expected, flags)
+	}
+}
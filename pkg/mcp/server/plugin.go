@@ -27,6 +27,7 @@ import (
 	"github.com/invopop/jsonschema"
 	"github.com/tidwall/gjson"
 
+	"github.com/higress-group/wasm-go/pkg/configerr"
 	"github.com/higress-group/wasm-go/pkg/log"
 	"github.com/higress-group/wasm-go/pkg/mcp/utils"
 	"github.com/higress-group/wasm-go/pkg/wrapper"
@@ -40,6 +41,22 @@ const (
 // SupportedMCPVersions contains all supported MCP protocol versions
 var SupportedMCPVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
 
+// defaultProtocolVersion is assumed for requests without the MCP-Protocol-Version header, as the 2025-06-18
+// specification requires for backwards compatibility
+const defaultProtocolVersion = "2025-03-26"
+
+// ctxKeyProtocolVersion holds the supported protocol version taken from the MCP-Protocol-Version header
+const ctxKeyProtocolVersion = "mcp_protocol_version"
+
+// requestProtocolVersion returns the protocol version negotiated by the client of the current request.
+// Versions are dates, so they compare as strings.
+func requestProtocolVersion(ctx wrapper.HttpContext) string {
+	if version, ok := ctx.GetContext(ctxKeyProtocolVersion).(string); ok {
+		return version
+	}
+	return defaultProtocolVersion
+}
+
 // validateURL validates that the given string is a valid URL
 func validateURL(urlStr string) error {
 	if urlStr == "" {
@@ -76,23 +93,39 @@ func setupMcpProxyServer(serverName string, serverJson gjson.Result, serverConfi
 	// Parse and validate transport (required for mcp-proxy)
 	transportStr := serverJson.Get("transport").String()
 	if transportStr == "" {
-		return nil, errors.New("transport field is required for mcp-proxy server type")
+		return nil, configerr.New("/transport", "string", errors.New("transport field is required for mcp-proxy server type"))
 	}
 	transport := TransportProtocol(transportStr)
 	if transport != TransportHTTP && transport != TransportSSE {
-		return nil, fmt.Errorf("invalid transport value: %s, must be 'http' or 'sse'", transportStr)
+		return nil, configerr.Errorf("/transport", `"http" or "sse"`, "invalid transport value: %s", transportStr)
 	}
 	proxyServer.SetTransport(transport)
 
-	// Parse and validate mcpServerURL (required for mcp-proxy)
-	mcpServerURL := serverJson.Get("mcpServerURL").String()
-	if mcpServerURL == "" {
-		return nil, errors.New("mcpServerURL is required for mcp-proxy server type")
-	}
-	if err := validateURL(mcpServerURL); err != nil {
-		return nil, fmt.Errorf("invalid mcpServerURL: %v", err)
+	// Parse and validate mcpServerURL (required for mcp-proxy), a list of backends is load balanced
+	mcpServerURLJson := serverJson.Get("mcpServerURL")
+	loadBalancingJson := serverJson.Get("loadBalancing")
+	if mcpServerURLJson.IsArray() {
+		if transport != TransportHTTP {
+			return nil, configerr.New("/mcpServerURL", "string", errors.New("multiple backends are only supported with http transport"))
+		}
+		pool, err := parseBackendPool(mcpServerURLJson, loadBalancingJson)
+		if err != nil {
+			return nil, err
+		}
+		proxyServer.SetBackendPool(pool)
+	} else {
+		if loadBalancingJson.Exists() {
+			return nil, configerr.New("/loadBalancing", "", errors.New("loadBalancing requires mcpServerURL to list the backends"))
+		}
+		mcpServerURL := mcpServerURLJson.String()
+		if mcpServerURL == "" {
+			return nil, configerr.New("/mcpServerURL", "string", errors.New("mcpServerURL is required for mcp-proxy server type"))
+		}
+		if err := validateURL(mcpServerURL); err != nil {
+			return nil, configerr.Errorf("/mcpServerURL", "http or https URL", "invalid mcpServerURL: %v", err)
+		}
+		proxyServer.SetMcpServerURL(mcpServerURL)
 	}
-	proxyServer.SetMcpServerURL(mcpServerURL)
 
 	// Parse timeout (optional)
 	timeout := serverJson.Get("timeout").Int()
@@ -107,10 +140,13 @@ func setupMcpProxyServer(serverName string, serverJson gjson.Result, serverConfi
 	// Parse security schemes
 	securitySchemesJson := serverJson.Get("securitySchemes")
 	if securitySchemesJson.Exists() {
-		for _, schemeJson := range securitySchemesJson.Array() {
+		for i, schemeJson := range securitySchemesJson.Array() {
 			var scheme SecurityScheme
-			if err := json.Unmarshal([]byte(schemeJson.Raw), &scheme); err != nil {
-				return nil, fmt.Errorf("failed to parse security scheme config: %v", err)
+			if err := configerr.DecodeJSON(configerr.Pointer("securitySchemes", i), []byte(schemeJson.Raw), &scheme); err != nil {
+				return nil, err
+			}
+			if scheme.Type == "oauth2" {
+				return nil, configerr.Errorf(configerr.Pointer("securitySchemes", i, "type"), "apiKey or http", "oauth2 security schemes are only supported by REST servers")
 			}
 			proxyServer.AddSecurityScheme(scheme)
 		}
@@ -120,8 +156,8 @@ func setupMcpProxyServer(serverName string, serverJson gjson.Result, serverConfi
 	defaultDownstreamSecurityJson := serverJson.Get("defaultDownstreamSecurity")
 	if defaultDownstreamSecurityJson.Exists() {
 		var defaultDownstreamSecurity SecurityRequirement
-		if err := json.Unmarshal([]byte(defaultDownstreamSecurityJson.Raw), &defaultDownstreamSecurity); err != nil {
-			return nil, fmt.Errorf("failed to parse defaultDownstreamSecurity config: %v", err)
+		if err := configerr.DecodeJSON("/defaultDownstreamSecurity", []byte(defaultDownstreamSecurityJson.Raw), &defaultDownstreamSecurity); err != nil {
+			return nil, err
 		}
 		proxyServer.SetDefaultDownstreamSecurity(defaultDownstreamSecurity)
 	}
@@ -130,12 +166,67 @@ func setupMcpProxyServer(serverName string, serverJson gjson.Result, serverConfi
 	defaultUpstreamSecurityJson := serverJson.Get("defaultUpstreamSecurity")
 	if defaultUpstreamSecurityJson.Exists() {
 		var defaultUpstreamSecurity SecurityRequirement
-		if err := json.Unmarshal([]byte(defaultUpstreamSecurityJson.Raw), &defaultUpstreamSecurity); err != nil {
-			return nil, fmt.Errorf("failed to parse defaultUpstreamSecurity config: %v", err)
+		if err := configerr.DecodeJSON("/defaultUpstreamSecurity", []byte(defaultUpstreamSecurityJson.Raw), &defaultUpstreamSecurity); err != nil {
+			return nil, err
 		}
 		proxyServer.SetDefaultUpstreamSecurity(defaultUpstreamSecurity)
 	}
 
+	// Parse errorCodeMapping (optional, overrides utils.DefaultStatusCodeMapping)
+	errorCodeMappingJson := serverJson.Get("errorCodeMapping")
+	if errorCodeMappingJson.Exists() {
+		mapping, err := utils.ParseStatusCodeMapping(errorCodeMappingJson)
+		if err != nil {
+			return nil, configerr.Prefix("/errorCodeMapping", err)
+		}
+		proxyServer.SetErrorCodeMapping(mapping)
+	}
+
+	// Parse validateArguments (optional, validate tools/call arguments of configured tools)
+	validateArguments, err := parseValidateArguments(serverJson)
+	if err != nil {
+		return nil, err
+	}
+	proxyServer.SetValidateArguments(validateArguments)
+
+	// Parse backendSession (optional, only supported by the http transport)
+	backendSessionJson := serverJson.Get("backendSession")
+	if backendSessionJson.Exists() {
+		var backendSession BackendSessionConfig
+		if err := configerr.DecodeJSON("/backendSession", []byte(backendSessionJson.Raw), &backendSession); err != nil {
+			return nil, err
+		}
+		if backendSession.Persist && transport != TransportHTTP {
+			return nil, configerr.New("/backendSession/persist", "", errors.New("backendSession.persist is only supported with http transport"))
+		}
+		if backendSession.Persist && backendSession.CredentialSecret == "" {
+			return nil, configerr.New("/backendSession/credentialSecret", "string", errors.New("backendSession.credentialSecret is required with backendSession.persist"))
+		}
+		if backendSession.DeleteOnComplete && transport != TransportHTTP {
+			return nil, configerr.New("/backendSession/deleteOnComplete", "", errors.New("backendSession.deleteOnComplete is only supported with http transport"))
+		}
+		proxyServer.SetBackendSession(backendSession)
+		if storeJson := backendSessionJson.Get("store"); storeJson.Exists() {
+			if !backendSession.Persist {
+				return nil, configerr.New("/backendSession/store", "", errors.New("backendSession.store requires backendSession.persist"))
+			}
+			store, err := parseSessionStore(serverName, storeJson)
+			if err != nil {
+				return nil, configerr.Prefix("/backendSession/store", err)
+			}
+			proxyServer.GetSessionManager().SetStore(store)
+		}
+	}
+
+	// Parse toolsListCache (optional, caches the backend tools/list result)
+	if toolsListCacheJson := serverJson.Get("toolsListCache"); toolsListCacheJson.Exists() {
+		cache, err := parseToolsListCache(serverName, toolsListCacheJson)
+		if err != nil {
+			return nil, configerr.Prefix("/toolsListCache", err)
+		}
+		proxyServer.SetToolsListCache(cache)
+	}
+
 	return proxyServer, nil
 }
 
@@ -157,6 +248,7 @@ type ToolInfo struct {
 	Description  string
 	InputSchema  map[string]any
 	OutputSchema map[string]any // New field for MCP Protocol Version 2025-06-18
+	Scopes       []string       // Scopes the caller must be granted to list and call the tool
 	ServerName   string         // Original server name
 	Tool         Tool           // The actual tool instance for cloning
 }
@@ -181,6 +273,7 @@ func (r *GlobalToolRegistry) RegisterTool(serverName string, toolName string, to
 		Name:        toolName,
 		Description: tool.Description(),
 		InputSchema: tool.InputSchema(),
+		Scopes:      scopesOf(tool),
 		ServerName:  serverName,
 		Tool:        tool,
 	}
@@ -221,6 +314,11 @@ type Server interface {
 	GetMCPTools() map[string]Tool // For single server, returns its tools. For composed, returns composed tools.
 	SetConfig(config []byte)
 	GetConfig(v any)
+	// Clone returns a copy of the server that can be configured and used concurrently with the original:
+	// changing the config, tools, resources, prompts, security schemes or tool configs of one of them never
+	// changes the other, so every map and slice of them is copied. The tool instances, parsed templates and
+	// other state that is never modified once parsed may be shared, as may the runtime state the copies are
+	// meant to share, e.g. acquired OAuth2 tokens, backend sessions and caches.
 	Clone() Server
 	// GetName() string // Returns the server name - REMOVED
 }
@@ -266,6 +364,13 @@ type McpServerConfig struct {
 	methodHandlers utils.MethodHandlers
 	toolSet        *ToolSetConfig // Parsed toolset configuration
 	isComposed     bool
+	recorder       *ToolCallRecorder    // Records tools/call invocations when server.recorder is configured
+	quota          *ToolQuota           // Limits the tools/call invocations of consumers when server.quota is configured
+	sandbox        *ToolSandbox         // Limits the callouts of every tools/call when server.sandbox is configured
+	output         *ToolOutputValidator // Checks the structured results of tools/call when server.validateOutput is set
+	authorization  *ToolAuthorization   // Enforces the scopes of tools when tools have scopes or server.authorization is configured
+	toolSource     *ToolSource          // Replaces the tool definitions when server.toolSource is configured
+	sseResponse    bool
 }
 
 // GetServerName returns the server name for external access
@@ -342,12 +447,14 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 	// serverConfigJsonForInstance is the config passed to the specific server instance (single or REST)
 	// It's distinct from pluginServerConfigJson which might be for the mcp-server plugin itself.
 	var serverConfigJsonForInstance string
+	// toolScopes are the scopes of the tools configured with scopes
+	toolScopes := make(map[string][]string)
 
 	if toolSetJson.Exists() {
 		config.isComposed = true
 		var tsConfig ToolSetConfig
-		if err := json.Unmarshal([]byte(toolSetJson.Raw), &tsConfig); err != nil {
-			return fmt.Errorf("failed to parse toolSet config: %v", err)
+		if err := configerr.DecodeJSON("/toolSet", []byte(toolSetJson.Raw), &tsConfig); err != nil {
+			return err
 		}
 		config.toolSet = &tsConfig
 		config.serverName = tsConfig.Name // Use toolSet name as the server name for composed server
@@ -361,7 +468,7 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 		config.isComposed = false
 		config.serverName = serverJson.Get("name").String()
 		if config.serverName == "" {
-			return errors.New("server.name field is missing for single server config")
+			return configerr.New("/server/name", "string", errors.New("server.name field is missing for single server config"))
 		}
 		// This is the config for the specific server being defined (e.g. REST server's own config)
 		serverConfigJsonForInstance = serverJson.Get("config").Raw
@@ -374,43 +481,67 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 		}
 
 		toolsJson := configJson.Get("tools") // These are REST tools for this server instance or MCP proxy tools
+		resourcesJson := configJson.Get("resources")
+		resourceTemplatesJson := configJson.Get("resourceTemplates")
+		promptsJson := configJson.Get("prompts")
 
 		if serverType == "mcp-proxy" {
 			// Create MCP proxy server
 			proxyServer, err := setupMcpProxyServer(config.serverName, serverJson, serverConfigJsonForInstance)
 			if err != nil {
-				return err
+				return configerr.Prefix("/server", err)
 			}
 
 			// Handle tools configuration (optional for MCP proxy)
 			if toolsJson.Exists() && len(toolsJson.Array()) > 0 {
-				for _, toolJson := range toolsJson.Array() {
+				for i, toolJson := range toolsJson.Array() {
 					var proxyTool McpProxyToolConfig
-					if err := json.Unmarshal([]byte(toolJson.Raw), &proxyTool); err != nil {
-						return fmt.Errorf("failed to parse proxy tool config: %v", err)
+					if err := configerr.DecodeJSON(configerr.Pointer("tools", i), []byte(toolJson.Raw), &proxyTool); err != nil {
+						return err
 					}
 
 					if err := proxyServer.AddProxyTool(proxyTool); err != nil {
-						return fmt.Errorf("failed to add proxy tool %s: %v", proxyTool.Name, err)
+						if _, ok := err.(*configerr.Error); ok {
+							return configerr.Prefix(configerr.Pointer("tools", i), err)
+						}
+						return configerr.Prefix(configerr.Pointer("tools", i), fmt.Errorf("failed to add proxy tool %s: %v", proxyTool.Name, err))
+					}
+					// Renamed tools are authorized and registered with the name they are exposed as
+					exposedName := proxyTool.ExposedName()
+					if len(proxyTool.Scopes) > 0 {
+						toolScopes[exposedName] = proxyTool.Scopes
 					}
 					// Register tool to registry
-					opts.ToolRegistry.RegisterTool(config.serverName, proxyTool.Name, proxyServer.GetMCPTools()[proxyTool.Name])
+					opts.ToolRegistry.RegisterTool(config.serverName, exposedName, proxyServer.GetMCPTools()[exposedName])
 				}
 			}
 			// Set the proxy server regardless of whether tools are configured
 			config.server = proxyServer
-		} else if toolsJson.Exists() && len(toolsJson.Array()) > 0 {
-			// Handle REST-to-MCP server (requires tools configuration)
+		} else if serverType == "mcp-aggregate" {
+			// Create MCP aggregate server, its tools are listed from the backends
+			aggregateServer, err := setupMcpAggregateServer(config.serverName, serverJson, serverConfigJsonForInstance)
+			if err != nil {
+				return configerr.Prefix("/server", err)
+			}
+			config.server = aggregateServer
+		} else if len(toolsJson.Array()) > 0 || len(resourcesJson.Array()) > 0 || len(resourceTemplatesJson.Array()) > 0 || len(promptsJson.Array()) > 0 || serverJson.Get("toolSource").Exists() {
+			// Handle REST-to-MCP server (requires tools, resources or prompts configuration, or a source of them)
 			// Create REST-to-MCP server (default behavior)
 			restServer := NewRestMCPServer(config.serverName)         // Pass the server name
 			restServer.SetConfig([]byte(serverConfigJsonForInstance)) // Pass the server's specific config
 
 			securitySchemesJson := serverJson.Get("securitySchemes")
 			if securitySchemesJson.Exists() {
-				for _, schemeJson := range securitySchemesJson.Array() {
+				for i, schemeJson := range securitySchemesJson.Array() {
 					var scheme SecurityScheme
-					if err := json.Unmarshal([]byte(schemeJson.Raw), &scheme); err != nil {
-						return fmt.Errorf("failed to parse security scheme config: %v", err)
+					if err := configerr.DecodeJSON(configerr.Pointer("server", "securitySchemes", i), []byte(schemeJson.Raw), &scheme); err != nil {
+						return err
+					}
+					if scheme.Type == "oauth2" {
+						if err := restServer.AddOAuth2Scheme(scheme); err != nil {
+							return configerr.Prefix(configerr.Pointer("server", "securitySchemes", i), err)
+						}
+						continue
 					}
 					restServer.AddSecurityScheme(scheme)
 				}
@@ -420,8 +551,8 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 			defaultDownstreamSecurityJson := serverJson.Get("defaultDownstreamSecurity")
 			if defaultDownstreamSecurityJson.Exists() {
 				var defaultDownstreamSecurity SecurityRequirement
-				if err := json.Unmarshal([]byte(defaultDownstreamSecurityJson.Raw), &defaultDownstreamSecurity); err != nil {
-					return fmt.Errorf("failed to parse defaultDownstreamSecurity config: %v", err)
+				if err := configerr.DecodeJSON("/server/defaultDownstreamSecurity", []byte(defaultDownstreamSecurityJson.Raw), &defaultDownstreamSecurity); err != nil {
+					return err
 				}
 				restServer.SetDefaultDownstreamSecurity(defaultDownstreamSecurity)
 			}
@@ -430,8 +561,8 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 			defaultUpstreamSecurityJson := serverJson.Get("defaultUpstreamSecurity")
 			if defaultUpstreamSecurityJson.Exists() {
 				var defaultUpstreamSecurity SecurityRequirement
-				if err := json.Unmarshal([]byte(defaultUpstreamSecurityJson.Raw), &defaultUpstreamSecurity); err != nil {
-					return fmt.Errorf("failed to parse defaultUpstreamSecurity config: %v", err)
+				if err := configerr.DecodeJSON("/server/defaultUpstreamSecurity", []byte(defaultUpstreamSecurityJson.Raw), &defaultUpstreamSecurity); err != nil {
+					return err
 				}
 				restServer.SetDefaultUpstreamSecurity(defaultUpstreamSecurity)
 			}
@@ -440,18 +571,92 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 			passthroughAuthHeader := serverJson.Get("passthroughAuthHeader").Bool()
 			restServer.SetPassthroughAuthHeader(passthroughAuthHeader)
 
-			for _, toolJson := range toolsJson.Array() {
+			// Parse errorCodeMapping (optional, report backend failures as JSON-RPC errors when set)
+			errorCodeMappingJson := serverJson.Get("errorCodeMapping")
+			if errorCodeMappingJson.Exists() {
+				mapping, err := utils.ParseStatusCodeMapping(errorCodeMappingJson)
+				if err != nil {
+					return configerr.Prefix("/server/errorCodeMapping", err)
+				}
+				restServer.SetErrorCodeMapping(mapping)
+			}
+
+			// Parse dryRun (optional, render tool requests instead of executing them)
+			dryRunMode, err := ParseDryRunMode(serverJson.Get("dryRun").String())
+			if err != nil {
+				return configerr.New("/server/dryRun", `one of "off", "header", "always"`, err)
+			}
+			restServer.SetDryRunMode(dryRunMode)
+
+			// Parse mock (optional, return the mockResponse of tools instead of calling their backend)
+			mockMode, err := ParseMockMode(serverJson.Get("mock").String())
+			if err != nil {
+				return configerr.New("/server/mock", `one of "off", "header", "always"`, err)
+			}
+			restServer.SetMockMode(mockMode)
+
+			// Parse validateArguments (optional, validate tools/call arguments against the input schema)
+			validateArguments, err := parseValidateArguments(serverJson)
+			if err != nil {
+				return configerr.Prefix("/server", err)
+			}
+			restServer.SetValidateArguments(validateArguments)
+
+			// Parse argSealKey (optional, accept sensitive arguments sealed by clients)
+			if argSealKey := serverJson.Get("argSealKey"); argSealKey.Exists() {
+				sealer, err := parseArgSealKey(argSealKey.String())
+				if err != nil {
+					return configerr.New("/server/argSealKey", "base64 AES key of 16, 24 or 32 bytes", err)
+				}
+				restServer.SetArgSealer(sealer)
+			}
+
+			for i, toolJson := range toolsJson.Array() {
 				var restTool RestTool
-				if err := json.Unmarshal([]byte(toolJson.Raw), &restTool); err != nil {
-					return fmt.Errorf("failed to parse tool config: %v", err)
+				if err := configerr.DecodeJSON(configerr.Pointer("tools", i), []byte(toolJson.Raw), &restTool); err != nil {
+					return err
 				}
 
 				if err := restServer.AddRestTool(restTool); err != nil {
-					return fmt.Errorf("failed to add tool %s: %v", restTool.Name, err)
+					if _, ok := err.(*configerr.Error); ok {
+						return configerr.Prefix(configerr.Pointer("tools", i), err)
+					}
+					return configerr.Prefix(configerr.Pointer("tools", i), fmt.Errorf("failed to add tool %s: %v", restTool.Name, err))
+				}
+				if len(restTool.Scopes) > 0 {
+					toolScopes[restTool.Name] = restTool.Scopes
 				}
 				// Register tool to registry
 				opts.ToolRegistry.RegisterTool(config.serverName, restTool.Name, restServer.GetMCPTools()[restTool.Name])
 			}
+
+			for i, resourceJson := range resourcesJson.Array() {
+				var restResource RestResource
+				if err := configerr.DecodeJSON(configerr.Pointer("resources", i), []byte(resourceJson.Raw), &restResource); err != nil {
+					return err
+				}
+				if err := restServer.AddRestResource(restResource); err != nil {
+					return configerr.Prefix(configerr.Pointer("resources", i), fmt.Errorf("failed to add resource %s: %v", restResource.Name, err))
+				}
+			}
+			for i, templateJson := range resourceTemplatesJson.Array() {
+				var restTemplate RestResourceTemplate
+				if err := configerr.DecodeJSON(configerr.Pointer("resourceTemplates", i), []byte(templateJson.Raw), &restTemplate); err != nil {
+					return err
+				}
+				if err := restServer.AddRestResourceTemplate(restTemplate); err != nil {
+					return configerr.Prefix(configerr.Pointer("resourceTemplates", i), fmt.Errorf("failed to add resource template %s: %v", restTemplate.Name, err))
+				}
+			}
+			for i, promptJson := range promptsJson.Array() {
+				var restPrompt TemplatePrompt
+				if err := configerr.DecodeJSON(configerr.Pointer("prompts", i), []byte(promptJson.Raw), &restPrompt); err != nil {
+					return err
+				}
+				if err := restServer.AddRestPrompt(restPrompt); err != nil {
+					return configerr.Prefix(configerr.Pointer("prompts", i), fmt.Errorf("failed to add prompt %s: %v", restPrompt.Name, err))
+				}
+			}
 			config.server = restServer
 		} else {
 			// Logic for pre-registered Go-based servers (non-REST)
@@ -469,12 +674,91 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 						opts.ToolRegistry.RegisterTool(config.serverName, toolName, toolInstance)
 					}
 				} else {
-					return fmt.Errorf("mcp server type '%s' not registered", config.serverName)
+					return configerr.Errorf("/server/name", "name of a registered mcp server", "mcp server type '%s' not registered", config.serverName)
 				}
 			}
 		}
 	} else {
-		return errors.New("either 'server' or 'toolSet' field must be present in the configuration")
+		return configerr.New("", "object with 'server' or 'toolSet'", errors.New("either 'server' or 'toolSet' field must be present in the configuration"))
+	}
+
+	// Parse recorder (optional, record tools/call invocations for replay)
+	if recorderJson := serverJson.Get("recorder"); recorderJson.Exists() && !config.isComposed {
+		var schemes map[string]SecurityScheme
+		if restServer, ok := config.server.(*RestMCPServer); ok {
+			schemes = restServer.securitySchemes
+		}
+		recorder, err := parseRecorder(config.serverName, recorderJson, schemes)
+		if err != nil {
+			return configerr.Prefix("/server/recorder", err)
+		}
+		recorder.setSensitiveArgs(config.server)
+		config.recorder = recorder
+	}
+
+	// Parse quota (optional, limit the tools/call invocations of every consumer)
+	if quotaJson := serverJson.Get("quota"); quotaJson.Exists() && !config.isComposed {
+		quota, err := parseQuota(config.serverName, quotaJson)
+		if err != nil {
+			return configerr.Prefix("/server/quota", err)
+		}
+		config.quota = quota
+	}
+
+	// Parse authorization (optional, grant the scopes required by tools to the callers)
+	if config.isComposed {
+		// The tools of a toolSet require the scopes of the tools they are taken from, which are only
+		// known once their servers are configured
+		authorization, err := parseAuthorization(toolSetJson.Get("authorization"), nil)
+		if err != nil {
+			return configerr.Prefix("/toolSet/authorization", err)
+		}
+		authorization.composed = config.server
+		config.authorization = authorization
+	} else if authorizationJson := serverJson.Get("authorization"); authorizationJson.Exists() || len(toolScopes) > 0 {
+		authorization, err := parseAuthorization(authorizationJson, toolScopes)
+		if err != nil {
+			return configerr.Prefix("/server/authorization", err)
+		}
+		config.authorization = authorization
+	}
+
+	// Parse sandbox (optional, limit the callouts and duration of every tools/call)
+	if sandboxJson := serverJson.Get("sandbox"); sandboxJson.Exists() {
+		sandbox, err := parseSandbox(sandboxJson)
+		if err != nil {
+			return configerr.Prefix("/server/sandbox", err)
+		}
+		config.sandbox = sandbox
+	}
+
+	// Parse validateOutput (optional, check structured tool results against the output schemas)
+	output, err := parseOutputValidation(serverJson)
+	if err != nil {
+		return configerr.Prefix("/server", err)
+	}
+	config.output = output
+
+	// Parse responseMode (optional, answer clients accepting text/event-stream with an event stream)
+	switch responseMode := serverJson.Get("responseMode").String(); responseMode {
+	case "", "json":
+	case "sse":
+		config.sseResponse = true
+		utils.RegisterSSEKeepAlive()
+	default:
+		return configerr.Errorf("/server/responseMode", `one of "json", "sse"`, "unknown response mode: %s", responseMode)
+	}
+
+	// Parse toolSource (optional, pull the tool definitions of a REST server from a config source)
+	if sourceJson := serverJson.Get("toolSource"); sourceJson.Exists() {
+		if _, ok := config.server.(*RestMCPServer); !ok {
+			return configerr.Errorf("/server/toolSource", "", "toolSource is only supported by REST servers")
+		}
+		toolSource, err := parseToolSource(config.serverName, sourceJson)
+		if err != nil {
+			return configerr.Prefix("/server/toolSource", err)
+		}
+		config.toolSource = toolSource
 	}
 
 	// Parse allowTools - this might need adjustment for composed servers
@@ -527,11 +811,18 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 				requestedVersion, negotiatedVersion)
 		}
 
+		capabilities := map[string]any{
+			"tools": map[string]any{},
+		}
+		if hasResources(config.server) {
+			capabilities["resources"] = map[string]any{}
+		}
+		if hasPrompts(config.server) {
+			capabilities["prompts"] = map[string]any{}
+		}
 		utils.OnMCPResponseSuccess(ctx, map[string]any{
 			"protocolVersion": negotiatedVersion,
-			"capabilities": map[string]any{
-				"tools": map[string]any{},
-			},
+			"capabilities":    capabilities,
 			"serverInfo": map[string]any{
 				"name":    currentServerNameForHandlers, // Use the actual server name (single or composed)
 				"version": "1.0.0",
@@ -547,9 +838,21 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 			proxyHandlers := CreateMcpProxyMethodHandlers(proxyServer, allowTools)
 			config.methodHandlers["tools/list"] = proxyHandlers["tools/list"]
 			config.methodHandlers["tools/call"] = proxyHandlers["tools/call"]
+		} else if aggregateServer, ok := config.server.(*McpAggregateServer); ok {
+			aggregateHandlers := CreateMcpAggregateMethodHandlers(aggregateServer, allowTools)
+			config.methodHandlers["tools/list"] = aggregateHandlers["tools/list"]
+			config.methodHandlers["tools/call"] = aggregateHandlers["tools/call"]
 		}
 	}
 
+	// Resource and prompt handlers for servers that expose them
+	if resourceServer, ok := config.server.(ResourceServer); ok {
+		addResourceMethodHandlers(config.methodHandlers, currentServerNameForHandlers, resourceServer)
+	}
+	if promptServer, ok := config.server.(PromptServer); ok {
+		addPromptMethodHandlers(config.methodHandlers, currentServerNameForHandlers, promptServer)
+	}
+
 	// Default tools/list handler for non-proxy servers
 	if config.methodHandlers["tools/list"] == nil {
 		config.methodHandlers["tools/list"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
@@ -569,6 +872,10 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 						continue
 					}
 				}
+				// Hide the tools the caller is not granted the scopes of
+				if !toolPermissionsOf(ctx).allows(toolFullName) {
+					continue
+				}
 				toolDef := map[string]any{
 					"name":        toolFullName,
 					"description": tool.Description(),
@@ -609,6 +916,14 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 			// Compute effective allowTools using helper function
 			effectiveAllowTools := computeEffectiveAllowTools(allowTools)
 
+			// Unknown tools are reported before the allowTools check, with the tools that may be called
+			tools := config.server.GetMCPTools()
+			toolToCall, ok := tools[toolName]
+			if !ok {
+				onUnknownTool(ctx, currentServerNameForHandlers, toolName, tools, effectiveAllowTools)
+				return nil
+			}
+
 			// Check if tool is allowed
 			if effectiveAllowTools != nil {
 				if _, allow := (*effectiveAllowTools)[toolName]; !allow {
@@ -620,13 +935,14 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 			proxywasm.SetProperty([]string{"mcp_server_name"}, []byte(currentServerNameForHandlers))
 			proxywasm.SetProperty([]string{"mcp_tool_name"}, []byte(toolName))
 
-			toolToCall, ok := config.server.GetMCPTools()[toolName]
-			if !ok {
-				utils.OnMCPResponseError(ctx, fmt.Errorf("unknown tool: %s", toolName), utils.ErrInvalidParams, fmt.Sprintf("mcp:%s:tools/call:invalid_tool_name", currentServerNameForHandlers))
-				return nil
+			if validator, ok := config.server.(argumentsValidator); ok && validator.ValidatesArguments() {
+				if err := validateToolArguments(toolToCall, args); err != nil {
+					onInvalidArguments(ctx, "mcp:"+currentServerNameForHandlers, err)
+					return nil
+				}
 			}
 
-			log.Debugf("Tool call [%s] on server [%s] with arguments[%s]", toolName, currentServerNameForHandlers, args.Raw)
+			log.Debugf("Tool call [%s] on server [%s] with arguments[%s]", toolName, currentServerNameForHandlers, redactArgs([]byte(args.Raw), sensitiveArgsOf(toolToCall), redactedArg))
 			toolInstance := toolToCall.Create([]byte(args.Raw))
 			err := toolInstance.Call(ctx, config.server) // Pass the single server instance
 			if err != nil {
@@ -637,6 +953,20 @@ func parseConfigCore(configJson gjson.Result, config *McpServerConfig, opts *Con
 		}
 	}
 
+	if config.output != nil && config.server != nil {
+		config.methodHandlers["tools/call"] = config.output.wrap(config.server, config.methodHandlers["tools/call"])
+	}
+	if config.sandbox != nil {
+		config.methodHandlers["tools/call"] = config.sandbox.wrap(config.methodHandlers["tools/call"])
+	}
+	if config.quota != nil {
+		config.methodHandlers["tools/call"] = config.quota.wrap(config.methodHandlers["tools/call"])
+	}
+	// The scopes are checked first, so that denied calls do not count against the quota
+	if config.authorization != nil {
+		config.authorization.wrap(config.methodHandlers)
+	}
+
 	return nil
 }
 
@@ -661,7 +991,52 @@ func parseConfig(context wrapper.PluginContext, configJson gjson.Result, config
 	}
 
 	// Call the core parsing logic
-	return parseConfigCore(configJson, config, opts)
+	if err := parseConfigCore(configJson, config, opts); err != nil {
+		return err
+	}
+	for _, proxyServer := range proxyServersOf(config.server) {
+		if proxyServer.GetSessionManager() != nil {
+			if store, ok := proxyServer.GetSessionManager().GetStore().(*RedisSessionStore); ok {
+				if err := store.init(); err != nil {
+					return err
+				}
+			}
+		}
+		if proxyServer.GetToolsListCache() != nil {
+			if err := proxyServer.GetToolsListCache().init(); err != nil {
+				return err
+			}
+		}
+	}
+	if config.quota != nil {
+		if err := config.quota.init(); err != nil {
+			return err
+		}
+	}
+	if config.recorder != nil {
+		if err := config.recorder.init(); err != nil {
+			return err
+		}
+	}
+	if config.toolSource != nil {
+		config.toolSource.start(config, configJson.Raw, opts)
+	}
+	return nil
+}
+
+// proxyServersOf returns the MCP proxy servers a server talks to, the backends of an aggregate server
+func proxyServersOf(server Server) []*McpProxyServer {
+	switch s := server.(type) {
+	case *McpProxyServer:
+		return []*McpProxyServer{s}
+	case *McpAggregateServer:
+		var servers []*McpProxyServer
+		for _, backend := range s.GetBackends() {
+			servers = append(servers, backend.Server)
+		}
+		return servers
+	}
+	return nil
 }
 
 func Load(options ...CtxOption) {
@@ -683,6 +1058,7 @@ func Initialize() {
 		wrapper.ProcessRequestBody(onHttpRequestBody),
 		wrapper.ProcessResponseHeaders(onHttpResponseHeaders),
 		wrapper.ProcessStreamingResponseBody(onHttpStreamingResponseBody),
+		wrapper.ProcessStreamDone(onHttpStreamDone),
 		wrapper.WithRebuildMaxMemBytes[McpServerConfig](200*1024*1024),
 	)
 }
@@ -736,6 +1112,7 @@ func StoreServerState(ctx wrapper.HttpContext, config any) {
 }
 
 func onHttpRequestHeaders(ctx wrapper.HttpContext, config McpServerConfig) types.Action {
+	config = config.resolve(ctx)
 	ctx.DisableReroute()
 	ctx.SetRequestBodyBufferLimit(DefaultMaxBodyBytes)
 	ctx.SetResponseBodyBufferLimit(DefaultMaxBodyBytes)
@@ -743,6 +1120,7 @@ func onHttpRequestHeaders(ctx wrapper.HttpContext, config McpServerConfig) types
 	// Remove accept-encoding header to prevent backend from compressing the response
 	// This ensures we can properly process and modify the response body
 	proxywasm.RemoveHttpRequestHeader("accept-encoding")
+	takeMockHeader(ctx)
 
 	// Parse MCP-Protocol-Version header and store in context
 	// This allows clients to specify the MCP protocol version via HTTP header
@@ -752,6 +1130,7 @@ func onHttpRequestHeaders(ctx wrapper.HttpContext, config McpServerConfig) types
 		// Validate the protocol version against supported versions
 		if slices.Contains(SupportedMCPVersions, protocolVersion) {
 			log.Debugf("MCP Protocol Version set from header: %s", protocolVersion)
+			ctx.SetContext(ctxKeyProtocolVersion, protocolVersion)
 		} else {
 			log.Warnf("Unsupported MCP Protocol Version in header: %s", protocolVersion)
 		}
@@ -760,6 +1139,12 @@ func onHttpRequestHeaders(ctx wrapper.HttpContext, config McpServerConfig) types
 		proxywasm.RemoveHttpRequestHeader("MCP-Protocol-Version")
 	}
 
+	if config.sseResponse {
+		if accept, _ := proxywasm.GetHttpRequestHeader("accept"); utils.AcceptsSSE(accept) {
+			utils.EnableSSEResponse(ctx)
+		}
+	}
+
 	if ctx.Method() == "GET" {
 		proxywasm.SendHttpResponseWithDetail(405, "not_support_sse_on_this_endpoint", nil, nil, -1)
 		return types.HeaderStopAllIterationAndWatermark
@@ -781,6 +1166,10 @@ func onHttpRequestHeaders(ctx wrapper.HttpContext, config McpServerConfig) types
 }
 
 func onHttpRequestBody(ctx wrapper.HttpContext, config McpServerConfig, body []byte) types.Action {
+	config = config.resolve(ctx)
+	if config.recorder != nil {
+		config.recorder.start(ctx, body)
+	}
 	return utils.HandleJsonRpcMethod(ctx, body, config.methodHandlers)
 }
 
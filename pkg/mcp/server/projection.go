@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// fieldProjection is the tree of the fields kept from a JSON response, a leaf keeps the whole value
+type fieldProjection map[string]fieldProjection
+
+// parseFieldProjection parses the paths of the fields to keep, e.g. ["id", "items.#.name"], where
+// # selects every element of an array and \. escapes a dot in a key
+func parseFieldProjection(fields []string) (fieldProjection, error) {
+	root := fieldProjection{}
+	for _, field := range fields {
+		segments := splitFieldPath(field)
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("responseTemplate.fields contains an empty path")
+		}
+		node := root
+		for i, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid responseTemplate.fields path %q", field)
+			}
+			child, ok := node[segment]
+			if ok && child == nil {
+				// A parent of the field is already kept whole
+				break
+			}
+			if i == len(segments)-1 {
+				node[segment] = nil
+				break
+			}
+			if !ok {
+				child = fieldProjection{}
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	return root, nil
+}
+
+// splitFieldPath splits a path on the dots not escaped with a backslash
+func splitFieldPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var segments []string
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			current.WriteByte(path[i])
+		case path[i] == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+	return append(segments, current.String())
+}
+
+// project returns the JSON body reduced to the fields of the projection, keeping the order of the
+// body. Bodies that are not JSON objects or arrays are returned as they are.
+func (p fieldProjection) project(body []byte) []byte {
+	value := gjson.ParseBytes(body)
+	if len(p) == 0 || !gjson.ValidBytes(body) || !(value.IsObject() || value.IsArray()) {
+		return body
+	}
+	var out bytes.Buffer
+	p.write(&out, value)
+	return out.Bytes()
+}
+
+func (p fieldProjection) write(out *bytes.Buffer, value gjson.Result) {
+	switch {
+	case p == nil:
+		out.WriteString(value.Raw)
+	case value.IsArray():
+		// Arrays are projected element by element with the fields under #
+		elements, ok := p["#"]
+		if !ok {
+			out.WriteString("[]")
+			return
+		}
+		out.WriteByte('[')
+		for i, element := range value.Array() {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			elements.write(out, element)
+		}
+		out.WriteByte(']')
+	case value.IsObject():
+		out.WriteByte('{')
+		first := true
+		value.ForEach(func(key, member gjson.Result) bool {
+			child, ok := p[key.String()]
+			if !ok {
+				return true
+			}
+			if !first {
+				out.WriteByte(',')
+			}
+			first = false
+			out.WriteString(key.Raw)
+			out.WriteByte(':')
+			child.write(out, member)
+			return true
+		})
+		out.WriteByte('}')
+	default:
+		// A scalar where an object or array was expected is kept
+		out.WriteString(value.Raw)
+	}
+}
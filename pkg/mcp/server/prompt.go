@@ -0,0 +1,225 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	template "github.com/higress-group/gjson_template"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// PromptArgument describes an argument accepted by a prompt
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// PromptInfo describes a prompt in prompts/list
+type PromptInfo struct {
+	Name        string           `json:"name"`
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptMessage is a text message of a prompts/get result
+type PromptMessage struct {
+	Role string `json:"role"` // "user" or "assistant"
+	Text string `json:"text"`
+}
+
+// PromptResult is the result of prompts/get
+type PromptResult struct {
+	Description string
+	Messages    []PromptMessage
+}
+
+// Prompt is a prompt template offered to clients. Required arguments are checked against
+// Info().Arguments before Get is called.
+type Prompt interface {
+	Info() PromptInfo
+	Get(httpCtx HttpContext, server Server, arguments map[string]string) (PromptResult, error)
+}
+
+// PromptServer is an optional interface for servers that expose prompts.
+// Servers built on BaseMCPServer can implement it by delegating to the base server.
+type PromptServer interface {
+	Server
+	AddMCPPrompt(prompt Prompt) Server
+	GetMCPPrompts() map[string]Prompt // Keyed by prompt name
+}
+
+// TemplatePrompt is a prompt whose messages are rendered from templates, with the arguments
+// under .args and the server config under .config, e.g. "Review {{.args.language}} code".
+// It is used for prompts configured for REST MCP servers and can be registered on any
+// PromptServer after NewTemplatePrompt has parsed it.
+type TemplatePrompt struct {
+	Name        string                  `json:"name"`
+	Title       string                  `json:"title,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	Arguments   []PromptArgument        `json:"arguments,omitempty"`
+	Messages    []TemplatePromptMessage `json:"messages"`
+
+	parsedMessages []*template.Template
+}
+
+// TemplatePromptMessage is a message of a TemplatePrompt, the text is a template
+type TemplatePromptMessage struct {
+	Role string `json:"role"`
+	Text string `json:"text"`
+}
+
+// NewTemplatePrompt validates the prompt and parses its message templates
+func NewTemplatePrompt(prompt TemplatePrompt) (*TemplatePrompt, error) {
+	if prompt.Name == "" {
+		return nil, errors.New("prompt name cannot be empty")
+	}
+	if len(prompt.Messages) == 0 {
+		return nil, errors.New("prompt must have at least one message")
+	}
+	argNames := make(map[string]bool, len(prompt.Arguments))
+	for _, arg := range prompt.Arguments {
+		if arg.Name == "" {
+			return nil, errors.New("prompt argument name cannot be empty")
+		}
+		if argNames[arg.Name] {
+			return nil, fmt.Errorf("duplicate prompt argument: %s", arg.Name)
+		}
+		argNames[arg.Name] = true
+	}
+	prompt.parsedMessages = make([]*template.Template, 0, len(prompt.Messages))
+	for i, message := range prompt.Messages {
+		if message.Role != "user" && message.Role != "assistant" {
+			return nil, fmt.Errorf("invalid role of message %d: %q, must be user or assistant", i, message.Role)
+		}
+		tmpl, err := template.New(fmt.Sprintf("message_%d", i)).Funcs(templateFuncs()).Parse(message.Text)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template of message %d: %v", i, err)
+		}
+		prompt.parsedMessages = append(prompt.parsedMessages, tmpl)
+	}
+	return &prompt, nil
+}
+
+// Info implements Prompt interface
+func (p *TemplatePrompt) Info() PromptInfo {
+	return PromptInfo{
+		Name:        p.Name,
+		Title:       p.Title,
+		Description: p.Description,
+		Arguments:   p.Arguments,
+	}
+}
+
+// Get implements Prompt interface
+func (p *TemplatePrompt) Get(httpCtx HttpContext, server Server, arguments map[string]string) (PromptResult, error) {
+	if len(p.parsedMessages) != len(p.Messages) {
+		return PromptResult{}, fmt.Errorf("prompt %s is not parsed, create it with NewTemplatePrompt", p.Name)
+	}
+	var serverConfig map[string]any
+	server.GetConfig(&serverConfig)
+	var templateDataBytes []byte
+	templateDataBytes, _ = sjson.SetBytes(templateDataBytes, "config", serverConfig)
+	templateDataBytes, _ = sjson.SetBytes(templateDataBytes, "args", arguments)
+	result := PromptResult{Description: p.Description}
+	for i, tmpl := range p.parsedMessages {
+		text, err := executeTemplate(tmpl, templateDataBytes)
+		if err != nil {
+			return PromptResult{}, fmt.Errorf("error executing template of message %d: %v", i, err)
+		}
+		result.Messages = append(result.Messages, PromptMessage{Role: p.Messages[i].Role, Text: text})
+	}
+	return result, nil
+}
+
+// hasPrompts returns whether the server exposes any prompts
+func hasPrompts(server Server) bool {
+	promptServer, ok := server.(PromptServer)
+	return ok && len(promptServer.GetMCPPrompts()) > 0
+}
+
+// addPromptMethodHandlers adds the prompts/list and prompts/get handlers
+func addPromptMethodHandlers(handlers utils.MethodHandlers, serverName string, server PromptServer) {
+	handlers["prompts/list"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		prompts := server.GetMCPPrompts()
+		names := make([]string, 0, len(prompts))
+		for name := range prompts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		listed := make([]PromptInfo, 0, len(names))
+		for _, name := range names {
+			listed = append(listed, prompts[name].Info())
+		}
+		utils.OnMCPResponseSuccess(ctx, map[string]any{
+			"prompts": listed,
+		}, fmt.Sprintf("mcp:%s:prompts/list", serverName))
+		return nil
+	}
+	handlers["prompts/get"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		name := params.Get("name").String()
+		prompt, ok := server.GetMCPPrompts()[name]
+		if !ok {
+			utils.OnMCPResponseError(ctx, fmt.Errorf("unknown prompt: %s", name), utils.ErrInvalidParams, fmt.Sprintf("mcp:%s:prompts/get:invalid_prompt_name", serverName))
+			return nil
+		}
+		arguments := make(map[string]string)
+		params.Get("arguments").ForEach(func(key, value gjson.Result) bool {
+			arguments[key.String()] = value.String()
+			return true
+		})
+		for _, arg := range prompt.Info().Arguments {
+			if _, exist := arguments[arg.Name]; arg.Required && !exist {
+				utils.OnMCPResponseError(ctx, fmt.Errorf("missing required argument: %s", arg.Name), utils.ErrInvalidParams, fmt.Sprintf("mcp:%s:prompts/get:missing_argument", serverName))
+				return nil
+			}
+		}
+		result, err := prompt.Get(ctx, server, arguments)
+		if err != nil {
+			log.Errorf("failed to get prompt %s: %v", name, err)
+			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, fmt.Sprintf("mcp:%s:prompts/get:error", serverName))
+			return nil
+		}
+		utils.OnMCPResponseSuccess(ctx, promptResultToMap(result), fmt.Sprintf("mcp:%s:prompts/get", serverName))
+		return nil
+	}
+}
+
+func promptResultToMap(result PromptResult) map[string]any {
+	messages := make([]map[string]any, 0, len(result.Messages))
+	for _, message := range result.Messages {
+		messages = append(messages, map[string]any{
+			"role": message.Role,
+			"content": map[string]any{
+				"type": "text",
+				"text": message.Text,
+			},
+		})
+	}
+	response := map[string]any{"messages": messages}
+	if result.Description != "" {
+		response["description"] = result.Description
+	}
+	return response
+}
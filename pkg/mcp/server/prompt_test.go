@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+// TestRestPromptsConfig tests prompts configured for a REST MCP server
+func TestRestPromptsConfig(t *testing.T) {
+	defer startTestHttpContext("prompt-test")()
+
+	config := &McpServerConfig{}
+	err := parseConfigCore(gjson.Parse(`{
+		"server": {"name": "review-server", "config": {"style": "concise"}},
+		"prompts": [{
+			"name": "code_review",
+			"description": "Review code",
+			"arguments": [{"name": "language", "required": true}, {"name": "focus"}],
+			"messages": [
+				{"role": "user", "text": "Review this {{.args.language}} code, be {{.config.style}}.{{if .args.focus}} Focus on {{.args.focus}}.{{end}}"},
+				{"role": "assistant", "text": "Sure."}
+			]
+		}]
+	}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+	assert.NoError(t, err)
+	assert.True(t, hasPrompts(config.server))
+	assert.False(t, hasResources(config.server))
+	assert.NotNil(t, config.methodHandlers["prompts/list"])
+	assert.NotNil(t, config.methodHandlers["prompts/get"])
+
+	server := config.server.(PromptServer)
+	prompt := server.GetMCPPrompts()["code_review"]
+	assert.Equal(t, []PromptArgument{{Name: "language", Required: true}, {Name: "focus"}}, prompt.Info().Arguments)
+
+	result, err := prompt.Get(nil, server, map[string]string{"language": "Go", "focus": "errors"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"description": "Review code",
+		"messages": []map[string]any{
+			{"role": "user", "content": map[string]any{"type": "text", "text": "Review this Go code, be concise. Focus on errors."}},
+			{"role": "assistant", "content": map[string]any{"type": "text", "text": "Sure."}},
+		},
+	}, promptResultToMap(result))
+
+	result, err = prompt.Get(nil, server, map[string]string{"language": "Rust"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Review this Rust code, be concise.", result.Messages[0].Text)
+}
+
+// TestNewTemplatePrompt tests validation of template prompts
+func TestNewTemplatePrompt(t *testing.T) {
+	message := []TemplatePromptMessage{{Role: "user", Text: "hello"}}
+	_, err := NewTemplatePrompt(TemplatePrompt{Name: "greet", Messages: message})
+	assert.NoError(t, err)
+
+	for name, prompt := range map[string]TemplatePrompt{
+		"missing name":       {Messages: message},
+		"no messages":        {Name: "greet"},
+		"invalid role":       {Name: "greet", Messages: []TemplatePromptMessage{{Role: "system", Text: "hello"}}},
+		"invalid template":   {Name: "greet", Messages: []TemplatePromptMessage{{Role: "user", Text: "{{"}}},
+		"duplicate argument": {Name: "greet", Messages: message, Arguments: []PromptArgument{{Name: "a"}, {Name: "a"}}},
+	} {
+		_, err := NewTemplatePrompt(prompt)
+		assert.Error(t, err, name)
+	}
+
+	_, err = (&TemplatePrompt{Name: "greet", Messages: message}).Get(nil, nil, nil)
+	assert.Error(t, err, "prompts must be created with NewTemplatePrompt")
+}
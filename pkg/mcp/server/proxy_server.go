@@ -17,9 +17,14 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
 	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
 	"github.com/higress-group/wasm-go/pkg/wrapper"
 )
 
@@ -54,9 +59,63 @@ type McpProxyToolConfig struct {
 	Name            string              `json:"name"`
 	Description     string              `json:"description"`
 	Security        SecurityRequirement `json:"security,omitempty"` // Tool-level security for MCP Client to MCP Server
+	Scopes          []string            `json:"scopes,omitempty"`   // Scopes the caller must be granted to list and call the tool, see AuthorizationConfig
 	Args            []ToolArg           `json:"args"`
 	OutputSchema    map[string]any      `json:"outputSchema,omitempty"` // Output schema for MCP Protocol Version 2025-06-18
 	RequestTemplate RequestTemplate     `json:"requestTemplate,omitempty"`
+	// ExposeAs is the name the backend tool is listed and called as by clients, its backend name is hidden
+	ExposeAs string `json:"exposeAs,omitempty"`
+	// DescriptionOverride replaces the descriptions of the backend tool in tools/list responses
+	DescriptionOverride *DescriptionOverride `json:"descriptionOverride,omitempty"`
+	// InjectArgs are merged into the arguments of the client before tools/call is forwarded
+	InjectArgs []InjectedArg `json:"injectArgs,omitempty"`
+
+	// Compiled patterns of the argument and output schemas (not from JSON)
+	patterns schemaPatterns
+}
+
+// ExposedName returns the name clients list and call the tool with
+func (c McpProxyToolConfig) ExposedName() string {
+	if c.ExposeAs != "" {
+		return c.ExposeAs
+	}
+	return c.Name
+}
+
+// DescriptionOverride replaces the description of a backend tool and the descriptions of its arguments, e.g.
+//
+//	{"description": "Search the product catalog", "args": {"q": "Keywords to search"}}
+//
+// A string replaces the description of the tool only.
+type DescriptionOverride struct {
+	Description string            `json:"description,omitempty"`
+	Args        map[string]string `json:"args,omitempty"` // Descriptions of the properties of the input schema by name
+}
+
+// UnmarshalJSON accepts the description of the tool as a string
+func (o *DescriptionOverride) UnmarshalJSON(data []byte) error {
+	var description string
+	if err := json.Unmarshal(data, &description); err == nil {
+		o.Description = description
+		return nil
+	}
+	type plain DescriptionOverride
+	return json.Unmarshal(data, (*plain)(o))
+}
+
+// apply replaces the descriptions of a raw tool of a tools/list result, arguments missing from its input schema
+// are left out
+func (o *DescriptionOverride) apply(tool []byte) []byte {
+	if o.Description != "" {
+		tool, _ = sjson.SetBytes(tool, "description", o.Description)
+	}
+	for arg, description := range o.Args {
+		path := "inputSchema.properties." + gjson.Escape(arg)
+		if gjson.GetBytes(tool, path).IsObject() {
+			tool, _ = sjson.SetBytes(tool, path+".description", description)
+		}
+	}
+	return tool
 }
 
 // RequestTemplate defines request template configuration for proxy tools
@@ -68,14 +127,22 @@ type RequestTemplate struct {
 type McpProxyServer struct {
 	Name                      string
 	base                      BaseMCPServer
-	toolsConfig               map[string]McpProxyToolConfig
+	toolsConfig               map[string]McpProxyToolConfig // Configured tools by the name they are exposed as
+	renamedTools              map[string]string             // Names the tools renamed with exposeAs are exposed as, by backend name
+	rewritesToolsList         bool                          // Set when tools are renamed or their descriptions overridden
 	securitySchemes           map[string]SecurityScheme
-	defaultDownstreamSecurity SecurityRequirement // Default client-to-gateway authentication
-	defaultUpstreamSecurity   SecurityRequirement // Default gateway-to-backend authentication
-	mcpServerURL              string              // Backend MCP server URL
-	timeout                   int                 // Request timeout in milliseconds
-	transport                 TransportProtocol   // Transport protocol (http or sse)
-	passthroughAuthHeader     bool                // If true, pass through Authorization header even without downstream security
+	defaultDownstreamSecurity SecurityRequirement     // Default client-to-gateway authentication
+	defaultUpstreamSecurity   SecurityRequirement     // Default gateway-to-backend authentication
+	mcpServerURL              string                  // Backend MCP server URL
+	timeout                   int                     // Request timeout in milliseconds
+	transport                 TransportProtocol       // Transport protocol (http or sse)
+	passthroughAuthHeader     bool                    // If true, pass through Authorization header even without downstream security
+	errorCodeMapping          utils.StatusCodeMapping // Backend HTTP status to JSON-RPC error code overrides
+	backendSession            BackendSessionConfig    // Backend session persistence and keep-alive settings
+	sessionManager            *McpSessionManagerImpl  // Persisted backend sessions, nil unless backendSession.persist is set
+	toolsListCache            *ToolsListCache         // Cache of the backend tools/list result, nil unless toolsListCache is set
+	backendPool               *BackendPool            // Backends the requests are balanced over, nil unless mcpServerURL lists several
+	validateArguments         bool                    // Whether tools/call arguments are validated against the input schema of configured tools
 }
 
 // NewMcpProxyServer creates a new MCP proxy server
@@ -84,6 +151,7 @@ func NewMcpProxyServer(name string) *McpProxyServer {
 		Name:            name,
 		base:            NewBaseMCPServer(),
 		toolsConfig:     make(map[string]McpProxyToolConfig),
+		renamedTools:    make(map[string]string),
 		securitySchemes: make(map[string]SecurityScheme),
 	}
 }
@@ -132,6 +200,20 @@ func (s *McpProxyServer) GetMcpServerURL() string {
 	return s.mcpServerURL
 }
 
+// SetBackendPool balances the requests over the backends of the pool, the first backend is used as
+// the mcpServerURL of the server, e.g. as the key of its cached tool list
+func (s *McpProxyServer) SetBackendPool(pool *BackendPool) {
+	s.backendPool = pool
+	if pool != nil && len(pool.backends) > 0 {
+		s.mcpServerURL = pool.backends[0].URL
+	}
+}
+
+// GetBackendPool returns the pool of backends, nil when the server has a single backend
+func (s *McpProxyServer) GetBackendPool() *BackendPool {
+	return s.backendPool
+}
+
 // SetTimeout sets the request timeout in milliseconds
 func (s *McpProxyServer) SetTimeout(timeout int) {
 	s.timeout = timeout
@@ -152,16 +234,101 @@ func (s *McpProxyServer) GetTransport() TransportProtocol {
 	return s.transport
 }
 
+// SetErrorCodeMapping sets the backend HTTP status to JSON-RPC error code mapping
+func (s *McpProxyServer) SetErrorCodeMapping(mapping utils.StatusCodeMapping) {
+	s.errorCodeMapping = mapping
+}
+
+// SetValidateArguments sets whether the arguments of tools/call are validated against the input schema of
+// configured tools, tools without a config are validated by the backend only
+func (s *McpProxyServer) SetValidateArguments(validate bool) {
+	s.validateArguments = validate
+}
+
+// ValidatesArguments returns whether the arguments of tools/call are validated against the input schema
+func (s *McpProxyServer) ValidatesArguments() bool {
+	return s.validateArguments
+}
+
+// GetErrorCodeMapping gets the backend HTTP status to JSON-RPC error code mapping
+func (s *McpProxyServer) GetErrorCodeMapping() utils.StatusCodeMapping {
+	return s.errorCodeMapping
+}
+
+// SetBackendSession sets the backend session configuration, enabling session persistence and
+// keep-alive pings when configured
+func (s *McpProxyServer) SetBackendSession(config BackendSessionConfig) {
+	s.backendSession = config
+	if !config.Persist {
+		s.sessionManager = nil
+		return
+	}
+	s.sessionManager = NewMcpSessionManagerImpl(s.Name, config.idleTimeout())
+	s.sessionManager.SetCredentialSecret(config.CredentialSecret)
+	s.startSessionKeepAlive()
+}
+
+// GetBackendSession gets the backend session configuration
+func (s *McpProxyServer) GetBackendSession() BackendSessionConfig {
+	return s.backendSession
+}
+
+// GetSessionManager returns the manager of persisted backend sessions, or nil when sessions are not persisted
+func (s *McpProxyServer) GetSessionManager() *McpSessionManagerImpl {
+	return s.sessionManager
+}
+
+// newProtocolHandler creates a protocol handler configured from the server fields
+func (s *McpProxyServer) newProtocolHandler() *McpProtocolHandler {
+	handler := NewMcpProtocolHandler(s.GetMcpServerURL(), s.GetTimeout())
+	handler.SetErrorCodeMapping(s.GetErrorCodeMapping())
+	handler.SetTransport(s.GetTransport())
+	handler.proxyServer = s
+	if s.backendPool != nil {
+		handler.backend = s.backendPool.Select()
+		handler.backendURL = handler.backend.URL
+		handler.pool = s.backendPool
+	}
+	if s.sessionManager != nil {
+		handler.SetSessionManager(s.sessionManager)
+	} else if s.backendSession.DeleteOnComplete {
+		handler.SetDeleteSessionOnComplete(true)
+	}
+	return handler
+}
+
 // AddMCPTool implements Server interface
 func (s *McpProxyServer) AddMCPTool(name string, tool Tool) Server {
 	s.base.AddMCPTool(name, tool)
 	return s
 }
 
-// AddProxyTool adds a proxy tool configuration
+// AddProxyTool adds a proxy tool configuration, the tool is registered with the name it is exposed as
 func (s *McpProxyServer) AddProxyTool(toolConfig McpProxyToolConfig) error {
-	s.toolsConfig[toolConfig.Name] = toolConfig
-	s.base.AddMCPTool(toolConfig.Name, &McpProxyTool{
+	exposedName := toolConfig.ExposedName()
+	if _, exists := s.toolsConfig[exposedName]; exists {
+		return fmt.Errorf("tool %s is configured more than once", exposedName)
+	}
+	if exposedName != toolConfig.Name {
+		if _, exists := s.renamedTools[toolConfig.Name]; exists {
+			return fmt.Errorf("backend tool %s is exposed more than once", toolConfig.Name)
+		}
+		s.renamedTools[toolConfig.Name] = exposedName
+		s.rewritesToolsList = true
+	}
+	if toolConfig.DescriptionOverride != nil {
+		s.rewritesToolsList = true
+	}
+	if err := parseInjectedArgs(toolConfig.InjectArgs); err != nil {
+		return err
+	}
+	patterns, err := compileToolPatterns(toolConfig.Args, toolConfig.OutputSchema)
+	if err != nil {
+		return err
+	}
+	toolConfig.patterns = patterns
+	s.toolsConfig[exposedName] = toolConfig
+	s.base.AddMCPTool(exposedName, &McpProxyTool{
 		serverName: s.Name,
 		name:       toolConfig.Name,
 		toolConfig: toolConfig,
@@ -187,29 +354,89 @@ func (s *McpProxyServer) GetConfig(v any) {
 // Clone implements Server interface
 func (s *McpProxyServer) Clone() Server {
 	newServer := &McpProxyServer{
-		Name:            s.Name,
-		base:            s.base.CloneBase(),
-		toolsConfig:     make(map[string]McpProxyToolConfig),
-		securitySchemes: make(map[string]SecurityScheme),
+		Name:                      s.Name,
+		base:                      s.base.CloneBase(),
+		toolsConfig:               make(map[string]McpProxyToolConfig, len(s.toolsConfig)),
+		renamedTools:              maps.Clone(s.renamedTools),
+		rewritesToolsList:         s.rewritesToolsList,
+		securitySchemes:           cloneSecuritySchemes(s.securitySchemes),
+		defaultDownstreamSecurity: s.defaultDownstreamSecurity,
+		defaultUpstreamSecurity:   s.defaultUpstreamSecurity,
+		mcpServerURL:              s.mcpServerURL,
+		timeout:                   s.timeout,
+		transport:                 s.transport,
+		passthroughAuthHeader:     s.passthroughAuthHeader,
+		errorCodeMapping:          maps.Clone(s.errorCodeMapping),
+		backendSession:            s.backendSession,
+		// The clones share the backend sessions, the cached tools/list result and the health of the backends
+		sessionManager:    s.sessionManager,
+		toolsListCache:    s.toolsListCache,
+		backendPool:       s.backendPool,
+		validateArguments: s.validateArguments,
 	}
-	for k, v := range s.toolsConfig {
-		newServer.toolsConfig[k] = v
+	if newServer.renamedTools == nil {
+		newServer.renamedTools = make(map[string]string)
 	}
-	// Deep copy securitySchemes
-	if s.securitySchemes != nil {
-		for k, v := range s.securitySchemes {
-			newServer.securitySchemes[k] = v
-		}
+	for k, v := range s.toolsConfig {
+		newServer.toolsConfig[k] = v.clone()
 	}
 	return newServer
 }
 
-// GetToolConfig returns the proxy tool configuration for a given tool name
+// GetToolConfig returns the proxy tool configuration for the name a tool is exposed as
 func (s *McpProxyServer) GetToolConfig(name string) (McpProxyToolConfig, bool) {
 	config, ok := s.toolsConfig[name]
 	return config, ok
 }
 
+// backendToolName returns the backend name of the tool a client calls, false for the backend name of a renamed
+// tool, which is not exposed
+func (s *McpProxyServer) backendToolName(name string) (string, bool) {
+	if config, ok := s.toolsConfig[name]; ok {
+		return config.Name, true
+	}
+	if _, renamed := s.renamedTools[name]; renamed {
+		return "", false
+	}
+	return name, true
+}
+
+// exposeTools renames the tools of a tools/list result of the backend and overrides their descriptions as
+// configured. A backend tool having the name another tool is exposed as is left out.
+func (s *McpProxyServer) exposeTools(result gjson.Result) gjson.Result {
+	tools := result.Get("tools")
+	if !s.rewritesToolsList || !tools.IsArray() {
+		return result
+	}
+	exposed := []byte{'['}
+	for _, tool := range tools.Array() {
+		raw := []byte(tool.Raw)
+		name := tool.Get("name").String()
+		exposedName, renamed := s.renamedTools[name]
+		if renamed {
+			raw, _ = sjson.SetBytes(raw, "name", exposedName)
+		} else if config, ok := s.toolsConfig[name]; ok && config.Name != name {
+			continue
+		} else {
+			exposedName = name
+		}
+		if config, ok := s.toolsConfig[exposedName]; ok && config.DescriptionOverride != nil {
+			raw = config.DescriptionOverride.apply(raw)
+		}
+		if len(exposed) > 1 {
+			exposed = append(exposed, ',')
+		}
+		exposed = append(exposed, raw...)
+	}
+	exposed = append(exposed, ']')
+	raw, err := sjson.SetRawBytes([]byte(result.Raw), "tools", exposed)
+	if err != nil {
+		log.Errorf("Failed to rewrite tools/list result: %v", err)
+		return result
+	}
+	return gjson.ParseBytes(raw)
+}
+
 // SetPassthroughAuthHeader sets the passthrough auth header flag
 func (s *McpProxyServer) SetPassthroughAuthHeader(passthrough bool) {
 	s.passthroughAuthHeader = passthrough
@@ -226,38 +453,10 @@ func (s *McpProxyServer) ForwardToolsList(ctx HttpContext, cursor *string) error
 
 	// Handle default downstream security for tools/list requests
 	// tools/list requests use server-level default authentication configuration
-	passthroughCredential := ""
-	downstreamSecurity := s.GetDefaultDownstreamSecurity()
-	if downstreamSecurity.ID != "" {
-		clientScheme, schemeOk := s.GetSecurityScheme(downstreamSecurity.ID)
-		if !schemeOk {
-			log.Warnf("Default downstream security scheme ID '%s' not found for tools/list request.", downstreamSecurity.ID)
-		} else {
-			// Extract and remove the credential from the incoming request
-			extractedCred, err := ExtractAndRemoveIncomingCredential(clientScheme)
-			if err != nil {
-				log.Warnf("Failed to extract/remove incoming credential for tools/list using scheme %s: %v", clientScheme.ID, err)
-			} else if extractedCred == "" {
-				log.Debugf("No incoming credential found for tools/list using scheme %s for extraction/removal.", clientScheme.ID)
-			}
-
-			// Only use passthrough if explicitly configured
-			if downstreamSecurity.Passthrough && extractedCred != "" {
-				passthroughCredential = extractedCred
-				log.Debugf("Passthrough credential set for tools/list request.")
-			}
-		}
-	} else {
-		// Fallback: Remove Authorization header if no downstream security is defined
-		// This prevents downstream credentials from being mistakenly passed to upstream
-		// Unless passthroughAuthHeader is explicitly set to true
-		if !s.GetPassthroughAuthHeader() {
-			proxywasm.RemoveHttpRequestHeader("Authorization")
-		}
-	}
+	passthroughCredential := extractDownstreamCredential(s.GetDefaultDownstreamSecurity(), s.GetSecurityScheme, s.GetPassthroughAuthHeader(), "tools/list request")
 
 	// Create protocol handler using server fields
-	handler := NewMcpProtocolHandler(s.GetMcpServerURL(), s.GetTimeout())
+	handler := s.newProtocolHandler()
 
 	// Prepare authentication information for gateway-to-backend communication
 	var authInfo *ProxyAuthInfo
@@ -270,8 +469,46 @@ func (s *McpProxyServer) ForwardToolsList(ctx HttpContext, cursor *string) error
 		}
 	}
 
-	// This will handle initialization asynchronously if needed and use ActionPause/Resume
-	return handler.ForwardToolsList(wrapperCtx, cursor, authInfo)
+	forward := func() error {
+		// This will handle initialization asynchronously if needed and use ActionPause/Resume
+		return handler.ForwardToolsList(wrapperCtx, cursor, authInfo)
+	}
+	// Only the first page of the tool list is cached
+	if s.toolsListCache != nil && (cursor == nil || *cursor == "") {
+		return s.toolsListCache.serve(wrapperCtx, s.GetMcpServerURL(), forward)
+	}
+	return forward()
+}
+
+// extractDownstreamCredential removes the credential of the downstream security from the incoming request and
+// returns it when the security passes it through to the backend. Without downstream security the Authorization
+// header is removed, unless passthroughAuthHeader is set, so that downstream credentials are not mistakenly
+// passed to upstream
+func extractDownstreamCredential(security SecurityRequirement, getScheme func(string) (SecurityScheme, bool), passthroughAuthHeader bool, subject string) string {
+	if security.ID == "" {
+		if !passthroughAuthHeader {
+			proxywasm.RemoveHttpRequestHeader("Authorization")
+		}
+		return ""
+	}
+	clientScheme, schemeOk := getScheme(security.ID)
+	if !schemeOk {
+		log.Warnf("Downstream security scheme ID '%s' not found for %s.", security.ID, subject)
+		return ""
+	}
+	// Extract and remove the credential from the incoming request
+	extractedCred, err := ExtractAndRemoveIncomingCredential(clientScheme)
+	if err != nil {
+		log.Warnf("Failed to extract/remove incoming credential for %s using scheme %s: %v", subject, clientScheme.ID, err)
+	} else if extractedCred == "" {
+		log.Debugf("No incoming credential found for %s using scheme %s for extraction/removal.", subject, clientScheme.ID)
+	}
+	// Only use passthrough if explicitly configured
+	if security.Passthrough && extractedCred != "" {
+		log.Debugf("Passthrough credential set for %s.", subject)
+		return extractedCred
+	}
+	return ""
 }
 
 // McpProxyTool implements Tool interface for MCP-to-MCP proxy
@@ -298,6 +535,11 @@ func (t *McpProxyTool) Create(params []byte) Tool {
 	return newTool
 }
 
+// Scopes implements ToolWithScopes interface
+func (t *McpProxyTool) Scopes() []string {
+	return t.toolConfig.Scopes
+}
+
 // Call implements Tool interface - this is where the MCP protocol handling happens
 func (t *McpProxyTool) Call(httpCtx HttpContext, server Server) error {
 	ctx := httpCtx.(wrapper.HttpContext)
@@ -310,7 +552,6 @@ func (t *McpProxyTool) Call(httpCtx HttpContext, server Server) error {
 
 	// Handle tool-level or default downstream security: extract credential for passthrough if configured
 	// toolConfig.Security represents client-to-gateway authentication, falls back to server's defaultDownstreamSecurity
-	passthroughCredential := ""
 	var downstreamSecurity SecurityRequirement
 	if t.toolConfig.Security.ID != "" {
 		// Use tool-level security if configured
@@ -324,36 +565,10 @@ func (t *McpProxyTool) Call(httpCtx HttpContext, server Server) error {
 		}
 	}
 
-	if downstreamSecurity.ID != "" {
-		clientScheme, schemeOk := proxyServer.GetSecurityScheme(downstreamSecurity.ID)
-		if !schemeOk {
-			log.Warnf("Downstream security scheme ID '%s' not found for tool %s.", downstreamSecurity.ID, t.name)
-		} else {
-			// Extract and remove the credential from the incoming request
-			extractedCred, err := ExtractAndRemoveIncomingCredential(clientScheme)
-			if err != nil {
-				log.Warnf("Failed to extract/remove incoming credential for tool %s using scheme %s: %v", t.name, clientScheme.ID, err)
-			} else if extractedCred == "" {
-				log.Debugf("No incoming credential found for tool %s using scheme %s for extraction/removal.", t.name, clientScheme.ID)
-			}
-
-			// Only use passthrough if explicitly configured
-			if downstreamSecurity.Passthrough && extractedCred != "" {
-				passthroughCredential = extractedCred
-				log.Debugf("Passthrough credential set for tool %s.", t.name)
-			}
-		}
-	} else {
-		// Fallback: Remove Authorization header if no downstream security is defined
-		// This prevents downstream credentials from being mistakenly passed to upstream
-		// Unless passthroughAuthHeader is explicitly set to true
-		if !proxyServer.GetPassthroughAuthHeader() {
-			proxywasm.RemoveHttpRequestHeader("Authorization")
-		}
-	}
+	passthroughCredential := extractDownstreamCredential(downstreamSecurity, proxyServer.GetSecurityScheme, proxyServer.GetPassthroughAuthHeader(), "tool "+t.name)
 
 	// Create protocol handler using server fields
-	handler := NewMcpProtocolHandler(proxyServer.GetMcpServerURL(), proxyServer.GetTimeout())
+	handler := proxyServer.newProtocolHandler()
 
 	// Prepare authentication information for gateway-to-backend communication
 	// toolConfig.RequestTemplate.Security represents gateway-to-backend authentication, falls back to server's defaultUpstreamSecurity
@@ -385,6 +600,9 @@ func (t *McpProxyTool) Call(httpCtx HttpContext, server Server) error {
 
 // Description implements Tool interface
 func (t *McpProxyTool) Description() string {
+	if override := t.toolConfig.DescriptionOverride; override != nil && override.Description != "" {
+		return override.Description
+	}
 	return t.toolConfig.Description
 }
 
@@ -404,6 +622,9 @@ func (t *McpProxyTool) InputSchema() map[string]any {
 			"type":        arg.Type,
 			"description": arg.Description,
 		}
+		if override := t.toolConfig.DescriptionOverride; override != nil && override.Args[arg.Name] != "" {
+			argSchema["description"] = override.Args[arg.Name]
+		}
 
 		if arg.Default != nil {
 			argSchema["default"] = arg.Default
@@ -429,16 +650,26 @@ func (t *McpProxyTool) OutputSchema() map[string]any {
 	return t.toolConfig.OutputSchema
 }
 
+func (t *McpProxyTool) schemaPatterns() schemaPatterns {
+	return t.toolConfig.patterns
+}
+
 // ValidateSecurityScheme validates a security scheme configuration
 func ValidateSecurityScheme(scheme SecurityScheme) error {
 	if scheme.ID == "" {
 		return fmt.Errorf("security scheme ID is required")
 	}
 
-	if scheme.Type != "apiKey" && scheme.Type != "http" {
+	if scheme.Type != "apiKey" && scheme.Type != "http" && scheme.Type != "oauth2" {
 		return fmt.Errorf("invalid security scheme type: %s", scheme.Type)
 	}
 
+	if scheme.Type == "oauth2" {
+		if scheme.TokenURL == "" || scheme.ClientID == "" || scheme.ClientSecret == "" {
+			return fmt.Errorf("security scheme tokenUrl, clientId and clientSecret are required for oauth2 type")
+		}
+	}
+
 	if scheme.Type == "apiKey" {
 		if scheme.Name == "" {
 			return fmt.Errorf("security scheme name is required for apiKey type")
@@ -0,0 +1,809 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	// CtxMcpProxySessionRetried marks that a request already re-initialized an expired persisted session
+	CtxMcpProxySessionRetried = "mcp_proxy_session_retried"
+
+	defaultSessionIdleTimeout = 5 * 60 * 1000 // 5 minutes
+	sessionExpiryCheckPeriod  = 1000          // 1 second
+
+	// mcpSessionSharedDataKeyPrefix prefixes the shared data key holding the sessions of one manager
+	mcpSessionSharedDataKeyPrefix = "mcp-proxy-sessions"
+	// keepAliveLeaseTicks is the number of keep-alive periods the VM keeping the sessions alive may miss
+	// before another VM takes over
+	keepAliveLeaseTicks = 3
+	// maxSessionCasRetries bounds the read-modify-write retries on concurrent updates from other VMs
+	maxSessionCasRetries = 10
+)
+
+// McpSession represents an MCP session negotiated with a backend server
+type McpSession struct {
+	ID          string      `json:"id"`
+	BackendURL  string      `json:"backendURL"`
+	RequestURL  string      `json:"-"`                     // Backend URL with upstream authentication applied, never persisted
+	ClusterName string      `json:"clusterName,omitempty"` // Upstream cluster the session was negotiated through
+	Host        string      `json:"host,omitempty"`        // Authority used when the backend URL has no host
+	Headers     [][2]string `json:"headers,omitempty"`     // Request headers replayed on keep-alive pings and re-initialization, without credentials
+	Credential  string      `json:"credential,omitempty"`  // Fingerprint of the credentials the session was negotiated with
+	CreatedAt   time.Time   `json:"createdAt"`
+	LastUsed    time.Time   `json:"lastUsed"`
+
+	ProtocolVersion  string `json:"protocolVersion,omitempty"`  // Protocol version negotiated with the backend
+	SecurityScheme   string `json:"securityScheme,omitempty"`   // Upstream security scheme re-applied from the configuration to replayed requests
+	ClientCredential bool   `json:"clientCredential,omitempty"` // Whether the session was negotiated with credentials of the client
+
+	// credentialHeaders are the request headers carrying credentials, they are only kept in the memory of
+	// the VMs that used the session, like RequestURL
+	credentialHeaders [][2]string
+}
+
+// Key returns the key the session is looked up by, see SessionKey
+func (s *McpSession) Key() string {
+	return SessionKey(s.BackendURL, s.Credential)
+}
+
+// SessionKey returns the key of the sessions negotiated with a backend using credentials of the given
+// fingerprint, so that a session is never reused by a caller with other credentials
+func SessionKey(backendURL, credential string) string {
+	if credential == "" {
+		return backendURL
+	}
+	return backendURL + "#" + credential
+}
+
+// sessionCredentialHeaders are the request headers carrying the credentials a session is bound to
+var sessionCredentialHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+}
+
+// sessionCredential returns the fingerprint of the credentials the backend requests of the current
+// request are sent with, empty when there are none, and whether some of them come from the client
+// rather than from the configuration. The fingerprint is an HMAC keyed by the credential secret of
+// the manager, so that it can neither be computed nor checked against guessed credentials by whoever
+// reads the shared data or the store.
+func (m *McpSessionManagerImpl) sessionCredential(authInfo *ProxyAuthInfo) (string, bool) {
+	hash := hmac.New(sha256.New, m.credentialSecret)
+	found, client := false, false
+	if authInfo != nil && authInfo.SecuritySchemeID != "" {
+		fmt.Fprintf(hash, "scheme:%s\ncredential:%s\n", authInfo.SecuritySchemeID, authInfo.PassthroughCredential)
+		found = true
+		client = authInfo.PassthroughCredential != ""
+	}
+	headers, _ := proxywasm.GetHttpRequestHeaders()
+	for _, h := range headers {
+		if name := strings.ToLower(h[0]); sessionCredentialHeaders[name] {
+			fmt.Fprintf(hash, "%s:%s\n", name, h[1])
+			found, client = true, true
+		}
+	}
+	if !found {
+		return "", false
+	}
+	return hex.EncodeToString(hash.Sum(nil)), client
+}
+
+// splitCredentialHeaders separates the headers carrying credentials, see sessionCredentialHeaders, and
+// the headers of the given extra names from the other headers
+func splitCredentialHeaders(headers [][2]string, extra ...string) (plain, credentials [][2]string) {
+	for _, h := range headers {
+		name := strings.ToLower(h[0])
+		isCredential := sessionCredentialHeaders[name]
+		for _, e := range extra {
+			isCredential = isCredential || strings.EqualFold(name, e)
+		}
+		if isCredential {
+			credentials = append(credentials, h)
+		} else {
+			plain = append(plain, h)
+		}
+	}
+	return plain, credentials
+}
+
+// sessionSecrets are the credentials a session is replayed with, kept in the memory of a VM only
+type sessionSecrets struct {
+	requestURL string
+	headers    [][2]string
+}
+
+// McpSessionManagerImpl manages MCP sessions in proxy-wasm shared data, so that sessions are visible
+// to every worker VM and survive VM rebuilds. Updates use CAS and sessions unused for longer than
+// the TTL are dropped whenever the session set is read or written. When a SessionStore is set,
+// changes are written through to it and sessions missing in shared data can be fetched from it.
+// Credentials are never written to shared data or to the store: the headers carrying them and the
+// request URL are kept in the memory of the VMs that used a session.
+type McpSessionManagerImpl struct {
+	key     string
+	ttl     time.Duration
+	store   SessionStore
+	secrets map[string]sessionSecrets
+	// credentialSecret keys the fingerprints of the credentials sessions are bound to
+	credentialSecret []byte
+}
+
+// NewMcpSessionManagerImpl creates a session manager whose sessions are stored under the given namespace
+func NewMcpSessionManagerImpl(namespace string, ttl time.Duration) *McpSessionManagerImpl {
+	return &McpSessionManagerImpl{
+		key:     fmt.Sprintf("%s:%s", mcpSessionSharedDataKeyPrefix, namespace),
+		ttl:     ttl,
+		secrets: make(map[string]sessionSecrets),
+	}
+}
+
+// SetStore sets the external store sessions are written through to
+func (m *McpSessionManagerImpl) SetStore(store SessionStore) {
+	m.store = store
+}
+
+// SetCredentialSecret sets the secret keying the fingerprints of the credentials sessions are bound to.
+// Every gateway instance sharing the sessions must use the same secret.
+func (m *McpSessionManagerImpl) SetCredentialSecret(secret string) {
+	m.credentialSecret = []byte(secret)
+}
+
+// GetStore returns the external session store, or nil when sessions are only kept in shared data
+func (m *McpSessionManagerImpl) GetStore() SessionStore {
+	return m.store
+}
+
+// load reads the live sessions and the CAS value of the shared data entry, and reports whether expired
+// sessions were dropped from the entry
+func (m *McpSessionManagerImpl) load() (map[string]*McpSession, uint32, bool, error) {
+	sessions := make(map[string]*McpSession)
+	data, cas, err := proxywasm.GetSharedData(m.key)
+	if err != nil {
+		if errors.Is(err, types.ErrorStatusNotFound) {
+			return sessions, cas, false, nil
+		}
+		return nil, 0, false, fmt.Errorf("failed to get sessions from shared data: %v", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &sessions); err != nil {
+			log.Warnf("Discarding malformed MCP sessions in shared data: %v", err)
+			sessions = make(map[string]*McpSession)
+		}
+	}
+	expired := m.dropExpired(sessions, m.ttl)
+	for sessionID := range m.secrets {
+		if sessions[sessionID] == nil {
+			delete(m.secrets, sessionID)
+		}
+	}
+	for sessionID, session := range sessions {
+		if secrets, ok := m.secrets[sessionID]; ok {
+			session.RequestURL = secrets.requestURL
+			session.credentialHeaders = secrets.headers
+		}
+	}
+	return sessions, cas, expired, nil
+}
+
+// dropExpired removes sessions that have not been used within maxAge and reports whether there were any
+func (m *McpSessionManagerImpl) dropExpired(sessions map[string]*McpSession, maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	now := time.Now()
+	dropped := false
+	for sessionID, session := range sessions {
+		if now.Sub(session.LastUsed) > maxAge {
+			delete(sessions, sessionID)
+			dropped = true
+			log.Debugf("Cleaned up expired MCP session %s", sessionID)
+		}
+	}
+	return dropped
+}
+
+// update applies a change to the session set and writes it back, retrying on CAS mismatch.
+// The change returns false when it did not modify the sessions and nothing needs to be written.
+func (m *McpSessionManagerImpl) update(change func(sessions map[string]*McpSession) bool) error {
+	for i := 0; i < maxSessionCasRetries; i++ {
+		sessions, cas, expired, err := m.load()
+		if err != nil {
+			return err
+		}
+		if !change(sessions) && !expired {
+			return nil
+		}
+		data, err := json.Marshal(sessions)
+		if err != nil {
+			return fmt.Errorf("failed to marshal sessions: %v", err)
+		}
+		err = proxywasm.SetSharedData(m.key, data, cas)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, types.ErrorStatusCasMismatch) {
+			return fmt.Errorf("failed to set sessions to shared data: %v", err)
+		}
+	}
+	return fmt.Errorf("failed to update sessions after %d retries due to concurrent updates", maxSessionCasRetries)
+}
+
+// CreateSession creates a new temporary session
+func (m *McpSessionManagerImpl) CreateSession(backendURL string) (string, error) {
+	now := time.Now()
+	session := &McpSession{
+		ID:         fmt.Sprintf("mcp-session-%d", now.UnixNano()),
+		BackendURL: backendURL,
+		CreatedAt:  now,
+		LastUsed:   now,
+	}
+	if err := m.PutSession(session); err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// PutSession stores a session negotiated with a backend server. The headers carrying credentials are
+// moved from Headers to the memory of the VM, together with RequestURL.
+func (m *McpSessionManagerImpl) PutSession(session *McpSession) error {
+	plain, credentials := splitCredentialHeaders(session.Headers)
+	session.Headers = plain
+	session.credentialHeaders = append(session.credentialHeaders, credentials...)
+	err := m.update(func(sessions map[string]*McpSession) bool {
+		sessions[session.ID] = session
+		return true
+	})
+	if err != nil {
+		log.Warnf("Failed to store MCP session %s: %v", session.ID, err)
+		return err
+	}
+	if session.RequestURL != "" || len(session.credentialHeaders) > 0 {
+		m.secrets[session.ID] = sessionSecrets{requestURL: session.RequestURL, headers: session.credentialHeaders}
+	}
+	log.Debugf("Stored MCP session %s for %s", session.ID, session.BackendURL)
+	m.saveToStore(session)
+	return nil
+}
+
+// saveToStore writes a session through to the external store, refreshing its expiry
+func (m *McpSessionManagerImpl) saveToStore(session *McpSession) {
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Save(session, m.ttl); err != nil {
+		log.Warnf("Failed to save MCP session %s to session store: %v", session.ID, err)
+	}
+}
+
+// FetchSession looks up the session of a key, see SessionKey, in the external store and caches it in
+// shared data. The callback reports whether a live session was found, or the error of the store when
+// the lookup failed or could not be sent. It returns false when no store is set, in which case the
+// callback is never called.
+func (m *McpSessionManagerImpl) FetchSession(key string, callback func(found bool, err error)) bool {
+	if m.store == nil {
+		return false
+	}
+	err := m.store.Find(key, func(session *McpSession, err error) {
+		if err != nil {
+			callback(false, err)
+			return
+		}
+		if session == nil || (m.ttl > 0 && time.Since(session.LastUsed) > m.ttl) {
+			callback(false, nil)
+			return
+		}
+		err = m.update(func(sessions map[string]*McpSession) bool {
+			sessions[session.ID] = session
+			return true
+		})
+		if err != nil {
+			log.Warnf("Failed to cache MCP session %s from session store: %v", session.ID, err)
+			callback(false, nil)
+			return
+		}
+		log.Debugf("Fetched MCP session %s for %s from session store", session.ID, session.BackendURL)
+		callback(true, nil)
+	})
+	if err != nil {
+		callback(false, fmt.Errorf("failed to fetch MCP session for %s from session store: %w", key, err))
+	}
+	return true
+}
+
+// touch marks a session as used once half of its TTL went by since it was last marked, so that using a
+// session does not write the whole session set, and the session store, on every request
+func (m *McpSessionManagerImpl) touch(session *McpSession) bool {
+	if m.ttl <= 0 || time.Since(session.LastUsed) < m.ttl/2 {
+		return false
+	}
+	session.LastUsed = time.Now()
+	return true
+}
+
+// GetSession retrieves a session by ID and marks it as used
+func (m *McpSessionManagerImpl) GetSession(sessionID string) (*McpSession, bool) {
+	var found *McpSession
+	err := m.update(func(sessions map[string]*McpSession) bool {
+		found = sessions[sessionID]
+		return found != nil && m.touch(found)
+	})
+	if err != nil {
+		log.Warnf("Failed to get MCP session %s: %v", sessionID, err)
+		return nil, false
+	}
+	return found, found != nil
+}
+
+// FindSession returns the most recently used live session of a key, see SessionKey, and marks it as used
+func (m *McpSessionManagerImpl) FindSession(key string) (*McpSession, bool) {
+	var found *McpSession
+	touched := false
+	err := m.update(func(sessions map[string]*McpSession) bool {
+		found = nil
+		for _, session := range sessions {
+			if session.Key() != key {
+				continue
+			}
+			if found == nil || session.LastUsed.After(found.LastUsed) {
+				found = session
+			}
+		}
+		touched = found != nil && m.touch(found)
+		return touched
+	})
+	if err != nil {
+		log.Warnf("Failed to find MCP session for %s: %v", key, err)
+		return nil, false
+	}
+	if touched {
+		m.saveToStore(found)
+	}
+	return found, found != nil
+}
+
+// ListSessions returns all live sessions
+func (m *McpSessionManagerImpl) ListSessions() []*McpSession {
+	sessions, _, _, err := m.load()
+	if err != nil {
+		log.Warnf("Failed to list MCP sessions: %v", err)
+		return nil
+	}
+	list := make([]*McpSession, 0, len(sessions))
+	for _, session := range sessions {
+		list = append(list, session)
+	}
+	return list
+}
+
+// CleanupSession removes a session
+func (m *McpSessionManagerImpl) CleanupSession(sessionID string) {
+	var removed *McpSession
+	err := m.update(func(sessions map[string]*McpSession) bool {
+		removed = sessions[sessionID]
+		if removed == nil {
+			return false
+		}
+		delete(sessions, sessionID)
+		return true
+	})
+	if err != nil {
+		log.Warnf("Failed to clean up MCP session %s: %v", sessionID, err)
+		return
+	}
+	delete(m.secrets, sessionID)
+	log.Debugf("Cleaned up MCP session %s", sessionID)
+	if removed != nil && m.store != nil {
+		if err := m.store.Delete(removed); err != nil {
+			log.Warnf("Failed to delete MCP session %s from session store: %v", sessionID, err)
+		}
+	}
+}
+
+// CleanupExpiredSessions removes sessions that have not been used within maxAge
+func (m *McpSessionManagerImpl) CleanupExpiredSessions(maxAge time.Duration) {
+	err := m.update(func(sessions map[string]*McpSession) bool {
+		return m.dropExpired(sessions, maxAge)
+	})
+	if err != nil {
+		log.Warnf("Failed to clean up expired MCP sessions: %v", err)
+	}
+}
+
+// BackendSessionConfig controls how mcp-proxy manages sessions with the backend MCP server
+type BackendSessionConfig struct {
+	Persist          bool `json:"persist"`          // Reuse the negotiated Mcp-Session-Id across requests with the same credentials
+	PingInterval     int  `json:"pingInterval"`     // Milliseconds between keep-alive pings, 0 disables pings
+	IdleTimeout      int  `json:"idleTimeout"`      // Milliseconds a session may stay unused before it is dropped
+	DeleteOnComplete bool `json:"deleteOnComplete"` // Send DELETE for non-persistent sessions when the request is done
+	// Secret keying the fingerprints of the credentials persisted sessions are bound to, required with Persist
+	CredentialSecret string `json:"credentialSecret"`
+}
+
+// idleTimeout returns the configured idle timeout or the default one
+func (c BackendSessionConfig) idleTimeout() time.Duration {
+	if c.IdleTimeout > 0 {
+		return time.Duration(c.IdleTimeout) * time.Millisecond
+	}
+	return defaultSessionIdleTimeout * time.Millisecond
+}
+
+// startSessionKeepAlive registers the tick function that expires idle sessions and pings live ones.
+// The sessions are shared by every VM, so only the VM holding the keep-alive lease of the sessions
+// does it. It must be called while the plugin configuration is being parsed.
+func (s *McpProxyServer) startSessionKeepAlive() {
+	period := int64(s.backendSession.PingInterval)
+	if period <= 0 {
+		period = sessionExpiryCheckPeriod
+	}
+	// Tick functions are driven by a 100ms host tick
+	period = (period + 99) / 100 * 100
+	// Another VM takes over when the holder missed a few ticks
+	ttl := time.Duration(period*keepAliveLeaseTicks) * time.Millisecond
+	wrapper.RegisterTickFunc(period, func() {
+		s.keepAliveSessionsOnLease(ttl)
+	})
+}
+
+// keepAliveSessionsOnLease keeps the sessions alive when the VM holds, or can take, the keep-alive lease
+func (s *McpProxyServer) keepAliveSessionsOnLease(ttl time.Duration) {
+	if wrapper.HoldLease(s.sessionManager.key+":keepalive", ttl) {
+		s.keepAliveSessions()
+	}
+}
+
+// keepAliveSessions drops idle sessions and pings the remaining ones when pings are enabled
+func (s *McpProxyServer) keepAliveSessions() {
+	s.sessionManager.CleanupExpiredSessions(s.backendSession.idleTimeout())
+	if s.backendSession.PingInterval <= 0 {
+		return
+	}
+	for _, session := range s.sessionManager.ListSessions() {
+		s.pingSession(session)
+	}
+}
+
+// replayRequest returns the URL and the headers requests on a session are sent with outside of any
+// request, or false when the VM does not know the credentials of the session: credentials of the client
+// are only known to the VMs that used the session, those of the configuration are applied again.
+func (s *McpProxyServer) replayRequest(session *McpSession, sessionID string) (string, [][2]string, bool) {
+	if session.RequestURL != "" {
+		headers := append(append([][2]string(nil), session.Headers...), session.credentialHeaders...)
+		return session.RequestURL, sessionHeaders(headers, sessionID), true
+	}
+	if session.ClientCredential {
+		return "", nil, false
+	}
+	headers := sessionHeaders(session.Headers, sessionID)
+	if session.SecurityScheme == "" {
+		return session.BackendURL, headers, true
+	}
+	handler := NewMcpProtocolHandler(session.BackendURL, s.GetTimeout())
+	requestURL, err := handler.applyProxyAuthentication(s, session.SecurityScheme, "", &headers)
+	if err != nil {
+		log.Warnf("Failed to apply authentication to MCP session %s: %v", session.ID, err)
+		return "", nil, false
+	}
+	return requestURL, headers, true
+}
+
+// pingSession sends a JSON-RPC ping on a persisted session and re-initializes it when the backend no longer knows it
+func (s *McpProxyServer) pingSession(session *McpSession) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      fmt.Sprintf("ping-%d", time.Now().UnixNano()),
+		"method":  "ping",
+	})
+	requestURL, headers, ok := s.replayRequest(session, session.ID)
+	if !ok {
+		log.Debugf("Not pinging backend MCP session %s, its credentials are unknown to this VM", session.ID)
+		return
+	}
+	err := s.sessionClient(session).Post(requestURL, headers, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		switch {
+		case statusCode == http.StatusNotFound:
+			log.Infof("Backend MCP session %s expired, re-initializing", session.ID)
+			s.sessionManager.CleanupSession(session.ID)
+			s.reinitializeSession(session)
+		case statusCode >= 300:
+			log.Warnf("Ping on backend MCP session %s failed with status %d: %s", session.ID, statusCode, string(responseBody))
+		default:
+			log.Debugf("Ping on backend MCP session %s succeeded", session.ID)
+		}
+	}, s.calloutTimeout())
+	if err != nil {
+		log.Warnf("Failed to ping backend MCP session %s: %v", session.ID, err)
+	}
+}
+
+// reinitializeSession negotiates a new backend session on behalf of an expired one outside of any request
+func (s *McpProxyServer) reinitializeSession(expired *McpSession) {
+	handler := NewMcpProtocolHandler(s.GetMcpServerURL(), s.GetTimeout())
+	body, _ := json.Marshal(handler.createInitializeRequest())
+	client := s.sessionClient(expired)
+	requestURL, headers, ok := s.replayRequest(expired, "")
+	if !ok {
+		log.Debugf("Not re-initializing backend MCP session %s, its credentials are unknown to this VM", expired.ID)
+		return
+	}
+	err := client.Post(requestURL, headers, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		sessionID := responseHeaders.Get("Mcp-Session-Id")
+		if statusCode != http.StatusOK || sessionID == "" {
+			log.Warnf("Failed to re-initialize backend MCP session for %s, status: %d", expired.BackendURL, statusCode)
+			return
+		}
+		notification, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "notifications/initialized",
+		})
+		_, headers, _ := s.replayRequest(expired, sessionID)
+		err := client.Post(requestURL, headers, notification, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+			if statusCode >= 300 {
+				log.Warnf("Initialized notification for re-initialized session %s failed with status %d", sessionID, statusCode)
+			}
+			now := time.Now()
+			renewed := *expired
+			renewed.ID = sessionID
+			renewed.CreatedAt = now
+			s.sessionManager.PutSession(&renewed)
+			log.Infof("Backend MCP session %s replaced by %s", expired.ID, sessionID)
+		}, s.calloutTimeout())
+		if err != nil {
+			log.Warnf("Failed to send initialized notification for session %s: %v", sessionID, err)
+		}
+	}, s.calloutTimeout())
+	if err != nil {
+		log.Warnf("Failed to re-initialize backend MCP session for %s: %v", expired.BackendURL, err)
+	}
+}
+
+// sessionClient returns a client bound to the cluster a session was negotiated through
+func (s *McpProxyServer) sessionClient(session *McpSession) wrapper.HttpClient {
+	return wrapper.NewClusterClient(wrapper.TargetCluster{
+		Cluster: session.ClusterName,
+		Host:    session.Host,
+	})
+}
+
+// calloutTimeout returns the backend request timeout in milliseconds
+func (s *McpProxyServer) calloutTimeout() uint32 {
+	if s.GetTimeout() > 0 {
+		return uint32(s.GetTimeout())
+	}
+	return 5000 // Default 5 seconds
+}
+
+// sessionHeaders copies the stored headers and sets the session ID, or drops it when sessionID is empty
+func sessionHeaders(stored [][2]string, sessionID string) [][2]string {
+	headers := make([][2]string, 0, len(stored)+1)
+	for _, h := range stored {
+		if strings.EqualFold(h[0], "Mcp-Session-Id") {
+			continue
+		}
+		headers = append(headers, h)
+	}
+	if sessionID != "" {
+		headers = append(headers, [2]string{"Mcp-Session-Id", sessionID})
+	}
+	return headers
+}
+
+// toHeaderSlice converts http.Header to [][2]string format
+func toHeaderSlice(header http.Header) [][2]string {
+	headerSlice := make([][2]string, 0, len(header))
+	for key, values := range header {
+		if len(values) > 0 {
+			headerSlice = append(headerSlice, [2]string{key, values[0]})
+		}
+	}
+	return headerSlice
+}
+
+// SetSessionManager enables reuse of backend sessions persisted in the given manager
+func (h *McpProtocolHandler) SetSessionManager(manager *McpSessionManagerImpl) {
+	h.sessionManager = manager
+}
+
+// SetDeleteSessionOnComplete controls whether a non-persistent backend session is terminated
+// with an HTTP DELETE once the downstream stream is done
+func (h *McpProtocolHandler) SetDeleteSessionOnComplete(enabled bool) {
+	h.deleteSession = enabled
+}
+
+// scheduleSessionDelete registers the DELETE of the session negotiated by this request, so that the
+// backend does not keep one orphaned session per proxied request
+func (h *McpProtocolHandler) scheduleSessionDelete(ctx wrapper.HttpContext) {
+	if !h.deleteSession || h.sessionManager != nil || h.sessionID == "" {
+		return
+	}
+	sessionID := h.sessionID
+	requestURL := h.requestURL
+	headers := sessionHeaders(h.requestHeaders, sessionID)
+	// Resolve the route while the request is still active
+	client := wrapper.NewClusterClient(h.sessionCluster())
+	timeout := uint32(h.timeout)
+	if timeout == 0 {
+		timeout = 5000 // Default 5 seconds
+	}
+	OnStreamDone(ctx, func(HttpContext) {
+		err := client.Delete(requestURL, headers, nil, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+			switch statusCode {
+			case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+				log.Debugf("Terminated backend MCP session %s, status: %d", sessionID, statusCode)
+			case http.StatusMethodNotAllowed:
+				// The backend does not allow clients to terminate sessions
+				log.Debugf("Backend does not support terminating MCP session %s", sessionID)
+			default:
+				log.Warnf("Failed to terminate backend MCP session %s, status: %d", sessionID, statusCode)
+			}
+		}, timeout)
+		if err != nil {
+			log.Warnf("Failed to send DELETE for backend MCP session %s: %v", sessionID, err)
+		}
+	})
+}
+
+// reusePersistedSession picks up a live persisted session for the backend, if any
+func (h *McpProtocolHandler) reusePersistedSession(ctx wrapper.HttpContext) bool {
+	if h.sessionManager == nil || ctx.GetContext(CtxMcpProxySessionRetried) != nil {
+		return false
+	}
+	session, ok := h.sessionManager.FindSession(SessionKey(h.backendURL, h.credential))
+	if !ok {
+		return false
+	}
+	h.sessionID = session.ID
+	h.protocolVersion = session.ProtocolVersion
+	h.sessionReused = true
+	ctx.SetContext(CtxMcpProxySessionID, session.ID)
+	ctx.SetContext(CtxMcpProxyInitialized, true)
+	log.Debugf("Reusing persisted MCP session %s for %s", session.ID, h.backendURL)
+	return true
+}
+
+// fetchStoredSession looks up a session negotiated by another gateway instance in the session store,
+// and reuses it or initializes a new one once the lookup is done. The failures of the store follow
+// the failure policy of wrapper.FailureRedis. It returns false when there is no session store to consult.
+func (h *McpProtocolHandler) fetchStoredSession(ctx wrapper.HttpContext, authInfo *ProxyAuthInfo) bool {
+	if h.sessionManager == nil || ctx.GetContext(CtxMcpProxySessionRetried) != nil {
+		return false
+	}
+	return h.sessionManager.FetchSession(SessionKey(h.backendURL, h.credential), func(found bool, err error) {
+		if err != nil && ctx.HandleFailure(wrapper.FailureRedis, err) == wrapper.FailClosed {
+			return
+		}
+		if found && h.reusePersistedSession(ctx) {
+			h.executePendingOperation(ctx)
+			return
+		}
+		if err := h.initializeBackend(ctx, authInfo); err != nil {
+			log.Errorf("Failed to initialize MCP session: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.CalloutErrorCode(err), "mcp-proxy:initialize:send_error")
+		}
+	})
+}
+
+// persistSession stores the session negotiated by this request so that later requests can reuse it
+func (h *McpProtocolHandler) persistSession(authInfo *ProxyAuthInfo) {
+	if h.sessionManager == nil || h.sessionID == "" {
+		return
+	}
+	now := time.Now()
+	cluster := h.sessionCluster()
+	session := &McpSession{
+		ID:          h.sessionID,
+		BackendURL:  h.backendURL,
+		RequestURL:  h.requestURL,
+		ClusterName: cluster.Cluster,
+		Host:        cluster.Host,
+		Credential:  h.credential,
+		CreatedAt:   now,
+		LastUsed:    now,
+
+		ProtocolVersion:  h.protocolVersion,
+		ClientCredential: h.clientCredential,
+	}
+	// The header a configured API key is sent in is a credential as well
+	var schemeHeader string
+	if authInfo != nil && authInfo.SecuritySchemeID != "" {
+		session.SecurityScheme = authInfo.SecuritySchemeID
+		if authInfo.Server != nil {
+			if scheme, ok := authInfo.Server.GetSecurityScheme(authInfo.SecuritySchemeID); ok && scheme.Type == "apiKey" && scheme.In == "header" {
+				schemeHeader = scheme.Name
+			}
+		}
+	}
+	session.Headers, session.credentialHeaders = splitCredentialHeaders(sessionHeaders(h.requestHeaders, ""), schemeHeader)
+	h.sessionManager.PutSession(session)
+}
+
+// retryWithNewSession re-initializes once when the backend reports that a reused session no longer exists.
+// It returns true when the response has been taken over by the retry.
+func (h *McpProtocolHandler) retryWithNewSession(ctx wrapper.HttpContext, statusCode int) bool {
+	if !h.sessionReused || statusCode != http.StatusNotFound {
+		return false
+	}
+	log.Infof("Persisted MCP session %s not found on backend, re-initializing", h.sessionID)
+	h.sessionManager.CleanupSession(h.sessionID)
+	h.sessionID = ""
+	h.sessionReused = false
+	ctx.SetContext(CtxMcpProxySessionRetried, true)
+	ctx.SetContext(CtxMcpProxySessionID, nil)
+	ctx.SetContext(CtxMcpProxyInitialized, nil)
+
+	var authInfo *ProxyAuthInfo
+	if authInfoCtx, ok := ctx.GetContext("mcp_proxy_auth_info").(*ProxyAuthInfo); ok {
+		authInfo = authInfoCtx
+	}
+	if err := h.Initialize(ctx, authInfo); err != nil {
+		log.Errorf("Failed to re-initialize MCP session: %v", err)
+		utils.OnMCPResponseError(ctx, err, utils.CalloutErrorCode(err), "mcp-proxy:initialize:send_error")
+	}
+	return true
+}
+
+// postToBackend sends a request to the backend. Requests on a freshly initialized session are routed
+// through the current route; requests on a reused session, or to a backend with a cluster of its own,
+// are sent as callouts while the request is paused, so that an expired session can still be
+// re-initialized and retried.
+func (h *McpProtocolHandler) postToBackend(ctx wrapper.HttpContext, url string, headers [][2]string, body []byte, callback func(int, [][2]string, []byte)) error {
+	if h.proxyServer != nil && h.proxyServer.toolsListCache != nil {
+		// Watch the notifications streamed before the response for changes of the tool list
+		respond := callback
+		callback = func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+			h.proxyServer.observeSSENotifications(responseHeaders, responseBody)
+			respond(statusCode, responseHeaders, responseBody)
+		}
+	}
+	if h.pool != nil {
+		respond := callback
+		callback = func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+			h.reportBackend(statusCode)
+			respond(statusCode, responseHeaders, responseBody)
+		}
+	}
+	var err error
+	if !h.sessionReused && h.backend == nil {
+		err = ctx.RouteCall("POST", url, headers, body, callback)
+	} else {
+		timeout := uint32(h.timeout)
+		if timeout == 0 {
+			timeout = 5000 // Default 5 seconds
+		}
+		err = h.backendClient().Post(url, headers, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+			callback(statusCode, toHeaderSlice(responseHeaders), responseBody)
+		}, timeout)
+	}
+	if err != nil {
+		h.reportBackend(0)
+	}
+	return err
+}
@@ -0,0 +1,508 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/test"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// TestSessionManagerFindSession tests lookup of persisted backend sessions
+func TestSessionManagerFindSession(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	manager := NewMcpSessionManagerImpl("find-test", time.Minute)
+	now := time.Now()
+	manager.PutSession(&McpSession{ID: "old", BackendURL: "http://backend/mcp", LastUsed: now.Add(-2 * time.Minute)})
+	manager.PutSession(&McpSession{ID: "recent", BackendURL: "http://backend/mcp", LastUsed: now.Add(-40 * time.Second)})
+	manager.PutSession(&McpSession{ID: "other", BackendURL: "http://other/mcp", LastUsed: now})
+
+	session, ok := manager.FindSession("http://backend/mcp")
+	assert.True(t, ok)
+	assert.Equal(t, "recent", session.ID)
+	assert.WithinDuration(t, time.Now(), session.LastUsed, time.Second, "sessions past half of their TTL are marked as used")
+
+	_, cas, _ := proxywasm.GetSharedData(manager.key)
+	session, ok = manager.FindSession("http://backend/mcp")
+	assert.True(t, ok)
+	_, unchanged, _ := proxywasm.GetSharedData(manager.key)
+	assert.Equal(t, cas, unchanged, "sessions used recently are not written again")
+	session, ok = manager.GetSession(session.ID)
+	assert.True(t, ok)
+	_, unchanged, _ = proxywasm.GetSharedData(manager.key)
+	assert.Equal(t, cas, unchanged)
+
+	_, ok = manager.FindSession("http://unknown/mcp")
+	assert.False(t, ok)
+
+	manager.CleanupSession("recent")
+	_, ok = manager.FindSession("http://backend/mcp")
+	assert.False(t, ok, "idle sessions must not be reused")
+	assert.Len(t, manager.ListSessions(), 1, "expired sessions must not be listed")
+}
+
+// TestSessionCredential tests that persisted sessions are bound to the credentials they were negotiated with
+func TestSessionCredential(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("credential-test")))
+	defer func() {
+		reset()
+		log.SetPluginLog(&testLogger{})
+	}()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+
+	manager := NewMcpSessionManagerImpl("credential-test", time.Minute)
+	manager.SetCredentialSecret("deployment-secret")
+	var clients []bool
+	credentialOf := func(manager *McpSessionManagerImpl, authInfo *ProxyAuthInfo, headers ...[2]string) string {
+		contextID := host.InitializeHttpContext()
+		defer host.CompleteHttpContext(contextID)
+		host.CallOnRequestHeaders(contextID, append([][2]string{{":authority", "example.com"}, {":path", "/mcp"}}, headers...), false)
+		fingerprint, client := manager.sessionCredential(authInfo)
+		clients = append(clients, client)
+		return fingerprint
+	}
+	credential := func(authInfo *ProxyAuthInfo, headers ...[2]string) string {
+		return credentialOf(manager, authInfo, headers...)
+	}
+	assert.Empty(t, credential(nil, [2]string{"x-request-id", "1"}))
+	alice := credential(nil, [2]string{"Authorization", "Bearer alice"})
+	assert.Len(t, alice, 64, "the full HMAC-SHA256 digest is kept")
+	assert.Equal(t, alice, credential(nil, [2]string{"authorization", "Bearer alice"}, [2]string{"x-request-id", "2"}))
+	assert.NotEqual(t, alice, credential(nil, [2]string{"authorization", "Bearer bob"}))
+	scheme := credential(&ProxyAuthInfo{SecuritySchemeID: "backend-key"})
+	assert.NotEmpty(t, scheme)
+	assert.NotEqual(t, scheme, credential(&ProxyAuthInfo{SecuritySchemeID: "backend-key", PassthroughCredential: "alice"}))
+	assert.Equal(t, []bool{false, true, true, true, false, true}, clients, "only credentials of the configuration are not the client's")
+
+	other := NewMcpSessionManagerImpl("credential-test", time.Minute)
+	other.SetCredentialSecret("other-secret")
+	assert.NotEqual(t, alice, credentialOf(other, nil, [2]string{"Authorization", "Bearer alice"}), "fingerprints depend on the secret")
+	sameSecret := NewMcpSessionManagerImpl("credential-test", time.Minute)
+	sameSecret.SetCredentialSecret("deployment-secret")
+	assert.Equal(t, alice, credentialOf(sameSecret, nil, [2]string{"Authorization", "Bearer alice"}), "instances sharing the secret agree")
+
+	manager.PutSession(&McpSession{ID: "alice", BackendURL: "http://backend/mcp", Credential: alice, LastUsed: time.Now()})
+	_, ok := manager.FindSession("http://backend/mcp")
+	assert.False(t, ok, "sessions with credentials must not be reused without them")
+	_, ok = manager.FindSession(SessionKey("http://backend/mcp", "other"))
+	assert.False(t, ok, "sessions must not be reused with other credentials")
+	session, ok := manager.FindSession(SessionKey("http://backend/mcp", alice))
+	assert.True(t, ok)
+	assert.Equal(t, "alice", session.ID)
+}
+
+// TestSessionManagerSharedData tests that sessions are shared between managers of the same namespace
+func TestSessionManagerSharedData(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	first := NewMcpSessionManagerImpl("shared-test", time.Minute)
+	second := NewMcpSessionManagerImpl("shared-test", time.Minute)
+	other := NewMcpSessionManagerImpl("other-test", time.Minute)
+
+	sessionID, err := first.CreateSession("http://backend/mcp")
+	assert.NoError(t, err)
+	assert.NoError(t, first.PutSession(&McpSession{
+		ID:         "negotiated",
+		BackendURL: "http://backend/mcp",
+		Headers:    [][2]string{{"Authorization", "Bearer token"}},
+		LastUsed:   time.Now(),
+	}))
+
+	session, ok := second.GetSession("negotiated")
+	assert.True(t, ok)
+	assert.Empty(t, session.Headers, "credentials are not shared")
+	session, ok = first.GetSession("negotiated")
+	assert.True(t, ok)
+	assert.Equal(t, [][2]string{{"Authorization", "Bearer token"}}, session.credentialHeaders)
+	_, ok = second.GetSession(sessionID)
+	assert.True(t, ok)
+	assert.Empty(t, other.ListSessions())
+
+	second.CleanupSession(sessionID)
+	assert.Len(t, first.ListSessions(), 1)
+
+	assert.NoError(t, first.PutSession(&McpSession{ID: "idle", BackendURL: "http://backend/mcp", LastUsed: time.Now().Add(-30 * time.Second)}))
+	first.CleanupExpiredSessions(10 * time.Second)
+	_, ok = second.GetSession("idle")
+	assert.False(t, ok)
+	_, ok = second.GetSession("negotiated")
+	assert.True(t, ok)
+}
+
+// TestSessionCredentialsNotShared tests that credentials are only kept in the memory of the VMs using a session
+func TestSessionCredentialsNotShared(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("secret-test")))
+	defer func() {
+		reset()
+		log.SetPluginLog(&testLogger{})
+	}()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	contextID := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(contextID, [][2]string{{":authority", "example.com"}, {":path", "/mcp"}}, false)
+
+	server, err := setupMcpProxyServer("secret-test", proxyServerJson(test.NewMCPServerConfig("secret-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithSecuritySchemes(test.MCPSecurityScheme{ID: "backend", Type: "apiKey", In: "header", Name: "x-backend-key", DefaultCredential: "backend-secret"}).
+		WithServerField("backendSession", map[string]interface{}{"persist": true, "credentialSecret": "test-secret", "pingInterval": 30000})), "")
+	assert.NoError(t, err)
+	handler := server.newProtocolHandler()
+	handler.sessionID = "configured"
+	handler.requestURL = "http://backend.example.com/mcp"
+	handler.requestHeaders = [][2]string{{"Accept", "application/json"}, {"x-backend-key", "backend-secret"}}
+	handler.credential = "fingerprint"
+	handler.persistSession(&ProxyAuthInfo{SecuritySchemeID: "backend", Server: server})
+	handler.sessionID = "client"
+	handler.requestURL = "http://backend.example.com/mcp?token=alice"
+	handler.requestHeaders = [][2]string{{"Accept", "application/json"}, {"Authorization", "Bearer alice"}}
+	handler.clientCredential = true
+	handler.persistSession(nil)
+
+	data, _, err := proxywasm.GetSharedData(server.GetSessionManager().key)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "backend-secret")
+	assert.NotContains(t, string(data), "alice")
+
+	// The VM that negotiated the sessions replays their credentials
+	for _, session := range server.GetSessionManager().ListSessions() {
+		requestURL, headers, ok := server.replayRequest(session, session.ID)
+		assert.True(t, ok)
+		if session.ID == "client" {
+			assert.Equal(t, "http://backend.example.com/mcp?token=alice", requestURL)
+			assert.Contains(t, headers, [2]string{"Authorization", "Bearer alice"})
+		} else {
+			assert.Contains(t, headers, [2]string{"x-backend-key", "backend-secret"})
+		}
+	}
+
+	// Other VMs only know the credentials of the configuration
+	other := NewMcpSessionManagerImpl("secret-test", time.Minute)
+	other.key = server.GetSessionManager().key
+	session, ok := other.GetSession("configured")
+	assert.True(t, ok)
+	requestURL, headers, ok := server.replayRequest(session, "configured")
+	assert.True(t, ok)
+	assert.Equal(t, "http://backend.example.com/mcp", requestURL)
+	assert.Equal(t, [][2]string{{"Accept", "application/json"}, {"Mcp-Session-Id", "configured"}, {"x-backend-key", "backend-secret"}}, headers)
+	session, ok = other.GetSession("client")
+	assert.True(t, ok)
+	_, _, ok = server.replayRequest(session, "client")
+	assert.False(t, ok, "credentials of the client are unknown to other VMs")
+}
+
+// TestSessionKeepAliveLease tests that only the VM holding the keep-alive lease maintains the sessions
+func TestSessionKeepAliveLease(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	server, err := setupMcpProxyServer("lease-test", proxyServerJson(test.NewMCPServerConfig("lease-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithServerField("backendSession", map[string]interface{}{"persist": true, "credentialSecret": "test-secret", "idleTimeout": 1000})), "")
+	assert.NoError(t, err)
+	manager := server.GetSessionManager()
+	lease := fmt.Sprintf("%s:%s:keepalive", wrapper.VMLeaseKeyPrefix, manager.key)
+	held, _ := json.Marshal(map[string]interface{}{"holder": "other-vm", "expiry": time.Now().Add(time.Minute).UnixMilli()})
+	assert.NoError(t, proxywasm.SetSharedData(lease, held, 0))
+	idle := &McpSession{ID: "idle", BackendURL: "http://backend.example.com/mcp", LastUsed: time.Now().Add(-2 * time.Second)}
+	// The TTL of the manager is the idle timeout, store it as if by another manager with a longer one
+	longer := NewMcpSessionManagerImpl("lease-test", time.Minute)
+	longer.key = manager.key
+	assert.NoError(t, longer.PutSession(idle))
+
+	server.keepAliveSessionsOnLease(3 * time.Second)
+	assert.Len(t, longer.ListSessions(), 1, "the sessions are maintained by the lease holder")
+
+	_, cas, _ := proxywasm.GetSharedData(lease)
+	expired, _ := json.Marshal(map[string]interface{}{"holder": "other-vm", "expiry": time.Now().Add(-time.Second).UnixMilli()})
+	assert.NoError(t, proxywasm.SetSharedData(lease, expired, cas))
+	server.keepAliveSessionsOnLease(3 * time.Second)
+	assert.Empty(t, longer.ListSessions(), "an expired lease is taken over")
+}
+
+// TestSessionHeaders tests that the stored session ID header is replaced
+func TestSessionHeaders(t *testing.T) {
+	stored := [][2]string{
+		{"Content-Type", "application/json"},
+		{"mcp-session-id", "stale"},
+		{"Authorization", "Bearer token"},
+	}
+
+	headers := sessionHeaders(stored, "fresh")
+	assert.Equal(t, [][2]string{
+		{"Content-Type", "application/json"},
+		{"Authorization", "Bearer token"},
+		{"Mcp-Session-Id", "fresh"},
+	}, headers)
+
+	headers = sessionHeaders(stored, "")
+	assert.Len(t, headers, 2)
+	assert.Len(t, stored, 3, "stored headers must not be modified")
+}
+
+// TestBackendSessionConfig tests parsing of the backendSession option
+func TestBackendSessionConfig(t *testing.T) {
+	server, err := setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithServerField("backendSession", map[string]interface{}{"persist": true, "credentialSecret": "test-secret", "pingInterval": 30000})), "")
+	assert.NoError(t, err)
+	assert.True(t, server.GetBackendSession().Persist)
+	assert.Equal(t, 30000, server.GetBackendSession().PingInterval)
+	assert.NotNil(t, server.GetSessionManager())
+	assert.Equal(t, 5*time.Minute, server.GetBackendSession().idleTimeout())
+
+	server, err = setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp")), "")
+	assert.NoError(t, err)
+	assert.Nil(t, server.GetSessionManager())
+	assert.False(t, server.newProtocolHandler().deleteSession)
+
+	server, err = setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithServerField("errorCodeMapping", map[string]interface{}{"5xx": -32000}).
+		WithServerField("backendSession", map[string]interface{}{"deleteOnComplete": true})), "")
+	assert.NoError(t, err)
+	handler := server.newProtocolHandler()
+	assert.True(t, handler.deleteSession)
+	assert.Nil(t, handler.sessionManager)
+	assert.Equal(t, -32000, handler.errorCodeMapping.ErrorCode(502))
+
+	server, err = setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithServerField("backendSession", map[string]interface{}{"persist": true, "credentialSecret": "test-secret", "deleteOnComplete": true})), "")
+	assert.NoError(t, err)
+	handler = server.newProtocolHandler()
+	assert.False(t, handler.deleteSession, "persisted sessions must not be deleted")
+	assert.NotNil(t, handler.sessionManager)
+
+	_, err = setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("sse", "http://backend.example.com/sse").
+		WithServerField("backendSession", map[string]interface{}{"persist": true, "credentialSecret": "test-secret"})), "")
+	assert.Error(t, err)
+
+	_, err = setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("sse", "http://backend.example.com/sse").
+		WithServerField("backendSession", map[string]interface{}{"deleteOnComplete": true})), "")
+	assert.Error(t, err)
+}
+
+// TestProxyServerProtocolHandler tests that the protocol handler of a proxy server is configured from its
+// fields for every transport
+func TestProxyServerProtocolHandler(t *testing.T) {
+	for _, transport := range []TransportProtocol{TransportHTTP, TransportSSE} {
+		server, err := setupMcpProxyServer("handler-test", proxyServerJson(test.NewMCPServerConfig("handler-test").
+			WithProxyBackend(string(transport), "http://backend.example.com/mcp").
+			WithServerField("timeout", 3000).
+			WithServerField("errorCodeMapping", map[string]interface{}{"5xx": -32000})), "")
+		assert.NoError(t, err, transport)
+		assert.Equal(t, transport, server.GetTransport())
+
+		handler := server.newProtocolHandler()
+		assert.Equal(t, "http://backend.example.com/mcp", handler.backendURL, transport)
+		assert.Equal(t, 3000, handler.timeout, transport)
+		assert.Equal(t, -32000, handler.errorCodeMapping.ErrorCode(502), transport)
+		assert.Nil(t, handler.sessionManager, transport)
+	}
+
+	server, err := setupMcpProxyServer("handler-test", proxyServerJson(test.NewMCPServerConfig("handler-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithServerField("backendSession", map[string]interface{}{"persist": true, "credentialSecret": "test-secret"})), "")
+	assert.NoError(t, err)
+	assert.Same(t, server.GetSessionManager(), server.newProtocolHandler().sessionManager)
+}
+
+// proxyServerJson returns the server config of an MCP proxy server config fixture
+func proxyServerJson(fixture *test.MCPServerConfigBuilder) gjson.Result {
+	return gjson.GetBytes(fixture.Build(), "server")
+}
+
+type sessionStoreStub struct {
+	saved   []*McpSession
+	deleted []*McpSession
+	found   *McpSession
+	// findErr fails the lookups and sendErr their dispatch
+	findErr error
+	sendErr error
+}
+
+func (s *sessionStoreStub) Save(session *McpSession, ttl time.Duration) error {
+	s.saved = append(s.saved, session)
+	return nil
+}
+
+func (s *sessionStoreStub) Delete(session *McpSession) error {
+	s.deleted = append(s.deleted, session)
+	return nil
+}
+
+func (s *sessionStoreStub) Find(backendURL string, callback func(session *McpSession, err error)) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	if s.findErr != nil {
+		callback(nil, s.findErr)
+	} else if s.found != nil && s.found.BackendURL == backendURL {
+		callback(s.found, nil)
+	} else {
+		callback(nil, nil)
+	}
+	return nil
+}
+
+// TestSessionManagerStore tests that sessions are written through to the session store and fetched from it
+func TestSessionManagerStore(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+
+	manager := NewMcpSessionManagerImpl("store-test", time.Minute)
+	assert.False(t, manager.FetchSession("http://backend/mcp", func(bool, error) {}), "fetch requires a store")
+
+	store := &sessionStoreStub{}
+	manager.SetStore(store)
+	assert.NoError(t, manager.PutSession(&McpSession{ID: "local", BackendURL: "http://backend/mcp", LastUsed: time.Now().Add(-40 * time.Second)}))
+	_, ok := manager.FindSession("http://backend/mcp")
+	assert.True(t, ok)
+	assert.Len(t, store.saved, 2, "stored and refreshed on use")
+	_, ok = manager.FindSession("http://backend/mcp")
+	assert.True(t, ok)
+	assert.Len(t, store.saved, 2, "refreshed only when close to expiring")
+	manager.CleanupSession("local")
+	if assert.Len(t, store.deleted, 1) {
+		assert.Equal(t, "local", store.deleted[0].ID)
+	}
+
+	store.found = &McpSession{ID: "remote", BackendURL: "http://backend/mcp", ProtocolVersion: "2025-06-18", LastUsed: time.Now()}
+	var found bool
+	var fetchErr error
+	fetch := func(ok bool, err error) { found, fetchErr = ok, err }
+	assert.True(t, manager.FetchSession("http://backend/mcp", fetch))
+	assert.True(t, found)
+	assert.NoError(t, fetchErr)
+	session, ok := manager.GetSession("remote")
+	assert.True(t, ok)
+	assert.Equal(t, "2025-06-18", session.ProtocolVersion)
+
+	store.found.LastUsed = time.Now().Add(-2 * time.Minute)
+	store.found.ID = "expired"
+	assert.True(t, manager.FetchSession("http://backend/mcp", fetch))
+	assert.False(t, found, "expired sessions must not be fetched")
+	assert.NoError(t, fetchErr)
+
+	// Failures of the store are reported to the callback, whether the lookup failed or could not be sent
+	store.findErr = errors.New("connection refused")
+	assert.True(t, manager.FetchSession("http://backend/mcp", fetch))
+	assert.False(t, found)
+	assert.ErrorIs(t, fetchErr, store.findErr)
+	store.findErr, store.sendErr = nil, errors.New("redis client is not ready")
+	fetchErr = nil
+	assert.True(t, manager.FetchSession("http://backend/mcp", fetch))
+	assert.ErrorIs(t, fetchErr, store.sendErr)
+}
+
+// TestRedisSessionStore tests the redis commands of the session store
+func TestRedisSessionStore(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("redis-session-test")))
+	defer func() {
+		reset()
+		log.SetPluginLog(&testLogger{})
+	}()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+
+	store, err := parseSessionStore("weather", gjson.Parse(`{"type": "redis", "serviceName": "redis.example.com", "servicePort": 6379}`))
+	assert.NoError(t, err)
+	assert.NoError(t, store.init())
+
+	contextID := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(contextID, [][2]string{{":authority", "example.com"}, {":path", "/mcp"}}, false)
+	session := &McpSession{
+		ID:              "s1",
+		BackendURL:      "http://backend/mcp",
+		RequestURL:      "http://backend/mcp?key=secret-query",
+		Headers:         [][2]string{{"Authorization", "Bearer secret-token"}, {"X-Tenant", "t1"}},
+		ProtocolVersion: "2025-03-26",
+	}
+	assert.NoError(t, store.Save(session, 90*time.Second))
+	var found *McpSession
+	var findErr error
+	assert.NoError(t, store.Find("http://backend/mcp", func(s *McpSession, err error) { found, findErr = s, err }))
+
+	callouts := host.GetRedisCalloutAttributesFromContext(contextID)
+	if assert.Len(t, callouts, 2) {
+		assert.Contains(t, string(callouts[0].Query), "mcp-sessions:weather:http://backend/mcp")
+		assert.Contains(t, string(callouts[0].Query), "90")
+		assert.Contains(t, string(callouts[0].Query), "X-Tenant")
+		assert.NotContains(t, string(callouts[0].Query), "secret", "credentials must not be stored in redis")
+		data, _ := json.Marshal(session)
+		host.CallOnRedisCallResponse(callouts[1].CalloutID, 0, test.CreateRedisRespString(string(data)))
+	}
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "s1", found.ID)
+		assert.Equal(t, "2025-03-26", found.ProtocolVersion)
+	}
+	assert.NoError(t, findErr)
+
+	assert.NoError(t, store.Find("http://backend/mcp", func(s *McpSession, err error) { found, findErr = s, err }))
+	callouts = host.GetRedisCalloutAttributesFromContext(contextID)
+	if assert.NotEmpty(t, callouts) {
+		host.CallOnRedisCallResponse(callouts[len(callouts)-1].CalloutID, 0, test.CreateRedisRespError("ERR connection lost"))
+	}
+	assert.Nil(t, found)
+	assert.ErrorContains(t, findErr, "ERR connection lost", "redis errors are reported, not taken for a missing session")
+}
+
+// TestSessionStoreConfig tests parsing of the backendSession.store option
+func TestSessionStoreConfig(t *testing.T) {
+	server, err := setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+		WithProxyBackend("http", "http://backend.example.com/mcp").
+		WithServerField("backendSession", map[string]interface{}{
+			"persist":          true,
+			"credentialSecret": "test-secret",
+			"store":            map[string]interface{}{"type": "redis", "serviceName": "redis.example.com", "servicePort": 6379, "keyPrefix": "sessions"},
+		})), "")
+	assert.NoError(t, err)
+	store, ok := server.GetSessionManager().GetStore().(*RedisSessionStore)
+	if assert.True(t, ok) {
+		assert.Equal(t, "sessions", store.config.KeyPrefix)
+		assert.Equal(t, int64(defaultSessionStoreTimeout), store.config.Timeout)
+	}
+
+	for config, pointer := range map[string]string{
+		`{"persist": true, "credentialSecret": "s", "store": {"type": "memcached", "serviceName": "a", "servicePort": 1}}`: "/backendSession/store/type",
+		`{"persist": true, "credentialSecret": "s", "store": {"type": "redis", "servicePort": 1}}`:                         "/backendSession/store/serviceName",
+		`{"persist": true, "credentialSecret": "s", "store": {"type": "redis", "serviceName": "a"}}`:                       "/backendSession/store/servicePort",
+		`{"store": {"type": "redis", "serviceName": "a", "servicePort": 1}}`:                                               "/backendSession/store",
+		`{"persist": true}`: "/backendSession/credentialSecret",
+	} {
+		_, err := setupMcpProxyServer("session-test", proxyServerJson(test.NewMCPServerConfig("session-test").
+			WithProxyBackend("http", "http://backend.example.com/mcp").
+			WithServerField("backendSession", json.RawMessage(config))), "")
+		assert.ErrorContains(t, err, `"`+pointer+`"`, config)
+	}
+}
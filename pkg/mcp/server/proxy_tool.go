@@ -15,21 +15,19 @@
 package server
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
 	"github.com/higress-group/wasm-go/pkg/log"
 	"github.com/higress-group/wasm-go/pkg/mcp/utils"
 	"github.com/higress-group/wasm-go/pkg/wrapper"
 	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
 const (
@@ -58,9 +56,22 @@ const (
 
 // McpProtocolHandler handles MCP protocol initialization and communication
 type McpProtocolHandler struct {
-	backendURL string
-	timeout    int
-	sessionID  string
+	backendURL       string
+	timeout          int
+	sessionID        string
+	errorCodeMapping utils.StatusCodeMapping
+	sessionManager   *McpSessionManagerImpl // Set when backend sessions are persisted across requests
+	sessionReused    bool                   // True when sessionID was taken from sessionManager
+	credential       string                 // Fingerprint of the credentials of the request, persisted sessions are bound to it
+	clientCredential bool                   // True when the request carries credentials of the client, which are never persisted
+	deleteSession    bool                   // Terminate the backend session once the downstream stream is done
+	requestURL       string                 // Final URL of the last request sent through sendMcpRequest
+	requestHeaders   [][2]string            // Headers of the last request sent through sendMcpRequest
+	protocolVersion  string                 // Protocol version negotiated with the backend
+	transport        TransportProtocol      // Backend transport, requests go over the SSE channel for TransportSSE
+	proxyServer      *McpProxyServer        // Server the handler was created for, required by the SSE transport
+	backend          *McpBackend            // Backend of the pool the request talks to, nil without a pool
+	pool             *BackendPool           // Pool the backend health is reported to
 }
 
 // NewMcpProtocolHandler creates a new MCP protocol handler
@@ -71,36 +82,80 @@ func NewMcpProtocolHandler(backendURL string, timeout int) *McpProtocolHandler {
 	}
 }
 
-// parseSSEResponse parses Server-Sent Events format and extracts data field content
-func parseSSEResponse(sseData []byte) ([]byte, error) {
-	scanner := bufio.NewScanner(bytes.NewReader(sseData))
-	// Set max token size to 32MB to handle large messages
-	maxTokenSize := 32 * 1024 * 1024 // 32MB
-	scanner.Buffer(make([]byte, 0, 64*1024), maxTokenSize)
+// SetErrorCodeMapping sets the mapping used to translate backend HTTP status codes into JSON-RPC error codes
+func (h *McpProtocolHandler) SetErrorCodeMapping(mapping utils.StatusCodeMapping) {
+	h.errorCodeMapping = mapping
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+// SetTransport sets the transport used to talk to the backend
+func (h *McpProtocolHandler) SetTransport(transport TransportProtocol) {
+	h.transport = transport
+}
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, ":") {
+// parseSSEResponse parses Server-Sent Events format and extracts the JSON-RPC message carried in a data field.
+// Backends may emit notifications or requests on the stream before the response, so the first event whose
+// data is a JSON-RPC response is preferred, falling back to the first event that carries any data.
+func parseSSEResponse(sseData []byte) ([]byte, error) {
+	// Terminate the last event in case the stream was closed without a trailing blank line
+	remaining := make([]byte, 0, len(sseData)+2)
+	remaining = append(remaining, sseData...)
+	remaining = append(remaining, '\n', '\n')
+
+	var firstData []byte
+	for {
+		msg, rest, err := ParseSSEMessage(remaining)
+		if err != nil {
+			return nil, fmt.Errorf("error reading SSE data: %w", err)
+		}
+		if msg == nil {
+			break
+		}
+		remaining = rest
+		if msg.Data == "" {
 			continue
 		}
-
-		// Look for data field
-		if strings.HasPrefix(line, "data: ") {
-			dataContent := strings.TrimPrefix(line, "data: ")
-			return []byte(dataContent), nil
+		if isJsonRpcResponse([]byte(msg.Data)) {
+			return []byte(msg.Data), nil
+		}
+		if firstData == nil {
+			firstData = []byte(msg.Data)
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		if errors.Is(err, bufio.ErrTooLong) {
-			return nil, fmt.Errorf("SSE response line exceeds maximum token size (32MB): %w", err)
+	if firstData != nil {
+		return firstData, nil
+	}
+	return nil, fmt.Errorf("no data field found in SSE response")
+}
+
+// isJsonRpcResponse checks whether data is a JSON-RPC response rather than a request or notification
+func isJsonRpcResponse(data []byte) bool {
+	if !gjson.ValidBytes(data) {
+		return false
+	}
+	parsed := gjson.ParseBytes(data)
+	return parsed.Get("id").Exists() && (parsed.Get("result").Exists() || parsed.Get("error").Exists())
+}
+
+// isSSEResponse reports whether a backend response is an SSE stream. The body is sniffed when
+// the backend omits the content-type header.
+func isSSEResponse(responseHeaders [][2]string, responseBody []byte) bool {
+	for _, header := range responseHeaders {
+		if strings.EqualFold(header[0], "content-type") {
+			return wrapper.IsSSEContentType(header[1])
 		}
-		return nil, fmt.Errorf("error reading SSE data: %v", err)
 	}
+	return wrapper.DetectBodyType("", responseBody) == wrapper.BodyTypeSSE
+}
 
-	return nil, fmt.Errorf("no data field found in SSE response")
+// decodeBackendResponse returns the JSON-RPC payload of a Streamable HTTP backend response,
+// unwrapping it from the SSE frame when the backend answered with text/event-stream
+func decodeBackendResponse(responseHeaders [][2]string, responseBody []byte) ([]byte, error) {
+	if !isSSEResponse(responseHeaders, responseBody) {
+		return responseBody, nil
+	}
+	log.Debugf("Processing SSE response from backend")
+	return parseSSEResponse(responseBody)
 }
 
 // Initialize performs the MCP protocol initialization sequence asynchronously
@@ -116,6 +171,24 @@ func (h *McpProtocolHandler) Initialize(ctx wrapper.HttpContext, authInfo *Proxy
 		}
 	}
 
+	// Reuse a persisted backend session negotiated with the same credentials instead of initializing again
+	if h.sessionManager != nil {
+		h.credential, h.clientCredential = h.sessionManager.sessionCredential(authInfo)
+	}
+	if h.reusePersistedSession(ctx) {
+		h.executePendingOperation(ctx)
+		return nil
+	}
+
+	// Look up a session negotiated by another gateway instance before initializing again
+	if h.fetchStoredSession(ctx, authInfo) {
+		return nil
+	}
+	return h.initializeBackend(ctx, authInfo)
+}
+
+// initializeBackend negotiates a new session with the backend
+func (h *McpProtocolHandler) initializeBackend(ctx wrapper.HttpContext, authInfo *ProxyAuthInfo) error {
 	// Step 1: Send initialize request
 	initRequest := h.createInitializeRequest()
 	requestBody, err := json.Marshal(initRequest)
@@ -129,42 +202,21 @@ func (h *McpProtocolHandler) Initialize(ctx wrapper.HttpContext, authInfo *Proxy
 		// or sendInitializedNotification will continue the async flow
 		if statusCode != 200 {
 			log.Errorf("Initialize request failed with status %d: %s", statusCode, string(responseBody))
-			utils.OnMCPResponseError(ctx, fmt.Errorf("backend initialization failed"), utils.ErrInternalError, "mcp-proxy:initialize:backend_error")
+			utils.OnMCPResponseError(ctx, fmt.Errorf("backend initialization failed, status: %d", statusCode), h.errorCodeMapping.ErrorCode(statusCode), "mcp-proxy:initialize:backend_error")
 			return
 		}
 
-		// Determine response content type and parse accordingly
-		var jsonResponseBody []byte
-		var contentType string
-
-		// Find content-type header
-		for _, header := range responseHeaders {
-			if strings.ToLower(header[0]) == "content-type" {
-				contentType = strings.ToLower(header[1])
-				break
-			}
-		}
-
-		// Parse response based on content type
-		if strings.Contains(contentType, "text/event-stream") {
-			// Handle SSE format
-			log.Debugf("Processing SSE response for initialize request")
-			parsedJSON, err := parseSSEResponse(responseBody)
-			if err != nil {
-				log.Errorf("Failed to parse SSE response: %v", err)
-				utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:initialize:sse_parse_error")
-				return
-			}
-			jsonResponseBody = parsedJSON
-		} else {
-			// Handle JSON format (default)
-			log.Debugf("Processing JSON response for initialize request")
-			jsonResponseBody = responseBody
+		// Unwrap the JSON-RPC message if the backend answered with an SSE stream
+		jsonResponseBody, err := decodeBackendResponse(responseHeaders, responseBody)
+		if err != nil {
+			log.Errorf("Failed to parse SSE response for initialize request: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:initialize:sse_parse_error")
+			return
 		}
 
 		// Parse initialize response
 		var response map[string]interface{}
-		if err := json.Unmarshal(jsonResponseBody, &response); err != nil {
+		if err := utils.UnmarshalJSON(jsonResponseBody, &response); err != nil {
 			log.Errorf("Failed to parse initialize response: %v", err)
 			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:initialize:parse_error")
 			return
@@ -176,7 +228,7 @@ func (h *McpProtocolHandler) Initialize(ctx wrapper.HttpContext, authInfo *Proxy
 
 			// Check if it's a version compatibility error
 			if errorMap, ok := errorObj.(map[string]interface{}); ok {
-				if code, codeOk := errorMap["code"]; codeOk && code == -32602 {
+				if code, codeOk := errorMap["code"]; codeOk && utils.NumberEquals(code, utils.ErrInvalidParams) {
 					// Protocol version not supported
 					utils.OnMCPResponseError(ctx, fmt.Errorf("protocol version not supported by backend"), utils.ErrInvalidParams, "mcp-proxy:initialize:version_incompatible")
 					return
@@ -187,15 +239,21 @@ func (h *McpProtocolHandler) Initialize(ctx wrapper.HttpContext, authInfo *Proxy
 			return
 		}
 
+		if result, ok := response["result"].(map[string]interface{}); ok {
+			h.protocolVersion, _ = result["protocolVersion"].(string)
+		}
+
 		// Extract session ID from response headers if present
 		for _, header := range responseHeaders {
-			if header[0] == "Mcp-Session-Id" {
+			if strings.EqualFold(header[0], "Mcp-Session-Id") {
 				h.sessionID = header[1]
 				ctx.SetContext(CtxMcpProxySessionID, h.sessionID)
 				log.Infof("Received MCP session ID: %s", h.sessionID)
 				break
 			}
 		}
+		h.persistSession(authInfo)
+		h.scheduleSessionDelete(ctx)
 
 		// Step 2: Send notifications/initialized
 		h.sendInitializedNotification(ctx, authInfo)
@@ -217,6 +275,11 @@ func (h *McpProtocolHandler) ForwardToolsList(ctx wrapper.HttpContext, cursor *s
 		ctx.SetContext("mcp_proxy_auth_info", authInfo)
 	}
 
+	// Legacy SSE backends negotiate the session on the SSE channel opened by the current request
+	if h.transport == TransportSSE {
+		return h.forwardOverSSE(ctx, h.createToolsListRequest(cursor), authInfo)
+	}
+
 	// Check if MCP is already initialized
 	if initialized := ctx.GetContext(CtxMcpProxyInitialized); initialized != nil {
 		// Already initialized, execute directly
@@ -250,6 +313,7 @@ func (h *McpProtocolHandler) executeToolsList(ctx wrapper.HttpContext) error {
 	if h.sessionID != "" {
 		headers = append(headers, [2]string{"Mcp-Session-Id", h.sessionID})
 	}
+	utils.SetCorrelationIDHeader(ctx, &headers)
 
 	// Start with the original backend URL
 	finalURL := h.backendURL
@@ -269,57 +333,36 @@ func (h *McpProtocolHandler) executeToolsList(ctx wrapper.HttpContext) error {
 		}
 	}
 
-	// Use RouteCall for the final tools/list request with potentially modified URL
-	return ctx.RouteCall("POST", finalURL, headers, requestBody, func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+	// Send the final tools/list request with potentially modified URL
+	return h.postToBackend(ctx, finalURL, headers, requestBody, func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+		if h.retryWithNewSession(ctx, statusCode) {
+			return
+		}
 		if statusCode != 200 {
 			log.Errorf("Tools/list request failed with status %d: %s", statusCode, string(responseBody))
-			utils.OnMCPResponseError(ctx, fmt.Errorf("backend tools/list failed"), utils.ErrInternalError, "mcp-proxy:tools/list:backend_error")
+			utils.OnMCPResponseError(ctx, fmt.Errorf("backend tools/list failed, status: %d", statusCode), h.errorCodeMapping.ErrorCode(statusCode), "mcp-proxy:tools/list:backend_error")
 			return
 		}
 
-		// Determine response content type and parse accordingly
-		var jsonResponseBody []byte
-		var contentType string
-
-		// Find content-type header
-		for _, header := range responseHeaders {
-			if strings.ToLower(header[0]) == "content-type" {
-				contentType = strings.ToLower(header[1])
-				break
-			}
-		}
-
-		// Parse response based on content type
-		if strings.Contains(contentType, "text/event-stream") {
-			// Handle SSE format
-			log.Debugf("Processing SSE response for tools/list request")
-			parsedJSON, err := parseSSEResponse(responseBody)
-			if err != nil {
-				log.Errorf("Failed to parse SSE response: %v", err)
-				utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/list:sse_parse_error")
-				return
-			}
-			jsonResponseBody = parsedJSON
-		} else {
-			// Handle JSON format (default)
-			log.Debugf("Processing JSON response for tools/list request")
-			jsonResponseBody = responseBody
+		// Unwrap the JSON-RPC message if the backend answered with an SSE stream
+		jsonResponseBody, err := decodeBackendResponse(responseHeaders, responseBody)
+		if err != nil {
+			log.Errorf("Failed to parse SSE response for tools/list request: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/list:sse_parse_error")
+			return
 		}
 
-		// Parse response and forward to client
-		var response map[string]interface{}
-		if err := json.Unmarshal(jsonResponseBody, &response); err != nil {
-			log.Errorf("Failed to parse tools/list response: %v", err)
-			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/list:parse_error")
+		if !gjson.ValidBytes(jsonResponseBody) {
+			log.Errorf("Failed to parse tools/list response: %s", string(jsonResponseBody))
+			utils.OnMCPResponseError(ctx, fmt.Errorf("invalid JSON response"), utils.ErrInternalError, "mcp-proxy:tools/list:parse_error")
 			return
 		}
 
-		// Forward the tools/list result with allowTools filtering
-		if result, hasResult := response["result"]; hasResult {
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				// Apply allowTools filtering if needed
-				filteredResult := h.applyAllowToolsFilter(ctx, resultMap)
-				utils.OnMCPResponseSuccess(ctx, filteredResult, "mcp-proxy:tools/list:success")
+		// Forward the raw tools/list result with allowTools filtering, so that fields unknown to the proxy are preserved
+		if result := gjson.GetBytes(jsonResponseBody, "result"); result.Exists() {
+			if result.IsObject() {
+				storeToolsListResult(ctx, []byte(result.Raw))
+				utils.OnMCPResponseRawSuccess(ctx, filterAllowedTools(exposedTools(ctx, result), effectiveAllowTools(ctx), toolPermissionsOf(ctx)), "mcp-proxy:tools/list:success")
 			} else {
 				utils.OnMCPResponseError(ctx, fmt.Errorf("invalid tools/list result type"), utils.ErrInternalError, "mcp-proxy:tools/list:invalid_type")
 			}
@@ -341,6 +384,11 @@ func (h *McpProtocolHandler) ForwardToolsCall(ctx wrapper.HttpContext, toolName
 		ctx.SetContext("mcp_proxy_auth_info", authInfo)
 	}
 
+	// Legacy SSE backends negotiate the session on the SSE channel opened by the current request
+	if h.transport == TransportSSE {
+		return h.forwardOverSSE(ctx, h.createToolsCallRequest(toolName, arguments), authInfo)
+	}
+
 	// Check if MCP is already initialized
 	if initialized := ctx.GetContext(CtxMcpProxyInitialized); initialized != nil {
 		// Already initialized, execute directly
@@ -371,6 +419,7 @@ func (h *McpProtocolHandler) executeToolsCall(ctx wrapper.HttpContext) error {
 	if h.sessionID != "" {
 		headers = append(headers, [2]string{"Mcp-Session-Id", h.sessionID})
 	}
+	utils.SetCorrelationIDHeader(ctx, &headers)
 
 	// Start with the original backend URL
 	finalURL := h.backendURL
@@ -390,69 +439,49 @@ func (h *McpProtocolHandler) executeToolsCall(ctx wrapper.HttpContext) error {
 		}
 	}
 
-	// Use RouteCall for the final tools/call request with potentially modified URL
-	return ctx.RouteCall("POST", finalURL, headers, requestBody, func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+	// Send the final tools/call request with potentially modified URL
+	return h.postToBackend(ctx, finalURL, headers, requestBody, func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
+		if h.retryWithNewSession(ctx, statusCode) {
+			return
+		}
 		if statusCode != 200 {
 			log.Errorf("Tools/call request failed with status %d: %s", statusCode, string(responseBody))
-			utils.OnMCPResponseError(ctx, fmt.Errorf("backend tools/call failed"), utils.ErrInternalError, "mcp-proxy:tools/call:backend_error")
+			utils.OnMCPResponseError(ctx, fmt.Errorf("backend tools/call failed, status: %d", statusCode), h.errorCodeMapping.ErrorCode(statusCode), "mcp-proxy:tools/call:backend_error")
 			return
 		}
 
-		// Determine response content type and parse accordingly
-		var jsonResponseBody []byte
-		var contentType string
-
-		// Find content-type header
-		for _, header := range responseHeaders {
-			if strings.ToLower(header[0]) == "content-type" {
-				contentType = strings.ToLower(header[1])
-				break
-			}
-		}
-
-		// Parse response based on content type
-		if strings.Contains(contentType, "text/event-stream") {
-			// Handle SSE format
-			log.Debugf("Processing SSE response for tools/call request")
-			parsedJSON, err := parseSSEResponse(responseBody)
-			if err != nil {
-				log.Errorf("Failed to parse SSE response: %v", err)
-				utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/call:sse_parse_error")
-				return
-			}
-			jsonResponseBody = parsedJSON
-		} else {
-			// Handle JSON format (default)
-			log.Debugf("Processing JSON response for tools/call request")
-			jsonResponseBody = responseBody
+		// Unwrap the JSON-RPC message if the backend answered with an SSE stream
+		jsonResponseBody, err := decodeBackendResponse(responseHeaders, responseBody)
+		if err != nil {
+			log.Errorf("Failed to parse SSE response for tools/call request: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/call:sse_parse_error")
+			return
 		}
 
-		// Parse response and check for backend errors (single unmarshal)
-		parsedResponse, isError, errorType := ParseBackendResponse(jsonResponseBody)
-		if parsedResponse == nil {
+		if !gjson.ValidBytes(jsonResponseBody) {
 			log.Errorf("Failed to parse tools/call response")
 			utils.OnMCPResponseError(ctx, fmt.Errorf("invalid JSON response"), utils.ErrInternalError, "mcp-proxy:tools/call:parse_error")
 			return
 		}
 
 		// Log backend errors for observability
-		if isError {
+		if isError, errorType := IsBackendError(jsonResponseBody); isError {
 			log.Warnf("Backend reported %s for %s", errorType, toolName)
 		}
 
-		// Forward the tools/call result (pass through both success and error responses)
-		if result, hasResult := parsedResponse["result"]; hasResult {
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				utils.OnMCPResponseSuccess(ctx, resultMap, "mcp-proxy:tools/call:success")
+		// Forward the raw tools/call result (pass through both success and error responses)
+		if result := gjson.GetBytes(jsonResponseBody, "result"); result.Exists() {
+			if result.IsObject() {
+				utils.OnMCPResponseRawSuccess(ctx, []byte(result.Raw), "mcp-proxy:tools/call:success")
 			} else {
 				utils.OnMCPResponseError(ctx, fmt.Errorf("invalid tools/call result type"), utils.ErrInternalError, "mcp-proxy:tools/call:invalid_type")
 			}
-		} else if errorField, hasError := parsedResponse["error"]; hasError {
+		} else if errorField := gjson.GetBytes(jsonResponseBody, "error"); errorField.Exists() {
 			// Pass through JSON-RPC error as MCP error
-			if errorMap, ok := errorField.(map[string]interface{}); ok {
+			if errorField.IsObject() {
 				errorMsg := "Backend error"
-				if msg, hasMsg := errorMap["message"]; hasMsg {
-					errorMsg = fmt.Sprintf("%v", msg)
+				if msg := errorField.Get("message"); msg.Exists() {
+					errorMsg = msg.String()
 				}
 				utils.OnMCPResponseError(ctx, fmt.Errorf("%s", errorMsg), utils.ErrInternalError, "mcp-proxy:tools/call:backend_error")
 			} else {
@@ -477,6 +506,10 @@ func (h *McpProtocolHandler) sendMcpRequest(ctx wrapper.HttpContext, body []byte
 	if h.sessionID != "" {
 		ensureHeader(&headers, "Mcp-Session-Id", h.sessionID)
 	}
+	if h.protocolVersion != "" {
+		ensureHeader(&headers, "MCP-Protocol-Version", h.protocolVersion)
+	}
+	utils.SetCorrelationIDHeader(ctx, &headers)
 
 	// Start with the original backend URL
 	finalURL := h.backendURL
@@ -499,23 +532,24 @@ func (h *McpProtocolHandler) sendMcpRequest(ctx wrapper.HttpContext, body []byte
 		timeout = 5000 // Default 5 seconds
 	}
 
-	// Create HTTP client using RouteCluster
-	client := wrapper.NewClusterClient(wrapper.RouteCluster{})
+	client := h.backendClient()
 
 	// Convert callback to the expected format
 	wrappedCallback := func(statusCode int, responseHeaders http.Header, responseBody []byte) {
-		// Convert http.Header to [][2]string format
-		headerSlice := make([][2]string, 0, len(responseHeaders))
-		for key, values := range responseHeaders {
-			if len(values) > 0 {
-				headerSlice = append(headerSlice, [2]string{key, values[0]})
-			}
-		}
-		callback(statusCode, headerSlice, responseBody)
+		h.reportBackend(statusCode)
+		callback(statusCode, toHeaderSlice(responseHeaders), responseBody)
 	}
 
+	// Remember what was sent so that a persisted session can be kept alive with the same credentials
+	h.requestURL = finalURL
+	h.requestHeaders = append([][2]string(nil), headers...)
+
 	// All MCP requests use POST method with potentially modified URL
-	return client.Post(finalURL, headers, body, wrappedCallback, timeout)
+	err := client.Post(finalURL, headers, body, wrappedCallback, timeout)
+	if err != nil {
+		h.reportBackend(0)
+	}
+	return err
 }
 
 // createInitializeRequest creates an MCP initialize request
@@ -566,32 +600,37 @@ func (h *McpProtocolHandler) sendInitializedNotification(ctx wrapper.HttpContext
 		ctx.SetContext(CtxMcpProxyInitialized, true)
 
 		// Now execute the originally requested operation
-		operation := ctx.GetContext(CtxMcpProxyOperation)
-		if operation != nil {
-			switch operation.(McpProxyOperation) {
-			case OpToolsList:
-				if err := h.executeToolsList(ctx); err != nil {
-					log.Errorf("Failed to execute tools/list: %v", err)
-					utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/list:execution_error")
-				}
-			case OpToolsCall:
-				if err := h.executeToolsCall(ctx); err != nil {
-					log.Errorf("Failed to execute tools/call: %v", err)
-					utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/call:execution_error")
-				}
-			default:
-				log.Warnf("Unknown MCP proxy operation: %v", operation)
-				utils.OnMCPResponseError(ctx, fmt.Errorf("unknown operation"), utils.ErrInternalError, "mcp-proxy:unknown_operation")
-			}
-		} else {
-			// No pending operation, just complete the initialization
-			log.Debugf("MCP initialization completed, no pending operation")
-		}
+		h.executePendingOperation(ctx)
 	})
 
 	if err != nil {
 		log.Errorf("Failed to send initialized notification: %v", err)
-		utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:notifications/initialized:send_error")
+		utils.OnMCPResponseError(ctx, err, utils.CalloutErrorCode(err), "mcp-proxy:notifications/initialized:send_error")
+	}
+}
+
+// executePendingOperation executes the operation stored in the context once a backend session is available
+func (h *McpProtocolHandler) executePendingOperation(ctx wrapper.HttpContext) {
+	operation := ctx.GetContext(CtxMcpProxyOperation)
+	if operation == nil {
+		// No pending operation, just complete the initialization
+		log.Debugf("MCP initialization completed, no pending operation")
+		return
+	}
+	switch operation.(McpProxyOperation) {
+	case OpToolsList:
+		if err := h.executeToolsList(ctx); err != nil {
+			log.Errorf("Failed to execute tools/list: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.CalloutErrorCode(err), "mcp-proxy:tools/list:execution_error")
+		}
+	case OpToolsCall:
+		if err := h.executeToolsCall(ctx); err != nil {
+			log.Errorf("Failed to execute tools/call: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.CalloutErrorCode(err), "mcp-proxy:tools/call:execution_error")
+		}
+	default:
+		log.Warnf("Unknown MCP proxy operation: %v", operation)
+		utils.OnMCPResponseError(ctx, fmt.Errorf("unknown operation"), utils.ErrInternalError, "mcp-proxy:unknown_operation")
 	}
 }
 
@@ -627,7 +666,7 @@ func (h *McpProtocolHandler) createToolsCallRequest(toolName string, arguments m
 // ParseBackendResponse parses the response body and checks if it's a backend error
 // Returns the parsed response, whether it's an error, and the error type
 func ParseBackendResponse(responseBody []byte) (response map[string]interface{}, isError bool, errorType string) {
-	if err := json.Unmarshal(responseBody, &response); err != nil {
+	if err := utils.UnmarshalJSON(responseBody, &response); err != nil {
 		return nil, false, ""
 	}
 
@@ -651,84 +690,26 @@ func ParseBackendResponse(responseBody []byte) (response map[string]interface{},
 // IsBackendError checks if the response is a backend error (JSON-RPC 2.0 error or result.isError)
 // Returns true if it's an error response, and the error type ("jsonrpc_error" or "result_isError")
 func IsBackendError(responseBody []byte) (isError bool, errorType string) {
-	_, isError, errorType = ParseBackendResponse(responseBody)
-	return isError, errorType
-}
-
-// McpSession represents a temporary MCP session
-type McpSession struct {
-	ID         string
-	BackendURL string
-	CreatedAt  time.Time
-	LastUsed   time.Time
-}
-
-// McpSessionManagerImpl manages temporary MCP sessions
-type McpSessionManagerImpl struct {
-	sessions map[string]*McpSession
-}
-
-// NewMcpSessionManagerImpl creates a new session manager
-func NewMcpSessionManagerImpl() *McpSessionManagerImpl {
-	return &McpSessionManagerImpl{
-		sessions: make(map[string]*McpSession),
-	}
-}
-
-// CreateSession creates a new temporary session
-func (m *McpSessionManagerImpl) CreateSession(backendURL string) (string, error) {
-	sessionID := fmt.Sprintf("mcp-session-%d", time.Now().UnixNano())
-	session := &McpSession{
-		ID:         sessionID,
-		BackendURL: backendURL,
-		CreatedAt:  time.Now(),
-		LastUsed:   time.Now(),
+	if !gjson.ValidBytes(responseBody) {
+		return false, ""
 	}
-
-	m.sessions[sessionID] = session
-	log.Debugf("Created MCP session %s for %s", sessionID, backendURL)
-
-	return sessionID, nil
-}
-
-// GetSession retrieves a session by ID
-func (m *McpSessionManagerImpl) GetSession(sessionID string) (*McpSession, bool) {
-	session, exists := m.sessions[sessionID]
-	if exists {
-		session.LastUsed = time.Now()
+	response := gjson.ParseBytes(responseBody)
+	if !response.IsObject() {
+		return false, ""
 	}
-	return session, exists
-}
-
-// CleanupSession removes a session
-func (m *McpSessionManagerImpl) CleanupSession(sessionID string) {
-	if _, exists := m.sessions[sessionID]; exists {
-		delete(m.sessions, sessionID)
-		log.Debugf("Cleaned up MCP session %s", sessionID)
+	if response.Get("error").Exists() {
+		return true, "jsonrpc_error"
 	}
-}
-
-// CleanupExpiredSessions removes sessions older than specified duration
-func (m *McpSessionManagerImpl) CleanupExpiredSessions(maxAge time.Duration) {
-	now := time.Now()
-	for sessionID, session := range m.sessions {
-		if now.Sub(session.LastUsed) > maxAge {
-			delete(m.sessions, sessionID)
-			log.Debugf("Cleaned up expired MCP session %s", sessionID)
-		}
+	if response.Get("result.isError").Type == gjson.True {
+		return true, "result_isError"
 	}
+	return false, ""
 }
 
 // CreateMcpProxyMethodHandlers creates JSON-RPC method handlers for MCP proxy operations
 func CreateMcpProxyMethodHandlers(server *McpProxyServer, allowTools *map[string]struct{}) utils.MethodHandlers {
 	return utils.MethodHandlers{
 		"tools/list": func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
-			// Check transport type
-			if server.GetTransport() == TransportSSE {
-				return handleSSEToolsList(ctx, id, params, server, allowTools)
-			}
-
-			// StreamableHTTP transport (original logic)
 			// Extract cursor parameter if present
 			var cursor *string
 			if cursorResult := params.Get("cursor"); cursorResult.Exists() {
@@ -753,17 +734,12 @@ func CreateMcpProxyMethodHandlers(server *McpProxyServer, allowTools *map[string
 				return err
 			}
 
-			// Signal that we need to pause and wait for async response
-			ctx.SetContext(utils.CtxNeedPause, true)
+			// Signal that we need to pause and wait for async response, unless the request
+			// continues upstream to open the SSE channel of a legacy SSE backend
+			ctx.SetContext(utils.CtxNeedPause, !isSSEChannelOpened(ctx))
 			return nil
 		},
 		"tools/call": func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
-			// Check transport type
-			if server.GetTransport() == TransportSSE {
-				return handleSSEToolsCall(ctx, id, params, server, allowTools)
-			}
-
-			// StreamableHTTP transport (original logic)
 			// Extract tool name and arguments
 			toolName := params.Get("name").String()
 			if toolName == "" {
@@ -785,7 +761,7 @@ func CreateMcpProxyMethodHandlers(server *McpProxyServer, allowTools *map[string
 			arguments := make(map[string]interface{})
 			argsResult := params.Get("arguments")
 			if argsResult.Exists() {
-				if err := json.Unmarshal([]byte(argsResult.Raw), &arguments); err != nil {
+				if err := utils.UnmarshalJSON([]byte(argsResult.Raw), &arguments); err != nil {
 					return fmt.Errorf("invalid arguments: %v", err)
 				}
 			}
@@ -794,18 +770,41 @@ func CreateMcpProxyMethodHandlers(server *McpProxyServer, allowTools *map[string
 			proxywasm.SetProperty([]string{"mcp_server_name"}, []byte(server.Name))
 			proxywasm.SetProperty([]string{"mcp_tool_name"}, []byte(toolName))
 
+			// Resolve the backend name of a tool renamed with exposeAs, whose backend name is not exposed
+			backendToolName, exposed := server.backendToolName(toolName)
+			if !exposed {
+				utils.OnMCPResponseError(ctx, fmt.Errorf("unknown tool: %s", toolName), utils.ErrInvalidParams, fmt.Sprintf("mcp-proxy:%s:tools/call:unknown_tool", server.Name))
+				return nil
+			}
+
 			// Create a tool instance and call it
 			toolConfig, exists := server.GetToolConfig(toolName)
 			if !exists {
 				log.Warnf("tool not found: %s, will not use tool specifiy security config", toolName)
 			}
 
-			// Debug logging (consistent with default handler)
-			log.Debugf("Tool call [%s] on server [%s] with arguments[%s]", toolName, server.Name, argsResult.Raw)
+			// Merge the configured arguments, e.g. the tenant of the caller, into the arguments of the client
+			if err := injectArguments(server, toolConfig.InjectArgs, arguments); err != nil {
+				if errors.Is(err, errArgumentConflict) {
+					utils.OnMCPResponseError(ctx, err, utils.ErrInvalidParams, fmt.Sprintf("mcp-proxy:%s:tools/call:argument_conflict", server.Name))
+					return nil
+				}
+				return err
+			}
+
+			// Validate the arguments the backend receives against the input schema of the configured tool
+			if server.ValidatesArguments() && exists {
+				if err := validateProxiedArguments(server.GetMCPTools()[toolName], arguments); err != nil {
+					onInvalidArguments(ctx, "mcp-proxy:"+server.Name, err)
+					return nil
+				}
+			}
+
+			log.Debugf("Tool call [%s] on server [%s]", toolName, server.Name)
 
 			tool := &McpProxyTool{
 				serverName: server.Name,
-				name:       toolName,
+				name:       backendToolName,
 				toolConfig: toolConfig,
 				arguments:  arguments,
 			}
@@ -816,60 +815,66 @@ func CreateMcpProxyMethodHandlers(server *McpProxyServer, allowTools *map[string
 				return err
 			}
 
-			// Signal that we need to pause and wait for async response
-			ctx.SetContext(utils.CtxNeedPause, true)
+			// Signal that we need to pause and wait for async response, unless the request
+			// continues upstream to open the SSE channel of a legacy SSE backend
+			ctx.SetContext(utils.CtxNeedPause, !isSSEChannelOpened(ctx))
 			return nil
 		},
 	}
 }
 
-// applyAllowToolsFilter applies allowTools filtering to the tools/list response
-func (h *McpProtocolHandler) applyAllowToolsFilter(ctx wrapper.HttpContext, resultMap map[string]interface{}) map[string]interface{} {
-	// Get pre-computed effective allowTools from context
-	var effectiveAllowTools *map[string]struct{}
-	if allowToolsCtx := ctx.GetContext("mcp_proxy_effective_allow_tools"); allowToolsCtx != nil {
-		if allowToolsPtr, ok := allowToolsCtx.(*map[string]struct{}); ok {
-			effectiveAllowTools = allowToolsPtr
-		}
+// effectiveAllowTools returns the pre-computed allowTools of the request, nil means all tools are allowed
+func effectiveAllowTools(ctx wrapper.HttpContext) *map[string]struct{} {
+	if allowTools, ok := ctx.GetContext("mcp_proxy_effective_allow_tools").(*map[string]struct{}); ok {
+		return allowTools
 	}
+	return nil
+}
 
-	// If no restrictions, return original result
-	if effectiveAllowTools == nil {
-		return resultMap
-	}
-
-	// Apply filtering to tools array
-	if tools, hasTools := resultMap["tools"]; hasTools {
-		if toolsArray, ok := tools.([]interface{}); ok {
-			filteredTools := make([]interface{}, 0)
-
-			for _, tool := range toolsArray {
-				if toolMap, ok := tool.(map[string]interface{}); ok {
-					if name, hasName := toolMap["name"]; hasName {
-						if toolName, ok := name.(string); ok {
-							// Check if tool is allowed
-							if _, allow := (*effectiveAllowTools)[toolName]; !allow {
-								continue
-							}
-							// Tool is allowed, add to filtered list
-							filteredTools = append(filteredTools, tool)
-						}
-					}
-				}
-			}
+// exposedTools applies the tool renames and description overrides of the proxy server of the request to a
+// tools/list result of the backend
+func exposedTools(ctx wrapper.HttpContext, result gjson.Result) gjson.Result {
+	if server, ok := ctx.GetContext("mcp_proxy_server").(*McpProxyServer); ok {
+		return server.exposeTools(result)
+	}
+	return result
+}
 
-			// Create new result with filtered tools
-			filteredResult := make(map[string]interface{})
-			for k, v := range resultMap {
-				filteredResult[k] = v
+// filterAllowedTools removes the tools that are not allowed, or that the caller is not granted the
+// scopes of, from a raw tools/list result, leaving every other field of the result and of the
+// allowed tools untouched
+func filterAllowedTools(result gjson.Result, allowTools *map[string]struct{}, permissions *toolPermissions) []byte {
+	raw := []byte(result.Raw)
+	tools := result.Get("tools")
+	if (allowTools == nil && permissions == nil) || !tools.IsArray() {
+		return raw
+	}
+	filtered := []byte{'['}
+	for _, tool := range tools.Array() {
+		name := tool.Get("name")
+		if name.Type != gjson.String {
+			continue
+		}
+		if allowTools != nil {
+			if _, allow := (*allowTools)[name.String()]; !allow {
+				continue
 			}
-			filteredResult["tools"] = filteredTools
-			return filteredResult
 		}
+		if !permissions.allows(name.String()) {
+			continue
+		}
+		if len(filtered) > 1 {
+			filtered = append(filtered, ',')
+		}
+		filtered = append(filtered, tool.Raw...)
 	}
-
-	// If tools array not found or invalid format, return original
-	return resultMap
+	filtered = append(filtered, ']')
+	raw, err := sjson.SetRawBytes(raw, "tools", filtered)
+	if err != nil {
+		log.Errorf("Failed to filter tools/list result: %v", err)
+		return []byte(result.Raw)
+	}
+	return raw
 }
 
 // applyProxyAuthentication applies authentication to the proxy request headers and URL
@@ -925,169 +930,6 @@ func (h *McpProtocolHandler) applyProxyAuthentication(server *McpProxyServer, sc
 	return urlStr, nil
 }
 
-// handleSSEToolsList handles tools/list request for SSE transport
-func handleSSEToolsList(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result, server *McpProxyServer, allowTools *map[string]struct{}) error {
-	// Extract allowTools from header and compute effective allowTools
-	allowToolsHeaderStr, _ := proxywasm.GetHttpRequestHeader("x-envoy-allow-mcp-tools")
-	proxywasm.RemoveHttpRequestHeader("x-envoy-allow-mcp-tools")
-	headerExists := allowToolsHeaderStr != ""
-	effectiveAllowTools := computeEffectiveAllowToolsFromHeader(allowTools, allowToolsHeaderStr, headerExists)
-
-	// Store server reference, effective allowTools, and JSON-RPC ID in context
-	ctx.SetContext("mcp_proxy_server", server)
-	ctx.SetContext("mcp_proxy_effective_allow_tools", effectiveAllowTools)
-
-	// Prepare request body for tools/list
-	listRequest := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      2,
-		"method":  "tools/list",
-		"params":  map[string]interface{}{},
-	}
-
-	if cursorResult := params.Get("cursor"); cursorResult.Exists() {
-		listRequest["params"].(map[string]interface{})["cursor"] = cursorResult.String()
-	}
-
-	requestBody, err := json.Marshal(listRequest)
-	if err != nil {
-		return fmt.Errorf("failed to marshal tools/list request: %v", err)
-	}
-
-	// Use common function to handle SSE request
-	return handleSSERequest(ctx, id, requestBody, server, server.GetDefaultDownstreamSecurity(), server.GetDefaultUpstreamSecurity())
-}
-
-// handleSSEToolsCall handles tools/call request for SSE transport
-func handleSSEToolsCall(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result, server *McpProxyServer, allowTools *map[string]struct{}) error {
-	// Extract tool name and arguments
-	toolName := params.Get("name").String()
-	if toolName == "" {
-		return fmt.Errorf("missing tool name")
-	}
-
-	// Compute effective allowTools
-	effectiveAllowTools := computeEffectiveAllowTools(allowTools)
-
-	// Check if tool is allowed
-	if effectiveAllowTools != nil {
-		if _, allow := (*effectiveAllowTools)[toolName]; !allow {
-			utils.OnMCPResponseError(ctx, fmt.Errorf("Tool not allowed: %s", toolName), utils.ErrInvalidParams, fmt.Sprintf("mcp-proxy:%s:tools/call:tool_not_allowed", server.Name))
-			return nil
-		}
-	}
-
-	// Store server reference in context
-	ctx.SetContext("mcp_proxy_server", server)
-
-	// Extract arguments
-	arguments := make(map[string]interface{})
-	argsResult := params.Get("arguments")
-	if argsResult.Exists() {
-		if err := json.Unmarshal([]byte(argsResult.Raw), &arguments); err != nil {
-			return fmt.Errorf("invalid arguments: %v", err)
-		}
-	}
-
-	// Set properties for monitoring
-	proxywasm.SetProperty([]string{"mcp_server_name"}, []byte(server.Name))
-	proxywasm.SetProperty([]string{"mcp_tool_name"}, []byte(toolName))
-
-	log.Debugf("Tool call [%s] on server [%s] with arguments[%s]", toolName, server.Name, argsResult.Raw)
-
-	// Prepare request body for tools/call
-	// Use id: 2 because initialize uses id: 1, and we only send one tool request (list or call)
-	callRequest := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"id":      2,
-		"method":  "tools/call",
-		"params": map[string]interface{}{
-			"name":      toolName,
-			"arguments": arguments,
-		},
-	}
-
-	requestBody, err := json.Marshal(callRequest)
-	if err != nil {
-		return fmt.Errorf("failed to marshal tools/call request: %v", err)
-	}
-
-	// Get tool config for tool-level security
-	toolConfig, _ := server.GetToolConfig(toolName)
-
-	// Determine downstream and upstream security (tool-level or server default)
-	var downstreamSecurity SecurityRequirement
-	if toolConfig.Security.ID != "" {
-		downstreamSecurity = toolConfig.Security
-	} else {
-		downstreamSecurity = server.GetDefaultDownstreamSecurity()
-	}
-
-	var upstreamSecurity SecurityRequirement
-	if toolConfig.RequestTemplate.Security.ID != "" {
-		upstreamSecurity = toolConfig.RequestTemplate.Security
-	} else {
-		upstreamSecurity = server.GetDefaultUpstreamSecurity()
-	}
-
-	// Use common function to handle SSE request
-	return handleSSERequest(ctx, id, requestBody, server, downstreamSecurity, upstreamSecurity)
-}
-
-// handleSSERequest is the common function to handle SSE requests for tools/list and tools/call
-func handleSSERequest(ctx wrapper.HttpContext, id utils.JsonRpcID, requestBody []byte, server *McpProxyServer, downstreamSecurity SecurityRequirement, upstreamSecurity SecurityRequirement) error {
-	// Store JSON-RPC ID in context
-	ctx.SetContext(CtxSSEProxyJsonRpcID, id)
-
-	// Store request body in context for later use
-	ctx.SetContext(CtxSSEProxyRequestBody, requestBody)
-
-	// Handle downstream security first (to extract and remove credentials before copying headers)
-	passthroughCredential := ""
-	if downstreamSecurity.ID != "" {
-		clientScheme, schemeOk := server.GetSecurityScheme(downstreamSecurity.ID)
-		if schemeOk {
-			extractedCred, err := ExtractAndRemoveIncomingCredential(clientScheme)
-			if err == nil && extractedCred != "" && downstreamSecurity.Passthrough {
-				passthroughCredential = extractedCred
-			}
-		}
-	} else {
-		// Fallback: Remove Authorization header if no downstream security is defined
-		// This prevents downstream credentials from being mistakenly passed to upstream
-		// Unless passthroughAuthHeader is explicitly set to true
-		if !server.GetPassthroughAuthHeader() {
-			proxywasm.RemoveHttpRequestHeader("Authorization")
-		}
-	}
-
-	// Prepare authentication info
-	var authInfo *ProxyAuthInfo
-	if upstreamSecurity.ID != "" {
-		authInfo = &ProxyAuthInfo{
-			SecuritySchemeID:      upstreamSecurity.ID,
-			PassthroughCredential: passthroughCredential,
-			Server:                server,
-		}
-	}
-
-	// Store auth info in context (headers will be copied directly in response phase)
-	ctx.SetContext(CtxSSEProxyAuthInfo, authInfo)
-
-	// Convert current request to SSE GET request
-	// The request will continue through the filter chain and be routed to backend
-	// The response will be handled by onHttpResponseHeaders and onHttpStreamingResponseBody
-	err := initiateSSEChannelInRequestPhase(ctx, server, authInfo)
-	if err != nil {
-		log.Errorf("Failed to convert request to SSE GET: %v", err)
-		return err
-	}
-
-	// Explicitly set to NOT pause - let the request continue to establish SSE channel
-	ctx.SetContext(utils.CtxNeedPause, false)
-	return nil
-}
-
 // initiateSSEChannelInRequestPhase modifies the current request to be a GET request for establishing SSE channel
 func initiateSSEChannelInRequestPhase(ctx wrapper.HttpContext, server *McpProxyServer, authInfo *ProxyAuthInfo) error {
 	// Copy original request headers
@@ -1263,6 +1105,7 @@ func copyAndCleanHeadersForSSE(ctx wrapper.HttpContext) [][2]string {
 
 	// Set/override Accept header for SSE
 	headers = append(headers, [2]string{"Accept", "text/event-stream"})
+	utils.SetCorrelationIDHeader(ctx, &headers)
 
 	log.Debugf("Prepared %d headers for SSE GET request", len(headers))
 	return headers
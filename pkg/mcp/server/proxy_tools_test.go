@@ -18,8 +18,13 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
 )
 
 // TestToolsListForwarding tests the tools/list request forwarding
@@ -341,6 +346,30 @@ data: {invalid json}
 			expectedData: `{invalid json}`,
 			shouldErr:    false,
 		},
+		{
+			name: "SSE with notification before response",
+			sseData: `event: message
+data: {"jsonrpc":"2.0","method":"notifications/progress","params":{"progress":1}}
+
+event: message
+data: {"jsonrpc":"2.0","id":4,"result":{"done":true}}
+
+`,
+			expectedData: `{"jsonrpc":"2.0","id":4,"result":{"done":true}}`,
+			shouldErr:    false,
+		},
+		{
+			name:         "SSE with multi-line data and no space after colon",
+			sseData:      "data:{\"jsonrpc\":\"2.0\",\"id\":5,\ndata:\"result\":{}}\n\n",
+			expectedData: "{\"jsonrpc\":\"2.0\",\"id\":5,\n\"result\":{}}",
+			shouldErr:    false,
+		},
+		{
+			name:         "SSE without trailing blank line",
+			sseData:      "event: message\r\ndata: {\"jsonrpc\":\"2.0\",\"id\":6,\"result\":{}}",
+			expectedData: `{"jsonrpc":"2.0","id":6,"result":{}}`,
+			shouldErr:    false,
+		},
 		{
 			name: "SSE with no data field",
 			sseData: `event: message
@@ -372,6 +401,43 @@ id: 123
 	}
 }
 
+// TestDecodeBackendResponse tests unwrapping of JSON and SSE backend responses
+func TestDecodeBackendResponse(t *testing.T) {
+	jsonBody := `{"jsonrpc":"2.0","id":1,"result":{}}`
+	tests := []struct {
+		name     string
+		headers  [][2]string
+		body     string
+		expected string
+	}{
+		{
+			name:     "plain JSON response",
+			headers:  [][2]string{{"Content-Type", "application/json"}},
+			body:     jsonBody,
+			expected: jsonBody,
+		},
+		{
+			name:     "SSE response with mixed case content type",
+			headers:  [][2]string{{"content-type", "Text/Event-Stream; charset=utf-8"}},
+			body:     "event: message\ndata: " + jsonBody + "\n\n",
+			expected: jsonBody,
+		},
+		{
+			name:     "SSE response without content type",
+			body:     "data: " + jsonBody + "\n\n",
+			expected: jsonBody,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := decodeBackendResponse(tt.headers, []byte(tt.body))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(result))
+		})
+	}
+}
+
 // TestIsBackendError tests detection of backend error responses
 func TestIsBackendError(t *testing.T) {
 	tests := []struct {
@@ -482,4 +548,136 @@ func TestIsBackendError(t *testing.T) {
 	}
 }
 
+// TestFilterAllowedTools tests that tools/list results are filtered without dropping unknown fields
+func TestFilterAllowedTools(t *testing.T) {
+	result := gjson.Parse(`{
+		"tools": [
+			{"name": "get_weather", "annotations": {"readOnlyHint": true}, "_meta": {"id": 9007199254740993}},
+			{"name": "delete_file"},
+			{"description": "no name"}
+		],
+		"nextCursor": "abc",
+		"_meta": {"x": 1}
+	}`)
+
+	assert.Equal(t, result.Raw, string(filterAllowedTools(result, nil, nil)))
+
+	allowTools := map[string]struct{}{"get_weather": {}}
+	filtered := filterAllowedTools(result, &allowTools, nil)
+	assert.JSONEq(t, `{
+		"tools": [{"name": "get_weather", "annotations": {"readOnlyHint": true}, "_meta": {"id": 9007199254740993}}],
+		"nextCursor": "abc",
+		"_meta": {"x": 1}
+	}`, string(filtered))
+	assert.Contains(t, string(filtered), "9007199254740993")
+
+	allowTools = map[string]struct{}{}
+	assert.Equal(t, "[]", gjson.GetBytes(filterAllowedTools(result, &allowTools, nil), "tools").Raw)
+}
+
 // ForwardToolsList is now implemented in proxy_server.go
+
+// TestExposeTools tests the renaming of backend tools with exposeAs and the description overrides
+func TestExposeTools(t *testing.T) {
+	server := NewMcpProxyServer("expose-test")
+	for _, raw := range []string{
+		`{"name": "search", "exposeAs": "catalog_search", "descriptionOverride": {"description": "Search the catalog", "args": {"q": "Keywords", "missing": "x"}}}`,
+		`{"name": "get_weather", "descriptionOverride": "Current weather"}`,
+	} {
+		var toolConfig McpProxyToolConfig
+		require.NoError(t, json.Unmarshal([]byte(raw), &toolConfig))
+		require.NoError(t, server.AddProxyTool(toolConfig))
+	}
+	assert.Error(t, server.AddProxyTool(McpProxyToolConfig{Name: "other", ExposeAs: "catalog_search"}))
+	assert.Error(t, server.AddProxyTool(McpProxyToolConfig{Name: "search", ExposeAs: "search2"}))
+
+	result := gjson.Parse(`{
+		"tools": [
+			{"name": "search", "description": "backend", "inputSchema": {"type": "object", "properties": {"q": {"type": "string"}, "limit": {"type": "integer"}}}},
+			{"name": "get_weather", "description": "backend"},
+			{"name": "catalog_search", "description": "shadowed by the renamed tool"},
+			{"name": "ping"}
+		],
+		"nextCursor": "abc"
+	}`)
+	assert.JSONEq(t, `{
+		"tools": [
+			{"name": "catalog_search", "description": "Search the catalog", "inputSchema": {"type": "object", "properties": {"q": {"type": "string", "description": "Keywords"}, "limit": {"type": "integer"}}}},
+			{"name": "get_weather", "description": "Current weather"},
+			{"name": "ping"}
+		],
+		"nextCursor": "abc"
+	}`, server.exposeTools(result).Raw)
+	assert.Equal(t, result.Raw, NewMcpProxyServer("plain").exposeTools(result).Raw)
+
+	for name, expected := range map[string]string{"catalog_search": "search", "get_weather": "get_weather", "ping": "ping"} {
+		backendName, ok := server.backendToolName(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, backendName)
+	}
+	_, ok := server.backendToolName("search")
+	assert.False(t, ok, "the backend name of a renamed tool is hidden")
+
+	tool := server.GetMCPTools()["catalog_search"]
+	require.NotNil(t, tool)
+	assert.Equal(t, "Search the catalog", tool.Description())
+	clone := server.Clone().(*McpProxyServer)
+	assert.Equal(t, "catalog_search", clone.renamedTools["search"])
+	assert.True(t, clone.rewritesToolsList)
+}
+
+// TestInjectArguments tests the merging of the injected arguments into the arguments of a tools/call
+func TestInjectArguments(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("inject-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+
+	server := NewMcpProxyServer("inject-test")
+	server.SetConfig([]byte(`{"region": "cn-hangzhou"}`))
+	var toolConfig McpProxyToolConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"name": "query", "injectArgs": [
+		{"name": "tenantId", "fromHeader": "x-tenant-id", "onConflict": "reject"},
+		{"name": "region", "template": "{{.config.region}}", "onConflict": "keep"},
+		{"name": "limit", "value": 10},
+		{"name": "operator", "fromHeader": "x-operator"}
+	]}`), &toolConfig))
+	require.NoError(t, server.AddProxyTool(toolConfig))
+	toolConfig, _ = server.GetToolConfig("query")
+
+	contextID := host.InitializeHttpContext()
+	defer host.CompleteHttpContext(contextID)
+	host.CallOnRequestHeaders(contextID, [][2]string{{":authority", "gateway"}, {":path", "/mcp"}, {"x-tenant-id", "acme"}}, false)
+
+	inject := func(raw string) (map[string]interface{}, error) {
+		arguments := map[string]interface{}{}
+		require.NoError(t, utils.UnmarshalJSON([]byte(raw), &arguments))
+		err := injectArguments(server, toolConfig.InjectArgs, arguments)
+		return arguments, err
+	}
+
+	arguments, err := inject(`{"q": "orders", "limit": 50, "operator": "root"}`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"q": "orders", "tenantId": "acme", "region": "cn-hangzhou", "limit": float64(10)}, arguments,
+		"limit is overridden and operator is removed as its header is absent")
+
+	arguments, err = inject(`{"tenantId": "acme", "region": "us-west-1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "us-west-1", arguments["region"])
+
+	_, err = inject(`{"tenantId": "other"}`)
+	assert.ErrorIs(t, err, errArgumentConflict)
+
+	for raw, message := range map[string]string{
+		`{"name": "a", "injectArgs": [{"value": 1}]}`:                                         `invalid config at "/injectArgs/0/name"`,
+		`{"name": "a", "injectArgs": [{"name": "x"}]}`:                                        `invalid config at "/injectArgs/0"`,
+		`{"name": "a", "injectArgs": [{"name": "x", "value": 1, "fromHeader": "x-a"}]}`:       `invalid config at "/injectArgs/0"`,
+		`{"name": "a", "injectArgs": [{"name": "x", "value": 1}, {"name": "x", "value": 2}]}`: `invalid config at "/injectArgs/1/name"`,
+		`{"name": "a", "injectArgs": [{"name": "x", "value": 1, "onConflict": "merge"}]}`:     `invalid config at "/injectArgs/0/onConflict"`,
+		`{"name": "a", "injectArgs": [{"name": "x", "template": "{{.args.q"}]}`:               `invalid config at "/injectArgs/0/template"`,
+	} {
+		var toolConfig McpProxyToolConfig
+		require.NoError(t, json.Unmarshal([]byte(raw), &toolConfig))
+		assert.ErrorContains(t, NewMcpProxyServer("inject-test").AddProxyTool(toolConfig), message, raw)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	defaultQuotaTimeout = 1000
+	// anonymousConsumer counts the calls of requests without authenticated consumer
+	anonymousConsumer = "anonymous"
+	// allToolsScope counts the calls of all tools together
+	allToolsScope = "*"
+)
+
+// QuotaLimit is the number of tools/call invocations allowed per minute and per day, 0 is unlimited
+type QuotaLimit struct {
+	PerMinute int64 `json:"perMinute"`
+	PerDay    int64 `json:"perDay"`
+}
+
+// QuotaConfig limits the tools/call invocations of every consumer, counted in Redis so that the
+// quota is shared by all gateway instances
+type QuotaConfig struct {
+	QuotaLimit
+	PerTool     bool                  `json:"perTool"`     // Apply the limits to every tool separately instead of all tools together
+	Tools       map[string]QuotaLimit `json:"tools"`       // Limits of single tools, on top of the limits of all tools or replacing them with perTool
+	ServiceName string                `json:"serviceName"` // FQDN of the Redis service, e.g. redis.default.svc.cluster.local
+	ServicePort int64                 `json:"servicePort"`
+	Username    string                `json:"username"`
+	Password    string                `json:"password"`
+	Database    int                   `json:"database"`
+	Timeout     int64                 `json:"timeout"`   // Milliseconds, defaults to 1000
+	KeyPrefix   string                `json:"keyPrefix"` // Defaults to mcp-quota:<server name>
+}
+
+// ToolQuota enforces the quota of the tools/call invocations of a server
+type ToolQuota struct {
+	config QuotaConfig
+	client *wrapper.RedisClusterClient[wrapper.FQDNCluster]
+}
+
+// quotaWindow is a limit of a call and what it applies to
+type quotaWindow struct {
+	wrapper.RateLimitWindow
+	name string // minute or day
+	tool string // empty when the limit applies to all tools
+}
+
+// parseQuota validates the quota config, the Redis client is created by init
+func parseQuota(serverName string, quotaJson gjson.Result) (*ToolQuota, error) {
+	var config QuotaConfig
+	if err := configerr.DecodeJSON("", []byte(quotaJson.Raw), &config); err != nil {
+		return nil, err
+	}
+	if config.ServiceName == "" {
+		return nil, configerr.New("/serviceName", "string", errors.New("quota serviceName is required"))
+	}
+	if config.ServicePort <= 0 {
+		return nil, configerr.New("/servicePort", "positive integer", errors.New("quota servicePort is required"))
+	}
+	if err := validateQuotaLimit("", config.QuotaLimit); err != nil {
+		return nil, err
+	}
+	limited := config.PerMinute > 0 || config.PerDay > 0
+	for tool, limit := range config.Tools {
+		if err := validateQuotaLimit(configerr.Join("/tools", tool), limit); err != nil {
+			return nil, err
+		}
+		limited = limited || limit.PerMinute > 0 || limit.PerDay > 0
+	}
+	if !limited {
+		return nil, configerr.New("/perMinute", "positive integer", errors.New("quota has no limit"))
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultQuotaTimeout
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "mcp-quota:" + serverName
+	}
+	return &ToolQuota{config: config}, nil
+}
+
+func validateQuotaLimit(pointer string, limit QuotaLimit) error {
+	if limit.PerMinute < 0 {
+		return configerr.Errorf(configerr.Join(pointer, "perMinute"), "non-negative integer", "got %d", limit.PerMinute)
+	}
+	if limit.PerDay < 0 {
+		return configerr.Errorf(configerr.Join(pointer, "perDay"), "non-negative integer", "got %d", limit.PerDay)
+	}
+	return nil
+}
+
+// init creates the Redis client, it must be called in the config phase
+func (q *ToolQuota) init() error {
+	client := wrapper.NewRedisClusterClient(wrapper.FQDNCluster{FQDN: q.config.ServiceName, Port: q.config.ServicePort})
+	if err := client.Init(q.config.Username, q.config.Password, q.config.Timeout, wrapper.WithDataBase(q.config.Database)); err != nil {
+		return fmt.Errorf("failed to init quota redis client: %w", err)
+	}
+	q.client = client
+	return nil
+}
+
+// windows returns the limits of a call of the tool by the consumer, the keys of a consumer share a
+// hash tag so that they can be counted at once with Redis Cluster
+func (q *ToolQuota) windows(consumer, tool string) []quotaWindow {
+	var windows []quotaWindow
+	add := func(limit QuotaLimit, scope string) {
+		prefix := fmt.Sprintf("%s:{%s}:%s", q.config.KeyPrefix, consumer, scope)
+		if scope == allToolsScope {
+			scope = ""
+		}
+		if limit.PerMinute > 0 {
+			windows = append(windows, quotaWindow{wrapper.RateLimitWindow{Key: prefix + ":m", Limit: limit.PerMinute, Window: time.Minute}, "minute", scope})
+		}
+		if limit.PerDay > 0 {
+			windows = append(windows, quotaWindow{wrapper.RateLimitWindow{Key: prefix + ":d", Limit: limit.PerDay, Window: 24 * time.Hour}, "day", scope})
+		}
+	}
+	limit, hasToolLimit := q.config.Tools[tool]
+	if q.config.PerTool {
+		if !hasToolLimit {
+			limit = q.config.QuotaLimit
+		}
+		add(limit, tool)
+	} else {
+		add(q.config.QuotaLimit, allToolsScope)
+		if hasToolLimit {
+			add(limit, tool)
+		}
+	}
+	return windows
+}
+
+// wrap checks the quota of the consumer before calling the tools/call handler. The consumer is the one
+// authenticated by the plugin, see HttpContext.SetConsumer: a consumer only named by the x-mse-consumer
+// header, which clients can send themselves, counts as anonymous. When Redis fails the failure policy of
+// the "redis" dependency applies, see wrapper.WithFailurePolicy.
+func (q *ToolQuota) wrap(handler utils.JsonRpcMethodHandler) utils.JsonRpcMethodHandler {
+	return func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		consumer := anonymousConsumer
+		if c := ctx.Consumer(); c != nil && c.Scheme != "" {
+			consumer = c.Name
+		}
+		tool := params.Get("name").String()
+		windows := q.windows(consumer, tool)
+		if len(windows) == 0 || q.client == nil {
+			return handler(ctx, id, params)
+		}
+		limits := make([]wrapper.RateLimitWindow, len(windows))
+		for i, w := range windows {
+			limits[i] = w.RateLimitWindow
+		}
+		err := q.client.RateLimit(limits, func(result wrapper.RateLimitResult, err error) {
+			// The response may arrive while another request is processed
+			if ctxErr := wrapper.RunInContext(ctx, func() {
+				q.checked(ctx, handler, id, params, consumer, windows, result, err)
+			}); ctxErr != nil {
+				log.Warnf("dropping the quota check of consumer %s, its request is gone: %v", consumer, ctxErr)
+			}
+		})
+		if err != nil {
+			if ctx.HandleFailure(wrapper.FailureRedis, fmt.Errorf("failed to check the quota of consumer %s: %w", consumer, err)) == wrapper.FailClosed {
+				return nil
+			}
+			return handler(ctx, id, params)
+		}
+		ctx.SetContext(utils.CtxNeedPause, true)
+		return nil
+	}
+}
+
+// checked calls the handler of a call whose quota was checked, or rejects it
+func (q *ToolQuota) checked(ctx wrapper.HttpContext, handler utils.JsonRpcMethodHandler, id utils.JsonRpcID, params gjson.Result,
+	consumer string, windows []quotaWindow, result wrapper.RateLimitResult, err error) {
+	if err != nil {
+		if ctx.HandleFailure(wrapper.FailureRedis, fmt.Errorf("failed to check the quota of consumer %s: %w", consumer, err)) == wrapper.FailClosed {
+			return
+		}
+	} else if !result.Allowed {
+		q.reject(ctx, consumer, windows[result.Exhausted], result.Resets[result.Exhausted])
+		return
+	}
+	ctx.SetContext(utils.CtxNeedPause, false)
+	if err := handler(ctx, id, params); err != nil {
+		utils.OnJsonRpcResponseError(ctx, err, utils.ErrInvalidRequest)
+		return
+	}
+	// Resume unless the handler waits for a callout or answered the request
+	if !ctx.GetBoolContext(utils.CtxNeedPause, false) && ctx.GetContext(utils.CtxJsonRpcResponse) == nil {
+		proxywasm.ResumeHttpRequest()
+	}
+}
+
+// reject answers a call over quota with a rate limit error telling when the quota resets
+func (q *ToolQuota) reject(ctx wrapper.HttpContext, consumer string, window quotaWindow, reset time.Duration) {
+	retryAfter := int64((reset + time.Second - 1) / time.Second)
+	data := map[string]any{
+		"consumer":   consumer,
+		"limit":      window.Limit,
+		"window":     window.name,
+		"retryAfter": retryAfter,
+		"resetAt":    time.Now().Add(reset).Unix(),
+	}
+	message := fmt.Sprintf("quota exceeded: %d tool calls per %s", window.Limit, window.name)
+	if window.tool != "" {
+		data["tool"] = window.tool
+		message = fmt.Sprintf("quota exceeded: %d calls of tool %s per %s", window.Limit, window.tool, window.name)
+	}
+	utils.OnJsonRpcResponseErrorWithData(ctx, errors.New(message), utils.ErrRateLimited, data, "mcp:tools/call:quota_exceeded")
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// TestParseQuota tests validation and defaults of the quota option
+func TestParseQuota(t *testing.T) {
+	quota, err := parseQuota("weather", gjson.Parse(`{"serviceName": "redis.default.svc.cluster.local", "servicePort": 6379, "perMinute": 10}`))
+	require.NoError(t, err)
+	assert.Equal(t, "mcp-quota:weather", quota.config.KeyPrefix)
+	assert.Equal(t, int64(1000), quota.config.Timeout)
+
+	tests := []struct {
+		config  string
+		pointer string
+	}{
+		{`{"servicePort": 6379, "perMinute": 10}`, "/serviceName"},
+		{`{"serviceName": "a", "perMinute": 10}`, "/servicePort"},
+		{`{"serviceName": "a", "servicePort": 6379}`, "/perMinute"},
+		{`{"serviceName": "a", "servicePort": 6379, "perDay": -1}`, "/perDay"},
+		{`{"serviceName": "a", "servicePort": 6379, "tools": {"search": {"perMinute": -1}}}`, "/tools/search/perMinute"},
+	}
+	for _, tt := range tests {
+		_, err := parseQuota("weather", gjson.Parse(tt.config))
+		assert.ErrorContains(t, err, `"`+tt.pointer+`"`, tt.config)
+	}
+}
+
+// TestQuotaWindows tests which counters limit a call
+func TestQuotaWindows(t *testing.T) {
+	keys := func(config string, tool string) []string {
+		quota, err := parseQuota("weather", gjson.Parse(config))
+		require.NoError(t, err)
+		var keys []string
+		for _, w := range quota.windows("alice", tool) {
+			keys = append(keys, w.Key)
+		}
+		return keys
+	}
+	const redis = `"serviceName": "a", "servicePort": 6379, `
+	assert.Equal(t, []string{"mcp-quota:weather:{alice}:*:m", "mcp-quota:weather:{alice}:*:d"},
+		keys(`{`+redis+`"perMinute": 10, "perDay": 100}`, "search"))
+	assert.Equal(t, []string{"mcp-quota:weather:{alice}:*:d", "mcp-quota:weather:{alice}:search:m"},
+		keys(`{`+redis+`"perDay": 100, "tools": {"search": {"perMinute": 1}}}`, "search"))
+	assert.Equal(t, []string{"mcp-quota:weather:{alice}:search:m"},
+		keys(`{`+redis+`"perMinute": 10, "perTool": true, "tools": {"search": {"perMinute": 1}}}`, "search"))
+	assert.Equal(t, []string{"mcp-quota:weather:{alice}:forecast:m"},
+		keys(`{`+redis+`"perMinute": 10, "perTool": true, "tools": {"search": {"perMinute": 1}}}`, "forecast"))
+	assert.Empty(t, keys(`{`+redis+`"tools": {"search": {"perMinute": 1}}}`, "forecast"))
+}
+
+// TestToolQuota tests that calls over quota are rejected with a rate limit error and others reach the handler
+func TestToolQuota(t *testing.T) {
+	quota, err := parseQuota("weather", gjson.Parse(`{
+		"serviceName": "redis.example.com",
+		"servicePort": 6379,
+		"perMinute": 10,
+		"tools": {"search": {"perDay": 100}}
+	}`))
+	require.NoError(t, err)
+	var handled int
+	handler := quota.wrap(func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		handled++
+		utils.OnMCPToolCallSuccess(ctx, []map[string]any{{"type": "text", "text": "ok"}}, "")
+		return nil
+	})
+	start := func(t *testing.T, redisMode wrapper.FailureMode) (proxytest.HostEmulator, func()) {
+		vm := wrapper.NewCommonVmCtx("quota-test",
+			wrapper.ParseConfig(func(json gjson.Result, config *struct{}) error {
+				return quota.init()
+			}),
+			wrapper.WithFailurePolicy[struct{}](wrapper.FailurePolicy{}, map[string]wrapper.FailurePolicy{"redis": {Mode: redisMode}}),
+			wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+				if name, _ := proxywasm.GetHttpRequestHeader("x-test-key"); name != "" {
+					ctx.SetConsumer(&wrapper.Consumer{Name: name, Scheme: "key"})
+				}
+				return types.HeaderStopIteration
+			}),
+			wrapper.ProcessRequestBody(func(ctx wrapper.HttpContext, config struct{}, body []byte) types.Action {
+				ctx.SetContext(utils.CtxCorrelationID, "req-1")
+				return utils.HandleJsonRpcMethod(ctx, body, utils.MethodHandlers{"tools/call": handler})
+			}))
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+		host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		return host, reset
+	}
+	// call sends a tools/call of the consumer, another request is processed while the quota is checked
+	call := func(t *testing.T, host proxytest.HostEmulator, headers [][2]string, status int32, reply []byte) uint32 {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, append([][2]string{{":authority", "example.com"}, {":path", "/mcp"}}, headers...), false)
+		action := host.CallOnRequestBody(id, []byte(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"search"}}`), true)
+		assert.Equal(t, types.ActionPause, action, "waits for redis")
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		calloutID, query := callouts[0].CalloutID, callouts[0].Query
+		host.CallOnRequestHeaders(host.InitializeHttpContext(), [][2]string{{":authority", "example.com"}, {":path", "/other"}}, false)
+		assert.True(t, bytes.Contains(query, []byte(":search:d:")))
+		host.CallOnRedisCallResponse(calloutID, status, reply)
+		return id
+	}
+	integers := func(values ...int) []byte {
+		array := make([]resp.Value, len(values))
+		for i, v := range values {
+			array[i] = resp.IntegerValue(v)
+		}
+		b, _ := resp.ArrayValue(array).MarshalRESP()
+		return b
+	}
+	response := func(host proxytest.HostEmulator, id uint32) (uint32, gjson.Result) {
+		local := host.GetSentLocalResponse(id)
+		require.NotNil(t, local)
+		return local.StatusCode, gjson.ParseBytes(local.Data)
+	}
+	counted := func(host proxytest.HostEmulator, id uint32, key string) bool {
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		return len(callouts) == 1 && bytes.Contains(callouts[0].Query, []byte(key))
+	}
+
+	t.Run("quota", func(t *testing.T) {
+		host, reset := start(t, wrapper.FailOpen)
+		defer reset()
+		handled = 0
+		alice := [][2]string{{"x-test-key", "alice"}}
+
+		id := call(t, host, alice, 0, integers(1, 0, 1, 60000, 1, 86400000))
+		assert.Equal(t, 1, handled)
+		status, body := response(host, id)
+		assert.Equal(t, uint32(200), status)
+		assert.Equal(t, "ok", body.Get("result.content.0.text").String(), "the call is handled for its request")
+
+		id = call(t, host, alice, 0, integers(0, 2, 3, 60000, 100, 7200000))
+		assert.Equal(t, 1, handled, "rejected calls do not reach the tool")
+		status, body = response(host, id)
+		assert.Equal(t, uint32(200), status)
+		rpcError := body.Get("error")
+		assert.Equal(t, int64(utils.ErrRateLimited), rpcError.Get("code").Int())
+		assert.Equal(t, "quota exceeded: 100 calls of tool search per day", rpcError.Get("message").String())
+		assert.Equal(t, "alice", rpcError.Get("data.consumer").String())
+		assert.Equal(t, "search", rpcError.Get("data.tool").String())
+		assert.Equal(t, "day", rpcError.Get("data.window").String())
+		assert.Equal(t, int64(100), rpcError.Get("data.limit").Int())
+		assert.Equal(t, int64(7200), rpcError.Get("data.retryAfter").Int())
+		assert.InDelta(t, time.Now().Add(2*time.Hour).Unix(), rpcError.Get("data.resetAt").Int(), 2)
+		assert.Equal(t, "req-1", rpcError.Get("data.correlationId").String())
+	})
+
+	t.Run("consumer header is not trusted", func(t *testing.T) {
+		host, reset := start(t, wrapper.FailOpen)
+		defer reset()
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/mcp"}, {"x-mse-consumer", "alice"}}, false)
+		host.CallOnRequestBody(id, []byte(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"search"}}`), true)
+		assert.True(t, counted(host, id, "{anonymous}"))
+	})
+
+	t.Run("redis failure fails open", func(t *testing.T) {
+		host, reset := start(t, wrapper.FailOpen)
+		defer reset()
+		handled = 0
+		id := call(t, host, nil, 1, nil)
+		assert.Equal(t, 1, handled)
+		status, _ := response(host, id)
+		assert.Equal(t, uint32(200), status)
+	})
+
+	t.Run("redis failure fails closed", func(t *testing.T) {
+		host, reset := start(t, wrapper.FailClosed)
+		defer reset()
+		handled = 0
+		id := call(t, host, nil, 1, nil)
+		assert.Equal(t, 0, handled)
+		status, _ := response(host, id)
+		assert.Equal(t, uint32(503), status)
+	})
+}
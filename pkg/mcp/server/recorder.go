@@ -0,0 +1,256 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	RecorderSinkRedis = "redis"
+	RecorderSinkHttp  = "http"
+
+	defaultRecorderTimeout    = 1000
+	defaultRecorderMaxEntries = 1000
+)
+
+// defaultRedactFields are the argument and result fields whose values are never recorded
+var defaultRedactFields = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret", "api_key", "apikey", "authorization"}
+
+// RecorderConfig configures the recording of tools/call invocations for replay
+type RecorderConfig struct {
+	Sink          string   `json:"sink"`          // redis or http
+	ServiceName   string   `json:"serviceName"`   // FQDN of the sink service, e.g. redis.default.svc.cluster.local
+	ServicePort   int64    `json:"servicePort"`   // Port of the sink service
+	Username      string   `json:"username"`      // Redis username
+	Password      string   `json:"password"`      // Redis password
+	Database      int      `json:"database"`      // Redis database
+	Timeout       int64    `json:"timeout"`       // Timeout in milliseconds, defaults to 1000
+	Key           string   `json:"key"`           // Redis list the records are pushed to, defaults to mcp-records:<server name>
+	MaxEntries    int      `json:"maxEntries"`    // Number of records kept in the Redis list, defaults to 1000
+	Path          string   `json:"path"`          // Path the records are posted to for the http sink, defaults to /
+	RedactFields  []string `json:"redactFields"`  // Extra argument and result fields to redact
+	RedactHeaders []string `json:"redactHeaders"` // Extra request headers to redact
+}
+
+// ToolCallRecord is a recorded tools/call. It can be replayed by passing Headers and Request to
+// CallOnHttpRequestHeaders and CallOnHttpRequestBody of a TestHost.
+type ToolCallRecord struct {
+	Server        string          `json:"server"`
+	Tool          string          `json:"tool"`
+	Timestamp     int64           `json:"timestamp"` // Unix milliseconds
+	DurationMs    int64           `json:"durationMs"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Headers       [][2]string     `json:"headers"`
+	Request       json.RawMessage `json:"request"`
+	Response      json.RawMessage `json:"response,omitempty"`
+}
+
+// ToolCallRecorder records tools/call invocations with credentials redacted
+type ToolCallRecorder struct {
+	config        RecorderConfig
+	serverName    string
+	redactFields  map[string]bool
+	redactHeaders map[string]bool
+	redisClient   wrapper.RedisClient
+	httpClient    wrapper.HttpClient
+	// sensitiveArgs are the sensitive arguments of every tool, redacted from the records
+	sensitiveArgs map[string][]string
+}
+
+// parseRecorder validates the recorder config, the sink client is created by init
+func parseRecorder(serverName string, recorderJson gjson.Result, schemes map[string]SecurityScheme) (*ToolCallRecorder, error) {
+	var config RecorderConfig
+	if err := configerr.DecodeJSON("", []byte(recorderJson.Raw), &config); err != nil {
+		return nil, err
+	}
+	switch config.Sink {
+	case RecorderSinkRedis, RecorderSinkHttp:
+	default:
+		return nil, configerr.Errorf("/sink", `"redis" or "http"`, "unknown recorder sink: %s", config.Sink)
+	}
+	if config.ServiceName == "" {
+		return nil, configerr.New("/serviceName", "string", errors.New("recorder serviceName is required"))
+	}
+	if config.ServicePort <= 0 {
+		return nil, configerr.New("/servicePort", "positive integer", errors.New("recorder servicePort is required"))
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultRecorderTimeout
+	}
+	if config.Key == "" {
+		config.Key = "mcp-records:" + serverName
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultRecorderMaxEntries
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+
+	recorder := &ToolCallRecorder{
+		config:       config,
+		serverName:   serverName,
+		redactFields: make(map[string]bool),
+	}
+	for _, field := range append(defaultRedactFields, config.RedactFields...) {
+		recorder.redactFields[strings.ToLower(field)] = true
+	}
+	recorder.redactHeaders, _ = credentialNames(schemes)
+	for _, header := range config.RedactHeaders {
+		recorder.redactHeaders[strings.ToLower(header)] = true
+	}
+	return recorder, nil
+}
+
+// setSensitiveArgs collects the sensitive arguments of the tools of the server
+func (r *ToolCallRecorder) setSensitiveArgs(server Server) {
+	if server == nil {
+		return
+	}
+	r.sensitiveArgs = map[string][]string{}
+	for name, tool := range server.GetMCPTools() {
+		if sensitive := sensitiveArgsOf(tool); len(sensitive) > 0 {
+			r.sensitiveArgs[name] = sensitive
+		}
+	}
+}
+
+// init creates the sink client, it must be called in the config phase
+func (r *ToolCallRecorder) init() error {
+	cluster := wrapper.FQDNCluster{FQDN: r.config.ServiceName, Port: r.config.ServicePort}
+	if r.config.Sink == RecorderSinkHttp {
+		r.httpClient = wrapper.NewClusterClient(cluster)
+		return nil
+	}
+	client := wrapper.NewRedisClusterClient(cluster)
+	if err := client.Init(r.config.Username, r.config.Password, r.config.Timeout, wrapper.WithDataBase(r.config.Database)); err != nil {
+		return fmt.Errorf("failed to init recorder redis client: %w", err)
+	}
+	r.redisClient = client
+	return nil
+}
+
+// start begins recording if the request is a tools/call, the record is sent once the stream is done
+func (r *ToolCallRecorder) start(ctx wrapper.HttpContext, body []byte) {
+	if gjson.GetBytes(body, "method").String() != "tools/call" {
+		return
+	}
+	headers, _ := proxywasm.GetHttpRequestHeaders()
+	tool := gjson.GetBytes(body, "params.name").String()
+	request := r.redact(body, "params.arguments")
+	if sensitive := r.sensitiveArgs[tool]; len(sensitive) > 0 {
+		if arguments := gjson.GetBytes(request, "params.arguments"); arguments.IsObject() {
+			request, _ = sjson.SetRawBytes(request, "params.arguments", redactArgs([]byte(arguments.Raw), sensitive, redactedArg))
+		}
+	}
+	record := &ToolCallRecord{
+		Server:    r.serverName,
+		Tool:      tool,
+		Timestamp: time.Now().UnixMilli(),
+		Headers:   redactHeaders(headers, r.redactHeaders),
+		Request:   request,
+	}
+	OnStreamDone(ctx, func(ctx HttpContext) {
+		r.finish(ctx, record)
+	})
+}
+
+func (r *ToolCallRecorder) finish(ctx HttpContext, record *ToolCallRecord) {
+	record.DurationMs = time.Now().UnixMilli() - record.Timestamp
+	record.CorrelationID, _ = ctx.GetContext(utils.CtxCorrelationID).(string)
+	if response, ok := ctx.GetContext(utils.CtxJsonRpcResponse).([]byte); ok && gjson.ValidBytes(response) {
+		record.Response = r.redact(response, "result")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("failed to marshal tool call record: %v", err)
+		return
+	}
+	if err := r.send(data); err != nil {
+		log.Warnf("failed to record tool call %s: %v", record.Tool, err)
+	}
+}
+
+func (r *ToolCallRecorder) send(data []byte) error {
+	if r.httpClient != nil {
+		return r.httpClient.Post(r.config.Path, [][2]string{{"Content-Type", "application/json"}}, data,
+			func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+				if statusCode < 200 || statusCode >= 300 {
+					log.Warnf("recorder http sink responded with status %d: %s", statusCode, string(responseBody))
+				}
+			}, uint32(r.config.Timeout))
+	}
+	if r.redisClient == nil {
+		return errors.New("recorder is not initialized")
+	}
+	key := r.config.Key
+	return r.redisClient.RPush(key, []interface{}{string(data)}, func(response resp.Value) {
+		if err := response.Error(); err != nil {
+			log.Warnf("failed to push tool call record to redis: %v", err)
+			return
+		}
+		if response.Integer() > r.config.MaxEntries {
+			r.redisClient.Command([]interface{}{"ltrim", key, -r.config.MaxEntries, -1}, func(response resp.Value) {
+				if err := response.Error(); err != nil {
+					log.Warnf("failed to trim tool call records: %v", err)
+				}
+			})
+		}
+	})
+}
+
+// redact hides the values of sensitive fields anywhere below path
+func (r *ToolCallRecorder) redact(body []byte, path string) []byte {
+	var paths []string
+	collectRedactPaths(gjson.GetBytes(body, path), path, r.redactFields, &paths)
+	for _, p := range paths {
+		body, _ = sjson.SetBytes(body, p, redactedValue)
+	}
+	return body
+}
+
+func collectRedactPaths(value gjson.Result, path string, fields map[string]bool, paths *[]string) {
+	if value.IsObject() {
+		value.ForEach(func(key, child gjson.Result) bool {
+			childPath := path + "." + gjson.Escape(key.String())
+			if fields[strings.ToLower(key.String())] {
+				*paths = append(*paths, childPath)
+			} else {
+				collectRedactPaths(child, childPath, fields, paths)
+			}
+			return true
+		})
+	} else if value.IsArray() {
+		for i, child := range value.Array() {
+			collectRedactPaths(child, fmt.Sprintf("%s.%d", path, i), fields, paths)
+		}
+	}
+}
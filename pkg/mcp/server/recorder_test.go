@@ -0,0 +1,89 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// TestParseRecorder tests validation and defaults of the recorder option
+func TestParseRecorder(t *testing.T) {
+	recorder, err := parseRecorder("weather", gjson.Parse(`{"sink": "redis", "serviceName": "redis.default.svc.cluster.local", "servicePort": 6379}`), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "mcp-records:weather", recorder.config.Key)
+	assert.Equal(t, 1000, recorder.config.MaxEntries)
+	assert.Equal(t, int64(1000), recorder.config.Timeout)
+
+	tests := []struct {
+		config  string
+		pointer string
+	}{
+		{`{"sink": "kafka", "serviceName": "a", "servicePort": 1}`, "/sink"},
+		{`{"sink": "http", "servicePort": 1}`, "/serviceName"},
+		{`{"sink": "http", "serviceName": "a"}`, "/servicePort"},
+		{`{"sink": "http", "serviceName": "a", "servicePort": "80"}`, "/servicePort"},
+	}
+	for _, tt := range tests {
+		_, err := parseRecorder("weather", gjson.Parse(tt.config), nil)
+		assert.ErrorContains(t, err, `"`+tt.pointer+`"`, tt.config)
+	}
+}
+
+// TestToolCallRecorder tests that tool calls are recorded with credentials redacted once the stream is done
+func TestToolCallRecorder(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("recorder-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	contextID := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(contextID, [][2]string{{":path", "/mcp"}, {"x-api-key", "key"}, {"x-user", "alice"}}, false)
+
+	recorder, err := parseRecorder("weather", gjson.Parse(`{
+		"sink": "http",
+		"serviceName": "recorder.example.com",
+		"servicePort": 80,
+		"path": "/records",
+		"redactFields": ["city"]
+	}`), map[string]SecurityScheme{"key": {ID: "key", Type: "apiKey", In: "header", Name: "X-Api-Key"}})
+	assert.NoError(t, err)
+	assert.NoError(t, recorder.init())
+
+	ctx := &contextStub{values: map[string]interface{}{}}
+	recorder.start(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	assert.Nil(t, ctx.values[CtxStreamDoneCallbacks], "only tools/call is recorded")
+
+	recorder.start(ctx, []byte(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"get_weather","arguments":{"city":"Hangzhou","auth":{"Token":"t"},"days":3}}}`))
+	ctx.SetContext(utils.CtxJsonRpcResponse, []byte(`{"jsonrpc":"2.0","id":7,"result":{"content":[{"type":"text","text":"sunny"}],"password":"p"}}`))
+	runStreamDoneCallbacks(ctx)
+
+	callouts := host.GetCalloutAttributesFromContext(contextID)
+	if assert.Len(t, callouts, 1) {
+		assert.Contains(t, callouts[0].Headers, [2]string{":path", "/records"})
+		record := gjson.ParseBytes(callouts[0].Body)
+		assert.Equal(t, "weather", record.Get("server").String())
+		assert.Equal(t, "get_weather", record.Get("tool").String())
+		assert.JSONEq(t, `[[":path","/mcp"],["x-api-key","REDACTED"],["x-user","alice"]]`, record.Get("headers").Raw)
+		assert.JSONEq(t, `{"city":"REDACTED","auth":{"Token":"REDACTED"},"days":3}`, record.Get("request.params.arguments").Raw)
+		assert.Equal(t, "REDACTED", record.Get("response.result.password").String())
+		assert.Equal(t, "sunny", record.Get("response.result.content.0.text").String())
+	}
+}
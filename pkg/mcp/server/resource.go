@@ -0,0 +1,367 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	template "github.com/higress-group/gjson_template"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// ResourceInfo describes a resource in resources/list
+type ResourceInfo struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceTemplateInfo describes a resource template in resources/templates/list
+type ResourceTemplateInfo struct {
+	URITemplate string `json:"uriTemplate"` // RFC 6570 URI template, e.g. "weather://{city}/current"
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is an entry of a resources/read result, holding either text or binary contents
+type ResourceContents struct {
+	URI      string
+	MimeType string
+	Text     string
+	Blob     []byte // Binary contents, sent base64 encoded instead of Text when set
+}
+
+func (c ResourceContents) toMap() map[string]any {
+	contents := map[string]any{"uri": c.URI}
+	if c.MimeType != "" {
+		contents["mimeType"] = c.MimeType
+	}
+	if c.Blob != nil {
+		contents["blob"] = base64.StdEncoding.EncodeToString(c.Blob)
+	} else {
+		contents["text"] = c.Text
+	}
+	return contents
+}
+
+// Resource is a resource with a fixed URI
+type Resource interface {
+	Info() ResourceInfo
+	Read(httpCtx HttpContext, server Server) ([]ResourceContents, error)
+}
+
+// ResourceTemplate is a family of resources whose URIs match a URI template.
+// The params passed to Read hold the values of the template variables.
+type ResourceTemplate interface {
+	Info() ResourceTemplateInfo
+	Read(httpCtx HttpContext, server Server, uri string, params map[string]string) ([]ResourceContents, error)
+}
+
+// ResourceServer is an optional interface for servers that expose resources.
+// Servers built on BaseMCPServer can implement it by delegating to the base server.
+type ResourceServer interface {
+	Server
+	AddMCPResource(resource Resource) Server
+	GetMCPResources() map[string]Resource // Keyed by resource URI
+	AddMCPResourceTemplate(template ResourceTemplate) Server
+	GetMCPResourceTemplates() []ResourceTemplate
+}
+
+// StaticResource is a resource with fixed contents
+type StaticResource struct {
+	ResourceInfo
+	Text string
+	Blob []byte
+}
+
+// Info implements Resource interface
+func (r *StaticResource) Info() ResourceInfo {
+	return r.ResourceInfo
+}
+
+// Read implements Resource interface
+func (r *StaticResource) Read(httpCtx HttpContext, server Server) ([]ResourceContents, error) {
+	return []ResourceContents{{URI: r.URI, MimeType: r.MimeType, Text: r.Text, Blob: r.Blob}}, nil
+}
+
+// uriTemplate matches URIs against a URI template. Simple expansions ({var}) match a single path
+// segment and are percent-decoded, reserved expansions ({+var}) match any remaining characters.
+type uriTemplate struct {
+	pattern *regexp.Regexp
+	names   []string
+}
+
+var uriTemplateExpression = regexp.MustCompile(`\{(\+?)([A-Za-z0-9_]+)\}`)
+
+func parseURITemplate(tmpl string) (*uriTemplate, error) {
+	if tmpl == "" {
+		return nil, errors.New("uri template cannot be empty")
+	}
+	var pattern strings.Builder
+	var names []string
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range uriTemplateExpression.FindAllStringSubmatchIndex(tmpl, -1) {
+		literal := tmpl[last:loc[0]]
+		if strings.ContainsAny(literal, "{}") {
+			return nil, fmt.Errorf("unsupported expression in uri template: %s", tmpl)
+		}
+		pattern.WriteString(regexp.QuoteMeta(literal))
+		if loc[3] > loc[2] {
+			pattern.WriteString("(.+)")
+		} else {
+			pattern.WriteString("([^/?#]+)")
+		}
+		names = append(names, tmpl[loc[4]:loc[5]])
+		last = loc[1]
+	}
+	if strings.ContainsAny(tmpl[last:], "{}") {
+		return nil, fmt.Errorf("unsupported expression in uri template: %s", tmpl)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("uri template has no variables: %s", tmpl)
+	}
+	pattern.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	pattern.WriteString("$")
+	return &uriTemplate{pattern: regexp.MustCompile(pattern.String()), names: names}, nil
+}
+
+// match returns the values of the template variables if the URI matches the template
+func (t *uriTemplate) match(uri string) (map[string]string, bool) {
+	submatches := t.pattern.FindStringSubmatch(uri)
+	if submatches == nil {
+		return nil, false
+	}
+	params := make(map[string]string, len(t.names))
+	for i, name := range t.names {
+		value := submatches[i+1]
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		params[name] = value
+	}
+	return params, true
+}
+
+// RestResource is a resource with fixed contents configured for a REST MCP server
+type RestResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Blob        string `json:"blob,omitempty"` // Base64 encoded binary contents
+}
+
+// toStaticResource validates the configuration and converts it to a StaticResource
+func (r RestResource) toStaticResource() (*StaticResource, error) {
+	if r.URI == "" {
+		return nil, errors.New("resource uri cannot be empty")
+	}
+	if _, err := url.Parse(r.URI); err != nil {
+		return nil, fmt.Errorf("invalid resource uri: %v", err)
+	}
+	if r.Name == "" {
+		return nil, errors.New("resource name cannot be empty")
+	}
+	resource := &StaticResource{
+		ResourceInfo: ResourceInfo{
+			URI:         r.URI,
+			Name:        r.Name,
+			Title:       r.Title,
+			Description: r.Description,
+			MimeType:    r.MimeType,
+		},
+		Text: r.Text,
+	}
+	if r.Blob != "" {
+		if r.Text != "" {
+			return nil, errors.New("text and blob cannot be used together")
+		}
+		blob, err := base64.StdEncoding.DecodeString(r.Blob)
+		if err != nil {
+			return nil, fmt.Errorf("blob must be base64 encoded: %v", err)
+		}
+		resource.Blob = blob
+	}
+	return resource, nil
+}
+
+// RestResourceTemplate is a resource template configured for a REST MCP server. The contents are
+// rendered from the text template, with the template variables under .params and the server
+// config under .config.
+type RestResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Text        string `json:"text"`
+
+	parsedText *template.Template
+}
+
+// parseTemplates validates the configuration and parses the text template
+func (t *RestResourceTemplate) parseTemplates() error {
+	if _, err := parseURITemplate(t.URITemplate); err != nil {
+		return err
+	}
+	if t.Name == "" {
+		return errors.New("resource template name cannot be empty")
+	}
+	var err error
+	t.parsedText, err = template.New("resource").Funcs(templateFuncs()).Parse(t.Text)
+	if err != nil {
+		return fmt.Errorf("error parsing resource text template: %v", err)
+	}
+	return nil
+}
+
+// Info implements ResourceTemplate interface
+func (t *RestResourceTemplate) Info() ResourceTemplateInfo {
+	return ResourceTemplateInfo{
+		URITemplate: t.URITemplate,
+		Name:        t.Name,
+		Title:       t.Title,
+		Description: t.Description,
+		MimeType:    t.MimeType,
+	}
+}
+
+// Read implements ResourceTemplate interface
+func (t *RestResourceTemplate) Read(httpCtx HttpContext, server Server, uri string, params map[string]string) ([]ResourceContents, error) {
+	var serverConfig map[string]any
+	server.GetConfig(&serverConfig)
+	var templateDataBytes []byte
+	templateDataBytes, _ = sjson.SetBytes(templateDataBytes, "config", serverConfig)
+	templateDataBytes, _ = sjson.SetBytes(templateDataBytes, "params", params)
+	text, err := executeTemplate(t.parsedText, templateDataBytes)
+	if err != nil {
+		return nil, fmt.Errorf("error executing resource text template: %v", err)
+	}
+	return []ResourceContents{{URI: uri, MimeType: t.MimeType, Text: text}}, nil
+}
+
+// hasResources returns whether the server exposes any resources or resource templates
+func hasResources(server Server) bool {
+	resourceServer, ok := server.(ResourceServer)
+	return ok && (len(resourceServer.GetMCPResources()) > 0 || len(resourceServer.GetMCPResourceTemplates()) > 0)
+}
+
+// addResourceMethodHandlers adds the resources/list, resources/templates/list and resources/read handlers
+func addResourceMethodHandlers(handlers utils.MethodHandlers, serverName string, server ResourceServer) {
+	handlers["resources/list"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		resources := server.GetMCPResources()
+		uris := make([]string, 0, len(resources))
+		for uri := range resources {
+			uris = append(uris, uri)
+		}
+		sort.Strings(uris)
+		listed := make([]ResourceInfo, 0, len(uris))
+		for _, uri := range uris {
+			listed = append(listed, resources[uri].Info())
+		}
+		utils.OnMCPResponseSuccess(ctx, map[string]any{
+			"resources": listed,
+		}, fmt.Sprintf("mcp:%s:resources/list", serverName))
+		return nil
+	}
+	handlers["resources/templates/list"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		templates := server.GetMCPResourceTemplates()
+		listed := make([]ResourceTemplateInfo, 0, len(templates))
+		for _, tmpl := range templates {
+			listed = append(listed, tmpl.Info())
+		}
+		utils.OnMCPResponseSuccess(ctx, map[string]any{
+			"resourceTemplates": listed,
+		}, fmt.Sprintf("mcp:%s:resources/templates/list", serverName))
+		return nil
+	}
+	handlers["resources/read"] = func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		uri := params.Get("uri").String()
+		if uri == "" {
+			utils.OnMCPResponseError(ctx, errors.New("uri is required"), utils.ErrInvalidParams, fmt.Sprintf("mcp:%s:resources/read:missing_uri", serverName))
+			return nil
+		}
+		contents, found, err := readResource(ctx, server, uri)
+		if !found {
+			utils.OnMCPResponseError(ctx, fmt.Errorf("resource not found: %s", uri), utils.ErrResourceNotFound, fmt.Sprintf("mcp:%s:resources/read:not_found", serverName))
+			return nil
+		}
+		if err != nil {
+			log.Errorf("failed to read resource %s: %v", uri, err)
+			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, fmt.Sprintf("mcp:%s:resources/read:error", serverName))
+			return nil
+		}
+		listed := make([]map[string]any, 0, len(contents))
+		for _, c := range contents {
+			listed = append(listed, c.toMap())
+		}
+		utils.OnMCPResponseSuccess(ctx, map[string]any{
+			"contents": listed,
+		}, fmt.Sprintf("mcp:%s:resources/read", serverName))
+		return nil
+	}
+}
+
+// resourceTemplateMatcher is implemented by servers that parse the URI templates of their resource
+// templates once, when they are added, see BaseMCPServer
+type resourceTemplateMatcher interface {
+	matchResourceTemplate(uri string) (ResourceTemplate, map[string]string, bool)
+}
+
+// readResource reads the resource with the given URI, trying exact resources before templates
+func readResource(ctx wrapper.HttpContext, server ResourceServer, uri string) ([]ResourceContents, bool, error) {
+	if resource, ok := server.GetMCPResources()[uri]; ok {
+		contents, err := resource.Read(ctx, server)
+		return contents, true, err
+	}
+	if matcher, ok := server.(resourceTemplateMatcher); ok {
+		tmpl, params, found := matcher.matchResourceTemplate(uri)
+		if !found {
+			return nil, false, nil
+		}
+		contents, err := tmpl.Read(ctx, server, uri, params)
+		return contents, true, err
+	}
+	// Servers not built on BaseMCPServer have their templates parsed on every read
+	for _, tmpl := range server.GetMCPResourceTemplates() {
+		parsed, err := parseURITemplate(tmpl.Info().URITemplate)
+		if err != nil {
+			continue
+		}
+		if params, ok := parsed.match(uri); ok {
+			contents, err := tmpl.Read(ctx, server, uri, params)
+			return contents, true, err
+		}
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// startTestHttpContext starts a plugin with an http context in the host emulator, so that request
+// headers are available. The returned reset also restores the test logger replaced by the plugin.
+func startTestHttpContext(pluginName string) func() {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}](pluginName)))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	contextID := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(contextID, [][2]string{{":authority", "example.com"}, {":path", "/mcp"}}, false)
+	return func() {
+		reset()
+		log.SetPluginLog(&testLogger{})
+	}
+}
+
+func newTestToolRegistry() *GlobalToolRegistry {
+	registry := &GlobalToolRegistry{}
+	registry.Initialize()
+	return registry
+}
+
+// TestURITemplateMatch tests matching of resource URIs against URI templates
+func TestURITemplateMatch(t *testing.T) {
+	tmpl, err := parseURITemplate("weather://{city}/forecast/{day}")
+	assert.NoError(t, err)
+	params, ok := tmpl.match("weather://San%20Jose/forecast/monday")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"city": "San Jose", "day": "monday"}, params)
+	_, ok = tmpl.match("weather://a/b/forecast/monday")
+	assert.False(t, ok, "simple expansions must not match across segments")
+
+	tmpl, err = parseURITemplate("file:///{+path}")
+	assert.NoError(t, err)
+	params, ok = tmpl.match("file:///docs/guide.md")
+	assert.True(t, ok)
+	assert.Equal(t, "docs/guide.md", params["path"])
+
+	for _, invalid := range []string{"", "docs://readme", "docs://{a,b}", "docs://{?q}"} {
+		_, err = parseURITemplate(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+// TestMatchResourceTemplate tests that resource templates are matched with the URI templates parsed when they were added
+func TestMatchResourceTemplate(t *testing.T) {
+	base := NewBaseMCPServer()
+	forecast := &RestResourceTemplate{URITemplate: "weather://{city}/forecast", Name: "forecast"}
+	files := &RestResourceTemplate{URITemplate: "file:///{+path}", Name: "files"}
+	base.AddMCPResourceTemplate(forecast)
+	base.AddMCPResourceTemplate(&RestResourceTemplate{URITemplate: "docs://{a,b}", Name: "invalid"})
+	base.AddMCPResourceTemplate(files)
+	assert.Len(t, base.GetMCPResourceTemplates(), 2, "invalid templates are not added")
+
+	for _, server := range []BaseMCPServer{base, base.CloneBase()} {
+		tmpl, params, ok := server.matchResourceTemplate("file:///docs/guide.md")
+		assert.True(t, ok)
+		assert.Same(t, files, tmpl)
+		assert.Equal(t, map[string]string{"path": "docs/guide.md"}, params)
+		tmpl, params, ok = server.matchResourceTemplate("weather://paris/forecast")
+		assert.True(t, ok)
+		assert.Same(t, forecast, tmpl)
+		assert.Equal(t, "paris", params["city"])
+		_, _, ok = server.matchResourceTemplate("weather://paris/current")
+		assert.False(t, ok)
+	}
+}
+
+// TestRestResourcesConfig tests resources configured for a REST MCP server
+func TestRestResourcesConfig(t *testing.T) {
+	defer startTestHttpContext("resource-test")()
+
+	config := &McpServerConfig{}
+	err := parseConfigCore(gjson.Parse(`{
+		"server": {"name": "docs-server", "config": {"product": "Higress"}},
+		"resources": [
+			{"uri": "docs://readme", "name": "readme", "mimeType": "text/markdown", "text": "# Readme"},
+			{"uri": "docs://logo", "name": "logo", "mimeType": "image/png", "blob": "iVBORw0="}
+		],
+		"resourceTemplates": [
+			{"uriTemplate": "docs://guides/{topic}", "name": "guide", "text": "{{.config.product}} guide: {{.params.topic}}"}
+		]
+	}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+	assert.NoError(t, err)
+	assert.True(t, hasResources(config.server))
+	for _, method := range []string{"resources/list", "resources/templates/list", "resources/read"} {
+		assert.NotNil(t, config.methodHandlers[method], method)
+	}
+	server := config.server.(ResourceServer)
+
+	contents, found, err := readResource(nil, server, "docs://readme")
+	assert.True(t, found)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"uri": "docs://readme", "mimeType": "text/markdown", "text": "# Readme"}, contents[0].toMap())
+
+	contents, _, _ = readResource(nil, server, "docs://logo")
+	assert.Equal(t, "iVBORw0=", contents[0].toMap()["blob"])
+
+	contents, found, err = readResource(nil, server, "docs://guides/routing")
+	assert.True(t, found)
+	assert.NoError(t, err)
+	assert.Equal(t, "Higress guide: routing", contents[0].Text)
+	assert.Equal(t, "docs://guides/routing", contents[0].URI)
+
+	_, found, _ = readResource(nil, server, "docs://unknown")
+	assert.False(t, found)
+
+	cloned := server.Clone().(ResourceServer)
+	assert.Len(t, cloned.GetMCPResources(), 2)
+	assert.Len(t, cloned.GetMCPResourceTemplates(), 1)
+}
+
+// TestRestResourcesConfigErrors tests validation of resource configurations
+func TestRestResourcesConfigErrors(t *testing.T) {
+	for name, resources := range map[string]string{
+		"missing uri":        `"resources": [{"name": "readme", "text": "a"}]`,
+		"duplicate uri":      `"resources": [{"uri": "docs://a", "name": "a"}, {"uri": "docs://a", "name": "b"}]`,
+		"text and blob":      `"resources": [{"uri": "docs://a", "name": "a", "text": "a", "blob": "YQ=="}]`,
+		"invalid blob":       `"resources": [{"uri": "docs://a", "name": "a", "blob": "not base64"}]`,
+		"template variables": `"resourceTemplates": [{"uriTemplate": "docs://a", "name": "a"}]`,
+		"template text":      `"resourceTemplates": [{"uriTemplate": "docs://{a}", "name": "a", "text": "{{"}]`,
+	} {
+		err := parseConfigCore(gjson.Parse(`{"server": {"name": "docs-server"}, `+resources+`}`),
+			&McpServerConfig{}, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+		assert.Error(t, err, name)
+	}
+}
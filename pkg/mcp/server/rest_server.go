@@ -18,13 +18,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/url"
 	"strings"
 	_ "time/tzdata"
 
 	template "github.com/higress-group/gjson_template"
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"gopkg.in/yaml.v3"
 
 	"github.com/higress-group/wasm-go/pkg/log"
 	"github.com/higress-group/wasm-go/pkg/mcp/utils"
@@ -46,6 +49,11 @@ type RestToolArg struct {
 	Required    bool          `json:"required,omitempty"`
 	Default     interface{}   `json:"default,omitempty"`
 	Enum        []interface{} `json:"enum,omitempty"`
+	// Bounds of number and integer arguments
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Pattern is a regular expression string arguments must match
+	Pattern string `json:"pattern,omitempty"`
 	// For array type
 	Items interface{} `json:"items,omitempty"`
 	// For object type
@@ -53,6 +61,9 @@ type RestToolArg struct {
 	// Position specifies where the argument should be placed in the request
 	// Valid values: query, path, header, cookie, body
 	Position string `json:"position,omitempty"`
+	// Sensitive hides the value in logs, tool call records and dry-run results, and lets clients
+	// send it sealed with the argSealKey of the server
+	Sensitive bool `json:"sensitive,omitempty"`
 }
 
 // RestToolHeader represents an HTTP header
@@ -73,11 +84,34 @@ type RestToolRequestTemplate struct {
 	Security       SecurityRequirement `json:"security,omitempty"`
 }
 
+// Content types of the result of a tool, see RestToolResponseTemplate.ContentType
+const (
+	ResponseContentTypeText     = "text"
+	ResponseContentTypeMarkdown = "markdown"
+	ResponseContentTypeJSON     = "json"
+	ResponseContentTypeYAML     = "yaml"
+)
+
 // RestToolResponseTemplate defines how to transform the HTTP response
 type RestToolResponseTemplate struct {
 	Body        string `json:"body"`
 	PrependBody string `json:"prependBody,omitempty"` // Text to insert before the response body
 	AppendBody  string `json:"appendBody,omitempty"`  // Text to insert after the response body
+	// ContentType is the format of the result: text and markdown results are free text, json and yaml
+	// results are built from mappings, the body template or the response, and are always valid JSON,
+	// which is also returned as structuredContent. yaml results are sent as YAML text.
+	ContentType string                    `json:"contentType,omitempty"`
+	Mappings    []RestToolResponseMapping `json:"mappings,omitempty"` // Rules building a json or yaml result
+	// Fields are the paths of the fields kept from a JSON response before it is rendered, e.g.
+	// ["id", "items.#.name"], where # selects every element of an array. All fields are kept if empty.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// RestToolResponseMapping sets a value of a json or yaml result, read from the response or constant
+type RestToolResponseMapping struct {
+	Path  string `json:"path"`            // sjson path of the value in the result
+	From  string `json:"from,omitempty"`  // gjson path of the value in the response
+	Value any    `json:"value,omitempty"` // Value used when from is not set or not found in the response
 }
 
 // RestTool represents a REST API that can be called as an MCP tool
@@ -85,11 +119,14 @@ type RestTool struct {
 	Name                  string                   `json:"name"`
 	Description           string                   `json:"description"`
 	Security              SecurityRequirement      `json:"security,omitempty"` // Tool-level security for MCP Client to MCP Server
+	Scopes                []string                 `json:"scopes,omitempty"`   // Scopes the caller must be granted to list and call the tool, see AuthorizationConfig
 	Args                  []RestToolArg            `json:"args"`
 	OutputSchema          map[string]any           `json:"outputSchema,omitempty"` // Output schema for MCP Protocol Version 2025-06-18
 	RequestTemplate       RestToolRequestTemplate  `json:"requestTemplate,omitempty"`
 	ResponseTemplate      RestToolResponseTemplate `json:"responseTemplate"`
 	ErrorResponseTemplate string                   `json:"errorResponseTemplate"`
+	// MockResponse is the backend response body used in mock mode, rendered with the response template
+	MockResponse json.RawMessage `json:"mockResponse,omitempty"`
 
 	// Parsed templates (not from JSON)
 	parsedURLTemplate           *template.Template
@@ -100,9 +137,14 @@ type RestTool struct {
 
 	// Map of argument names to their positions
 	argPositions map[string]string
+	// Compiled patterns of the argument and output schemas
+	patterns schemaPatterns
 
 	// Flag to indicate if this is a direct response tool (no HTTP request)
 	isDirectResponseTool bool
+
+	// Fields kept from the response, nil to keep all of them
+	fieldProjection fieldProjection
 }
 
 // parseIP
@@ -202,6 +244,15 @@ func (t *RestTool) parseTemplates() error {
 		}
 	}
 
+	if err = t.ResponseTemplate.validateContentType(); err != nil {
+		return err
+	}
+	if len(t.ResponseTemplate.Fields) > 0 {
+		if t.fieldProjection, err = parseFieldProjection(t.ResponseTemplate.Fields); err != nil {
+			return err
+		}
+	}
+
 	// Parse response template if present
 	if t.ResponseTemplate.Body != "" {
 		// Validate that PrependBody and AppendBody are not used with Body
@@ -213,8 +264,8 @@ func (t *RestTool) parseTemplates() error {
 		if err != nil {
 			return fmt.Errorf("error parsing response template: %v", err)
 		}
-	} else if t.isDirectResponseTool {
-		return errors.New("direct response mode must set responseTemplate.body")
+	} else if t.isDirectResponseTool && len(t.ResponseTemplate.Mappings) == 0 {
+		return errors.New("direct response mode must set responseTemplate.body or responseTemplate.mappings")
 	}
 
 	// Parse error response template if present
@@ -236,6 +287,102 @@ func (t *RestTool) parseTemplates() error {
 	return nil
 }
 
+// validateContentType checks the content type and the options it allows
+func (r *RestToolResponseTemplate) validateContentType() error {
+	switch r.ContentType {
+	case "", ResponseContentTypeText, ResponseContentTypeMarkdown:
+		if len(r.Mappings) > 0 {
+			return fmt.Errorf("responseTemplate.mappings requires the json or yaml contentType")
+		}
+		return nil
+	case ResponseContentTypeJSON, ResponseContentTypeYAML:
+	default:
+		return fmt.Errorf("unknown responseTemplate.contentType %q, expected one of text, markdown, json, yaml", r.ContentType)
+	}
+	if r.PrependBody != "" || r.AppendBody != "" {
+		return fmt.Errorf("PrependBody and AppendBody cannot be used with the %s contentType", r.ContentType)
+	}
+	if len(r.Mappings) > 0 && r.Body != "" {
+		return fmt.Errorf("responseTemplate.mappings cannot be used when Body is specified")
+	}
+	for i, mapping := range r.Mappings {
+		if mapping.Path == "" {
+			return fmt.Errorf("responseTemplate.mappings[%d].path is required", i)
+		}
+	}
+	return nil
+}
+
+func (r *RestToolResponseTemplate) isStructured() bool {
+	return r.ContentType == ResponseContentTypeJSON || r.ContentType == ResponseContentTypeYAML
+}
+
+// renderStructuredResponse renders the result of a tool with the json or yaml content type from the
+// response, or the template data of a direct response tool. It returns the text of the result and its
+// structured content, the result itself if it is an object, else wrapped as {"result": ...}.
+func (t *RestTool) renderStructuredResponse(data []byte) (string, json.RawMessage, error) {
+	var result []byte
+	switch {
+	case len(t.ResponseTemplate.Mappings) > 0:
+		result = []byte("{}")
+		for _, mapping := range t.ResponseTemplate.Mappings {
+			var err error
+			if value := gjson.GetBytes(data, mapping.From); mapping.From != "" && value.Exists() {
+				result, err = sjson.SetRawBytes(result, mapping.Path, []byte(value.Raw))
+			} else {
+				result, err = sjson.SetBytes(result, mapping.Path, mapping.Value)
+			}
+			if err != nil {
+				return "", nil, fmt.Errorf("error mapping response to %s: %v", mapping.Path, err)
+			}
+		}
+	case t.parsedResponseTemplate != nil:
+		rendered, err := executeTemplate(t.parsedResponseTemplate, data)
+		if err != nil {
+			return "", nil, fmt.Errorf("error executing response template: %v", err)
+		}
+		result = []byte(rendered)
+	default:
+		result = data
+	}
+	if !json.Valid(result) {
+		return "", nil, fmt.Errorf("%s response is not valid JSON: %s", t.ResponseTemplate.ContentType, result)
+	}
+	structured := json.RawMessage(result)
+	if !gjson.ParseBytes(result).IsObject() {
+		structured, _ = sjson.SetRawBytes([]byte("{}"), "result", result)
+	}
+	if t.ResponseTemplate.ContentType != ResponseContentTypeYAML {
+		return string(result), structured, nil
+	}
+	text, err := jsonToYAML(result)
+	if err != nil {
+		return "", nil, fmt.Errorf("error converting response to YAML: %v", err)
+	}
+	return text, structured, nil
+}
+
+// jsonToYAML converts JSON to YAML in block style, keeping the order of the keys
+func jsonToYAML(data []byte) (string, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return "", err
+	}
+	var clearStyle func(n *yaml.Node)
+	clearStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, child := range n.Content {
+			clearStyle(child)
+		}
+	}
+	clearStyle(&node)
+	out, err := yaml.Marshal(&node)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
 // executeTemplate executes a parsed template with the given data
 func executeTemplate(tmpl *template.Template, data []byte) (string, error) {
 	if tmpl == nil {
@@ -256,9 +403,15 @@ type RestMCPServer struct {
 	base                      BaseMCPServer
 	toolsConfig               map[string]RestTool // Store original tool configs for template rendering
 	securitySchemes           map[string]SecurityScheme
-	defaultDownstreamSecurity SecurityRequirement // Default client-to-gateway authentication
-	defaultUpstreamSecurity   SecurityRequirement // Default gateway-to-backend authentication
-	passthroughAuthHeader     bool                // If true, pass through Authorization header even without downstream security
+	defaultDownstreamSecurity SecurityRequirement           // Default client-to-gateway authentication
+	defaultUpstreamSecurity   SecurityRequirement           // Default gateway-to-backend authentication
+	passthroughAuthHeader     bool                          // If true, pass through Authorization header even without downstream security
+	errorCodeMapping          utils.StatusCodeMapping       // If set, non-2xx backend responses become JSON-RPC errors with mapped codes
+	dryRunMode                DryRunMode                    // Whether tools/call returns the rendered backend request instead of executing it
+	mockMode                  MockMode                      // Whether tools/call returns the mockResponse of the tool instead of calling its backend
+	argSealer                 *ArgSealer                    // If set, decrypts the sealed values of sensitive arguments
+	validateArguments         bool                          // Whether tools/call arguments are validated against the input schema
+	oauth2Tokens              map[string]*oauth2TokenSource // Token sources of the oauth2 security schemes by ID
 }
 
 // NewRestMCPServer creates a new REST-to-MCP server
@@ -279,6 +432,21 @@ func (s *RestMCPServer) AddSecurityScheme(scheme SecurityScheme) {
 	s.securitySchemes[scheme.ID] = scheme
 }
 
+// AddOAuth2Scheme adds an oauth2 security scheme, whose tokens are acquired before tools/call
+// requests are forwarded to the backend
+func (s *RestMCPServer) AddOAuth2Scheme(scheme SecurityScheme) error {
+	source, err := newOAuth2TokenSource(scheme)
+	if err != nil {
+		return err
+	}
+	if s.oauth2Tokens == nil {
+		s.oauth2Tokens = make(map[string]*oauth2TokenSource)
+	}
+	s.oauth2Tokens[scheme.ID] = source
+	s.AddSecurityScheme(scheme)
+	return nil
+}
+
 // GetSecurityScheme retrieves a security scheme by its ID from the map
 func (s *RestMCPServer) GetSecurityScheme(id string) (SecurityScheme, bool) {
 	scheme, ok := s.securitySchemes[id]
@@ -315,6 +483,56 @@ func (s *RestMCPServer) GetPassthroughAuthHeader() bool {
 	return s.passthroughAuthHeader
 }
 
+// SetErrorCodeMapping sets the backend HTTP status to JSON-RPC error code mapping
+func (s *RestMCPServer) SetErrorCodeMapping(mapping utils.StatusCodeMapping) {
+	s.errorCodeMapping = mapping
+}
+
+// GetErrorCodeMapping gets the backend HTTP status to JSON-RPC error code mapping
+func (s *RestMCPServer) GetErrorCodeMapping() utils.StatusCodeMapping {
+	return s.errorCodeMapping
+}
+
+// SetArgSealer sets the sealer decrypting the sealed values of sensitive arguments
+func (s *RestMCPServer) SetArgSealer(sealer *ArgSealer) {
+	s.argSealer = sealer
+}
+
+// GetArgSealer returns the sealer of sensitive arguments, nil if sealed values are not accepted
+func (s *RestMCPServer) GetArgSealer() *ArgSealer {
+	return s.argSealer
+}
+
+// SetDryRunMode sets whether tools are executed or only rendered
+func (s *RestMCPServer) SetDryRunMode(mode DryRunMode) {
+	s.dryRunMode = mode
+}
+
+// GetDryRunMode returns the dry-run mode of the server
+func (s *RestMCPServer) GetDryRunMode() DryRunMode {
+	return s.dryRunMode
+}
+
+// SetMockMode sets whether tools call their backend or return their mock response
+func (s *RestMCPServer) SetMockMode(mode MockMode) {
+	s.mockMode = mode
+}
+
+// GetMockMode returns the mock mode of the server
+func (s *RestMCPServer) GetMockMode() MockMode {
+	return s.mockMode
+}
+
+// SetValidateArguments sets whether the arguments of tools/call are validated against the input schema of the tool
+func (s *RestMCPServer) SetValidateArguments(validate bool) {
+	s.validateArguments = validate
+}
+
+// ValidatesArguments returns whether the arguments of tools/call are validated against the input schema of the tool
+func (s *RestMCPServer) ValidatesArguments() bool {
+	return s.validateArguments
+}
+
 // AddMCPTool implements Server interface
 func (s *RestMCPServer) AddMCPTool(name string, tool Tool) Server {
 	s.base.AddMCPTool(name, tool)
@@ -327,6 +545,11 @@ func (s *RestMCPServer) AddRestTool(toolConfig RestTool) error {
 	if err := toolConfig.parseTemplates(); err != nil {
 		return err
 	}
+	patterns, err := compileToolPatterns(toolConfig.Args, toolConfig.OutputSchema)
+	if err != nil {
+		return err
+	}
+	toolConfig.patterns = patterns
 
 	s.toolsConfig[toolConfig.Name] = toolConfig
 	s.base.AddMCPTool(toolConfig.Name, &RestMCPTool{
@@ -343,6 +566,74 @@ func (s *RestMCPServer) GetMCPTools() map[string]Tool {
 	return s.base.GetMCPTools()
 }
 
+// AddMCPResource implements ResourceServer interface
+func (s *RestMCPServer) AddMCPResource(resource Resource) Server {
+	s.base.AddMCPResource(resource)
+	return s
+}
+
+// GetMCPResources implements ResourceServer interface
+func (s *RestMCPServer) GetMCPResources() map[string]Resource {
+	return s.base.GetMCPResources()
+}
+
+// AddMCPResourceTemplate implements ResourceServer interface
+func (s *RestMCPServer) AddMCPResourceTemplate(tmpl ResourceTemplate) Server {
+	s.base.AddMCPResourceTemplate(tmpl)
+	return s
+}
+
+// GetMCPResourceTemplates implements ResourceServer interface
+func (s *RestMCPServer) GetMCPResourceTemplates() []ResourceTemplate {
+	return s.base.GetMCPResourceTemplates()
+}
+
+// AddMCPPrompt implements PromptServer interface
+func (s *RestMCPServer) AddMCPPrompt(prompt Prompt) Server {
+	s.base.AddMCPPrompt(prompt)
+	return s
+}
+
+// GetMCPPrompts implements PromptServer interface
+func (s *RestMCPServer) GetMCPPrompts() map[string]Prompt {
+	return s.base.GetMCPPrompts()
+}
+
+// AddRestPrompt adds a prompt configuration
+func (s *RestMCPServer) AddRestPrompt(promptConfig TemplatePrompt) error {
+	prompt, err := NewTemplatePrompt(promptConfig)
+	if err != nil {
+		return err
+	}
+	if _, exist := s.base.GetMCPPrompts()[prompt.Name]; exist {
+		return fmt.Errorf("duplicate prompt name: %s", prompt.Name)
+	}
+	s.base.AddMCPPrompt(prompt)
+	return nil
+}
+
+// AddRestResource adds a resource configuration
+func (s *RestMCPServer) AddRestResource(resourceConfig RestResource) error {
+	resource, err := resourceConfig.toStaticResource()
+	if err != nil {
+		return err
+	}
+	if _, exist := s.base.GetMCPResources()[resource.URI]; exist {
+		return fmt.Errorf("duplicate resource uri: %s", resource.URI)
+	}
+	s.base.AddMCPResource(resource)
+	return nil
+}
+
+// AddRestResourceTemplate adds a resource template configuration
+func (s *RestMCPServer) AddRestResourceTemplate(templateConfig RestResourceTemplate) error {
+	if err := templateConfig.parseTemplates(); err != nil {
+		return err
+	}
+	s.base.AddMCPResourceTemplate(&templateConfig)
+	return nil
+}
+
 // SetConfig implements Server interface
 func (s *RestMCPServer) SetConfig(config []byte) {
 	s.base.SetConfig(config)
@@ -356,19 +647,23 @@ func (s *RestMCPServer) GetConfig(v any) {
 // Clone implements Server interface
 func (s *RestMCPServer) Clone() Server {
 	newServer := &RestMCPServer{
-		name:            s.name,
-		base:            s.base.CloneBase(),
-		toolsConfig:     make(map[string]RestTool),
-		securitySchemes: make(map[string]SecurityScheme), // Initialize the map
+		name:                      s.name,
+		base:                      s.base.CloneBase(),
+		toolsConfig:               make(map[string]RestTool, len(s.toolsConfig)),
+		securitySchemes:           cloneSecuritySchemes(s.securitySchemes),
+		defaultDownstreamSecurity: s.defaultDownstreamSecurity,
+		defaultUpstreamSecurity:   s.defaultUpstreamSecurity,
+		passthroughAuthHeader:     s.passthroughAuthHeader,
+		errorCodeMapping:          maps.Clone(s.errorCodeMapping),
+		dryRunMode:                s.dryRunMode,
+		mockMode:                  s.mockMode,
+		argSealer:                 s.argSealer,
+		validateArguments:         s.validateArguments,
+		// The clones share the tokens acquired for oauth2 schemes
+		oauth2Tokens: s.oauth2Tokens,
 	}
 	for k, v := range s.toolsConfig {
-		newServer.toolsConfig[k] = v
-	}
-	// Deep copy securitySchemes
-	if s.securitySchemes != nil {
-		for k, v := range s.securitySchemes {
-			newServer.securitySchemes[k] = v
-		}
+		newServer.toolsConfig[k] = v.clone()
 	}
 	return newServer
 }
@@ -413,58 +708,100 @@ func (t *RestMCPTool) Create(params []byte) Tool {
 			}
 			continue
 		}
+		newTool.arguments[arg.Name] = convertArg(arg, rawValue)
+	}
 
-		// Convert value based on type
-		switch arg.Type {
-		case "boolean":
-			// Convert to boolean
-			switch v := rawValue.(type) {
-			case bool:
-				newTool.arguments[arg.Name] = v
-			case string:
-				if v == "true" {
-					newTool.arguments[arg.Name] = true
-				} else if v == "false" {
-					newTool.arguments[arg.Name] = false
-				} else {
-					newTool.arguments[arg.Name] = rawValue
-				}
-			default:
-				newTool.arguments[arg.Name] = rawValue
+	return newTool
+}
+
+// Scopes implements ToolWithScopes interface
+func (t *RestMCPTool) Scopes() []string {
+	return t.toolConfig.Scopes
+}
+
+// SensitiveArgs implements ToolWithSensitiveArgs interface
+func (t *RestMCPTool) SensitiveArgs() []string {
+	var names []string
+	for _, arg := range t.toolConfig.Args {
+		if arg.Sensitive {
+			names = append(names, arg.Name)
+		}
+	}
+	return names
+}
+
+// unsealArgs decrypts the sealed values of the sensitive arguments. Their decrypted values are validated against
+// the input schema when validate is set, as the sealed values were skipped by validateToolArguments.
+func (t *RestMCPTool) unsealArgs(sealer *ArgSealer, validate bool) error {
+	for _, arg := range t.toolConfig.Args {
+		sealed, ok := isSealed(t.arguments[arg.Name])
+		if !ok || !arg.Sensitive {
+			continue
+		}
+		if sealer == nil {
+			return fmt.Errorf("argument %s is sealed but the server has no argSealKey", arg.Name)
+		}
+		value, err := sealer.Unseal(t.name, arg.Name, sealed)
+		if err != nil {
+			return fmt.Errorf("failed to unseal argument %s: %v", arg.Name, err)
+		}
+		t.arguments[arg.Name] = convertArg(arg, value)
+		if validate {
+			if err := validateUnsealedArgument(t, arg.Name, t.arguments[arg.Name]); err != nil {
+				return err
 			}
-		case "integer":
-			// Convert to integer
-			switch v := rawValue.(type) {
-			case float64:
-				newTool.arguments[arg.Name] = int(v)
-			case string:
-				if intVal, err := json.Number(v).Int64(); err == nil {
-					newTool.arguments[arg.Name] = int(intVal)
-				} else {
-					newTool.arguments[arg.Name] = rawValue
-				}
-			default:
-				newTool.arguments[arg.Name] = rawValue
+		}
+	}
+	return nil
+}
+
+// convertArg converts an argument value to the type of the argument, values that cannot be converted
+// are kept as they are
+func convertArg(arg RestToolArg, rawValue interface{}) interface{} {
+	switch arg.Type {
+	case "boolean":
+		// Convert to boolean
+		switch v := rawValue.(type) {
+		case bool:
+			return v
+		case string:
+			if v == "true" {
+				return true
+			} else if v == "false" {
+				return false
 			}
-		case "number":
-			// Convert to number (float64)
-			switch v := rawValue.(type) {
-			case string:
-				if floatVal, err := json.Number(v).Float64(); err == nil {
-					newTool.arguments[arg.Name] = floatVal
-				} else {
-					newTool.arguments[arg.Name] = rawValue
-				}
-			default:
-				newTool.arguments[arg.Name] = rawValue
+			return rawValue
+		default:
+			return rawValue
+		}
+	case "integer":
+		// Convert to integer
+		switch v := rawValue.(type) {
+		case float64:
+			return int(v)
+		case string:
+			if intVal, err := json.Number(v).Int64(); err == nil {
+				return int(intVal)
+			}
+			return rawValue
+		default:
+			return rawValue
+		}
+	case "number":
+		// Convert to number (float64)
+		switch v := rawValue.(type) {
+		case string:
+			if floatVal, err := json.Number(v).Float64(); err == nil {
+				return floatVal
 			}
+			return rawValue
 		default:
-			// For string, array, object, or unspecified types, use as is
-			newTool.arguments[arg.Name] = rawValue
+			return rawValue
 		}
+	default:
+		// For string, array, object, or unspecified types, use as is
+		return rawValue
 	}
-
-	return newTool
 }
 
 // convertArgToString converts an argument value to a string representation
@@ -483,16 +820,24 @@ func convertArgToString(value interface{}) string {
 	}
 }
 
-// hasContentType checks if the headers contain a specific content type
-func hasContentType(headers [][2]string, contentTypeSubstr string) bool {
+// hasContentType checks if the headers contain a content type of the kind, e.g. wrapper.IsJSONContentType
+func hasContentType(headers [][2]string, isKind func(contentType string) bool) bool {
 	for _, header := range headers {
-		if strings.EqualFold(header[0], "Content-Type") && strings.Contains(strings.ToLower(header[1]), contentTypeSubstr) {
+		if strings.EqualFold(header[0], "Content-Type") && isKind(header[1]) {
 			return true
 		}
 	}
 	return false
 }
 
+// upstreamSecurity returns the tool-level upstream security, or else the server's default
+func (t *RestMCPTool) upstreamSecurity(restServer *RestMCPServer) SecurityRequirement {
+	if t.toolConfig.RequestTemplate.Security.ID != "" {
+		return t.toolConfig.RequestTemplate.Security
+	}
+	return restServer.GetDefaultUpstreamSecurity()
+}
+
 // applySecurity applies the configured security scheme to the request with fallback to default upstream security.
 // It modifies reqCtx.Headers and reqCtx.ParsedURL (specifically RawQuery) in place if necessary.
 func (t *RestMCPTool) applySecurity(serverObj Server, reqCtx *AuthRequestContext) error {
@@ -500,22 +845,10 @@ func (t *RestMCPTool) applySecurity(serverObj Server, reqCtx *AuthRequestContext
 	if !ok {
 		return errors.New("server is not a RestMCPServer")
 	}
-
-	// Determine which upstream security to use: tool-level or server's default
-	var upstreamSecurity SecurityRequirement
-	if t.toolConfig.RequestTemplate.Security.ID != "" {
-		// Use tool-level upstream security if configured
-		upstreamSecurity = t.toolConfig.RequestTemplate.Security
-		log.Debugf("Using tool-level upstream security for tool %s: %s", t.name, upstreamSecurity.ID)
-	} else {
-		// Fall back to server's default upstream security
-		upstreamSecurity = restServer.GetDefaultUpstreamSecurity()
-		if upstreamSecurity.ID != "" {
-			log.Debugf("Using default upstream security for tool %s: %s", t.name, upstreamSecurity.ID)
-		}
+	upstreamSecurity := t.upstreamSecurity(restServer)
+	if upstreamSecurity.ID != "" {
+		log.Debugf("Using upstream security for tool %s: %s", t.name, upstreamSecurity.ID)
 	}
-
-	// Apply security using the determined configuration
 	return ApplySecurity(upstreamSecurity, restServer, reqCtx)
 }
 
@@ -528,6 +861,13 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 	if !ok {
 		return fmt.Errorf("server is not a RestMCPServer")
 	}
+	if err := t.unsealArgs(restServer.GetArgSealer(), restServer.ValidatesArguments()); err != nil {
+		if _, ok := err.(*ArgumentError); ok {
+			onInvalidArguments(ctx, "mcp:"+restServer.name, err)
+			return nil
+		}
+		return err
+	}
 
 	// Handle tool-level or default downstream security: extract credential for passthrough if configured
 	// toolConfig.Security represents client-to-gateway authentication, falls back to server's defaultDownstreamSecurity
@@ -578,6 +918,15 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 		// Process response directly
 		var result string
 
+		if t.toolConfig.ResponseTemplate.isStructured() {
+			result, structured, err := t.toolConfig.renderStructuredResponse(templateDataBytes)
+			if err != nil {
+				return err
+			}
+			utils.SendMCPToolTextResultWithStructuredContent(ctx, result, structured, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
+			return nil
+		}
+
 		// Render the response template with the arguments
 		templateResult, err := executeTemplate(t.toolConfig.parsedResponseTemplate, templateDataBytes)
 		if err != nil {
@@ -604,6 +953,15 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 	}
 
 	// Regular REST tool with HTTP request
+	if isMock(ctx, restServer.GetMockMode()) {
+		if len(t.toolConfig.MockResponse) == 0 {
+			return fmt.Errorf("tool %s has no mockResponse", t.name)
+		}
+		log.Infof("mock response of tool %s", t.name)
+		t.sendResult(ctx, nil, mockBody(t.toolConfig.MockResponse))
+		return nil
+	}
+
 	// Execute URL template
 	urlStr, err := executeTemplate(t.toolConfig.parsedURLTemplate, templateDataBytes)
 	if err != nil {
@@ -728,8 +1086,8 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 	}
 
 	// Check for existing content types from tool config headers
-	hasJsonContentType := hasContentType(headers, "application/json")
-	hasFormContentType := hasContentType(headers, "application/x-www-form-urlencoded")
+	hasJsonContentType := hasContentType(headers, wrapper.IsJSONContentType)
+	hasFormContentType := hasContentType(headers, wrapper.IsFormContentType)
 
 	// Prepare request body
 	var requestBody []byte
@@ -836,7 +1194,42 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 		RequestBody:           requestBody,
 		PassthroughCredential: passthroughCredential,
 	}
-	if err := t.applySecurity(server, &authReqCtx); err != nil {
+	tokens := restServer.oauth2Tokens[t.upstreamSecurity(restServer).ID]
+	if tokens == nil || passthroughCredential != "" {
+		return t.send(ctx, restServer, &authReqCtx)
+	}
+	if isDryRun(restServer.GetDryRunMode()) {
+		// The dry-run result hides the token, so none is acquired
+		authReqCtx.OAuth2Token = redactedValue
+		return t.send(ctx, restServer, &authReqCtx)
+	}
+	// The call is sent once the token is acquired, the request waits unless it is cached
+	done, pending := false, false
+	tokens.get(func(token string, err error) {
+		done = true
+		if err != nil {
+			utils.OnMCPToolCallError(ctx, fmt.Errorf("failed to acquire access token of security scheme %s: %v", t.upstreamSecurity(restServer).ID, err))
+			return
+		}
+		authReqCtx.OAuth2Token = token
+		if err := t.send(ctx, restServer, &authReqCtx); err != nil {
+			utils.OnMCPToolCallError(ctx, err)
+			return
+		}
+		if pending && ctx.GetContext(utils.CtxJsonRpcResponse) == nil {
+			proxywasm.ResumeHttpRequest()
+		}
+	})
+	if !done {
+		pending = true
+		ctx.SetContext(utils.CtxNeedPause, true)
+	}
+	return nil
+}
+
+// send applies the upstream security to the rendered request and calls the backend through the route
+func (t *RestMCPTool) send(ctx wrapper.HttpContext, restServer *RestMCPServer, authReqCtx *AuthRequestContext) error {
+	if err := t.applySecurity(restServer, authReqCtx); err != nil {
 		// Log the error and continue, rather than failing the entire call.
 		// The request will proceed without the intended security modifications if applySecurity failed.
 		log.Errorf("Failed to apply security scheme for tool %s: %v. Request will proceed with potentially incomplete authentication.", t.name, err)
@@ -845,6 +1238,7 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 	// Update urlStr from the potentially modified ParsedURL.
 	u := authReqCtx.ParsedURL
 	encodedPath := u.EscapedPath()
+	var urlStr string
 	if u.Scheme != "" && u.Host != "" {
 		urlStr = u.Scheme + "://" + u.Host + encodedPath
 	} else {
@@ -856,11 +1250,29 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 	if u.Fragment != "" {
 		urlStr += "#" + u.Fragment
 	}
+	utils.SetCorrelationIDHeader(ctx, &authReqCtx.Headers)
+	if isDryRun(restServer.GetDryRunMode()) {
+		sendDryRunResult(ctx, t.name, DryRunRequest{
+			Method:  authReqCtx.Method,
+			URL:     urlStr,
+			Headers: authReqCtx.Headers,
+			Body:    string(authReqCtx.RequestBody),
+		}, restServer.securitySchemes, sensitiveValues(t.arguments, t.SensitiveArgs()))
+		return nil
+	}
 	// Make HTTP request using potentially modified headers from authReqCtx
-	err = ctx.RouteCall(authReqCtx.Method, urlStr, authReqCtx.Headers, authReqCtx.RequestBody,
+	err := ctx.RouteCall(authReqCtx.Method, urlStr, authReqCtx.Headers, authReqCtx.RequestBody,
 		func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
 
 			if statusCode >= 300 || statusCode < 200 {
+				onCallFailed := func(err error) {
+					// Without an explicit mapping, backend failures are reported as tool execution errors
+					if mapping := restServer.GetErrorCodeMapping(); mapping != nil {
+						utils.OnMCPResponseError(ctx, err, mapping.ErrorCode(statusCode), fmt.Sprintf("mcp:tools/call:%s/%s:backend_error", t.serverName, t.name))
+						return
+					}
+					utils.OnMCPToolCallError(ctx, err)
+				}
 				if t.toolConfig.parsedErrorResponseTemplate != nil {
 					// Error response template is provided to customize the error response result.
 					// Based on the responseBody, access the map-structured responseHeaders through _headers to reference their values within the errorResponseTemplate.
@@ -871,72 +1283,19 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 					errorResponseTemplateDataBytes, _ := sjson.SetBytes(responseBody, "_headers", convertHeaders(responseHeaders))
 					errorTemplateResult, err := executeTemplate(t.toolConfig.parsedErrorResponseTemplate, errorResponseTemplateDataBytes)
 					if err != nil {
-						utils.OnMCPToolCallError(ctx, fmt.Errorf("error executing error response template: %v", err))
+						onCallFailed(fmt.Errorf("error executing error response template: %v", err))
 						return
 					}
 					if errorTemplateResult != "" {
-						utils.OnMCPToolCallError(ctx, fmt.Errorf("%s", errorTemplateResult))
+						onCallFailed(fmt.Errorf("%s", errorTemplateResult))
 						return
 					}
 				}
-				utils.OnMCPToolCallError(ctx, fmt.Errorf("call failed, status: %d, response: %s", statusCode, responseBody))
+				onCallFailed(fmt.Errorf("call failed, status: %d, response: %s", statusCode, responseBody))
 				return
 			}
 
-			// Process response
-			var result string
-
-			headerMap := convertHeaders(responseHeaders)
-			contentType := headerMap[strings.ToLower("Content-Type")]
-			// Check if the response is an image
-			if strings.HasPrefix(contentType, "image/") {
-				// Handle image response by sending it as an MCP tool result
-				utils.SendMCPToolImageResult(ctx, responseBody, contentType, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
-				return
-			}
-
-			// Case 1: Full response template is provided
-			if t.toolConfig.parsedResponseTemplate != nil {
-				templateResult, err := executeTemplate(t.toolConfig.parsedResponseTemplate, responseBody)
-				if err != nil {
-					utils.OnMCPToolCallError(ctx, fmt.Errorf("error executing response template: %v", err))
-					return
-				}
-				result = templateResult
-			} else {
-				// Case 2: No template, but prepend/append might be used
-				rawResponse := string(responseBody)
-
-				// Apply prepend/append if specified
-				if t.toolConfig.ResponseTemplate.PrependBody != "" || t.toolConfig.ResponseTemplate.AppendBody != "" {
-					result = t.toolConfig.ResponseTemplate.PrependBody + rawResponse + t.toolConfig.ResponseTemplate.AppendBody
-				} else {
-					// Case 3: No template and no prepend/append, just use raw response
-					result = rawResponse
-				}
-			}
-			if result == "" {
-				result = "success"
-			}
-
-			// Check if tool has outputSchema and try to parse response as structured content
-			var structuredContent json.RawMessage
-			if t.toolConfig.OutputSchema != nil && len(t.toolConfig.OutputSchema) > 0 {
-				// Try to parse response as JSON for structured content
-				if json.Valid(responseBody) {
-					structuredContent = json.RawMessage(responseBody)
-				}
-				// If not valid JSON, don't force structuredContent creation
-				// Standard approach: use isError: true + error text (type: "text")
-				// Only add structuredContent when there's a structured need for errors
-			}
-
-			// Send the result using structured content if available
-			if structuredContent != nil {
-				utils.SendMCPToolTextResultWithStructuredContent(ctx, result, structuredContent, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
-			} else {
-				utils.SendMCPToolTextResult(ctx, result, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
-			}
+			t.sendResult(ctx, responseHeaders, responseBody)
 		})
 	if err != nil {
 		utils.OnMCPToolCallError(ctx, errors.New("route failed"))
@@ -945,6 +1304,76 @@ func (t *RestMCPTool) Call(httpCtx HttpContext, server Server) error {
 	return nil
 }
 
+// sendResult renders a successful backend response, or the mock response, into the tool result
+func (t *RestMCPTool) sendResult(ctx wrapper.HttpContext, responseHeaders [][2]string, responseBody []byte) {
+	var result string
+
+	headerMap := convertHeaders(responseHeaders)
+	contentType := headerMap[strings.ToLower("Content-Type")]
+	// Check if the response is an image
+	if strings.HasPrefix(contentType, "image/") {
+		// Handle image response by sending it as an MCP tool result
+		utils.SendMCPToolImageResult(ctx, responseBody, contentType, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
+		return
+	}
+
+	// Strip the response down to the selected fields before it is rendered
+	responseBody = t.toolConfig.fieldProjection.project(responseBody)
+
+	if t.toolConfig.ResponseTemplate.isStructured() {
+		result, structured, err := t.toolConfig.renderStructuredResponse(responseBody)
+		if err != nil {
+			utils.OnMCPToolCallError(ctx, err)
+			return
+		}
+		utils.SendMCPToolTextResultWithStructuredContent(ctx, result, structured, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
+		return
+	}
+
+	// Case 1: Full response template is provided
+	if t.toolConfig.parsedResponseTemplate != nil {
+		templateResult, err := executeTemplate(t.toolConfig.parsedResponseTemplate, responseBody)
+		if err != nil {
+			utils.OnMCPToolCallError(ctx, fmt.Errorf("error executing response template: %v", err))
+			return
+		}
+		result = templateResult
+	} else {
+		// Case 2: No template, but prepend/append might be used
+		rawResponse := string(responseBody)
+
+		// Apply prepend/append if specified
+		if t.toolConfig.ResponseTemplate.PrependBody != "" || t.toolConfig.ResponseTemplate.AppendBody != "" {
+			result = t.toolConfig.ResponseTemplate.PrependBody + rawResponse + t.toolConfig.ResponseTemplate.AppendBody
+		} else {
+			// Case 3: No template and no prepend/append, just use raw response
+			result = rawResponse
+		}
+	}
+	if result == "" {
+		result = "success"
+	}
+
+	// Check if tool has outputSchema and try to parse response as structured content
+	var structuredContent json.RawMessage
+	if t.toolConfig.OutputSchema != nil && len(t.toolConfig.OutputSchema) > 0 {
+		// Try to parse response as JSON for structured content
+		if json.Valid(responseBody) {
+			structuredContent = json.RawMessage(responseBody)
+		}
+		// If not valid JSON, don't force structuredContent creation
+		// Standard approach: use isError: true + error text (type: "text")
+		// Only add structuredContent when there's a structured need for errors
+	}
+
+	// Send the result using structured content if available
+	if structuredContent != nil {
+		utils.SendMCPToolTextResultWithStructuredContent(ctx, result, structuredContent, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
+	} else {
+		utils.SendMCPToolTextResult(ctx, result, fmt.Sprintf("mcp:tools/call:%s/%s:result", t.serverName, t.name))
+	}
+}
+
 // Description implements Tool interface
 func (t *RestMCPTool) Description() string {
 	return t.toolConfig.Description
@@ -978,6 +1407,17 @@ func (t *RestMCPTool) InputSchema() map[string]any {
 			argSchema["default"] = arg.Default
 		}
 
+		// Add the constraints checked when the server validates arguments
+		if arg.Minimum != nil {
+			argSchema["minimum"] = *arg.Minimum
+		}
+		if arg.Maximum != nil {
+			argSchema["maximum"] = *arg.Maximum
+		}
+		if arg.Pattern != "" {
+			argSchema["pattern"] = arg.Pattern
+		}
+
 		// Add items for array type
 		if argType == "array" && arg.Items != nil {
 			argSchema["items"] = arg.Items
@@ -1014,6 +1454,10 @@ func (t *RestMCPTool) OutputSchema() map[string]any {
 	return t.toolConfig.OutputSchema
 }
 
+func (t *RestMCPTool) schemaPatterns() schemaPatterns {
+	return t.toolConfig.patterns
+}
+
 func convertHeaders(responseHeaders [][2]string) map[string]string {
 	headerMap := make(map[string]string)
 	for _, h := range responseHeaders {
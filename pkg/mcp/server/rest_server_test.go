@@ -22,6 +22,8 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
 )
 
 func TestConvertArgToString(t *testing.T) {
@@ -205,7 +207,7 @@ func TestHasContentType(t *testing.T) {
 	tests := []struct {
 		name            string
 		headers         [][2]string
-		contentTypeStr  string
+		isKind          func(string) bool
 		expectedOutcome bool
 	}{
 		{
@@ -213,7 +215,7 @@ func TestHasContentType(t *testing.T) {
 			headers: [][2]string{
 				{"Content-Type", "application/json"},
 			},
-			contentTypeStr:  "application/json",
+			isKind:          wrapper.IsJSONContentType,
 			expectedOutcome: true,
 		},
 		{
@@ -221,15 +223,39 @@ func TestHasContentType(t *testing.T) {
 			headers: [][2]string{
 				{"content-type", "application/JSON"},
 			},
-			contentTypeStr:  "application/json",
+			isKind:          wrapper.IsJSONContentType,
 			expectedOutcome: true,
 		},
 		{
-			name: "substring match",
+			name: "parameters ignored",
 			headers: [][2]string{
 				{"Content-Type", "application/json; charset=utf-8"},
 			},
-			contentTypeStr:  "application/json",
+			isKind:          wrapper.IsJSONContentType,
+			expectedOutcome: true,
+		},
+		{
+			name: "structured syntax suffix",
+			headers: [][2]string{
+				{"Content-Type", "application/problem+json"},
+			},
+			isKind:          wrapper.IsJSONContentType,
+			expectedOutcome: true,
+		},
+		{
+			name: "prefix of another type",
+			headers: [][2]string{
+				{"Content-Type", "application/json-seq"},
+			},
+			isKind:          wrapper.IsJSONContentType,
+			expectedOutcome: false,
+		},
+		{
+			name: "form",
+			headers: [][2]string{
+				{"Content-Type", "application/x-www-form-urlencoded; charset=utf-8"},
+			},
+			isKind:          wrapper.IsFormContentType,
 			expectedOutcome: true,
 		},
 		{
@@ -237,7 +263,7 @@ func TestHasContentType(t *testing.T) {
 			headers: [][2]string{
 				{"Content-Type", "text/plain"},
 			},
-			contentTypeStr:  "application/json",
+			isKind:          wrapper.IsJSONContentType,
 			expectedOutcome: false,
 		},
 		{
@@ -245,22 +271,22 @@ func TestHasContentType(t *testing.T) {
 			headers: [][2]string{
 				{"Accept", "application/json"},
 			},
-			contentTypeStr:  "application/json",
+			isKind:          wrapper.IsJSONContentType,
 			expectedOutcome: false,
 		},
 		{
 			name:            "empty headers",
 			headers:         [][2]string{},
-			contentTypeStr:  "application/json",
+			isKind:          wrapper.IsJSONContentType,
 			expectedOutcome: false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := hasContentType(tt.headers, tt.contentTypeStr)
+			result := hasContentType(tt.headers, tt.isKind)
 			if result != tt.expectedOutcome {
-				t.Errorf("hasContentType(%v, %v) = %v, want %v", tt.headers, tt.contentTypeStr, result, tt.expectedOutcome)
+				t.Errorf("hasContentType(%v) = %v, want %v", tt.headers, result, tt.expectedOutcome)
 			}
 		})
 	}
@@ -920,3 +946,132 @@ func TestRestServerSecurityFallback(t *testing.T) {
 
 	t.Logf("REST server security fallback test completed successfully")
 }
+
+func TestResponseTemplateContentTypes(t *testing.T) {
+	sampleResponse := []byte(`{"data": {"name": "Test", "value": 42, "zip": "01234"}, "debug": true}`)
+
+	tests := []struct {
+		name       string
+		template   RestToolResponseTemplate
+		text       string
+		structured string
+	}{
+		{
+			name: "json mappings",
+			template: RestToolResponseTemplate{
+				ContentType: ResponseContentTypeJSON,
+				Mappings: []RestToolResponseMapping{
+					{Path: "user.name", From: "data.name"},
+					{Path: "user.value", From: "data.value"},
+					{Path: "source", Value: "api"},
+					{Path: "missing", From: "data.missing", Value: nil},
+				},
+			},
+			text:       `{"user":{"name":"Test","value":42},"source":"api","missing":null}`,
+			structured: `{"user":{"name":"Test","value":42},"source":"api","missing":null}`,
+		},
+		{
+			name:       "json body template",
+			template:   RestToolResponseTemplate{ContentType: ResponseContentTypeJSON, Body: `[{{.data.value}}]`},
+			text:       `[42]`,
+			structured: `{"result":[42]}`,
+		},
+		{
+			name:       "json raw response",
+			template:   RestToolResponseTemplate{ContentType: ResponseContentTypeJSON},
+			text:       string(sampleResponse),
+			structured: string(sampleResponse),
+		},
+		{
+			name: "yaml mappings",
+			template: RestToolResponseTemplate{
+				ContentType: ResponseContentTypeYAML,
+				Mappings: []RestToolResponseMapping{
+					{Path: "name", From: "data.name"},
+					{Path: "zip", From: "data.zip"},
+					{Path: "tags", Value: []string{"a", "b"}},
+				},
+			},
+			text:       "name: Test\nzip: \"01234\"\ntags:\n    - a\n    - b\n",
+			structured: `{"name":"Test","zip":"01234","tags":["a","b"]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := RestTool{ResponseTemplate: tt.template}
+			tool.RequestTemplate.URL = "http://example.com/api"
+			assert.NoError(t, tool.parseTemplates())
+			text, structured, err := tool.renderStructuredResponse(sampleResponse)
+			assert.NoError(t, err)
+			if tt.template.ContentType == ResponseContentTypeJSON {
+				assert.JSONEq(t, tt.text, text)
+			} else {
+				assert.Equal(t, tt.text, text)
+			}
+			assert.JSONEq(t, tt.structured, string(structured))
+		})
+	}
+
+	tool := RestTool{ResponseTemplate: RestToolResponseTemplate{ContentType: ResponseContentTypeJSON, Body: `{"name": {{.data.name}}}`}}
+	assert.NoError(t, tool.parseTemplates())
+	_, _, err := tool.renderStructuredResponse(sampleResponse)
+	assert.ErrorContains(t, err, "not valid JSON")
+}
+
+func TestResponseTemplateContentTypeValidation(t *testing.T) {
+	invalid := []RestToolResponseTemplate{
+		{ContentType: "html", Body: "x"},
+		{Body: "x", Mappings: []RestToolResponseMapping{{Path: "a"}}},
+		{ContentType: ResponseContentTypeJSON, PrependBody: "x"},
+		{ContentType: ResponseContentTypeJSON, Body: "{}", Mappings: []RestToolResponseMapping{{Path: "a"}}},
+		{ContentType: ResponseContentTypeYAML, Mappings: []RestToolResponseMapping{{From: "a"}}},
+	}
+	for _, template := range invalid {
+		tool := RestTool{ResponseTemplate: template}
+		tool.RequestTemplate.URL = "http://example.com/api"
+		assert.Error(t, tool.parseTemplates(), "%+v", template)
+	}
+
+	// Direct response tools may build their result from mappings of the arguments
+	tool := RestTool{ResponseTemplate: RestToolResponseTemplate{
+		ContentType: ResponseContentTypeJSON,
+		Mappings:    []RestToolResponseMapping{{Path: "echo", From: "args.text"}},
+	}}
+	assert.NoError(t, tool.parseTemplates())
+	text, _, err := tool.renderStructuredResponse([]byte(`{"args":{"text":"hi"}}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"echo":"hi"}`, text)
+}
+
+func TestResponseTemplateFields(t *testing.T) {
+	tool := RestTool{ResponseTemplate: RestToolResponseTemplate{
+		Fields: []string{"id", "items.#.name", "owner", "owner.login", `meta\.version`},
+	}}
+	tool.RequestTemplate.URL = "http://example.com/api"
+	assert.NoError(t, tool.parseTemplates())
+
+	body := []byte(`{"meta.version":2,"id":1,"items":[{"name":"a","size":10},{"name":"b","tags":["x"]},3],` +
+		`"owner":{"login":"u","avatar":"..."},"debug":{"trace":"..."}}`)
+	assert.Equal(t,
+		`{"meta.version":2,"id":1,"items":[{"name":"a"},{"name":"b"},3],"owner":{"login":"u","avatar":"..."}}`,
+		string(tool.fieldProjection.project(body)))
+
+	// Arrays at the root are projected with #
+	tool = RestTool{ResponseTemplate: RestToolResponseTemplate{Fields: []string{"#.id"}}}
+	tool.RequestTemplate.URL = "http://example.com/api"
+	assert.NoError(t, tool.parseTemplates())
+	assert.Equal(t, `[{"id":1},{"id":2}]`, string(tool.fieldProjection.project([]byte(`[{"id":1,"x":0},{"id":2}]`))))
+
+	// Bodies that are not JSON objects or arrays are kept
+	assert.Equal(t, "not json", string(tool.fieldProjection.project([]byte("not json"))))
+	assert.Equal(t, `"text"`, string(tool.fieldProjection.project([]byte(`"text"`))))
+
+	// Without fields the body is kept whole
+	assert.Equal(t, string(body), string(RestTool{}.fieldProjection.project(body)))
+
+	for _, fields := range [][]string{{""}, {"a..b"}, {"a."}} {
+		tool := RestTool{ResponseTemplate: RestToolResponseTemplate{Fields: fields}}
+		tool.RequestTemplate.URL = "http://example.com/api"
+		assert.Error(t, tool.parseTemplates(), "%q", fields)
+	}
+}
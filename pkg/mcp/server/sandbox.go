@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// SandboxLimit is a ceiling of the work done by a single tools/call, 0 is unlimited
+type SandboxLimit struct {
+	MaxCallouts int   `json:"maxCallouts"` // HTTP callouts made while handling the call, including chained ones
+	MaxDuration int64 `json:"maxDuration"` // Milliseconds from the start of the call to the end of its last callout
+}
+
+// SandboxConfig limits the callouts of every tools/call, so that a runaway composite or chained tool
+// is stopped instead of holding the request
+type SandboxConfig struct {
+	SandboxLimit
+	Tools map[string]SandboxLimit `json:"tools"` // Limits of single tools, replacing the default limits
+}
+
+// ToolSandbox enforces the sandbox limits of tools/call
+type ToolSandbox struct {
+	config SandboxConfig
+}
+
+func parseSandbox(sandboxJson gjson.Result) (*ToolSandbox, error) {
+	var config SandboxConfig
+	if err := configerr.DecodeJSON("", []byte(sandboxJson.Raw), &config); err != nil {
+		return nil, err
+	}
+	check := func(pointer string, limit SandboxLimit) error {
+		if limit.MaxCallouts < 0 {
+			return configerr.Errorf(configerr.Join(pointer, "maxCallouts"), "a value of at least 0", "got %d", limit.MaxCallouts)
+		}
+		if limit.MaxDuration < 0 {
+			return configerr.Errorf(configerr.Join(pointer, "maxDuration"), "a value of at least 0", "got %d", limit.MaxDuration)
+		}
+		return nil
+	}
+	if err := check("", config.SandboxLimit); err != nil {
+		return nil, err
+	}
+	for tool, limit := range config.Tools {
+		if err := check(configerr.Join("/tools", tool), limit); err != nil {
+			return nil, err
+		}
+	}
+	return &ToolSandbox{config: config}, nil
+}
+
+// limit returns the limits of the tool
+func (s *ToolSandbox) limit(tool string) SandboxLimit {
+	if limit, ok := s.config.Tools[tool]; ok {
+		return limit
+	}
+	return s.config.SandboxLimit
+}
+
+// wrap applies the limits of the called tool to the callouts of the handler, callouts over the limits
+// fail with wrapper.ErrCalloutLimitExceeded, which the tool reports as its error
+func (s *ToolSandbox) wrap(handler utils.JsonRpcMethodHandler) utils.JsonRpcMethodHandler {
+	return func(ctx wrapper.HttpContext, id utils.JsonRpcID, params gjson.Result) error {
+		limit := s.limit(params.Get("name").String())
+		wrapper.LimitCallouts(limit.MaxCallouts, time.Duration(limit.MaxDuration)*time.Millisecond)
+		return handler(ctx, id, params)
+	}
+}
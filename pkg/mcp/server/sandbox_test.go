@@ -0,0 +1,37 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseSandbox(t *testing.T) {
+	sandbox, err := parseSandbox(gjson.Parse(`{"maxCallouts": 5, "maxDuration": 3000, "tools": {"crawl": {"maxCallouts": 20}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, SandboxLimit{MaxCallouts: 5, MaxDuration: 3000}, sandbox.limit("search"))
+	assert.Equal(t, SandboxLimit{MaxCallouts: 20}, sandbox.limit("crawl"))
+
+	_, err = parseSandbox(gjson.Parse(`{"maxDuration": -1}`))
+	assert.EqualError(t, err, `invalid config at "/maxDuration", expected a value of at least 0: got -1`)
+	_, err = parseSandbox(gjson.Parse(`{"tools": {"crawl": {"maxCallouts": -2}}}`))
+	assert.EqualError(t, err, `invalid config at "/tools/crawl/maxCallouts", expected a value of at least 0: got -2`)
+	_, err = parseSandbox(gjson.Parse(`{"maxCallouts": "many"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// SealedPrefix marks the argument values encrypted with ArgSealer.Seal, e.g. "sealed:3q2+7w..."
+const SealedPrefix = "sealed:"
+
+// ToolWithSensitiveArgs is implemented by tools whose sensitive arguments must not appear in logs,
+// tool call records and dry-run results
+type ToolWithSensitiveArgs interface {
+	SensitiveArgs() []string
+}
+
+// sensitiveArgsOf returns the names of the sensitive arguments of a tool
+func sensitiveArgsOf(tool Tool) []string {
+	if t, ok := tool.(ToolWithSensitiveArgs); ok {
+		return t.SensitiveArgs()
+	}
+	return nil
+}
+
+// ArgSealer encrypts and decrypts argument values with AES-GCM. Clients seal the values of sensitive
+// arguments with the key of the server, so that they are only decrypted by the gateway. The name of
+// the tool and of the argument are the additional data of the encryption, so that a sealed value is
+// only accepted for the argument it was sealed for.
+type ArgSealer struct {
+	aead cipher.AEAD
+}
+
+// NewArgSealer creates a sealer with an AES key of 16, 24 or 32 bytes
+func NewArgSealer(key []byte) (*ArgSealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &ArgSealer{aead: aead}, nil
+}
+
+// Seal encrypts the value of an argument of a tool into SealedPrefix followed by the base64url of the
+// nonce and the ciphertext
+func (s *ArgSealer) Seal(tool, arg, value string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(value), sealedArgData(tool, arg))
+	return SealedPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Unseal decrypts a value returned by Seal for the same argument of the same tool
+func (s *ArgSealer) Unseal(tool, arg, value string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, SealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed value: %v", err)
+	}
+	if len(data) < s.aead.NonceSize() {
+		return "", errors.New("invalid sealed value: too short")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, sealedArgData(tool, arg))
+	if err != nil {
+		return "", errors.New("invalid sealed value: authentication failed")
+	}
+	return string(plaintext), nil
+}
+
+// sealedArgData is the additional data binding a sealed value to an argument of a tool, the NUL
+// separator cannot appear in tool names
+func sealedArgData(tool, arg string) []byte {
+	return []byte(tool + "\x00" + arg)
+}
+
+// parseArgSealKey parses the base64 AES key of server.argSealKey
+func parseArgSealKey(key string) (*ArgSealer, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("argSealKey is not base64: %v", err)
+	}
+	sealer, err := NewArgSealer(data)
+	if err != nil {
+		return nil, fmt.Errorf("argSealKey must be an AES key of 16, 24 or 32 bytes: %v", err)
+	}
+	return sealer, nil
+}
+
+// isSealed tells whether an argument value was sealed by the client
+func isSealed(value interface{}) (string, bool) {
+	s, ok := value.(string)
+	return s, ok && strings.HasPrefix(s, SealedPrefix)
+}
+
+// redactArgs returns the JSON arguments with the values of the sensitive ones replaced by replace
+func redactArgs(args []byte, sensitive []string, replace func(value gjson.Result) string) []byte {
+	for _, name := range sensitive {
+		path := gjson.Escape(name)
+		value := gjson.GetBytes(args, path)
+		if !value.Exists() {
+			continue
+		}
+		if redacted, err := sjson.SetBytes(args, path, replace(value)); err == nil {
+			args = redacted
+		}
+	}
+	return args
+}
+
+// redactedArg replaces every sensitive value
+func redactedArg(gjson.Result) string {
+	return redactedValue
+}
+
+// sensitiveValues returns the forms of the values of the sensitive arguments that may appear in a
+// rendered request: as they are, URL-encoded and JSON-escaped
+func sensitiveValues(arguments map[string]interface{}, sensitive []string) []string {
+	var values []string
+	for _, name := range sensitive {
+		value, ok := arguments[name]
+		if !ok {
+			continue
+		}
+		s := convertArgToString(value)
+		if s == "" {
+			continue
+		}
+		values = append(values, s, url.QueryEscape(s), url.PathEscape(s))
+		if escaped, err := json.Marshal(s); err == nil {
+			values = append(values, string(escaped[1:len(escaped)-1]))
+		}
+	}
+	return values
+}
+
+// redactValues replaces the sensitive values wherever a template put them in the request
+func (r *DryRunRequest) redactValues(values []string) {
+	if len(values) == 0 {
+		return
+	}
+	pairs := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		pairs = append(pairs, v, redactedValue)
+	}
+	replacer := strings.NewReplacer(pairs...)
+	r.URL = replacer.Replace(r.URL)
+	r.Body = replacer.Replace(r.Body)
+	for i := range r.Headers {
+		r.Headers[i][1] = replacer.Replace(r.Headers[i][1])
+	}
+}
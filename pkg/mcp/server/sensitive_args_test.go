@@ -0,0 +1,171 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+var testArgSealKey = []byte("0123456789abcdef0123456789abcdef")
+
+// TestArgSealer tests the encryption of sealed argument values
+func TestArgSealer(t *testing.T) {
+	sealer, err := NewArgSealer(testArgSealKey)
+	require.NoError(t, err)
+	sealed, err := sealer.Seal("pay", "card", "4111 1111 1111 1111")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, SealedPrefix))
+	value, err := sealer.Unseal("pay", "card", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "4111 1111 1111 1111", value)
+
+	other, _ := NewArgSealer([]byte("fedcba9876543210fedcba9876543210"))
+	_, err = other.Unseal("pay", "card", sealed)
+	assert.EqualError(t, err, "invalid sealed value: authentication failed")
+	// A sealed value is bound to its argument of its tool
+	_, err = sealer.Unseal("pay", "note", sealed)
+	assert.EqualError(t, err, "invalid sealed value: authentication failed")
+	_, err = sealer.Unseal("refund", "card", sealed)
+	assert.EqualError(t, err, "invalid sealed value: authentication failed")
+	for _, invalid := range []string{"sealed:!!", "sealed:AAAA", sealed[:len(sealed)-2]} {
+		_, err = sealer.Unseal("pay", "card", invalid)
+		assert.Error(t, err, invalid)
+	}
+
+	_, err = NewArgSealer([]byte("short"))
+	assert.Error(t, err)
+	_, err = parseArgSealKey("not base64")
+	assert.Error(t, err)
+}
+
+// TestRedactArgs tests hiding the sensitive arguments in JSON arguments
+func TestRedactArgs(t *testing.T) {
+	args := []byte(`{"card":"4111","cvv":123,"amount":10,"a.b":"x"}`)
+	assert.JSONEq(t, `{"card":"REDACTED","cvv":"REDACTED","amount":10,"a.b":"REDACTED"}`,
+		string(redactArgs(args, []string{"card", "cvv", "a.b", "missing"}, redactedArg)))
+	assert.Equal(t, args, redactArgs(args, nil, redactedArg))
+}
+
+// TestSensitiveArgs tests that sealed arguments are decrypted, and that sensitive arguments are hidden
+// in dry-run results
+func TestSensitiveArgs(t *testing.T) {
+	defer startTestHttpContext("sensitive-args-test")()
+
+	config := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(`{
+		"server": {"name": "payments", "dryRun": "always", "argSealKey": "`+base64.StdEncoding.EncodeToString(testArgSealKey)+`"},
+		"tools": [{
+			"name": "pay",
+			"args": [
+				{"name": "card", "type": "string", "sensitive": true, "position": "query"},
+				{"name": "pin", "type": "integer", "sensitive": true, "position": "header"},
+				{"name": "amount", "type": "number"}
+			],
+			"requestTemplate": {"url": "https://pay.example.com/v1/charges", "method": "POST", "argsToJsonBody": true,
+				"headers": [{"key": "x-card", "value": "{{.args.card}}"}]}
+		}]
+	}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+	server := config.server.(*RestMCPServer)
+	require.NotNil(t, server.GetArgSealer())
+	assert.Equal(t, []string{"card", "pin"}, sensitiveArgsOf(server.GetMCPTools()["pay"]))
+	assert.NotNil(t, server.Clone().(*RestMCPServer).GetArgSealer())
+
+	call := func(args string) (gjson.Result, error) {
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}
+		tool := server.GetMCPTools()["pay"].Create([]byte(args))
+		err := tool.Call(ctx, server)
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response).Get("result.structuredContent"), err
+	}
+
+	sealedCard, _ := server.GetArgSealer().Seal("pay", "card", "4111 1111 1111 1111")
+	sealedPin, _ := server.GetArgSealer().Seal("pay", "pin", "1234")
+	request, err := call(`{"card": "` + sealedCard + `", "pin": "` + sealedPin + `", "amount": 9.5}`)
+	require.NoError(t, err)
+	assert.Equal(t, "https://pay.example.com/v1/charges?card=REDACTED", request.Get("url").String())
+	assert.Contains(t, request.Get("headers").Raw, `["x-card","REDACTED"]`)
+	assert.Contains(t, request.Get("headers").Raw, `["pin","REDACTED"]`)
+	assert.JSONEq(t, `{"amount": 9.5}`, request.Get("body").String())
+	assert.NotContains(t, request.Raw, "4111")
+	assert.NotContains(t, request.Raw, "1234")
+
+	// Plain values are hidden too
+	request, err = call(`{"card": "4111 1111 1111 1111", "amount": 1}`)
+	require.NoError(t, err)
+	assert.NotContains(t, request.Raw, "4111")
+
+	_, err = call(`{"card": "sealed:AAAA"}`)
+	assert.ErrorContains(t, err, "failed to unseal argument card")
+	_, err = call(`{"card": "` + sealedPin + `"}`)
+	assert.ErrorContains(t, err, "failed to unseal argument card")
+	server.SetArgSealer(nil)
+	_, err = call(`{"card": "` + sealedCard + `"}`)
+	assert.EqualError(t, err, "argument card is sealed but the server has no argSealKey")
+}
+
+// TestRecorderSensitiveArgs tests that tool call records carry neither the plain nor the sealed values
+// of sensitive arguments
+func TestRecorderSensitiveArgs(t *testing.T) {
+	defer startTestHttpContext("sensitive-args-recorder-test")()
+
+	server := NewRestMCPServer("payments")
+	require.NoError(t, server.AddRestTool(RestTool{
+		Name:            "pay",
+		Args:            []RestToolArg{{Name: "card", Sensitive: true}, {Name: "amount"}},
+		RequestTemplate: RestToolRequestTemplate{URL: "https://pay.example.com/v1/charges", Method: "POST"},
+	}))
+	sealer, _ := NewArgSealer(testArgSealKey)
+	server.SetArgSealer(sealer)
+	recorder, err := parseRecorder("payments", gjson.Parse(`{"sink": "http", "serviceName": "recorder.example.com", "servicePort": 80}`), nil)
+	require.NoError(t, err)
+	recorder.setSensitiveArgs(server)
+	client := &recordingClient{}
+	recorder.httpClient = client
+	record := func(body []byte) gjson.Result {
+		ctx := &contextStub{values: map[string]interface{}{}}
+		recorder.start(ctx, body)
+		runStreamDoneCallbacks(ctx)
+		require.NotEmpty(t, client.bodies)
+		return gjson.ParseBytes(client.bodies[len(client.bodies)-1])
+	}
+
+	body := []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"pay","arguments":{"card":"4111","amount":10}}}`)
+	assert.JSONEq(t, `{"card":"REDACTED","amount":10}`, record(body).Get("request.params.arguments").Raw)
+	assert.Contains(t, string(body), `"card":"4111"`, "the request body is not modified")
+
+	sealed, _ := sealer.Seal("pay", "card", "4111")
+	body = []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"pay","arguments":{"card":"` + sealed + `","amount":10}}}`)
+	assert.JSONEq(t, `{"card":"REDACTED","amount":10}`, record(body).Get("request.params.arguments").Raw)
+}
+
+// recordingClient keeps the bodies posted by a recorder
+type recordingClient struct {
+	wrapper.HttpClient
+	bodies [][]byte
+}
+
+func (c *recordingClient) Post(rawURL string, headers [][2]string, body []byte, cb wrapper.ResponseCallback, timeoutMillisecond ...uint32) error {
+	c.bodies = append(c.bodies, body)
+	return nil
+}
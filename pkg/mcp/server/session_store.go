@@ -0,0 +1,168 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	SessionStoreRedis = "redis"
+
+	defaultSessionStoreTimeout = 1000 // 1 second
+)
+
+// deleteSessionScript deletes the stored session of a backend only if it is still the given one,
+// so that a session renewed by another gateway instance is not dropped
+const deleteSessionScript = `local v = redis.call('GET', KEYS[1])
+if v and cjson.decode(v).id == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// SessionStore persists backend MCP sessions outside of the gateway instance, so that sessions
+// survive VM restarts and are shared between gateway instances. Lookups on the request path are
+// served from shared data first, the store is only consulted when a session is not found there.
+type SessionStore interface {
+	// Save stores the session as the current session of its backend, expiring after ttl
+	Save(session *McpSession, ttl time.Duration) error
+	// Delete removes the session if it is still the current session of its backend
+	Delete(session *McpSession) error
+	// Find looks up the current session of a key, see SessionKey, the callback receives nil if there is none
+	// and the error of the store if the lookup failed
+	Find(key string, callback func(session *McpSession, err error)) error
+}
+
+// SessionStoreConfig configures the external store of persisted backend sessions
+type SessionStoreConfig struct {
+	Type        string `json:"type"`        // Only redis is supported
+	ServiceName string `json:"serviceName"` // FQDN of the store service, e.g. redis.default.svc.cluster.local
+	ServicePort int64  `json:"servicePort"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Database    int    `json:"database"`
+	Timeout     int64  `json:"timeout"`   // Milliseconds
+	KeyPrefix   string `json:"keyPrefix"` // Defaults to mcp-sessions:<server name>
+}
+
+// RedisSessionStore stores the current session of every backend and credential under <keyPrefix>:<session key>
+type RedisSessionStore struct {
+	config SessionStoreConfig
+	client wrapper.RedisClient
+}
+
+// parseSessionStore validates the session store config, the Redis client is created by init
+func parseSessionStore(serverName string, storeJson gjson.Result) (*RedisSessionStore, error) {
+	var config SessionStoreConfig
+	if err := configerr.DecodeJSON("", []byte(storeJson.Raw), &config); err != nil {
+		return nil, err
+	}
+	if config.Type != SessionStoreRedis {
+		return nil, configerr.Errorf("/type", `"redis"`, "unknown session store type: %s", config.Type)
+	}
+	if config.ServiceName == "" {
+		return nil, configerr.New("/serviceName", "string", errors.New("session store serviceName is required"))
+	}
+	if config.ServicePort <= 0 {
+		return nil, configerr.New("/servicePort", "positive integer", errors.New("session store servicePort is required"))
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultSessionStoreTimeout
+	}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "mcp-sessions:" + serverName
+	}
+	return &RedisSessionStore{config: config}, nil
+}
+
+// init creates the Redis client, it must be called in the config phase
+func (s *RedisSessionStore) init() error {
+	client := wrapper.NewRedisClusterClient(wrapper.FQDNCluster{FQDN: s.config.ServiceName, Port: s.config.ServicePort})
+	if err := client.Init(s.config.Username, s.config.Password, s.config.Timeout, wrapper.WithDataBase(s.config.Database)); err != nil {
+		return fmt.Errorf("failed to init session store redis client: %w", err)
+	}
+	s.client = client
+	return nil
+}
+
+func (s *RedisSessionStore) key(sessionKey string) string {
+	return s.config.KeyPrefix + ":" + sessionKey
+}
+
+// Save implements SessionStore. Credentials never reach Redis: the request URL is not marshaled and
+// headers carrying credentials are dropped, even from sessions not stored through the session manager.
+func (s *RedisSessionStore) Save(session *McpSession, ttl time.Duration) error {
+	if s.client == nil {
+		return errors.New("session store is not initialized")
+	}
+	stored := *session
+	stored.Headers, _ = splitCredentialHeaders(session.Headers)
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %v", err)
+	}
+	seconds := int((ttl + time.Second - 1) / time.Second)
+	return s.client.SetEx(s.key(session.Key()), string(data), seconds, func(response resp.Value) {
+		if err := response.Error(); err != nil {
+			log.Warnf("failed to save MCP session %s to redis: %v", session.ID, err)
+		}
+	})
+}
+
+// Delete implements SessionStore
+func (s *RedisSessionStore) Delete(session *McpSession) error {
+	if s.client == nil {
+		return errors.New("session store is not initialized")
+	}
+	return s.client.Eval(deleteSessionScript, 1, []interface{}{s.key(session.Key())}, []interface{}{session.ID}, func(response resp.Value) {
+		if err := response.Error(); err != nil {
+			log.Warnf("failed to delete MCP session %s from redis: %v", session.ID, err)
+		}
+	})
+}
+
+// Find implements SessionStore
+func (s *RedisSessionStore) Find(key string, callback func(session *McpSession, err error)) error {
+	if s.client == nil {
+		return errors.New("session store is not initialized")
+	}
+	return s.client.Get(s.key(key), func(response resp.Value) {
+		if err := response.Error(); err != nil {
+			callback(nil, fmt.Errorf("failed to get MCP session of %s from redis: %w", key, err))
+			return
+		}
+		if response.IsNull() {
+			callback(nil, nil)
+			return
+		}
+		var session McpSession
+		if err := json.Unmarshal(response.Bytes(), &session); err != nil {
+			log.Warnf("Discarding malformed MCP session of %s in redis: %v", key, err)
+			callback(nil, nil)
+			return
+		}
+		callback(&session, nil)
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
@@ -52,38 +53,67 @@ const (
 	MaxSSEBufferSize = 100 * 1024 * 1024
 )
 
+// forwardOverSSE forwards a tools/list or tools/call request to a backend exposing the legacy HTTP+SSE transport.
+// The current request is turned into the GET that opens the SSE channel; initialize, notifications/initialized
+// and the request itself are posted to the message endpoint announced by the endpoint event, and the response
+// is picked from the stream by its request id in handleSSEStreamingResponse.
+func (h *McpProtocolHandler) forwardOverSSE(ctx wrapper.HttpContext, request map[string]interface{}, authInfo *ProxyAuthInfo) error {
+	if h.proxyServer == nil {
+		return errors.New("sse transport requires the handler to be created by an mcp-proxy server")
+	}
+	jsonRpcID, ok := ctx.GetContext(utils.CtxJsonRpcID).(utils.JsonRpcID)
+	if !ok {
+		return errors.New("JSON-RPC ID not found in context")
+	}
+	// Use id: 2 because initialize uses id: 1, and we only send one tool request (list or call) per channel
+	request["id"] = 2
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %v request: %v", request["method"], err)
+	}
+
+	// Store everything the streaming response phase needs to drive the SSE exchange
+	ctx.SetContext(CtxSSEProxyJsonRpcID, jsonRpcID)
+	ctx.SetContext(CtxSSEProxyRequestBody, requestBody)
+	ctx.SetContext(CtxSSEProxyAuthInfo, authInfo)
+	ctx.SetContext("mcp_proxy_server", h.proxyServer)
+
+	// The request will continue through the filter chain and be routed to the backend SSE endpoint
+	if err := initiateSSEChannelInRequestPhase(ctx, h.proxyServer, authInfo); err != nil {
+		log.Errorf("Failed to convert request to SSE GET: %v", err)
+		return err
+	}
+	return nil
+}
+
+// isSSEChannelOpened reports whether the current request was turned into the GET opening an SSE channel
+func isSSEChannelOpened(ctx wrapper.HttpContext) bool {
+	return ctx.GetContext(CtxSSEProxyState) != nil
+}
+
+// matchesRequestID reports whether a JSON-RPC id received on the SSE channel answers the request sent with
+// requestID. Some backends echo numeric ids as strings, so both forms are accepted.
+func matchesRequestID(id gjson.Result, requestID int) bool {
+	switch id.Type {
+	case gjson.Number:
+		return id.Raw == strconv.Itoa(requestID)
+	case gjson.String:
+		return id.Str == strconv.Itoa(requestID)
+	}
+	return false
+}
+
 // injectSSEResponseSuccess injects a successful JSON-RPC response in streaming response body phase
-func injectSSEResponseSuccess(ctx wrapper.HttpContext, result map[string]any) {
+func injectSSEResponseSuccess(ctx wrapper.HttpContext, result []byte) {
 	// Get JSON-RPC ID from context
 	jsonRpcIDRaw := ctx.GetContext(CtxSSEProxyJsonRpcID)
 	if jsonRpcIDRaw == nil {
 		log.Errorf("JSON-RPC ID not found in context for SSE response")
 		return
 	}
-	jsonRpcID := jsonRpcIDRaw.(utils.JsonRpcID)
-
-	var body []byte
-	var err error
-	if jsonRpcID.IsString {
-		body, err = json.Marshal(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      jsonRpcID.StringValue,
-			"result":  result,
-		})
-	} else {
-		body, err = json.Marshal(map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      jsonRpcID.IntValue,
-			"result":  result,
-		})
-	}
-
-	if err != nil {
-		log.Errorf("Failed to marshal JSON-RPC success response: %v", err)
-		return
-	}
+	body := utils.NewJsonRpcResultBody(jsonRpcIDRaw.(utils.JsonRpcID), utils.FilterResult(ctx, result))
 
-	proxywasm.InjectEncodedDataToFilterChain(body, true)
+	injectSSEResponseBody(ctx, body)
 }
 
 // injectSSEResponseError injects an error JSON-RPC response in streaming response body phase
@@ -123,6 +153,17 @@ func injectSSEResponseError(ctx wrapper.HttpContext, err error, errorCode int) {
 		return
 	}
 
+	injectSSEResponseBody(ctx, body)
+}
+
+// injectSSEResponseBody injects the final JSON-RPC response, framed as an event when the client
+// negotiated an SSE response
+func injectSSEResponseBody(ctx wrapper.HttpContext, body []byte) {
+	utils.StopSSEKeepAlive(ctx)
+	ctx.SetContext(utils.CtxJsonRpcResponse, body)
+	if utils.IsSSEResponse(ctx) {
+		body = utils.SSEResponseBody(ctx, body)
+	}
 	proxywasm.InjectEncodedDataToFilterChain(body, true)
 }
 
@@ -292,7 +333,7 @@ func sendSSEInitialize(ctx wrapper.HttpContext, endpointURL string, authInfo *Pr
 		if statusCode != 200 && statusCode != 202 {
 			log.Errorf("SSE initialize request failed with status %d: %s", statusCode, string(responseBody))
 			// At this point, we're in streaming response phase, must use injectSSEResponseError
-			injectSSEResponseError(ctx, fmt.Errorf("SSE initialize failed with status %d", statusCode), utils.ErrInternalError)
+			injectSSEResponseError(ctx, fmt.Errorf("SSE initialize failed with status %d", statusCode), proxyServer.GetErrorCodeMapping().ErrorCode(statusCode))
 			return
 		}
 
@@ -423,7 +464,7 @@ func sendSSEToolRequest(ctx wrapper.HttpContext, endpointURL string, authInfo *P
 		if statusCode != 200 && statusCode != 202 {
 			log.Errorf("SSE tool request failed with status %d: %s", statusCode, string(responseBody))
 			// At this point, we're in streaming response phase, must use injectSSEResponseError
-			injectSSEResponseError(ctx, fmt.Errorf("SSE tool request failed with status %d", statusCode), utils.ErrInternalError)
+			injectSSEResponseError(ctx, fmt.Errorf("SSE tool request failed with status %d", statusCode), proxyServer.GetErrorCodeMapping().ErrorCode(statusCode))
 			return
 		}
 
@@ -464,6 +505,7 @@ func copyHeadersForSSERequest(ctx wrapper.HttpContext) [][2]string {
 		}
 		headers = append(headers, header)
 	}
+	utils.SetCorrelationIDHeader(ctx, &headers)
 
 	log.Debugf("Copied %d headers from request in response phase for SSE", len(headers))
 	return headers
@@ -533,7 +575,7 @@ func handleSSEStreamingResponse(ctx wrapper.HttpContext, config McpServerConfig,
 	if isFirstChunk {
 		// Validate that backend returned text/event-stream
 		contentType, err := proxywasm.GetHttpResponseHeader("content-type")
-		if err != nil || !strings.Contains(strings.ToLower(contentType), "text/event-stream") {
+		if err != nil || !wrapper.IsSSEContentType(contentType) {
 			log.Errorf("Backend did not return text/event-stream content-type, got: %s", contentType)
 			// Return JSON-RPC error
 			injectSSEResponseError(ctx, fmt.Errorf("invalid content-type, expected text/event-stream but got: %s", contentType), utils.ErrInternalError)
@@ -542,8 +584,23 @@ func handleSSEStreamingResponse(ctx wrapper.HttpContext, config McpServerConfig,
 
 		// Remove content-length and modify content-type
 		proxywasm.RemoveHttpResponseHeader("content-length")
-		proxywasm.ReplaceHttpResponseHeader("content-type", "application/json; charset=utf-8")
+		if utils.IsSSEResponse(ctx) {
+			proxywasm.ReplaceHttpResponseHeader("content-type", utils.SSEContentType)
+			proxywasm.ReplaceHttpResponseHeader("cache-control", "no-cache")
+		} else {
+			proxywasm.ReplaceHttpResponseHeader("content-type", "application/json; charset=utf-8")
+		}
 		proxywasm.ReplaceHttpResponseHeader(":status", "200")
+		// Keep the client connection alive on ticks while the backend does not send anything
+		if utils.IsSSEResponse(ctx) {
+			utils.KeepSSEAlive(ctx)
+			OnStreamDone(ctx, func(HttpContext) { utils.StopSSEKeepAlive(ctx) })
+		}
+	}
+
+	// Keep the client connection alive while waiting for the backend result
+	if ping := utils.SSEKeepAlive(ctx); ping != nil {
+		proxywasm.InjectEncodedDataToFilterChain(ping, false)
 	}
 
 	// Get or initialize buffer
@@ -691,7 +748,7 @@ func handleWaitingInitResp(ctx wrapper.HttpContext, config McpServerConfig, buff
 		if msg.Event == "message" {
 			// Parse JSON-RPC response
 			var jsonRpcResp map[string]interface{}
-			if err := json.Unmarshal([]byte(msg.Data), &jsonRpcResp); err != nil {
+			if err := utils.UnmarshalJSON([]byte(msg.Data), &jsonRpcResp); err != nil {
 				log.Errorf("Failed to parse JSON-RPC response: %v", err)
 				continue
 			}
@@ -699,13 +756,7 @@ func handleWaitingInitResp(ctx wrapper.HttpContext, config McpServerConfig, buff
 			// Check if this is the initialize response
 			respID := jsonRpcResp["id"]
 			if respID != nil {
-				var idMatch bool
-				switch v := respID.(type) {
-				case float64:
-					idMatch = int(v) == requestID.(int)
-				case int:
-					idMatch = v == requestID.(int)
-				}
+				idMatch := matchesRequestID(gjson.Get(msg.Data, "id"), requestID.(int))
 
 				if idMatch {
 					// Check for errors
@@ -790,79 +841,37 @@ func handleWaitingToolResp(ctx wrapper.HttpContext, config McpServerConfig, buff
 		// Check for message event
 		if msg.Event == "message" {
 			// Parse JSON-RPC response
-			var jsonRpcResp map[string]interface{}
-			if err := json.Unmarshal([]byte(msg.Data), &jsonRpcResp); err != nil {
-				log.Errorf("Failed to parse JSON-RPC response: %v", err)
+			if !gjson.Valid(msg.Data) {
+				log.Errorf("Failed to parse JSON-RPC response: %s", msg.Data)
 				continue
 			}
+			jsonRpcResp := gjson.Parse(msg.Data)
+			if proxyServer, ok := ctx.GetContext("mcp_proxy_server").(*McpProxyServer); ok {
+				proxyServer.observeBackendMessage(jsonRpcResp)
+			}
 
 			// Check if this is the expected response
-			respID := jsonRpcResp["id"]
-			if respID != nil {
-				var idMatch bool
-				switch v := respID.(type) {
-				case float64:
-					idMatch = int(v) == requestID.(int)
-				case int:
-					idMatch = v == requestID.(int)
+			if matchesRequestID(jsonRpcResp.Get("id"), requestID.(int)) {
+				// Check for errors
+				if errorObj := jsonRpcResp.Get("error"); errorObj.Exists() {
+					log.Errorf("Backend tool error: %s", errorObj.Raw)
+					injectSSEResponseError(ctx, fmt.Errorf("backend tool call failed"), utils.ErrInternalError)
+					return []byte{}
 				}
 
-				if idMatch {
-					// Check for errors
-					if errorObj, hasError := jsonRpcResp["error"]; hasError {
-						log.Errorf("Backend tool error: %v", errorObj)
-						injectSSEResponseError(ctx, fmt.Errorf("backend tool call failed"), utils.ErrInternalError)
-						return []byte{}
-					}
-
-					// Extract result and return to client
-					if result, hasResult := jsonRpcResp["result"]; hasResult {
-						if resultMap, ok := result.(map[string]interface{}); ok {
-							// Apply allowTools filtering if this is a tools/list response
-							filteredResult := resultMap
-							if _, hasTools := resultMap["tools"]; hasTools {
-								// Get pre-computed effective allowTools from context
-								if allowToolsCtx := ctx.GetContext("mcp_proxy_effective_allow_tools"); allowToolsCtx != nil {
-									if effectiveAllowTools, ok := allowToolsCtx.(*map[string]struct{}); ok && effectiveAllowTools != nil {
-										// Apply filtering
-										if tools, hasToolsArray := resultMap["tools"]; hasToolsArray {
-											if toolsArray, ok := tools.([]interface{}); ok {
-												filteredTools := make([]interface{}, 0)
-												for _, tool := range toolsArray {
-													if toolMap, ok := tool.(map[string]interface{}); ok {
-														if name, hasName := toolMap["name"]; hasName {
-															if toolName, ok := name.(string); ok {
-																if _, allow := (*effectiveAllowTools)[toolName]; allow {
-																	filteredTools = append(filteredTools, tool)
-																}
-															}
-														}
-													}
-												}
-												// Create filtered result
-												filteredResult = make(map[string]interface{})
-												for k, v := range resultMap {
-													filteredResult[k] = v
-												}
-												filteredResult["tools"] = filteredTools
-											}
-										}
-									}
-								}
-							}
-
-							injectSSEResponseSuccess(ctx, filteredResult)
-							// Clear buffer as we've processed the response
-							*buffer = []byte{}
-							ctx.SetContext(CtxSSEProxyBuffer, *buffer)
-							return []byte{}
-						}
-					}
-
-					log.Errorf("Invalid tool response format")
-					injectSSEResponseError(ctx, errors.New("invalid response format"), utils.ErrInternalError)
+				// Extract the raw result and return to client, filtering tools if this is a tools/list response
+				if result := jsonRpcResp.Get("result"); result.IsObject() {
+					storeToolsListResult(ctx, []byte(result.Raw))
+					injectSSEResponseSuccess(ctx, filterAllowedTools(exposedTools(ctx, result), effectiveAllowTools(ctx), toolPermissionsOf(ctx)))
+					// Clear buffer as we've processed the response
+					*buffer = []byte{}
+					ctx.SetContext(CtxSSEProxyBuffer, *buffer)
 					return []byte{}
 				}
+
+				log.Errorf("Invalid tool response format")
+				injectSSEResponseError(ctx, errors.New("invalid response format"), utils.ErrInternalError)
+				return []byte{}
 			}
 		}
 
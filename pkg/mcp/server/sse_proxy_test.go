@@ -16,6 +16,11 @@ package server
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/test"
 )
 
 // TestParseSSEMessage tests SSE message parsing
@@ -245,6 +250,25 @@ func TestMcpProxyServerTransport(t *testing.T) {
 	}
 }
 
+// TestProtocolHandlerTransport tests that protocol handlers inherit the server transport
+func TestProtocolHandlerTransport(t *testing.T) {
+	server := NewMcpProxyServer("test-server")
+	server.SetTransport(TransportSSE)
+
+	handler := server.newProtocolHandler()
+	assert.Equal(t, TransportSSE, handler.transport)
+	assert.Same(t, server, handler.proxyServer)
+}
+
+// TestMatchesRequestID tests correlation of SSE responses with the request id
+func TestMatchesRequestID(t *testing.T) {
+	assert.True(t, matchesRequestID(gjson.Get(`{"id":3}`, "id"), 3))
+	assert.True(t, matchesRequestID(gjson.Get(`{"id":"3"}`, "id"), 3))
+	assert.False(t, matchesRequestID(gjson.Get(`{"id":2}`, "id"), 3))
+	assert.False(t, matchesRequestID(gjson.Get(`{"id":3.5}`, "id"), 3))
+	assert.False(t, matchesRequestID(gjson.Get(`{"method":"ping"}`, "id"), 3))
+}
+
 // TestSSEMessageParsing_MultipleMessages tests parsing multiple SSE messages
 func TestSSEMessageParsing_MultipleMessages(t *testing.T) {
 	data := []byte(`event: endpoint
@@ -295,3 +319,20 @@ data: {"id":2}
 		t.Errorf("Expected no more messages, got: %+v", msg4)
 	}
 }
+
+// TestResponseModeConfig tests parsing of the server.responseMode option
+func TestResponseModeConfig(t *testing.T) {
+	defer startTestHttpContext("response-mode-test")()
+
+	echo := test.MCPTool{Name: "echo", RequestTemplate: map[string]interface{}{"url": "http://backend/echo", "method": "GET"}}
+	config := &McpServerConfig{}
+	fixture := test.NewMCPServerConfig("sse-server").WithServerField("responseMode", "sse").WithTools(echo).Build()
+	err := parseConfigCore(gjson.ParseBytes(fixture), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+	assert.NoError(t, err)
+	assert.True(t, config.sseResponse)
+
+	config = &McpServerConfig{}
+	fixture = test.NewMCPServerConfig("sse-server").WithServerField("responseMode", "stream").WithTools(echo).Build()
+	err = parseConfigCore(gjson.ParseBytes(fixture), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+	assert.ErrorContains(t, err, "/server/responseMode")
+}
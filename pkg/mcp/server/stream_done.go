@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// CtxStreamDoneCallbacks stores the cleanup callbacks registered during the current request
+const CtxStreamDoneCallbacks = "mcp_stream_done_callbacks"
+
+// StreamDoneCallback releases resources held by a tool call, such as temporary backend sessions or locks
+type StreamDoneCallback func(ctx HttpContext)
+
+// OnStreamDone registers a callback that runs when the downstream HTTP stream completes or aborts,
+// including when the client disconnects while a tool call is still waiting for its backend.
+// Callbacks run once, in reverse order of registration.
+func OnStreamDone(ctx HttpContext, callback StreamDoneCallback) {
+	if callback == nil {
+		return
+	}
+	callbacks, _ := ctx.GetContext(CtxStreamDoneCallbacks).([]StreamDoneCallback)
+	ctx.SetContext(CtxStreamDoneCallbacks, append(callbacks, callback))
+}
+
+func onHttpStreamDone(ctx wrapper.HttpContext, config McpServerConfig) {
+	runStreamDoneCallbacks(ctx)
+}
+
+// runStreamDoneCallbacks runs the registered callbacks, isolating panics so that one failing
+// callback does not prevent the remaining resources from being released
+func runStreamDoneCallbacks(ctx HttpContext) {
+	callbacks, _ := ctx.GetContext(CtxStreamDoneCallbacks).([]StreamDoneCallback)
+	if len(callbacks) == 0 {
+		return
+	}
+	ctx.SetContext(CtxStreamDoneCallbacks, nil)
+	for i := len(callbacks) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("stream done callback panicked: %v", r)
+				}
+			}()
+			callbacks[i](ctx)
+		}()
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// contextStub implements the request context storage of wrapper.HttpContext
+type contextStub struct {
+	wrapper.HttpContext
+	values map[string]interface{}
+}
+
+func (c *contextStub) SetContext(key string, value interface{}) {
+	c.values[key] = value
+}
+
+func (c *contextStub) GetContext(key string) interface{} {
+	return c.values[key]
+}
+
+// TestStreamDoneCallbacks tests ordering, panic isolation and single execution of cleanup callbacks
+func TestStreamDoneCallbacks(t *testing.T) {
+	ctx := &contextStub{values: map[string]interface{}{}}
+	var calls []string
+	OnStreamDone(ctx, func(HttpContext) { calls = append(calls, "session") })
+	OnStreamDone(ctx, nil)
+	OnStreamDone(ctx, func(HttpContext) { panic("release failed") })
+	OnStreamDone(ctx, func(HttpContext) { calls = append(calls, "lock") })
+
+	onHttpStreamDone(ctx, McpServerConfig{})
+	assert.Equal(t, []string{"lock", "session"}, calls)
+
+	onHttpStreamDone(ctx, McpServerConfig{})
+	assert.Len(t, calls, 2, "callbacks must run only once")
+}
@@ -0,0 +1,351 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	defaultToolSourceInterval = 30000
+	defaultToolSourceTimeout  = 3000
+	defaultToolSourceHistory  = 5
+	// Another VM takes over polling when the poller missed a few ticks
+	toolSourceLeaseTicks = 3
+
+	toolSourceSharedDataKeyPrefix = "mcp-tool-source"
+
+	// ctxKeyToolSourceConfig pins the config serving a request, so that a version applied while the
+	// request is processed does not change its tools
+	ctxKeyToolSourceConfig = "mcp_tool_source_config"
+)
+
+// toolSourceKeys are the fields of the plugin config that the definitions of a tool source replace
+var toolSourceKeys = []string{"tools", "resources", "resourceTemplates", "prompts", "allowTools"}
+
+// ToolSourceConfig configures the config source the tool definitions of a REST server are pulled from,
+// e.g. a Nacos configuration or a Kubernetes ConfigMap served over the config cluster of the gateway
+type ToolSourceConfig struct {
+	ServiceName string            `json:"serviceName"` // FQDN of the config service, e.g. nacos.default.svc.cluster.local
+	ServicePort int64             `json:"servicePort"` // Port of the config service
+	Path        string            `json:"path"`        // Path of the definitions, e.g. /nacos/v1/cs/configs?dataId=mcp-tools&group=DEFAULT_GROUP
+	Headers     map[string]string `json:"headers"`     // Headers of the requests, e.g. an access token
+	// ContentPath is the gjson path of the definitions in the response, e.g. data.tools\.json for a ConfigMap,
+	// a string value is parsed as JSON. The whole response is the definitions when it is empty.
+	ContentPath string `json:"contentPath"`
+	Interval    int64  `json:"interval"` // Milliseconds between polls, defaults to 30000
+	Timeout     int64  `json:"timeout"`  // Timeout of a poll in milliseconds, defaults to 3000
+	History     int    `json:"history"`  // Number of applied versions kept, defaults to 5
+}
+
+// ToolSourceVersion is a set of definitions applied from a tool source
+type ToolSourceVersion struct {
+	Version   string // ETag of the response, or the hash of the definitions when the source has no ETag
+	AppliedAt int64  // Unix milliseconds
+}
+
+// ToolSource watches a config source for the tool definitions of a server. The definitions, an object with
+// any of tools, resources, resourceTemplates, prompts and allowTools, replace those of the plugin config. A
+// new version is validated like the plugin config before it is applied; a version failing validation is
+// rejected and the server keeps serving the last version that passed, or the plugin config.
+//
+// The source is polled by a single VM, the one holding the poller lease of the server. It publishes the
+// versions it applied in shared data, where the other VMs pick them up on their ticks.
+type ToolSource struct {
+	config     ToolSourceConfig
+	serverName string
+	key        string           // Shared data key of the published version, and prefix of the poller lease
+	baseJson   string           // Plugin config the definitions are merged into
+	base       *McpServerConfig // Config parsed from the plugin config
+	servers    map[string]Server
+	registry   *GlobalToolRegistry
+	client     wrapper.HttpClient
+	active     *McpServerConfig // Config of the applied version, nil until a version is applied
+	etag       string
+	rejected   string // Last rejected version, it is not validated again until the source changes
+	history    []ToolSourceVersion
+	pending    bool
+	applied    proxywasm.MetricCounter
+	rejections proxywasm.MetricCounter
+}
+
+// parseToolSource validates the tool source config, polling is started by start
+func parseToolSource(serverName string, sourceJson gjson.Result) (*ToolSource, error) {
+	var config ToolSourceConfig
+	if err := configerr.DecodeJSON("", []byte(sourceJson.Raw), &config); err != nil {
+		return nil, err
+	}
+	if config.ServiceName == "" {
+		return nil, configerr.New("/serviceName", "string", errors.New("toolSource serviceName is required"))
+	}
+	if config.ServicePort <= 0 {
+		return nil, configerr.New("/servicePort", "positive integer", errors.New("toolSource servicePort is required"))
+	}
+	if !strings.HasPrefix(config.Path, "/") {
+		return nil, configerr.Errorf("/path", "path starting with /", "invalid toolSource path: %q", config.Path)
+	}
+	if config.Interval <= 0 {
+		config.Interval = defaultToolSourceInterval
+	}
+	// Tick functions are driven by a 100ms host tick
+	config.Interval = (config.Interval + 99) / 100 * 100
+	if config.Timeout <= 0 {
+		config.Timeout = defaultToolSourceTimeout
+	}
+	if config.History <= 0 {
+		config.History = defaultToolSourceHistory
+	}
+	return &ToolSource{config: config, serverName: serverName, key: fmt.Sprintf("%s:%s", toolSourceSharedDataKeyPrefix, serverName)}, nil
+}
+
+// toolSourceEntry is the shared data value of the version of a tool source published by its poller
+type toolSourceEntry struct {
+	Version     string          `json:"version"`
+	ETag        string          `json:"etag,omitempty"`
+	Definitions json.RawMessage `json:"definitions"`
+}
+
+// start begins polling the source, it must be called in the config phase once the plugin config is parsed
+func (s *ToolSource) start(base *McpServerConfig, baseJson string, opts *ConfigOptions) {
+	s.base = base
+	s.baseJson = baseJson
+	s.servers = opts.Servers
+	s.registry = opts.ToolRegistry
+	s.client = wrapper.NewClusterClient(wrapper.FQDNCluster{FQDN: s.config.ServiceName, Port: s.config.ServicePort})
+	s.applied = proxywasm.DefineCounterMetric(fmt.Sprintf("mcp_tool_source.%s.applied", s.serverName))
+	s.rejections = proxywasm.DefineCounterMetric(fmt.Sprintf("mcp_tool_source.%s.rejected", s.serverName))
+	ttl := time.Duration(s.config.Interval*toolSourceLeaseTicks) * time.Millisecond
+	wrapper.RegisterTickFunc(s.config.Interval, func() {
+		s.tick(ttl)
+	})
+}
+
+// tick applies the version published by the poller, and polls the source when the VM holds, or can
+// take, the poller lease
+func (s *ToolSource) tick(ttl time.Duration) {
+	s.sync()
+	if wrapper.HoldLease(s.key+":poller", ttl) {
+		s.poll()
+	}
+}
+
+// sync applies the version published in shared data when the VM does not serve it yet
+func (s *ToolSource) sync() {
+	data, _, err := proxywasm.GetSharedData(s.key)
+	if err != nil || len(data) == 0 {
+		if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+			log.Warnf("Failed to get the published version of the tool source of server %s: %v", s.serverName, err)
+		}
+		return
+	}
+	var entry toolSourceEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Warnf("Discarding malformed published version of the tool source of server %s: %v", s.serverName, err)
+		return
+	}
+	if entry.ETag != "" {
+		s.etag = entry.ETag
+	}
+	if entry.Version == s.Version() || entry.Version == s.rejected {
+		return
+	}
+	if err := s.apply(entry.Version, gjson.ParseBytes(entry.Definitions)); err != nil {
+		s.reject(entry.Version, err)
+	}
+}
+
+// publish writes an applied version to shared data for the other VMs
+func (s *ToolSource) publish(version string, definitions gjson.Result) {
+	value, _ := json.Marshal(toolSourceEntry{Version: version, ETag: s.etag, Definitions: json.RawMessage(definitions.Raw)})
+	_, cas, err := proxywasm.GetSharedData(s.key)
+	if err != nil {
+		// Only create the entry when no other VM created it in the meantime
+		cas = math.MaxUint32
+	}
+	if err := proxywasm.SetSharedData(s.key, value, cas); err != nil {
+		log.Warnf("Failed to publish version %s of the tool source of server %s: %v", version, s.serverName, err)
+	}
+}
+
+// reject records a version failing validation, it is not validated again until the source changes
+func (s *ToolSource) reject(version string, err error) {
+	s.rejected = version
+	s.rejections.Increment(1)
+	log.Errorf("Rejected version %s of the tool source of server %s, serving version %q: %v", version, s.serverName, s.Version(), err)
+}
+
+// Version returns the applied version, empty while the server serves the definitions of the plugin config
+func (s *ToolSource) Version() string {
+	if len(s.history) == 0 {
+		return ""
+	}
+	return s.history[len(s.history)-1].Version
+}
+
+// History returns the last applied versions, the latest last
+func (s *ToolSource) History() []ToolSourceVersion {
+	return append([]ToolSourceVersion(nil), s.history...)
+}
+
+// poll requests the definitions, unless the previous poll has not been answered yet, and publishes the
+// versions it applies
+func (s *ToolSource) poll() {
+	if s.pending {
+		return
+	}
+	headers := make([][2]string, 0, len(s.config.Headers)+1)
+	for key, value := range s.config.Headers {
+		headers = append(headers, [2]string{key, value})
+	}
+	if s.etag != "" {
+		headers = append(headers, [2]string{"If-None-Match", s.etag})
+	}
+	err := s.client.Get(s.config.Path, headers, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		s.pending = false
+		switch statusCode {
+		case http.StatusOK:
+		case http.StatusNotModified:
+			return
+		default:
+			log.Warnf("Failed to poll the tool source of server %s, status: %d", s.serverName, statusCode)
+			return
+		}
+		version := responseHeaders.Get("ETag")
+		if version == "" {
+			h := fnv.New64a()
+			h.Write(responseBody)
+			version = fmt.Sprintf("%016x", h.Sum64())
+		} else {
+			s.etag = version
+		}
+		if version == s.Version() || version == s.rejected {
+			return
+		}
+		definitions, err := s.definitionsOf(responseBody)
+		if err == nil {
+			err = s.apply(version, definitions)
+		}
+		if err != nil {
+			s.reject(version, err)
+			return
+		}
+		s.publish(version, definitions)
+	}, uint32(s.config.Timeout))
+	if err != nil {
+		log.Warnf("Failed to poll the tool source of server %s: %v", s.serverName, err)
+		return
+	}
+	s.pending = true
+}
+
+// definitionsOf returns the definitions of a response of the source
+func (s *ToolSource) definitionsOf(body []byte) (gjson.Result, error) {
+	content := gjson.ParseBytes(body)
+	if s.config.ContentPath != "" {
+		content = content.Get(s.config.ContentPath)
+		if content.Type == gjson.String {
+			content = gjson.Parse(content.Str)
+		}
+	}
+	if !content.IsObject() || !gjson.Valid(content.Raw) {
+		return gjson.Result{}, errors.New("definitions must be a JSON object")
+	}
+	return content, nil
+}
+
+// apply validates the definitions of a version and serves them if they pass
+func (s *ToolSource) apply(version string, content gjson.Result) error {
+	merged := s.baseJson
+	for _, key := range toolSourceKeys {
+		var err error
+		if value := content.Get(key); value.Exists() {
+			merged, err = sjson.SetRaw(merged, key, value.Raw)
+		} else {
+			merged, err = sjson.Delete(merged, key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tools are registered once the version passes validation
+	registry := &GlobalToolRegistry{}
+	registry.Initialize()
+	config := &McpServerConfig{}
+	if err := parseConfigCore(gjson.Parse(merged), config, &ConfigOptions{Servers: s.servers, ToolRegistry: registry}); err != nil {
+		return err
+	}
+	config.adoptClients(s.base)
+	config.toolSource = s
+	s.registry.serverTools[s.serverName] = registry.serverTools[s.serverName]
+	s.active = config
+	s.rejected = ""
+	s.history = append(s.history, ToolSourceVersion{Version: version, AppliedAt: time.Now().UnixMilli()})
+	if len(s.history) > s.config.History {
+		s.history = s.history[len(s.history)-s.config.History:]
+	}
+	s.applied.Increment(1)
+	log.Infof("Applied version %s of the tool source of server %s with %d tools", version, s.serverName, len(config.server.GetMCPTools()))
+	return nil
+}
+
+// adoptClients shares the clients initialized for the plugin config with a config parsed from a tool source,
+// the settings they were created for are not defined by tool sources
+func (c *McpServerConfig) adoptClients(base *McpServerConfig) {
+	if c.recorder != nil && base.recorder != nil {
+		c.recorder.redisClient = base.recorder.redisClient
+		c.recorder.httpClient = base.recorder.httpClient
+	}
+	if c.quota != nil && base.quota != nil {
+		c.quota.client = base.quota.client
+	}
+	if server, ok := c.server.(*RestMCPServer); ok {
+		if baseServer, ok := base.server.(*RestMCPServer); ok {
+			server.oauth2Tokens = baseServer.oauth2Tokens
+		}
+	}
+}
+
+// resolve returns the config serving the request, the latest version of its tool source when it has one
+func (c McpServerConfig) resolve(ctx wrapper.HttpContext) McpServerConfig {
+	if c.toolSource == nil {
+		return c
+	}
+	if pinned, ok := ctx.GetContext(ctxKeyToolSourceConfig).(*McpServerConfig); ok {
+		return *pinned
+	}
+	pinned := &c
+	if c.toolSource.active != nil {
+		pinned = c.toolSource.active
+	}
+	ctx.SetContext(ctxKeyToolSourceConfig, pinned)
+	return *pinned
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// configSourceStub answers the GET requests of a ToolSource when respond is called
+type configSourceStub struct {
+	wrapper.HttpClient
+	headers   [][2]string
+	callbacks []wrapper.ResponseCallback
+}
+
+func (c *configSourceStub) Get(rawURL string, headers [][2]string, cb wrapper.ResponseCallback, timeoutMillisecond ...uint32) error {
+	c.headers = headers
+	c.callbacks = append(c.callbacks, cb)
+	return nil
+}
+
+func (c *configSourceStub) respond(statusCode int, etag, body string) {
+	callbacks := c.callbacks
+	c.callbacks = nil
+	headers := http.Header{}
+	if etag != "" {
+		headers.Set("ETag", etag)
+	}
+	for _, cb := range callbacks {
+		cb(statusCode, headers, []byte(body))
+	}
+}
+
+// TestParseToolSource tests validation and defaults of the toolSource option
+func TestParseToolSource(t *testing.T) {
+	source, err := parseToolSource("weather", gjson.Parse(`{"serviceName": "nacos.default.svc.cluster.local", "servicePort": 8848, "path": "/nacos/v1/cs/configs?dataId=weather", "interval": 1050}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1100), source.config.Interval)
+	assert.Equal(t, int64(3000), source.config.Timeout)
+	assert.Equal(t, 5, source.config.History)
+
+	tests := []struct {
+		config  string
+		pointer string
+	}{
+		{`{"servicePort": 8848, "path": "/tools"}`, "/server/toolSource/serviceName"},
+		{`{"serviceName": "nacos", "path": "/tools"}`, "/server/toolSource/servicePort"},
+		{`{"serviceName": "nacos", "servicePort": 8848, "path": "tools"}`, "/server/toolSource/path"},
+		{`{"serviceName": "nacos", "servicePort": "8848", "path": "/tools"}`, "/server/toolSource/servicePort"},
+	}
+	for _, tt := range tests {
+		err := parseConfigCore(gjson.Parse(`{"server": {"name": "weather", "toolSource": `+tt.config+`}}`), &McpServerConfig{}, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+		assert.ErrorContains(t, err, `"`+tt.pointer+`"`, tt.config)
+	}
+
+	err = parseConfigCore(gjson.Parse(`{"server": {"name": "weather", "type": "mcp-proxy", "mcpServerURL": "http://backend/mcp", "transport": "http",
+		"toolSource": {"serviceName": "nacos", "servicePort": 8848, "path": "/tools"}}}`), &McpServerConfig{}, &ConfigOptions{ToolRegistry: newTestToolRegistry()})
+	assert.ErrorContains(t, err, `"/server/toolSource"`)
+}
+
+// TestToolSource tests that versions of the definitions are applied once they pass validation, and that a
+// rejected version leaves the last applied one in place
+func TestToolSource(t *testing.T) {
+	reset := startTestHttpContext("tool-source-test")
+	defer reset()
+
+	configJson := `{"server": {"name": "weather", "toolSource": {"serviceName": "nacos", "servicePort": 8848, "path": "/tools", "contentPath": "content", "history": 2}},
+		"tools": [{"name": "forecast", "requestTemplate": {"url": "http://weather/forecast", "method": "GET"}}]}`
+	registry := newTestToolRegistry()
+	opts := &ConfigOptions{ToolRegistry: registry}
+	config := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(configJson), config, opts))
+	source := config.toolSource
+	require.NotNil(t, source)
+	source.start(config, configJson, opts)
+	stub := &configSourceStub{}
+	source.client = stub
+
+	ctx := &contextStub{values: map[string]interface{}{}}
+	assert.Contains(t, config.resolve(ctx).server.GetMCPTools(), "forecast")
+
+	version := func(tools string) string {
+		return `{"content": "{\"tools\": ` + tools + `}"}`
+	}
+	source.poll()
+	stub.respond(http.StatusOK, `"v1"`, version(`[{\"name\": \"alerts\", \"args\": [{\"name\": \"city\", \"required\": true}], \"requestTemplate\": {\"url\": \"http://weather/alerts\", \"method\": \"GET\"}}]`))
+	assert.Equal(t, `"v1"`, source.Version())
+	_, ok := registry.GetToolInfo("weather", "alerts")
+	assert.True(t, ok)
+	_, ok = registry.GetToolInfo("weather", "forecast")
+	assert.False(t, ok)
+
+	// A request keeps the config it started with
+	assert.Contains(t, config.resolve(ctx).server.GetMCPTools(), "forecast")
+	tools := config.resolve(&contextStub{values: map[string]interface{}{}}).server.GetMCPTools()
+	assert.Contains(t, tools, "alerts")
+	assert.NotContains(t, tools, "forecast")
+
+	// The next poll is conditional, an unchanged source is not applied again
+	source.poll()
+	assert.Contains(t, stub.headers, [2]string{"If-None-Match", `"v1"`})
+	stub.respond(http.StatusNotModified, "", "")
+	assert.Len(t, source.History(), 1)
+
+	// A version failing validation is rejected
+	source.poll()
+	stub.respond(http.StatusOK, `"v2"`, version(`[{\"name\": \"alerts\"}]`))
+	assert.Equal(t, `"v1"`, source.Version())
+	assert.Equal(t, `"v2"`, source.rejected)
+	source.poll()
+	stub.respond(http.StatusOK, "", `{"content": "not json"}`)
+	assert.Equal(t, `"v1"`, source.Version())
+	assert.Contains(t, config.resolve(&contextStub{values: map[string]interface{}{}}).server.GetMCPTools(), "alerts")
+
+	// Versions without an ETag are identified by their hash, the history keeps the last ones
+	source.poll()
+	stub.respond(http.StatusOK, "", version(`[]`))
+	source.poll()
+	stub.respond(http.StatusOK, "", version(`[{\"name\": \"uv\", \"requestTemplate\": {\"url\": \"http://weather/uv\", \"method\": \"GET\"}}]`))
+	history := source.History()
+	require.Len(t, history, 2)
+	assert.Len(t, history[0].Version, 16)
+	assert.Equal(t, source.Version(), history[1].Version)
+	assert.Contains(t, config.resolve(&contextStub{values: map[string]interface{}{}}).server.GetMCPTools(), "uv")
+}
+
+// TestToolSourcePoller tests that only the VM holding the poller lease polls the source, and that the other
+// VMs apply the versions it publishes
+func TestToolSourcePoller(t *testing.T) {
+	reset := startTestHttpContext("tool-source-poller-test")
+	defer reset()
+
+	configJson := `{"server": {"name": "weather", "toolSource": {"serviceName": "nacos", "servicePort": 8848, "path": "/tools"}},
+		"tools": [{"name": "forecast", "requestTemplate": {"url": "http://weather/forecast", "method": "GET"}}]}`
+	opts := &ConfigOptions{ToolRegistry: newTestToolRegistry()}
+	config := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(configJson), config, opts))
+	source := config.toolSource
+	source.start(config, configJson, opts)
+	stub := &configSourceStub{}
+	source.client = stub
+
+	// Another VM holds the lease: the source is not polled, the version it publishes is applied
+	leaseKey := fmt.Sprintf("%s:%s:poller", wrapper.VMLeaseKeyPrefix, source.key)
+	holdLease := func(expiry time.Time) {
+		_, cas, _ := proxywasm.GetSharedData(leaseKey)
+		require.NoError(t, proxywasm.SetSharedData(leaseKey, []byte(fmt.Sprintf(`{"holder": "other-vm", "expiry": %d}`, expiry.UnixMilli())), cas))
+	}
+	holdLease(time.Now().Add(time.Minute))
+	source.tick(time.Minute)
+	assert.Empty(t, stub.callbacks)
+	require.NoError(t, proxywasm.SetSharedData(source.key, []byte(`{"version": "\"v1\"", "etag": "\"v1\"",
+		"definitions": {"tools": [{"name": "alerts", "requestTemplate": {"url": "http://weather/alerts", "method": "GET"}}]}}`), 0))
+	source.tick(time.Minute)
+	assert.Empty(t, stub.callbacks)
+	assert.Equal(t, `"v1"`, source.Version())
+	assert.Contains(t, config.resolve(&contextStub{values: map[string]interface{}{}}).server.GetMCPTools(), "alerts")
+
+	// The VM takes over once the lease expires and publishes the versions it applies
+	holdLease(time.Now().Add(-time.Second))
+	source.tick(time.Minute)
+	require.Len(t, stub.callbacks, 1)
+	assert.Contains(t, stub.headers, [2]string{"If-None-Match", `"v1"`}, "the poller continues from the published version")
+	stub.respond(http.StatusOK, `"v2"`, `{"tools": [{"name": "uv", "requestTemplate": {"url": "http://weather/uv", "method": "GET"}}]}`)
+	assert.Equal(t, `"v2"`, source.Version())
+	published, _, err := proxywasm.GetSharedData(source.key)
+	require.NoError(t, err)
+	assert.Equal(t, `"v2"`, gjson.GetBytes(published, "version").String())
+	assert.Equal(t, "uv", gjson.GetBytes(published, "definitions.tools.0.name").String())
+
+	// Rejected versions are not published
+	source.tick(time.Minute)
+	stub.respond(http.StatusOK, `"v3"`, `{"tools": [{"name": "broken"}]}`)
+	assert.Equal(t, `"v2"`, source.Version())
+	published, _, _ = proxywasm.GetSharedData(source.key)
+	assert.Equal(t, `"v2"`, gjson.GetBytes(published, "version").String())
+}
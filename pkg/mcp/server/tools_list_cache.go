@@ -0,0 +1,218 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/store"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	// CtxToolsListCacheEntry is the context key of the cache entry a missed tools/list result is stored under
+	CtxToolsListCacheEntry = "mcp_proxy_tools_list_cache_entry"
+
+	defaultToolsListCacheTTL = 5 * 60 * 1000 // 5 minutes
+
+	toolsListChangedMethod = "notifications/tools/list_changed"
+)
+
+// ToolsListCacheConfig configures the cache of the backend tools/list result of an mcp-proxy server, e.g.
+//
+//	{"ttl": 60000, "store": {"backend": "redis", "serviceName": "redis.default.svc.cluster.local", "servicePort": 6379}}
+//
+// The store defaults to shared data. Only the first page of the tool list is cached, and the cached
+// result is shared by all callers, so the cache must not be enabled for backends whose tool list
+// depends on the credentials of the caller.
+type ToolsListCacheConfig struct {
+	TTL int `json:"ttl"` // Milliseconds a result is served from the cache, defaults to 5 minutes
+}
+
+// ToolsListCache caches the backend tools/list result of an mcp-proxy server. The result is cached
+// before allowTools filtering, which is applied to every response. It is invalidated when the backend
+// sends notifications/tools/list_changed.
+type ToolsListCache struct {
+	ttl         time.Duration
+	storeConfig *store.Config
+	namespace   string
+	store       store.Store
+}
+
+// toolsListCacheEntry is the cache and key a tools/list result is stored under once the backend answered
+type toolsListCacheEntry struct {
+	cache *ToolsListCache
+	key   string
+}
+
+// parseToolsListCache validates the cache config, the store is created by init
+func parseToolsListCache(serverName string, cacheJson gjson.Result) (*ToolsListCache, error) {
+	var config ToolsListCacheConfig
+	if err := configerr.DecodeJSON("", []byte(cacheJson.Raw), &config); err != nil {
+		return nil, err
+	}
+	if config.TTL < 0 {
+		return nil, configerr.Errorf("/ttl", "non-negative integer", "got %d", config.TTL)
+	}
+	if config.TTL == 0 {
+		config.TTL = defaultToolsListCacheTTL
+	}
+	storeJson := cacheJson.Get("store")
+	storeConfig, err := store.ParseConfig(storeJson)
+	if err != nil {
+		return nil, configerr.Prefix("/store", err)
+	}
+	if !storeJson.Exists() {
+		storeConfig.Backend = store.BackendShared
+	}
+	return &ToolsListCache{
+		ttl:         time.Duration(config.TTL) * time.Millisecond,
+		storeConfig: storeConfig,
+		namespace:   "mcp-tools-list:" + serverName,
+	}, nil
+}
+
+// init creates the store, it must be called in the config phase
+func (c *ToolsListCache) init() error {
+	s, err := store.New(c.storeConfig, c.namespace)
+	if err != nil {
+		return err
+	}
+	c.store = s
+	return nil
+}
+
+// serve answers a tools/list request from the cache, calling forward to send it to the backend on a miss.
+// When the store answers later, e.g. from Redis, the request is paused until then, and it is resumed
+// after forward unless forward waits for a callout.
+func (c *ToolsListCache) serve(ctx wrapper.HttpContext, key string, forward func() error) error {
+	if c.store == nil {
+		return forward()
+	}
+	async := false
+	var forwardErr error
+	err := c.store.Get(key, func(value []byte, ok bool, err error) {
+		if err != nil {
+			log.Warnf("Failed to read cached tools/list of %s, forwarding to backend: %v", key, err)
+		}
+		if ok && gjson.ValidBytes(value) {
+			log.Debugf("Serving tools/list of %s from cache", key)
+			utils.OnMCPResponseRawSuccess(ctx, filterAllowedTools(exposedTools(ctx, gjson.ParseBytes(value)), effectiveAllowTools(ctx), toolPermissionsOf(ctx)), "mcp-proxy:tools/list:cache_hit")
+			return
+		}
+		ctx.SetContext(CtxToolsListCacheEntry, &toolsListCacheEntry{cache: c, key: key})
+		if err := forward(); err != nil {
+			if !async {
+				forwardErr = err
+				return
+			}
+			log.Errorf("Failed to forward tools/list: %v", err)
+			utils.OnMCPResponseError(ctx, err, utils.ErrInternalError, "mcp-proxy:tools/list:execution_error")
+			return
+		}
+		// The request opening an SSE channel has to continue upstream
+		if async && isSSEChannelOpened(ctx) {
+			proxywasm.ResumeHttpRequest()
+		}
+	})
+	if err != nil {
+		log.Warnf("Failed to read cached tools/list of %s, forwarding to backend: %v", key, err)
+		return forward()
+	}
+	async = true
+	return forwardErr
+}
+
+// Invalidate drops the cached tools/list result stored under key
+func (c *ToolsListCache) Invalidate(key string) {
+	if c.store == nil {
+		return
+	}
+	err := c.store.Del(key, func(err error) {
+		if err != nil {
+			log.Warnf("Failed to invalidate cached tools/list of %s: %v", key, err)
+		}
+	})
+	if err != nil {
+		log.Warnf("Failed to invalidate cached tools/list of %s: %v", key, err)
+	}
+}
+
+// storeToolsListResult caches a tools/list result fetched from the backend after a cache miss
+func storeToolsListResult(ctx wrapper.HttpContext, result []byte) {
+	entry, ok := ctx.GetContext(CtxToolsListCacheEntry).(*toolsListCacheEntry)
+	if !ok || entry.cache.store == nil {
+		return
+	}
+	err := entry.cache.store.Set(entry.key, result, entry.cache.ttl, func(err error) {
+		if err != nil {
+			log.Warnf("Failed to cache tools/list of %s: %v", entry.key, err)
+		}
+	})
+	if err != nil {
+		log.Warnf("Failed to cache tools/list of %s: %v", entry.key, err)
+	}
+}
+
+// SetToolsListCache sets the cache of the backend tools/list result, nil disables caching
+func (s *McpProxyServer) SetToolsListCache(cache *ToolsListCache) {
+	s.toolsListCache = cache
+}
+
+// GetToolsListCache returns the cache of the backend tools/list result, or nil when it is not cached
+func (s *McpProxyServer) GetToolsListCache() *ToolsListCache {
+	return s.toolsListCache
+}
+
+// InvalidateToolsListCache drops the cached tools/list result of the backend, so that the next
+// tools/list request fetches it again
+func (s *McpProxyServer) InvalidateToolsListCache() {
+	if s.toolsListCache != nil {
+		s.toolsListCache.Invalidate(s.GetMcpServerURL())
+	}
+}
+
+// observeBackendMessage invalidates the tools/list cache when a backend message is notifications/tools/list_changed
+func (s *McpProxyServer) observeBackendMessage(message gjson.Result) {
+	if s == nil || s.toolsListCache == nil || message.Get("method").String() != toolsListChangedMethod {
+		return
+	}
+	log.Infof("Backend tools of %s changed, invalidating cached tools/list", s.Name)
+	s.InvalidateToolsListCache()
+}
+
+// observeSSENotifications passes the messages of an SSE response of a Streamable HTTP backend to observeBackendMessage
+func (s *McpProxyServer) observeSSENotifications(responseHeaders [][2]string, responseBody []byte) {
+	if s == nil || s.toolsListCache == nil || !isSSEResponse(responseHeaders, responseBody) {
+		return
+	}
+	remaining := append(append([]byte{}, responseBody...), '\n', '\n')
+	for {
+		msg, rest, err := ParseSSEMessage(remaining)
+		if err != nil || msg == nil {
+			return
+		}
+		remaining = rest
+		if gjson.Valid(msg.Data) {
+			s.observeBackendMessage(gjson.Parse(msg.Data))
+		}
+	}
+}
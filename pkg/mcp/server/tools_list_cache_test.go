@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/store"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// TestParseToolsListCache tests the defaults and validation of the toolsListCache option
+func TestParseToolsListCache(t *testing.T) {
+	server, err := setupMcpProxyServer("cache-test", gjson.Parse(`{
+		"transport": "http",
+		"mcpServerURL": "http://backend.example.com/mcp",
+		"toolsListCache": {}
+	}`), "")
+	require.NoError(t, err)
+	cache := server.GetToolsListCache()
+	require.NotNil(t, cache)
+	assert.Equal(t, 5*time.Minute, cache.ttl)
+	assert.Equal(t, store.BackendShared, cache.storeConfig.Backend)
+	assert.Same(t, cache, server.Clone().(*McpProxyServer).GetToolsListCache())
+
+	cache, err = parseToolsListCache("cache-test", gjson.Parse(`{"ttl": 1000, "store": {"backend": "memory"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, cache.ttl)
+	assert.Equal(t, store.BackendMemory, cache.storeConfig.Backend)
+
+	_, err = parseToolsListCache("cache-test", gjson.Parse(`{"ttl": -1}`))
+	assert.ErrorContains(t, err, "/ttl")
+	_, err = parseToolsListCache("cache-test", gjson.Parse(`{"store": {"backend": "redis"}}`))
+	assert.ErrorContains(t, err, "/store/serviceName")
+}
+
+// TestToolsListCacheServe tests that results are cached on a miss, served filtered on a hit and
+// invalidated by notifications/tools/list_changed
+func TestToolsListCacheServe(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("cache-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+
+	server := NewMcpProxyServer("cache-test")
+	server.SetMcpServerURL("http://backend.example.com/mcp")
+	cache, err := parseToolsListCache("cache-test", gjson.Parse(`{"store": {"backend": "memory"}}`))
+	require.NoError(t, err)
+	require.NoError(t, cache.init())
+	server.SetToolsListCache(cache)
+
+	backendResult := []byte(`{"tools":[{"name":"a"},{"name":"b"}],"nextCursor":""}`)
+	forwarded := 0
+	list := func(allowTools *map[string]struct{}) gjson.Result {
+		contextID := host.InitializeHttpContext()
+		defer host.CompleteHttpContext(contextID)
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{
+			utils.CtxJsonRpcID:                utils.JsonRpcID{IntValue: 1},
+			"mcp_proxy_effective_allow_tools": allowTools,
+		}}}
+		err := cache.serve(ctx, server.GetMcpServerURL(), func() error {
+			forwarded++
+			storeToolsListResult(ctx, backendResult)
+			return nil
+		})
+		require.NoError(t, err)
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response)
+	}
+
+	assert.False(t, list(nil).Exists(), "a miss is forwarded to the backend")
+	assert.Equal(t, 1, forwarded)
+
+	response := list(&map[string]struct{}{"b": {}})
+	assert.Equal(t, 1, forwarded, "a hit is served from the cache")
+	assert.Equal(t, `[{"name":"b"}]`, response.Get("result.tools").Raw)
+	assert.True(t, response.Get("result.nextCursor").Exists())
+
+	server.observeBackendMessage(gjson.Parse(`{"jsonrpc":"2.0","method":"notifications/progress"}`))
+	list(nil)
+	assert.Equal(t, 1, forwarded)
+
+	server.observeSSENotifications([][2]string{{"content-type", "text/event-stream"}},
+		[]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/tools/list_changed\"}\n\nevent: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":2,\"result\":{}}\n\n"))
+	list(nil)
+	assert.Equal(t, 2, forwarded, "the cache is invalidated when the tool list changed")
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// maxListedTools bounds the tool names listed in the error of an unknown tool
+const maxListedTools = 100
+
+// maxSuggestedNameLength bounds the length of the unknown names a suggestion is looked for, names
+// sent by clients being of any length
+const maxSuggestedNameLength = 256
+
+// availableToolNames returns the sorted names of the tools that may be called
+func availableToolNames(tools map[string]Tool, allowTools *map[string]struct{}, permissions *toolPermissions) []string {
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		if allowTools != nil {
+			if _, allow := (*allowTools)[name]; !allow {
+				continue
+			}
+		}
+		if !permissions.allows(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// closestToolName returns the name closest to an unknown name, or "" if none is close enough to be
+// a likely typo
+func closestToolName(name string, names []string) string {
+	if len(name) > maxSuggestedNameLength {
+		return ""
+	}
+	lower := strings.ToLower(name)
+	// Allow about one edit per three characters, so that short names do not match anything
+	best, bestDistance := "", max(1, len(name)/3)+1
+	for _, candidate := range names {
+		if bestDistance == 0 {
+			break
+		}
+		distance := editDistance(lower, strings.ToLower(candidate), bestDistance-1)
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of two strings, or limit+1 as soon as it is known to
+// exceed limit
+func editDistance(a, b string, limit int) int {
+	if len(a)-len(b) > limit || len(b)-len(a) > limit {
+		return limit + 1
+	}
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		rowMin := i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			rowMin = min(rowMin, current[j])
+		}
+		// The distance never goes below the minimum of a row
+		if rowMin > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+	return min(previous[len(b)], limit+1)
+}
+
+// onUnknownTool answers a call of a tool the server does not have with an invalid params error
+// whose data lists the available tools and the closest one
+func onUnknownTool(ctx wrapper.HttpContext, serverName, toolName string, tools map[string]Tool, allowTools *map[string]struct{}) {
+	names := availableToolNames(tools, allowTools, toolPermissionsOf(ctx))
+	message := fmt.Sprintf("unknown tool: %s", toolName)
+	data := map[string]any{"tool": toolName}
+	if suggestion := closestToolName(toolName, names); suggestion != "" {
+		message += fmt.Sprintf(", did you mean %s?", suggestion)
+		data["suggestion"] = suggestion
+	}
+	if len(names) > maxListedTools {
+		names = names[:maxListedTools]
+		data["truncated"] = true
+	}
+	data["availableTools"] = names
+	utils.OnJsonRpcResponseErrorWithData(ctx, errors.New(message), utils.ErrInvalidParams, data, fmt.Sprintf("mcp:%s:tools/call:invalid_tool_name", serverName))
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/mcp/utils"
+)
+
+// TestClosestToolName tests the suggestions for misspelled tool names
+func TestClosestToolName(t *testing.T) {
+	names := []string{"get_forecast", "get_weather", "search_news"}
+	assert.Equal(t, "get_weather", closestToolName("get_wether", names))
+	assert.Equal(t, "get_weather", closestToolName("Get_Weather", names))
+	assert.Equal(t, "search_news", closestToolName("search-news", names))
+	assert.Equal(t, "", closestToolName("delete_user", names))
+	assert.Equal(t, "", closestToolName("ab", []string{"cd"}))
+	assert.Equal(t, "", closestToolName("get_weather", nil))
+	assert.Equal(t, "", closestToolName(strings.Repeat("get_weather", 100), names))
+	assert.Equal(t, 3, editDistance("kitten", "sitting", 3))
+	assert.Equal(t, 2, editDistance("kitten", "sitting", 1))
+	assert.Equal(t, 3, editDistance("kitten", strings.Repeat("x", 10000), 2))
+}
+
+// TestUnknownTool tests the error of tools/call for a tool the server does not have
+func TestUnknownTool(t *testing.T) {
+	defer startTestHttpContext("unknown-tool-test")()
+
+	config := &McpServerConfig{}
+	require.NoError(t, parseConfigCore(gjson.Parse(`{
+		"server": {"name": "weather-server"},
+		"tools": [
+			{"name": "get_weather", "requestTemplate": {"url": "http://weather.example.com/now", "method": "GET"}},
+			{"name": "get_forecast", "requestTemplate": {"url": "http://weather.example.com/forecast", "method": "GET"}},
+			{"name": "get_alerts", "requestTemplate": {"url": "http://weather.example.com/alerts", "method": "GET"}}
+		],
+		"allowTools": ["get_weather", "get_forecast"]
+	}`), config, &ConfigOptions{ToolRegistry: newTestToolRegistry()}))
+
+	call := func(tool string) gjson.Result {
+		ctx := &phaseContextStub{contextStub{values: map[string]interface{}{utils.CtxJsonRpcID: utils.JsonRpcID{IntValue: 1}}}}
+		require.NoError(t, config.methodHandlers["tools/call"](ctx, utils.JsonRpcID{IntValue: 1}, gjson.Parse(`{"name": "`+tool+`", "arguments": {}}`)))
+		response, _ := ctx.values[utils.CtxJsonRpcResponse].([]byte)
+		return gjson.ParseBytes(response)
+	}
+
+	response := call("get_wether")
+	assert.Equal(t, int64(utils.ErrInvalidParams), response.Get("error.code").Int())
+	assert.Equal(t, "unknown tool: get_wether, did you mean get_weather?", response.Get("error.message").String())
+	assert.Equal(t, "get_wether", response.Get("error.data.tool").String())
+	assert.Equal(t, "get_weather", response.Get("error.data.suggestion").String())
+	assert.JSONEq(t, `["get_forecast", "get_weather"]`, response.Get("error.data.availableTools").Raw, "tools not allowed are not listed")
+
+	response = call("delete_user")
+	assert.Equal(t, "unknown tool: delete_user", response.Get("error.message").String())
+	assert.False(t, response.Get("error.data.suggestion").Exists())
+
+	response = call("get_alerts")
+	assert.Equal(t, "Tool not allowed: get_alerts", response.Get("error.message").String())
+}
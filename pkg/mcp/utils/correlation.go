@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	CtxCorrelationID    = "mcpCorrelationID"
+	CorrelationIDHeader = "x-request-id"
+)
+
+// GetCorrelationID returns the ID used to correlate an MCP request with its backend callouts.
+// The gateway request ID is propagated when available; otherwise a new ID is generated. A new ID is
+// written back to the request headers when the request headers are being processed, so that later
+// logs and route calls carry it as well, after that phase the headers can no longer be changed.
+func GetCorrelationID(ctx wrapper.HttpContext) string {
+	if id, ok := ctx.GetContext(CtxCorrelationID).(string); ok && id != "" {
+		return id
+	}
+	id := requestIDFromHost()
+	if id == "" {
+		id = uuid.New().String()
+		if ctx.GetExecutionPhase() == iface.DecodeHeader {
+			if err := proxywasm.ReplaceHttpRequestHeader(CorrelationIDHeader, id); err != nil {
+				log.Debugf("failed to set generated correlation id to request header: %v", err)
+			}
+		}
+		log.Debugf("generated correlation id: %s", id)
+	}
+	ctx.SetContext(CtxCorrelationID, id)
+	return id
+}
+
+// SetCorrelationIDHeader sets the correlation ID header on a backend callout, replacing any existing value.
+func SetCorrelationIDHeader(ctx wrapper.HttpContext, headers *[][2]string) {
+	id := GetCorrelationID(ctx)
+	for i, h := range *headers {
+		if strings.EqualFold(h[0], CorrelationIDHeader) {
+			(*headers)[i][1] = id
+			return
+		}
+	}
+	*headers = append(*headers, [2]string{CorrelationIDHeader, id})
+}
+
+// requestIDFromHost reads the request ID assigned by the gateway, falling back to the request header.
+func requestIDFromHost() string {
+	if raw, err := proxywasm.GetProperty([]string{"x_request_id"}); err == nil && len(raw) > 0 {
+		return string(raw)
+	}
+	if id, err := proxywasm.GetHttpRequestHeader(CorrelationIDHeader); err == nil {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+type phaseContextStub struct {
+	sseContextStub
+	phase iface.HTTPExecutionPhase
+}
+
+func (c *phaseContextStub) GetExecutionPhase() iface.HTTPExecutionPhase {
+	return c.phase
+}
+
+func TestGetCorrelationID(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("correlation-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":path", "/mcp"}}, false)
+
+	// Outside of the header phase the generated ID is only returned
+	ctx := &phaseContextStub{sseContextStub{values: map[string]interface{}{}}, iface.DecodeData}
+	generated := GetCorrelationID(ctx)
+	if generated == "" {
+		t.Fatal("an ID must be generated when the request has none")
+	}
+	if header, _ := proxywasm.GetHttpRequestHeader(CorrelationIDHeader); header != "" {
+		t.Errorf("the request header must not be set after the header phase, got %q", header)
+	}
+	if got := GetCorrelationID(ctx); got != generated {
+		t.Errorf("GetCorrelationID() = %q, want the ID of the request %q", got, generated)
+	}
+
+	ctx = &phaseContextStub{sseContextStub{values: map[string]interface{}{}}, iface.DecodeHeader}
+	generated = GetCorrelationID(ctx)
+	if header, _ := proxywasm.GetHttpRequestHeader(CorrelationIDHeader); header != generated {
+		t.Errorf("request header = %q, want the generated ID %q", header, generated)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// Implementation-defined server error codes (JSON-RPC reserves -32000 to -32099)
+const (
+	ErrServerError      = -32000
+	ErrAuthError        = -32001
+	ErrBackendTimeout   = -32003
+	ErrPermissionDenied = -32004
+	ErrRateLimited      = -32005
+)
+
+// ErrResourceNotFound is the code the MCP specification assigns to reading an unknown resource
+const ErrResourceNotFound = -32002
+
+// StatusCodeMapping maps backend HTTP status codes to JSON-RPC error codes.
+// Keys are either an exact status code ("401") or a status class ("5xx").
+type StatusCodeMapping map[string]int
+
+// DefaultStatusCodeMapping is consulted when a status code is not covered by a configured mapping.
+var DefaultStatusCodeMapping = StatusCodeMapping{
+	"400": ErrInvalidParams,
+	"401": ErrAuthError,
+	"403": ErrAuthError,
+	"408": ErrBackendTimeout,
+	"429": ErrRateLimited,
+	"504": ErrBackendTimeout,
+	"4xx": ErrInvalidRequest,
+	"5xx": ErrInternalError,
+}
+
+// lookup returns the error code for an exact match first, then for the status class.
+func (m StatusCodeMapping) lookup(statusCode int) (int, bool) {
+	if code, ok := m[strconv.Itoa(statusCode)]; ok {
+		return code, true
+	}
+	if code, ok := m[fmt.Sprintf("%dxx", statusCode/100)]; ok {
+		return code, true
+	}
+	return 0, false
+}
+
+// ErrorCode returns the JSON-RPC error code for a backend HTTP status code.
+// Configured entries take precedence over DefaultStatusCodeMapping, and ErrInternalError
+// is used when neither covers the status code.
+func (m StatusCodeMapping) ErrorCode(statusCode int) int {
+	if code, ok := m.lookup(statusCode); ok {
+		return code
+	}
+	if code, ok := DefaultStatusCodeMapping.lookup(statusCode); ok {
+		return code
+	}
+	return ErrInternalError
+}
+
+// CalloutErrorCode returns the JSON-RPC error code of a request to a backend that could not be sent,
+// ErrRateLimited when a limit of the wrapper is exceeded and ErrInternalError otherwise
+func CalloutErrorCode(err error) int {
+	if errors.Is(err, wrapper.ErrLimitExceeded) {
+		return ErrRateLimited
+	}
+	return ErrInternalError
+}
+
+// ParseStatusCodeMapping parses a mapping object such as {"401": -32001, "5xx": -32603}.
+func ParseStatusCodeMapping(mappingJson gjson.Result) (StatusCodeMapping, error) {
+	if !mappingJson.IsObject() {
+		return nil, configerr.New("", "object", fmt.Errorf("status code mapping must be an object"))
+	}
+	mapping := make(StatusCodeMapping)
+	var parseErr error
+	mappingJson.ForEach(func(key, value gjson.Result) bool {
+		status := strings.ToLower(key.String())
+		if !isValidStatusKey(status) {
+			parseErr = configerr.Errorf(configerr.Pointer(key.String()), `status code such as "401" or class such as "5xx"`, "invalid status code key: %s", key.String())
+			return false
+		}
+		if value.Type != gjson.Number {
+			parseErr = configerr.Errorf(configerr.Pointer(key.String()), "number", "error code for status %s must be a number", key.String())
+			return false
+		}
+		mapping[status] = int(value.Int())
+		return true
+	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	return mapping, nil
+}
+
+func isValidStatusKey(key string) bool {
+	if len(key) != 3 || key[0] < '1' || key[0] > '5' {
+		return false
+	}
+	if key[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(key)
+	return err == nil
+}
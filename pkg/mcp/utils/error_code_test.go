@@ -0,0 +1,173 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func TestStatusCodeMappingErrorCode(t *testing.T) {
+	custom := StatusCodeMapping{
+		"403": -32010,
+		"5xx": ErrServerError,
+	}
+	tests := []struct {
+		name       string
+		mapping    StatusCodeMapping
+		statusCode int
+		expected   int
+	}{
+		{"default unauthorized", nil, 401, ErrAuthError},
+		{"default forbidden", nil, 403, ErrAuthError},
+		{"default rate limited", nil, 429, ErrRateLimited},
+		{"default gateway timeout", nil, 504, ErrBackendTimeout},
+		{"default server error class", nil, 502, ErrInternalError},
+		{"default client error class", nil, 404, ErrInvalidRequest},
+		{"unmapped status", nil, 302, ErrInternalError},
+		{"custom exact match", custom, 403, -32010},
+		{"custom class overrides default class", custom, 500, ErrServerError},
+		{"custom class takes precedence over default exact", custom, 504, ErrServerError},
+		{"falls back to default", custom, 401, ErrAuthError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.ErrorCode(tt.statusCode); got != tt.expected {
+				t.Errorf("ErrorCode(%d) = %d, want %d", tt.statusCode, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestErrorCodesDistinct checks that no two exported error codes of the package share a value, so clients
+// can tell the errors apart
+func TestErrorCodesDistinct(t *testing.T) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[int64]string)
+	for _, file := range packages["utils"].Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				for i, name := range spec.(*ast.ValueSpec).Names {
+					values := spec.(*ast.ValueSpec).Values
+					if !name.IsExported() || !strings.HasPrefix(name.Name, "Err") || i >= len(values) {
+						continue
+					}
+					tv, err := types.Eval(fset, nil, token.NoPos, types.ExprString(values[i]))
+					if err != nil || tv.Value == nil || tv.Value.Kind() != constant.Int {
+						continue
+					}
+					code, _ := constant.Int64Val(tv.Value)
+					if other, ok := names[code]; ok {
+						t.Errorf("%s and %s share the error code %d", other, name.Name, code)
+					}
+					names[code] = name.Name
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		t.Fatal("no error codes found")
+	}
+}
+
+func TestCalloutErrorCode(t *testing.T) {
+	if got := CalloutErrorCode(fmt.Errorf("%w: the maximum of 3 callouts is reached", wrapper.ErrCalloutLimitExceeded)); got != ErrRateLimited {
+		t.Errorf("CalloutErrorCode(callout limit) = %d, want %d", got, ErrRateLimited)
+	}
+	if got := CalloutErrorCode(errors.New("dispatch failed")); got != ErrInternalError {
+		t.Errorf("CalloutErrorCode(other) = %d, want %d", got, ErrInternalError)
+	}
+}
+
+func TestParseStatusCodeMapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		jsonData  string
+		expected  StatusCodeMapping
+		expectErr bool
+	}{
+		{
+			name:     "exact and class keys",
+			jsonData: `{"401": -32001, "5XX": -32000}`,
+			expected: StatusCodeMapping{"401": -32001, "5xx": -32000},
+		},
+		{
+			name:      "not an object",
+			jsonData:  `[401]`,
+			expectErr: true,
+		},
+		{
+			name:      "invalid key",
+			jsonData:  `{"40x": -32001}`,
+			expectErr: true,
+		},
+		{
+			name:      "out of range key",
+			jsonData:  `{"600": -32001}`,
+			expectErr: true,
+		},
+		{
+			name:      "non numeric code",
+			jsonData:  `{"401": "auth"}`,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping, err := ParseStatusCodeMapping(gjson.Parse(tt.jsonData))
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("expected error, got mapping %v", mapping)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(mapping) != len(tt.expected) {
+				t.Fatalf("mapping = %v, want %v", mapping, tt.expected)
+			}
+			for k, v := range tt.expected {
+				if mapping[k] != v {
+					t.Errorf("mapping[%s] = %d, want %d", k, mapping[k], v)
+				}
+			}
+		})
+	}
+}
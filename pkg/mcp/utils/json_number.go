@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// UnmarshalJSON works like json.Unmarshal, but decodes numbers into interface values as json.Number
+// instead of float64, so that large integers such as ids survive a decode/encode round trip unchanged.
+func UnmarshalJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("invalid character after top-level value")
+	}
+	return nil
+}
+
+// RawJSON returns the id as it should be written to a JSON-RPC message. Numeric ids keep their
+// original text when they were parsed from a message, so ids beyond the int64 range or with a
+// fraction are echoed back exactly.
+func (id JsonRpcID) RawJSON() []byte {
+	if id.IsString {
+		raw, _ := json.Marshal(id.StringValue)
+		return raw
+	}
+	if id.RawValue != "" {
+		return []byte(id.RawValue)
+	}
+	return []byte(strconv.FormatInt(id.IntValue, 10))
+}
+
+// NumberEquals reports whether a value decoded from JSON is the given integer, accepting both
+// json.Number (see UnmarshalJSON) and float64 values.
+func NumberEquals(value any, expected int64) bool {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := v.Int64()
+		return err == nil && n == expected
+	case float64:
+		return v == float64(expected)
+	case int:
+		return int64(v) == expected
+	case int64:
+		return v == expected
+	}
+	return false
+}
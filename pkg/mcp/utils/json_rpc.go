@@ -15,6 +15,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 
@@ -36,6 +37,7 @@ const (
 	JError       = "error"
 	JCode        = "code"
 	JMessage     = "message"
+	JData        = "data"
 	JResult      = "result"
 
 	ErrParseError     = -32700
@@ -45,11 +47,37 @@ const (
 	ErrInternalError  = -32603
 )
 
+// CtxJsonRpcResponse stores the last response body sent by the plugin
+const CtxJsonRpcResponse = "jsonRpcResponse"
+
+// CtxResultFilter stores the ResultFilter of the current request
+const CtxResultFilter = "jsonRpcResultFilter"
+
+// ResultFilter rewrites the result of a success response before it is sent, e.g. to check a tool result
+// whichever server produced it
+type ResultFilter func(result []byte) []byte
+
+// SetResultFilter sets the filter applied to the result of the success response of the current request,
+// nil removes it
+func SetResultFilter(ctx wrapper.HttpContext, filter ResultFilter) {
+	ctx.SetContext(CtxResultFilter, filter)
+}
+
+// FilterResult applies the ResultFilter of the current request to a result, it must be called by the code
+// sending success responses without OnJsonRpcResponseSuccess or OnJsonRpcResponseRawSuccess
+func FilterResult(ctx wrapper.HttpContext, result []byte) []byte {
+	if filter, ok := ctx.GetContext(CtxResultFilter).(ResultFilter); ok && filter != nil {
+		return filter(result)
+	}
+	return result
+}
+
 // JsonRpcID represents a JSON-RPC ID which can be either a string or a number
 type JsonRpcID struct {
 	StringValue string
 	IntValue    int64
 	IsString    bool
+	RawValue    string // Original JSON text of a numeric ID, IntValue may lose precision
 }
 
 // NewJsonRpcIDFromGjson creates a JsonRpcID from a gjson.Result
@@ -60,10 +88,14 @@ func NewJsonRpcIDFromGjson(result gjson.Result) JsonRpcID {
 			IsString:    true,
 		}
 	}
-	return JsonRpcID{
+	id := JsonRpcID{
 		IntValue: result.Int(),
 		IsString: false,
 	}
+	if result.Type == gjson.Number {
+		id.RawValue = result.Raw
+	}
+	return id
 }
 
 type JsonRpcRequestHandler func(context wrapper.HttpContext, id JsonRpcID, method string, params gjson.Result, rawBody []byte) types.Action
@@ -75,6 +107,11 @@ type JsonRpcMethodHandler func(context wrapper.HttpContext, id JsonRpcID, params
 type MethodHandlers map[string]JsonRpcMethodHandler
 
 func makeHttpResponse(ctx wrapper.HttpContext, code uint32, debugInfo string, headers [][2]string, body []byte) {
+	ctx.SetContext(CtxJsonRpcResponse, body)
+	if code == 200 && IsSSEResponse(ctx) {
+		headers = SSEResponseHeaders(headers)
+		body = SSEResponseBody(ctx, body)
+	}
 	phase := ctx.GetExecutionPhase()
 	if phase < iface.EncodeHeader {
 		proxywasm.SendHttpResponseWithDetail(code, debugInfo, headers, body, -1)
@@ -108,17 +145,36 @@ func makeHttpResponse(ctx wrapper.HttpContext, code uint32, debugInfo string, he
 
 func sendJsonRpcResponse(ctx wrapper.HttpContext, id JsonRpcID, extras map[string]any, debugInfo string) {
 	body := []byte(`{"jsonrpc": "2.0"}`)
-	if id.IsString {
-		body, _ = sjson.SetBytes(body, "id", id.StringValue)
-	} else {
-		body, _ = sjson.SetBytes(body, "id", id.IntValue)
-	}
+	body, _ = sjson.SetRawBytes(body, "id", id.RawJSON())
 	for key, value := range extras {
 		body, _ = sjson.SetBytes(body, key, value)
 	}
 	makeHttpResponse(ctx, 200, debugInfo, [][2]string{{"Content-Type", "application/json; charset=utf-8"}}, body)
 }
 
+// NewJsonRpcResultBody builds a JSON-RPC success response with a raw JSON result, which is
+// spliced in verbatim so that fields unknown to the gateway are preserved.
+func NewJsonRpcResultBody(id JsonRpcID, result []byte) []byte {
+	body := []byte(`{"jsonrpc": "2.0"}`)
+	body, _ = sjson.SetRawBytes(body, "id", id.RawJSON())
+	body, _ = sjson.SetRawBytes(body, JResult, result)
+	return body
+}
+
+// OnJsonRpcResponseRawSuccess is like OnJsonRpcResponseSuccess, but takes the result as raw JSON.
+func OnJsonRpcResponseRawSuccess(ctx wrapper.HttpContext, result []byte, debugInfo ...string) {
+	id, ok := ctx.GetContext(CtxJsonRpcID).(JsonRpcID)
+	if !ok {
+		makeHttpResponse(ctx, 500, "not_found_json_rpc_id", nil, []byte("not found json rpc id"))
+		return
+	}
+	responseDebugInfo := "json_rpc_success"
+	if len(debugInfo) > 0 {
+		responseDebugInfo = debugInfo[0]
+	}
+	makeHttpResponse(ctx, 200, responseDebugInfo, [][2]string{{"Content-Type", "application/json; charset=utf-8"}}, NewJsonRpcResultBody(id, FilterResult(ctx, result)))
+}
+
 func OnJsonRpcResponseSuccess(ctx wrapper.HttpContext, result map[string]any, debugInfo ...string) {
 	var (
 		id JsonRpcID
@@ -133,10 +189,21 @@ func OnJsonRpcResponseSuccess(ctx wrapper.HttpContext, result map[string]any, de
 	if len(debugInfo) > 0 {
 		responseDebugInfo = debugInfo[0]
 	}
+	if filter, ok := ctx.GetContext(CtxResultFilter).(ResultFilter); ok && filter != nil {
+		if raw, err := json.Marshal(result); err == nil {
+			makeHttpResponse(ctx, 200, responseDebugInfo, [][2]string{{"Content-Type", "application/json; charset=utf-8"}}, NewJsonRpcResultBody(id, filter(raw)))
+			return
+		}
+	}
 	sendJsonRpcResponse(ctx, id, map[string]any{JResult: result}, responseDebugInfo)
 }
 
 func OnJsonRpcResponseError(ctx wrapper.HttpContext, err error, errorCode int, debugInfo ...string) {
+	OnJsonRpcResponseErrorWithData(ctx, err, errorCode, nil, debugInfo...)
+}
+
+// OnJsonRpcResponseErrorWithData is like OnJsonRpcResponseError, with data giving details of the error
+func OnJsonRpcResponseErrorWithData(ctx wrapper.HttpContext, err error, errorCode int, data map[string]any, debugInfo ...string) {
 	var (
 		id JsonRpcID
 		ok bool
@@ -150,10 +217,20 @@ func OnJsonRpcResponseError(ctx wrapper.HttpContext, err error, errorCode int, d
 	if len(debugInfo) > 0 {
 		responseDebugInfo = debugInfo[0]
 	}
-	sendJsonRpcResponse(ctx, id, map[string]any{JError: map[string]any{
+	errorBody := map[string]any{
 		JMessage: err.Error(),
 		JCode:    errorCode,
-	}}, responseDebugInfo)
+	}
+	if correlationID := GetCorrelationID(ctx); correlationID != "" {
+		if data == nil {
+			data = map[string]any{}
+		}
+		data["correlationId"] = correlationID
+	}
+	if len(data) > 0 {
+		errorBody[JData] = data
+	}
+	sendJsonRpcResponse(ctx, id, map[string]any{JError: errorBody}, responseDebugInfo)
 }
 
 func HandleJsonRpcMethod(ctx wrapper.HttpContext, body []byte, handles MethodHandlers) types.Action {
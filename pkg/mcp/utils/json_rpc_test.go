@@ -158,3 +158,53 @@ func TestJsonRpcIDMarshaling(t *testing.T) {
 		})
 	}
 }
+
+func TestJsonRpcIDRawJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonData string
+		expected string
+	}{
+		{"integer id", `{"id": 123}`, `123`},
+		{"beyond float64 precision", `{"id": 9007199254740993}`, `9007199254740993`},
+		{"beyond int64 range", `{"id": 123456789012345678901234567890}`, `123456789012345678901234567890`},
+		{"string id", `{"id": "a\"b"}`, `"a\"b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := NewJsonRpcIDFromGjson(gjson.Get(tt.jsonData, "id"))
+			if got := string(id.RawJSON()); got != tt.expected {
+				t.Errorf("RawJSON() = %s, want %s", got, tt.expected)
+			}
+		})
+	}
+	if got := string((JsonRpcID{IntValue: 7}).RawJSON()); got != "7" {
+		t.Errorf("RawJSON() = %s, want 7", got)
+	}
+}
+
+func TestUnmarshalJSONPreservesNumbers(t *testing.T) {
+	var value map[string]interface{}
+	if err := UnmarshalJSON([]byte(`{"id": 9007199254740993, "ratio": 0.1}`), &value); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := json.Marshal(value)
+	if string(body) != `{"id":9007199254740993,"ratio":0.1}` {
+		t.Errorf("round trip = %s", body)
+	}
+	if !NumberEquals(value["id"], 9007199254740993) || NumberEquals(value["ratio"], 0) {
+		t.Errorf("NumberEquals mismatch for %v", value)
+	}
+	if err := UnmarshalJSON([]byte(`{} {}`), &value); err == nil {
+		t.Errorf("expected error for trailing data")
+	}
+}
+
+func TestNewJsonRpcResultBody(t *testing.T) {
+	id := NewJsonRpcIDFromGjson(gjson.Get(`{"id": 9007199254740993}`, "id"))
+	body := NewJsonRpcResultBody(id, []byte(`{"content":[],"_meta":{"trace":"t1"},"future":{"n":1.50}}`))
+	expected := `{"jsonrpc": "2.0","id":9007199254740993,"result":{"content":[],"_meta":{"trace":"t1"},"future":{"n":1.50}}}`
+	if string(body) != expected {
+		t.Errorf("NewJsonRpcResultBody() = %s, want %s", body, expected)
+	}
+}
@@ -26,6 +26,7 @@ type MCPServerLog struct {
 }
 
 func setMCPInfo(msg string) string {
+	// Logs are also written outside of requests, where request headers can not be read
 	requestIDRaw, _ := proxywasm.GetProperty([]string{"x_request_id"})
 	requestID := string(requestIDRaw)
 	if requestID == "" {
@@ -24,12 +24,15 @@ import (
 
 func OnMCPResponseSuccess(ctx wrapper.HttpContext, result map[string]any, debugInfo string) {
 	OnJsonRpcResponseSuccess(ctx, result, debugInfo)
-	// TODO: support pub to redis when use POST + SSE
+}
+
+// OnMCPResponseRawSuccess sends a result received from an MCP backend without re-encoding it.
+func OnMCPResponseRawSuccess(ctx wrapper.HttpContext, result []byte, debugInfo string) {
+	OnJsonRpcResponseRawSuccess(ctx, result, debugInfo)
 }
 
 func OnMCPResponseError(ctx wrapper.HttpContext, err error, code int, debugInfo string) {
 	OnJsonRpcResponseError(ctx, err, code, debugInfo)
-	// TODO: support pub to redis when use POST + SSE
 }
 
 func OnMCPToolCallSuccess(ctx wrapper.HttpContext, content []map[string]any, debugInfo string) {
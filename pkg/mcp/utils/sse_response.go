@@ -0,0 +1,192 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	CtxSSEResponse      = "mcpSSEResponse"
+	CtxSSENotifications = "mcpSSENotifications"
+	CtxSSELastWrite     = "mcpSSELastWrite"
+	SSEContentType      = "text/event-stream"
+)
+
+// SSEKeepAliveInterval is the minimum time between two keep-alive comments on an SSE response.
+var SSEKeepAliveInterval = 15 * time.Second
+
+// SSEKeepAliveTickPeriod is the period in milliseconds of the tick function writing keep-alive
+// comments to the event streams kept alive with KeepSSEAlive, see RegisterSSEKeepAlive.
+const SSEKeepAliveTickPeriod = 1000
+
+var sseKeepAlive = []byte(": ping\n\n")
+
+// keptAliveSSEStreams are the event streams of the VM waiting for data, written keep-alives on ticks
+var keptAliveSSEStreams = map[wrapper.HttpContext]bool{}
+
+// AcceptsSSE reports whether an Accept header value allows a text/event-stream response.
+func AcceptsSSE(accept string) bool {
+	// Wildcards are not enough, clients must ask for an event stream explicitly
+	for _, r := range wrapper.ParseAccept(accept) {
+		if r.Q > 0 && strings.EqualFold(r.Type+"/"+r.Subtype, SSEContentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnableSSEResponse switches the responses of the current request to Server-Sent Events.
+func EnableSSEResponse(ctx wrapper.HttpContext) {
+	ctx.SetContext(CtxSSEResponse, true)
+	ctx.SetContext(CtxSSELastWrite, time.Now())
+}
+
+// IsSSEResponse reports whether the responses of the current request are sent as Server-Sent Events.
+func IsSSEResponse(ctx wrapper.HttpContext) bool {
+	return ctx.GetBoolContext(CtxSSEResponse, false)
+}
+
+// SendMCPNotification queues a JSON-RPC notification that is sent before the response of the
+// current request. Notifications can only be delivered on SSE responses and are dropped otherwise.
+func SendMCPNotification(ctx wrapper.HttpContext, method string, params map[string]any) {
+	if !IsSSEResponse(ctx) {
+		log.Debugf("drop mcp notification %s, the response is not an event stream", method)
+		return
+	}
+	notification := map[string]any{
+		"jsonrpc": "2.0",
+		"method":  method,
+	}
+	if params != nil {
+		notification["params"] = params
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		log.Errorf("failed to marshal mcp notification %s: %v", method, err)
+		return
+	}
+	pending, _ := ctx.GetContext(CtxSSENotifications).([][]byte)
+	ctx.SetContext(CtxSSENotifications, append(pending, body))
+}
+
+// FormatSSEEvent frames data as a single Server-Sent Event, splitting it into one data line per line.
+func FormatSSEEvent(event string, data []byte) []byte {
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: ")
+		buf.WriteString(event)
+		buf.WriteByte('\n')
+	}
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(bytes.TrimSuffix(line, []byte("\r")))
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// SSEResponseBody frames a JSON-RPC response as an event stream, preceded by the queued notifications.
+func SSEResponseBody(ctx wrapper.HttpContext, response []byte) []byte {
+	var body []byte
+	if pending, ok := ctx.GetContext(CtxSSENotifications).([][]byte); ok {
+		for _, notification := range pending {
+			body = append(body, FormatSSEEvent("message", notification)...)
+		}
+		ctx.SetContext(CtxSSENotifications, nil)
+	}
+	return append(body, FormatSSEEvent("message", response)...)
+}
+
+// SSEKeepAlive returns a keep-alive comment when SSEKeepAliveInterval has passed since the last
+// write to the event stream, and nil otherwise or when the response is not an event stream.
+func SSEKeepAlive(ctx wrapper.HttpContext) []byte {
+	if !IsSSEResponse(ctx) {
+		return nil
+	}
+	now := time.Now()
+	if lastWrite, ok := ctx.GetContext(CtxSSELastWrite).(time.Time); ok && now.Sub(lastWrite) < SSEKeepAliveInterval {
+		return nil
+	}
+	ctx.SetContext(CtxSSELastWrite, now)
+	return sseKeepAlive
+}
+
+// RegisterSSEKeepAlive registers the tick function writing keep-alive comments to the event streams
+// kept alive with KeepSSEAlive. Wasm plugins have no per-stream timers, so without it keep-alives are
+// only written while data of the stream is being processed. Like every tick function, it must be
+// registered while the plugin configuration is being parsed.
+func RegisterSSEKeepAlive() {
+	wrapper.RegisterTickFunc(SSEKeepAliveTickPeriod, writeSSEKeepAlives)
+}
+
+// KeepSSEAlive writes keep-alive comments to the event stream of the current request on the ticks of
+// the VM, until StopSSEKeepAlive is called or writing to the stream fails. The response headers must
+// have been sent, e.g. by processing the response body of a streaming backend.
+func KeepSSEAlive(ctx wrapper.HttpContext) {
+	if IsSSEResponse(ctx) {
+		keptAliveSSEStreams[ctx] = true
+	}
+}
+
+// StopSSEKeepAlive stops writing keep-alive comments to the event stream of the current request, it
+// must be called once the stream ends, at the latest when the request is done.
+func StopSSEKeepAlive(ctx wrapper.HttpContext) {
+	delete(keptAliveSSEStreams, ctx)
+}
+
+// writeSSEKeepAlives writes a keep-alive comment to the kept alive event streams idle for longer than
+// SSEKeepAliveInterval
+func writeSSEKeepAlives() {
+	for ctx := range keptAliveSSEStreams {
+		ping := SSEKeepAlive(ctx)
+		if ping == nil {
+			continue
+		}
+		var injectErr error
+		err := wrapper.RunInContext(ctx, func() {
+			injectErr = proxywasm.InjectEncodedDataToFilterChain(ping, false)
+		})
+		if err == nil {
+			err = injectErr
+		}
+		if err != nil {
+			log.Debugf("stop keeping the event stream alive: %v", err)
+			delete(keptAliveSSEStreams, ctx)
+		}
+	}
+}
+
+// SSEResponseHeaders replaces the Content-Type of a JSON response with text/event-stream and
+// disables caching, as required for event streams.
+func SSEResponseHeaders(headers [][2]string) [][2]string {
+	result := make([][2]string, 0, len(headers)+2)
+	for _, h := range headers {
+		if strings.EqualFold(h[0], "content-type") || strings.EqualFold(h[0], "cache-control") {
+			continue
+		}
+		result = append(result, h)
+	}
+	return append(result, [2]string{"Content-Type", SSEContentType}, [2]string{"Cache-Control", "no-cache"})
+}
@@ -0,0 +1,179 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+type sseContextStub struct {
+	wrapper.HttpContext
+	values map[string]interface{}
+}
+
+func (c *sseContextStub) SetContext(key string, value interface{}) {
+	c.values[key] = value
+}
+
+func (c *sseContextStub) GetContext(key string) interface{} {
+	return c.values[key]
+}
+
+func (c *sseContextStub) GetBoolContext(key string, defaultValue bool) bool {
+	if value, ok := c.values[key].(bool); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func TestAcceptsSSE(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{"application/json, text/event-stream", true},
+		{"text/event-stream;q=0.9", true},
+		{"Text/Event-Stream", true},
+		{"application/json", false},
+		{"*/*", false},
+		{"text/event-stream;q=0, application/json", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := AcceptsSSE(tt.accept); got != tt.expected {
+			t.Errorf("AcceptsSSE(%q) = %v, want %v", tt.accept, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatSSEEvent(t *testing.T) {
+	got := string(FormatSSEEvent("message", []byte(`{"id":1}`)))
+	if want := "event: message\ndata: {\"id\":1}\n\n"; got != want {
+		t.Errorf("FormatSSEEvent() = %q, want %q", got, want)
+	}
+	got = string(FormatSSEEvent("", []byte("a\r\nb")))
+	if want := "data: a\ndata: b\n\n"; got != want {
+		t.Errorf("FormatSSEEvent() = %q, want %q", got, want)
+	}
+}
+
+func TestSSEResponseBody(t *testing.T) {
+	ctx := &sseContextStub{values: map[string]interface{}{}}
+	EnableSSEResponse(ctx)
+	SendMCPNotification(ctx, "notifications/progress", map[string]any{"progress": 1})
+	SendMCPNotification(ctx, "notifications/message", nil)
+
+	got := string(SSEResponseBody(ctx, []byte(`{"jsonrpc":"2.0","id":1,"result":{}}`)))
+	want := "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{\"progress\":1}}\n\n" +
+		"event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/message\"}\n\n" +
+		"event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":1,\"result\":{}}\n\n"
+	if got != want {
+		t.Errorf("SSEResponseBody() = %q, want %q", got, want)
+	}
+	if got := string(SSEResponseBody(ctx, []byte(`{}`))); got != "event: message\ndata: {}\n\n" {
+		t.Errorf("notifications must only be sent once, got %q", got)
+	}
+}
+
+func TestSSEKeepAlive(t *testing.T) {
+	ctx := &sseContextStub{values: map[string]interface{}{}}
+	if ping := SSEKeepAlive(ctx); ping != nil {
+		t.Errorf("keep-alive must not be sent on JSON responses, got %q", ping)
+	}
+	EnableSSEResponse(ctx)
+	if ping := SSEKeepAlive(ctx); ping != nil {
+		t.Errorf("keep-alive must not be sent before the interval passed, got %q", ping)
+	}
+	ctx.SetContext(CtxSSELastWrite, time.Now().Add(-SSEKeepAliveInterval))
+	if ping := string(SSEKeepAlive(ctx)); ping != ": ping\n\n" {
+		t.Errorf("SSEKeepAlive() = %q, want a ping comment", ping)
+	}
+	if ping := SSEKeepAlive(ctx); ping != nil {
+		t.Errorf("keep-alive must be throttled, got %q", ping)
+	}
+}
+
+func TestSSEKeepAliveTick(t *testing.T) {
+	var streams []wrapper.HttpContext
+	vm := wrapper.NewCommonVmCtx[struct{}]("sse-keepalive-test",
+		wrapper.ProcessResponseHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			EnableSSEResponse(ctx)
+			KeepSSEAlive(ctx)
+			streams = append(streams, ctx)
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	var ids []uint32
+	for i := 0; i < 2; i++ {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/sse"}}, true)
+		host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, false)
+		ids = append(ids, id)
+	}
+	defer func() {
+		for _, ctx := range streams {
+			StopSSEKeepAlive(ctx)
+		}
+	}()
+	// The emulator only exposes injected data once the stream is ended by an injection
+	injected := func(id uint32) string {
+		proxywasm.SetEffectiveContext(id)
+		proxywasm.InjectEncodedDataToFilterChain(nil, true)
+		return string(host.GetCurrentResponseBody(id))
+	}
+
+	writeSSEKeepAlives()
+	for _, id := range ids {
+		if body := injected(id); len(body) != 0 {
+			t.Errorf("keep-alive must not be sent before the interval passed, got %q", body)
+		}
+	}
+	// Only the idle stream gets a keep-alive, without any data of the stream being processed
+	streams[1].SetContext(CtxSSELastWrite, time.Now().Add(-SSEKeepAliveInterval))
+	writeSSEKeepAlives()
+	if body := injected(ids[0]); len(body) != 0 {
+		t.Errorf("keep-alive must only be sent to idle streams, got %q", body)
+	}
+	if body := injected(ids[1]); body != ": ping\n\n" {
+		t.Errorf("response body = %q, want a ping comment", body)
+	}
+
+	StopSSEKeepAlive(streams[0])
+	streams[0].SetContext(CtxSSELastWrite, time.Now().Add(-SSEKeepAliveInterval))
+	writeSSEKeepAlives()
+	if body := injected(ids[0]); len(body) != 0 {
+		t.Errorf("keep-alive must not be sent once stopped, got %q", body)
+	}
+}
+
+func TestSSEResponseHeaders(t *testing.T) {
+	got := SSEResponseHeaders([][2]string{{"Content-Type", "application/json; charset=utf-8"}, {"X-Custom", "1"}})
+	want := [][2]string{{"X-Custom", "1"}, {"Content-Type", "text/event-stream"}, {"Cache-Control", "no-cache"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SSEResponseHeaders() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/matcher"
+)
+
+// Validate validates an mcp-server plugin configuration in JSON or YAML format, including the
+// per-route configurations under _rules_. It has no host dependencies, so it can run in a native
+// binary, and returns nil when the configuration is valid. Errors carry the JSON pointer of the
+// offending field.
+func Validate(configBytes []byte) error {
+	if !gjson.ValidBytes(configBytes) {
+		jsonBytes, err := yamlToJSON(configBytes)
+		if err != nil {
+			return err
+		}
+		configBytes = jsonBytes
+	}
+	config := gjson.ParseBytes(configBytes)
+	if !config.IsObject() {
+		return configerr.New("", "object", errors.New("config must be an object"))
+	}
+
+	fields := config.Map()
+	rules, hasRules := fields[matcher.RULES_KEY]
+	if len(fields) == 0 || (hasRules && len(rules.Array()) == 0 && len(fields) == 1) {
+		return configerr.New("", "object", errors.New("config is empty"))
+	}
+	// The global config is only parsed when it has fields besides the rules, as the plugin does
+	if !hasRules || len(fields) > 1 {
+		if err := validateServerConfig(config); err != nil {
+			return err
+		}
+	}
+	for i, rule := range rules.Array() {
+		if err := validateServerConfig(rule); err != nil {
+			return configerr.Prefix(configerr.Pointer(matcher.RULES_KEY, i), err)
+		}
+	}
+	return nil
+}
+
+// validateServerConfig validates a single mcp-server configuration
+func validateServerConfig(config gjson.Result) error {
+	result, err := ValidateConfig(config.Raw)
+	if err != nil {
+		return err
+	}
+	return result.Error
+}
+
+// Run validates the configuration files named in args and reports one line per file, so that
+// plugin repositories can validate their configs in CI with a tiny native binary:
+//
+//	func main() {
+//		os.Exit(validator.Run(os.Args[1:], os.Stdout, os.Stderr))
+//	}
+//
+// It returns 0 when every file is valid, 1 when any file is invalid and 2 when a file cannot be
+// read or no file is given.
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: validate <config.yaml|config.json>...")
+		return 2
+	}
+	exitCode := 0
+	for _, path := range args {
+		configBytes, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			exitCode = 2
+			continue
+		}
+		if err := Validate(configBytes); err != nil {
+			fmt.Fprintf(stdout, "%s: %v\n", path, err)
+			if exitCode == 0 {
+				exitCode = 1
+			}
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: OK\n", path)
+	}
+	return exitCode
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validRestConfig = `
+server:
+  name: weather-api
+tools:
+  - name: get_weather
+    description: Get current weather
+    args:
+      - name: city
+        type: string
+        required: true
+    requestTemplate:
+      url: "https://api.weather.com/v1/current?city={{.args.city}}"
+      method: GET
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		errMsg string
+	}{
+		{
+			name:   "valid yaml",
+			config: validRestConfig,
+		},
+		{
+			name: "yaml with non-string keys",
+			config: `
+server:
+  name: weather-api
+  config:
+    404: not found
+    true:
+      - 1: one
+tools:
+  - name: get_weather
+    requestTemplate:
+      url: "https://api.weather.com/v1/current"
+      method: GET
+`,
+		},
+		{
+			name:   "valid json",
+			config: `{"toolSet": {"name": "tools", "serverTools": [{"serverName": "weather-api", "tools": ["get_weather"]}]}}`,
+		},
+		{
+			name:   "empty config",
+			config: `{}`,
+			errMsg: "config is empty",
+		},
+		{
+			name:   "not an object",
+			config: `[1, 2]`,
+			errMsg: "config must be an object",
+		},
+		{
+			name:   "invalid yaml",
+			config: "server: {\n  name",
+			errMsg: "failed to parse YAML",
+		},
+		{
+			name: "valid rules",
+			config: `{"_rules_": [{"_match_route_": ["weather"], "server": {"name": "weather-api"},
+				"tools": [{"name": "get_weather", "requestTemplate": {"url": "https://api.weather.com", "method": "GET"}}]}]}`,
+		},
+		{
+			name: "invalid rule is located by its index",
+			config: `{"_rules_": [
+				{"_match_route_": ["weather"], "server": {"name": "weather-api"}, "tools": [{"name": "get_weather", "requestTemplate": {"url": "https://api.weather.com", "method": "GET"}}]},
+				{"_match_route_": ["proxy"], "server": {"name": "proxy", "type": "mcp-proxy", "transport": "http"}}
+			]}`,
+			errMsg: `invalid config at "/_rules_/1/server/mcpServerURL"`,
+		},
+		{
+			name:   "invalid global config",
+			config: `{"server": {"type": "mcp-proxy"}, "_rules_": []}`,
+			errMsg: `invalid config at "/server/name"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]byte(tt.config))
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("expected valid config, got error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("expected error containing %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	validPath := filepath.Join(dir, "valid.yaml")
+	invalidPath := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(validPath, []byte(validRestConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalidPath, []byte(`{"server": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{validPath}, &stdout, &stderr); code != 0 {
+		t.Errorf("expected exit code 0, got %d, output: %s", code, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), validPath+": OK") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	if code := Run([]string{validPath, invalidPath}, &stdout, &stderr); code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stdout.String(), invalidPath+": invalid config at \"/server/name\"") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+
+	if code := Run([]string{filepath.Join(dir, "missing.yaml"), invalidPath}, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2, got %d", code)
+	}
+	if code := Run(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 without arguments, got %d", code)
+	}
+}
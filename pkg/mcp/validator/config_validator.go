@@ -106,24 +106,56 @@ func ValidateConfig(configJSON string) (*ValidationResult, error) {
 // ValidateConfigYAML validates MCP configuration from YAML format
 // This function converts YAML to JSON first, then validates using the same logic
 func ValidateConfigYAML(configYAML string) (*ValidationResult, error) {
-	// Parse YAML into a generic interface
-	var yamlData interface{}
-	if err := yaml.Unmarshal([]byte(configYAML), &yamlData); err != nil {
+	jsonBytes, err := yamlToJSON([]byte(configYAML))
+	if err != nil {
 		return &ValidationResult{
 			IsValid: false,
-			Error:   fmt.Errorf("failed to parse YAML: %v", err),
+			Error:   err,
 		}, nil
 	}
 
+	// Use the existing JSON validation logic
+	return ValidateConfig(string(jsonBytes))
+}
+
+// yamlToJSON converts a YAML document to JSON
+func yamlToJSON(configYAML []byte) ([]byte, error) {
+	// Parse YAML into a generic interface
+	var yamlData interface{}
+	if err := yaml.Unmarshal(configYAML, &yamlData); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %v", err)
+	}
+
 	// Convert to JSON
-	jsonBytes, err := json.Marshal(yamlData)
+	jsonBytes, err := json.Marshal(jsonValue(yamlData))
 	if err != nil {
-		return &ValidationResult{
-			IsValid: false,
-			Error:   fmt.Errorf("failed to convert YAML to JSON: %v", err),
-		}, nil
+		return nil, fmt.Errorf("failed to convert YAML to JSON: %v", err)
 	}
+	return jsonBytes, nil
+}
 
-	// Use the existing JSON validation logic
-	return ValidateConfig(string(jsonBytes))
+// jsonValue converts the mappings of a parsed YAML value to JSON objects. YAML mappings whose keys are
+// not all strings, e.g. `404: not found`, are parsed as map[interface{}]interface{}, which JSON cannot
+// encode, so their keys are formatted as strings.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonValue(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return object
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonValue(item)
+		}
+		return v
+	default:
+		return v
+	}
 }
@@ -0,0 +1,126 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"time"
+)
+
+// sweepInterval is the number of hits between two removals of the idle keys
+const sweepInterval = 1024
+
+// localState is the state of a key
+type localState struct {
+	window   int64 // index of the current window
+	count    int64
+	previous int64 // count of the previous window, for SlidingWindow
+	tokens   float64
+	last     time.Time // time of the last hit
+}
+
+// LocalLimiter limits the hits of the keys in the memory of the VM, every worker thread has its own
+// limits
+type LocalLimiter struct {
+	rule   Rule
+	states map[string]*localState
+	hits   int
+	now    func() time.Time
+}
+
+// NewLocalLimiter creates a limiter counting the hits in the VM
+func NewLocalLimiter(rule Rule) *LocalLimiter {
+	return &LocalLimiter{rule: rule, states: map[string]*localState{}, now: time.Now}
+}
+
+func (l *LocalLimiter) Rule() *Rule {
+	return &l.rule
+}
+
+// Take counts a hit of the key and calls the callback before returning
+func (l *LocalLimiter) Take(key string, callback func(result Result, err error)) error {
+	now := l.now()
+	l.hits++
+	if l.hits%sweepInterval == 0 {
+		l.sweep(now)
+	}
+	state, ok := l.states[key]
+	if !ok {
+		state = &localState{window: -1, tokens: float64(l.rule.Burst), last: now}
+		l.states[key] = state
+	}
+	callback(l.take(state, now), nil)
+	return nil
+}
+
+func (l *LocalLimiter) take(state *localState, now time.Time) Result {
+	r := &l.rule
+	window := r.Window.Milliseconds()
+	ms := now.UnixMilli()
+	index := ms / window
+	defer func() { state.last = now }()
+	switch r.Algorithm {
+	case TokenBucket:
+		elapsed := float64(now.Sub(state.last)) / float64(time.Millisecond)
+		state.tokens = min(float64(r.Burst), state.tokens+max(elapsed, 0)*r.rate())
+		allowed := state.tokens >= 1
+		if allowed {
+			state.tokens--
+		}
+		return r.tokenBucketResult(allowed, state.tokens)
+	case SlidingWindow:
+		if state.window != index {
+			if state.window == index-1 {
+				state.previous = state.count
+			} else {
+				state.previous = 0
+			}
+			state.window, state.count = index, 0
+		}
+		elapsed := ms - index*window
+		// The hit is allowed if the weighted count stays within the limit
+		allowed := r.slidingWindowCount(state.count+1, state.previous, elapsed) <= float64(r.Limit)
+		if allowed {
+			state.count++
+		}
+		return r.slidingWindowResult(allowed, state.count, state.previous, elapsed)
+	default:
+		if state.window != index {
+			state.window, state.count = index, 0
+		}
+		allowed := state.count < r.Limit
+		if allowed {
+			state.count++
+		}
+		return r.fixedWindowResult(allowed, state.count, time.Duration((index+1)*window-ms)*time.Millisecond)
+	}
+}
+
+// sweep removes the keys whose limit is entirely available again
+func (l *LocalLimiter) sweep(now time.Time) {
+	idle := 2 * l.rule.Window
+	if l.rule.Algorithm == TokenBucket {
+		idle = time.Duration(float64(l.rule.Burst) / l.rule.rate() * float64(time.Millisecond))
+	}
+	for key, state := range l.states {
+		if now.Sub(state.last) >= idle {
+			delete(l.states, key)
+		}
+	}
+}
+
+// Len returns the number of keys tracked
+func (l *LocalLimiter) Len() int {
+	return len(l.states)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStart is the start of a window of every length used by the tests
+var testStart = time.UnixMilli(1_800_000_000_000)
+
+func newTestLimiter(rule Rule) (*LocalLimiter, *time.Time) {
+	now := testStart
+	l := NewLocalLimiter(rule)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func take(t *testing.T, l *LocalLimiter, key string) Result {
+	var result Result
+	called := false
+	require.NoError(t, l.Take(key, func(r Result, err error) {
+		require.NoError(t, err)
+		result, called = r, true
+	}))
+	require.True(t, called)
+	return result
+}
+
+func TestLocalFixedWindow(t *testing.T) {
+	l, now := newTestLimiter(Rule{Algorithm: FixedWindow, Limit: 2, Window: time.Minute, Burst: 2})
+	*now = now.Add(15 * time.Second)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 45 * time.Second, Policy: "2;w=60"}, take(t, l, "a"))
+	assert.Equal(t, int64(0), take(t, l, "a").Remaining)
+	assert.Equal(t, Result{Limit: 2, Reset: 45 * time.Second, RetryAfter: 45 * time.Second, Policy: "2;w=60"}, take(t, l, "a"))
+	// Keys are limited separately
+	assert.True(t, take(t, l, "b").Allowed)
+
+	*now = testStart.Add(time.Minute)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Minute, Policy: "2;w=60"}, take(t, l, "a"))
+}
+
+func TestLocalSlidingWindow(t *testing.T) {
+	l, now := newTestLimiter(Rule{Algorithm: SlidingWindow, Limit: 4, Window: 10 * time.Second, Burst: 4})
+	for i := 0; i < 4; i++ {
+		assert.True(t, take(t, l, "a").Allowed)
+	}
+	// The 4 hits weigh 3 when a quarter of the next window is elapsed
+	result := take(t, l, "a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 12500*time.Millisecond, result.RetryAfter)
+
+	*now = testStart.Add(12400 * time.Millisecond)
+	result = take(t, l, "a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 100*time.Millisecond, result.RetryAfter)
+
+	*now = testStart.Add(12500 * time.Millisecond)
+	result = take(t, l, "a")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(0), result.Remaining)
+	assert.Equal(t, 7500*time.Millisecond, result.Reset)
+
+	// The weight of the previous window decays within the current window
+	result = take(t, l, "a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 2500*time.Millisecond, result.RetryAfter)
+
+	// Windows older than the previous one are not counted
+	*now = testStart.Add(30 * time.Second)
+	result = take(t, l, "a")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, int64(3), result.Remaining)
+}
+
+func TestLocalTokenBucket(t *testing.T) {
+	l, now := newTestLimiter(Rule{Algorithm: TokenBucket, Limit: 1, Window: time.Second, Burst: 2})
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second, Policy: "1;w=1;burst=2"}, take(t, l, "a"))
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: 2 * time.Second, Policy: "1;w=1;burst=2"}, take(t, l, "a"))
+	assert.Equal(t, Result{Limit: 2, Reset: 2 * time.Second, RetryAfter: time.Second, Policy: "1;w=1;burst=2"}, take(t, l, "a"))
+
+	*now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, take(t, l, "a").RetryAfter)
+	*now = now.Add(500 * time.Millisecond)
+	assert.True(t, take(t, l, "a").Allowed)
+
+	// The bucket does not exceed its capacity
+	*now = now.Add(time.Hour)
+	assert.Equal(t, int64(1), take(t, l, "a").Remaining)
+}
+
+func TestLocalLimiterSweep(t *testing.T) {
+	l, now := newTestLimiter(Rule{Algorithm: FixedWindow, Limit: 10, Window: time.Minute, Burst: 10})
+	take(t, l, "idle")
+	*now = now.Add(3 * time.Minute)
+	for i := 2; i < sweepInterval; i++ {
+		take(t, l, "active")
+	}
+	assert.Equal(t, 2, l.Len())
+	take(t, l, "active")
+	assert.Equal(t, 1, l.Len())
+}
@@ -0,0 +1,352 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ratelimit limits the requests of a key, e.g. a consumer, per VM with NewLocalLimiter or
+// across all gateway instances with NewRedisLimiter. A rule is configured as:
+//
+//	{"key": "header:x-api-key", "algorithm": "token_bucket", "limit": 100, "window": "1m", "burst": 20}
+//
+// Keys are consumer, route, ip, global or header:<name>. Algorithms are fixed_window (the default),
+// sliding_window, which weights the count of the previous window to smooth its boundary, and
+// token_bucket, which refills limit tokens per window up to burst. The window is a duration or a
+// number of seconds. Usage in onHttpRequestHeaders:
+//
+//	return ratelimit.Check(ctx, config.limiter)
+//
+// and in onHttpResponseHeaders, to return the RateLimit-* headers:
+//
+//	ratelimit.AddResponseHeaders(ctx)
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// Algorithm is the way hits are counted
+type Algorithm string
+
+const (
+	FixedWindow   Algorithm = "fixed_window"
+	SlidingWindow Algorithm = "sliding_window"
+	TokenBucket   Algorithm = "token_bucket"
+)
+
+// Keys of the rules, a header is given as header:<name>
+const (
+	KeyConsumer     = "consumer"
+	KeyRoute        = "route"
+	KeyIP           = "ip"
+	KeyGlobal       = "global"
+	KeyHeaderPrefix = "header:"
+)
+
+const (
+	consumerHeader = "x-mse-consumer"
+	// CtxKeyResult holds the Result of the request checked by Check
+	CtxKeyResult = "ratelimit_result"
+	// RejectedStatus is the status of the requests rejected by Check
+	RejectedStatus = 429
+)
+
+// Rule is a limit of the hits of every key
+type Rule struct {
+	Key       string
+	Algorithm Algorithm
+	// Limit is the number of hits per window, the number of tokens refilled per window for TokenBucket
+	Limit  int64
+	Window time.Duration
+	// Burst is the capacity of TokenBucket, defaults to Limit
+	Burst int64
+	// RemoteIP selects the client IP of the ip key, the source address by default
+	RemoteIP wrapper.RemoteIP
+}
+
+// ParseRule parses a rule from a config
+func ParseRule(json gjson.Result) (*Rule, error) {
+	if !json.IsObject() {
+		return nil, configerr.Errorf("", "object", "rate limit rule is %s", json.Type)
+	}
+	r := &Rule{
+		Key:       json.Get("key").String(),
+		Algorithm: Algorithm(json.Get("algorithm").String()),
+		Limit:     json.Get("limit").Int(),
+		Burst:     json.Get("burst").Int(),
+	}
+	if r.Key == "" {
+		r.Key = KeyGlobal
+	}
+	switch {
+	case r.Key == KeyConsumer, r.Key == KeyRoute, r.Key == KeyIP, r.Key == KeyGlobal:
+	case strings.HasPrefix(r.Key, KeyHeaderPrefix) && len(r.Key) > len(KeyHeaderPrefix):
+	default:
+		return nil, configerr.Errorf("/key", "consumer, route, ip, global or header:<name>", "unknown key %q", r.Key)
+	}
+	switch r.Algorithm {
+	case "":
+		r.Algorithm = FixedWindow
+	case FixedWindow, SlidingWindow, TokenBucket:
+	default:
+		return nil, configerr.Errorf("/algorithm", "fixed_window, sliding_window or token_bucket", "unknown algorithm %q", r.Algorithm)
+	}
+	if r.Limit <= 0 {
+		return nil, configerr.Errorf("/limit", "positive integer", "limit is %s", json.Get("limit").Raw)
+	}
+	window := json.Get("window")
+	switch window.Type {
+	case gjson.Number:
+		r.Window = time.Duration(window.Float() * float64(time.Second))
+	case gjson.String:
+		d, err := time.ParseDuration(window.Str)
+		if err != nil {
+			return nil, configerr.New("/window", "duration", err)
+		}
+		r.Window = d
+	case gjson.Null:
+		r.Window = time.Second
+	}
+	if r.Window < time.Millisecond {
+		return nil, configerr.Errorf("/window", "duration of at least 1ms", "window is %s", window.Raw)
+	}
+	if r.Burst < 0 {
+		return nil, configerr.Errorf("/burst", "positive integer", "burst is %d", r.Burst)
+	}
+	if r.Burst == 0 {
+		r.Burst = r.Limit
+	}
+	if remoteIP := json.Get("remoteIP"); remoteIP.Exists() {
+		if err := configerr.DecodeJSON("/remoteIP", []byte(remoteIP.Raw), &r.RemoteIP); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// UnmarshalJSON parses the rule of a config bound with encoding/json or wrapper.BindConfig
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseRule(gjson.ParseBytes(data))
+	if err != nil {
+		return err
+	}
+	*r = *parsed
+	return nil
+}
+
+// KeyOf returns the key of the current request, false if the request has none, e.g. no consumer,
+// in which case it is not limited
+func (r *Rule) KeyOf() (string, bool) {
+	var value string
+	switch {
+	case r.Key == KeyGlobal:
+		return KeyGlobal, true
+	case r.Key == KeyConsumer:
+		value, _ = proxywasm.GetHttpRequestHeader(consumerHeader)
+	case r.Key == KeyRoute:
+		route, _ := proxywasm.GetProperty([]string{"route_name"})
+		value = string(route)
+	case r.Key == KeyIP:
+		value = r.RemoteIP.String()
+	default:
+		value, _ = proxywasm.GetHttpRequestHeader(strings.TrimPrefix(r.Key, KeyHeaderPrefix))
+	}
+	if value == "" {
+		return "", false
+	}
+	return r.Key + ":" + value, true
+}
+
+// Result is the state of the limit of a key after a hit
+type Result struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// Reset is the time until the window starts over, until the bucket is full for TokenBucket
+	Reset time.Duration
+	// RetryAfter is the time until a rejected hit may be allowed, 0 if the hit is allowed
+	RetryAfter time.Duration
+	// Policy is the value of the RateLimit-Policy header
+	Policy string
+}
+
+// Headers returns the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers of the result, and Retry-After if the hit is rejected
+func (r *Result) Headers() [][2]string {
+	headers := [][2]string{
+		{"RateLimit-Limit", strconv.FormatInt(r.Limit, 10)},
+		{"RateLimit-Remaining", strconv.FormatInt(r.Remaining, 10)},
+		{"RateLimit-Reset", strconv.FormatInt(seconds(r.Reset), 10)},
+	}
+	if r.Policy != "" {
+		headers = append(headers, [2]string{"RateLimit-Policy", r.Policy})
+	}
+	if !r.Allowed {
+		headers = append(headers, [2]string{"Retry-After", strconv.FormatInt(seconds(r.RetryAfter), 10)})
+	}
+	return headers
+}
+
+// seconds rounds a duration up to whole seconds
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// policy returns the RateLimit-Policy of the rule, e.g. 100;w=60
+func (r *Rule) policy() string {
+	policy := fmt.Sprintf("%d;w=%d", r.Limit, seconds(r.Window))
+	if r.Algorithm == TokenBucket && r.Burst != r.Limit {
+		policy += fmt.Sprintf(";burst=%d", r.Burst)
+	}
+	return policy
+}
+
+// fixedWindowResult is the result of a hit counted in a window ending after reset
+func (r *Rule) fixedWindowResult(allowed bool, count int64, reset time.Duration) Result {
+	result := Result{Allowed: allowed, Limit: r.Limit, Remaining: max(0, r.Limit-count), Reset: reset, Policy: r.policy()}
+	if !allowed {
+		result.RetryAfter = reset
+	}
+	return result
+}
+
+// slidingWindowResult is the result of a hit given the counts of the current and previous windows
+// and the milliseconds elapsed in the current window. The count of the previous window is weighted
+// by the part of it still in the sliding window.
+func (r *Rule) slidingWindowResult(allowed bool, current, previous, elapsed int64) Result {
+	window := r.Window.Milliseconds()
+	weighted := r.slidingWindowCount(current, previous, elapsed)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     r.Limit,
+		Remaining: max(0, int64(math.Floor(float64(r.Limit)-weighted))),
+		Reset:     time.Duration(window-elapsed) * time.Millisecond,
+		Policy:    r.policy(),
+	}
+	if allowed {
+		return result
+	}
+	var wait float64
+	if current+1 <= r.Limit {
+		// The weight of the previous window decays enough within the current window
+		wait = float64(window) - float64(r.Limit-1-current)*float64(window)/float64(previous) - float64(elapsed)
+	} else {
+		// The current window becomes the previous one
+		wait = float64(window-elapsed) + float64(window) - float64(r.Limit-1)*float64(window)/float64(current)
+	}
+	result.RetryAfter = time.Duration(math.Ceil(max(wait, 0))) * time.Millisecond
+	return result
+}
+
+// slidingWindowCount is the count of the sliding window ending now
+func (r *Rule) slidingWindowCount(current, previous, elapsed int64) float64 {
+	window := r.Window.Milliseconds()
+	return float64(previous)*float64(window-elapsed)/float64(window) + float64(current)
+}
+
+// tokenBucketResult is the result of a hit leaving tokens in the bucket
+func (r *Rule) tokenBucketResult(allowed bool, tokens float64) Result {
+	rate := r.rate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     r.Burst,
+		Remaining: int64(math.Floor(tokens)),
+		Reset:     time.Duration(math.Ceil((float64(r.Burst)-tokens)/rate)) * time.Millisecond,
+		Policy:    r.policy(),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+	return result
+}
+
+// rate is the number of tokens refilled per millisecond
+func (r *Rule) rate() float64 {
+	return float64(r.Limit) / float64(r.Window.Milliseconds())
+}
+
+// Limiter counts the hits of keys. The callback of Take may be called before Take returns, e.g. by
+// local limiters, or later, e.g. by the callout of Redis limiters.
+type Limiter interface {
+	Rule() *Rule
+	Take(key string, callback func(result Result, err error)) error
+}
+
+// Check takes a hit of the key of the current request and returns the action of
+// onHttpRequestHeaders. A rejected request is answered with 429 and the RateLimit-* headers. Requests
+// without a key are not limited. The failures of Redis follow the failure policy of wrapper.FailureRedis.
+func Check(ctx wrapper.HttpContext, limiter Limiter) types.Action {
+	key, ok := limiter.Rule().KeyOf()
+	if !ok {
+		return types.ActionContinue
+	}
+	done, pending := false, false
+	action := types.ActionContinue
+	err := limiter.Take(key, func(result Result, err error) {
+		done = true
+		action = handleResult(ctx, key, result, err)
+		if pending && action == types.ActionContinue {
+			_ = proxywasm.ResumeHttpRequest()
+		}
+	})
+	if err != nil {
+		return handleResult(ctx, key, Result{}, err)
+	}
+	if done {
+		return action
+	}
+	// The result is not known yet, the request waits for the callback
+	pending = true
+	return types.HeaderStopAllIterationAndWatermark
+}
+
+// handleResult rejects the request if the hit is rejected, and returns whether the request continues
+func handleResult(ctx wrapper.HttpContext, key string, result Result, err error) types.Action {
+	if err != nil {
+		if ctx.HandleFailure(wrapper.FailureRedis, err) == wrapper.FailClosed {
+			return types.ActionPause
+		}
+		return types.ActionContinue
+	}
+	ctx.SetContext(CtxKeyResult, &result)
+	if result.Allowed {
+		return types.ActionContinue
+	}
+	log.Debugf("rate limit of %s exceeded, retry after %s", key, result.RetryAfter)
+	_ = proxywasm.SendHttpResponseWithDetail(RejectedStatus, "ratelimit.rejected", result.Headers(), []byte("Too Many Requests"), -1)
+	return types.ActionPause
+}
+
+// AddResponseHeaders adds the RateLimit-* headers of the request checked by Check to the response
+func AddResponseHeaders(ctx wrapper.HttpContext) {
+	result, ok := ctx.GetContext(CtxKeyResult).(*Result)
+	if !ok {
+		return
+	}
+	for _, header := range result.Headers() {
+		_ = proxywasm.ReplaceHttpResponseHeader(header[0], header[1])
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule(gjson.Parse(`{"key": "header:x-api-key", "algorithm": "token_bucket", "limit": 100, "window": "1m", "burst": 20}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Rule{Key: "header:x-api-key", Algorithm: TokenBucket, Limit: 100, Window: time.Minute, Burst: 20}, rule)
+
+	rule, err = ParseRule(gjson.Parse(`{"limit": 5, "window": 0.5}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Rule{Key: KeyGlobal, Algorithm: FixedWindow, Limit: 5, Window: 500 * time.Millisecond, Burst: 5}, rule)
+
+	rule, err = ParseRule(gjson.Parse(`{"key": "ip", "limit": 5, "remoteIP": {"header": "x-forwarded-for", "trustedHops": 1}}`))
+	require.NoError(t, err)
+	assert.Equal(t, wrapper.RemoteIP{Header: "x-forwarded-for", TrustedHops: 1}, rule.RemoteIP)
+
+	var config struct {
+		Rule Rule `json:"rule"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"rule": {"key": "consumer", "limit": 10}}`), &config))
+	assert.Equal(t, Rule{Key: KeyConsumer, Algorithm: FixedWindow, Limit: 10, Window: time.Second, Burst: 10}, config.Rule)
+
+	for config, message := range map[string]string{
+		`[]`:                                             `invalid config at "/", expected object`,
+		`{"key": "cookie", "limit": 1}`:                  `invalid config at "/key"`,
+		`{"key": "header:", "limit": 1}`:                 `invalid config at "/key"`,
+		`{"algorithm": "leaky", "limit": 1}`:             `invalid config at "/algorithm"`,
+		`{"limit": 0}`:                                   `invalid config at "/limit", expected positive integer`,
+		`{"limit": 1, "window": "1 minute"}`:             `invalid config at "/window", expected duration`,
+		`{"limit": 1, "window": "0s"}`:                   `invalid config at "/window"`,
+		`{"limit": 1, "burst": -1}`:                      `invalid config at "/burst"`,
+		`{"limit": 1, "remoteIP": {"trustedHops": "1"}}`: `invalid config at "/remoteIP/trustedHops", expected integer`,
+	} {
+		_, err := ParseRule(gjson.Parse(config))
+		assert.ErrorContains(t, err, message, config)
+	}
+}
+
+func TestResultHeaders(t *testing.T) {
+	result := Result{Allowed: true, Limit: 10, Remaining: 3, Reset: 1500 * time.Millisecond, Policy: "10;w=60"}
+	assert.Equal(t, [][2]string{
+		{"RateLimit-Limit", "10"}, {"RateLimit-Remaining", "3"}, {"RateLimit-Reset", "2"}, {"RateLimit-Policy", "10;w=60"},
+	}, result.Headers())
+	result = Result{Limit: 10, Reset: time.Minute, RetryAfter: 100 * time.Millisecond}
+	assert.Equal(t, [][2]string{
+		{"RateLimit-Limit", "10"}, {"RateLimit-Remaining", "0"}, {"RateLimit-Reset", "60"}, {"Retry-After", "1"},
+	}, result.Headers())
+}
+
+func headerValue(headers [][2]string, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h[0], name) {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+func TestCheckLocal(t *testing.T) {
+	limiter := NewLocalLimiter(Rule{Key: "header:x-api-key", Algorithm: FixedWindow, Limit: 2, Window: time.Hour, Burst: 2})
+	vm := wrapper.NewCommonVmCtx("ratelimit-test",
+		wrapper.ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			return Check(ctx, limiter)
+		}),
+		wrapper.ProcessResponseHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			AddResponseHeaders(ctx)
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	request := func(key string) uint32 {
+		id := host.InitializeHttpContext()
+		headers := [][2]string{{":authority", "example.com"}, {":path", "/"}}
+		if key != "" {
+			headers = append(headers, [2]string{"x-api-key", key})
+		}
+		host.CallOnRequestHeaders(id, headers, true)
+		if host.GetSentLocalResponse(id) == nil {
+			host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, true)
+		}
+		return id
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		id := request("k1")
+		assert.Nil(t, host.GetSentLocalResponse(id), i)
+		assert.Equal(t, remaining, headerValue(host.GetCurrentResponseHeaders(id), "RateLimit-Remaining"))
+		assert.Equal(t, "2", headerValue(host.GetCurrentResponseHeaders(id), "RateLimit-Limit"))
+		host.CompleteHttpContext(id)
+	}
+
+	id := request("k1")
+	response := host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(RejectedStatus), response.StatusCode)
+	assert.Equal(t, "ratelimit.rejected", response.StatusCodeDetail)
+	assert.NotEmpty(t, headerValue(response.Headers, "Retry-After"))
+	host.CompleteHttpContext(id)
+
+	// Other keys and requests without a key are not limited by k1
+	for _, key := range []string{"k2", ""} {
+		id := request(key)
+		assert.Nil(t, host.GetSentLocalResponse(id))
+		host.CompleteHttpContext(id)
+	}
+	assert.Equal(t, 2, limiter.Len())
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// fixedWindowScript counts a hit in the window of KEYS[1] unless its limit ARGV[1] is reached, the
+// window lasts ARGV[2] milliseconds. It returns whether the hit is allowed, the count and the
+// milliseconds to the end of the window.
+const fixedWindowScript = `local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if count >= tonumber(ARGV[1]) then
+  return {0, count, redis.call('PTTL', KEYS[1])}
+end
+count = redis.call('INCR', KEYS[1])
+if count == 1 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return {1, count, redis.call('PTTL', KEYS[1])}`
+
+// slidingWindowScript counts a hit in the current window KEYS[1] unless the count of the previous
+// window KEYS[2], weighted by the part of it still in the sliding window, plus the count of the
+// current one reaches the limit ARGV[1]. ARGV[2] is the length of the windows and ARGV[3] the time
+// elapsed in the current one, in milliseconds. It returns whether the hit is allowed and the counts
+// of both windows.
+const slidingWindowScript = `local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+if previous * (window - elapsed) / window + current + 1 > limit then
+  return {0, current, previous}
+end
+current = redis.call('INCR', KEYS[1])
+if current == 1 then
+  redis.call('PEXPIRE', KEYS[1], 2 * window)
+end
+return {1, current, previous}`
+
+// tokenBucketScript takes a token of the bucket KEYS[1] of capacity ARGV[1], refilled with ARGV[2]
+// tokens every ARGV[3] milliseconds, at the time ARGV[4] in milliseconds. It returns whether the hit
+// is allowed and the tokens left, as a string since Redis truncates the numbers of scripts.
+const tokenBucketScript = `local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2]) / tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return {allowed, tostring(tokens)}`
+
+// RedisLimiter limits the hits of the keys with Redis, the limits are shared by all gateway instances
+type RedisLimiter struct {
+	rule   Rule
+	client wrapper.RedisClient
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisLimiter creates a limiter counting the hits in Redis, under keys starting with prefix, e.g.
+// the name of the plugin. The keys of a hit share a {hash tag} so that they work with Redis Cluster.
+func NewRedisLimiter(client wrapper.RedisClient, rule Rule, prefix string) *RedisLimiter {
+	return &RedisLimiter{rule: rule, client: client, prefix: prefix, now: time.Now}
+}
+
+func (l *RedisLimiter) Rule() *Rule {
+	return &l.rule
+}
+
+// Take counts a hit of the key, the callback is called with the reply of Redis
+func (l *RedisLimiter) Take(key string, callback func(result Result, err error)) error {
+	r := &l.rule
+	now := l.now()
+	ms := now.UnixMilli()
+	window := r.Window.Milliseconds()
+	index := ms / window
+	base := "{" + l.prefix + ":" + key + "}"
+	switch r.Algorithm {
+	case TokenBucket:
+		keys := []interface{}{base}
+		args := []interface{}{r.Burst, r.Limit, window, ms}
+		return l.client.Eval(tokenBucketScript, len(keys), keys, args, func(response resp.Value) {
+			values, err := replyValues(response, 2)
+			if err != nil {
+				callback(Result{}, err)
+				return
+			}
+			tokens, err := strconv.ParseFloat(values[1].String(), 64)
+			if err != nil {
+				callback(Result{}, fmt.Errorf("unexpected rate limit reply: %s", response.String()))
+				return
+			}
+			callback(r.tokenBucketResult(values[0].Integer() == 1, tokens), nil)
+		})
+	case SlidingWindow:
+		keys := []interface{}{base + ":" + strconv.FormatInt(index, 10), base + ":" + strconv.FormatInt(index-1, 10)}
+		elapsed := ms - index*window
+		args := []interface{}{r.Limit, window, elapsed}
+		return l.client.Eval(slidingWindowScript, len(keys), keys, args, func(response resp.Value) {
+			values, err := replyValues(response, 3)
+			if err != nil {
+				callback(Result{}, err)
+				return
+			}
+			callback(r.slidingWindowResult(values[0].Integer() == 1, int64(values[1].Integer()), int64(values[2].Integer()), elapsed), nil)
+		})
+	default:
+		keys := []interface{}{base + ":" + strconv.FormatInt(index, 10)}
+		args := []interface{}{r.Limit, window}
+		return l.client.Eval(fixedWindowScript, len(keys), keys, args, func(response resp.Value) {
+			values, err := replyValues(response, 3)
+			if err != nil {
+				callback(Result{}, err)
+				return
+			}
+			reset := time.Duration(values[2].Integer()) * time.Millisecond
+			if reset < 0 {
+				// The counter may have expired since it was read, the window ends on schedule
+				reset = time.Duration((index+1)*window-ms) * time.Millisecond
+			}
+			callback(r.fixedWindowResult(values[0].Integer() == 1, int64(values[1].Integer()), reset), nil)
+		})
+	}
+}
+
+// replyValues returns the values of the array replied by a script
+func replyValues(response resp.Value, n int) ([]resp.Value, error) {
+	if err := response.Error(); err != nil {
+		return nil, err
+	}
+	values := response.Array()
+	if len(values) != n {
+		return nil, fmt.Errorf("unexpected rate limit reply: %s", response.String())
+	}
+	return values, nil
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func redisReply(values ...resp.Value) []byte {
+	b, _ := resp.ArrayValue(values).MarshalRESP()
+	return b
+}
+
+func TestRedisLimiter(t *testing.T) {
+	client := wrapper.NewRedisClusterClient(wrapper.FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	var limiter *RedisLimiter
+	vm := wrapper.NewCommonVmCtx("ratelimit-redis-test",
+		wrapper.ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			return Check(ctx, limiter)
+		}),
+		wrapper.ProcessResponseHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			AddResponseHeaders(ctx)
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	require.NoError(t, client.Init("", "", 1000))
+
+	// request sends a request of alice and replies to the Redis callout, it returns the arguments of the callout
+	request := func(rule Rule, reply []byte) (uint32, []string) {
+		limiter = NewRedisLimiter(client, rule, "test")
+		limiter.now = func() time.Time { return testStart.Add(2500 * time.Millisecond) }
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"x-mse-consumer", "alice"}}, true)
+		require.Equal(t, types.HeaderStopAllIterationAndWatermark, host.GetCurrentHttpStreamAction(id))
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		values, _, err := resp.NewReader(bytes.NewReader(callouts[0].Query)).ReadValue()
+		require.NoError(t, err)
+		var args []string
+		for _, v := range values.Array() {
+			args = append(args, v.String())
+		}
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, reply)
+		if host.GetSentLocalResponse(id) == nil {
+			host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, true)
+		}
+		return id, args
+	}
+
+	fixed := Rule{Key: KeyConsumer, Algorithm: FixedWindow, Limit: 10, Window: time.Minute, Burst: 10}
+	id, args := request(fixed, redisReply(resp.IntegerValue(1), resp.IntegerValue(4), resp.IntegerValue(57500)))
+	assert.Equal(t, []string{"eval", fixedWindowScript, "1", "{test:consumer:alice}:30000000", "10", "60000"}, args)
+	assert.Equal(t, types.ActionContinue, host.GetCurrentHttpStreamAction(id))
+	headers := host.GetCurrentResponseHeaders(id)
+	assert.Equal(t, "6", headerValue(headers, "RateLimit-Remaining"))
+	assert.Equal(t, "58", headerValue(headers, "RateLimit-Reset"))
+	host.CompleteHttpContext(id)
+
+	id, _ = request(fixed, redisReply(resp.IntegerValue(0), resp.IntegerValue(10), resp.IntegerValue(-2)))
+	response := host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(RejectedStatus), response.StatusCode)
+	// The window ends on schedule when its counter is gone
+	assert.Equal(t, "58", headerValue(response.Headers, "Retry-After"))
+	host.CompleteHttpContext(id)
+
+	sliding := Rule{Key: KeyConsumer, Algorithm: SlidingWindow, Limit: 4, Window: 10 * time.Second, Burst: 4}
+	id, args = request(sliding, redisReply(resp.IntegerValue(0), resp.IntegerValue(0), resp.IntegerValue(5)))
+	assert.Equal(t, []string{"eval", slidingWindowScript, "2", "{test:consumer:alice}:180000000", "{test:consumer:alice}:179999999", "4", "10000", "2500"}, args)
+	response = host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, "2", headerValue(response.Headers, "Retry-After"))
+	host.CompleteHttpContext(id)
+
+	bucket := Rule{Key: KeyConsumer, Algorithm: TokenBucket, Limit: 1, Window: time.Second, Burst: 5}
+	id, args = request(bucket, redisReply(resp.IntegerValue(1), resp.StringValue("3.5")))
+	assert.Equal(t, []string{"eval", tokenBucketScript, "1", "{test:consumer:alice}", "5", "1", "1000", "1800000002500"}, args)
+	headers = host.GetCurrentResponseHeaders(id)
+	assert.Equal(t, "3", headerValue(headers, "RateLimit-Remaining"))
+	assert.Equal(t, "5", headerValue(headers, "RateLimit-Limit"))
+	assert.Equal(t, "2", headerValue(headers, "RateLimit-Reset"))
+	host.CompleteHttpContext(id)
+
+	// Redis errors fail open without a failure policy
+	id, _ = request(fixed, []byte("-ERR unknown command\r\n"))
+	assert.Nil(t, host.GetSentLocalResponse(id))
+	assert.Equal(t, types.ActionContinue, host.GetCurrentHttpStreamAction(id))
+	assert.Empty(t, headerValue(host.GetCurrentResponseHeaders(id), "RateLimit-Limit"))
+	host.CompleteHttpContext(id)
+
+	id, _ = request(bucket, redisReply(resp.IntegerValue(1)))
+	assert.Nil(t, host.GetSentLocalResponse(id))
+	host.CompleteHttpContext(id)
+}
@@ -0,0 +1,316 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schedule evaluates the time windows of plugin configs, e.g. to block requests outside
+// business hours or to switch models off-peak. A schedule is a list of windows, each written as a
+// string or an object:
+//
+//	[
+//	  "mon-fri 09:00-18:00 Asia/Shanghai",
+//	  {"days": ["sat", "sun"], "start": "22:00", "end": "06:00", "timezone": "Europe/Berlin"}
+//	]
+//
+// Days default to every day, start to 00:00, end to 24:00, which can be written 00:00 as well, and the
+// timezone to UTC. A window ending before it starts spans midnight and belongs to the day it starts on.
+// The windows are parsed once with the config, so checking a schedule per request is cheap.
+//
+// Timezones are IANA names like Asia/Shanghai or fixed offsets like UTC+8 or +05:30. The time zone
+// database is not available to plugins and is not embedded by this package, so that plugins which do
+// not need it do not grow: plugins using IANA names import it with
+//
+//	import _ "time/tzdata"
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+const minutesPerDay = 24 * 60
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Window is a daily time window on some days of the week
+type Window struct {
+	days     [7]bool
+	start    int // minute of the day the window starts
+	end      int // minute of the day the window ends, before start if the window spans midnight
+	location *time.Location
+}
+
+// Schedule is a set of time windows
+type Schedule struct {
+	Windows []Window
+}
+
+// Parse parses a schedule from a window or an array of windows
+func Parse(json gjson.Result) (*Schedule, error) {
+	s := &Schedule{}
+	if !json.Exists() {
+		return s, nil
+	}
+	if !json.IsArray() {
+		w, err := parseWindow(json)
+		if err != nil {
+			return nil, err
+		}
+		s.Windows = append(s.Windows, w)
+		return s, nil
+	}
+	for i, item := range json.Array() {
+		w, err := parseWindow(item)
+		if err != nil {
+			return nil, configerr.Prefix(configerr.Pointer(i), err)
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	return s, nil
+}
+
+// UnmarshalJSON parses the schedule of a config bound with encoding/json or wrapper.BindConfig
+func (s *Schedule) UnmarshalJSON(data []byte) error {
+	parsed, err := Parse(gjson.ParseBytes(data))
+	if err != nil {
+		return err
+	}
+	*s = *parsed
+	return nil
+}
+
+// MarshalJSON writes the windows as strings
+func (s Schedule) MarshalJSON() ([]byte, error) {
+	windows := make([]string, 0, len(s.Windows))
+	for _, w := range s.Windows {
+		windows = append(windows, w.String())
+	}
+	return json.Marshal(windows)
+}
+
+// Active tells whether t is in one of the windows, an empty schedule is never active
+func (s *Schedule) Active(t time.Time) bool {
+	for i := range s.Windows {
+		if s.Windows[i].Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveNow tells whether the current time is in one of the windows
+func (s *Schedule) ActiveNow() bool {
+	return s.Active(time.Now())
+}
+
+// Contains tells whether t is in the window
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	// The window spans midnight, the part after midnight belongs to the previous day
+	return (w.days[day] && minute >= w.start) || (w.days[(day+6)%7] && minute < w.end)
+}
+
+func (w *Window) String() string {
+	var days []string
+	for _, name := range []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"} {
+		if w.days[dayNames[name]] {
+			days = append(days, name)
+		}
+	}
+	return fmt.Sprintf("%s %s-%s %s", strings.Join(days, ","), formatMinute(w.start), formatMinute(w.end), w.location)
+}
+
+func parseWindow(json gjson.Result) (Window, error) {
+	if json.Type == gjson.String {
+		return parseWindowString(json.String())
+	}
+	if !json.IsObject() {
+		return Window{}, configerr.Errorf("", "string or object", "invalid time window: %s", json.Raw)
+	}
+	if days := json.Get("days"); days.Exists() && !days.IsArray() {
+		return Window{}, configerr.Errorf("/days", "array", "got %s", days.Raw)
+	}
+	var days []string
+	for _, day := range json.Get("days").Array() {
+		days = append(days, day.String())
+	}
+	return newWindow(days, json.Get("start").String(), json.Get("end").String(), json.Get("timezone").String())
+}
+
+// parseWindowString parses "[days] [start-end] [timezone]", e.g. "mon-fri 09:00-18:00 Asia/Shanghai"
+func parseWindowString(s string) (Window, error) {
+	var days []string
+	var start, end, timezone string
+	for _, field := range strings.Fields(s) {
+		switch {
+		case isTimezone(field):
+			timezone = field
+		case strings.Contains(field, ":"):
+			var ok bool
+			if start, end, ok = strings.Cut(field, "-"); !ok {
+				return Window{}, configerr.Errorf("", "[days] [HH:MM-HH:MM] [timezone]", "invalid time range %q", field)
+			}
+		default:
+			days = append(days, strings.Split(field, ",")...)
+		}
+	}
+	return newWindow(days, start, end, timezone)
+}
+
+func newWindow(days []string, start, end, timezone string) (Window, error) {
+	w := Window{end: minutesPerDay, location: time.UTC}
+	var err error
+	if len(days) == 0 {
+		days = []string{"*"}
+	}
+	for _, day := range days {
+		if err := w.addDays(day); err != nil {
+			return w, configerr.New("/days", "days like mon, mon-fri or *", err)
+		}
+	}
+	if start != "" {
+		if w.start, err = parseMinute(start); err != nil || w.start == minutesPerDay {
+			return w, configerr.Errorf("/start", "HH:MM", "invalid start %q", start)
+		}
+	}
+	if end != "" {
+		if w.end, err = parseMinute(end); err != nil {
+			return w, configerr.Errorf("/end", "HH:MM", "invalid end %q", end)
+		}
+		if w.end == 0 {
+			w.end = minutesPerDay
+		}
+	}
+	if w.start == w.end {
+		return w, configerr.Errorf("/end", "", "window from %s to %s is empty", start, end)
+	}
+	if timezone != "" {
+		if w.location, err = loadLocation(timezone); err != nil {
+			return w, configerr.New("/timezone", "IANA time zone or UTC offset", err)
+		}
+	}
+	return w, nil
+}
+
+// isTimezone tells whether a field of a window string is a timezone rather than days or a time range
+func isTimezone(field string) bool {
+	upper := strings.ToUpper(field)
+	return strings.Contains(field, "/") || strings.HasPrefix(upper, "UTC") || strings.HasPrefix(upper, "GMT") ||
+		strings.EqualFold(field, "Local") || strings.HasPrefix(field, "+") || strings.HasPrefix(field, "-")
+}
+
+// loadLocation returns the location of a fixed UTC offset like UTC+8, GMT-03:30 or +05:30, or else of an
+// IANA time zone, which requires the time zone database
+func loadLocation(timezone string) (*time.Location, error) {
+	offset := timezone
+	if upper := strings.ToUpper(offset); strings.HasPrefix(upper, "UTC") || strings.HasPrefix(upper, "GMT") {
+		offset = offset[3:]
+		if offset == "" {
+			return time.UTC, nil
+		}
+	}
+	if offset == "" || (offset[0] != '+' && offset[0] != '-') {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w, IANA time zones require the plugin to import time/tzdata", err)
+		}
+		return location, nil
+	}
+	minutes, err := parseMinute(offset[1:])
+	if err != nil {
+		if hours, herr := strconv.Atoi(offset[1:]); herr == nil && hours >= 0 && hours <= 14 {
+			minutes, err = hours*60, nil
+		}
+	}
+	if err != nil || minutes > 14*60 {
+		return nil, fmt.Errorf("invalid UTC offset %q", timezone)
+	}
+	if minutes == 0 {
+		return time.UTC, nil
+	}
+	seconds := minutes * 60
+	if offset[0] == '-' {
+		seconds = -seconds
+	}
+	return time.FixedZone("UTC"+offset[:1]+formatMinute(minutes), seconds), nil
+}
+
+// addDays adds a day, a range of days like fri-mon, or * for all days
+func (w *Window) addDays(spec string) error {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "*" {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+		return nil
+	}
+	from, to, isRange := strings.Cut(spec, "-")
+	if !isRange {
+		to = from
+	}
+	first, ok := lookupDay(from)
+	last, ok2 := lookupDay(to)
+	if !ok || !ok2 {
+		return fmt.Errorf("unknown day %q", spec)
+	}
+	for day := first; ; day = (day + 1) % 7 {
+		w.days[day] = true
+		if day == last {
+			return nil
+		}
+	}
+}
+
+func lookupDay(name string) (time.Weekday, bool) {
+	if len(name) > 3 {
+		name = name[:3]
+	}
+	day, ok := dayNames[name]
+	return day, ok
+}
+
+// parseMinute parses HH:MM as the minute of the day, 24:00 is the end of the day
+func parseMinute(s string) (int, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, err
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func formatMinute(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
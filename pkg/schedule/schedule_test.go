@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestScheduleActive(t *testing.T) {
+	s, err := Parse(gjson.Parse(`[
+		"mon-fri 09:00-18:00 Asia/Shanghai",
+		{"days": ["fri-sat"], "start": "22:00", "end": "06:00"}
+	]`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		time   string
+		active bool
+	}{
+		{"2024-06-03T01:00:00Z", true},  // Monday 09:00 in Shanghai
+		{"2024-06-03T00:59:00Z", false}, // Monday 08:59 in Shanghai
+		{"2024-06-03T10:00:00Z", false}, // Monday 18:00 in Shanghai
+		{"2024-06-08T03:00:00Z", true},  // Saturday 03:00, window of Friday night
+		{"2024-06-08T23:00:00Z", true},  // Saturday 23:00
+		{"2024-06-09T05:59:00Z", true},  // Sunday 05:59, window of Saturday night
+		{"2024-06-09T06:00:00Z", false}, // Sunday 06:00
+		{"2024-06-09T23:00:00Z", false}, // Sunday night has no window
+	}
+	for _, tt := range tests {
+		now, err := time.Parse(time.RFC3339, tt.time)
+		require.NoError(t, err)
+		assert.Equal(t, tt.active, s.Active(now), tt.time)
+	}
+	assert.False(t, (&Schedule{}).Active(time.Now()))
+}
+
+func TestScheduleDefaults(t *testing.T) {
+	s, err := Parse(gjson.Parse(`"sat,sun"`))
+	require.NoError(t, err)
+	require.Len(t, s.Windows, 1)
+	assert.Equal(t, "sat,sun 00:00-24:00 UTC", s.Windows[0].String())
+
+	s, err = Parse(gjson.Parse(`{"start": "12:00"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "mon,tue,wed,thu,fri,sat,sun 12:00-24:00 UTC", s.Windows[0].String())
+}
+
+func TestScheduleEndOfDay(t *testing.T) {
+	s, err := Parse(gjson.Parse(`["mon 18:00-00:00", {"days": ["tue"], "end": "00:00"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, "mon 18:00-24:00 UTC", s.Windows[0].String())
+	assert.Equal(t, "tue 00:00-24:00 UTC", s.Windows[1].String())
+	monday := time.Date(2024, 6, 3, 23, 59, 0, 0, time.UTC)
+	assert.True(t, s.Active(monday))
+	assert.True(t, s.Active(monday.Add(time.Minute)), "tuesday")
+	assert.False(t, s.Active(monday.Add(24*time.Hour+time.Minute)), "wednesday")
+}
+
+func TestScheduleOffsets(t *testing.T) {
+	s, err := Parse(gjson.Parse(`["mon 09:00-18:00 UTC+8", "tue 09:00-18:00 -05:30", {"days": ["wed"], "timezone": "GMT"}]`))
+	require.NoError(t, err)
+	assert.Equal(t, "mon 09:00-18:00 UTC+08:00", s.Windows[0].String())
+	assert.Equal(t, "tue 09:00-18:00 UTC-05:30", s.Windows[1].String())
+	assert.Equal(t, "wed 00:00-24:00 UTC", s.Windows[2].String())
+	assert.True(t, s.Active(time.Date(2024, 6, 3, 1, 0, 0, 0, time.UTC)), "monday 09:00 at UTC+8")
+	assert.False(t, s.Active(time.Date(2024, 6, 3, 0, 59, 0, 0, time.UTC)))
+	assert.True(t, s.Active(time.Date(2024, 6, 4, 14, 30, 0, 0, time.UTC)), "tuesday 09:00 at UTC-05:30")
+	assert.False(t, s.Active(time.Date(2024, 6, 4, 14, 29, 0, 0, time.UTC)))
+
+	reparsed, err := Parse(gjson.Parse(`"` + s.Windows[1].String() + `"`))
+	require.NoError(t, err)
+	assert.Equal(t, s.Windows[1].String(), reparsed.Windows[0].String())
+}
+
+func TestScheduleJSON(t *testing.T) {
+	var config struct {
+		OffPeak Schedule `json:"offPeak"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"offPeak": ["mon-fri 20:00-08:00 Asia/Shanghai"]}`), &config))
+	out, err := json.Marshal(config)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"offPeak": ["mon,tue,wed,thu,fri 20:00-08:00 Asia/Shanghai"]}`, string(out))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		config  string
+		pointer string
+	}{
+		{`[1]`, `"/0"`},
+		{`["someday"]`, `"/0/days"`},
+		{`["mon 09:00"]`, `"/0"`},
+		{`[{"days": "mon"}]`, `"/0/days"`},
+		{`[{"start": "25:00"}]`, `"/0/start"`},
+		{`[{"end": "24:01"}]`, `"/0/end"`},
+		{`[{"timezone": "UTC+15"}]`, `"/0/timezone"`},
+		{`[{"start": "09:00", "end": "09:00"}]`, `"/0/end"`},
+		{`[{"timezone": "Mars/Olympus"}]`, `"/0/timezone"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(gjson.Parse(tt.config))
+		assert.ErrorContains(t, err, tt.pointer, tt.config)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// sweepInterval is the number of writes between two removals of the expired keys
+const sweepInterval = 1024
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time // zero if the value does not expire
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryStore keeps the values in the memory of the VM, every worker thread has its own values
+type MemoryStore struct {
+	entries map[string]*memoryEntry
+	writes  int
+	now     func() time.Time
+}
+
+// NewMemoryStore creates a store in the memory of the VM
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, now: time.Now}
+}
+
+// load returns the entry of a key, nil if it is missing or expired
+func (s *MemoryStore) load(key string, now time.Time) *memoryEntry {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.expired(now) {
+		delete(s.entries, key)
+		return nil
+	}
+	return e
+}
+
+// written counts a write and removes the expired keys every sweepInterval writes
+func (s *MemoryStore) written(now time.Time) {
+	s.writes++
+	if s.writes%sweepInterval != 0 {
+		return
+	}
+	for key, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func expiresAt(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(key string, callback func(value []byte, ok bool, err error)) error {
+	e := s.load(key, s.now())
+	if e == nil {
+		callback(nil, false, nil)
+		return nil
+	}
+	callback(e.value, true, nil)
+	return nil
+}
+
+// Set implements Store
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration, callback func(err error)) error {
+	now := s.now()
+	s.entries[key] = &memoryEntry{value: append([]byte(nil), value...), expiresAt: expiresAt(now, ttl)}
+	s.written(now)
+	if callback != nil {
+		callback(nil)
+	}
+	return nil
+}
+
+// Del implements Store
+func (s *MemoryStore) Del(key string, callback func(err error)) error {
+	delete(s.entries, key)
+	if callback != nil {
+		callback(nil)
+	}
+	return nil
+}
+
+// Incr implements Store
+func (s *MemoryStore) Incr(key string, delta int64, ttl time.Duration, callback func(value int64, err error)) error {
+	now := s.now()
+	e := s.load(key, now)
+	if e == nil {
+		e = &memoryEntry{value: []byte("0"), expiresAt: expiresAt(now, ttl)}
+	}
+	value, err := strconv.ParseInt(string(e.value), 10, 64)
+	if err != nil {
+		callback(0, fmt.Errorf("value of %s is not an integer", key))
+		return nil
+	}
+	value += delta
+	e.value = []byte(strconv.FormatInt(value, 10))
+	s.entries[key] = e
+	s.written(now)
+	callback(value, nil)
+	return nil
+}
+
+// Len returns the number of keys kept, including the expired keys not removed yet
+func (s *MemoryStore) Len() int {
+	return len(s.entries)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	now := time.UnixMilli(1_800_000_000_000)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ok := func(key string) bool {
+		found := false
+		_ = s.Get(key, func(_ []byte, ok bool, _ error) { found = ok })
+		return found
+	}
+
+	_ = s.Set("k", []byte("v"), time.Minute, nil)
+	_ = s.Incr("count", 1, time.Minute, func(int64, error) {})
+	now = now.Add(30 * time.Second)
+	// Incr keeps the expiry of the key
+	_ = s.Incr("count", 1, time.Minute, func(value int64, _ error) { assert.Equal(t, int64(2), value) })
+	assert.True(t, ok("k"))
+	now = now.Add(30 * time.Second)
+	assert.False(t, ok("k"))
+	assert.False(t, ok("count"))
+
+	// Expired keys are removed every sweepInterval writes
+	_ = s.Set("k", []byte("v"), time.Minute, nil)
+	now = now.Add(time.Minute)
+	for i := 0; s.writes%sweepInterval != sweepInterval-1; i++ {
+		_ = s.Set("persistent", []byte("v"), 0, nil)
+	}
+	assert.Equal(t, 2, s.Len())
+	_ = s.Set("persistent", []byte("v"), 0, nil)
+	assert.Equal(t, 1, s.Len())
+}
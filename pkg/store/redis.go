@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"time"
+
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// incrScript adds ARGV[1] to KEYS[1] and sets its expiry to ARGV[2] milliseconds if it is created
+const incrScript = `local created = redis.call('EXISTS', KEYS[1]) == 0
+local value = redis.call('INCRBY', KEYS[1], ARGV[1])
+if created and tonumber(ARGV[2]) > 0 then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return value`
+
+// RedisStore keeps the values in Redis, they are shared by all gateway instances
+type RedisStore struct {
+	client wrapper.RedisClient
+	prefix string
+}
+
+// NewRedisStore creates a store in Redis, under keys starting with prefix
+func NewRedisStore(client wrapper.RedisClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) key(key string) string {
+	return s.prefix + ":" + key
+}
+
+// Get implements Store
+func (s *RedisStore) Get(key string, callback func(value []byte, ok bool, err error)) error {
+	return s.client.Get(s.key(key), func(response resp.Value) {
+		if err := response.Error(); err != nil {
+			callback(nil, false, err)
+			return
+		}
+		if response.IsNull() {
+			callback(nil, false, nil)
+			return
+		}
+		callback(response.Bytes(), true, nil)
+	})
+}
+
+// Set implements Store
+func (s *RedisStore) Set(key string, value []byte, ttl time.Duration, callback func(err error)) error {
+	args := []interface{}{"set", s.key(key), string(value)}
+	if ttl > 0 {
+		args = append(args, "px", max(ttl.Milliseconds(), 1))
+	}
+	return s.client.Command(args, func(response resp.Value) {
+		if callback != nil {
+			callback(response.Error())
+		}
+	})
+}
+
+// Del implements Store
+func (s *RedisStore) Del(key string, callback func(err error)) error {
+	return s.client.Del(s.key(key), func(response resp.Value) {
+		if callback != nil {
+			callback(response.Error())
+		}
+	})
+}
+
+// Incr implements Store
+func (s *RedisStore) Incr(key string, delta int64, ttl time.Duration, callback func(value int64, err error)) error {
+	var ms int64
+	if ttl > 0 {
+		ms = max(ttl.Milliseconds(), 1)
+	}
+	return s.client.Eval(incrScript, 1, []interface{}{s.key(key)}, []interface{}{delta, ms}, func(response resp.Value) {
+		if err := response.Error(); err != nil {
+			callback(0, err)
+			return
+		}
+		callback(int64(response.Integer()), nil)
+	})
+}
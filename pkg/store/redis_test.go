@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func TestRedisStore(t *testing.T) {
+	host, reset := newTestHost()
+	defer reset()
+	client := wrapper.NewRedisClusterClient(wrapper.FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	require.NoError(t, client.Init("", "", 1000))
+	s := NewRedisStore(client, "test")
+
+	// reply replies to the last Redis callout and returns its arguments
+	reply := func(response []byte) []string {
+		callouts := host.GetRedisCalloutAttributesFromContext(proxytest.PluginContextID)
+		require.NotEmpty(t, callouts)
+		callout := callouts[len(callouts)-1]
+		values, _, err := resp.NewReader(bytes.NewReader(callout.Query)).ReadValue()
+		require.NoError(t, err)
+		var args []string
+		for _, v := range values.Array() {
+			args = append(args, v.String())
+		}
+		host.CallOnRedisCallResponse(callout.CalloutID, 0, response)
+		return args
+	}
+
+	var value []byte
+	var found bool
+	require.NoError(t, s.Get("k", func(v []byte, ok bool, err error) {
+		assert.NoError(t, err)
+		value, found = v, ok
+	}))
+	assert.Equal(t, []string{"get", "test:k"}, reply([]byte("$2\r\nv1\r\n")))
+	assert.True(t, found)
+	assert.Equal(t, "v1", string(value))
+	require.NoError(t, s.Get("missing", func(v []byte, ok bool, err error) { found = ok }))
+	reply([]byte("$-1\r\n"))
+	assert.False(t, found)
+
+	var setErr error
+	require.NoError(t, s.Set("k", []byte("v2"), 1500*time.Millisecond, func(err error) { setErr = err }))
+	assert.Equal(t, []string{"set", "test:k", "v2", "px", "1500"}, reply([]byte("+OK\r\n")))
+	assert.NoError(t, setErr)
+	require.NoError(t, s.Set("k", []byte("v3"), 0, nil))
+	assert.Equal(t, []string{"set", "test:k", "v3"}, reply([]byte("+OK\r\n")))
+	require.NoError(t, s.Del("k", func(err error) { setErr = err }))
+	assert.Equal(t, []string{"del", "test:k"}, reply([]byte("-ERR failed\r\n")))
+	assert.Error(t, setErr)
+
+	var count int64
+	require.NoError(t, s.Incr("count", 2, time.Minute, func(v int64, err error) {
+		assert.NoError(t, err)
+		count = v
+	}))
+	assert.Equal(t, []string{"eval", incrScript, "1", "test:count", "2", "60000"}, reply([]byte(":5\r\n")))
+	assert.Equal(t, int64(5), count)
+	var incrErr error
+	require.NoError(t, s.Incr("k", 1, 0, func(_ int64, err error) { incrErr = err }))
+	reply([]byte("-ERR value is not an integer or out of range\r\n"))
+	assert.ErrorContains(t, incrErr, "not an integer")
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/higress-group/wasm-go/pkg/cache"
+)
+
+// SharedStore keeps the values in the shared data of the VMs of a gateway instance with a
+// cache.SharedCache. Shared data entries cannot be removed, so the keys should be taken from a
+// bounded set.
+type SharedStore struct {
+	cache *cache.SharedCache[[]byte]
+}
+
+// NewSharedStore creates a store in shared data, under keys starting with namespace
+func NewSharedStore(namespace string) *SharedStore {
+	return &SharedStore{cache: cache.NewSharedCache[[]byte](namespace, 0)}
+}
+
+// Get implements Store
+func (s *SharedStore) Get(key string, callback func(value []byte, ok bool, err error)) error {
+	value, ok, err := s.cache.Get(key)
+	callback(value, ok, err)
+	return nil
+}
+
+// Set implements Store
+func (s *SharedStore) Set(key string, value []byte, ttl time.Duration, callback func(err error)) error {
+	err := s.cache.SetWithTTL(key, value, ttl)
+	if callback != nil {
+		callback(err)
+	}
+	return nil
+}
+
+// Del implements Store
+func (s *SharedStore) Del(key string, callback func(err error)) error {
+	err := s.cache.Delete(key)
+	if callback != nil {
+		callback(err)
+	}
+	return nil
+}
+
+// Incr implements Store. The value is read and written back with its CAS, and the increment is retried
+// when another VM updated the key in between, creating it included, so that no increment is lost.
+func (s *SharedStore) Incr(key string, delta int64, ttl time.Duration, callback func(value int64, err error)) error {
+	var result int64
+	_, err := s.cache.UpdateWithTTL(key, ttl, func(value []byte, ok bool) ([]byte, error) {
+		result = 0
+		if ok {
+			var err error
+			if result, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+				return nil, fmt.Errorf("value of %s is not an integer", key)
+			}
+		}
+		result += delta
+		return []byte(strconv.FormatInt(result, 10)), nil
+	})
+	if err != nil {
+		result = 0
+	}
+	callback(result, err)
+	return nil
+}
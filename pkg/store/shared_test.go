@@ -0,0 +1,64 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedStore(t *testing.T) {
+	_, reset := newTestHost()
+	defer reset()
+	testStore(t, NewSharedStore("test"))
+
+	// The values are shared by the VMs, under the namespace of the store
+	data, _, err := proxywasm.GetSharedData("test:count")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"e":`)
+	other := NewSharedStore("test")
+	_ = other.Get("count", func(value []byte, ok bool, err error) {
+		assert.True(t, ok)
+		assert.Equal(t, "-1", string(value))
+	})
+}
+
+func TestSharedStoreIncr(t *testing.T) {
+	_, reset := newTestHost()
+	defer reset()
+	a, b := NewSharedStore("test"), NewSharedStore("test")
+	incr := func(s *SharedStore, delta int64) int64 {
+		var result int64
+		require.NoError(t, s.Incr("hits", delta, 0, func(value int64, err error) {
+			require.NoError(t, err)
+			result = value
+		}))
+		return result
+	}
+
+	// The stores of every VM add to the same value, from the creation of the key on
+	assert.Equal(t, int64(1), incr(a, 1))
+	assert.Equal(t, int64(3), incr(b, 2))
+	assert.Equal(t, int64(4), incr(a, 1))
+
+	// A value created by another VM is added to
+	require.NoError(t, proxywasm.SetSharedData("test:other", []byte(`{"v":"NQ=="}`), 0))
+	require.NoError(t, a.Incr("other", 1, 0, func(value int64, err error) {
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), value)
+	}))
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store is a key-value store with TTLs whose backend is chosen by config, so that features
+// such as caches, quotas or nonces do not depend on where their state is kept:
+//
+//	{"backend": "redis", "serviceName": "redis.default.svc.cluster.local", "servicePort": 6379, "timeout": 1000}
+//
+// Backends are memory, state of the VM of a worker thread, shared, state shared by the VMs of a
+// gateway instance with shared data, and redis, state shared by all gateway instances. A store is
+// created in the config phase:
+//
+//	s, err := store.Parse(json.Get("store"), "my-plugin")
+//
+// and used like a Redis client, e.g. to count the requests of a consumer:
+//
+//	err := s.Incr(consumer, 1, time.Minute, func(count int64, err error) { ... })
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// Backends of the stores
+const (
+	BackendMemory = "memory"
+	BackendShared = "shared"
+	BackendRedis  = "redis"
+)
+
+const defaultRedisTimeout = 1000
+
+// Store keeps values under keys, with an optional TTL. The callbacks may be called before the methods
+// return, e.g. by the memory and shared backends, or later, e.g. by the callouts of the redis backend.
+// The callbacks of Set and Del may be nil. The methods return an error, and do not call the callback,
+// if the operation cannot be started.
+type Store interface {
+	// Get calls callback with the value of a key, ok is false if the key is missing or expired
+	Get(key string, callback func(value []byte, ok bool, err error)) error
+	// Set sets the value of a key expiring after ttl, or never if ttl is 0
+	Set(key string, value []byte, ttl time.Duration, callback func(err error)) error
+	// Del removes a key
+	Del(key string, callback func(err error)) error
+	// Incr adds delta to the integer value of a key and calls callback with the result. A missing key
+	// counts from 0 and is created expiring after ttl, or never if ttl is 0, an existing key keeps its
+	// expiry. Values that are not integers are an error.
+	Incr(key string, delta int64, ttl time.Duration, callback func(value int64, err error)) error
+}
+
+// Config configures a store, the Redis fields are only used by the redis backend
+type Config struct {
+	Backend     string `json:"backend"`     // memory (the default), shared or redis
+	ServiceName string `json:"serviceName"` // FQDN of the Redis service, e.g. redis.default.svc.cluster.local
+	ServicePort int64  `json:"servicePort"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Database    int    `json:"database"`
+	Timeout     int64  `json:"timeout"`   // Milliseconds, defaults to 1000
+	KeyPrefix   string `json:"keyPrefix"` // Defaults to the namespace of the store
+}
+
+// ParseConfig validates a store config, a missing config is the memory backend
+func ParseConfig(json gjson.Result) (*Config, error) {
+	config := &Config{}
+	if json.Exists() {
+		if err := configerr.DecodeJSON("", []byte(json.Raw), config); err != nil {
+			return nil, err
+		}
+	}
+	switch config.Backend {
+	case "":
+		config.Backend = BackendMemory
+	case BackendMemory, BackendShared:
+	case BackendRedis:
+		if config.ServiceName == "" {
+			return nil, configerr.New("/serviceName", "string", errors.New("redis store serviceName is required"))
+		}
+		if config.ServicePort <= 0 {
+			return nil, configerr.New("/servicePort", "positive integer", errors.New("redis store servicePort is required"))
+		}
+		if config.Timeout <= 0 {
+			config.Timeout = defaultRedisTimeout
+		}
+	default:
+		return nil, configerr.Errorf("/backend", "memory, shared or redis", "unknown store backend %q", config.Backend)
+	}
+	return config, nil
+}
+
+// New creates the store of a config, the keys start with the key prefix or namespace, e.g. the
+// name of the plugin. The Redis client is initialized, so it must be called in the config phase.
+func New(config *Config, namespace string) (Store, error) {
+	prefix := config.KeyPrefix
+	if prefix == "" {
+		prefix = namespace
+	}
+	switch config.Backend {
+	case BackendShared:
+		return NewSharedStore(prefix), nil
+	case BackendRedis:
+		client := wrapper.NewRedisClusterClient(wrapper.FQDNCluster{FQDN: config.ServiceName, Port: config.ServicePort})
+		if err := client.Init(config.Username, config.Password, config.Timeout, wrapper.WithDataBase(config.Database)); err != nil {
+			return nil, fmt.Errorf("failed to init store redis client: %w", err)
+		}
+		return NewRedisStore(client, prefix), nil
+	default:
+		return NewMemoryStore(), nil
+	}
+}
+
+// Parse parses a store config and creates its store, see ParseConfig and New
+func Parse(json gjson.Result, namespace string) (Store, error) {
+	config, err := ParseConfig(json)
+	if err != nil {
+		return nil, err
+	}
+	return New(config, namespace)
+}
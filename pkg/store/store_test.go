@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func newTestHost() (proxytest.HostEmulator, func()) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(wrapper.NewCommonVmCtx[struct{}]("store-test")))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	return host, reset
+}
+
+// testStore tests the operations of the backends that call back before returning
+func testStore(t *testing.T, s Store) {
+	get := func(key string) (string, bool) {
+		var value []byte
+		var found bool
+		require.NoError(t, s.Get(key, func(v []byte, ok bool, err error) {
+			require.NoError(t, err)
+			value, found = v, ok
+		}))
+		return string(value), found
+	}
+	incr := func(key string, delta int64) (int64, error) {
+		var value int64
+		var incrErr error
+		require.NoError(t, s.Incr(key, delta, time.Minute, func(v int64, err error) { value, incrErr = v, err }))
+		return value, incrErr
+	}
+
+	_, ok := get("k")
+	assert.False(t, ok)
+	require.NoError(t, s.Set("k", []byte("v1"), 0, func(err error) { assert.NoError(t, err) }))
+	value, ok := get("k")
+	assert.True(t, ok)
+	assert.Equal(t, "v1", value)
+	require.NoError(t, s.Del("k", nil))
+	_, ok = get("k")
+	assert.False(t, ok)
+
+	count, err := incr("count", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	count, err = incr("count", -3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), count)
+	value, _ = get("count")
+	assert.Equal(t, "-1", value)
+
+	require.NoError(t, s.Set("k", []byte("v1"), 0, nil))
+	_, err = incr("k", 1)
+	assert.Error(t, err)
+	value, _ = get("k")
+	assert.Equal(t, "v1", value, "a failed Incr writes nothing")
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(gjson.Result{})
+	require.NoError(t, err)
+	assert.Equal(t, BackendMemory, config.Backend)
+
+	config, err = ParseConfig(gjson.Parse(`{"backend": "redis", "serviceName": "redis.default.svc.cluster.local", "servicePort": 6379}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultRedisTimeout), config.Timeout)
+
+	for raw, pointer := range map[string]string{
+		`{"backend": "etcd"}`:  "/backend",
+		`{"backend": "redis"}`: "/serviceName",
+		`{"backend": "redis", "serviceName": "redis.default"}`: "/servicePort",
+		`{"backend": "shared", "keyPrefix": 1}`:                "/keyPrefix",
+	} {
+		var cfgErr *configerr.Error
+		_, err := ParseConfig(gjson.Parse(raw))
+		if assert.ErrorAs(t, err, &cfgErr, raw) {
+			assert.Equal(t, pointer, cfgErr.Pointer, raw)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	_, reset := newTestHost()
+	defer reset()
+
+	s, err := Parse(gjson.Result{}, "test")
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = Parse(gjson.Parse(`{"backend": "shared", "keyPrefix": "custom"}`), "test")
+	require.NoError(t, err)
+	require.NoError(t, s.Set("k", []byte("v"), 0, nil))
+	_, ok, err := NewSharedStore("custom").cache.Get("k")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	s, err = Parse(gjson.Parse(`{"backend": "redis", "serviceName": "redis.default.svc.cluster.local", "servicePort": 6379}`), "test")
+	require.NoError(t, err)
+	assert.Equal(t, "test", s.(*RedisStore).prefix)
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package streamjson reconstructs a JSON body delivered in chunks, e.g. a large non-streaming LLM
+// response read in onHttpStreamingResponseBody, and tells as soon as the values of given paths are
+// complete, without waiting for the end of the body:
+//
+//	acc := streamjson.New()
+//	acc.Watch("model", func(value gjson.Result) {
+//		ctx.SetUserAttribute("model", value.String())
+//	})
+//	ctx.SetContext("acc", acc)
+//
+//	// onHttpStreamingResponseBody
+//	acc := ctx.GetContext("acc").(*streamjson.Accumulator)
+//	if err := acc.Write(chunk); err != nil {
+//		log.Warnf("invalid response body: %v", err)
+//	}
+//
+// Paths are gjson paths of values, such as choices.0.message.content, without wildcards or queries.
+package streamjson
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// frame is an object or array being parsed
+type frame struct {
+	array bool
+	path  string // path of the object or array
+	start int    // offset of the opening bracket
+	key   string // key of the current member of an object, escaped for gjson paths
+	index int    // index of the current element of an array
+}
+
+// Accumulator accumulates the chunks of a JSON value and tracks the values completed so far
+type Accumulator struct {
+	buf   []byte
+	pos   int
+	stack []frame
+
+	inString    bool
+	escaped     bool
+	stringIsKey bool
+	valueStart  int
+	inScalar    bool
+	expectKey   bool
+
+	complete bool
+	err      error
+	watches  map[string][]func(value gjson.Result)
+	done     map[string]bool
+}
+
+// New creates an empty accumulator
+func New() *Accumulator {
+	return &Accumulator{watches: map[string][]func(value gjson.Result){}, done: map[string]bool{}}
+}
+
+// Watch calls f with the value at path once it is complete, f may be nil to only track it with
+// Completed. f is called at once if the value is already complete.
+func (a *Accumulator) Watch(path string, f func(value gjson.Result)) {
+	a.watches[path] = append(a.watches[path], f)
+	if !a.done[path] && a.completedBefore(path) {
+		a.done[path] = true
+	}
+	if a.done[path] && f != nil {
+		f(a.Get(path))
+	}
+}
+
+// completedBefore tells whether the value at a path not watched yet was already received entirely
+func (a *Accumulator) completedBefore(path string) bool {
+	if a.complete || path == "" {
+		return a.complete
+	}
+	if !a.Get(path).Exists() {
+		return false
+	}
+	if (a.inString && !a.stringIsKey) || a.inScalar {
+		if a.path() == path {
+			return false
+		}
+	}
+	for _, f := range a.stack {
+		if f.path == path {
+			return false
+		}
+	}
+	return true
+}
+
+// Completed tells whether the value at a watched path is complete
+func (a *Accumulator) Completed(path string) bool {
+	return a.done[path]
+}
+
+// Complete tells whether the whole JSON value has been received
+func (a *Accumulator) Complete() bool {
+	return a.complete
+}
+
+// Bytes returns the bytes received so far
+func (a *Accumulator) Bytes() []byte {
+	return a.buf
+}
+
+// Get queries the bytes received so far, values not received entirely may be missing or truncated
+func (a *Accumulator) Get(path string) gjson.Result {
+	return gjson.GetBytes(a.buf, path)
+}
+
+// Write adds a chunk and calls the watches of the values it completes. It fails once the bytes are
+// not valid JSON, the later chunks are then only accumulated.
+func (a *Accumulator) Write(chunk []byte) error {
+	a.buf = append(a.buf, chunk...)
+	if a.err != nil {
+		return a.err
+	}
+	for ; a.pos < len(a.buf); a.pos++ {
+		if a.err = a.scan(a.pos, a.buf[a.pos]); a.err != nil {
+			return a.err
+		}
+	}
+	return nil
+}
+
+func (a *Accumulator) scan(i int, c byte) error {
+	if a.inString {
+		switch {
+		case a.escaped:
+			a.escaped = false
+		case c == '\\':
+			a.escaped = true
+		case c == '"':
+			a.inString = false
+			if a.stringIsKey {
+				top := &a.stack[len(a.stack)-1]
+				top.key = gjson.Escape(gjson.ParseBytes(a.buf[a.valueStart : i+1]).String())
+				return nil
+			}
+			a.completeValue(a.valueStart, i+1)
+		}
+		return nil
+	}
+	if a.inScalar {
+		if !isDelimiter(c) {
+			return nil
+		}
+		a.inScalar = false
+		a.completeValue(a.valueStart, i)
+	}
+	if a.complete {
+		if isSpace(c) {
+			return nil
+		}
+		return fmt.Errorf("unexpected %q after the end of the JSON value at offset %d", c, i)
+	}
+	switch {
+	case isSpace(c), c == ':':
+	case c == '"':
+		a.inString = true
+		a.stringIsKey = a.expectKey
+		a.expectKey = false
+		a.valueStart = i
+	case c == '{' || c == '[':
+		a.stack = append(a.stack, frame{array: c == '[', path: a.path(), start: i})
+		a.expectKey = c == '{'
+	case c == '}' || c == ']':
+		if len(a.stack) == 0 || a.stack[len(a.stack)-1].array != (c == ']') {
+			return fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+		top := a.stack[len(a.stack)-1]
+		a.stack = a.stack[:len(a.stack)-1]
+		a.expectKey = false
+		a.completeValue(top.start, i+1)
+	case c == ',':
+		if len(a.stack) == 0 {
+			return fmt.Errorf("unexpected ',' at offset %d", i)
+		}
+		top := &a.stack[len(a.stack)-1]
+		if top.array {
+			top.index++
+		} else {
+			a.expectKey = true
+		}
+	case c == '-' || c == 't' || c == 'f' || c == 'n' || (c >= '0' && c <= '9'):
+		a.inScalar = true
+		a.valueStart = i
+	default:
+		return fmt.Errorf("unexpected %q at offset %d", c, i)
+	}
+	return nil
+}
+
+// completeValue records the value between start and end at the current path
+func (a *Accumulator) completeValue(start, end int) {
+	if len(a.stack) == 0 {
+		a.complete = true
+	}
+	path := a.path()
+	if _, watched := a.watches[path]; !watched || a.done[path] {
+		return
+	}
+	a.done[path] = true
+	value := gjson.ParseBytes(a.buf[start:end])
+	for _, f := range a.watches[path] {
+		if f != nil {
+			f(value)
+		}
+	}
+}
+
+// path returns the gjson path of the current value
+func (a *Accumulator) path() string {
+	parts := make([]string, 0, len(a.stack))
+	for _, f := range a.stack {
+		if f.array {
+			parts = append(parts, strconv.Itoa(f.index))
+		} else {
+			parts = append(parts, f.key)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// Finish ends the body: a number at the very end is completed, and an error is returned if the value
+// is not complete
+func (a *Accumulator) Finish() error {
+	if a.err != nil {
+		return a.err
+	}
+	if a.inScalar {
+		a.inScalar = false
+		a.completeValue(a.valueStart, len(a.buf))
+	}
+	if !a.complete {
+		return errIncomplete
+	}
+	return nil
+}
+
+var errIncomplete = errors.New("incomplete JSON value")
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isDelimiter(c byte) bool {
+	return isSpace(c) || c == ',' || c == '}' || c == ']'
+}
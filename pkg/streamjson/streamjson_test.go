@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streamjson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const completion = `{"id":"chatcmpl-1","model":"qwen-max","choices":[{"index":0,"message":{"role":"assistant","content":"he said \"hi\" }"}}],` +
+	`"usage":{"prompt_tokens":10,"completion_tokens":-2.5e1,"total_tokens":true},"a.b":[[1,2],null]}`
+
+func TestAccumulatorByteByByte(t *testing.T) {
+	acc := New()
+	var completed []string
+	watch := func(path string) {
+		acc.Watch(path, func(value gjson.Result) {
+			completed = append(completed, path+"="+value.Raw)
+			// The value is complete before the rest of the body is received
+			assert.False(t, acc.Complete())
+		})
+	}
+	watch("model")
+	watch("choices.0.message.content")
+	watch("choices.0")
+	watch("usage.completion_tokens")
+	watch(`a\.b.0.1`)
+	acc.Watch("", nil)
+
+	for i := 0; i < len(completion); i++ {
+		require.NoError(t, acc.Write([]byte{completion[i]}))
+		if i == len(completion)-2 {
+			assert.False(t, acc.Completed(""))
+		}
+	}
+	require.NoError(t, acc.Finish())
+	assert.True(t, acc.Complete())
+	assert.True(t, acc.Completed(""))
+	assert.Equal(t, []string{
+		`model="qwen-max"`,
+		`choices.0.message.content="he said \"hi\" }"`,
+		`choices.0={"index":0,"message":{"role":"assistant","content":"he said \"hi\" }"}}`,
+		`usage.completion_tokens=-2.5e1`,
+		`a\.b.0.1=2`,
+	}, completed)
+	assert.Equal(t, int64(10), acc.Get("usage.prompt_tokens").Int())
+}
+
+func TestAccumulatorPartialQueries(t *testing.T) {
+	acc := New()
+	require.NoError(t, acc.Write([]byte(`{"model":"qwen","choices":[{"message":{"content":"par`)))
+	assert.Equal(t, "qwen", acc.Get("model").String())
+	assert.False(t, acc.Complete())
+	assert.ErrorIs(t, acc.Finish(), errIncomplete)
+
+	// Values completed before they are watched are reported at once
+	var model, content string
+	acc.Watch("model", func(value gjson.Result) { model = value.String() })
+	assert.Equal(t, "qwen", model)
+	acc.Watch("choices.0.message.content", func(value gjson.Result) { content = value.String() })
+	acc.Watch("choices.0", nil)
+	assert.Empty(t, content)
+	require.NoError(t, acc.Write([]byte(`tial"}`)))
+	assert.Equal(t, "partial", content)
+	assert.False(t, acc.Completed("choices.0"))
+	require.NoError(t, acc.Write([]byte(`}]}`)))
+	require.NoError(t, acc.Finish())
+	assert.True(t, acc.Completed("choices.0"))
+}
+
+func TestAccumulatorScalarRoot(t *testing.T) {
+	acc := New()
+	acc.Watch("", nil)
+	require.NoError(t, acc.Write([]byte("12")))
+	require.NoError(t, acc.Write([]byte("3")))
+	assert.False(t, acc.Completed(""))
+	require.NoError(t, acc.Finish())
+	assert.True(t, acc.Completed(""))
+}
+
+func TestAccumulatorInvalid(t *testing.T) {
+	for _, body := range []string{`{"a":1]`, `]`, `{"a":1} x`, `{"a":?}`} {
+		acc := New()
+		assert.Error(t, acc.Write([]byte(body)), body)
+		assert.Error(t, acc.Finish(), body)
+	}
+}
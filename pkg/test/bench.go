@@ -0,0 +1,54 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// BenchHost runs requests in a benchmark loop. The plugin is started once and every iteration
+// reuses the same warm HTTP context, so the loop measures the request handling of the plugin
+// rather than the setup of the host. Plugins keeping state in the context across phases see the
+// state of the previous iteration.
+type BenchHost struct {
+	*testHost
+	b *testing.B
+}
+
+// NewBenchHost starts the plugin with the config, the host is reset when the benchmark ends
+func NewBenchHost(b *testing.B, config json.RawMessage, opts ...HostOptionFunc) *BenchHost {
+	b.Helper()
+	host, status := NewTestHostWithOptions(config, opts...)
+	b.Cleanup(host.Reset)
+	if status != types.OnPluginStartStatusOK {
+		b.Fatalf("plugin failed to start, status: %v", status)
+	}
+	return &BenchHost{testHost: host.(*testHost), b: b}
+}
+
+// MockCallout answers every HTTP callout to the upstream with the response, see ExpectCallout
+func (h *BenchHost) MockCallout(upstream string, headers [][2]string, body []byte) *CalloutExpectation {
+	return h.ExpectCallout(h.b, upstream).AnyTimes().Respond(headers, body)
+}
+
+// Run reports allocations and calls f b.N times, the setup before Run is not measured
+func (h *BenchHost) Run(f func()) {
+	h.b.ReportAllocs()
+	h.b.ResetTimer()
+	for i := 0; i < h.b.N; i++ {
+		f()
+		// Answered callouts do not need to be remembered, their IDs are not reused
+		h.seenCallouts = nil
+	}
+	h.b.StopTimer()
+}
+
+// RunRequest measures a request with the headers and the body, a nil body ends the request with the headers
+func (h *BenchHost) RunRequest(headers [][2]string, body []byte) {
+	h.Run(func() {
+		if h.CallOnHttpRequestHeaders(headers, WithEndOfStream(body == nil)) == types.ActionContinue && body != nil {
+			h.CallOnHttpRequestBody(body)
+		}
+	})
+}
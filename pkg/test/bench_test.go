@@ -0,0 +1,45 @@
+package test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func TestBenchHost(t *testing.T) {
+	var headerCalls, bodyCalls, callouts int
+	client := wrapper.NewClusterClient(wrapper.FQDNCluster{FQDN: "auth.example.com", Port: 80})
+	setTestVMContext(wrapper.NewCommonVmCtx("bench-host",
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			headerCalls++
+			return types.ActionContinue
+		}),
+		wrapper.ProcessRequestBody(func(ctx wrapper.HttpContext, config struct{}, body []byte) types.Action {
+			bodyCalls++
+			client.Post("/auth", nil, body, func(statusCode int, _ http.Header, _ []byte) {
+				callouts++
+				proxywasm.ResumeHttpRequest()
+			})
+			return types.ActionPause
+		})))
+	defer clearTestVMContext()
+
+	var n int
+	result := testing.Benchmark(func(b *testing.B) {
+		host := NewBenchHost(b, []byte(`{}`))
+		host.MockCallout("outbound|80||auth.example.com", [][2]string{{":status", "200"}}, nil)
+		host.RunRequest([][2]string{{":authority", "example.com"}, {":path", "/"}, {":method", "POST"}}, []byte(`{}`))
+		assert.Equal(b, types.ActionContinue, host.GetHttpStreamAction())
+		n += b.N
+	})
+	assert.NotZero(t, n)
+	assert.Equal(t, n, headerCalls)
+	assert.Equal(t, n, bodyCalls)
+	assert.Equal(t, n, callouts)
+	assert.NotZero(t, result.AllocsPerOp())
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+const (
+	// maxTraceEntries is the number of host calls kept for the debug dump of a test host
+	maxTraceEntries = 100
+	// maxDumpLogs is the number of most recent logs of each level in the debug dump
+	maxDumpLogs = 20
+	// maxDumpBody is the number of bytes of a body shown in the debug dump
+	maxDumpBody = 2048
+)
+
+// debugHosts are the test hosts created by the running wasm mode test, nil outside of wasm mode.
+// It is guarded by testMutex like testVMContext.
+var debugHosts []*testHost
+
+// startWasmDebug records the test hosts created by a wasm mode test. The returned function
+// dumps their state to the test output if the test failed, since wasm mode failures cannot be
+// inspected with a debugger.
+func startWasmDebug(t *testing.T) func() {
+	debugHosts = []*testHost{}
+	return func() {
+		hosts := debugHosts
+		debugHosts = nil
+		if !t.Failed() {
+			return
+		}
+		for i, h := range hosts {
+			dump := h.debugDump
+			if dump == "" {
+				dump = h.debugState()
+			}
+			t.Logf("wasm mode test failed, state of test host %d:\n%s", i, dump)
+		}
+	}
+}
+
+// tracef records a call made by the test host into the plugin
+func (h *testHost) tracef(format string, args ...interface{}) {
+	if len(h.trace) >= maxTraceEntries {
+		h.trace = h.trace[1:]
+	}
+	h.trace = append(h.trace, fmt.Sprintf(format, args...))
+}
+
+// traceAction records a call that returned an action
+func (h *testHost) traceAction(call, args string, action types.Action) {
+	h.tracef("%s(%s) -> %s", call, args, actionName(action))
+}
+
+// debugState describes the host calls, the current request and the plugin logs
+func (h *testHost) debugState() string {
+	var b strings.Builder
+	b.WriteString("host calls:\n")
+	for _, entry := range h.trace {
+		fmt.Fprintf(&b, "  %s\n", entry)
+	}
+	if h.currentContextID != 0 {
+		fmt.Fprintf(&b, "request headers: %v\n", h.GetRequestHeaders())
+		fmt.Fprintf(&b, "request body: %s\n", truncate(string(h.GetRequestBody())))
+		fmt.Fprintf(&b, "response headers: %v\n", h.GetResponseHeaders())
+		fmt.Fprintf(&b, "response body: %s\n", truncate(string(h.GetResponseBody())))
+		if local := h.GetLocalResponse(); local != nil {
+			fmt.Fprintf(&b, "local response: %d %v %s\n", local.StatusCode, local.Headers, truncate(string(local.Data)))
+		}
+		for _, callout := range h.HostEmulator.GetCalloutAttributesFromContext(h.currentContextID) {
+			fmt.Fprintf(&b, "pending %s\n", describeCallout(callout))
+		}
+		for _, callout := range h.HostEmulator.GetRedisCalloutAttributesFromContext(h.currentContextID) {
+			fmt.Fprintf(&b, "pending redis callout to %s: %q\n", callout.Upstream, callout.Query)
+		}
+	}
+	for _, level := range []struct {
+		name string
+		logs []string
+	}{
+		{"trace", h.GetTraceLogs()},
+		{"debug", h.GetDebugLogs()},
+		{"info", h.GetInfoLogs()},
+		{"warn", h.GetWarnLogs()},
+		{"error", h.GetErrorLogs()},
+		{"critical", h.GetCriticalLogs()},
+	} {
+		logs := level.logs
+		if len(logs) == 0 {
+			continue
+		}
+		if len(logs) > maxDumpLogs {
+			logs = logs[len(logs)-maxDumpLogs:]
+		}
+		fmt.Fprintf(&b, "%s logs (%d most recent):\n", level.name, len(logs))
+		for _, l := range logs {
+			fmt.Fprintf(&b, "  %s\n", l)
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string) string {
+	if len(s) > maxDumpBody {
+		return fmt.Sprintf("%s... (%d bytes)", s[:maxDumpBody], len(s))
+	}
+	return s
+}
+
+func actionName(action types.Action) string {
+	switch action {
+	case types.ActionContinue:
+		return "Continue"
+	case types.ActionPause:
+		return "Pause"
+	}
+	return fmt.Sprintf("Action(%d)", action)
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWasmDebugDump(t *testing.T) {
+	setTestVMContext(calloutChainPlugin())
+	defer clearTestVMContext()
+	done := startWasmDebug(t)
+
+	host, _ := NewTestHost([]byte(`{}`))
+	host.CallOnHttpRequestHeaders([][2]string{{":authority", "example.com"}, {":path", "/orders"}})
+	host.CallOnHttpCall([][2]string{{":status", "200"}}, []byte("authorized"))
+	host.Reset()
+
+	if assert.Len(t, debugHosts, 1) {
+		dump := debugHosts[0].debugDump
+		assert.Contains(t, dump, "CallOnHttpRequestHeaders([[:authority example.com] [:path /orders]]) -> Pause")
+		assert.Contains(t, dump, "CallOnHttpCall([[:status 200]], authorized)")
+		assert.Contains(t, dump, "request headers: [[:authority example.com] [:path /orders]")
+		assert.Contains(t, dump, "pending callout GET to outbound|80||auth.example.com /profile")
+		assert.Contains(t, dump, "http call end")
+	}
+	done()
+	assert.Nil(t, debugHosts)
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+)
+
+// CalloutExpectation is an HTTP callout the plugin is expected to make, created by TestHost.ExpectCallout.
+// Once a test has expectations, every HTTP callout of the current request must match one of them.
+type CalloutExpectation struct {
+	t               testing.TB
+	upstream        string
+	method          string
+	path            string
+	times           int
+	matched         int
+	respond         bool
+	responseHeaders [][2]string
+	responseBody    []byte
+}
+
+// WithMethod only matches callouts with the given method
+func (e *CalloutExpectation) WithMethod(method string) *CalloutExpectation {
+	e.method = method
+	return e
+}
+
+// WithPath only matches callouts with the given path, including the query string
+func (e *CalloutExpectation) WithPath(path string) *CalloutExpectation {
+	e.path = path
+	return e
+}
+
+// Times sets how many matching callouts are expected, default 1
+func (e *CalloutExpectation) Times(n int) *CalloutExpectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes allows any number of matching callouts, including none
+func (e *CalloutExpectation) AnyTimes() *CalloutExpectation {
+	e.times = -1
+	return e
+}
+
+// Respond answers matching callouts right away. Callouts of expectations without a response
+// stay pending until the test answers them, e.g. with CallOnHttpCall.
+func (e *CalloutExpectation) Respond(headers [][2]string, body []byte) *CalloutExpectation {
+	e.respond = true
+	e.responseHeaders = headers
+	e.responseBody = body
+	return e
+}
+
+func (e *CalloutExpectation) String() string {
+	s := "callout"
+	if e.method != "" {
+		s += " " + e.method
+	}
+	if e.upstream != "" {
+		s += " to " + e.upstream
+	}
+	if e.path != "" {
+		s += " " + e.path
+	}
+	return s
+}
+
+func (e *CalloutExpectation) matches(callout proxytest.HttpCalloutAttribute) bool {
+	if e.times >= 0 && e.matched >= e.times {
+		return false
+	}
+	if e.upstream != "" && e.upstream != callout.Upstream {
+		return false
+	}
+	if e.method != "" && !HasHeaderWithValue(callout.Headers, ":method", e.method) {
+		return false
+	}
+	if e.path != "" && !HasHeaderWithValue(callout.Headers, ":path", e.path) {
+		return false
+	}
+	return true
+}
+
+func (e *CalloutExpectation) verify() {
+	e.t.Helper()
+	if e.times >= 0 && e.matched < e.times {
+		e.t.Errorf("expected %s %d time(s), got %d", e, e.times, e.matched)
+	}
+}
+
+// ExpectCallout expects an HTTP callout to the upstream, e.g. "outbound|80||httpbin.org", an empty
+// upstream matches any. The test fails on callouts matching no expectation, and when it ends
+// with expectations that have not been met.
+func (h *testHost) ExpectCallout(t testing.TB, upstream string) *CalloutExpectation {
+	e := &CalloutExpectation{t: t, upstream: upstream, times: 1}
+	h.expectations = append(h.expectations, e)
+	h.expectT = t
+	t.Cleanup(e.verify)
+	return e
+}
+
+// checkCallouts matches the new callouts of the current request against the expectations,
+// answering them as long as the responses lead to further callouts.
+func (h *testHost) checkCallouts() {
+	if len(h.expectations) == 0 || !h.currentContextValid {
+		return
+	}
+	if h.seenCallouts == nil {
+		h.seenCallouts = make(map[uint32]bool)
+	}
+	for {
+		var responses []proxytest.HttpCalloutAttribute
+		var expectations []*CalloutExpectation
+		for _, callout := range h.HostEmulator.GetCalloutAttributesFromContext(h.currentContextID) {
+			if h.seenCallouts[callout.CalloutID] {
+				continue
+			}
+			h.seenCallouts[callout.CalloutID] = true
+			e := h.matchCallout(callout)
+			if e == nil {
+				h.expectT.Errorf("unexpected %s", describeCallout(callout))
+				continue
+			}
+			e.matched++
+			if e.respond {
+				responses = append(responses, callout)
+				expectations = append(expectations, e)
+			}
+		}
+		if len(responses) == 0 {
+			return
+		}
+		for i, callout := range responses {
+			h.HostEmulator.CallOnHttpCallResponse(callout.CalloutID, expectations[i].responseHeaders, nil, expectations[i].responseBody)
+		}
+	}
+}
+
+func (h *testHost) matchCallout(callout proxytest.HttpCalloutAttribute) *CalloutExpectation {
+	for _, e := range h.expectations {
+		if e.matches(callout) {
+			return e
+		}
+	}
+	return nil
+}
+
+func describeCallout(callout proxytest.HttpCalloutAttribute) string {
+	method, _ := GetHeaderValue(callout.Headers, ":method")
+	path, _ := GetHeaderValue(callout.Headers, ":path")
+	return fmt.Sprintf("callout %s to %s %s", method, callout.Upstream, path)
+}
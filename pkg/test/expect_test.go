@@ -0,0 +1,96 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// recordingT records the failures and cleanups of a test that is expected to fail
+type recordingT struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordingT) finish() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+
+// calloutChainPlugin authenticates every request with a callout to /auth, followed by a callout to /profile
+func calloutChainPlugin() types.VMContext {
+	client := wrapper.NewClusterClient(wrapper.FQDNCluster{FQDN: "auth.example.com", Port: 80})
+	return wrapper.NewCommonVmCtx("callout-chain", wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+		client.Get("/auth", nil, func(statusCode int, _ http.Header, _ []byte) {
+			if statusCode != http.StatusOK {
+				proxywasm.SendHttpResponse(http.StatusUnauthorized, nil, nil, -1)
+				return
+			}
+			client.Get("/profile", nil, func(int, http.Header, []byte) {
+				proxywasm.ResumeHttpRequest()
+			})
+		})
+		return types.ActionPause
+	}))
+}
+
+func TestExpectCallout(t *testing.T) {
+	setTestVMContext(calloutChainPlugin())
+	defer clearTestVMContext()
+	headers := [][2]string{{":authority", "example.com"}, {":path", "/"}}
+
+	t.Run("responses are chained", func(t *testing.T) {
+		host, status := NewTestHost([]byte(`{}`))
+		require.Equal(t, types.OnPluginStartStatusOK, status)
+		defer host.Reset()
+
+		host.ExpectCallout(t, "outbound|80||auth.example.com").WithMethod("GET").WithPath("/auth").Respond([][2]string{{":status", "200"}}, nil)
+		host.ExpectCallout(t, "").WithPath("/profile").Respond([][2]string{{":status", "200"}}, nil)
+		assert.Equal(t, types.ActionPause, host.CallOnHttpRequestHeaders(headers))
+		assert.Equal(t, types.ActionContinue, host.GetHttpStreamAction())
+	})
+
+	t.Run("pending callouts are answered by the test", func(t *testing.T) {
+		host, _ := NewTestHost([]byte(`{}`))
+		defer host.Reset()
+
+		host.ExpectCallout(t, "").WithPath("/auth")
+		host.CallOnHttpRequestHeaders(headers)
+		host.CallOnHttpCall([][2]string{{":status", "403"}}, nil)
+		assert.Equal(t, uint32(http.StatusUnauthorized), host.GetLocalResponse().StatusCode)
+	})
+
+	t.Run("unexpected and missing callouts fail the test", func(t *testing.T) {
+		host, _ := NewTestHost([]byte(`{}`))
+		defer host.Reset()
+
+		rt := &recordingT{TB: t}
+		host.ExpectCallout(rt, "").WithPath("/auth").Respond([][2]string{{":status", "200"}}, nil)
+		host.ExpectCallout(rt, "").WithPath("/auth").Times(2)
+		host.CallOnHttpRequestHeaders(headers)
+		rt.finish()
+		assert.Equal(t, []string{
+			"unexpected callout GET to outbound|80||auth.example.com /profile",
+			"expected callout /auth 2 time(s), got 0",
+		}, rt.errors)
+	})
+}
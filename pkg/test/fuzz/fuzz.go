@@ -0,0 +1,157 @@
+// Package fuzz wires Go fuzzing into the entry points of a plugin, so that panics of plugin code
+// parsing headers and bodies are found in go mode tests. A fuzz test only needs the plugin config
+// and a few seed inputs:
+//
+//	func FuzzRequestBody(f *testing.F) {
+//		headers := [][2]string{{":authority", "example.com"}, {":method", "POST"}, {":path", "/v1/chat/completions"}}
+//		fuzz.New(config).RequestBody(f, headers, []byte(`{"model":"qwen"}`))
+//	}
+//
+// Run it with go test -fuzz=FuzzRequestBody. Panics fail the input with the stack of the plugin,
+// and the fuzzing engine minimizes the input and stores it in testdata/fuzz/FuzzRequestBody, where
+// it is replayed by every later go test run until the plugin is fixed.
+package fuzz
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/test"
+)
+
+// maxReportedInput is the number of bytes of an input shown when it fails
+const maxReportedInput = 1024
+
+// Harness runs fuzzed inputs against the plugin of the package under test in go mode
+type Harness struct {
+	config json.RawMessage
+	opts   []test.HostOptionFunc
+}
+
+// New creates a harness starting the plugin with the config, opts set up its test host
+func New(config json.RawMessage, opts ...test.HostOptionFunc) *Harness {
+	return &Harness{config: config, opts: opts}
+}
+
+// RequestHeaders fuzzes the request headers, the seeds are header lists the fuzzer mutates
+func (h *Harness) RequestHeaders(f *testing.F, seeds ...[][2]string) {
+	f.Helper()
+	for _, seed := range seeds {
+		f.Add(EncodeHeaders(seed))
+	}
+	f.Fuzz(func(t *testing.T, encoded string) {
+		headers := DecodeHeaders(encoded)
+		h.Run(t, fmt.Sprintf("request headers %q", headers), func(host test.TestHost) {
+			if host.CallOnHttpRequestHeaders(headers, test.WithEndOfStream(true)) == types.ActionContinue {
+				host.CallOnHttpResponseHeaders([][2]string{{":status", "200"}})
+			}
+		})
+	})
+}
+
+// RequestBody fuzzes the request body sent after the headers, the body is passed in a single call
+func (h *Harness) RequestBody(f *testing.F, headers [][2]string, seeds ...[]byte) {
+	f.Helper()
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		h.Run(t, "request body "+quote(body), func(host test.TestHost) {
+			if host.CallOnHttpRequestHeaders(headers) == types.ActionContinue {
+				host.CallOnHttpRequestBody(body)
+			}
+		})
+	})
+}
+
+// ResponseBody fuzzes the response body of a request with the request headers and the response headers
+func (h *Harness) ResponseBody(f *testing.F, requestHeaders, responseHeaders [][2]string, seeds ...[]byte) {
+	f.Helper()
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		h.Run(t, "response body "+quote(body), func(host test.TestHost) {
+			if host.CallOnHttpRequestHeaders(requestHeaders, test.WithEndOfStream(true)) != types.ActionContinue {
+				return
+			}
+			if host.CallOnHttpResponseHeaders(responseHeaders) == types.ActionContinue {
+				host.CallOnHttpResponseBody(body)
+			}
+		})
+	})
+}
+
+// MCPRequest fuzzes the JSON-RPC messages posted to the MCP endpoint of the host, e.g. "/mcp"
+func (h *Harness) MCPRequest(f *testing.F, host, path string, seeds ...[]byte) {
+	f.Helper()
+	h.RequestBody(f, [][2]string{
+		{":authority", host},
+		{":method", "POST"},
+		{":path", path},
+		{"content-type", "application/json"},
+		{"accept", "application/json, text/event-stream"},
+	}, seeds...)
+}
+
+// Run starts a test host, calls the plugin with one input and completes the request. A panic of the
+// plugin fails t with the input, described by desc, and the stack of the panic.
+func (h *Harness) Run(t testing.TB, desc string, call func(host test.TestHost)) {
+	t.Helper()
+	host, status := test.NewTestHostWithOptions(h.config, h.opts...)
+	defer host.Reset()
+	if status != types.OnPluginStartStatusOK {
+		t.Fatalf("plugin failed to start with the fuzz config")
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("plugin panicked on %s: %v\n%s", desc, r, debug.Stack())
+		}
+	}()
+	call(host)
+	host.CompleteHttp()
+}
+
+// EncodeHeaders encodes headers as the string input of RequestHeaders, one "name: value" per line
+func EncodeHeaders(headers [][2]string) string {
+	var b strings.Builder
+	for _, header := range headers {
+		b.WriteString(header[0])
+		b.WriteString(": ")
+		b.WriteString(header[1])
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// DecodeHeaders decodes a fuzzed header string, lines without a colon become headers with empty values
+func DecodeHeaders(encoded string) [][2]string {
+	var headers [][2]string
+	for _, line := range strings.Split(encoded, "\n") {
+		if line == "" {
+			continue
+		}
+		// Pseudo headers start with a colon, the separator is the first colon after the name
+		sep := strings.Index(line[1:], ":")
+		if sep < 0 {
+			headers = append(headers, [2]string{line, ""})
+			continue
+		}
+		sep++
+		headers = append(headers, [2]string{line[:sep], strings.TrimPrefix(line[sep+1:], " ")})
+	}
+	return headers
+}
+
+func quote(input []byte) string {
+	if len(input) > maxReportedInput {
+		return fmt.Sprintf("%q... (%d bytes)", input[:maxReportedInput], len(input))
+	}
+	return fmt.Sprintf("%q", input)
+}
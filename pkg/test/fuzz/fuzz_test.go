@@ -0,0 +1,87 @@
+package fuzz
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/test"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func init() {
+	wrapper.SetCtx(
+		"fuzz-test",
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			if strings.Contains(ctx.Path(), "panic") {
+				panic("bad path")
+			}
+			return types.ActionContinue
+		}),
+		wrapper.ProcessRequestBody(func(ctx wrapper.HttpContext, config struct{}, body []byte) types.Action {
+			if gjson.GetBytes(body, "method").String() == "panic" {
+				panic("bad method")
+			}
+			return types.ActionContinue
+		}),
+	)
+}
+
+var emptyConfig = []byte("{}")
+
+// fatalT records the failure of an input that is expected to fail
+type fatalT struct {
+	testing.TB
+	fatal string
+}
+
+func (f *fatalT) Helper() {}
+
+func (f *fatalT) Fatalf(format string, args ...any) {
+	f.fatal = fmt.Sprintf(format, args...)
+}
+
+func FuzzRequestHeaders(f *testing.F) {
+	New(emptyConfig).RequestHeaders(f, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"x-user", "alice"}})
+}
+
+func FuzzMCPRequest(f *testing.F) {
+	New(emptyConfig).MCPRequest(f, "example.com", "/mcp", []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`), []byte("{"))
+}
+
+func TestRunReportsPanic(t *testing.T) {
+	h := New(emptyConfig)
+	ft := &fatalT{TB: t}
+	h.Run(ft, `request body "{\"method\":\"panic\"}"`, func(host test.TestHost) {
+		host.CallOnHttpRequestHeaders([][2]string{{":authority", "example.com"}, {":path", "/mcp"}})
+		host.CallOnHttpRequestBody([]byte(`{"method":"panic"}`))
+	})
+	require.NotEmpty(t, ft.fatal)
+	assert.Contains(t, ft.fatal, `plugin panicked on request body "{\"method\":\"panic\"}": bad method`)
+	assert.Contains(t, ft.fatal, "fuzz_test.go")
+
+	ft = &fatalT{TB: t}
+	h.Run(ft, "request headers", func(host test.TestHost) {
+		host.CallOnHttpRequestHeaders(DecodeHeaders(":authority: example.com\n:path: /panic\n"))
+	})
+	assert.Contains(t, ft.fatal, "bad path")
+
+	// The host is usable again after a panic
+	ft = &fatalT{TB: t}
+	h.Run(ft, "request body", func(host test.TestHost) {
+		host.CallOnHttpRequestHeaders([][2]string{{":authority", "example.com"}, {":path", "/mcp"}})
+		host.CallOnHttpRequestBody([]byte(`{"method":"ping"}`))
+	})
+	assert.Empty(t, ft.fatal)
+}
+
+func TestHeaderEncoding(t *testing.T) {
+	headers := [][2]string{{":path", "/a:b"}, {"x-empty", ""}, {"x-time", "12:00"}}
+	assert.Equal(t, headers, DecodeHeaders(EncodeHeaders(headers)))
+	assert.Equal(t, [][2]string{{"novalue", ""}, {":", ""}}, DecodeHeaders("novalue\n\n:\n"))
+}
@@ -4,11 +4,17 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"reflect"
+	"strconv"
+	"testing"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
 )
 
 // headerOption holds options for CallOnHttpRequestHeaders and CallOnHttpResponseHeaders
@@ -44,10 +50,23 @@ type TestHost interface {
 	CallOnHttpStreamingResponseBody(body []byte, endOfStream bool) types.Action
 	// CallOnHttpResponseBody call the onHttpResponseBody method in the wasm plugin.
 	CallOnHttpResponseBody(body []byte) types.Action
+	// CallOnHttpStreamingRequestBodyChunks split the body into chunks and call the onHttpRequestBody method with each of them.
+	CallOnHttpStreamingRequestBodyChunks(body []byte, chunkSize int) []types.Action
+	// CallOnHttpStreamingResponseBodyChunks split the body into chunks and call the onHttpResponseBody method with each of them.
+	CallOnHttpStreamingResponseBodyChunks(body []byte, chunkSize int) []types.Action
+	// CallOnUpgradedDownstreamData call the onHttpRequestBody method with data sent by the client on an upgraded connection,
+	// e.g. WebSocket frames encoded with wrapper.EncodeWebSocketFrame.
+	CallOnUpgradedDownstreamData(data []byte, endOfStream bool) types.Action
+	// CallOnUpgradedUpstreamData call the onHttpResponseBody method with data sent by the upstream on an upgraded connection.
+	CallOnUpgradedUpstreamData(data []byte, endOfStream bool) types.Action
 	// CallOnHttpCall call the proxy_on_http_call_response method in the wasm plugin.
 	CallOnHttpCall(headers [][2]string, body []byte)
 	// CallOnRedisCall call the proxy_on_redis_call_response method in the wasm plugin.
 	CallOnRedisCall(status int32, response []byte)
+	// CallOnGrpcCall respond to the gRPC call made with wrapper.GrpcClient with the status and response messages.
+	CallOnGrpcCall(status int, message string, responses ...[]byte)
+	// ExpectCallout expect an HTTP callout to the upstream, the test fails on unexpected or missing callouts.
+	ExpectCallout(t testing.TB, upstream string) *CalloutExpectation
 	// GetHttpCalloutAttributes get the callout attributes.
 	GetHttpCalloutAttributes() []proxytest.HttpCalloutAttribute
 	// GetRedisCalloutAttributes get the redis callout attributes.
@@ -64,6 +83,8 @@ type TestHost interface {
 	SetRequestId(requestId string) error
 	// SetDomainName set the domain for the current HTTP context.
 	SetDomainName(domain string) error
+	// SetRouteFeatureFlag set a feature flag in the route metadata under wrapper.DefaultFeatureFlagNamespace.
+	SetRouteFeatureFlag(name, value string) error
 	// GetMatchConfig get the match config with default host name.
 	GetMatchConfig() (any, error)
 	// GetHttpStreamAction get the http stream action.
@@ -87,32 +108,109 @@ type TestHost interface {
 // currentContextID is the context id for the current http request.
 // currentContextValid is the valid flag for the current http request.
 // currentDomain is the domain for configuration matching.
+// option holds the defaults the test host was created with.
+// expectations are the callouts expected by ExpectCallout, seenCallouts the callouts already matched.
+// trace and debugDump are the host calls and the state dumped when a wasm mode test fails.
 // reset is the function to reset the test host.
 type testHost struct {
 	proxytest.HostEmulator
 	currentContextID    uint32
 	currentContextValid bool
 	currentDomain       string
+	option              hostOption
+	expectations        []*CalloutExpectation
+	expectT             testing.TB
+	seenCallouts        map[uint32]bool
+	trace               []string
+	debugDump           string
 	reset               func()
 }
 
 // Reset call the reset function to call internal.VMStateReset() and release mutex for currentHost.
 func (h *testHost) Reset() {
+	if debugHosts != nil {
+		h.debugDump = h.debugState()
+	}
 	h.currentContextID = 0
 	h.currentContextValid = false
 	h.currentDomain = ""
+	h.expectations = nil
+	h.expectT = nil
+	h.seenCallouts = nil
 	h.reset()
 }
 
+// hostOption holds the defaults of a test host
+type hostOption struct {
+	domain         string
+	routeName      string
+	clusterName    string
+	requestHeaders [][2]string
+	foreignFuncs   map[string]func([]byte) []byte
+}
+
+// HostOptionFunc is a function that configures hostOption
+type HostOptionFunc func(*hostOption)
+
+// WithDefaultDomain sets the domain used when a test does not send request headers, and for GetMatchConfig.
+func WithDefaultDomain(domain string) HostOptionFunc {
+	return func(o *hostOption) {
+		o.domain = domain
+	}
+}
+
+// WithDefaultRoute sets the property route_name of every request.
+func WithDefaultRoute(routeName string) HostOptionFunc {
+	return func(o *hostOption) {
+		o.routeName = routeName
+	}
+}
+
+// WithDefaultCluster sets the property cluster_name of every request.
+func WithDefaultCluster(clusterName string) HostOptionFunc {
+	return func(o *hostOption) {
+		o.clusterName = clusterName
+	}
+}
+
+// WithDefaultRequestHeaders sets the request headers sent when a body or response phase call starts a
+// request without CallOnHttpRequestHeaders. :authority is set to the domain if it is missing.
+func WithDefaultRequestHeaders(headers [][2]string) HostOptionFunc {
+	return func(o *hostOption) {
+		o.requestHeaders = headers
+	}
+}
+
+// WithForeignFuncs registers foreign functions, see NewTestHostWithForeignFuncs.
+func WithForeignFuncs(foreignFuncs map[string]func([]byte) []byte) HostOptionFunc {
+	return func(o *hostOption) {
+		o.foreignFuncs = foreignFuncs
+	}
+}
+
 // NewTestHost create a new test host with config in json format.
 func NewTestHost(config json.RawMessage) (TestHost, types.OnPluginStartStatus) {
-	return NewTestHostWithForeignFuncs(config, nil)
+	return NewTestHostWithOptions(config)
 }
 
 // NewTestHostWithForeignFuncs create a new test host with config and foreign functions.
 // foreignFuncs is a map of foreign function name to the function implementation.
 // This is useful for testing plugins that call foreign functions like "set_global_max_requests_per_io_cycle".
 func NewTestHostWithForeignFuncs(config json.RawMessage, foreignFuncs map[string]func([]byte) []byte) (TestHost, types.OnPluginStartStatus) {
+	return NewTestHostWithOptions(config, WithForeignFuncs(foreignFuncs))
+}
+
+// NewTestHostWithOptions create a new test host with config and options overriding its defaults,
+// e.g. the domain for tests of domain matched rules.
+func NewTestHostWithOptions(config json.RawMessage, opts ...HostOptionFunc) (TestHost, types.OnPluginStartStatus) {
+	option := hostOption{
+		domain:      defaultTestDomain,
+		routeName:   "test-route-default",
+		clusterName: "test-cluster-default",
+	}
+	for _, opt := range opts {
+		opt(&option)
+	}
 	// if wasmInitVMContext is not set, set it to the commonVMContext.
 	if getWasmInitVMContext() == nil {
 		setWasmInitVMContext(proxywasm.GetVMContext())
@@ -129,7 +227,7 @@ func NewTestHostWithForeignFuncs(config json.RawMessage, foreignFuncs map[string
 	host, reset := proxytest.NewHostEmulator(opt)
 
 	// register foreign functions before starting the plugin.
-	for name, f := range foreignFuncs {
+	for name, f := range option.foreignFuncs {
 		host.RegisterForeignFunction(name, f)
 	}
 
@@ -145,10 +243,14 @@ func NewTestHostWithForeignFuncs(config json.RawMessage, foreignFuncs map[string
 	// create a new test host with the host emulator and the reset function.
 	testHost := &testHost{
 		HostEmulator: host,
+		option:       option,
 		reset:        reset,
 	}
 	// set the default properties.
 	testHost.setDefaultProperties()
+	if debugHosts != nil {
+		debugHosts = append(debugHosts, testHost)
+	}
 	return testHost, status
 }
 
@@ -156,8 +258,8 @@ func NewTestHostWithForeignFuncs(config json.RawMessage, foreignFuncs map[string
 // set the default properties include route_name, cluster_name, x_request_id.
 // unitTest can override the default properties.
 func (h *testHost) setDefaultProperties() {
-	h.SetRouteName("test-route-default")
-	h.SetClusterName("test-cluster-default")
+	h.SetRouteName(h.option.routeName)
+	h.SetClusterName(h.option.clusterName)
 	h.SetRequestId("test-request-id-default")
 }
 
@@ -171,6 +273,7 @@ func (h *testHost) InitHttp() {
 // CompleteHttpRequest complete the http request and set the currentContextValid to false.
 func (h *testHost) CompleteHttp() {
 	h.HostEmulator.CompleteHttpContext(h.currentContextID)
+	h.tracef("CompleteHttp()")
 	h.currentContextValid = false
 }
 
@@ -189,6 +292,8 @@ func (h *testHost) CallOnHttpRequestHeaders(headers [][2]string, opts ...HeaderO
 	}
 
 	action := h.HostEmulator.CallOnRequestHeaders(h.currentContextID, headers, option.endOfStream)
+	h.traceAction("CallOnHttpRequestHeaders", fmt.Sprintf("%v", headers), action)
+	h.checkCallouts()
 	return action
 }
 
@@ -197,17 +302,36 @@ func (h *testHost) CallOnHttpRequestHeaders(headers [][2]string, opts ...HeaderO
 func (h *testHost) ensureContextInitialized() {
 	if !h.currentContextValid {
 		h.InitHttp()
-		action := h.HostEmulator.CallOnRequestHeaders(h.currentContextID, [][2]string{{":authority", defaultTestDomain}}, false)
+		action := h.HostEmulator.CallOnRequestHeaders(h.currentContextID, h.defaultRequestHeaders(), false)
 		if action != types.ActionContinue {
 			panic("wasm plugin unit test should CallOnHttpRequestHeaders first")
 		}
 	}
 }
 
+// domain returns the domain set by SetDomainName, or the default domain.
+func (h *testHost) domain() string {
+	if h.currentDomain != "" {
+		return h.currentDomain
+	}
+	return h.option.domain
+}
+
+// defaultRequestHeaders returns the request headers of requests started without CallOnHttpRequestHeaders.
+func (h *testHost) defaultRequestHeaders() [][2]string {
+	headers := append([][2]string(nil), h.option.requestHeaders...)
+	if !HasHeader(headers, ":authority") {
+		headers = append(headers, [2]string{":authority", h.domain()})
+	}
+	return headers
+}
+
 // CallOnHttpRequestBody call the onHttpRequestBody method in the wasm plugin.
 func (h *testHost) CallOnHttpRequestBody(body []byte) types.Action {
 	h.ensureContextInitialized()
 	action := h.HostEmulator.CallOnRequestBody(h.currentContextID, body, true)
+	h.traceAction("CallOnHttpRequestBody", truncate(string(body)), action)
+	h.checkCallouts()
 	return action
 }
 
@@ -216,6 +340,8 @@ func (h *testHost) CallOnHttpRequestBody(body []byte) types.Action {
 func (h *testHost) CallOnHttpStreamingRequestBody(body []byte, endOfStream bool) types.Action {
 	h.ensureContextInitialized()
 	action := h.HostEmulator.CallOnRequestBody(h.currentContextID, body, endOfStream)
+	h.traceAction("CallOnHttpStreamingRequestBody", fmt.Sprintf("%s, %t", truncate(string(body)), endOfStream), action)
+	h.checkCallouts()
 	return action
 }
 
@@ -224,6 +350,29 @@ func (h *testHost) CallOnHttpStreamingRequestBody(body []byte, endOfStream bool)
 func (h *testHost) CallOnHttpStreamingResponseBody(body []byte, endOfStream bool) types.Action {
 	h.ensureContextInitialized()
 	action := h.HostEmulator.CallOnResponseBody(h.currentContextID, body, endOfStream)
+	h.traceAction("CallOnHttpStreamingResponseBody", fmt.Sprintf("%s, %t", truncate(string(body)), endOfStream), action)
+	h.checkCallouts()
+	return action
+}
+
+// CallOnUpgradedDownstreamData call the onHttpRequestBody method with data sent by the client on an upgraded connection,
+// after the request headers with Connection: Upgrade and the 101 response headers. The data forwarded to the
+// upstream is read with GetRequestBody.
+func (h *testHost) CallOnUpgradedDownstreamData(data []byte, endOfStream bool) types.Action {
+	h.ensureContextInitialized()
+	action := h.HostEmulator.CallOnRequestBody(h.currentContextID, data, endOfStream)
+	h.traceAction("CallOnUpgradedDownstreamData", fmt.Sprintf("%q, %t", truncate(string(data)), endOfStream), action)
+	h.checkCallouts()
+	return action
+}
+
+// CallOnUpgradedUpstreamData call the onHttpResponseBody method with data sent by the upstream on an upgraded connection.
+// The data forwarded to the client is read with GetResponseBody.
+func (h *testHost) CallOnUpgradedUpstreamData(data []byte, endOfStream bool) types.Action {
+	h.ensureContextInitialized()
+	action := h.HostEmulator.CallOnResponseBody(h.currentContextID, data, endOfStream)
+	h.traceAction("CallOnUpgradedUpstreamData", fmt.Sprintf("%q, %t", truncate(string(data)), endOfStream), action)
+	h.checkCallouts()
 	return action
 }
 
@@ -240,6 +389,8 @@ func (h *testHost) CallOnHttpResponseHeaders(headers [][2]string, opts ...Header
 	}
 
 	action := h.HostEmulator.CallOnResponseHeaders(h.currentContextID, headers, option.endOfStream)
+	h.traceAction("CallOnHttpResponseHeaders", fmt.Sprintf("%v", headers), action)
+	h.checkCallouts()
 	return action
 }
 
@@ -247,14 +398,59 @@ func (h *testHost) CallOnHttpResponseHeaders(headers [][2]string, opts ...Header
 func (h *testHost) CallOnHttpResponseBody(body []byte) types.Action {
 	h.ensureContextInitialized()
 	action := h.HostEmulator.CallOnResponseBody(h.currentContextID, body, true)
+	h.traceAction("CallOnHttpResponseBody", truncate(string(body)), action)
+	h.checkCallouts()
 	return action
 }
 
+// CallOnHttpStreamingRequestBodyChunks split the body into chunks of chunkSize bytes and call the
+// onHttpRequestBody method with each of them, endOfStream is only set for the last chunk.
+func (h *testHost) CallOnHttpStreamingRequestBodyChunks(body []byte, chunkSize int) []types.Action {
+	var actions []types.Action
+	for _, chunk := range splitChunks(body, chunkSize) {
+		actions = append(actions, h.CallOnHttpStreamingRequestBody(chunk.data, chunk.last))
+	}
+	return actions
+}
+
+// CallOnHttpStreamingResponseBodyChunks split the body into chunks of chunkSize bytes and call the
+// onHttpResponseBody method with each of them, endOfStream is only set for the last chunk.
+func (h *testHost) CallOnHttpStreamingResponseBodyChunks(body []byte, chunkSize int) []types.Action {
+	var actions []types.Action
+	for _, chunk := range splitChunks(body, chunkSize) {
+		actions = append(actions, h.CallOnHttpStreamingResponseBody(chunk.data, chunk.last))
+	}
+	return actions
+}
+
+type bodyChunk struct {
+	data []byte
+	last bool
+}
+
+// splitChunks splits the body into chunks of at most chunkSize bytes, an empty body is a single empty chunk
+func splitChunks(body []byte, chunkSize int) []bodyChunk {
+	if chunkSize <= 0 {
+		chunkSize = len(body)
+	}
+	var chunks []bodyChunk
+	for {
+		n := chunkSize
+		if n >= len(body) {
+			return append(chunks, bodyChunk{data: body, last: true})
+		}
+		chunks = append(chunks, bodyChunk{data: body[:n]})
+		body = body[n:]
+	}
+}
+
 // CallOnHttpCall call the proxy_on_http_call_response method in the wasm plugin.
 func (h *testHost) CallOnHttpCall(headers [][2]string, body []byte) {
 	attrs := h.HostEmulator.GetCalloutAttributesFromContext(h.currentContextID)
 	calloutID := attrs[0].CalloutID
 	h.HostEmulator.CallOnHttpCallResponse(calloutID, headers, nil, body)
+	h.tracef("CallOnHttpCall(%v, %s)", headers, truncate(string(body)))
+	h.checkCallouts()
 }
 
 // CallOnRedisCall call the proxy_on_redis_call_response method in the wasm plugin.
@@ -262,6 +458,26 @@ func (h *testHost) CallOnRedisCall(status int32, response []byte) {
 	attrs := h.HostEmulator.GetRedisCalloutAttributesFromContext(h.currentContextID)
 	calloutID := attrs[0].CalloutID
 	h.HostEmulator.CallOnRedisCallResponse(calloutID, status, response)
+	h.tracef("CallOnRedisCall(%d, %q)", status, response)
+	h.checkCallouts()
+}
+
+// CallOnGrpcCall respond to the gRPC call made with wrapper.GrpcClient with the status and response messages.
+func (h *testHost) CallOnGrpcCall(status int, message string, responses ...[]byte) {
+	attrs := h.HostEmulator.GetCalloutAttributesFromContext(h.currentContextID)
+	calloutID := attrs[0].CalloutID
+	var body []byte
+	for _, response := range responses {
+		body = append(body, wrapper.EncodeGrpcMessage(response)...)
+	}
+	headers := [][2]string{{":status", "200"}, {"content-type", "application/grpc"}}
+	trailers := [][2]string{{"grpc-status", strconv.Itoa(status)}}
+	if message != "" {
+		trailers = append(trailers, [2]string{"grpc-message", url.PathEscape(message)})
+	}
+	h.HostEmulator.CallOnHttpCallResponse(calloutID, headers, trailers, body)
+	h.tracef("CallOnGrpcCall(%d, %q, %d messages)", status, message, len(responses))
+	h.checkCallouts()
 }
 
 // GetHttpCalloutAttributes get the callout attributes.
@@ -289,6 +505,11 @@ func (h *testHost) SetRequestId(requestId string) error {
 	return h.SetProperty([]string{"x_request_id"}, []byte(requestId))
 }
 
+// SetRouteFeatureFlag set a feature flag in the route metadata under wrapper.DefaultFeatureFlagNamespace.
+func (h *testHost) SetRouteFeatureFlag(name, value string) error {
+	return h.SetProperty([]string{"xds", "route_metadata", "filter_metadata", wrapper.DefaultFeatureFlagNamespace, name}, []byte(value))
+}
+
 // SetDomainName set the domain for the current HTTP context.
 // This method sets the domain for configuration matching.
 func (h *testHost) SetDomainName(domain string) error {
@@ -304,10 +525,7 @@ func (h *testHost) SetDomainName(domain string) error {
 func (h *testHost) GetMatchConfig() (any, error) {
 	contextID := h.HostEmulator.InitializeHttpContext()
 
-	headers := [][2]string{{":authority", defaultTestDomain}}
-	if h.currentDomain != "" {
-		headers = [][2]string{{":authority", h.currentDomain}}
-	}
+	headers := [][2]string{{":authority", h.domain()}}
 	h.HostEmulator.SetHttpRequestHeaders(contextID, headers)
 
 	httpContext := proxywasm.GetHttpContext(contextID)
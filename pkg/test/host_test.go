@@ -0,0 +1,75 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func TestHostOptions(t *testing.T) {
+	var host, path, route string
+	setTestVMContext(wrapper.NewCommonVmCtx("host-options", wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+		host, path = ctx.Host(), ctx.Path()
+		routeName, _ := proxywasm.GetProperty([]string{"route_name"})
+		route = string(routeName)
+		return types.ActionContinue
+	})))
+	defer clearTestVMContext()
+
+	t.Run("defaults", func(t *testing.T) {
+		h, _ := NewTestHost(nil)
+		defer h.Reset()
+		h.CallOnHttpRequestBody([]byte("{}"))
+		assert.Equal(t, defaultTestDomain, host)
+		assert.Equal(t, "test-route-default", route)
+	})
+
+	t.Run("overridden", func(t *testing.T) {
+		h, _ := NewTestHostWithOptions(nil, WithDefaultDomain("api.example.com"), WithDefaultRoute("api-route"),
+			WithDefaultRequestHeaders([][2]string{{":path", "/v1/chat/completions"}, {":method", "POST"}}))
+		defer h.Reset()
+		h.CallOnHttpRequestBody([]byte("{}"))
+		assert.Equal(t, "api.example.com", host)
+		assert.Equal(t, "/v1/chat/completions", path)
+		assert.Equal(t, "api-route", route)
+	})
+
+	t.Run("domain set by the test", func(t *testing.T) {
+		h, _ := NewTestHostWithOptions(nil, WithDefaultDomain("api.example.com"))
+		defer h.Reset()
+		h.SetDomainName("admin.example.com")
+		h.CallOnHttpResponseHeaders([][2]string{{":status", "200"}})
+		assert.Equal(t, "admin.example.com", host)
+	})
+}
+
+func TestStreamingBodyChunks(t *testing.T) {
+	var chunks []string
+	var last []bool
+	setTestVMContext(wrapper.NewCommonVmCtx("streaming-chunks",
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			return types.ActionContinue
+		}),
+		wrapper.ProcessStreamingResponseBody(func(ctx wrapper.HttpContext, config struct{}, chunk []byte, isLastChunk bool) []byte {
+			chunks = append(chunks, string(chunk))
+			last = append(last, isLastChunk)
+			return chunk
+		})))
+	defer clearTestVMContext()
+
+	host, _ := NewTestHost(nil)
+	defer host.Reset()
+	host.CallOnHttpRequestHeaders([][2]string{{":authority", "example.com"}, {":path", "/v1/chat/completions"}})
+	host.CallOnHttpResponseHeaders([][2]string{{":status", "200"}, {"content-type", "text/event-stream"}})
+	actions := host.CallOnHttpStreamingResponseBodyChunks([]byte("data: 1\n\ndata: 2\n\n"), 8)
+	assert.Len(t, actions, 3)
+	assert.Equal(t, []string{"data: 1\n", "\ndata: 2", "\n\n"}, chunks)
+	assert.Equal(t, []bool{false, false, true}, last)
+
+	assert.Equal(t, []bodyChunk{{data: nil, last: true}}, splitChunks(nil, 8))
+	assert.Equal(t, []bodyChunk{{data: []byte("abc"), last: true}}, splitChunks([]byte("abc"), 0))
+}
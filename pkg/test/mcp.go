@@ -0,0 +1,119 @@
+package test
+
+import (
+	"encoding/json"
+)
+
+// MCPToolArg is an argument of a tool in an MCP server config fixture
+type MCPToolArg struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Enum        []string    `json:"enum,omitempty"`
+	Position    string      `json:"position,omitempty"`
+}
+
+// MCPTool is a tool in an MCP server config fixture. RequestTemplate and ResponseTemplate are
+// only used by REST servers.
+type MCPTool struct {
+	Name             string                 `json:"name"`
+	Description      string                 `json:"description,omitempty"`
+	Args             []MCPToolArg           `json:"args,omitempty"`
+	RequestTemplate  map[string]interface{} `json:"requestTemplate,omitempty"`
+	ResponseTemplate map[string]interface{} `json:"responseTemplate,omitempty"`
+}
+
+// MCPSecurityScheme is a security scheme in an MCP server config fixture
+type MCPSecurityScheme struct {
+	ID                string `json:"id"`
+	Type              string `json:"type"`
+	Scheme            string `json:"scheme,omitempty"`
+	In                string `json:"in,omitempty"`
+	Name              string `json:"name,omitempty"`
+	DefaultCredential string `json:"defaultCredential,omitempty"`
+}
+
+// MCPServerConfigBuilder builds the plugin config of an MCP server for tests
+type MCPServerConfigBuilder struct {
+	server map[string]interface{}
+	config map[string]interface{}
+	tools  []MCPTool
+}
+
+// NewMCPServerConfig starts an MCP server config fixture for the server with the given name
+func NewMCPServerConfig(name string) *MCPServerConfigBuilder {
+	return &MCPServerConfigBuilder{
+		server: map[string]interface{}{"name": name},
+		config: map[string]interface{}{},
+	}
+}
+
+// WithType sets the server type, e.g. "mcp-proxy". REST servers have no type.
+func (b *MCPServerConfigBuilder) WithType(serverType string) *MCPServerConfigBuilder {
+	b.server["type"] = serverType
+	return b
+}
+
+// WithProxyBackend configures an mcp-proxy server with the transport and URL of its backend
+func (b *MCPServerConfigBuilder) WithProxyBackend(transport, mcpServerURL string) *MCPServerConfigBuilder {
+	b.server["type"] = "mcp-proxy"
+	b.server["transport"] = transport
+	b.server["mcpServerURL"] = mcpServerURL
+	return b
+}
+
+// WithServerConfig sets server.config, the values available to templates as .config
+func (b *MCPServerConfigBuilder) WithServerConfig(config map[string]interface{}) *MCPServerConfigBuilder {
+	b.server["config"] = config
+	return b
+}
+
+// WithServerField sets any other field of server, e.g. "dryRun" or "backendSession"
+func (b *MCPServerConfigBuilder) WithServerField(key string, value interface{}) *MCPServerConfigBuilder {
+	b.server[key] = value
+	return b
+}
+
+// WithSecuritySchemes appends to server.securitySchemes
+func (b *MCPServerConfigBuilder) WithSecuritySchemes(schemes ...MCPSecurityScheme) *MCPServerConfigBuilder {
+	existing, _ := b.server["securitySchemes"].([]MCPSecurityScheme)
+	b.server["securitySchemes"] = append(existing, schemes...)
+	return b
+}
+
+// WithTools appends tools
+func (b *MCPServerConfigBuilder) WithTools(tools ...MCPTool) *MCPServerConfigBuilder {
+	b.tools = append(b.tools, tools...)
+	return b
+}
+
+// WithAllowTools sets allowTools
+func (b *MCPServerConfigBuilder) WithAllowTools(names ...string) *MCPServerConfigBuilder {
+	b.config["allowTools"] = append([]string{}, names...)
+	return b
+}
+
+// WithField sets any other top level field, e.g. "resources" or "prompts"
+func (b *MCPServerConfigBuilder) WithField(key string, value interface{}) *MCPServerConfigBuilder {
+	b.config[key] = value
+	return b
+}
+
+// Build returns the plugin config
+func (b *MCPServerConfigBuilder) Build() json.RawMessage {
+	config := make(map[string]interface{}, len(b.config)+2)
+	for k, v := range b.config {
+		config[k] = v
+	}
+	config["server"] = b.server
+	if len(b.tools) > 0 {
+		config["tools"] = b.tools
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
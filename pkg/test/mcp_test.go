@@ -0,0 +1,66 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMCPServerConfig(t *testing.T) {
+	t.Run("rest server", func(t *testing.T) {
+		config := NewMCPServerConfig("rest-server").
+			WithType("rest").
+			WithServerConfig(map[string]interface{}{"apiKey": "key"}).
+			WithTools(MCPTool{
+				Name: "get_weather",
+				Args: []MCPToolArg{{Name: "city", Type: "string", Required: true}},
+				RequestTemplate: map[string]interface{}{
+					"url":    "https://api.example.com/weather?city={{.args.city}}",
+					"method": "GET",
+				},
+			}).
+			Build()
+		assert.JSONEq(t, `{
+			"server": {"name": "rest-server", "type": "rest", "config": {"apiKey": "key"}},
+			"tools": [{
+				"name": "get_weather",
+				"args": [{"name": "city", "type": "string", "required": true}],
+				"requestTemplate": {"url": "https://api.example.com/weather?city={{.args.city}}", "method": "GET"}
+			}]
+		}`, string(config))
+	})
+
+	t.Run("proxy server", func(t *testing.T) {
+		config := NewMCPServerConfig("proxy-server").
+			WithProxyBackend("sse", "http://backend.example.com/sse").
+			WithServerField("timeout", 5000).
+			WithSecuritySchemes(MCPSecurityScheme{ID: "key", Type: "apiKey", In: "header", Name: "X-API-Key"}).
+			WithSecuritySchemes(MCPSecurityScheme{ID: "bearer", Type: "http", Scheme: "bearer"}).
+			WithAllowTools("get_product").
+			WithField("prompts", []string{}).
+			Build()
+		assert.JSONEq(t, `{
+			"server": {
+				"name": "proxy-server",
+				"type": "mcp-proxy",
+				"transport": "sse",
+				"mcpServerURL": "http://backend.example.com/sse",
+				"timeout": 5000,
+				"securitySchemes": [
+					{"id": "key", "type": "apiKey", "in": "header", "name": "X-API-Key"},
+					{"id": "bearer", "type": "http", "scheme": "bearer"}
+				]
+			},
+			"allowTools": ["get_product"],
+			"prompts": []
+		}`, string(config), "schemes are appended and no tools are written without tools")
+	})
+
+	t.Run("builds are independent", func(t *testing.T) {
+		builder := NewMCPServerConfig("server").WithTools(MCPTool{Name: "a"})
+		first := builder.Build()
+		builder.WithTools(MCPTool{Name: "b"})
+		assert.JSONEq(t, `{"server": {"name": "server"}, "tools": [{"name": "a"}]}`, string(first))
+		assert.JSONEq(t, `{"server": {"name": "server"}, "tools": [{"name": "a"}, {"name": "b"}]}`, string(builder.Build()))
+	})
+}
@@ -139,6 +139,7 @@ func RunWasmTestWithPath(t *testing.T, wasmPath string, f func(*testing.T)) {
 		defer vm.Close()
 		setTestVMContext(vm)
 		defer clearTestVMContext()
+		defer startWasmDebug(t)()
 		f(t)
 	})
 }
@@ -173,6 +174,7 @@ func RunTestWithPath(t *testing.T, wasmPath string, f func(*testing.T)) {
 		defer vm.Close()
 		setTestVMContext(vm)
 		defer clearTestVMContext()
+		defer startWasmDebug(t)()
 		f(t)
 		t.Log("wasm mode test end")
 	})
@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenusage
+
+import (
+	"time"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+// Attributes read by the ai-statistics plugin of Higress and its dashboards. The ai_log attributes
+// model, input_token, output_token and total_token are the CtxKey constants.
+const (
+	AttrLLMFirstTokenDuration = "llm_first_token_duration" // Milliseconds from the request to the first chunk of a stream
+	AttrLLMServiceDuration    = "llm_service_duration"     // Milliseconds from the request to the end of the response
+	AttrResponseType          = "response_type"
+
+	ResponseTypeStream = "stream"
+	ResponseTypeNormal = "normal"
+
+	SpanAttrModelName    = "gen_ai.model_name"
+	SpanAttrRequestModel = "gen_ai.request.model"
+	SpanAttrInputTokens  = "gen_ai.usage.input_tokens"
+	SpanAttrOutputTokens = "gen_ai.usage.output_tokens"
+	SpanAttrTotalTokens  = "gen_ai.usage.total_tokens"
+
+	ctxKeyRequestStartTime = "ai-statistics-request-start-time"
+	ctxKeyFirstTokenTime   = "ai-statistics-first-token-time"
+	ctxKeyStreaming        = "ai-statistics-streaming"
+)
+
+// LLMTiming are the durations of an LLM call, zero durations are not reported
+type LLMTiming struct {
+	// FirstToken is the time to the first chunk of a streamed response
+	FirstToken time.Duration
+	// Service is the time to the end of the response
+	Service   time.Duration
+	Streaming bool
+}
+
+// SetStatisticsAttributes sets the user attributes of the usage and timing in the names and units
+// of ai-statistics, to be written to the ai_log with WriteUserAttributeToLogWithKey(wrapper.AILogKey),
+// and the gen_ai span attributes of the usage.
+func SetStatisticsAttributes(ctx wrapper.HttpContext, u TokenUsage, timing LLMTiming) {
+	ctx.SetUserAttribute(CtxKeyModel, u.Model)
+	ctx.SetUserAttribute(CtxKeyInputToken, u.InputToken)
+	ctx.SetUserAttribute(CtxKeyOutputToken, u.OutputToken)
+	ctx.SetUserAttribute(CtxKeyTotalToken, u.TotalToken)
+	if timing.Streaming {
+		ctx.SetUserAttribute(AttrResponseType, ResponseTypeStream)
+		if timing.FirstToken > 0 {
+			ctx.SetUserAttribute(AttrLLMFirstTokenDuration, timing.FirstToken.Milliseconds())
+		}
+	} else {
+		ctx.SetUserAttribute(AttrResponseType, ResponseTypeNormal)
+	}
+	if timing.Service > 0 {
+		ctx.SetUserAttribute(AttrLLMServiceDuration, timing.Service.Milliseconds())
+	}
+
+	ctx.SetSpanAttribute(SpanAttrModelName, u.Model)
+	if requestModel := ctx.GetStringContext(CtxKeyRequestModel, ModelEmpty); requestModel != ModelEmpty {
+		ctx.SetSpanAttribute(SpanAttrRequestModel, requestModel)
+	}
+	ctx.SetSpanAttribute(SpanAttrInputTokens, u.InputToken)
+	ctx.SetSpanAttribute(SpanAttrOutputTokens, u.OutputToken)
+	ctx.SetSpanAttribute(SpanAttrTotalTokens, u.TotalToken)
+}
+
+// MarkRequestStart records the start of the LLM call of the request, call it in the request header
+// phase so that EnableTokenUsageTracking reports its durations
+func MarkRequestStart(ctx wrapper.HttpContext) {
+	ctx.SetContext(ctxKeyRequestStartTime, time.Now())
+}
+
+// markResponseChunk records the first chunk of the response and whether it is streamed
+func markResponseChunk(ctx wrapper.HttpContext, chunk []byte) {
+	if _, ok := ctx.GetContext(ctxKeyFirstTokenTime).(time.Time); ok || len(chunk) == 0 {
+		return
+	}
+	ctx.SetContext(ctxKeyFirstTokenTime, time.Now())
+	ctx.SetContext(ctxKeyStreaming, wrapper.DetectBodyType("", chunk) == wrapper.BodyTypeSSE)
+}
+
+// trackedTiming returns the timing of the response observed by EnableTokenUsageTracking
+func trackedTiming(ctx wrapper.HttpContext) LLMTiming {
+	timing := LLMTiming{Streaming: ctx.GetBoolContext(ctxKeyStreaming, false)}
+	start, ok := ctx.GetContext(ctxKeyRequestStartTime).(time.Time)
+	if !ok {
+		return timing
+	}
+	if first, ok := ctx.GetContext(ctxKeyFirstTokenTime).(time.Time); ok && timing.Streaming {
+		timing.FirstToken = first.Sub(start)
+	}
+	timing.Service = time.Since(start)
+	return timing
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenusage
+
+import (
+	"bytes"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+const (
+	// CtxKeyTokenUsage holds the latest TokenUsage extracted by EnableTokenUsageTracking
+	CtxKeyTokenUsage = "token_usage"
+
+	ctxKeyTrackingPending = "token_usage_pending"
+)
+
+var sseEventSeparator = []byte("\n\n")
+
+// EnableTokenUsageTracking returns an option that extracts token usage from the response body,
+// whether it is streamed or not, and writes the usage attributes to the ai_log at stream end, with the
+// durations of ai-statistics when the plugin calls MarkRequestStart.
+// It works alongside the plugin's own response body handlers, which can read the usage so far
+// with GetTrackedTokenUsage.
+func EnableTokenUsageTracking[PluginConfig any]() wrapper.CtxOption[PluginConfig] {
+	return wrapper.ObserveResponseBody[PluginConfig](wrapper.ResponseBodyObserver{
+		OnChunk: trackChunk,
+		OnDone:  writeTrackedTokenUsage,
+	})
+}
+
+// GetTrackedTokenUsage returns the token usage extracted so far by EnableTokenUsageTracking.
+func GetTrackedTokenUsage(ctx wrapper.HttpContext) (TokenUsage, bool) {
+	u, ok := ctx.GetContext(CtxKeyTokenUsage).(TokenUsage)
+	return u, ok
+}
+
+// trackChunk extracts the usage from the complete SSE events of a chunk. An event split across
+// chunks is kept until the rest of it arrives, as is a plain JSON body until the last chunk.
+func trackChunk(ctx wrapper.HttpContext, chunk []byte, isLastChunk bool) {
+	markResponseChunk(ctx, chunk)
+	data := wrapper.UnifySSEChunk(append(ctx.GetByteSliceContext(ctxKeyTrackingPending, nil), chunk...))
+	if !isLastChunk {
+		idx := bytes.LastIndex(data, sseEventSeparator)
+		if idx < 0 {
+			ctx.SetContext(ctxKeyTrackingPending, data)
+			return
+		}
+		ctx.SetContext(ctxKeyTrackingPending, bytes.Clone(data[idx+len(sseEventSeparator):]))
+		data = data[:idx+len(sseEventSeparator)]
+	} else {
+		ctx.SetContext(ctxKeyTrackingPending, nil)
+	}
+	trackUsage(ctx, data)
+}
+
+func trackUsage(ctx wrapper.HttpContext, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	// The model is always set once a usage has been extracted
+	if u := GetTokenUsage(ctx, data); u.Model != ModelEmpty {
+		ctx.SetContext(CtxKeyTokenUsage, u)
+	}
+}
+
+func writeTrackedTokenUsage(ctx wrapper.HttpContext) {
+	// The stream may end without a last chunk, e.g. when the downstream resets it
+	if pending := ctx.GetByteSliceContext(ctxKeyTrackingPending, nil); len(pending) > 0 {
+		ctx.SetContext(ctxKeyTrackingPending, nil)
+		trackUsage(ctx, pending)
+	}
+	u, ok := GetTrackedTokenUsage(ctx)
+	if !ok {
+		return
+	}
+	SetStatisticsAttributes(ctx, u, trackedTiming(ctx))
+	if err := ctx.WriteUserAttributeToLogWithKey(wrapper.AILogKey); err != nil {
+		log.Warnf("failed to write token usage to log: %v", err)
+	}
+}
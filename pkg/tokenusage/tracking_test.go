@@ -0,0 +1,155 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokenusage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/wrapper"
+)
+
+func newTrackingHost(t *testing.T, options ...wrapper.CtxOption[struct{}]) (proxytest.HostEmulator, uint32, func()) {
+	options = append(options, EnableTokenUsageTracking[struct{}]())
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().
+		WithVMContext(wrapper.NewCommonVmCtx[struct{}]("token-usage-test", options...)))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":method", "POST"}, {":path", "/v1/chat/completions"}}, false)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-type", "text/event-stream"}}, false)
+	return host, id, reset
+}
+
+// getAILog returns the unescaped ai_log written by the plugin
+func getAILog(t *testing.T, host proxytest.HostEmulator) string {
+	raw, err := host.GetProperty([]string{wrapper.AILogKey})
+	assert.NoError(t, err)
+	return wrapper.UnmarshalStr(`"` + string(raw) + `"`)
+}
+
+func TestEnableTokenUsageTrackingStreaming(t *testing.T) {
+	var seen []byte
+	var usage TokenUsage
+	host, id, reset := newTrackingHost(t,
+		wrapper.ProcessStreamingResponseBody(func(ctx wrapper.HttpContext, config struct{}, chunk []byte, isLastChunk bool) []byte {
+			seen = append(seen, chunk...)
+			if isLastChunk {
+				usage, _ = GetTrackedTokenUsage(ctx)
+			}
+			return chunk
+		}))
+	defer reset()
+
+	// The usage event is split across chunks
+	chunks := []string{
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"qwen\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\r\n\r\n",
+		"data: {\"id\":\"chatcmpl-1\",\"model\":\"qwen\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,",
+		"\"completion_tokens\":5,\"total_tokens\":15}}\n\ndata: [DONE]\n\n",
+	}
+	for i, chunk := range chunks {
+		host.CallOnResponseBody(id, []byte(chunk), i == len(chunks)-1)
+	}
+	assert.Equal(t, chunks[0]+chunks[1]+chunks[2], string(seen), "chunks must reach the plugin unchanged")
+	assert.Equal(t, int64(10), usage.InputToken)
+	assert.Equal(t, int64(5), usage.OutputToken)
+	assert.Equal(t, int64(15), usage.TotalToken)
+
+	host.CompleteHttpContext(id)
+	aiLog := getAILog(t, host)
+	assert.Equal(t, "qwen", gjson.Get(aiLog, CtxKeyModel).String())
+	assert.Equal(t, int64(10), gjson.Get(aiLog, CtxKeyInputToken).Int())
+	assert.Equal(t, int64(5), gjson.Get(aiLog, CtxKeyOutputToken).Int())
+	assert.Equal(t, int64(15), gjson.Get(aiLog, CtxKeyTotalToken).Int())
+}
+
+func TestEnableTokenUsageTrackingBuffered(t *testing.T) {
+	calls := 0
+	host, id, reset := newTrackingHost(t,
+		wrapper.ProcessResponseBody(func(ctx wrapper.HttpContext, config struct{}, body []byte) types.Action {
+			calls++
+			return types.ActionContinue
+		}))
+	defer reset()
+
+	host.CallOnResponseBody(id, []byte(`{"model":"gpt-4o","usage":{"prompt_tokens":3,`), false)
+	host.CallOnResponseBody(id, []byte(`"completion_tokens":4,"total_tokens":7}}`), true)
+	assert.Equal(t, 1, calls)
+
+	host.CompleteHttpContext(id)
+	aiLog := getAILog(t, host)
+	assert.Equal(t, "gpt-4o", gjson.Get(aiLog, CtxKeyModel).String())
+	assert.Equal(t, int64(7), gjson.Get(aiLog, CtxKeyTotalToken).Int())
+}
+
+func TestEnableTokenUsageTrackingWithoutUsage(t *testing.T) {
+	host, id, reset := newTrackingHost(t)
+	defer reset()
+
+	host.CallOnResponseBody(id, []byte("data: {\"choices\":[]}\n\n"), true)
+	host.CompleteHttpContext(id)
+	_, err := host.GetProperty([]string{wrapper.AILogKey})
+	assert.Error(t, err, "nothing must be logged without a usage")
+}
+
+func TestEnableTokenUsageTrackingStatistics(t *testing.T) {
+	host, id, reset := newTrackingHost(t,
+		wrapper.ProcessRequestHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			MarkRequestStart(ctx)
+			ctx.SetContext(CtxKeyRequestModel, "qwen-max")
+			return types.ActionContinue
+		}))
+	defer reset()
+
+	time.Sleep(2 * time.Millisecond)
+	host.CallOnResponseBody(id, []byte("data: {\"model\":\"qwen-max-0919\",\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"), false)
+	time.Sleep(2 * time.Millisecond)
+	host.CallOnResponseBody(id, []byte("data: {\"model\":\"qwen-max-0919\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5,\"total_tokens\":15}}\n\n"), true)
+	host.CompleteHttpContext(id)
+
+	aiLog := getAILog(t, host)
+	assert.Equal(t, ResponseTypeStream, gjson.Get(aiLog, AttrResponseType).String())
+	firstToken := gjson.Get(aiLog, AttrLLMFirstTokenDuration).Int()
+	service := gjson.Get(aiLog, AttrLLMServiceDuration).Int()
+	assert.GreaterOrEqual(t, firstToken, int64(2))
+	assert.GreaterOrEqual(t, service, firstToken+2)
+	assert.Equal(t, int64(15), gjson.Get(aiLog, CtxKeyTotalToken).Int())
+}
+
+func TestSetStatisticsAttributes(t *testing.T) {
+	var attributes map[string]interface{}
+	host, id, reset := newTrackingHost(t,
+		wrapper.ProcessResponseHeaders(func(ctx wrapper.HttpContext, config struct{}) types.Action {
+			SetStatisticsAttributes(ctx, TokenUsage{Model: "gpt-4o", InputToken: 3, OutputToken: 4, TotalToken: 7}, LLMTiming{Service: 120 * time.Millisecond})
+			attributes = ctx.GetUserAttributeMap()
+			return types.ActionContinue
+		}))
+	defer reset()
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, map[string]interface{}{
+		CtxKeyModel:            "gpt-4o",
+		CtxKeyInputToken:       int64(3),
+		CtxKeyOutputToken:      int64(4),
+		CtxKeyTotalToken:       int64(7),
+		AttrResponseType:       ResponseTypeNormal,
+		AttrLLMServiceDuration: int64(120),
+	}, attributes)
+}
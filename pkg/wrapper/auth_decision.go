@@ -0,0 +1,194 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// Challenge is an authentication challenge sent in a WWW-Authenticate header (RFC 9110), e.g.
+// `Bearer realm="gateway",error="invalid_token"`
+type Challenge struct {
+	Scheme string
+	Params [][2]string // Auth params in order, the values are quoted
+}
+
+// BearerChallenge returns the challenge of the Bearer scheme (RFC 6750), errorCode and description are
+// omitted when empty, e.g. BearerChallenge("gateway", "insufficient_scope", "")
+func BearerChallenge(realm, errorCode, description string) Challenge {
+	c := Challenge{Scheme: "Bearer", Params: [][2]string{{"realm", realm}}}
+	if errorCode != "" {
+		c.Params = append(c.Params, [2]string{"error", errorCode})
+	}
+	if description != "" {
+		c.Params = append(c.Params, [2]string{"error_description", description})
+	}
+	return c
+}
+
+// String returns the WWW-Authenticate header value of the challenge
+func (c Challenge) String() string {
+	var b strings.Builder
+	b.WriteString(c.Scheme)
+	for i, p := range c.Params {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(p[0])
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(p[1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// AuthDecision is a request rejected or redirected by an auth plugin. A nil decision lets the request
+// through, so that checks can return it as is:
+//
+//	func onHttpRequestHeaders(ctx wrapper.HttpContext, config Config) types.Action {
+//		return check(ctx, config).Send()
+//	}
+type AuthDecision struct {
+	Status     uint32         // 302 for redirects, 401 or 403 for denials
+	Detail     string         // Response code details, e.g. oidc.login, defaults to auth.<reason>
+	Location   string         // Target of a redirect
+	Challenges []Challenge    // Sent in WWW-Authenticate headers
+	Cookies    []*http.Cookie // Sent in Set-Cookie headers
+	Headers    [][2]string    // Other headers
+	Body       []byte
+}
+
+// Redirect redirects the request with 302 to location, e.g. the login page of an identity provider,
+// setting cookies such as the state of the login
+func Redirect(location string, cookies ...*http.Cookie) *AuthDecision {
+	return &AuthDecision{Status: http.StatusFound, Detail: "auth.redirect", Location: location, Cookies: cookies}
+}
+
+// Unauthorized rejects a request without valid credentials with 401
+func Unauthorized(challenges ...Challenge) *AuthDecision {
+	return &AuthDecision{Status: http.StatusUnauthorized, Detail: "auth.unauthorized", Challenges: challenges, Body: []byte("Unauthorized")}
+}
+
+// Forbidden rejects a request whose credentials are not granted access with 403
+func Forbidden(challenges ...Challenge) *AuthDecision {
+	return &AuthDecision{Status: http.StatusForbidden, Detail: "auth.forbidden", Challenges: challenges, Body: []byte("Forbidden")}
+}
+
+// WithDetail sets the response code details of the decision
+func (d *AuthDecision) WithDetail(detail string) *AuthDecision {
+	d.Detail = detail
+	return d
+}
+
+// WithCookies adds cookies to set, e.g. ClearCookie of a session that is no longer valid
+func (d *AuthDecision) WithCookies(cookies ...*http.Cookie) *AuthDecision {
+	d.Cookies = append(d.Cookies, cookies...)
+	return d
+}
+
+// ResponseHeaders returns the headers of the response of the decision. Responses setting cookies
+// are not cacheable.
+func (d *AuthDecision) ResponseHeaders() [][2]string {
+	var headers [][2]string
+	if d.Location != "" {
+		headers = append(headers, [2]string{"Location", d.Location})
+	}
+	for _, c := range d.Challenges {
+		headers = append(headers, [2]string{"WWW-Authenticate", c.String()})
+	}
+	for _, c := range d.Cookies {
+		if v := c.String(); v != "" {
+			headers = append(headers, [2]string{"Set-Cookie", v})
+		} else {
+			log.Warnf("dropping invalid cookie %q", c.Name)
+		}
+	}
+	if len(d.Cookies) > 0 {
+		headers = append(headers, [2]string{"Cache-Control", "no-store"})
+	}
+	return append(headers, d.Headers...)
+}
+
+// Send sends the response of the decision and returns ActionPause, or ActionContinue for a nil decision
+func (d *AuthDecision) Send() types.Action {
+	if d == nil {
+		return types.ActionContinue
+	}
+	if err := proxywasm.SendHttpResponseWithDetail(d.Status, d.Detail, d.ResponseHeaders(), d.Body, -1); err != nil {
+		log.Errorf("failed to send %d response: %v", d.Status, err)
+	}
+	return types.ActionPause
+}
+
+// StateCookie returns a cookie keeping state across a redirect to another site and back, e.g. the state
+// and nonce of a login. It is sent over HTTPS only, hidden from scripts, and sent with the top-level
+// navigation back to the gateway.
+func StateCookie(name, value, path string, maxAge time.Duration) *http.Cookie {
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ClearCookie returns a cookie deleting the cookie of name set on path
+func ClearCookie(name, path string) *http.Cookie {
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{Name: name, Path: path, MaxAge: -1, Secure: true, HttpOnly: true}
+}
+
+// GetRequestCookie returns the value of the cookie of name sent with the current request, empty if it is missing
+func GetRequestCookie(name string) string {
+	headers, err := proxywasm.GetHttpRequestHeaders()
+	if err != nil {
+		log.Warnf("failed to get request headers: %v", err)
+		return ""
+	}
+	return CookieValue(headers, name)
+}
+
+// CookieValue returns the value of the cookie of name in the Cookie headers, empty if it is missing
+func CookieValue(headers [][2]string, name string) string {
+	for _, h := range headers {
+		if !strings.EqualFold(h[0], "cookie") {
+			continue
+		}
+		for _, pair := range strings.Split(h[1], ";") {
+			n, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && n == name {
+				return strings.Trim(value, `"`)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestChallenge(t *testing.T) {
+	assert.Equal(t, `Bearer realm="gateway"`, BearerChallenge("gateway", "", "").String())
+	assert.Equal(t, `Bearer realm="gateway",error="insufficient_scope",error_description="needs \"admin\""`,
+		BearerChallenge("gateway", "insufficient_scope", `needs "admin"`).String())
+	assert.Equal(t, "Negotiate", Challenge{Scheme: "Negotiate"}.String())
+}
+
+func TestAuthDecisionHeaders(t *testing.T) {
+	redirect := Redirect("https://idp.example.com/authorize?state=abc", StateCookie("oidc_state", "abc", "", 10*time.Minute))
+	assert.Equal(t, [][2]string{
+		{"Location", "https://idp.example.com/authorize?state=abc"},
+		{"Set-Cookie", "oidc_state=abc; Path=/; Max-Age=600; HttpOnly; Secure; SameSite=Lax"},
+		{"Cache-Control", "no-store"},
+	}, redirect.ResponseHeaders())
+
+	denied := Forbidden(BearerChallenge("gateway", "insufficient_scope", "")).WithCookies(ClearCookie("session", "/app"))
+	assert.Equal(t, [][2]string{
+		{"WWW-Authenticate", `Bearer realm="gateway",error="insufficient_scope"`},
+		{"Set-Cookie", "session=; Path=/app; Max-Age=0; HttpOnly; Secure"},
+		{"Cache-Control", "no-store"},
+	}, denied.ResponseHeaders())
+}
+
+func TestCookieValue(t *testing.T) {
+	headers := [][2]string{{"cookie", "a=1; oidc_state=abc"}, {"Cookie", `session="xyz"`}}
+	assert.Equal(t, "abc", CookieValue(headers, "oidc_state"))
+	assert.Equal(t, "xyz", CookieValue(headers, "session"))
+	assert.Equal(t, "", CookieValue(headers, "missing"))
+}
+
+func TestAuthDecisionSend(t *testing.T) {
+	vm := NewCommonVmCtx("auth-decision-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			if GetRequestCookie("session") != "" {
+				return (*AuthDecision)(nil).Send()
+			}
+			return Redirect("/login", StateCookie("state", "abc", "", time.Minute)).WithDetail("test.login").Send()
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	assert.Equal(t, types.ActionContinue, host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"cookie", "session=1"}}, true))
+	assert.Nil(t, host.GetSentLocalResponse(id))
+
+	id = host.InitializeHttpContext()
+	assert.Equal(t, types.ActionPause, host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true))
+	if response := host.GetSentLocalResponse(id); assert.NotNil(t, response) {
+		assert.Equal(t, uint32(302), response.StatusCode)
+		assert.Equal(t, "test.login", response.StatusCodeDetail)
+		assert.Contains(t, response.Headers, [2]string{"Location", "/login"})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+type basicTelemetryOption[PluginConfig any] struct{}
+
+func (o *basicTelemetryOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.basicTelemetry = true
+}
+
+// EnableBasicTelemetry records the baseline telemetry of every request going through the plugin, with no
+// plugin code, in the histogram metrics telemetry.<plugin name>.<metric>:
+//   - request_size_bytes: the size of the headers and body received from the client
+//   - response_size_bytes: the size of the headers and body sent to the client
+//   - upstream_latency_ms: the time from the end of the request being forwarded to the arrival of the
+//     response headers, not recorded for the requests answered by the plugin
+//   - plugin_latency_ms: the time spent in the handlers of the plugin, plus the time the plugin held the
+//     end of the request or of the response until the response of its last callout arrived
+//
+// Usage in plugin init:
+//
+//	func main() {
+//	    wrapper.SetCtx(
+//	        "my-plugin",
+//	        wrapper.ParseConfig(parseConfig),
+//	        wrapper.EnableBasicTelemetry[PluginConfig](),
+//	    )
+//	}
+func EnableBasicTelemetry[PluginConfig any]() CtxOption[PluginConfig] {
+	return &basicTelemetryOption[PluginConfig]{}
+}
+
+// telemetryStats are the histograms of the requests of a VM
+type telemetryStats struct {
+	requestSize     proxywasm.MetricHistogram
+	responseSize    proxywasm.MetricHistogram
+	upstreamLatency proxywasm.MetricHistogram
+	pluginLatency   proxywasm.MetricHistogram
+}
+
+func newTelemetryStats(pluginName string) *telemetryStats {
+	define := func(name string) proxywasm.MetricHistogram {
+		return proxywasm.DefineHistogramMetric(fmt.Sprintf("telemetry.%s.%s", pluginName, name))
+	}
+	return &telemetryStats{
+		requestSize:     define("request_size_bytes"),
+		responseSize:    define("response_size_bytes"),
+		upstreamLatency: define("upstream_latency_ms"),
+		pluginLatency:   define("plugin_latency_ms"),
+	}
+}
+
+// requestTelemetry measures the latencies of a request
+type requestTelemetry struct {
+	// Time spent in the handlers and holding the request or the response
+	plugin time.Duration
+	// Since when the plugin holds the end of the request or of the response, zero when it does not
+	heldSince   time.Time
+	heldRequest bool
+	// Whether a callout ended since the plugin started holding, the hold is then over at the latest when
+	// the response of the last callout arrived
+	calloutEnded bool
+	// When the end of the request was forwarded upstream, zero until then
+	forwarded time.Time
+	upstream  time.Duration
+	// Whether the response headers came from upstream after the request was forwarded
+	upstreamMeasured bool
+}
+
+// telemetryRequests are the requests of plugins using EnableBasicTelemetry by context id, used to end the
+// hold of a request when the callouts made by the package level HttpCall and Redis functions return
+var telemetryRequests = map[uint32]*requestTelemetry{}
+
+// hold starts holding the end of the request or of the response
+func (t *requestTelemetry) hold(now time.Time, request bool) {
+	t.heldSince = now
+	t.heldRequest = request
+	t.calloutEnded = false
+}
+
+// release adds the time held until now to the time of the plugin
+func (t *requestTelemetry) release(now time.Time) {
+	if !t.heldSince.IsZero() {
+		t.plugin += now.Sub(t.heldSince)
+		t.heldSince = time.Time{}
+	}
+}
+
+// calloutDone is called when the response of a callout made in the context of the request arrives, the
+// plugin may resume the request or the response in its callback
+func (t *requestTelemetry) calloutDone() {
+	if t.heldSince.IsZero() {
+		return
+	}
+	now := time.Now()
+	t.plugin += now.Sub(t.heldSince)
+	t.heldSince = now
+	t.calloutEnded = true
+	if t.heldRequest {
+		t.forwarded = now
+	}
+}
+
+// startTelemetry measures a phase of the request, the returned function is called with the action of the
+// phase and whether it processed the end of the request or of the response. Headers that are not let
+// through are held by the plugin, and so is the end of a body.
+func (ctx *CommonHttpCtx[PluginConfig]) startTelemetry(request, headers bool) func(action types.Action, endOfStream bool) {
+	if ctx.telemetry == nil {
+		return func(types.Action, bool) {}
+	}
+	start := time.Now()
+	return func(action types.Action, endOfStream bool) {
+		t := ctx.telemetry
+		now := time.Now()
+		t.plugin += now.Sub(start)
+		if !headers && !endOfStream {
+			return
+		}
+		held := !t.heldSince.IsZero() && !t.calloutEnded
+		if action != types.ActionContinue {
+			if !held {
+				t.hold(now, request)
+			}
+			return
+		}
+		if held || !endOfStream {
+			return
+		}
+		// The callout ending the hold resumed the stream before its end arrived
+		t.heldSince = time.Time{}
+		if request {
+			t.forwarded = now
+		}
+	}
+}
+
+// telemetryResponseHeaders measures the upstream latency when the final response headers arrive, a request
+// held without callouts until then was answered by the plugin
+func (ctx *CommonHttpCtx[PluginConfig]) telemetryResponseHeaders() {
+	t := ctx.telemetry
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	if !t.heldSince.IsZero() && !t.calloutEnded {
+		t.release(now)
+		return
+	}
+	t.heldSince = time.Time{}
+	if !t.forwarded.IsZero() {
+		t.upstream = now.Sub(t.forwarded)
+		t.upstreamMeasured = true
+	}
+}
+
+// finishTelemetry records the sizes and latencies of a done request in the histograms of the VM, the traffic
+// of the request must be counted before
+func (ctx *CommonHttpCtx[PluginConfig]) finishTelemetry() {
+	t := ctx.telemetry
+	if t == nil {
+		return
+	}
+	delete(telemetryRequests, ctx.contextID)
+	// A hold ended by a callout is over when its response arrived, the callback resumed it
+	if !t.calloutEnded {
+		t.release(time.Now())
+	}
+	vm := ctx.plugin.vm
+	if vm.telemetryStats == nil {
+		vm.telemetryStats = newTelemetryStats(vm.pluginName)
+	}
+	size := ctx.traffic.size
+	vm.telemetryStats.requestSize.Record(uint64(size.RequestHeadersIn + size.RequestBodyIn))
+	vm.telemetryStats.responseSize.Record(uint64(size.ResponseHeadersOut + size.ResponseBodyOut))
+	if t.upstreamMeasured {
+		vm.telemetryStats.upstreamLatency.Record(uint64(t.upstream.Milliseconds()))
+	}
+	vm.telemetryStats.pluginLatency.Record(uint64(t.plugin.Milliseconds()))
+}
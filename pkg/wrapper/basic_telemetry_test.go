@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasicTelemetry(t *testing.T) {
+	client := NewClusterClient(FQDNCluster{FQDN: "auth.example.com", Port: 80})
+	vm := NewCommonVmCtx[struct{}]("telemetry-test",
+		EnableBasicTelemetry[struct{}](),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			if ctx.Path() == "/local" {
+				return types.ActionPause
+			}
+			client.Get("/check", nil, func(int, http.Header, []byte) {
+				proxywasm.ResumeHttpRequest()
+			})
+			return types.ActionPause
+		}),
+		ProcessStreamingResponseBody(func(ctx HttpContext, config struct{}, chunk []byte, endOfStream bool) []byte {
+			return append(chunk, chunk...)
+		}),
+		ProcessStreamDone(func(ctx HttpContext, config struct{}) {
+			assert.Nil(t, ctx.GetTrafficSize(), "the sizes are only exposed with WithTrafficAccounting")
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	histogram := func(name string) uint64 {
+		value, err := host.GetHistogramMetric("telemetry.telemetry-test." + name)
+		require.NoError(t, err)
+		return value
+	}
+
+	// The request is held until the response of the callout arrives, then forwarded upstream
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	time.Sleep(30 * time.Millisecond)
+	for _, callout := range host.GetCalloutAttributesFromContext(id) {
+		host.CallOnHttpCallResponse(callout.CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	}
+	time.Sleep(10 * time.Millisecond)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, false)
+	host.CallOnResponseBody(id, []byte("abc"), true)
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, uint64(len(":authority"+"example.com"+":path"+"/")), histogram("request_size_bytes"))
+	assert.Equal(t, uint64(len(":status"+"200")+6), histogram("response_size_bytes"))
+	upstream := histogram("upstream_latency_ms")
+	assert.GreaterOrEqual(t, upstream, uint64(10))
+	assert.Less(t, upstream, uint64(30), "the time the plugin held the request is not upstream latency")
+	plugin := histogram("plugin_latency_ms")
+	assert.GreaterOrEqual(t, plugin, uint64(30))
+	assert.Less(t, plugin, uint64(40), "the upstream latency is not added by the plugin")
+
+	// A request answered by the plugin has no upstream latency
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/local"}}, false)
+	host.CallOnRequestBody(id, []byte("hello"), true)
+	time.Sleep(20 * time.Millisecond)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "403"}}, true)
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, uint64(len(":authority"+"example.com"+":path"+"/local")+5), histogram("request_size_bytes"))
+	assert.Equal(t, upstream, histogram("upstream_latency_ms"))
+	assert.GreaterOrEqual(t, histogram("plugin_latency_ms"), uint64(20))
+	assert.Empty(t, telemetryRequests)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// ErrBodyIntegrity is returned for bodies that do not match their digest headers
+var ErrBodyIntegrity = errors.New("body does not match its digest")
+
+// bodyDigestAlgorithms are the digest algorithms verified, by their lowercase names
+var bodyDigestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// BodyDigest returns the base64 digest of a body with an algorithm of the Digest and Content-Digest
+// headers: md5, sha-256 or sha-512.
+func BodyDigest(algorithm string, body []byte) (string, error) {
+	newHash, ok := bodyDigestAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return "", fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+	h := newHash()
+	h.Write(body)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// BodyDigestHeaders returns the Content-MD5 and Content-Digest (RFC 9530, with sha-256) headers of a
+// body, e.g. for callouts to integrity-sensitive upstreams.
+func BodyDigestHeaders(body []byte) [][2]string {
+	md5Digest, _ := BodyDigest("md5", body)
+	sha256Digest, _ := BodyDigest("sha-256", body)
+	return [][2]string{{"content-md5", md5Digest}, {"content-digest", "sha-256=:" + sha256Digest + ":"}}
+}
+
+// VerifyBodyIntegrity checks a body against the Content-MD5, Digest (RFC 3230) and Content-Digest
+// (RFC 9530) headers. Digests of unsupported algorithms are ignored. It returns whether a digest was
+// checked, and an error wrapping ErrBodyIntegrity for the first one that does not match.
+func VerifyBodyIntegrity(headers [][2]string, body []byte) (bool, error) {
+	checked := false
+	for _, h := range headers {
+		var digests [][2]string
+		switch strings.ToLower(h[0]) {
+		case "content-md5":
+			digests = [][2]string{{"md5", strings.TrimSpace(h[1])}}
+		case "digest":
+			for _, item := range strings.Split(h[1], ",") {
+				algorithm, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+				digests = append(digests, [2]string{algorithm, value})
+			}
+		case "content-digest":
+			for _, item := range strings.Split(h[1], ",") {
+				algorithm, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+				// The values are structured field byte sequences, :base64:
+				digests = append(digests, [2]string{algorithm, strings.Trim(value, ":")})
+			}
+		default:
+			continue
+		}
+		for _, digest := range digests {
+			expected, err := BodyDigest(digest[0], body)
+			if err != nil {
+				continue
+			}
+			checked = true
+			if subtle.ConstantTimeCompare([]byte(expected), []byte(digest[1])) != 1 {
+				return true, fmt.Errorf("%w: %s %s of %s", ErrBodyIntegrity, h[0], strings.ToLower(digest[0]), digest[1])
+			}
+		}
+	}
+	return checked, nil
+}
+
+// CheckRequestBodyIntegrity verifies the buffered request body against the digest headers of the
+// request, it should be called in the request body phase. A mismatch is rejected with 400 and
+// ActionPause is returned, otherwise ActionContinue.
+func CheckRequestBodyIntegrity(body []byte) types.Action {
+	headers, err := proxywasm.GetHttpRequestHeaders()
+	if err != nil {
+		log.Warnf("failed to get request headers: %v", err)
+		return types.ActionContinue
+	}
+	if _, err := VerifyBodyIntegrity(headers, body); err != nil {
+		log.Warnf("rejecting request: %v", err)
+		_ = proxywasm.SendHttpResponseWithDetail(http.StatusBadRequest, "body_integrity.mismatch", nil, []byte(ErrBodyIntegrity.Error()), -1)
+		return types.ActionPause
+	}
+	return types.ActionContinue
+}
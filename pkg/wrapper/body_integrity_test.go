@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestBodyDigest(t *testing.T) {
+	// echo -n hello | openssl dgst -md5 -binary | base64
+	digest, err := BodyDigest("MD5", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "XUFAKrxLKna5cZ2REBfFkg==", digest)
+	digest, err = BodyDigest("sha-256", []byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=", digest)
+	_, err = BodyDigest("crc32", []byte("hello"))
+	assert.Error(t, err)
+
+	assert.Equal(t, [][2]string{{"content-md5", "XUFAKrxLKna5cZ2REBfFkg=="},
+		{"content-digest", "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:"}}, BodyDigestHeaders([]byte("hello")))
+}
+
+func TestVerifyBodyIntegrity(t *testing.T) {
+	body := []byte("hello")
+	tests := []struct {
+		name    string
+		headers [][2]string
+		checked bool
+		wantErr bool
+	}{
+		{"no digest", [][2]string{{"content-type", "text/plain"}}, false, false},
+		{"content-md5", [][2]string{{"Content-MD5", "XUFAKrxLKna5cZ2REBfFkg=="}}, true, false},
+		{"content-md5 mismatch", [][2]string{{"Content-MD5", "AAAAKrxLKna5cZ2REBfFkg=="}}, true, true},
+		{"digest", [][2]string{{"Digest", "SHA-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=, MD5=XUFAKrxLKna5cZ2REBfFkg=="}}, true, false},
+		{"digest mismatch", [][2]string{{"Digest", "SHA-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=, MD5=AAAA"}}, true, true},
+		{"content-digest", [][2]string{{"Content-Digest", "sha-256=:LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=:"}}, true, false},
+		{"unsupported algorithm", [][2]string{{"Content-Digest", "crc32c=:AAAA:"}}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checked, err := VerifyBodyIntegrity(tt.headers, body)
+			assert.Equal(t, tt.checked, checked)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBodyIntegrity)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckRequestBodyIntegrity(t *testing.T) {
+	vm := NewCommonVmCtx("body-integrity-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessRequestBody(func(ctx HttpContext, config struct{}, body []byte) types.Action {
+			return CheckRequestBodyIntegrity(body)
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {":method", "POST"},
+		{"content-md5", "XUFAKrxLKna5cZ2REBfFkg=="}}, false)
+	assert.Equal(t, types.ActionContinue, host.CallOnRequestBody(id, []byte("hello"), true))
+	assert.Nil(t, host.GetSentLocalResponse(id))
+
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {":method", "POST"},
+		{"content-md5", "XUFAKrxLKna5cZ2REBfFkg=="}}, false)
+	host.CallOnRequestBody(id, []byte("hellO"), true)
+	if response := host.GetSentLocalResponse(id); assert.NotNil(t, response) {
+		assert.Equal(t, uint32(400), response.StatusCode)
+		assert.Equal(t, "body_integrity.mismatch", response.StatusCodeDetail)
+	}
+}
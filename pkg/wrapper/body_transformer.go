@@ -0,0 +1,542 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	template "github.com/higress-group/gjson_template"
+	"github.com/higress-group/gjson_template/parse"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+type BodyOp string
+
+const (
+	BodyOpExtract  BodyOp = "extract"  // Replace the body with the value at path
+	BodyOpMove     BodyOp = "move"     // Move the value at path to another path
+	BodyOpDelete   BodyOp = "delete"   // Delete the value at path
+	BodyOpRename   BodyOp = "rename"   // Rename the last key of path, keeping it in the same object
+	BodyOpSet      BodyOp = "set"      // Set the value at path to a JSON value
+	BodyOpTemplate BodyOp = "template" // Replace the body with a template rendered with the body
+	BodyOpStage    BodyOp = "stage"    // Run a stage added with BodyTransformer.Then
+)
+
+// BodyRule is a single body transformation step, paths are kept in gjson/sjson syntax.
+type BodyRule struct {
+	Op    BodyOp
+	Path  string
+	To    string
+	Value []byte
+
+	template *template.Template
+	stage    BodyStage
+}
+
+// BodyStage is a transformation step written in Go, it returns the new body
+type BodyStage func(body []byte) ([]byte, error)
+
+// BodyTransformer applies an ordered list of JSON body rules. Paths are written as JSONPath
+// with dot and bracket notation, e.g.
+//
+//	[
+//	  {"op": "extract", "path": "$.data"},
+//	  {"op": "move", "path": "$.items[0].id", "to": "$.firstId"},
+//	  {"op": "rename", "path": "$['user.name']", "to": "userName"},
+//	  {"op": "delete", "path": "$.debug"},
+//	  {"op": "set", "path": "$.stream", "value": false},
+//	  {"op": "template", "template": "{\"input\":\"{{.prompt}}\",\"n\":{{.n}}}"}
+//	]
+//
+// Templates are rendered with gjson_template, where {{.a.b}} reads the body at the gjson path a.b.
+// The values are written as JSON: JSON-escaped within a string of the template, e.g. "{{.prompt}}",
+// and elsewhere as JSON values, strings being quoted. Rules other than set whose path does not exist in the body are skipped.
+type BodyTransformer struct {
+	Rules []BodyRule
+	// MaxDecompressedSize is the size of the largest gzip encoded body decompressed to be transformed,
+	// DefaultMaxDecompressedSize when not set. Larger bodies are passed through untransformed.
+	MaxDecompressedSize int
+}
+
+// ParseBodyTransformer parses an array of body rules.
+func ParseBodyTransformer(json gjson.Result) (*BodyTransformer, error) {
+	if !json.Exists() {
+		return &BodyTransformer{}, nil
+	}
+	if !json.IsArray() {
+		return nil, configerr.New("", "array", fmt.Errorf("body rules must be an array"))
+	}
+	transformer := &BodyTransformer{}
+	for i, item := range json.Array() {
+		rule, err := parseBodyRule(item)
+		if err != nil {
+			return nil, configerr.Prefix(configerr.Pointer(i), err)
+		}
+		transformer.Rules = append(transformer.Rules, rule)
+	}
+	return transformer, nil
+}
+
+func parseBodyRule(json gjson.Result) (BodyRule, error) {
+	if !json.IsObject() {
+		return BodyRule{}, configerr.New("", "object", fmt.Errorf("body rule must be an object"))
+	}
+	rule := BodyRule{Op: BodyOp(json.Get("op").String())}
+	if rule.Op == BodyOpTemplate {
+		tmpl, err := template.New("body").Funcs(bodyTemplateFuncs).Parse(json.Get("template").String())
+		if err != nil {
+			return rule, configerr.New("/template", "template", err)
+		}
+		if tmpl.Tree != nil {
+			escapeBodyTemplate(tmpl.Tree.Root, false)
+		}
+		rule.template = tmpl
+		return rule, nil
+	}
+	path, err := jsonPathToGjson(json.Get("path").String())
+	if err != nil {
+		return rule, configerr.New("/path", "JSONPath", err)
+	}
+	rule.Path = path
+	to := json.Get("to").String()
+	switch rule.Op {
+	case BodyOpSet:
+		value := json.Get("value")
+		if !value.Exists() {
+			return rule, configerr.Errorf("/value", "JSON value", "set body rule requires a value")
+		}
+		rule.Value = []byte(value.Raw)
+	case BodyOpExtract, BodyOpDelete:
+		if path == "" && rule.Op == BodyOpDelete {
+			return rule, configerr.Errorf("/path", "JSONPath", "the root can not be deleted")
+		}
+	case BodyOpMove:
+		if rule.To, err = jsonPathToGjson(to); err != nil {
+			return rule, configerr.New("/to", "JSONPath", err)
+		}
+		if path == "" || rule.To == "" {
+			return rule, configerr.Errorf("/to", "JSONPath", "the root can not be moved")
+		}
+	case BodyOpRename:
+		if path == "" {
+			return rule, configerr.Errorf("/path", "JSONPath", "the root can not be renamed")
+		}
+		if to == "" {
+			return rule, configerr.Errorf("/to", "string", "rename body rule requires a new key")
+		}
+		if i := lastPathSeparator(path); i >= 0 {
+			rule.To = path[:i+1] + gjson.Escape(to)
+		} else {
+			rule.To = gjson.Escape(to)
+		}
+	default:
+		return rule, configerr.Errorf("/op", "one of extract, move, delete, rename, set, template", "unknown body rule op: %s", rule.Op)
+	}
+	return rule, nil
+}
+
+const (
+	bodyTemplateStringFunc = "bodyTemplateString"
+	bodyTemplateValueFunc  = "bodyTemplateValue"
+)
+
+// bodyTemplateFuncs write the values of the actions of body templates as JSON, see escapeBodyTemplate
+var bodyTemplateFuncs = template.FuncMap{
+	// The value within a JSON string, escaped
+	bodyTemplateStringFunc: func(values ...any) string {
+		if len(values) == 0 || values[0] == nil {
+			return ""
+		}
+		escaped := jsonEncode(fmt.Sprint(values[0]))
+		return escaped[1 : len(escaped)-1]
+	},
+	// The value as a JSON value. Objects and arrays are passed as their JSON, so that a string holding a
+	// JSON object or array is written as it is.
+	bodyTemplateValueFunc: func(values ...any) string {
+		if len(values) == 0 || values[0] == nil {
+			return "null"
+		}
+		if s, ok := values[0].(string); ok {
+			if trimmed := strings.TrimSpace(s); (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && gjson.Valid(trimmed) {
+				return s
+			}
+			return jsonEncode(s)
+		}
+		return jsonEncode(values[0])
+	},
+}
+
+// jsonEncode returns the JSON of a value without escaping HTML characters
+func jsonEncode(value any) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(value)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// escapeBodyTemplate pipes the values written by the actions of a template to the funcs of
+// bodyTemplateFuncs, depending on whether the text before them leaves them within a JSON string,
+// so that values can not change the structure of the rendered JSON. It returns whether the end of
+// the list is within a string.
+func escapeBodyTemplate(list *parse.ListNode, inString bool) bool {
+	if list == nil {
+		return inString
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			for i := 0; i < len(n.Text); i++ {
+				switch {
+				case inString && n.Text[i] == '\\':
+					i++
+				case n.Text[i] == '"':
+					inString = !inString
+				}
+			}
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 {
+				continue
+			}
+			name := bodyTemplateValueFunc
+			if inString {
+				name = bodyTemplateStringFunc
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(name).SetPos(n.Pos)},
+			})
+		case *parse.IfNode:
+			escapeBodyTemplate(n.ElseList, inString)
+			inString = escapeBodyTemplate(n.List, inString)
+		case *parse.RangeNode:
+			escapeBodyTemplate(n.ElseList, inString)
+			inString = escapeBodyTemplate(n.List, inString)
+		case *parse.WithNode:
+			escapeBodyTemplate(n.ElseList, inString)
+			inString = escapeBodyTemplate(n.List, inString)
+		}
+	}
+	return inString
+}
+
+// jsonPathToGjson converts a JSONPath such as $.a['b.c'][0] to the gjson path a.b\.c.0
+func jsonPathToGjson(expr string) (string, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if expr[0] != '$' {
+		return "", fmt.Errorf("path must start with $: %s", expr)
+	}
+	var keys []string
+	for i := 1; i < len(expr); {
+		switch expr[i] {
+		case '.':
+			end := i + 1
+			for end < len(expr) && expr[end] != '.' && expr[end] != '[' {
+				end++
+			}
+			key := expr[i+1 : end]
+			if key == "" || key == "*" {
+				return "", fmt.Errorf("unsupported path segment at offset %d: %s", i, expr)
+			}
+			keys = append(keys, gjson.Escape(key))
+			i = end
+		case '[':
+			end := strings.IndexByte(expr[i:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed bracket at offset %d: %s", i, expr)
+			}
+			inner := expr[i+1 : i+end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				keys = append(keys, gjson.Escape(inner[1:len(inner)-1]))
+			} else if index, err := strconv.Atoi(inner); err == nil && index >= 0 {
+				keys = append(keys, inner)
+			} else {
+				return "", fmt.Errorf("unsupported path segment at offset %d: %s", i, expr)
+			}
+			i += end + 1
+		default:
+			return "", fmt.Errorf("unexpected character at offset %d: %s", i, expr)
+		}
+	}
+	return strings.Join(keys, "."), nil
+}
+
+// lastPathSeparator returns the index of the last unescaped dot of a gjson path, or -1
+func lastPathSeparator(path string) int {
+	last := -1
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' {
+			i++
+		} else if path[i] == '.' {
+			last = i
+		}
+	}
+	return last
+}
+
+// Then adds a stage run after the rules added before it.
+func (t *BodyTransformer) Then(stage BodyStage) *BodyTransformer {
+	t.Rules = append(t.Rules, BodyRule{Op: BodyOpStage, stage: stage})
+	return t
+}
+
+// Transform returns the body after applying all rules.
+func (t *BodyTransformer) Transform(body []byte) ([]byte, error) {
+	if len(t.Rules) == 0 {
+		return body, nil
+	}
+	if !gjson.ValidBytes(body) {
+		return nil, fmt.Errorf("body is not a valid json")
+	}
+	var err error
+	for _, rule := range t.Rules {
+		if body, err = rule.apply(body); err != nil {
+			return nil, fmt.Errorf("failed to %s %s: %v", rule.Op, rule.Path, err)
+		}
+	}
+	return body, nil
+}
+
+func (r BodyRule) apply(body []byte) ([]byte, error) {
+	switch r.Op {
+	case BodyOpStage:
+		return r.stage(body)
+	case BodyOpTemplate:
+		var buf bytes.Buffer
+		if err := r.template.Execute(&buf, body); err != nil {
+			return nil, err
+		}
+		if !gjson.ValidBytes(buf.Bytes()) {
+			return nil, fmt.Errorf("template did not render a valid json: %s", buf.String())
+		}
+		return buf.Bytes(), nil
+	case BodyOpSet:
+		if r.Path == "" {
+			return r.Value, nil
+		}
+		return sjson.SetRawBytes(body, r.Path, r.Value)
+	}
+	if r.Path == "" {
+		// Extracting the root keeps the body as it is
+		return body, nil
+	}
+	value := gjson.GetBytes(body, r.Path)
+	if !value.Exists() {
+		return body, nil
+	}
+	switch r.Op {
+	case BodyOpExtract:
+		return []byte(value.Raw), nil
+	case BodyOpDelete:
+		return sjson.DeleteBytes(body, r.Path)
+	case BodyOpMove, BodyOpRename:
+		if r.To == r.Path {
+			return body, nil
+		}
+		body, err := sjson.DeleteBytes(body, r.Path)
+		if err != nil {
+			return nil, err
+		}
+		return sjson.SetRawBytes(body, r.To, []byte(value.Raw))
+	}
+	return body, nil
+}
+
+// ApplyToRequestHeaders prepares the request for a transformed body, it should be called in the
+// request headers phase. The content-length header is removed since the length of the body changes.
+func (t *BodyTransformer) ApplyToRequestHeaders() {
+	if len(t.Rules) > 0 {
+		_ = proxywasm.RemoveHttpRequestHeader("content-length")
+	}
+}
+
+// ApplyToResponseHeaders prepares the response for a transformed body, it should be called in the
+// response headers phase.
+func (t *BodyTransformer) ApplyToResponseHeaders() {
+	if len(t.Rules) > 0 {
+		_ = proxywasm.RemoveHttpResponseHeader("content-length")
+	}
+}
+
+// ApplyToRequestBody transforms and replaces the request body, it should be called in the request body phase.
+// A gzip encoded body is decompressed before and compressed again after the transformation.
+func (t *BodyTransformer) ApplyToRequestBody(body []byte) error {
+	if len(t.Rules) == 0 {
+		return nil
+	}
+	encoding, _ := proxywasm.GetHttpRequestHeader("content-encoding")
+	transformed, err := t.transformEncoded(body, encoding)
+	if errors.Is(err, errDecompressedBodyTooLarge) {
+		log.Warnf("request body passed untransformed: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = proxywasm.ReplaceHttpRequestBody(transformed); err != nil {
+		return fmt.Errorf("failed to replace request body: %v", err)
+	}
+	return nil
+}
+
+// ApplyToResponseBody transforms and replaces the response body, it should be called in the response body phase.
+// A gzip encoded body is decompressed before and compressed again after the transformation.
+func (t *BodyTransformer) ApplyToResponseBody(body []byte) error {
+	if len(t.Rules) == 0 {
+		return nil
+	}
+	encoding, _ := proxywasm.GetHttpResponseHeader("content-encoding")
+	transformed, err := t.transformEncoded(body, encoding)
+	if errors.Is(err, errDecompressedBodyTooLarge) {
+		log.Warnf("response body passed untransformed: %v", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = proxywasm.ReplaceHttpResponseBody(transformed); err != nil {
+		return fmt.Errorf("failed to replace response body: %v", err)
+	}
+	return nil
+}
+
+func (t *BodyTransformer) transformEncoded(body []byte, encoding string) ([]byte, error) {
+	if !strings.EqualFold(strings.TrimSpace(encoding), "gzip") {
+		return t.Transform(body)
+	}
+	limit := t.MaxDecompressedSize
+	if limit <= 0 {
+		limit = DefaultMaxDecompressedSize
+	}
+	decoded, err := decodeContentEncoding("gzip", body, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress gzip body: %w", err)
+	}
+	transformed, err := t.Transform(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return gzipBytes(transformed)
+}
+
+func gzipBytes(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyToStreamingRequestBody transforms a chunk of a streaming request body, see ApplyToStreamingResponseBody.
+func (t *BodyTransformer) ApplyToStreamingRequestBody(ctx HttpContext, chunk []byte, endOfStream bool) []byte {
+	return t.transformLines(ctx, "request", chunk, endOfStream)
+}
+
+// ApplyToStreamingResponseBody transforms a chunk of a streaming response body and returns the chunk to
+// send, it should be called in the streaming response body phase. The body is transformed line by line:
+// the JSON of SSE data lines and of NDJSON lines is transformed, other lines are passed as they are. A
+// line split across chunks is held until it is complete. Streams with a content-encoding, e.g. gzip,
+// are not transformed.
+func (t *BodyTransformer) ApplyToStreamingResponseBody(ctx HttpContext, chunk []byte, endOfStream bool) []byte {
+	return t.transformLines(ctx, "response", chunk, endOfStream)
+}
+
+func (t *BodyTransformer) transformLines(ctx HttpContext, direction string, chunk []byte, endOfStream bool) []byte {
+	if len(t.Rules) == 0 || streamEncoded(ctx, direction) {
+		return chunk
+	}
+	key := "body_transformer_pending_" + direction
+	if pending, ok := ctx.GetContext(key).([]byte); ok && len(pending) > 0 {
+		chunk = append(pending, chunk...)
+	}
+	rest := []byte(nil)
+	if !endOfStream {
+		end := bytes.LastIndexByte(chunk, '\n') + 1
+		rest = append(rest, chunk[end:]...)
+		chunk = chunk[:end]
+	}
+	ctx.SetContext(key, rest)
+	var out []byte
+	for len(chunk) > 0 {
+		line := chunk
+		if i := bytes.IndexByte(chunk, '\n'); i >= 0 {
+			line = chunk[:i+1]
+		}
+		chunk = chunk[len(line):]
+		out = append(out, t.transformLine(line)...)
+	}
+	return out
+}
+
+// streamEncoded tells whether the body of the direction has a content-encoding, read once per stream
+func streamEncoded(ctx HttpContext, direction string) bool {
+	key := "body_transformer_encoded_" + direction
+	if encoded, ok := ctx.GetContext(key).(bool); ok {
+		return encoded
+	}
+	get := proxywasm.GetHttpResponseHeader
+	if direction == "request" {
+		get = proxywasm.GetHttpRequestHeader
+	}
+	encoding, _ := get("content-encoding")
+	encoding = strings.TrimSpace(encoding)
+	encoded := encoding != "" && !strings.EqualFold(encoding, "identity")
+	if encoded {
+		log.Debugf("streaming %s body with content-encoding %s is not transformed", direction, encoding)
+	}
+	ctx.SetContext(key, encoded)
+	return encoded
+}
+
+// transformLine transforms the JSON of an SSE data line or an NDJSON line, keeping its line ending
+func (t *BodyTransformer) transformLine(line []byte) []byte {
+	content := bytes.TrimRight(line, "\r\n")
+	ending := line[len(content):]
+	prefix := []byte(nil)
+	payload := content
+	if bytes.HasPrefix(content, []byte("data:")) {
+		payload = bytes.TrimPrefix(bytes.TrimPrefix(content, []byte("data:")), []byte(" "))
+		prefix = content[:len(content)-len(payload)]
+	}
+	if !gjson.ValidBytes(payload) || !bytes.HasPrefix(bytes.TrimSpace(payload), []byte("{")) {
+		return line
+	}
+	transformed, err := t.Transform(payload)
+	if err != nil {
+		log.Warnf("failed to transform streaming body line: %v", err)
+		return line
+	}
+	out := append(append([]byte(nil), prefix...), transformed...)
+	return append(out, ending...)
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+func TestJsonPathToGjson(t *testing.T) {
+	tests := map[string]string{
+		"$":                 "",
+		"$.a.b":             "a.b",
+		"$.items[0].id":     "items.0.id",
+		"$['user.name']":    `user\.name`,
+		`$["a*"].b`:         `a\*.b`,
+		"$.data['x-token']": "data.x-token",
+	}
+	for expr, expected := range tests {
+		path, err := jsonPathToGjson(expr)
+		assert.NoError(t, err, expr)
+		assert.Equal(t, expected, path, expr)
+	}
+	for _, expr := range []string{"", "a.b", "$..a", "$.a[", "$.a[*]", "$.*"} {
+		_, err := jsonPathToGjson(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestBodyTransformer(t *testing.T) {
+	transformer, err := ParseBodyTransformer(gjson.Parse(`[
+		{"op": "extract", "path": "$.data"},
+		{"op": "move", "path": "$.items[0].id", "to": "$.meta.firstId"},
+		{"op": "rename", "path": "$.meta['user.name']", "to": "userName"},
+		{"op": "delete", "path": "$.debug"},
+		{"op": "delete", "path": "$.missing"}
+	]`))
+	assert.NoError(t, err)
+
+	body, err := transformer.Transform([]byte(`{"data":{"items":[{"id":1,"v":"a"}],"meta":{"user.name":"bob"},"debug":true},"code":0}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"items":[{"v":"a"}],"meta":{"userName":"bob","firstId":1}}`, string(body))
+
+	_, err = transformer.Transform([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestParseBodyTransformerErrors(t *testing.T) {
+	tests := []struct {
+		config  string
+		pointer string
+	}{
+		{`{"op": "delete"}`, "/"},
+		{`[{"op": "delete", "path": "a"}]`, "/0/path"},
+		{`[{"op": "delete", "path": "$"}]`, "/0/path"},
+		{`[{"op": "move", "path": "$.a"}]`, "/0/to"},
+		{`[{"op": "rename", "path": "$.a"}]`, "/0/to"},
+		{`[{"op": "copy", "path": "$.a"}]`, "/0/op"},
+	}
+	for _, tt := range tests {
+		_, err := ParseBodyTransformer(gjson.Parse(tt.config))
+		assert.ErrorContains(t, err, `"`+tt.pointer+`"`, tt.config)
+	}
+}
+
+func TestBodyTransformerStages(t *testing.T) {
+	transformer, err := ParseBodyTransformer(gjson.Parse(`[
+		{"op": "set", "path": "$.n", "value": 2},
+		{"op": "template", "template": "{\"input\":\"{{.prompt}}\",\"n\":{{.n}},\"debug\":true}"},
+		{"op": "delete", "path": "$.debug"}
+	]`))
+	require.NoError(t, err)
+	transformer.Then(func(body []byte) ([]byte, error) {
+		return sjson.SetBytes(body, "stage", "go")
+	})
+
+	body, err := transformer.Transform([]byte(`{"prompt":"hi","n":1}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"input":"hi","n":2,"stage":"go"}`, string(body))
+
+	_, err = ParseBodyTransformer(gjson.Parse(`[{"op": "set", "path": "$.a"}]`))
+	assert.ErrorContains(t, err, `"/0/value"`)
+	_, err = ParseBodyTransformer(gjson.Parse(`[{"op": "template", "template": "{{.a"}]`))
+	assert.ErrorContains(t, err, `"/0/template"`)
+}
+
+func TestBodyTransformerTemplateEscaping(t *testing.T) {
+	transformer, err := ParseBodyTransformer(gjson.Parse(`[{"op": "template", "template": ` +
+		`"{\"input\":\"say {{.prompt}}\",\"raw\":{{.prompt}},\"n\":{{.n}},\"obj\":{{.obj}},\"missing\":{{.missing}},` +
+		`\"items\":[{{range $i, $v := .items}}{{if $i}},{{end}}\"{{$v}}\"{{end}}]}"}]`))
+	require.NoError(t, err)
+
+	body, err := transformer.Transform([]byte(`{"prompt":"hi\",\"admin\":true,\"x\":\"","n":1.5,"obj":{"a":"q\"uote"},"items":["a\"b","c"]}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"input": "say hi\",\"admin\":true,\"x\":\"",
+		"raw": "hi\",\"admin\":true,\"x\":\"",
+		"n": 1.5,
+		"obj": {"a": "q\"uote"},
+		"missing": null,
+		"items": ["a\"b", "c"]
+	}`, string(body), "substituted values can not change the structure of the body")
+}
+
+func TestBodyTransformerGzip(t *testing.T) {
+	transformer, err := ParseBodyTransformer(gjson.Parse(`[{"op": "delete", "path": "$.debug"}]`))
+	require.NoError(t, err)
+	compressed, err := gzipBytes([]byte(`{"a":1,"debug":true}`))
+	require.NoError(t, err)
+
+	body, err := transformer.transformEncoded(compressed, "gzip")
+	require.NoError(t, err)
+	decoded, err := decodeContentEncoding("gzip", body, DefaultMaxDecompressedSize)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":1}`, string(decoded))
+
+	_, err = transformer.transformEncoded([]byte(`{"a":1}`), "gzip")
+	assert.ErrorContains(t, err, "failed to decompress gzip body")
+
+	// A body decompressing to more than the limit is passed through untransformed
+	transformer.MaxDecompressedSize = 1024
+	oversized, err := gzipBytes([]byte(`{"a":"` + strings.Repeat("x", 4096) + `","debug":true}`))
+	require.NoError(t, err)
+	_, err = transformer.transformEncoded(oversized, "gzip")
+	assert.ErrorIs(t, err, errDecompressedBodyTooLarge)
+
+	var applied bool
+	vm := NewCommonVmCtx("body-transformer-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessResponseHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			applied = true
+			assert.NoError(t, transformer.ApplyToResponseBody(oversized))
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-encoding", "gzip"}}, false)
+	assert.True(t, applied)
+	assert.Empty(t, host.GetCurrentResponseBody(id), "the body is not replaced")
+}
+
+func TestBodyTransformerStreaming(t *testing.T) {
+	transformer, err := ParseBodyTransformer(gjson.Parse(`[{"op": "delete", "path": "$.usage"}]`))
+	require.NoError(t, err)
+	var chunks [][]byte
+	vm := NewCommonVmCtx("body-transformer-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessResponseHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			transformer.ApplyToResponseHeaders()
+			return types.ActionContinue
+		}),
+		ProcessStreamingResponseBody(func(ctx HttpContext, config struct{}, chunk []byte, isLastChunk bool) []byte {
+			out := transformer.ApplyToStreamingResponseBody(ctx, chunk, isLastChunk)
+			chunks = append(chunks, out)
+			return out
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer func() { reset() }()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-length", "100"}}, false)
+	assert.Empty(t, headerValue(host.GetCurrentResponseHeaders(id), "content-length"))
+	host.CallOnResponseBody(id, []byte("data: {\"a\":1,\"usage\":{}}\n\ndata: {\"b\""), false)
+	host.CallOnResponseBody(id, []byte(":2,\"usage\":{}}\n\ndata: [DONE]"), true)
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, []string{"data: {\"a\":1}\n\n", "data: {\"b\":2}\n\ndata: [DONE]"}, []string{string(chunks[0]), string(chunks[1])})
+
+	// Compressed streams are passed as they are, the wrapper does not pass them to the body handlers
+	compressed, err := gzipBytes([]byte("data: {\"a\":1,\"usage\":{}}\n\n"))
+	require.NoError(t, err)
+	var out []byte
+	vm = NewCommonVmCtx("body-transformer-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessResponseHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			out = transformer.ApplyToStreamingResponseBody(ctx, compressed, true)
+			return types.ActionContinue
+		}),
+	)
+	reset()
+	host, reset = proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-encoding", "gzip"}}, false)
+	host.CompleteHttpContext(id)
+	assert.Equal(t, compressed, out)
+}
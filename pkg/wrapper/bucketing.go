@@ -0,0 +1,104 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"hash/fnv"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+)
+
+// BucketSource selects what identifies the client of a request when it is bucketed
+type BucketSource string
+
+const (
+	// BucketByConsumer buckets by the consumer authenticated by the gateway, in the x-mse-consumer header
+	BucketByConsumer BucketSource = "consumer"
+	// BucketByIP buckets by the client IP selected by Bucketing.RemoteIP, the source address by default
+	BucketByIP BucketSource = "ip"
+	// BucketByHeader buckets by the value of Bucketing.Header
+	BucketByHeader BucketSource = "header"
+
+	// BucketCount is the number of buckets, the bucket of a request is in [0, BucketCount)
+	BucketCount = 100
+	// BucketAttributePrefix is the prefix of the user attribute holding the bucket of a request,
+	// followed by Bucketing.Name
+	BucketAttributePrefix = "bucket."
+
+	consumerHeader = "x-mse-consumer"
+)
+
+// Bucketing assigns requests to buckets by consistent hashing of their client for the gradual rollout
+// of a feature, e.g. in a plugin config:
+//
+//	{"name": "new-prompt", "source": "header", "header": "x-user-id", "salt": "2024-06", "percentage": 10}
+//
+// A client stays in its bucket, so raising the percentage only adds clients to the rollout. Rollouts
+// with different salts select independent sets of clients. Requests without a client key are never
+// in the rollout.
+type Bucketing struct {
+	// Name of the rollout, the bucket is written to the user attribute bucket.<name>
+	Name   string       `json:"name"`
+	Source BucketSource `json:"source" default:"consumer" enum:"consumer,ip,header"`
+	Header string       `json:"header"`
+	Salt   string       `json:"salt"`
+	// Percentage of the clients in the rollout
+	Percentage int `json:"percentage" min:"0" max:"100"`
+	// RemoteIP selects the client IP of the ip source
+	RemoteIP RemoteIP `json:"remoteIP"`
+}
+
+// Bucket returns the bucket of the client key
+func (b *Bucketing) Bucket(key string) int {
+	h := fnv.New64a()
+	h.Write([]byte(b.Salt))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum64() % BucketCount)
+}
+
+// InRollout tells whether the client key is in the rollout
+func (b *Bucketing) InRollout(key string) bool {
+	return key != "" && b.Bucket(key) < b.Percentage
+}
+
+// Key returns the client key of the current request, empty if it has none
+func (b *Bucketing) Key() string {
+	switch b.Source {
+	case BucketByIP:
+		return b.RemoteIP.String()
+	case BucketByHeader:
+		if b.Header == "" {
+			return ""
+		}
+		value, _ := proxywasm.GetHttpRequestHeader(b.Header)
+		return value
+	default:
+		value, _ := proxywasm.GetHttpRequestHeader(consumerHeader)
+		return value
+	}
+}
+
+// Assign buckets the current request and writes its bucket to the user attribute bucket.<name>. It
+// returns -1 and false for requests without a client key.
+func (b *Bucketing) Assign(ctx HttpContext) (int, bool) {
+	key := b.Key()
+	if key == "" {
+		return -1, false
+	}
+	bucket := b.Bucket(key)
+	ctx.SetUserAttribute(BucketAttributePrefix+b.Name, bucket)
+	return bucket, bucket < b.Percentage
+}
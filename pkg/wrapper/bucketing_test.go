@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketingRollout(t *testing.T) {
+	b := &Bucketing{Salt: "a", Percentage: 20}
+	in := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		bucket := b.Bucket(key)
+		require.True(t, bucket >= 0 && bucket < BucketCount)
+		assert.Equal(t, bucket, b.Bucket(key))
+		if b.InRollout(key) {
+			in++
+			// Raising the percentage keeps the clients in the rollout
+			wider := *b
+			wider.Percentage = 50
+			assert.True(t, wider.InRollout(key))
+		}
+	}
+	assert.InDelta(t, 2000, in, 300)
+	assert.False(t, b.InRollout(""))
+
+	other := &Bucketing{Salt: "b", Percentage: 20}
+	same := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		if b.Bucket(key) == other.Bucket(key) {
+			same++
+		}
+	}
+	assert.Less(t, same, 50)
+}
+
+func TestBucketingConfig(t *testing.T) {
+	var b Bucketing
+	require.NoError(t, BindConfig([]byte(`{"name":"beta","percentage":10}`), &b))
+	assert.Equal(t, BucketByConsumer, b.Source)
+	assert.Error(t, BindConfig([]byte(`{"source":"cookie","percentage":101}`), &b))
+}
+
+func TestBucketingAssign(t *testing.T) {
+	type config struct {
+		Bucketing Bucketing `json:"bucketing"`
+	}
+	var buckets []int
+	var rollouts []bool
+	vm := NewCommonVmCtx("bucketing-test",
+		ParseConfigInto[config](),
+		ProcessRequestHeaders(func(ctx HttpContext, config config) types.Action {
+			bucket, ok := config.Bucketing.Assign(ctx)
+			buckets = append(buckets, bucket)
+			rollouts = append(rollouts, ok)
+			assert.Equal(t, bucket, ctx.GetUserAttribute(BucketAttributePrefix+"beta"))
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).
+		WithPluginConfiguration([]byte(`{"bucketing":{"name":"beta","source":"ip","percentage":100,"remoteIP":{"header":"x-forwarded-for","trustedHops":1}}}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	expected := (&Bucketing{}).Bucket("1.1.1.1")
+	host.SetProperty([]string{"source", "address"}, []byte("10.0.0.2:43210"))
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"x-forwarded-for", "2.2.2.2, 1.1.1.1"}}, true)
+	host.CompleteHttpContext(id)
+
+	host.SetProperty([]string{"source", "address"}, []byte("1.1.1.1:43210"))
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, []int{expected, expected}, buckets)
+	assert.Equal(t, []bool{true, true}, rollouts)
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// ErrCalloutLimitExceeded is returned by the callouts of a request when a callout would exceed the limits set with LimitCallouts
+var ErrCalloutLimitExceeded = fmt.Errorf("callout %w", ErrLimitExceeded)
+
+type calloutLimits struct {
+	contextID   uint32
+	maxCallouts int
+	maxDuration time.Duration
+	deadline    time.Time
+	callouts    int
+	// The cancel functions of the callouts in flight by sequence number
+	inFlight map[uint64]func()
+	next     uint64
+}
+
+// limitedRequests are the callout limits of requests by context id
+var limitedRequests = map[uint32]*calloutLimits{}
+
+// LimitCallouts caps the callouts made on behalf of the request being processed, e.g. by a tool
+// chaining calls to its backends: at most maxCallouts HTTP, gRPC, Redis and route callouts, all done
+// within maxDuration from now. A callout over the limits fails with ErrCalloutLimitExceeded, and the
+// timeout of a callout is cut to the remaining duration. Once the duration is over, the callouts still
+// in flight are cancelled: their callbacks get a failure right away, an HTTP status 504, a gRPC status
+// DEADLINE_EXCEEDED or a Redis error, and their responses are dropped. This happens when a callout of the
+// request ends, the timeouts of HTTP and gRPC callouts are cut to the deadline, when another callout is
+// attempted, or on the next tick of a plugin with tick functions. A route call cannot be cancelled, the
+// upstream timeout of its route is cut instead.
+// A limit of 0 is unlimited, calling it again replaces the limits.
+func LimitCallouts(maxCallouts int, maxDuration time.Duration) {
+	if activeHttpContextID == 0 {
+		return
+	}
+	if maxCallouts <= 0 && maxDuration <= 0 {
+		delete(limitedRequests, activeHttpContextID)
+		return
+	}
+	limits := &calloutLimits{contextID: activeHttpContextID, maxCallouts: maxCallouts, maxDuration: maxDuration}
+	if previous := limitedRequests[activeHttpContextID]; previous != nil {
+		limits.inFlight, limits.next = previous.inFlight, previous.next
+	}
+	if maxDuration > 0 {
+		limits.deadline = time.Now().Add(maxDuration)
+	}
+	limitedRequests[activeHttpContextID] = limits
+}
+
+// CalloutCount returns the number of callouts counted against the limits of the request being processed
+func CalloutCount() int {
+	if limits := limitedRequests[activeHttpContextID]; limits != nil {
+		return limits.callouts
+	}
+	return 0
+}
+
+// chargeCallout counts a callout of the request being processed and returns its timeout, cut to the
+// remaining duration. cancel fails the callout when the duration is over before its response arrives,
+// nil for a callout that cannot be cancelled. The returned function is called when the response
+// arrives and reports whether it is still expected, it is not once the callout was cancelled.
+func chargeCallout(timeout uint32, cancel func()) (uint32, func() bool, error) {
+	limits := limitedRequests[activeHttpContextID]
+	if limits == nil {
+		return timeout, func() bool { return true }, nil
+	}
+	if limits.maxCallouts > 0 && limits.callouts >= limits.maxCallouts {
+		return 0, nil, fmt.Errorf("%w: the maximum of %d callouts is reached", ErrCalloutLimitExceeded, limits.maxCallouts)
+	}
+	if !limits.deadline.IsZero() {
+		remaining := time.Until(limits.deadline).Milliseconds()
+		if remaining <= 0 {
+			limits.cancelInFlight()
+			return 0, nil, fmt.Errorf("%w: the maximum duration of %s is reached after %d callouts", ErrCalloutLimitExceeded, limits.maxDuration, limits.callouts)
+		}
+		if remaining < int64(timeout) {
+			timeout = uint32(remaining)
+		}
+	}
+	limits.callouts++
+	if cancel == nil {
+		return timeout, func() bool { return true }, nil
+	}
+	seq := limits.next
+	limits.next++
+	if limits.inFlight == nil {
+		limits.inFlight = map[uint64]func(){}
+	}
+	limits.inFlight[seq] = cancel
+	return timeout, func() bool {
+		if _, ok := limits.inFlight[seq]; !ok {
+			return false
+		}
+		delete(limits.inFlight, seq)
+		if limits.expired() {
+			limits.cancelInFlight()
+		}
+		return true
+	}, nil
+}
+
+func (l *calloutLimits) expired() bool {
+	return !l.deadline.IsZero() && !time.Now().Before(l.deadline)
+}
+
+// cancelInFlight fails the callouts in flight, their responses are dropped when they arrive
+func (l *calloutLimits) cancelInFlight() {
+	for len(l.inFlight) > 0 {
+		for seq, cancel := range l.inFlight {
+			delete(l.inFlight, seq)
+			log.Debugf("cancelling a callout of context %d, the maximum duration of %s is reached", l.contextID, l.maxDuration)
+			cancel()
+			break
+		}
+	}
+}
+
+// cancelExpiredCallouts cancels the callouts in flight of the requests whose duration is over, in the
+// context of their requests
+func cancelExpiredCallouts() {
+	for contextID, limits := range limitedRequests {
+		if len(limits.inFlight) == 0 || !limits.expired() {
+			continue
+		}
+		if err := proxywasm.SetEffectiveContext(contextID); err != nil {
+			log.Debugf("dropping the callout limits of finished request, context %d: %v", contextID, err)
+			delete(limitedRequests, contextID)
+			continue
+		}
+		activeHttpContextID = contextID
+		limits.cancelInFlight()
+		activeHttpContextID = 0
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+)
+
+func TestLimitCalloutsChained(t *testing.T) {
+	var errs []error
+	client := NewClusterClient(FQDNCluster{FQDN: "backend.example.com", Port: 80})
+	var chain func(ctx HttpContext)
+	chain = func(ctx HttpContext) {
+		err := client.Get("/step", nil, func(int, http.Header, []byte) {
+			chain(ctx)
+		})
+		if err != nil {
+			errs = append(errs, err)
+			proxywasm.ResumeHttpRequest()
+		}
+	}
+	vm := NewCommonVmCtx[struct{}]("callout-limits-test",
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			LimitCallouts(2, 0)
+			chain(ctx)
+			return types.ActionPause
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	for i := 0; i < 2; i++ {
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	}
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id))
+	require.Len(t, errs, 1)
+	assert.True(t, errors.Is(errs[0], ErrCalloutLimitExceeded))
+	assert.Contains(t, errs[0].Error(), "the maximum of 2 callouts is reached")
+	assert.Equal(t, types.ActionContinue, host.GetCurrentHttpStreamAction(id))
+
+	host.CompleteHttpContext(id)
+	assert.Empty(t, limitedRequests)
+}
+
+func TestChargeCallout(t *testing.T) {
+	activeHttpContextID = 1
+	defer func() {
+		activeHttpContextID = 0
+		delete(limitedRequests, 1)
+	}()
+
+	timeout, _, err := chargeCallout(500, nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(500), timeout)
+	assert.Equal(t, 0, CalloutCount())
+
+	LimitCallouts(0, 100*time.Millisecond)
+	timeout, _, err = chargeCallout(500, nil)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, timeout, uint32(100))
+	assert.Greater(t, timeout, uint32(0))
+	var cancelled []string
+	_, firstDone, err := chargeCallout(50, func() { cancelled = append(cancelled, "first") })
+	require.NoError(t, err)
+	_, secondDone, err := chargeCallout(50, func() { cancelled = append(cancelled, "second") })
+	require.NoError(t, err)
+	assert.Equal(t, 3, CalloutCount())
+
+	assert.True(t, firstDone(), "a response within the duration is expected")
+	limitedRequests[1].deadline = time.Now().Add(-time.Millisecond)
+	_, _, err = chargeCallout(500, nil)
+	assert.True(t, errors.Is(err, ErrCalloutLimitExceeded))
+	assert.Contains(t, err.Error(), "the maximum duration of 100ms is reached after 3 callouts")
+	assert.Equal(t, []string{"second"}, cancelled, "callouts in flight are cancelled once the duration is over")
+	assert.False(t, secondDone(), "the response of a cancelled callout is dropped")
+
+	LimitCallouts(0, 0)
+	assert.Empty(t, limitedRequests)
+}
+
+// TestLimitCalloutsKinds tests that every kind of callout counts against the limits
+func TestLimitCalloutsKinds(t *testing.T) {
+	var errs []error
+	var redisReply resp.Value
+	var grpcStatus GrpcStatus
+	var httpStatus int
+	redis := NewRedisClusterClient(FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	grpc := NewGrpcClusterClient(FQDNCluster{FQDN: "grpc.example.com", Port: 9090})
+	client := NewClusterClient(FQDNCluster{FQDN: "backend.example.com", Port: 80})
+	vm := NewCommonVmCtx("callout-limits-kinds-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error {
+			return redis.Init("", "", 1000)
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			switch ctx.Path() {
+			case "/count":
+				LimitCallouts(3, 0)
+				errs = append(errs,
+					redis.Get("key", func(resp.Value) {}),
+					grpc.Call("/pkg.Service/Method", nil, nil, func(GrpcStatus, http.Header, [][]byte) {}),
+					ctx.RouteCall(http.MethodGet, "/route", nil, nil, func(int, [][2]string, []byte) {}),
+					redis.Get("key", func(resp.Value) {}),
+					grpc.Call("/pkg.Service/Method", nil, nil, func(GrpcStatus, http.Header, [][]byte) {}),
+					ctx.RouteCall(http.MethodGet, "/route", nil, nil, func(int, [][2]string, []byte) {}),
+				)
+			case "/duration":
+				LimitCallouts(0, time.Minute)
+				errs = append(errs,
+					redis.Get("key", func(reply resp.Value) { redisReply = reply }),
+					grpc.Call("/pkg.Service/Method", nil, nil, func(status GrpcStatus, _ http.Header, _ [][]byte) { grpcStatus = status }),
+					client.Get("/slow", nil, func(statusCode int, _ http.Header, _ []byte) { httpStatus = statusCode }),
+					ctx.RouteCall(http.MethodGet, "/route", nil, nil, func(int, [][2]string, []byte) {}),
+				)
+			}
+			return types.ActionPause
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	t.Run("count", func(t *testing.T) {
+		errs = nil
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/count"}}, true)
+		require.Len(t, errs, 6)
+		for _, err := range errs[:3] {
+			assert.NoError(t, err)
+		}
+		for _, err := range errs[3:] {
+			assert.ErrorIs(t, err, ErrCalloutLimitExceeded)
+		}
+		assert.Len(t, host.GetRedisCalloutAttributesFromContext(id), 1)
+		assert.Len(t, host.GetCalloutAttributesFromContext(id), 1)
+		host.CompleteHttpContext(id)
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		errs = nil
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/duration"}}, true)
+		require.Len(t, errs, 4)
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		timeout, err := strconv.Atoi(host.GetCurrentRequestHeaders(id)[slices.IndexFunc(host.GetCurrentRequestHeaders(id), func(h [2]string) bool {
+			return h[0] == "x-envoy-upstream-rq-timeout-ms"
+		})][1])
+		require.NoError(t, err)
+		assert.LessOrEqual(t, timeout, 60000, "the upstream timeout of the route call is cut")
+
+		redisCallouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, redisCallouts, 1)
+		redisCallout := redisCallouts[0].CalloutID
+		callouts := host.GetCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 2)
+		grpcCallout, httpCallout := callouts[0].CalloutID, callouts[1].CalloutID
+
+		limitedRequests[id].deadline = time.Now()
+		// The host times the http call out at the deadline
+		host.CallOnHttpCallResponse(httpCallout, nil, nil, nil)
+		assert.Equal(t, http.StatusBadGateway, httpStatus)
+		assert.EqualError(t, redisReply.Error(), ErrCalloutLimitExceeded.Error(), "the callouts in flight are cancelled")
+		assert.Equal(t, GrpcStatusDeadlineExceeded, grpcStatus.Code)
+
+		redisReply, grpcStatus = resp.Value{}, GrpcStatus{}
+		host.CallOnRedisCallResponse(redisCallout, 0, []byte("$1\r\nv\r\n"))
+		host.CallOnHttpCallResponse(grpcCallout, [][2]string{{":status", "200"}, {"grpc-status", "0"}}, nil, nil)
+		assert.Equal(t, resp.Value{}, redisReply, "the responses of cancelled callouts are dropped")
+		assert.Equal(t, GrpcStatus{}, grpcStatus)
+		host.CompleteHttpContext(id)
+	})
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// CalloutPriority orders the callouts queued by a CalloutScheduler, higher priorities are sent first
+type CalloutPriority int
+
+const (
+	// PriorityBestEffort is for callouts nothing waits for, e.g. shipping analytics
+	PriorityBestEffort CalloutPriority = iota
+	PriorityNormal
+	// PriorityCritical is for callouts requests wait for, e.g. auth checks
+	PriorityCritical
+)
+
+func (p CalloutPriority) String() string {
+	switch p {
+	case PriorityBestEffort:
+		return "best-effort"
+	case PriorityNormal:
+		return "normal"
+	case PriorityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+// ErrCalloutQueueFull is returned for callouts a CalloutScheduler can neither send nor queue
+var ErrCalloutQueueFull = fmt.Errorf("%w: callout queue is full", ErrLimitExceeded)
+
+const defaultCalloutAgingInterval = time.Second
+
+// CalloutScheduler caps the callouts in flight of a plugin VM, e.g. to its share of the requests per
+// IO cycle set with WithMaxRequestsPerIoCycle, and queues the others by priority: once a callout is
+// done, the queued callout of the highest priority is sent in the context of its request, so critical
+// callouts overtake best-effort ones. To prevent starvation, a queued callout is promoted one priority
+// for every aging interval it waits. Callouts of requests that are gone when their turn comes are
+// dropped.
+//
+// The scheduler is shared by the clients created with Client, one per cluster and priority:
+//
+//	scheduler := wrapper.NewCalloutScheduler(20)
+//	authClient := scheduler.Client(wrapper.NewClusterClient(authCluster), wrapper.PriorityCritical)
+//	analyticsClient := scheduler.Client(wrapper.NewClusterClient(analyticsCluster), wrapper.PriorityBestEffort)
+type CalloutScheduler struct {
+	maxInFlight   int
+	maxQueued     int
+	agingInterval time.Duration
+	now           func() time.Time
+
+	inFlight int
+	queue    []*queuedCallout
+}
+
+type queuedCallout struct {
+	priority  CalloutPriority
+	queuedAt  time.Time
+	contextID uint32
+	dispatch  func() error
+	fail      func()
+}
+
+type CalloutSchedulerOption func(s *CalloutScheduler)
+
+// WithMaxQueuedCallouts bounds the queue, default unbounded. When it is full a callout evicts the
+// queued callout of the lowest priority if its own is higher, the evicted callout gets a 503
+// response, otherwise it fails with ErrCalloutQueueFull.
+func WithMaxQueuedCallouts(maxQueued int) CalloutSchedulerOption {
+	return func(s *CalloutScheduler) {
+		s.maxQueued = maxQueued
+	}
+}
+
+// WithCalloutAging sets the time a queued callout waits for each promotion, default 1s. 0 disables aging.
+func WithCalloutAging(interval time.Duration) CalloutSchedulerOption {
+	return func(s *CalloutScheduler) {
+		s.agingInterval = interval
+	}
+}
+
+// NewCalloutScheduler creates a scheduler sending at most maxInFlight callouts at a time
+func NewCalloutScheduler(maxInFlight int, opts ...CalloutSchedulerOption) *CalloutScheduler {
+	s := &CalloutScheduler{
+		maxInFlight:   max(maxInFlight, 1),
+		agingInterval: defaultCalloutAgingInterval,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Client returns a client sending the callouts of another client with a priority
+func (s *CalloutScheduler) Client(client HttpClient, priority CalloutPriority) HttpClient {
+	return &scheduledClient{scheduler: s, client: client, priority: priority}
+}
+
+// InFlight returns the number of callouts sent and not done yet
+func (s *CalloutScheduler) InFlight() int {
+	return s.inFlight
+}
+
+// Queued returns the number of callouts waiting for their turn
+func (s *CalloutScheduler) Queued() int {
+	return len(s.queue)
+}
+
+// effectivePriority is the priority of a queued callout promoted for the time it waited
+func (s *CalloutScheduler) effectivePriority(c *queuedCallout, now time.Time) CalloutPriority {
+	if s.agingInterval <= 0 {
+		return c.priority
+	}
+	return c.priority + CalloutPriority(now.Sub(c.queuedAt)/s.agingInterval)
+}
+
+// pick returns the index of the queued callout of the highest effective priority, the first queued
+// one on ties. lowest picks that of the lowest priority, the last queued one on ties.
+func (s *CalloutScheduler) pick(lowest bool) int {
+	now := s.now()
+	best := -1
+	var bestPriority CalloutPriority
+	for i, c := range s.queue {
+		p := s.effectivePriority(c, now)
+		if best < 0 || (!lowest && p > bestPriority) || (lowest && p <= bestPriority) {
+			best, bestPriority = i, p
+		}
+	}
+	return best
+}
+
+func (s *CalloutScheduler) remove(i int) *queuedCallout {
+	c := s.queue[i]
+	s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	return c
+}
+
+// schedule sends a callout right away if less than maxInFlight are in flight, otherwise it queues it
+func (s *CalloutScheduler) schedule(priority CalloutPriority, dispatch func() error, fail func()) error {
+	if s.inFlight < s.maxInFlight {
+		s.inFlight++
+		if err := dispatch(); err != nil {
+			s.inFlight--
+			return err
+		}
+		return nil
+	}
+	if s.maxQueued > 0 && len(s.queue) >= s.maxQueued {
+		lowest := s.pick(true)
+		if s.effectivePriority(s.queue[lowest], s.now()) >= priority {
+			return ErrCalloutQueueFull
+		}
+		evicted := s.remove(lowest)
+		log.Debugf("evicting queued %s callout for a %s callout", evicted.priority, priority)
+		s.run(evicted, evicted.fail)
+	}
+	s.queue = append(s.queue, &queuedCallout{
+		priority:  priority,
+		queuedAt:  s.now(),
+		contextID: activeHttpContextID,
+		dispatch:  dispatch,
+		fail:      fail,
+	})
+	return nil
+}
+
+// done counts a callout as done and sends the queued callouts whose turn it is
+func (s *CalloutScheduler) done() {
+	s.inFlight--
+	for s.inFlight < s.maxInFlight && len(s.queue) > 0 {
+		c := s.remove(s.pick(false))
+		s.run(c, func() {
+			s.inFlight++
+			if err := c.dispatch(); err != nil {
+				s.inFlight--
+				log.Warnf("failed to dispatch queued %s callout: %v", c.priority, err)
+				c.fail()
+			}
+		})
+	}
+}
+
+// run calls f in the context of the request of a queued callout, then sets the current context back
+// as effective. The callout is dropped if its request is gone.
+func (s *CalloutScheduler) run(c *queuedCallout, f func()) {
+	contextID := activeHttpContextID
+	if c.contextID == 0 || c.contextID == contextID {
+		f()
+		return
+	}
+	if err := proxywasm.SetEffectiveContext(c.contextID); err != nil {
+		log.Debugf("dropping queued callout of finished request, context %d: %v", c.contextID, err)
+		return
+	}
+	activeHttpContextID = c.contextID
+	f()
+	if contextID != 0 {
+		if err := proxywasm.SetEffectiveContext(contextID); err != nil {
+			log.Debugf("failed to restore context %d: %v", contextID, err)
+		}
+	}
+	activeHttpContextID = contextID
+}
+
+type scheduledClient struct {
+	scheduler *CalloutScheduler
+	client    HttpClient
+	priority  CalloutPriority
+}
+
+func (c *scheduledClient) Get(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodGet, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Head(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodHead, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Options(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodOptions, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Post(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPost, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Put(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPut, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Patch(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPatch, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Delete(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodDelete, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Connect(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodConnect, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *scheduledClient) Trace(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodTrace, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+
+// Call sends the callout when its turn comes. A queued callout that cannot be sent gets a 503 response.
+// The slot of a done callout is handed over before its callback runs, so callouts chained by the
+// callback queue behind those already waiting.
+func (c *scheduledClient) Call(method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	dispatch := func() error {
+		// The callout is sent in the context of its request, which the callback makes active again
+		// whatever client sends it
+		contextID := activeHttpContextID
+		return c.client.Call(method, rawURL, headers, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+			activeHttpContextID = contextID
+			c.scheduler.done()
+			cb(statusCode, responseHeaders, responseBody)
+		}, timeoutMillisecond...)
+	}
+	fail := func() {
+		cb(http.StatusServiceUnavailable, http.Header{}, nil)
+	}
+	return c.scheduler.schedule(c.priority, dispatch, fail)
+}
+
+func (c *scheduledClient) ClusterName() string {
+	return c.client.ClusterName()
+}
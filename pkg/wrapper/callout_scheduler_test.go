@@ -0,0 +1,164 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// recordingClient records the paths of the callouts it sends and answers them on respond
+type recordingClient struct {
+	HttpClient
+	sent      []string
+	callbacks []ResponseCallback
+	err       error
+}
+
+func (c *recordingClient) Call(method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, rawURL)
+	c.callbacks = append(c.callbacks, cb)
+	return nil
+}
+
+func (c *recordingClient) respond() {
+	cb := c.callbacks[0]
+	c.callbacks = c.callbacks[1:]
+	cb(http.StatusOK, http.Header{}, nil)
+}
+
+func newTestCalloutScheduler(t *testing.T, maxInFlight int, opts ...CalloutSchedulerOption) (*CalloutScheduler, *time.Time) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	t.Cleanup(reset)
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	log.SetPluginLog(&DefaultLog{pluginName: "callout-scheduler-test"})
+	now := time.Unix(1700000000, 0)
+	s := NewCalloutScheduler(maxInFlight, opts...)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestCalloutSchedulerPriority(t *testing.T) {
+	s, _ := newTestCalloutScheduler(t, 1)
+	inner := &recordingClient{}
+	critical, normal, bestEffort := s.Client(inner, PriorityCritical), s.Client(inner, PriorityNormal), s.Client(inner, PriorityBestEffort)
+	noop := func(int, http.Header, []byte) {}
+
+	assert.NoError(t, bestEffort.Get("/analytics/1", nil, noop))
+	assert.NoError(t, bestEffort.Get("/analytics/2", nil, noop))
+	assert.NoError(t, normal.Get("/profile", nil, noop))
+	assert.NoError(t, critical.Get("/auth", nil, noop))
+	assert.Equal(t, []string{"/analytics/1"}, inner.sent)
+	assert.Equal(t, 1, s.InFlight())
+	assert.Equal(t, 3, s.Queued())
+
+	for s.InFlight() > 0 {
+		inner.respond()
+	}
+	assert.Equal(t, []string{"/analytics/1", "/auth", "/profile", "/analytics/2"}, inner.sent)
+	assert.Equal(t, 0, s.Queued())
+
+	// Callouts failing to dispatch free their slot
+	inner.err = errors.New("bad cluster")
+	assert.Error(t, critical.Get("/auth", nil, noop))
+	assert.Equal(t, 0, s.InFlight())
+}
+
+func TestCalloutSchedulerAging(t *testing.T) {
+	s, now := newTestCalloutScheduler(t, 1, WithCalloutAging(time.Second))
+	inner := &recordingClient{}
+	critical, bestEffort := s.Client(inner, PriorityCritical), s.Client(inner, PriorityBestEffort)
+	noop := func(int, http.Header, []byte) {}
+
+	assert.NoError(t, critical.Get("/auth/1", nil, noop))
+	assert.NoError(t, bestEffort.Get("/analytics", nil, noop))
+	*now = now.Add(2 * time.Second)
+	assert.NoError(t, critical.Get("/auth/2", nil, noop))
+	inner.respond()
+	assert.Equal(t, []string{"/auth/1", "/analytics"}, inner.sent, "the best-effort callout waited long enough to be promoted")
+	inner.respond()
+	assert.Equal(t, []string{"/auth/1", "/analytics", "/auth/2"}, inner.sent)
+}
+
+func TestCalloutSchedulerQueueFull(t *testing.T) {
+	s, _ := newTestCalloutScheduler(t, 1, WithMaxQueuedCallouts(1), WithCalloutAging(0))
+	inner := &recordingClient{}
+	critical, bestEffort := s.Client(inner, PriorityCritical), s.Client(inner, PriorityBestEffort)
+	var evicted int
+	noop := func(int, http.Header, []byte) {}
+
+	assert.NoError(t, bestEffort.Get("/analytics/1", nil, noop))
+	assert.NoError(t, bestEffort.Get("/analytics/2", nil, func(statusCode int, _ http.Header, _ []byte) { evicted = statusCode }))
+	assert.ErrorIs(t, bestEffort.Get("/analytics/3", nil, noop), ErrCalloutQueueFull)
+	assert.NoError(t, critical.Get("/auth", nil, noop))
+	assert.Equal(t, http.StatusServiceUnavailable, evicted)
+	assert.ErrorIs(t, critical.Get("/auth", nil, noop), ErrCalloutQueueFull)
+
+	inner.respond()
+	assert.Equal(t, []string{"/analytics/1", "/auth"}, inner.sent)
+}
+
+func TestCalloutSchedulerContext(t *testing.T) {
+	type schedulerConfig struct {
+		client HttpClient
+	}
+	statuses := map[string]int{}
+	scheduler := NewCalloutScheduler(1)
+	vm := NewCommonVmCtx("callout-scheduler-test",
+		ParseConfig(func(json gjson.Result, config *schedulerConfig) error {
+			config.client = scheduler.Client(NewClusterClient(FQDNCluster{FQDN: "auth.example.com", Port: 80}), PriorityCritical)
+			return nil
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config schedulerConfig) types.Action {
+			path := ctx.Path()
+			config.client.Get("/check"+path, nil, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+				statuses[ctx.Path()] = statusCode
+			})
+			return types.ActionPause
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	first, second := host.InitializeHttpContext(), host.InitializeHttpContext()
+	host.CallOnRequestHeaders(first, [][2]string{{":authority", "example.com"}, {":path", "/first"}}, false)
+	host.CallOnRequestHeaders(second, [][2]string{{":authority", "example.com"}, {":path", "/second"}}, false)
+	assert.Empty(t, host.GetCalloutAttributesFromContext(second), "the second callout is queued")
+
+	callouts := host.GetCalloutAttributesFromContext(first)
+	if assert.Len(t, callouts, 1) {
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	}
+	callouts = host.GetCalloutAttributesFromContext(second)
+	if assert.Len(t, callouts, 1, "the queued callout is sent in the context of its request") {
+		assert.Contains(t, callouts[0].Headers, [2]string{":path", "/check/second"})
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "204"}}, nil, nil)
+	}
+	assert.Equal(t, map[string]int{"/first": 200, "/second": 204}, statuses)
+	assert.Equal(t, 0, scheduler.InFlight())
+}
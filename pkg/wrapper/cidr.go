@@ -0,0 +1,268 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+// cidrNode is a node of the binary trie of CIDRMap, IPv4 addresses are stored as IPv4-mapped IPv6
+type cidrNode[V any] struct {
+	children [2]*cidrNode[V]
+	value    V
+	set      bool
+}
+
+// CIDRMap maps IP ranges to values, lookups return the value of the longest matching range in a
+// time bound by the address length, whatever the number of ranges, e.g. to route by region:
+//
+//	regions := NewCIDRMap[string]()
+//	regions.Add("10.1.0.0/16", "hangzhou")
+//	regions.Add("10.2.0.0/16", "beijing")
+//	region, ok := regions.Lookup("10.1.2.3")
+type CIDRMap[V any] struct {
+	root cidrNode[V]
+	size int
+}
+
+func NewCIDRMap[V any]() *CIDRMap[V] {
+	return &CIDRMap[V]{}
+}
+
+// ParseCIDR parses a range written as a CIDR or a single address, e.g. 10.0.0.0/8, 1.2.3.4 or ::1
+func ParseCIDR(cidr string) (netip.Prefix, error) {
+	cidr = strings.TrimSpace(cidr)
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// Add maps the range to the value, replacing the value of the same range
+func (m *CIDRMap[V]) Add(cidr string, value V) error {
+	prefix, err := ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid cidr %q: %v", cidr, err)
+	}
+	m.AddPrefix(prefix, value)
+	return nil
+}
+
+func (m *CIDRMap[V]) AddPrefix(prefix netip.Prefix, value V) {
+	bytes, bits := cidrKey(prefix.Addr(), prefix.Bits())
+	node := &m.root
+	for i := 0; i < bits; i++ {
+		bit := bytes[i/8] >> (7 - i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &cidrNode[V]{}
+		}
+		node = node.children[bit]
+	}
+	if !node.set {
+		m.size++
+	}
+	node.value, node.set = value, true
+}
+
+// Lookup returns the value of the longest range containing the address, false if there is none or
+// the address is invalid
+func (m *CIDRMap[V]) Lookup(ip string) (V, bool) {
+	addr, err := ParseIP(ip)
+	if err != nil {
+		var zero V
+		return zero, false
+	}
+	return m.LookupAddr(addr)
+}
+
+func (m *CIDRMap[V]) LookupAddr(addr netip.Addr) (V, bool) {
+	var value V
+	var found bool
+	if !addr.IsValid() {
+		return value, false
+	}
+	bytes, bits := cidrKey(addr, addr.BitLen())
+	node := &m.root
+	for i := 0; node != nil; i++ {
+		if node.set {
+			value, found = node.value, true
+		}
+		if i == bits {
+			break
+		}
+		node = node.children[bytes[i/8]>>(7-i%8)&1]
+	}
+	return value, found
+}
+
+// Len returns the number of ranges
+func (m *CIDRMap[V]) Len() int {
+	return m.size
+}
+
+// cidrKey returns the 16 byte key of an address and the number of bits of a prefix of it
+func cidrKey(addr netip.Addr, bits int) ([16]byte, int) {
+	if addr.Is4() {
+		bits += 96
+	}
+	return addr.As16(), bits
+}
+
+// CIDRSet is a set of IP ranges for allowlists and denylists, in a config it is an array of CIDRs
+// or addresses, e.g. ["10.0.0.0/8", "192.168.1.1", "fd00::/8"]
+type CIDRSet struct {
+	m CIDRMap[struct{}]
+}
+
+// NewCIDRSet creates a set of the ranges written as CIDRs or single addresses
+func NewCIDRSet(cidrs ...string) (*CIDRSet, error) {
+	s := &CIDRSet{}
+	for i, cidr := range cidrs {
+		if err := s.Add(cidr); err != nil {
+			return nil, configerr.New(configerr.Pointer(i), "CIDR or IP address", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *CIDRSet) Add(cidr string) error {
+	return s.m.Add(cidr, struct{}{})
+}
+
+// Contains tells whether the address is in one of the ranges, false for invalid addresses
+func (s *CIDRSet) Contains(ip string) bool {
+	_, found := s.m.Lookup(ip)
+	return found
+}
+
+func (s *CIDRSet) ContainsAddr(addr netip.Addr) bool {
+	_, found := s.m.LookupAddr(addr)
+	return found
+}
+
+func (s *CIDRSet) Len() int {
+	return s.m.Len()
+}
+
+// UnmarshalJSON parses the set from an array of CIDRs, for configs bound with BindConfig
+func (s *CIDRSet) UnmarshalJSON(data []byte) error {
+	var cidrs []string
+	if err := json.Unmarshal(data, &cidrs); err != nil {
+		return err
+	}
+	parsed, err := NewCIDRSet(cidrs...)
+	if err != nil {
+		return err
+	}
+	*s = *parsed
+	return nil
+}
+
+// ParseIP parses an address as found in headers and in the source address, with an optional port
+// and brackets, e.g. 1.2.3.4:8080 or [::1]:8080. IPv4-mapped IPv6 addresses are unmapped.
+func ParseIP(ip string) (netip.Addr, error) {
+	ip = strings.TrimSpace(ip)
+	if addrPort, err := netip.ParseAddrPort(ip); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+var errNoRemoteIP = errors.New("no remote ip")
+
+// RemoteIP selects the address of the client of a request, e.g. in a plugin config:
+//
+//	{"header": "x-forwarded-for", "trustedProxies": ["10.0.0.0/8"]}
+//	{"header": "x-forwarded-for", "trustedHops": 1}
+//
+// By default the source address of the connection, i.e. the downstream remote address, is used. A
+// header listing addresses, like X-Forwarded-For, is only used with trusted proxies or trusted hops,
+// as clients can set it to any value: the source address is taken as the last address of the list,
+// then either the addresses of trusted proxies are skipped from the right, the client being the
+// first address which is not a trusted proxy, or the given number of trusted hops, i.e. of proxies
+// in front of the gateway, is skipped from the right.
+type RemoteIP struct {
+	Header         string   `json:"header"`
+	TrustedProxies *CIDRSet `json:"trustedProxies"`
+	TrustedHops    int      `json:"trustedHops"`
+}
+
+// Addr returns the address of the client of the current request
+func (r *RemoteIP) Addr() (netip.Addr, error) {
+	var addresses []string
+	if r.trustsHeader() {
+		if value, _ := proxywasm.GetHttpRequestHeader(r.Header); value != "" {
+			addresses = strings.Split(value, ",")
+		}
+	}
+	if address, err := proxywasm.GetProperty([]string{"source", "address"}); err == nil && len(address) > 0 {
+		addresses = append(addresses, string(address))
+	}
+	if len(addresses) == 0 {
+		return netip.Addr{}, errNoRemoteIP
+	}
+	return r.fromAddresses(addresses)
+}
+
+// String returns the address of the client of the current request, empty if it has none
+func (r *RemoteIP) String() string {
+	addr, err := r.Addr()
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func (r *RemoteIP) trustsHeader() bool {
+	return r.Header != "" && (r.TrustedHops > 0 || r.TrustedProxies != nil && r.TrustedProxies.Len() > 0)
+}
+
+func (r *RemoteIP) fromAddresses(addresses []string) (netip.Addr, error) {
+	if r.TrustedProxies == nil || r.TrustedProxies.Len() == 0 {
+		return ParseIP(addresses[max(len(addresses)-1-max(r.TrustedHops, 0), 0)])
+	}
+	var addr netip.Addr
+	for i := len(addresses) - 1; i >= 0; i-- {
+		var err error
+		if addr, err = ParseIP(addresses[i]); err != nil {
+			return netip.Addr{}, err
+		}
+		if !r.TrustedProxies.ContainsAddr(addr) {
+			return addr, nil
+		}
+	}
+	// Every address is a trusted proxy, the first one is the closest to the client
+	return addr, nil
+}
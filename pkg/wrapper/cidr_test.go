@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCIDRSet(t *testing.T) {
+	set, err := NewCIDRSet("10.0.0.0/8", "192.168.1.1", "fd00::/8", "172.16.1.1/16")
+	require.NoError(t, err)
+	assert.Equal(t, 4, set.Len())
+
+	tests := map[string]bool{
+		"10.1.2.3":         true,
+		"11.0.0.1":         false,
+		"192.168.1.1":      true,
+		"192.168.1.2":      false,
+		"172.16.200.1":     true,
+		"fd12::1":          true,
+		"fe80::1":          false,
+		"::ffff:10.0.0.1":  true,
+		"10.0.0.1:8080":    true,
+		"[fd00::1]:443":    true,
+		"not an address":   false,
+		"":                 false,
+		"::ffff:11.0.0.1":  false,
+		"[::ffff:1.2.3.4]": false,
+	}
+	for ip, expected := range tests {
+		assert.Equal(t, expected, set.Contains(ip), ip)
+	}
+
+	_, err = NewCIDRSet("10.0.0.0/8", "10.0.0.0/33")
+	assert.ErrorContains(t, err, `"/1"`)
+}
+
+func TestCIDRMapLongestMatch(t *testing.T) {
+	m := NewCIDRMap[string]()
+	require.NoError(t, m.Add("0.0.0.0/0", "default"))
+	require.NoError(t, m.Add("10.0.0.0/8", "private"))
+	require.NoError(t, m.Add("10.1.0.0/16", "hangzhou"))
+
+	for ip, expected := range map[string]string{"10.1.2.3": "hangzhou", "10.2.0.1": "private", "8.8.8.8": "default"} {
+		value, ok := m.Lookup(ip)
+		assert.True(t, ok, ip)
+		assert.Equal(t, expected, value, ip)
+	}
+	_, ok := m.Lookup("::1")
+	assert.False(t, ok)
+}
+
+func TestRemoteIP(t *testing.T) {
+	var config struct {
+		RemoteIP RemoteIP `json:"remoteIP"`
+	}
+	require.NoError(t, BindConfig([]byte(`{"remoteIP":{"header":"x-forwarded-for","trustedProxies":["10.0.0.0/8"]}}`), &config))
+	assert.Error(t, BindConfig([]byte(`{"remoteIP":{"trustedProxies":["10.0.0.0/99"]}}`), &config))
+
+	hops := RemoteIP{Header: "x-forwarded-for", TrustedHops: 1}
+	tests := []struct {
+		remoteIP RemoteIP
+		source   string
+		xff      string
+		expected string
+	}{
+		{config.RemoteIP, "10.0.0.1", "1.1.1.1, 2.2.2.2, 10.0.0.2", "2.2.2.2"},
+		{config.RemoteIP, "10.0.0.1", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		// The header of a client connecting directly is not trusted
+		{config.RemoteIP, "3.3.3.3", "1.1.1.1, 10.0.0.2", "3.3.3.3"},
+		{hops, "10.0.0.1", "1.1.1.1, 2.2.2.2", "2.2.2.2"},
+		{hops, "10.0.0.1", "", "10.0.0.1"},
+		{RemoteIP{Header: "x-forwarded-for", TrustedHops: 5}, "10.0.0.1", "1.1.1.1, 2.2.2.2", "1.1.1.1"},
+		{RemoteIP{Header: "x-forwarded-for"}, "3.3.3.3", "1.1.1.1, 2.2.2.2", "3.3.3.3"},
+		{RemoteIP{}, "3.3.3.3", "1.1.1.1", "3.3.3.3"},
+	}
+	for _, tt := range tests {
+		headers := [][2]string{{":authority", "example.com"}}
+		if tt.xff != "" {
+			headers = append(headers, [2]string{"x-forwarded-for", tt.xff})
+		}
+		assert.Equal(t, tt.expected, remoteIPOf(t, tt.remoteIP, tt.source, headers), tt.xff)
+	}
+}
+
+// remoteIPOf returns the remote ip of a request with the headers from the source address
+func remoteIPOf(t *testing.T, remoteIP RemoteIP, source string, headers [][2]string) string {
+	var ip string
+	vm := NewCommonVmCtx("remote-ip-test",
+		ParseConfigInto[struct{}](),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			ip = remoteIP.String()
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	host.SetProperty([]string{"source", "address"}, []byte(source+":5000"))
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, headers, true)
+	host.CompleteHttpContext(id)
+	return ip
+}
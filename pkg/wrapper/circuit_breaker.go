@@ -0,0 +1,285 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// CircuitState is the state of a CircuitBreakerClient, it is also the value of its state gauge
+type CircuitState int64
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// ErrCircuitOpen is returned for callouts rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	defaultBreakerErrorThreshold = 0.5
+	defaultBreakerMinRequests    = 10
+	defaultBreakerWindow         = 10 * time.Second
+	defaultBreakerOpenDuration   = 30 * time.Second
+	// Time allowed beyond the timeout of the probe for its callback, after which the probe is considered
+	// lost, e.g. because the request that sent it is gone, and another probe is let through
+	breakerProbeGrace = time.Second
+)
+
+// CircuitBreakerClient stops sending callouts to a cluster whose error rate is too high. Outcomes are
+// counted in fixed windows, once a window has MinRequests callouts and its error rate reaches
+// ErrorThreshold the circuit opens and callouts fail right away with ErrCircuitOpen. After OpenDuration
+// a single probe callout is let through (half-open), its outcome closes or reopens the circuit. A probe
+// whose callback does not arrive within its timeout is replaced by the next callout.
+//
+// State is tracked per plugin VM, so it is exported as the gauge circuit_breaker.<cluster>.vm.<vm>.state
+// (0 closed, 1 open, 2 half-open) of every VM, where <vm> is the identifier of the VM also used for leases.
+// Rejected callouts are counted by circuit_breaker.<cluster>.rejected.
+type CircuitBreakerClient struct {
+	client         HttpClient
+	errorThreshold float64
+	minRequests    int
+	window         time.Duration
+	openDuration   time.Duration
+	isFailure      func(statusCode int) bool
+
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	// Sequence number of the current probe, outcomes of replaced probes are ignored
+	probe        uint64
+	probeExpiry  time.Time
+	stateGauge   proxywasm.MetricGauge
+	rejectedStat proxywasm.MetricCounter
+}
+
+type CircuitBreakerOption func(c *CircuitBreakerClient)
+
+// WithErrorThreshold sets the error rate at which the circuit opens, default 0.5.
+func WithErrorThreshold(ratio float64) CircuitBreakerOption {
+	return func(c *CircuitBreakerClient) {
+		c.errorThreshold = ratio
+	}
+}
+
+// WithMinRequests sets the number of callouts a window needs before its error rate is considered, default 10.
+func WithMinRequests(n int) CircuitBreakerOption {
+	return func(c *CircuitBreakerClient) {
+		c.minRequests = n
+	}
+}
+
+// WithWindow sets the length of the windows outcomes are counted in, default 10s.
+func WithWindow(window time.Duration) CircuitBreakerOption {
+	return func(c *CircuitBreakerClient) {
+		c.window = window
+	}
+}
+
+// WithOpenDuration sets how long the circuit stays open before a probe is let through, default 30s.
+func WithOpenDuration(duration time.Duration) CircuitBreakerOption {
+	return func(c *CircuitBreakerClient) {
+		c.openDuration = duration
+	}
+}
+
+// WithBreakerFailureStatus sets which response status codes count as errors, default 5xx.
+func WithBreakerFailureStatus(isFailure func(statusCode int) bool) CircuitBreakerOption {
+	return func(c *CircuitBreakerClient) {
+		c.isFailure = isFailure
+	}
+}
+
+// NewCircuitBreakerClient wraps a client with a circuit breaker. It must be created in the config
+// phase, so that its state and metrics are shared by all requests of the VM.
+func NewCircuitBreakerClient(client HttpClient, opts ...CircuitBreakerOption) *CircuitBreakerClient {
+	c := &CircuitBreakerClient{
+		client:         client,
+		errorThreshold: defaultBreakerErrorThreshold,
+		minRequests:    defaultBreakerMinRequests,
+		window:         defaultBreakerWindow,
+		openDuration:   defaultBreakerOpenDuration,
+		isFailure: func(statusCode int) bool {
+			return statusCode >= 500
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.stateGauge = proxywasm.DefineGaugeMetric(fmt.Sprintf("circuit_breaker.%s.vm.%s.state", client.ClusterName(), vmInstanceID))
+	c.rejectedStat = proxywasm.DefineCounterMetric(fmt.Sprintf("circuit_breaker.%s.rejected", client.ClusterName()))
+	return c
+}
+
+func (c *CircuitBreakerClient) Get(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodGet, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Head(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodHead, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Options(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodOptions, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Post(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPost, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Put(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPut, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Patch(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPatch, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Delete(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodDelete, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Connect(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodConnect, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CircuitBreakerClient) Trace(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodTrace, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+
+// Call sends the callout unless the circuit is open, in which case ErrCircuitOpen is returned
+// and the callback is not called.
+func (c *CircuitBreakerClient) Call(method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	timeout := uint32(500)
+	if len(timeoutMillisecond) > 0 {
+		timeout = timeoutMillisecond[0]
+	}
+	probe, err := c.allow(time.Duration(timeout) * time.Millisecond)
+	if err != nil {
+		c.rejectedStat.Increment(1)
+		return err
+	}
+	err = c.client.Call(method, rawURL, headers, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		c.record(probe, !c.isFailure(statusCode))
+		cb(statusCode, responseHeaders, responseBody)
+	}, timeoutMillisecond...)
+	if err != nil {
+		c.record(probe, false)
+	}
+	return err
+}
+
+func (c *CircuitBreakerClient) ClusterName() string {
+	return c.client.ClusterName()
+}
+
+// State returns the current state of the circuit
+func (c *CircuitBreakerClient) State() CircuitState {
+	return c.state
+}
+
+// allow decides whether a callout of the given timeout may be sent, and returns the sequence number of
+// the probe when it is the probe of a half-open circuit, 0 otherwise
+func (c *CircuitBreakerClient) allow(timeout time.Duration) (uint64, error) {
+	now := time.Now()
+	switch c.state {
+	case CircuitOpen:
+		if now.Sub(c.openedAt) < c.openDuration {
+			return 0, ErrCircuitOpen
+		}
+		c.setState(CircuitHalfOpen)
+	case CircuitHalfOpen:
+		if c.probing && now.Before(c.probeExpiry) {
+			return 0, ErrCircuitOpen
+		}
+		if c.probing {
+			log.Debugf("probe of circuit breaker of cluster %s got no response, sending another one", c.ClusterName())
+		}
+	default:
+		return 0, nil
+	}
+	c.probing = true
+	c.probe++
+	c.probeExpiry = now.Add(timeout + breakerProbeGrace)
+	return c.probe, nil
+}
+
+func (c *CircuitBreakerClient) record(probe uint64, success bool) {
+	if probe != 0 {
+		if !c.probing || probe != c.probe {
+			// Outcome of a probe replaced after its expiry
+			return
+		}
+		c.probing = false
+		if success {
+			c.setState(CircuitClosed)
+		} else {
+			c.open()
+		}
+		return
+	}
+	if c.state != CircuitClosed {
+		// Outcome of a callout sent before the circuit opened
+		return
+	}
+	now := time.Now()
+	if now.Sub(c.windowStart) >= c.window {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	c.requests++
+	if !success {
+		c.failures++
+	}
+	if c.requests >= c.minRequests && float64(c.failures)/float64(c.requests) >= c.errorThreshold {
+		log.Warnf("circuit breaker of cluster %s opens, %d of %d callouts failed", c.ClusterName(), c.failures, c.requests)
+		c.open()
+	}
+}
+
+func (c *CircuitBreakerClient) open() {
+	c.openedAt = time.Now()
+	c.setState(CircuitOpen)
+}
+
+func (c *CircuitBreakerClient) setState(state CircuitState) {
+	if state == c.state {
+		return
+	}
+	log.Infof("circuit breaker of cluster %s changes from %s to %s", c.ClusterName(), c.state, state)
+	// The gauge is set rather than moved by the change, so that it always shows the state
+	c.stateGauge.Add(int64(state) - c.stateGauge.Value())
+	c.state = state
+	if state == CircuitClosed {
+		c.windowStart = time.Now()
+		c.requests = 0
+		c.failures = 0
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerClient(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("circuit-breaker-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	client := NewCircuitBreakerClient(NewClusterClient(TargetCluster{Cluster: "moderation"}),
+		WithMinRequests(2), WithErrorThreshold(0.5), WithOpenDuration(50*time.Millisecond))
+	respond := func(status string) {
+		callouts := host.GetCalloutAttributesFromContext(id)
+		if assert.Len(t, callouts, 1) {
+			host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", status}}, nil, nil)
+		}
+	}
+	state := func() uint64 {
+		value, err := host.GetGaugeMetric("circuit_breaker.moderation.vm." + vmInstanceID + ".state")
+		assert.NoError(t, err)
+		return value
+	}
+	noop := func(int, http.Header, []byte) {}
+
+	assert.NoError(t, client.Get("/check", nil, noop))
+	respond("200")
+	assert.NoError(t, client.Get("/check", nil, noop))
+	respond("500")
+	assert.Equal(t, CircuitOpen, client.State(), "one of two callouts failed")
+	assert.Equal(t, uint64(CircuitOpen), state())
+
+	assert.ErrorIs(t, client.Get("/check", nil, noop), ErrCircuitOpen)
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id))
+	rejected, err := host.GetCounterMetric("circuit_breaker.moderation.rejected")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), rejected)
+
+	// A failed probe reopens the circuit
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, client.Get("/check", nil, noop))
+	assert.Equal(t, CircuitHalfOpen, client.State())
+	assert.ErrorIs(t, client.Get("/check", nil, noop), ErrCircuitOpen, "only one probe at a time")
+	respond("503")
+	assert.Equal(t, CircuitOpen, client.State())
+
+	// A successful probe closes it
+	time.Sleep(50 * time.Millisecond)
+	var status int
+	assert.NoError(t, client.Get("/check", nil, func(statusCode int, _ http.Header, _ []byte) {
+		status = statusCode
+	}))
+	respond("200")
+	assert.Equal(t, 200, status)
+	assert.Equal(t, CircuitClosed, client.State())
+	assert.Equal(t, uint64(CircuitClosed), state())
+
+	// A probe whose callback never arrives is replaced once it expired, its late outcome is ignored
+	assert.NoError(t, client.Get("/check", nil, noop))
+	respond("500")
+	assert.NoError(t, client.Get("/check", nil, noop))
+	respond("500")
+	assert.Equal(t, CircuitOpen, client.State())
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, client.Get("/check", nil, noop))
+	lost := host.GetCalloutAttributesFromContext(id)
+	assert.ErrorIs(t, client.Get("/check", nil, noop), ErrCircuitOpen)
+	client.probeExpiry = time.Now()
+	assert.NoError(t, client.Get("/check", nil, noop), "the lost probe is replaced")
+	if assert.Len(t, lost, 1) {
+		host.CallOnHttpCallResponse(lost[0].CalloutID, [][2]string{{":status", "503"}}, nil, nil)
+	}
+	assert.Equal(t, CircuitHalfOpen, client.State(), "the outcome of the replaced probe is ignored")
+	respond("200")
+	assert.Equal(t, CircuitClosed, client.State())
+	assert.Equal(t, uint64(CircuitClosed), state())
+}
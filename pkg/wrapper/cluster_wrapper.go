@@ -16,6 +16,8 @@ package wrapper
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
@@ -26,6 +28,28 @@ type Cluster interface {
 	HostName() string
 }
 
+// BuildOutboundClusterName builds the name of the outbound cluster of a service, in the form
+// "outbound|<port>|<subset>|<host>". The subset is usually the service version and may be empty.
+func BuildOutboundClusterName(port int64, subset, host string) string {
+	return fmt.Sprintf("outbound|%d|%s|%s", port, subset, host)
+}
+
+// ParseOutboundClusterName splits an outbound cluster name into its port, subset and host.
+func ParseOutboundClusterName(name string) (port int64, subset, host string, err error) {
+	parts := strings.Split(name, "|")
+	if len(parts) != 4 || parts[0] != "outbound" {
+		return 0, "", "", fmt.Errorf("invalid outbound cluster name: %s", name)
+	}
+	port, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, "", "", fmt.Errorf("invalid port in outbound cluster name: %s", name)
+	}
+	if parts[3] == "" {
+		return 0, "", "", fmt.Errorf("missing host in outbound cluster name: %s", name)
+	}
+	return port, parts[2], parts[3], nil
+}
+
 type RouteCluster struct {
 	Host string
 }
@@ -66,26 +90,31 @@ type K8sCluster struct {
 	Host        string
 }
 
-func (c K8sCluster) ClusterName() string {
+// serviceHost returns the cluster-local host of the service, namespace defaults to "default"
+func (c K8sCluster) serviceHost() string {
 	namespace := "default"
 	if c.Namespace != "" {
 		namespace = c.Namespace
 	}
-	return fmt.Sprintf("outbound|%d|%s|%s.%s.svc.cluster.local",
-		c.Port, c.Version, c.ServiceName, namespace)
+	return fmt.Sprintf("%s.%s.svc.cluster.local", c.ServiceName, namespace)
+}
+
+func (c K8sCluster) ClusterName() string {
+	return BuildOutboundClusterName(c.Port, c.Version, c.serviceHost())
 }
 
 func (c K8sCluster) HostName() string {
 	if c.Host != "" {
 		return c.Host
 	}
-	return fmt.Sprintf("%s.%s.svc.cluster.local", c.ServiceName, c.Namespace)
+	return c.serviceHost()
 }
 
 type NacosCluster struct {
 	ServiceName string
 	// use DEFAULT-GROUP by default
-	Group       string
+	Group string
+	// use public by default
 	NamespaceID string
 	Port        int64
 	// set true if use edas/sae registry
@@ -99,12 +128,16 @@ func (c NacosCluster) ClusterName() string {
 	if c.Group != "" {
 		group = strings.ReplaceAll(c.Group, "_", "-")
 	}
+	namespaceID := "public"
+	if c.NamespaceID != "" {
+		namespaceID = c.NamespaceID
+	}
 	tail := "nacos"
 	if c.IsExtRegistry {
 		tail += "-ext"
 	}
-	return fmt.Sprintf("outbound|%d|%s|%s.%s.%s.%s",
-		c.Port, c.Version, c.ServiceName, group, c.NamespaceID, tail)
+	return BuildOutboundClusterName(c.Port, c.Version,
+		fmt.Sprintf("%s.%s.%s.%s", c.ServiceName, group, namespaceID, tail))
 }
 
 func (c NacosCluster) HostName() string {
@@ -114,6 +147,27 @@ func (c NacosCluster) HostName() string {
 	return c.ServiceName
 }
 
+// EurekaCluster is a service discovered from a Eureka registry, the application name is the service name.
+type EurekaCluster struct {
+	ServiceName string
+	Port        int64
+	Version     string
+	Host        string
+}
+
+func (c EurekaCluster) ClusterName() string {
+	return BuildOutboundClusterName(c.Port, c.Version, strings.ToLower(c.ServiceName)+".eureka")
+}
+
+func (c EurekaCluster) HostName() string {
+	if c.Host != "" {
+		return c.Host
+	}
+	return strings.ToLower(c.ServiceName)
+}
+
+// StaticIpCluster is a service registered with a static list of IP:port addresses, such as the
+// "static" registry of McpBridge. The port defaults to 80, the port of static services.
 type StaticIpCluster struct {
 	ServiceName string
 	Port        int64
@@ -121,7 +175,11 @@ type StaticIpCluster struct {
 }
 
 func (c StaticIpCluster) ClusterName() string {
-	return fmt.Sprintf("outbound|%d||%s.static", c.Port, c.ServiceName)
+	port := c.Port
+	if port == 0 {
+		port = 80
+	}
+	return BuildOutboundClusterName(port, "", c.ServiceName+".static")
 }
 
 func (c StaticIpCluster) HostName() string {
@@ -131,6 +189,56 @@ func (c StaticIpCluster) HostName() string {
 	return c.ServiceName
 }
 
+// ParseStaticIpAddresses parses a comma-separated list of IP:port addresses, the format of the
+// domain of a static service, e.g. "10.0.0.1:8080,[::1]:8080".
+func ParseStaticIpAddresses(addresses string) ([]string, error) {
+	var result []string
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static address %s: %v", address, err)
+		}
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("invalid ip in static address: %s", address)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port in static address: %s", address)
+		}
+		result = append(result, address)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no static address found in: %s", addresses)
+	}
+	return result, nil
+}
+
+// UnixSocketCluster is a sidecar-local service listening on a unix domain socket, e.g. a local
+// inference runtime. The gateway must define a cluster with a pipe endpoint for the socket, named
+// Cluster or, by default, "uds:<path>".
+type UnixSocketCluster struct {
+	Path    string
+	Cluster string
+	Host    string
+}
+
+func (c UnixSocketCluster) ClusterName() string {
+	if c.Cluster != "" {
+		return c.Cluster
+	}
+	return "uds:" + c.Path
+}
+
+func (c UnixSocketCluster) HostName() string {
+	if c.Host != "" {
+		return c.Host
+	}
+	return "localhost"
+}
+
 type DnsCluster struct {
 	ServiceName string
 	Domain      string
@@ -138,7 +246,7 @@ type DnsCluster struct {
 }
 
 func (c DnsCluster) ClusterName() string {
-	return fmt.Sprintf("outbound|%d||%s.dns", c.Port, c.ServiceName)
+	return BuildOutboundClusterName(c.Port, "", c.ServiceName+".dns")
 }
 
 func (c DnsCluster) HostName() string {
@@ -154,8 +262,8 @@ type ConsulCluster struct {
 
 func (c ConsulCluster) ClusterName() string {
 	tail := "consul"
-	return fmt.Sprintf("outbound|%d||%s.%s.%s",
-		c.Port, c.ServiceName, c.Datacenter, tail)
+	return BuildOutboundClusterName(c.Port, "",
+		fmt.Sprintf("%s.%s.%s", c.ServiceName, c.Datacenter, tail))
 }
 
 func (c ConsulCluster) HostName() string {
@@ -172,7 +280,7 @@ type FQDNCluster struct {
 }
 
 func (c FQDNCluster) ClusterName() string {
-	return fmt.Sprintf("outbound|%d||%s", c.Port, c.FQDN)
+	return BuildOutboundClusterName(c.Port, "", c.FQDN)
 }
 
 func (c FQDNCluster) HostName() string {
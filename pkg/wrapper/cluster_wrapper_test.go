@@ -48,6 +48,15 @@ func TestClusterAndHost(t *testing.T) {
 			expectCluster: "outbound|8080||foo.default.svc.cluster.local",
 			expectHost:    "www.example.com",
 		},
+		{
+			name: "k8s default namespace host",
+			cluster: K8sCluster{
+				ServiceName: "foo",
+				Port:        8080,
+			},
+			expectCluster: "outbound|8080||foo.default.svc.cluster.local",
+			expectHost:    "foo.default.svc.cluster.local",
+		},
 		{
 			name: "nacos",
 			cluster: NacosCluster{
@@ -72,6 +81,26 @@ func TestClusterAndHost(t *testing.T) {
 			expectCluster: "outbound|8080||foo.DEFAULT-GROUP.xxxx.nacos-ext",
 			expectHost:    "www.test.com",
 		},
+		{
+			name: "nacos public namespace",
+			cluster: NacosCluster{
+				ServiceName: "foo",
+				Group:       "my_group",
+				Port:        8080,
+			},
+			expectCluster: "outbound|8080||foo.my-group.public.nacos",
+			expectHost:    "foo",
+		},
+		{
+			name: "eureka",
+			cluster: EurekaCluster{
+				ServiceName: "FOO-SERVICE",
+				Port:        8080,
+				Version:     "v1",
+			},
+			expectCluster: "outbound|8080|v1|foo-service.eureka",
+			expectHost:    "foo-service",
+		},
 		{
 			name: "static",
 			cluster: StaticIpCluster{
@@ -82,6 +111,32 @@ func TestClusterAndHost(t *testing.T) {
 			expectCluster: "outbound|8080||foo.static",
 			expectHost:    "www.test.com",
 		},
+		{
+			name: "static default port",
+			cluster: StaticIpCluster{
+				ServiceName: "foo",
+			},
+			expectCluster: "outbound|80||foo.static",
+			expectHost:    "foo",
+		},
+		{
+			name: "unix socket",
+			cluster: UnixSocketCluster{
+				Path: "/var/run/llm.sock",
+			},
+			expectCluster: "uds:/var/run/llm.sock",
+			expectHost:    "localhost",
+		},
+		{
+			name: "unix socket with cluster",
+			cluster: UnixSocketCluster{
+				Path:    "/var/run/llm.sock",
+				Cluster: "local-llm",
+				Host:    "llm.local",
+			},
+			expectCluster: "local-llm",
+			expectHost:    "llm.local",
+		},
 		{
 			name: "dns",
 			cluster: DnsCluster{
@@ -100,3 +155,29 @@ func TestClusterAndHost(t *testing.T) {
 		})
 	}
 }
+
+func TestParseOutboundClusterName(t *testing.T) {
+	name := BuildOutboundClusterName(8080, "v1", "foo.bar.svc.cluster.local")
+	assert.Equal(t, "outbound|8080|v1|foo.bar.svc.cluster.local", name)
+	port, subset, host, err := ParseOutboundClusterName(name)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8080), port)
+	assert.Equal(t, "v1", subset)
+	assert.Equal(t, "foo.bar.svc.cluster.local", host)
+
+	for _, invalid := range []string{"", "inbound|8080||foo", "outbound|http||foo", "outbound|0||foo", "outbound|8080||", "outbound|8080|foo"} {
+		_, _, _, err = ParseOutboundClusterName(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseStaticIpAddresses(t *testing.T) {
+	addresses, err := ParseStaticIpAddresses("10.0.0.1:8080, [::1]:9090,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:8080", "[::1]:9090"}, addresses)
+
+	for _, invalid := range []string{"", "10.0.0.1", "foo.com:80", "10.0.0.1:0", "10.0.0.1:http"} {
+		_, err = ParseStaticIpAddresses(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultEjectionDuration = 30 * time.Second
+)
+
+// WeightedCluster is a cluster of a CompositeClient with its relative share of the callouts.
+type WeightedCluster struct {
+	Cluster Cluster
+	Weight  int
+}
+
+type clusterHealth struct {
+	failures     int
+	ejectedUntil time.Time
+}
+
+// CompositeClient spreads callouts across several clusters by weight, e.g. the regional endpoints
+// of an AI provider. A callout that fails is retried on another cluster, and a cluster that fails
+// FailureThreshold times in a row is ejected for EjectionDuration. Health is tracked per plugin VM.
+type CompositeClient struct {
+	clusters         []WeightedCluster
+	health           []clusterHealth
+	failureThreshold int
+	ejectionDuration time.Duration
+	maxFailovers     int
+	isFailure        func(statusCode int) bool
+	randIntn         func(n int) int
+}
+
+type CompositeClientOption func(c *CompositeClient)
+
+// WithFailureThreshold sets the number of consecutive failures after which a cluster is ejected, default 3.
+func WithFailureThreshold(threshold int) CompositeClientOption {
+	return func(c *CompositeClient) {
+		c.failureThreshold = threshold
+	}
+}
+
+// WithEjectionDuration sets how long an ejected cluster receives no callouts, default 30s.
+func WithEjectionDuration(duration time.Duration) CompositeClientOption {
+	return func(c *CompositeClient) {
+		c.ejectionDuration = duration
+	}
+}
+
+// WithMaxFailovers limits how many other clusters a failed callout is retried on, default all of them.
+func WithMaxFailovers(maxFailovers int) CompositeClientOption {
+	return func(c *CompositeClient) {
+		c.maxFailovers = maxFailovers
+	}
+}
+
+// WithFailureStatus sets which response status codes count as failures, default 5xx and 429.
+func WithFailureStatus(isFailure func(statusCode int) bool) CompositeClientOption {
+	return func(c *CompositeClient) {
+		c.isFailure = isFailure
+	}
+}
+
+// NewCompositeClient creates a client over the given clusters, clusters with a non-positive weight are ignored.
+// It must be created in the config phase, so that cluster health is shared by all requests of the VM.
+func NewCompositeClient(clusters []WeightedCluster, opts ...CompositeClientOption) (*CompositeClient, error) {
+	c := &CompositeClient{
+		failureThreshold: defaultFailureThreshold,
+		ejectionDuration: defaultEjectionDuration,
+		isFailure: func(statusCode int) bool {
+			return statusCode >= 500 || statusCode == http.StatusTooManyRequests
+		},
+		randIntn: rand.Intn,
+	}
+	for _, cluster := range clusters {
+		if cluster.Cluster != nil && cluster.Weight > 0 {
+			c.clusters = append(c.clusters, cluster)
+		}
+	}
+	if len(c.clusters) == 0 {
+		return nil, errors.New("composite client needs at least one cluster with a positive weight")
+	}
+	c.health = make([]clusterHealth, len(c.clusters))
+	c.maxFailovers = len(c.clusters) - 1
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+func (c *CompositeClient) Get(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodGet, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Head(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodHead, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Options(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodOptions, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Post(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPost, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Put(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPut, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Patch(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPatch, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Delete(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodDelete, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Connect(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodConnect, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *CompositeClient) Trace(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodTrace, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+
+// Call sends the callout to a healthy cluster picked by weight, failing over to other clusters
+// when it fails. The callback receives the response of the last attempt.
+func (c *CompositeClient) Call(method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	tried := make([]bool, len(c.clusters))
+	return c.attempt(tried, 0, method, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+
+// ClusterName returns the name of the first cluster
+func (c *CompositeClient) ClusterName() string {
+	return c.clusters[0].Cluster.ClusterName()
+}
+
+func (c *CompositeClient) attempt(tried []bool, failovers int, method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	index := c.pick(tried)
+	tried[index] = true
+	cluster := c.clusters[index].Cluster
+	// HttpCall modifies the headers in place, every attempt needs its own copy
+	attemptHeaders := append([][2]string(nil), headers...)
+	err := HttpCall(cluster, method, rawURL, attemptHeaders, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		if !c.isFailure(statusCode) {
+			c.markSuccess(index)
+			cb(statusCode, responseHeaders, responseBody)
+			return
+		}
+		c.markFailure(index)
+		if failovers < c.maxFailovers && c.hasUntried(tried) {
+			log.Warnf("callout to cluster %s failed with status %d, failing over", cluster.ClusterName(), statusCode)
+			if err := c.attempt(tried, failovers+1, method, rawURL, headers, body, cb, timeoutMillisecond...); err == nil {
+				return
+			}
+		}
+		cb(statusCode, responseHeaders, responseBody)
+	}, timeoutMillisecond...)
+	if err != nil {
+		c.markFailure(index)
+		if failovers < c.maxFailovers && c.hasUntried(tried) {
+			log.Warnf("failed to dispatch callout to cluster %s: %v, failing over", cluster.ClusterName(), err)
+			return c.attempt(tried, failovers+1, method, rawURL, headers, body, cb, timeoutMillisecond...)
+		}
+	}
+	return err
+}
+
+// pick chooses an untried cluster by weight, preferring healthy ones. Ejected clusters are only
+// used when no healthy cluster is left, so that callouts are never dropped.
+func (c *CompositeClient) pick(tried []bool) int {
+	now := time.Now()
+	for _, healthyOnly := range []bool{true, false} {
+		total := 0
+		for i, cluster := range c.clusters {
+			if !tried[i] && (!healthyOnly || !now.Before(c.health[i].ejectedUntil)) {
+				total += cluster.Weight
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		n := c.randIntn(total)
+		for i, cluster := range c.clusters {
+			if tried[i] || (healthyOnly && now.Before(c.health[i].ejectedUntil)) {
+				continue
+			}
+			if n < cluster.Weight {
+				return i
+			}
+			n -= cluster.Weight
+		}
+	}
+	return 0
+}
+
+func (c *CompositeClient) hasUntried(tried []bool) bool {
+	for _, t := range tried {
+		if !t {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CompositeClient) markSuccess(index int) {
+	c.health[index] = clusterHealth{}
+}
+
+func (c *CompositeClient) markFailure(index int) {
+	health := &c.health[index]
+	health.failures++
+	if health.failures >= c.failureThreshold {
+		health.ejectedUntil = time.Now().Add(c.ejectionDuration)
+		health.failures = 0
+		log.Warnf("cluster %s ejected for %s after %d consecutive failures", c.clusters[index].Cluster.ClusterName(), c.ejectionDuration, c.failureThreshold)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompositeClientPick(t *testing.T) {
+	_, err := NewCompositeClient([]WeightedCluster{{Cluster: TargetCluster{Cluster: "a"}}})
+	assert.Error(t, err, "clusters without weight are ignored")
+
+	client, err := NewCompositeClient([]WeightedCluster{
+		{Cluster: TargetCluster{Cluster: "a"}, Weight: 3},
+		{Cluster: TargetCluster{Cluster: "b"}, Weight: 1},
+	})
+	assert.NoError(t, err)
+	for n, expected := range map[int]int{0: 0, 2: 0, 3: 1} {
+		client.randIntn = func(int) int { return n }
+		assert.Equal(t, expected, client.pick([]bool{false, false}), n)
+	}
+	client.randIntn = func(int) int { return 0 }
+	assert.Equal(t, 1, client.pick([]bool{true, false}))
+
+	client.health[0].ejectedUntil = time.Now().Add(time.Minute)
+	assert.Equal(t, 1, client.pick([]bool{false, false}), "ejected clusters are skipped")
+	assert.Equal(t, 0, client.pick([]bool{false, true}), "ejected clusters are used when nothing else is left")
+}
+
+func TestCompositeClientFailover(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("composite-client-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	client, err := NewCompositeClient([]WeightedCluster{
+		{Cluster: TargetCluster{Cluster: "us", Host: "us.example.com"}, Weight: 1},
+		{Cluster: TargetCluster{Cluster: "eu", Host: "eu.example.com"}, Weight: 1},
+	}, WithFailureThreshold(1))
+	assert.NoError(t, err)
+	client.randIntn = func(int) int { return 0 }
+
+	var status int
+	var body string
+	headers := [][2]string{{"Content-Type", "application/json"}}
+	assert.NoError(t, client.Post("/v1/chat", headers, []byte(`{}`), func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		status, body = statusCode, string(responseBody)
+	}, 1000))
+
+	callouts := host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, "us", callouts[0].Upstream)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "503"}}, nil, []byte("unavailable"))
+	}
+	callouts = host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, "eu", callouts[0].Upstream)
+		assert.Contains(t, callouts[0].Headers, [2]string{":authority", "eu.example.com"})
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, []byte("ok"))
+	}
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "ok", body)
+	assert.Equal(t, [][2]string{{"Content-Type", "application/json"}}, headers, "caller headers must not be modified")
+	assert.True(t, time.Now().Before(client.health[0].ejectedUntil), "failed cluster is ejected")
+
+	// The ejected cluster is skipped, when the last cluster fails its response is returned
+	assert.NoError(t, client.Get("/v1/models", nil, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		status = statusCode
+	}))
+	callouts = host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, "eu", callouts[0].Upstream)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "429"}}, nil, nil)
+	}
+	callouts = host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, "us", callouts[0].Upstream)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "500"}}, nil, nil)
+	}
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id))
+	assert.Equal(t, 500, status)
+}
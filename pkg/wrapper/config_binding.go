@@ -0,0 +1,226 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+// ParseConfigInto parses the plugin config with BindConfig instead of a hand-written parse function
+func ParseConfigInto[PluginConfig any]() CtxOption[PluginConfig] {
+	return &parseConfigOption[PluginConfig]{rawF: BindConfig[PluginConfig]}
+}
+
+// BindConfig unmarshals the config JSON into the config struct and checks it against the tags of
+// its fields, including the fields of nested structs and of structs in slices:
+//
+//	type Config struct {
+//		Mode    string   `json:"mode" default:"strict" enum:"strict,lenient"`
+//		Timeout int      `json:"timeout" default:"500" min:"1" max:"60000"`
+//		Keys    []string `json:"keys" required:"true" min:"1"`
+//	}
+//
+// default is the value of a field missing from the JSON, as JSON or as a plain string for string
+// fields. required fails when a field without default is missing. enum lists the allowed values
+// of a field or of the elements of a slice. min and max bound numbers, and the length of strings,
+// slices and maps. All failed checks are returned together, each as a *configerr.Error.
+func BindConfig[T any](configBytes []byte, config *T) error {
+	if len(bytes.TrimSpace(configBytes)) == 0 {
+		configBytes = []byte("{}")
+	}
+	if err := configerr.DecodeJSON("", configBytes, config); err != nil {
+		return err
+	}
+	v := reflect.ValueOf(config).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs []error
+	bindStruct("", json.RawMessage(configBytes), true, v, &errs)
+	return errors.Join(errs...)
+}
+
+// bindStruct applies the tags of the fields of v, raw is the JSON object v was decoded from, present
+// tells whether it is in the config at all
+func bindStruct(pointer string, raw json.RawMessage, present bool, v reflect.Value, errs *[]error) {
+	var obj map[string]json.RawMessage
+	if present {
+		_ = json.Unmarshal(raw, &obj)
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			if fv.Kind() == reflect.Struct {
+				bindStruct(pointer, raw, present, fv, errs)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fieldPointer := configerr.Join(pointer, name)
+		fieldRaw, found := lookupJSONField(obj, name)
+		if found && string(fieldRaw) == "null" {
+			found = false
+		}
+		set := found
+		if !found {
+			if def, ok := field.Tag.Lookup("default"); ok {
+				if err := setDefault(fv, def); err != nil {
+					*errs = append(*errs, configerr.Errorf(fieldPointer, "", "invalid default %q: %v", def, err))
+					continue
+				}
+				set = true
+			} else if present && field.Tag.Get("required") == "true" {
+				*errs = append(*errs, configerr.Errorf(fieldPointer, "", "required field is missing"))
+				continue
+			}
+		}
+		if set {
+			validateField(fieldPointer, field, fv, errs)
+		}
+		bindNested(fieldPointer, fieldRaw, found, fv, errs)
+	}
+}
+
+// bindNested applies the tags of structs nested in a field
+func bindNested(pointer string, raw json.RawMessage, present bool, v reflect.Value, errs *[]error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		bindStruct(pointer, raw, present, v, errs)
+	case reflect.Ptr:
+		if !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+			bindStruct(pointer, raw, present, v.Elem(), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if present {
+			_ = json.Unmarshal(raw, &elems)
+		}
+		for i := 0; i < v.Len() && i < len(elems); i++ {
+			bindNested(configerr.Join(pointer, i), elems[i], true, v.Index(i), errs)
+		}
+	}
+}
+
+// jsonFieldName returns the name of the field in JSON, false for fields skipped by encoding/json
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, true
+}
+
+// lookupJSONField finds a key like encoding/json does, preferring an exact match over a case-insensitive one
+func lookupJSONField(obj map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if raw, ok := obj[name]; ok {
+		return raw, true
+	}
+	for key, raw := range obj {
+		if strings.EqualFold(key, name) {
+			return raw, true
+		}
+	}
+	return nil, false
+}
+
+func setDefault(v reflect.Value, def string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(def)
+		return nil
+	}
+	return json.Unmarshal([]byte(def), v.Addr().Interface())
+}
+
+func validateField(pointer string, field reflect.StructField, v reflect.Value, errs *[]error) {
+	if enum, ok := field.Tag.Lookup("enum"); ok {
+		allowed := strings.Split(enum, ",")
+		check := func(pointer string, elem reflect.Value) {
+			value := fmt.Sprint(elem.Interface())
+			for _, a := range allowed {
+				if value == a {
+					return
+				}
+			}
+			*errs = append(*errs, configerr.Errorf(pointer, "one of "+strings.Join(allowed, ", "), "got %q", value))
+		}
+		if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			for i := 0; i < v.Len(); i++ {
+				check(configerr.Join(pointer, i), v.Index(i))
+			}
+		} else {
+			check(pointer, v)
+		}
+	}
+	for _, bound := range []string{"min", "max"} {
+		tag, ok := field.Tag.Lookup(bound)
+		if !ok {
+			continue
+		}
+		limit, err := strconv.ParseFloat(tag, 64)
+		if err != nil {
+			*errs = append(*errs, configerr.Errorf(pointer, "", "invalid %s %q: %v", bound, tag, err))
+			continue
+		}
+		value, what := boundedValue(v)
+		if what == "" {
+			continue
+		}
+		if bound == "min" && value < limit {
+			*errs = append(*errs, configerr.Errorf(pointer, fmt.Sprintf("%s of at least %s", what, tag), "got %v", value))
+		}
+		if bound == "max" && value > limit {
+			*errs = append(*errs, configerr.Errorf(pointer, fmt.Sprintf("%s of at most %s", what, tag), "got %v", value))
+		}
+	}
+}
+
+// boundedValue returns what min and max bound for the value, numbers or lengths
+func boundedValue(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "a value"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "a value"
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "a value"
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "a length"
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return boundedValue(v.Elem())
+		}
+	}
+	return 0, ""
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+type boundUpstream struct {
+	Name    string `json:"name" required:"true"`
+	Weight  int    `json:"weight" default:"1" min:"0" max:"100"`
+	Enabled bool   `json:"enabled" default:"true"`
+}
+
+type boundLimits struct {
+	Burst int `json:"burst" default:"10" min:"1"`
+}
+
+type boundConfig struct {
+	Mode      string          `json:"mode" default:"strict" enum:"strict,lenient"`
+	Timeout   float64         `json:"timeout" default:"0.5" min:"0.1"`
+	Keys      []string        `json:"keys" required:"true" min:"1"`
+	Methods   []string        `json:"methods,omitempty" default:"[\"GET\"]" enum:"GET,POST"`
+	Upstreams []boundUpstream `json:"upstreams"`
+	Limits    boundLimits     `json:"limits"`
+	Ignored   string          `json:"-" required:"true"`
+}
+
+func TestBindConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		var config boundConfig
+		require.NoError(t, BindConfig([]byte(`{"keys":["a"],"upstreams":[{"name":"a"},{"name":"b","weight":0,"enabled":false}]}`), &config))
+		assert.Equal(t, boundConfig{
+			Mode:    "strict",
+			Timeout: 0.5,
+			Keys:    []string{"a"},
+			Methods: []string{"GET"},
+			Upstreams: []boundUpstream{
+				{Name: "a", Weight: 1, Enabled: true},
+				{Name: "b", Weight: 0, Enabled: false},
+			},
+			Limits: boundLimits{Burst: 10},
+		}, config)
+	})
+
+	t.Run("errors are aggregated", func(t *testing.T) {
+		var config boundConfig
+		err := BindConfig([]byte(`{"mode":"loose","timeout":0,"keys":[],"methods":["GET","PUT"],"upstreams":[{"weight":101}],"limits":{"burst":0}}`), &config)
+		require.Error(t, err)
+		var pointers []string
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var cfgErr *configerr.Error
+			require.True(t, errors.As(e, &cfgErr), e.Error())
+			pointers = append(pointers, cfgErr.Pointer)
+		}
+		assert.Equal(t, []string{"/mode", "/timeout", "/keys", "/methods/1", "/upstreams/0/name", "/upstreams/0/weight", "/limits/burst"}, pointers)
+		assert.ErrorContains(t, err, `invalid config at "/mode", expected one of strict, lenient: got "loose"`)
+		assert.ErrorContains(t, err, `invalid config at "/keys", expected a length of at least 1: got 0`)
+		assert.ErrorContains(t, err, `invalid config at "/upstreams/0/name": required field is missing`)
+		assert.ErrorContains(t, err, `invalid config at "/upstreams/0/weight", expected a value of at most 100: got 101`)
+	})
+
+	t.Run("type errors", func(t *testing.T) {
+		var config boundConfig
+		err := BindConfig([]byte(`{"keys":"a"}`), &config)
+		assert.EqualError(t, err, `invalid config at "/keys", expected array: got string`)
+	})
+
+	t.Run("empty config", func(t *testing.T) {
+		var config boundConfig
+		assert.EqualError(t, BindConfig(nil, &config), `invalid config at "/keys": required field is missing`)
+	})
+}
+
+func TestParseConfigInto(t *testing.T) {
+	var parsed boundConfig
+	vm := NewCommonVmCtx("parse-config-into-test",
+		ParseConfigInto[boundConfig](),
+		ProcessRequestHeaders(func(ctx HttpContext, config boundConfig) types.Action {
+			parsed = config
+			return types.ActionContinue
+		}),
+	)
+	startPlugin := func(config string) (proxytest.HostEmulator, types.OnPluginStartStatus, func()) {
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(config)))
+		host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+		return host, host.StartPlugin(), reset
+	}
+
+	t.Run("valid config", func(t *testing.T) {
+		host, status, reset := startPlugin(`{"keys":["a"],"mode":"lenient"}`)
+		defer reset()
+		require.Equal(t, types.OnPluginStartStatusOK, status)
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+		assert.Equal(t, "lenient", parsed.Mode)
+		assert.Equal(t, 10, parsed.Limits.Burst)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		_, status, reset := startPlugin(`{"mode":"loose"}`)
+		defer reset()
+		assert.Equal(t, types.OnPluginStartStatusFailed, status)
+	})
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type mergedRuleConfigOption[PluginConfig any] struct{}
+
+func (o *mergedRuleConfigOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.mergeRuleConfig = true
+}
+
+// WithMergedRuleConfig parses the config of every rule in _rules_ merged onto the global config, so
+// that a rule only lists the fields it overrides, e.g. with the config
+//
+//	timeout: 500
+//	headers: {x-env: prod, x-team: core}
+//	_rules_:
+//	- _match_route_: [slow-route]
+//	  timeout: 3000
+//	  headers: {x-team: null}
+//
+// the rule of slow-route is parsed as {timeout: 3000, headers: {x-env: prod}}. Objects are merged
+// recursively, other values including arrays are replaced, and null removes a field, see MergeConfigJSON.
+// The parse function of ParseOverrideConfig still runs for rules, with the merged config.
+func WithMergedRuleConfig[PluginConfig any]() CtxOption[PluginConfig] {
+	return &mergedRuleConfigOption[PluginConfig]{}
+}
+
+// MergeConfigJSON deep merges the override onto the base following JSON Merge Patch (RFC 7386)
+func MergeConfigJSON(base, override []byte) ([]byte, error) {
+	var baseValue, overrideValue interface{}
+	if err := decodeConfigJSON(base, &baseValue); err != nil {
+		return nil, fmt.Errorf("failed to decode base config: %v", err)
+	}
+	if err := decodeConfigJSON(override, &overrideValue); err != nil {
+		return nil, fmt.Errorf("failed to decode override config: %v", err)
+	}
+	return json.Marshal(mergeConfigValue(baseValue, overrideValue))
+}
+
+func decodeConfigJSON(data []byte, v *interface{}) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		*v = map[string]interface{}{}
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as they are written, large integers would lose precision as float64
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func mergeConfigValue(base, override interface{}) interface{} {
+	overrideObj, ok := override.(map[string]interface{})
+	if !ok {
+		return override
+	}
+	baseObj, ok := base.(map[string]interface{})
+	if !ok {
+		baseObj = map[string]interface{}{}
+	}
+	merged := make(map[string]interface{}, len(baseObj)+len(overrideObj))
+	for k, v := range baseObj {
+		merged[k] = v
+	}
+	for k, v := range overrideObj {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		merged[k] = mergeConfigValue(merged[k], v)
+	}
+	return merged
+}
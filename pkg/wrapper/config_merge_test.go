@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestMergeConfigJSON(t *testing.T) {
+	merged, err := MergeConfigJSON(
+		[]byte(`{"timeout":500,"id":12345678901234567890,"headers":{"x-env":"prod","x-team":"core"},"keys":["a","b"]}`),
+		[]byte(`{"timeout":3000,"headers":{"x-team":null,"x-new":"1"},"keys":["c"]}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"timeout":3000,"id":12345678901234567890,"headers":{"x-env":"prod","x-new":"1"},"keys":["c"]}`, string(merged))
+	assert.Contains(t, string(merged), "12345678901234567890")
+
+	merged, err = MergeConfigJSON(nil, []byte(`{"a":{"b":1}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"b":1}}`, string(merged))
+
+	merged, err = MergeConfigJSON([]byte(`{"a":"scalar"}`), []byte(`{"a":{"b":1}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"b":1}}`, string(merged))
+
+	_, err = MergeConfigJSON([]byte(`{`), nil)
+	assert.ErrorContains(t, err, "failed to decode base config")
+}
+
+type mergedTestConfig struct {
+	timeout int64
+	headers map[string]string
+}
+
+func TestMergedRuleConfig(t *testing.T) {
+	var effective any
+	var handled mergedTestConfig
+	vm := NewCommonVmCtx("merged-rule-config-test",
+		WithMergedRuleConfig[mergedTestConfig](),
+		ParseConfig(func(json gjson.Result, config *mergedTestConfig) error {
+			config.timeout = json.Get("timeout").Int()
+			config.headers = map[string]string{}
+			for k, v := range json.Get("headers").Map() {
+				config.headers[k] = v.String()
+			}
+			return nil
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config mergedTestConfig) types.Action {
+			effective = ctx.EffectiveConfig()
+			handled = config
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{
+		"timeout": 500,
+		"headers": {"x-env": "prod", "x-team": "core"},
+		"_rules_": [{"_match_domain_": ["slow.example.com"], "timeout": 3000, "headers": {"x-team": null}}]
+	}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	for _, tc := range []struct {
+		domain   string
+		expected mergedTestConfig
+	}{
+		{"slow.example.com", mergedTestConfig{timeout: 3000, headers: map[string]string{"x-env": "prod"}}},
+		{"example.com", mergedTestConfig{timeout: 500, headers: map[string]string{"x-env": "prod", "x-team": "core"}}},
+	} {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", tc.domain}, {":path", "/"}}, true)
+		assert.Equal(t, tc.expected, handled, tc.domain)
+		assert.Equal(t, tc.expected, effective, tc.domain)
+		host.CompleteHttpContext(id)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+type onConfigUpdateFunc[PluginConfig any] func(context PluginContext, oldConfig, newConfig PluginConfig) error
+
+type configUpdateOption[PluginConfig any] struct {
+	f onConfigUpdateFunc[PluginConfig]
+}
+
+func (o *configUpdateOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.onConfigUpdate = o.f
+}
+
+// OnConfigUpdate registers a callback run when the host pushes a new plugin configuration to a running
+// VM, after the new configuration is parsed successfully. It receives the global configs parsed
+// before and after the update, zero values for plugins only configured with _rules_, so that state
+// derived from the config, e.g. compiled regexes or auth caches, is rebuilt without restarting the VM.
+// It does not run at the first start of the plugin. An error fails the start of the new configuration.
+// Plugins sharing the VM, told apart by their _plugin_id_, have their own configuration history.
+func OnConfigUpdate[PluginConfig any](f func(context PluginContext, oldConfig, newConfig PluginConfig) error) CtxOption[PluginConfig] {
+	return &configUpdateOption[PluginConfig]{f: f}
+}
+
+// notifyConfigUpdate runs the OnConfigUpdate callback when a configuration of the plugin was parsed before
+func (ctx *CommonPluginCtx[PluginConfig]) notifyConfigUpdate() error {
+	if ctx.vm.onConfigUpdate == nil {
+		return nil
+	}
+	newConfig, _ := ctx.GetGlobalConfig()
+	oldConfig := ctx.vm.lastConfigs[ctx.pluginID]
+	if oldConfig != nil {
+		if err := ctx.vm.onConfigUpdate(ctx, *oldConfig, newConfig); err != nil {
+			return err
+		}
+	}
+	if ctx.vm.lastConfigs == nil {
+		ctx.vm.lastConfigs = map[string]*PluginConfig{}
+	}
+	ctx.vm.lastConfigs[ctx.pluginID] = &newConfig
+	return nil
+}
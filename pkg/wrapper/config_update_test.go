@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+type updateTestConfig struct {
+	pattern string
+}
+
+func TestOnConfigUpdate(t *testing.T) {
+	var updates [][2]string
+	var compiled *regexp.Regexp
+	vm := NewCommonVmCtx("config-update-test",
+		ParseConfig(func(json gjson.Result, config *updateTestConfig) error {
+			config.pattern = json.Get("pattern").String()
+			return nil
+		}),
+		OnConfigUpdate(func(context PluginContext, oldConfig, newConfig updateTestConfig) error {
+			updates = append(updates, [2]string{oldConfig.pattern, newConfig.pattern})
+			re, err := regexp.Compile(newConfig.pattern)
+			if err != nil {
+				return errors.New("invalid pattern")
+			}
+			compiled = re
+			return nil
+		}),
+	)
+	// Every start of an emulator creates a new plugin context in the same VM, like a config push of the host
+	start := func(config string) types.OnPluginStartStatus {
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(config)))
+		defer reset()
+		host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+		return host.StartPlugin()
+	}
+
+	assert.Equal(t, types.OnPluginStartStatusOK, start(`{"pattern":"^a"}`))
+	assert.Empty(t, updates, "not called at the first start")
+
+	assert.Equal(t, types.OnPluginStartStatusOK, start(`{"pattern":"^b"}`))
+	assert.Equal(t, [][2]string{{"^a", "^b"}}, updates)
+	assert.Equal(t, "^b", compiled.String())
+
+	assert.Equal(t, types.OnPluginStartStatusFailed, start(`{"pattern":"("}`))
+	assert.Equal(t, "^b", compiled.String())
+
+	// The failed update is not the old config of the next one
+	assert.Equal(t, types.OnPluginStartStatusOK, start(`{"pattern":"^c"}`))
+	assert.Equal(t, [][2]string{{"^a", "^b"}, {"^b", "("}, {"^b", "^c"}}, updates)
+
+	// Another plugin sharing the VM has its own configs
+	updates = nil
+	assert.Equal(t, types.OnPluginStartStatusOK, start(`{"_plugin_id_":"other","pattern":"^x"}`))
+	assert.Empty(t, updates, "the first config of another plugin is not an update")
+	assert.Equal(t, types.OnPluginStartStatusOK, start(`{"_plugin_id_":"other","pattern":"^y"}`))
+	assert.Equal(t, types.OnPluginStartStatusOK, start(`{"pattern":"^d"}`))
+	assert.Equal(t, [][2]string{{"^x", "^y"}, {"^c", "^d"}}, updates)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+// Consumer is the authenticated caller of a request, see pkg/consumer to authenticate it
+type Consumer = iface.Consumer
+
+// ConsumerAttribute is the user attribute holding the name of the consumer set with SetConsumer
+const ConsumerAttribute = "consumer"
+
+func (ctx *CommonHttpCtx[PluginConfig]) Consumer() *Consumer {
+	if !ctx.consumerLoaded {
+		ctx.consumerLoaded = true
+		if name, err := proxywasm.GetHttpRequestHeader(consumerHeader); err == nil && name != "" {
+			ctx.consumer = &Consumer{Name: name}
+		}
+	}
+	return ctx.consumer
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) SetConsumer(consumer *Consumer) {
+	ctx.consumer, ctx.consumerLoaded = consumer, true
+	if consumer == nil {
+		_ = proxywasm.RemoveHttpRequestHeader(consumerHeader)
+		return
+	}
+	_ = proxywasm.ReplaceHttpRequestHeader(consumerHeader, consumer.Name)
+	ctx.SetUserAttribute(ConsumerAttribute, consumer.Name)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestConsumer(t *testing.T) {
+	var consumers []*Consumer
+	vm := NewCommonVmCtx("consumer-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			consumers = append(consumers, ctx.Consumer())
+			switch ctx.Path() {
+			case "/login":
+				ctx.SetConsumer(&Consumer{Name: "alice", Scheme: "key"})
+				consumers = append(consumers, ctx.Consumer())
+			case "/anonymous":
+				ctx.SetConsumer(nil)
+				consumers = append(consumers, ctx.Consumer())
+			}
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	// The consumer authenticated by a plugin of the gateway
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"x-mse-consumer", "bob"}}, true)
+	host.CompleteHttpContext(id)
+	assert.Equal(t, []*Consumer{{Name: "bob"}}, consumers)
+
+	consumers = nil
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/login"}}, true)
+	assert.Equal(t, "alice", headerValue(host.GetCurrentRequestHeaders(id), "x-mse-consumer"))
+	host.CompleteHttpContext(id)
+	assert.Equal(t, []*Consumer{nil, {Name: "alice", Scheme: "key"}}, consumers)
+
+	// A consumer set by the client is removed
+	consumers = nil
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/anonymous"}, {"x-mse-consumer", "mallory"}}, true)
+	assert.Empty(t, headerValue(host.GetCurrentRequestHeaders(id), "x-mse-consumer"))
+	host.CompleteHttpContext(id)
+	assert.Equal(t, []*Consumer{{Name: "mallory"}, nil}, consumers)
+}
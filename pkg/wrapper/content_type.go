@@ -0,0 +1,216 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeSSE  = "text/event-stream"
+	ContentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// BodyType is the kind of a request or response body, see DetectBodyType
+type BodyType int
+
+const (
+	BodyTypeUnknown BodyType = iota
+	BodyTypeJSON
+	BodyTypeSSE
+	BodyTypeForm
+)
+
+func (t BodyType) String() string {
+	switch t {
+	case BodyTypeJSON:
+		return "json"
+	case BodyTypeSSE:
+		return "sse"
+	case BodyTypeForm:
+		return "form"
+	}
+	return "unknown"
+}
+
+// MediaRange is an element of an Accept header, e.g. text/* or application/json;q=0.5
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Q       float64
+}
+
+// Matches reports whether the media type falls within the range
+func (r MediaRange) Matches(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	return (r.Type == "*" || strings.EqualFold(r.Type, typ)) &&
+		(r.Subtype == "*" || strings.EqualFold(r.Subtype, subtype))
+}
+
+// specificity orders ranges matching the same type: type/subtype over type/* over */*
+func (r MediaRange) specificity() int {
+	switch {
+	case r.Type == "*":
+		return 0
+	case r.Subtype == "*":
+		return 1
+	}
+	return 2 + len(r.Params)
+}
+
+// ParseMediaType parses a Content-Type header value into its lowercased media type and its parameters.
+// Unlike mime.ParseMediaType it never fails, malformed parameters are skipped.
+func ParseMediaType(value string) (string, map[string]string) {
+	mediaType, rest, _ := strings.Cut(value, ";")
+	var params map[string]string
+	for _, param := range strings.Split(rest, ";") {
+		name, val, ok := strings.Cut(param, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || name == "" {
+			continue
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[name] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType)), params
+}
+
+// ParseAccept parses an Accept header value into its media ranges, sorted from the most preferred
+// by q-value and specificity. Ranges with an invalid q-value get q=1 like browsers do.
+func ParseAccept(accept string) []MediaRange {
+	var ranges []MediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params := ParseMediaType(part)
+		if mediaType == "" {
+			continue
+		}
+		r := MediaRange{Q: 1}
+		r.Type, r.Subtype, _ = strings.Cut(mediaType, "/")
+		if r.Subtype == "" {
+			r.Subtype = "*"
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v >= 0 && v <= 1 {
+				r.Q = v
+			}
+			delete(params, "q")
+		}
+		if len(params) > 0 {
+			r.Params = params
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Q != ranges[j].Q {
+			return ranges[i].Q > ranges[j].Q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+// acceptQuality returns the q-value of the media type given by the most specific matching range,
+// -1 if no range matches
+func acceptQuality(ranges []MediaRange, mediaType string) float64 {
+	q, specificity := -1.0, -1
+	for _, r := range ranges {
+		if r.Matches(mediaType) && r.specificity() > specificity {
+			q, specificity = r.Q, r.specificity()
+		}
+	}
+	return q
+}
+
+// Accepts reports whether an Accept header value allows a response of the media type. A missing
+// Accept header accepts everything.
+func Accepts(accept, mediaType string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	return acceptQuality(ParseAccept(accept), mediaType) > 0
+}
+
+// NegotiateContentType picks the representation of a response among the offered media types,
+// preferred by the server in the given order. It returns the offer with the highest q-value in
+// the Accept header value, the first offer if the header is empty and "" if none is acceptable.
+func NegotiateContentType(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	ranges := ParseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// IsJSONContentType reports whether a Content-Type header value is JSON, including application/*+json types
+func IsJSONContentType(contentType string) bool {
+	mediaType, _ := ParseMediaType(contentType)
+	return mediaType == ContentTypeJSON || strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// IsSSEContentType reports whether a Content-Type header value is an event stream
+func IsSSEContentType(contentType string) bool {
+	mediaType, _ := ParseMediaType(contentType)
+	return mediaType == ContentTypeSSE
+}
+
+// IsFormContentType reports whether a Content-Type header value is an urlencoded form
+func IsFormContentType(contentType string) bool {
+	mediaType, _ := ParseMediaType(contentType)
+	return mediaType == ContentTypeForm
+}
+
+// DetectBodyType returns the kind of a body from its Content-Type header value. The body is only
+// sniffed when the Content-Type is missing, a body labelled otherwise is BodyTypeUnknown.
+func DetectBodyType(contentType string, body []byte) BodyType {
+	switch {
+	case IsJSONContentType(contentType):
+		return BodyTypeJSON
+	case IsSSEContentType(contentType):
+		return BodyTypeSSE
+	case IsFormContentType(contentType):
+		return BodyTypeForm
+	case strings.TrimSpace(contentType) != "":
+		return BodyTypeUnknown
+	}
+	trimmed := bytes.TrimLeft(body, " \t\r\n")
+	switch {
+	case len(trimmed) == 0:
+		return BodyTypeUnknown
+	case bytes.HasPrefix(trimmed, []byte("event:")) || bytes.HasPrefix(trimmed, []byte("data:")) ||
+		bytes.HasPrefix(trimmed, []byte("id:")) || bytes.HasPrefix(trimmed, []byte(":")):
+		return BodyTypeSSE
+	case (trimmed[0] == '{' || trimmed[0] == '[') && gjson.ValidBytes(trimmed):
+		return BodyTypeJSON
+	}
+	return BodyTypeUnknown
+}
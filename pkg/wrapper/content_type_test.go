@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMediaType(t *testing.T) {
+	mediaType, params := ParseMediaType(` Application/JSON ; charset="UTF-8"; bad`)
+	assert.Equal(t, "application/json", mediaType)
+	assert.Equal(t, map[string]string{"charset": "UTF-8"}, params)
+
+	mediaType, params = ParseMediaType("")
+	assert.Equal(t, "", mediaType)
+	assert.Nil(t, params)
+}
+
+func TestParseAccept(t *testing.T) {
+	ranges := ParseAccept("*/*;q=0.1, text/*, application/json;q=0.9, text/html;level=1, application/xml;q=x")
+	var types []string
+	for _, r := range ranges {
+		types = append(types, r.Type+"/"+r.Subtype)
+	}
+	assert.Equal(t, []string{"text/html", "application/xml", "text/*", "application/json", "*/*"}, types)
+	assert.Equal(t, map[string]string{"level": "1"}, ranges[0].Params)
+	assert.Equal(t, 1.0, ranges[1].Q)
+	assert.Equal(t, 0.1, ranges[4].Q)
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+	}{
+		{"empty accept", "", []string{ContentTypeJSON, ContentTypeSSE}, ContentTypeJSON},
+		{"both accepted", "application/json, text/event-stream", []string{ContentTypeSSE, ContentTypeJSON}, ContentTypeSSE},
+		{"q-values", "application/json;q=0.5, text/event-stream", []string{ContentTypeJSON, ContentTypeSSE}, ContentTypeSSE},
+		{"wildcard", "text/*;q=0.8, */*;q=0.1", []string{ContentTypeJSON, ContentTypeSSE}, ContentTypeSSE},
+		{"most specific range wins", "text/*, text/event-stream;q=0", []string{ContentTypeSSE, "text/plain"}, "text/plain"},
+		{"case insensitive", "Application/JSON", []string{ContentTypeJSON}, ContentTypeJSON},
+		{"nothing acceptable", "text/html", []string{ContentTypeJSON, ContentTypeSSE}, ""},
+		{"no offers", "*/*", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NegotiateContentType(tt.accept, tt.offers...))
+		})
+	}
+	assert.True(t, Accepts("", ContentTypeSSE))
+	assert.False(t, Accepts("application/json, */*;q=0", ContentTypeSSE))
+}
+
+func TestDetectBodyType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        BodyType
+	}{
+		{"json", "application/json; charset=utf-8", "", BodyTypeJSON},
+		{"json suffix", "application/vnd.api+json", "", BodyTypeJSON},
+		{"json prefix", "application/json-patch", `{}`, BodyTypeUnknown},
+		{"sse", "Text/Event-Stream", "", BodyTypeSSE},
+		{"form", "application/x-www-form-urlencoded", "a=b", BodyTypeForm},
+		{"labelled otherwise", "text/plain", `{"a":1}`, BodyTypeUnknown},
+		{"sniffed json", "", ` {"a":1}`, BodyTypeJSON},
+		{"sniffed invalid json", "", `{"a":`, BodyTypeUnknown},
+		{"sniffed sse", "", "\nevent: message\ndata: {}\n\n", BodyTypeSSE},
+		{"sniffed sse comment", "", ": ping\n\n", BodyTypeSSE},
+		{"empty", "", "", BodyTypeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectBodyType(tt.contentType, []byte(tt.body))
+			assert.Equal(t, tt.want, got, "got %s", got)
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+type autoDecompressResponseOption[PluginConfig any] struct{}
+
+func (o *autoDecompressResponseOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.autoDecompressResponse = true
+}
+
+// WithAutoDecompressResponse enables HttpContext.EnableAutoDecompressResponse for every request
+func WithAutoDecompressResponse[PluginConfig any]() CtxOption[PluginConfig] {
+	return &autoDecompressResponseOption[PluginConfig]{}
+}
+
+// DefaultMaxDecompressedSize is the size of the largest response body decompressed by
+// EnableAutoDecompressResponse without WithMaxDecompressedSize
+const DefaultMaxDecompressedSize = 32 << 20
+
+var errDecompressedBodyTooLarge = fmt.Errorf("%w: decompressed body too large", ErrLimitExceeded)
+
+type maxDecompressedSizeOption[PluginConfig any] struct {
+	size int
+}
+
+func (o *maxDecompressedSizeOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.maxDecompressedSize = o.size
+}
+
+// WithMaxDecompressedSize sets the size in bytes of the largest response body decompressed by
+// EnableAutoDecompressResponse, DefaultMaxDecompressedSize by default. A body that decompresses to
+// more is passed to the client as it is.
+func WithMaxDecompressedSize[PluginConfig any](size int) CtxOption[PluginConfig] {
+	return &maxDecompressedSizeOption[PluginConfig]{size: size}
+}
+
+// EnableAutoDecompressResponse makes ProcessResponseBody receive the decompressed body of responses
+// encoded with gzip or deflate. The response headers are held until the body is decompressed, then
+// their content-encoding and content-length are removed, so the body is sent to the client
+// uncompressed, whether the plugin replaces it or not. A body that cannot be decompressed, or that
+// decompresses to more than the size set with WithMaxDecompressedSize, is sent as it is without
+// calling ProcessResponseBody.
+// Brotli is not supported, it is removed from the accept-encoding header of the request when this is
+// called in the request headers phase. It has no effect on streamed response bodies.
+func (ctx *CommonHttpCtx[PluginConfig]) EnableAutoDecompressResponse() {
+	ctx.autoDecompressResponse = true
+	if ctx.executionPhase == iface.DecodeHeader {
+		restrictAcceptEncoding()
+	}
+}
+
+// decodableContentEncodings are the content encodings EnableAutoDecompressResponse decompresses
+var decodableContentEncodings = map[string]bool{"gzip": true, "x-gzip": true, "deflate": true, "identity": true}
+
+// restrictAcceptEncoding removes the encodings that cannot be decompressed from the accept-encoding header
+func restrictAcceptEncoding() {
+	accept, err := proxywasm.GetHttpRequestHeader("accept-encoding")
+	if err != nil || accept == "" {
+		return
+	}
+	var kept []string
+	for _, part := range strings.Split(accept, ",") {
+		coding, _, _ := strings.Cut(part, ";")
+		if decodableContentEncodings[strings.ToLower(strings.TrimSpace(coding))] {
+			kept = append(kept, strings.TrimSpace(part))
+		}
+	}
+	if len(kept) == 0 {
+		_ = proxywasm.RemoveHttpRequestHeader("accept-encoding")
+		return
+	}
+	_ = proxywasm.ReplaceHttpRequestHeader("accept-encoding", strings.Join(kept, ", "))
+}
+
+// responseDecoding returns the encoding to decompress the response body from, empty if it is not
+// decompressed: the body is not encoded, or not buffered for ProcessResponseBody
+func (ctx *CommonHttpCtx[PluginConfig]) responseDecoding() string {
+	vm := ctx.plugin.vm
+	if !ctx.autoDecompressResponse || vm.onHttpResponseBody == nil || (vm.onHttpStreamingResponseBody != nil && ctx.streamingResponseBody) {
+		return ""
+	}
+	encoding := strings.ToLower(strings.TrimSpace(ctx.responseContentEncoding))
+	if encoding == "identity" || !decodableContentEncodings[encoding] {
+		return ""
+	}
+	return encoding
+}
+
+// prepareResponseDecompression tells at the end of the response headers phase whether the body is
+// decompressed, the headers are then held until it is
+func (ctx *CommonHttpCtx[PluginConfig]) prepareResponseDecompression() bool {
+	if !ctx.needResponseBody {
+		return false
+	}
+	ctx.decompressResponse = ctx.responseDecoding()
+	return ctx.decompressResponse != ""
+}
+
+// decompressResponseBody decompresses the buffered response body and replaces it with the result, the
+// headers of the encoded body are removed once it is decompressed
+func (ctx *CommonHttpCtx[PluginConfig]) decompressResponseBody(body []byte) ([]byte, error) {
+	limit := ctx.plugin.vm.maxDecompressedSize
+	if limit <= 0 {
+		limit = DefaultMaxDecompressedSize
+	}
+	decoded, err := decodeContentEncoding(ctx.decompressResponse, body, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err = proxywasm.ReplaceHttpResponseBody(decoded); err != nil {
+		return nil, fmt.Errorf("failed to replace response body: %v", err)
+	}
+	_ = proxywasm.RemoveHttpResponseHeader("content-encoding")
+	_ = proxywasm.RemoveHttpResponseHeader("content-length")
+	return decoded, nil
+}
+
+// decodeContentEncoding decompresses a gzip or deflate body of at most limit bytes, deflate bodies are
+// accepted with or without the zlib wrapper since both are found in the wild
+func decodeContentEncoding(encoding string, body []byte, limit int) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		if reader, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	decoded, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", errDecompressedBodyTooLarge, limit)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestDecodeContentEncoding(t *testing.T) {
+	var zlibBody, rawBody bytes.Buffer
+	zw := zlib.NewWriter(&zlibBody)
+	zw.Write([]byte("zlib"))
+	zw.Close()
+	fw, _ := flate.NewWriter(&rawBody, flate.DefaultCompression)
+	fw.Write([]byte("raw"))
+	fw.Close()
+	gzipBody, err := gzipBytes([]byte("gzip"))
+	require.NoError(t, err)
+
+	for encoding, body := range map[string][]byte{"gzip": gzipBody, "x-gzip": gzipBody, "deflate": zlibBody.Bytes()} {
+		decoded, err := decodeContentEncoding(encoding, body, 4)
+		require.NoError(t, err, encoding)
+		assert.Contains(t, []string{"gzip", "zlib"}, string(decoded))
+	}
+	decoded, err := decodeContentEncoding("deflate", rawBody.Bytes(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(decoded))
+	_, err = decodeContentEncoding("br", []byte("x"), 4)
+	assert.Error(t, err)
+	_, err = decodeContentEncoding("gzip", gzipBody, 3)
+	assert.ErrorIs(t, err, errDecompressedBodyTooLarge)
+}
+
+func TestAutoDecompressResponse(t *testing.T) {
+	var received []string
+	vm := NewCommonVmCtx("decompress-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		WithAutoDecompressResponse[struct{}](),
+		WithMaxDecompressedSize[struct{}](8),
+		ProcessResponseBody(func(ctx HttpContext, config struct{}, body []byte) types.Action {
+			received = append(received, string(body))
+			proxywasm.ReplaceHttpResponseBody(append(body, '!'))
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	compressed, err := gzipBytes([]byte("hello"))
+	require.NoError(t, err)
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {"accept-encoding", "br, gzip;q=0.9, zstd"}}, true)
+	assert.Equal(t, "gzip;q=0.9", headerValue(host.GetCurrentRequestHeaders(id), "accept-encoding"))
+	action := host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-encoding", "gzip"}, {"content-length", "25"}}, false)
+	assert.Equal(t, types.HeaderStopIteration, action, "the headers are held until the body is decompressed")
+	assert.Equal(t, "gzip", headerValue(host.GetCurrentResponseHeaders(id), "content-encoding"))
+	host.CallOnResponseBody(id, compressed, true)
+	assert.Equal(t, "hello!", string(host.GetCurrentResponseBody(id)))
+	headers := host.GetCurrentResponseHeaders(id)
+	assert.Empty(t, headerValue(headers, "content-encoding"))
+	assert.Empty(t, headerValue(headers, "content-length"))
+	host.CompleteHttpContext(id)
+
+	// Bodies that cannot be decompressed within the limit are sent as they are
+	large, err := gzipBytes([]byte("hello world"))
+	require.NoError(t, err)
+	for _, body := range [][]byte{large, []byte("not gzip")} {
+		id = host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+		host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-encoding", "gzip"}, {"content-length", "25"}}, false)
+		host.CallOnResponseBody(id, body, true)
+		assert.Equal(t, body, host.GetCurrentResponseBody(id))
+		headers = host.GetCurrentResponseHeaders(id)
+		assert.Equal(t, "gzip", headerValue(headers, "content-encoding"))
+		assert.Equal(t, "25", headerValue(headers, "content-length"))
+		host.CompleteHttpContext(id)
+	}
+
+	// Encodings that cannot be decompressed are passed through as binary bodies
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-encoding", "br"}}, false)
+	assert.Equal(t, "br", headerValue(host.GetCurrentResponseHeaders(id), "content-encoding"))
+	host.CallOnResponseBody(id, []byte("brotli"), true)
+	assert.Equal(t, "brotli", string(host.GetCurrentResponseBody(id)))
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, []string{"hello"}, received)
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/binary"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+type (
+	DownstreamTLS   = iface.DownstreamTLS
+	PeerCertificate = iface.PeerCertificate
+)
+
+// maxCachedConnections bounds the TLS details cached per connection, the host does not tell the plugin when a
+// connection is closed so the oldest connections are dropped first
+const maxCachedConnections = 1024
+
+// connectionTLSCache holds the TLS details of the recent downstream connections of the VM by connection id
+type connectionTLSCache struct {
+	entries map[uint64]*DownstreamTLS
+	order   []uint64
+}
+
+var downstreamTLSCache = &connectionTLSCache{entries: make(map[uint64]*DownstreamTLS)}
+
+func (c *connectionTLSCache) get(id uint64) (*DownstreamTLS, bool) {
+	tls, ok := c.entries[id]
+	return tls, ok
+}
+
+func (c *connectionTLSCache) put(id uint64, tls *DownstreamTLS) {
+	if len(c.order) >= maxCachedConnections {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.entries[id] = tls
+	c.order = append(c.order, id)
+}
+
+func connectionProperty(name string) string {
+	value, _ := proxywasm.GetProperty([]string{"connection", name})
+	return string(value)
+}
+
+// readDownstreamTLS reads the TLS details of the downstream connection from the connection attributes of the host
+func readDownstreamTLS() *DownstreamTLS {
+	version := connectionProperty("tls_version")
+	if version == "" {
+		return nil
+	}
+	tls := &DownstreamTLS{
+		ServerName:  connectionProperty("requested_server_name"),
+		Version:     version,
+		CipherSuite: connectionProperty("tls_cipher_suite"),
+	}
+	if digest := connectionProperty("sha256_peer_certificate_digest"); digest != "" {
+		mtls, _ := proxywasm.GetProperty([]string{"connection", "mtls"})
+		tls.PeerCertificate = &PeerCertificate{
+			Subject:      connectionProperty("subject_peer_certificate"),
+			DNSSAN:       connectionProperty("dns_san_peer_certificate"),
+			URISAN:       connectionProperty("uri_san_peer_certificate"),
+			SHA256Digest: digest,
+			Presented:    len(mtls) > 0 && mtls[0] != 0,
+		}
+	}
+	return tls
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) DownstreamTLS() *DownstreamTLS {
+	if ctx.downstreamTLSLoaded {
+		return ctx.downstreamTLS
+	}
+	ctx.downstreamTLSLoaded = true
+	id, err := proxywasm.GetProperty([]string{"connection", "id"})
+	if err != nil || len(id) != 8 {
+		ctx.downstreamTLS = readDownstreamTLS()
+		return ctx.downstreamTLS
+	}
+	connectionID := binary.LittleEndian.Uint64(id)
+	if tls, ok := downstreamTLSCache.get(connectionID); ok {
+		ctx.downstreamTLS = tls
+		return tls
+	}
+	ctx.downstreamTLS = readDownstreamTLS()
+	downstreamTLSCache.put(connectionID, ctx.downstreamTLS)
+	return ctx.downstreamTLS
+}
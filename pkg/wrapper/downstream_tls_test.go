@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownstreamTLS(t *testing.T) {
+	downstreamTLSCache = &connectionTLSCache{entries: make(map[uint64]*DownstreamTLS)}
+	var tls *DownstreamTLS
+	// request sends a request on the connection with the connection attributes
+	request := func(connectionID uint64, properties map[string]string) *DownstreamTLS {
+		vm := NewCommonVmCtx[struct{}]("tls-test",
+			ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+				tls = ctx.DownstreamTLS()
+				return types.ActionContinue
+			}),
+		)
+		id := make([]byte, 8)
+		binary.LittleEndian.PutUint64(id, connectionID)
+		option := proxytest.NewEmulatorOption().WithVMContext(vm).WithProperty([]string{"connection", "id"}, id)
+		for name, value := range properties {
+			option = option.WithProperty([]string{"connection", name}, []byte(value))
+		}
+		host, reset := proxytest.NewHostEmulator(option)
+		defer reset()
+		host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		tls = nil
+		contextID := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(contextID, [][2]string{{":authority", "api.example.com"}, {":path", "/"}}, true)
+		host.CompleteHttpContext(contextID)
+		return tls
+	}
+
+	properties := map[string]string{
+		"tls_version":                    "TLSv1.3",
+		"requested_server_name":          "api.example.com",
+		"tls_cipher_suite":               "TLS_AES_128_GCM_SHA256",
+		"mtls":                           "\x01",
+		"sha256_peer_certificate_digest": "9f86d081884c7d659a2feaa0c55ad015",
+		"subject_peer_certificate":       "CN=client-a,O=Acme",
+		"uri_san_peer_certificate":       "spiffe://acme/client-a",
+	}
+	assert.Equal(t, &DownstreamTLS{
+		ServerName:  "api.example.com",
+		Version:     "TLSv1.3",
+		CipherSuite: "TLS_AES_128_GCM_SHA256",
+		PeerCertificate: &PeerCertificate{
+			Subject:      "CN=client-a,O=Acme",
+			URISAN:       "spiffe://acme/client-a",
+			SHA256Digest: "9f86d081884c7d659a2feaa0c55ad015",
+			Presented:    true,
+		},
+	}, request(1, properties))
+	assert.True(t, tls.PeerCertificate.MatchesFingerprint("00", "9F:86:D0:81:88:4C:7D:65:9A:2F:EA:A0:C5:5A:D0:15"))
+	assert.False(t, tls.PeerCertificate.MatchesFingerprint("9f86d081"))
+
+	// The details are read once per connection
+	first := tls
+	properties["requested_server_name"] = "other.example.com"
+	assert.Same(t, first, request(1, properties))
+
+	assert.Equal(t, &DownstreamTLS{ServerName: "www.example.com", Version: "TLSv1.2"},
+		request(2, map[string]string{"tls_version": "TLSv1.2", "requested_server_name": "www.example.com"}))
+	assert.False(t, tls.PeerCertificate.MatchesFingerprint("9f86d081884c7d659a2feaa0c55ad015"))
+
+	assert.Nil(t, request(3, nil), "plaintext connection")
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+)
+
+// IsInformationalStatus reports whether the status code is a 1xx interim response that is
+// followed by the final response headers. 101 Switching Protocols is excluded since it is final.
+func IsInformationalStatus(statusCode int) bool {
+	return statusCode >= 100 && statusCode < 200 && statusCode != 101
+}
+
+// EarlyHint is a resource advertised to the client through a Link header (RFC 8288), so that it can
+// be fetched while the response body is still being received. The hints are only added to the final
+// response: plugins cannot send a 103 Early Hints response.
+type EarlyHint struct {
+	URL         string `json:"url"`
+	Rel         string `json:"rel"`
+	As          string `json:"as"`
+	Type        string `json:"type"`
+	CrossOrigin string `json:"crossorigin"`
+}
+
+// LinkValue returns the Link header value of the hint, e.g. `</app.css>; rel=preload; as=style`.
+func (h EarlyHint) LinkValue() string {
+	rel := h.Rel
+	if rel == "" {
+		rel = "preload"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%s>; rel=%s", h.URL, rel)
+	if h.As != "" {
+		fmt.Fprintf(&b, "; as=%s", h.As)
+	}
+	if h.Type != "" {
+		fmt.Fprintf(&b, "; type=%q", h.Type)
+	}
+	if h.CrossOrigin != "" {
+		if h.CrossOrigin == "anonymous" {
+			b.WriteString("; crossorigin")
+		} else {
+			fmt.Fprintf(&b, "; crossorigin=%s", h.CrossOrigin)
+		}
+	}
+	return b.String()
+}
+
+// ParseEarlyHints parses a list of hints such as [{"url": "/app.css", "as": "style"}].
+// A plain string item is taken as the URL of a preload hint.
+func ParseEarlyHints(json gjson.Result) ([]EarlyHint, error) {
+	if !json.Exists() {
+		return nil, nil
+	}
+	if !json.IsArray() {
+		return nil, fmt.Errorf("early hints must be an array")
+	}
+	var hints []EarlyHint
+	for i, item := range json.Array() {
+		var hint EarlyHint
+		if item.Type == gjson.String {
+			hint.URL = item.String()
+		} else {
+			hint = EarlyHint{
+				URL:         item.Get("url").String(),
+				Rel:         item.Get("rel").String(),
+				As:          item.Get("as").String(),
+				Type:        item.Get("type").String(),
+				CrossOrigin: item.Get("crossorigin").String(),
+			}
+		}
+		if hint.URL == "" {
+			return nil, fmt.Errorf("early hint %d has no url", i)
+		}
+		if strings.ContainsAny(hint.URL, "<>\r\n") {
+			return nil, fmt.Errorf("early hint %d has invalid url: %s", i, hint.URL)
+		}
+		hints = append(hints, hint)
+	}
+	return hints, nil
+}
+
+// AddEarlyHints adds the hints as Link headers to the final response, it should be called in the response
+// header phase. No 103 Early Hints response is sent, the proxy-wasm ABI has no way to send an interim
+// response, so the client only learns about the hints with the final response headers. A downstream
+// CDN that caches Link headers may turn them into a 103 response on later requests, the plugin cannot.
+func AddEarlyHints(hints []EarlyHint) error {
+	for _, hint := range hints {
+		if err := proxywasm.AddHttpResponseHeader("link", hint.LinkValue()); err != nil {
+			return fmt.Errorf("failed to add early hint header: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestIsInformationalStatus(t *testing.T) {
+	assert.True(t, IsInformationalStatus(100))
+	assert.True(t, IsInformationalStatus(103))
+	assert.False(t, IsInformationalStatus(101))
+	assert.False(t, IsInformationalStatus(200))
+	assert.False(t, IsInformationalStatus(99))
+}
+
+func TestParseEarlyHints(t *testing.T) {
+	hints, err := ParseEarlyHints(gjson.Parse(`[
+		"/app.js",
+		{"url": "/app.css", "as": "style"},
+		{"url": "https://fonts.example.com/a.woff2", "as": "font", "type": "font/woff2", "crossorigin": "anonymous"},
+		{"url": "https://cdn.example.com", "rel": "preconnect"}
+	]`))
+	assert.NoError(t, err)
+	var values []string
+	for _, hint := range hints {
+		values = append(values, hint.LinkValue())
+	}
+	assert.Equal(t, []string{
+		"</app.js>; rel=preload",
+		"</app.css>; rel=preload; as=style",
+		`<https://fonts.example.com/a.woff2>; rel=preload; as=font; type="font/woff2"; crossorigin`,
+		"<https://cdn.example.com>; rel=preconnect",
+	}, values)
+
+	hints, err = ParseEarlyHints(gjson.Result{})
+	assert.NoError(t, err)
+	assert.Empty(t, hints)
+
+	_, err = ParseEarlyHints(gjson.Parse(`{"url": "/app.css"}`))
+	assert.Error(t, err)
+	_, err = ParseEarlyHints(gjson.Parse(`[{"as": "style"}]`))
+	assert.Error(t, err)
+	_, err = ParseEarlyHints(gjson.Parse(`["/a>b"]`))
+	assert.Error(t, err)
+}
+
+func TestInformationalResponseHeaders(t *testing.T) {
+	var informational []int
+	var final int
+	vm := NewCommonVmCtx[struct{}]("informational-test",
+		ProcessResponseHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			final++
+			hints, _ := ParseEarlyHints(gjson.Parse(`[{"url": "/app.css", "as": "style"}]`))
+			assert.NoError(t, AddEarlyHints(hints))
+			return types.ActionContinue
+		}),
+		ProcessInformationalResponseHeaders(func(ctx HttpContext, config struct{}, statusCode int) {
+			informational = append(informational, statusCode)
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {":method", "GET"}}, true)
+	action := host.CallOnResponseHeaders(id, [][2]string{{":status", "100"}}, false)
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Equal(t, []int{100}, informational)
+	assert.Equal(t, 0, final, "informational headers must not be treated as the final response")
+
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-type", "text/html"}}, false)
+	assert.Equal(t, 1, final)
+	assert.Equal(t, []int{100}, informational)
+	assert.Contains(t, host.GetCurrentResponseHeaders(id), [2]string{"link", "</app.css>; rel=preload; as=style"})
+}
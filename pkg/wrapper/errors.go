@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+// The common failures of the wrapper. The errors returned by the wrapper, and by the mcp and redis
+// helpers built on it, wrap one of them, so plugins and tests assert on the class of a failure with
+// errors.Is instead of matching its message, e.g.
+//
+//	if errors.Is(err, wrapper.ErrLimitExceeded) {
+//		...
+//	}
+var (
+	// ErrConfigInvalid is matched by the configuration errors of package configerr
+	ErrConfigInvalid = configerr.ErrInvalid
+	// ErrCalloutFailed is returned when an HTTP, gRPC or Redis callout cannot be dispatched
+	ErrCalloutFailed = errors.New("callout failed")
+	// ErrPauseNotAllowed is returned when an operation needs to pause a request that can no longer be
+	// paused, e.g. a route call once the response is being processed
+	ErrPauseNotAllowed = errors.New("pause not allowed")
+	// ErrLimitExceeded is returned when a limit of the request or of the VM is reached, e.g. by
+	// ErrCalloutLimitExceeded and ErrCalloutQueueFull
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// Public codes of the common failures, stable to be used in logs, metrics and response details
+const (
+	ErrorCodeConfigInvalid   = "config_invalid"
+	ErrorCodeCalloutFailed   = "callout_failed"
+	ErrorCodePauseNotAllowed = "pause_not_allowed"
+	ErrorCodeLimitExceeded   = "limit_exceeded"
+	ErrorCodeInternal        = "internal"
+)
+
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrConfigInvalid, ErrorCodeConfigInvalid},
+	{ErrCalloutFailed, ErrorCodeCalloutFailed},
+	{ErrPauseNotAllowed, ErrorCodePauseNotAllowed},
+	{ErrLimitExceeded, ErrorCodeLimitExceeded},
+}
+
+// ErrorCode returns the public code of the common failure err wraps, ErrorCodeInternal for any other
+// error and an empty code for a nil error
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ErrorCodeInternal
+}
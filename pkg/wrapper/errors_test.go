@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+func TestErrorCode(t *testing.T) {
+	cfgErr := configerr.Prefix("/rules/0", configerr.Errorf("/path", "string", "got 1"))
+	assert.ErrorIs(t, cfgErr, ErrConfigInvalid)
+	assert.Equal(t, ErrorCodeConfigInvalid, ErrorCode(fmt.Errorf("failed to parse config: %w", cfgErr)))
+
+	assert.ErrorIs(t, ErrCalloutLimitExceeded, ErrLimitExceeded)
+	assert.Equal(t, "callout limit exceeded", ErrCalloutLimitExceeded.Error())
+	assert.Equal(t, ErrorCodeLimitExceeded, ErrorCode(ErrCalloutQueueFull))
+	assert.Equal(t, ErrorCodeLimitExceeded, ErrorCode(errWebSocketFrameTooLarge))
+
+	err := NewRedisClusterClient(FQDNCluster{FQDN: "redis.dns", Port: 6379}).Get("key", nil)
+	assert.ErrorIs(t, err, ErrCalloutFailed)
+	assert.Equal(t, ErrorCodeCalloutFailed, ErrorCode(err))
+
+	assert.Equal(t, ErrorCodePauseNotAllowed, ErrorCode(fmt.Errorf("%w: route call after the request phases", ErrPauseNotAllowed)))
+
+	assert.Equal(t, ErrorCodeInternal, ErrorCode(errors.New("boom")))
+	assert.Empty(t, ErrorCode(nil))
+}
+
+// TestRouteCallAfterRequestPhases tests that a route call is refused once the request was forwarded, when the
+// request can no longer be paused to be replaced
+func TestRouteCallAfterRequestPhases(t *testing.T) {
+	var requestErr, responseErr error
+	vm := NewCommonVmCtx[struct{}]("route-call-test",
+		ProcessRequestBody(func(ctx HttpContext, config struct{}, body []byte) types.Action {
+			requestErr = ctx.RouteCall("POST", "/check", nil, body, func(int, [][2]string, []byte) {})
+			return types.ActionPause
+		}),
+		ProcessResponseHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			responseErr = ctx.RouteCall("GET", "/check", nil, nil, func(int, [][2]string, []byte) {})
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}, {":method", "POST"}}, false)
+	host.CallOnRequestBody(id, []byte("{}"), true)
+	assert.NoError(t, requestErr)
+
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	action := host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, false)
+	assert.Equal(t, types.ActionContinue, action)
+	assert.ErrorIs(t, responseErr, ErrPauseNotAllowed)
+	assert.Equal(t, ErrorCodePauseNotAllowed, ErrorCode(responseErr))
+}
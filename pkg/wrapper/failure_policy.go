@@ -0,0 +1,163 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+// FailureMode is how a request proceeds when a dependency of the plugin fails
+type FailureMode = iface.FailureMode
+
+const (
+	// FailOpen continues the request as if the dependency had let it through
+	FailOpen = iface.FailOpen
+	// FailClosed rejects the request with the status of the policy
+	FailClosed = iface.FailClosed
+	// FailDegrade continues the request, the plugin serves it without the dependency, e.g. from a stale cache
+	FailDegrade = iface.FailDegrade
+)
+
+// Dependencies whose failures are handled by the wrapper itself, plugins use their own names for others, e.g. "auth"
+const (
+	// FailureConfig is the failure to find the config matching a request, handled before the request header handler
+	FailureConfig = "config"
+	// FailureWarmup is a request arriving before the warm-up of OnPluginWarmup is done, handled before the request header handler
+	FailureWarmup = "warmup"
+	// FailureRedis and FailureCallout are the usual names of failed Redis commands and timed out callouts
+	FailureRedis   = "redis"
+	FailureCallout = "callout"
+)
+
+const defaultFailureStatus = 503
+
+var errNotWarmedUp = errors.New("the plugin warm-up is not done")
+
+// failingRequests are the requests of the plugins with a failure policy by context id, the wrapper applies
+// the policy of FailureRedis and FailureCallout to the callouts they send
+var failingRequests = map[uint32]interface {
+	rejectFailedCallout(dependency string, err error) bool
+}{}
+
+// FailurePolicy is the behavior of a plugin when a dependency fails
+type FailurePolicy struct {
+	Mode FailureMode `json:"mode"`
+	// Status is the status of requests rejected by FailClosed, defaults to 503
+	Status uint32 `json:"status"`
+	// Body is the body of requests rejected by FailClosed
+	Body string `json:"body"`
+}
+
+type failurePolicyOption[PluginConfig any] struct {
+	policy   FailurePolicy
+	features map[string]FailurePolicy
+}
+
+func (o *failurePolicyOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.failurePolicy = &o.policy
+	ctx.featureFailurePolicies = o.features
+}
+
+// WithFailurePolicy sets the behavior of the plugin when its dependencies fail, the policy applies to all
+// dependencies without a policy in features. The mode of a dependency is overridden on a route by the
+// feature flag <plugin name>.failure_mode.<dependency>, e.g. ai-cache.failure_mode.redis: "closed".
+// Plugins apply it with HttpContext.HandleFailure, the wrapper applies it to FailureConfig and
+// FailureWarmup, and with FailureRedis and FailureCallout to the Redis commands that cannot reach Redis
+// and the HTTP callouts that time out: when they fail closed the request is rejected and the callback of
+// the callout is not called, the callback handles the other modes. Without this option all dependencies
+// fail open, except the security dependencies handled with HttpContext.HandleSecurityFailure, which fail
+// closed unless their own policy in features or the feature flag sets FailOpen.
+func WithFailurePolicy[PluginConfig any](policy FailurePolicy, features map[string]FailurePolicy) CtxOption[PluginConfig] {
+	return &failurePolicyOption[PluginConfig]{policy: policy, features: features}
+}
+
+// failurePolicy returns the policy of the dependency for the request. The mode of the plugin-wide policy
+// does not apply to security dependencies, which fail closed unless their own policy or the feature flag
+// sets FailOpen: they have no degraded mode.
+func (ctx *CommonHttpCtx[PluginConfig]) failurePolicy(dependency string, security bool) FailurePolicy {
+	vm := ctx.plugin.vm
+	var policy FailurePolicy
+	if p, ok := vm.featureFailurePolicies[dependency]; ok {
+		policy = p
+	} else if vm.failurePolicy != nil {
+		policy = *vm.failurePolicy
+		if security {
+			policy.Mode = ""
+		}
+	}
+	switch mode := FailureMode(ctx.FeatureFlags().String(vm.pluginName+".failure_mode."+dependency, "")); mode {
+	case FailOpen, FailClosed, FailDegrade:
+		policy.Mode = mode
+	}
+	if policy.Mode == "" {
+		policy.Mode = FailOpen
+		if security {
+			policy.Mode = FailClosed
+		}
+	}
+	if security && policy.Mode == FailDegrade {
+		policy.Mode = FailClosed
+	}
+	if policy.Status == 0 {
+		policy.Status = defaultFailureStatus
+	}
+	return policy
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) HandleFailure(dependency string, err error) FailureMode {
+	return ctx.handleFailure(dependency, err, false)
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) HandleSecurityFailure(dependency string, err error) FailureMode {
+	return ctx.handleFailure(dependency, err, true)
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) handleFailure(dependency string, err error, security bool) FailureMode {
+	policy := ctx.failurePolicy(dependency, security)
+	ctx.plugin.vm.log.Warnf("dependency %s failed, failing %s: %v", dependency, policy.Mode, err)
+	ctx.applyFailurePolicy(dependency, policy)
+	return policy.Mode
+}
+
+// applyFailurePolicy rejects the request when the policy fails closed, and tells whether it did
+func (ctx *CommonHttpCtx[PluginConfig]) applyFailurePolicy(dependency string, policy FailurePolicy) bool {
+	if policy.Mode != FailClosed {
+		return false
+	}
+	_ = proxywasm.SendHttpResponseWithDetail(policy.Status, "dependency_failure."+dependency, nil, []byte(policy.Body), -1)
+	return true
+}
+
+// rejectFailedCallout rejects the request when the policy of the dependency of its failed callout fails
+// closed, and tells whether it did
+func (ctx *CommonHttpCtx[PluginConfig]) rejectFailedCallout(dependency string, err error) bool {
+	policy := ctx.failurePolicy(dependency, false)
+	if policy.Mode != FailClosed {
+		return false
+	}
+	ctx.plugin.vm.log.Warnf("dependency %s failed, failing %s: %v", dependency, policy.Mode, err)
+	return ctx.applyFailurePolicy(dependency, policy)
+}
+
+// rejectFailedCallout applies the failure policy to the failed callout of the active request, the
+// callback of the callout is not called when the request is rejected
+func rejectFailedCallout(dependency string, err error) bool {
+	request, ok := failingRequests[activeHttpContextID]
+	return ok && request.rejectFailedCallout(dependency, err)
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+)
+
+func TestHandleFailure(t *testing.T) {
+	var dependency string
+	var security bool
+	var modes []FailureMode
+	newVM := func(options ...CtxOption[struct{}]) *CommonVmCtx[struct{}] {
+		options = append(options, ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			handle := ctx.HandleFailure
+			if security {
+				handle = ctx.HandleSecurityFailure
+			}
+			mode := handle(dependency, errors.New("connection refused"))
+			modes = append(modes, mode)
+			if mode == FailClosed {
+				return types.ActionPause
+			}
+			return types.ActionContinue
+		}))
+		return NewCommonVmCtx[struct{}]("failure-test", options...)
+	}
+	run := func(vm *CommonVmCtx[struct{}], dep string, flag string) (types.Action, *proxytest.LocalHttpResponse) {
+		dependency = dep
+		host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+		defer reset()
+		host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+		require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+		if flag != "" {
+			require.NoError(t, host.SetProperty([]string{"xds", "route_metadata", "filter_metadata", DefaultFeatureFlagNamespace, "failure-test.failure_mode." + dep}, []byte(flag)))
+		}
+		id := host.InitializeHttpContext()
+		action := host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+		return action, host.GetSentLocalResponse(id)
+	}
+
+	// Without policy dependencies fail open
+	action, response := run(newVM(), FailureRedis, "")
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Nil(t, response)
+
+	vm := newVM(WithFailurePolicy[struct{}](FailurePolicy{Mode: FailClosed, Status: 502, Body: "auth unavailable"},
+		map[string]FailurePolicy{FailureRedis: {Mode: FailDegrade}}))
+	action, response = run(vm, "auth", "")
+	assert.Equal(t, types.ActionPause, action)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(502), response.StatusCode)
+	assert.Equal(t, "auth unavailable", string(response.Data))
+	assert.Equal(t, "dependency_failure.auth", response.StatusCodeDetail)
+
+	action, response = run(vm, FailureRedis, "")
+	assert.Equal(t, types.ActionContinue, action)
+	assert.Nil(t, response)
+
+	// Route flags override the mode
+	action, response = run(vm, FailureRedis, "closed")
+	assert.Equal(t, types.ActionPause, action)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(503), response.StatusCode)
+	action, _ = run(vm, "auth", "open")
+	assert.Equal(t, types.ActionContinue, action)
+
+	assert.Equal(t, []FailureMode{FailOpen, FailClosed, FailDegrade, FailClosed, FailOpen}, modes)
+
+	// Security dependencies fail closed unless their own policy or the route sets another mode
+	security = true
+	modes = nil
+	action, response = run(newVM(), "jwks", "")
+	assert.Equal(t, types.ActionPause, action)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(503), response.StatusCode)
+	assert.Equal(t, "dependency_failure.jwks", response.StatusCodeDetail)
+	vm = newVM(WithFailurePolicy[struct{}](FailurePolicy{Mode: FailOpen, Status: 502},
+		map[string]FailurePolicy{"oidc": {Mode: FailOpen}}))
+	action, response = run(vm, "jwks", "")
+	assert.Equal(t, types.ActionPause, action, "the plugin-wide mode does not open security dependencies")
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(502), response.StatusCode)
+	action, _ = run(vm, "oidc", "")
+	assert.Equal(t, types.ActionContinue, action)
+	action, _ = run(vm, "jwks", "open")
+	assert.Equal(t, types.ActionContinue, action)
+	// Security dependencies have no degraded mode
+	action, response = run(vm, "jwks", "degrade")
+	assert.Equal(t, types.ActionPause, action)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(502), response.StatusCode)
+	assert.Equal(t, []FailureMode{FailClosed, FailClosed, FailOpen, FailOpen, FailClosed}, modes)
+}
+
+func TestWarmupFailurePolicy(t *testing.T) {
+	var handled bool
+	vm := NewCommonVmCtx[struct{}]("failure-test",
+		OnPluginWarmup(func(ctx PluginContext, config struct{}, done func(error)) {}),
+		WithFailurePolicy[struct{}](FailurePolicy{Mode: FailOpen}, map[string]FailurePolicy{FailureWarmup: {Mode: FailClosed}}),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			handled = true
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	action := host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	assert.Equal(t, types.ActionPause, action)
+	assert.False(t, handled)
+	response := host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(503), response.StatusCode)
+	assert.Equal(t, "dependency_failure.warmup", response.StatusCodeDetail)
+}
+
+func TestCalloutFailurePolicy(t *testing.T) {
+	var redisReplies []resp.Value
+	var httpStatuses []int
+	redis := NewRedisClusterClient(FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	client := NewClusterClient(FQDNCluster{FQDN: "backend.example.com", Port: 80})
+	vm := NewCommonVmCtx("failure-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error {
+			return redis.Init("", "", 1000)
+		}),
+		WithFailurePolicy[struct{}](FailurePolicy{Mode: FailOpen}, map[string]FailurePolicy{FailureRedis: {Mode: FailClosed, Status: 502}}),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			_ = redis.Get("key", func(reply resp.Value) { redisReplies = append(redisReplies, reply) })
+			_ = client.Get("/", nil, func(statusCode int, _ http.Header, _ []byte) { httpStatuses = append(httpStatuses, statusCode) })
+			return types.ActionPause
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	redisCallouts := host.GetRedisCalloutAttributesFromContext(id)
+	require.Len(t, redisCallouts, 1)
+	callouts := host.GetCalloutAttributesFromContext(id)
+	require.Len(t, callouts, 1)
+	redisCallout, httpCallout := redisCallouts[0].CalloutID, callouts[0].CalloutID
+
+	// The callout fails open, its callback handles the failure
+	host.CallOnHttpCallResponse(httpCallout, nil, nil, nil)
+	assert.Equal(t, []int{http.StatusBadGateway}, httpStatuses)
+	assert.Nil(t, host.GetSentLocalResponse(id))
+
+	// Redis fails closed, the request is rejected without calling the callback
+	host.CallOnRedisCallResponse(redisCallout, 1, nil)
+	assert.Empty(t, redisReplies)
+	response := host.GetSentLocalResponse(id)
+	require.NotNil(t, response)
+	assert.Equal(t, uint32(502), response.StatusCode)
+	assert.Equal(t, "dependency_failure.redis", response.StatusCodeDetail)
+	host.CompleteHttpContext(id)
+	assert.NotContains(t, failingRequests, id)
+
+	// Replies of a reachable Redis are passed to the callback, errors included
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	redisCallouts = host.GetRedisCalloutAttributesFromContext(id)
+	require.Len(t, redisCallouts, 1)
+	host.CallOnRedisCallResponse(redisCallouts[0].CalloutID, 0, []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"))
+	require.Len(t, redisReplies, 1)
+	assert.Error(t, redisReplies[0].Error())
+	assert.Nil(t, host.GetSentLocalResponse(id))
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// DefaultFeatureFlagNamespace is the route metadata filter namespace holding feature flags, e.g.
+//
+//	metadata:
+//	  filter_metadata:
+//	    higress.feature_flags:
+//	      ai-proxy.streaming: "off"
+//
+// Flag names are shared by all plugins on the route, so they are usually prefixed with the plugin name.
+const DefaultFeatureFlagNamespace = "higress.feature_flags"
+
+type FlagSet iface.FlagSet
+
+type featureFlagNamespaceOption[PluginConfig any] struct {
+	namespace string
+}
+
+func (o *featureFlagNamespaceOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.featureFlagNamespace = o.namespace
+}
+
+// WithFeatureFlagNamespace sets the route metadata filter namespace that HttpContext.FeatureFlags reads.
+// DefaultFeatureFlagNamespace is used when it is not set.
+func WithFeatureFlagNamespace[PluginConfig any](namespace string) CtxOption[PluginConfig] {
+	return &featureFlagNamespaceOption[PluginConfig]{namespace: namespace}
+}
+
+type featureFlag struct {
+	value string
+	found bool
+}
+
+// routeFlagSet reads feature flags from route metadata on first access and caches them per request
+type routeFlagSet struct {
+	namespace string
+	flags     map[string]featureFlag
+}
+
+func newRouteFlagSet(namespace string) *routeFlagSet {
+	if namespace == "" {
+		namespace = DefaultFeatureFlagNamespace
+	}
+	return &routeFlagSet{
+		namespace: namespace,
+		flags:     make(map[string]featureFlag),
+	}
+}
+
+func (f *routeFlagSet) lookup(name string) (string, bool) {
+	if flag, ok := f.flags[name]; ok {
+		return flag.value, flag.found
+	}
+	var flag featureFlag
+	raw, err := proxywasm.GetProperty([]string{"xds", "route_metadata", "filter_metadata", f.namespace, name})
+	if err == nil && len(raw) > 0 {
+		flag = featureFlag{value: decodeFlagValue(raw), found: true}
+	}
+	f.flags[name] = flag
+	return flag.value, flag.found
+}
+
+// decodeFlagValue converts a metadata property value to its string form. Boolean metadata values
+// are serialized by the host as a single byte, other supported values are strings.
+func decodeFlagValue(raw []byte) string {
+	if len(raw) == 1 && raw[0] <= 1 {
+		return strconv.FormatBool(raw[0] == 1)
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// Has reports whether the flag is set in the metadata of the route
+func (f *routeFlagSet) Has(name string) bool {
+	_, found := f.lookup(name)
+	return found
+}
+
+// Enabled reports whether the flag is set to a true boolean value
+func (f *routeFlagSet) Enabled(name string) bool {
+	return f.Bool(name, false)
+}
+
+// Bool returns the flag as a boolean, or defaultValue when it is not set or not a boolean
+func (f *routeFlagSet) Bool(name string, defaultValue bool) bool {
+	value, found := f.lookup(name)
+	if !found {
+		return defaultValue
+	}
+	switch strings.ToLower(value) {
+	case "true", "on", "yes", "1", "enabled":
+		return true
+	case "false", "off", "no", "0", "disabled":
+		return false
+	}
+	log.Warnf("invalid boolean value of feature flag %s: %s", name, value)
+	return defaultValue
+}
+
+// String returns the flag, or defaultValue when it is not set
+func (f *routeFlagSet) String(name, defaultValue string) string {
+	if value, found := f.lookup(name); found {
+		return value
+	}
+	return defaultValue
+}
+
+// Int returns the flag as a decimal integer, or defaultValue when it is not set or not an integer
+func (f *routeFlagSet) Int(name string, defaultValue int64) int64 {
+	value, found := f.lookup(name)
+	if !found {
+		return defaultValue
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Warnf("invalid integer value of feature flag %s: %s", name, value)
+		return defaultValue
+	}
+	return i
+}
+
+// Float returns the flag as a number, or defaultValue when it is not set or not a number
+func (f *routeFlagSet) Float(name string, defaultValue float64) float64 {
+	value, found := f.lookup(name)
+	if !found {
+		return defaultValue
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Warnf("invalid number value of feature flag %s: %s", name, value)
+		return defaultValue
+	}
+	return v
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+func TestRouteFlagSet(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	log.SetPluginLog(&DefaultLog{pluginName: "feature-flags-test"})
+
+	setFlag := func(namespace, name string, value []byte) {
+		assert.NoError(t, host.SetProperty([]string{"xds", "route_metadata", "filter_metadata", namespace, name}, value))
+	}
+	setFlag(DefaultFeatureFlagNamespace, "streaming", []byte("off"))
+	setFlag(DefaultFeatureFlagNamespace, "cache", []byte{1})
+	setFlag(DefaultFeatureFlagNamespace, "max-tokens", []byte("2048"))
+	setFlag(DefaultFeatureFlagNamespace, "ratio", []byte("0.25"))
+	setFlag(DefaultFeatureFlagNamespace, "mode", []byte("shadow"))
+	setFlag("custom.flags", "streaming", []byte("on"))
+
+	flags := newRouteFlagSet("")
+	assert.True(t, flags.Has("streaming"))
+	assert.False(t, flags.Bool("streaming", true))
+	assert.True(t, flags.Enabled("cache"))
+	assert.Equal(t, int64(2048), flags.Int("max-tokens", 0))
+	assert.Equal(t, 0.25, flags.Float("ratio", 1))
+	assert.Equal(t, "shadow", flags.String("mode", "active"))
+
+	// Invalid or missing values fall back to the default
+	assert.Equal(t, int64(10), flags.Int("mode", 10))
+	assert.True(t, flags.Bool("mode", true))
+	assert.False(t, flags.Has("unknown"))
+	assert.Equal(t, "default", flags.String("unknown", "default"))
+
+	// Values are cached for the lifetime of the flag set
+	setFlag(DefaultFeatureFlagNamespace, "mode", []byte("active"))
+	assert.Equal(t, "shadow", flags.String("mode", ""))
+
+	assert.True(t, newRouteFlagSet("custom.flags").Enabled("streaming"))
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+)
+
+// FilterStatePrefix is prepended by Envoy to the keys of the filter state entries set by wasm
+// plugins, e.g. an entry set with the key "auth.decision" is matched by an RBAC filter as
+//
+//	filter_state:
+//	  key: wasm.auth.decision
+//	  string_match:
+//	    exact: allow
+const FilterStatePrefix = "wasm."
+
+// SetFilterState stores a raw entry in the filter state of the request, where it can be read by the
+// other filters of the chain and by plugins running later
+func SetFilterState(key string, value []byte) error {
+	if err := proxywasm.SetProperty([]string{key}, value); err != nil {
+		return fmt.Errorf("failed to set filter state %s: %v", key, err)
+	}
+	return nil
+}
+
+// GetFilterState reads a raw entry of the filter state of the request
+func GetFilterState(key string) ([]byte, error) {
+	value, err := proxywasm.GetProperty([]string{key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter state %s: %v", key, err)
+	}
+	return value, nil
+}
+
+// SetFilterStateValue stores a typed entry in the filter state. Strings, booleans and numbers are
+// stored as text so that other filters can match them, e.g. true as "true", other types as JSON.
+func SetFilterStateValue[T any](key string, value T) error {
+	raw, err := encodeFilterState(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode filter state %s: %v", key, err)
+	}
+	return SetFilterState(key, raw)
+}
+
+// GetFilterStateValue reads a typed entry of the filter state stored by SetFilterStateValue
+func GetFilterStateValue[T any](key string) (T, error) {
+	var value T
+	raw, err := GetFilterState(key)
+	if err != nil {
+		return value, err
+	}
+	if err := decodeFilterState(raw, &value); err != nil {
+		return value, fmt.Errorf("failed to decode filter state %s: %v", key, err)
+	}
+	return value, nil
+}
+
+func encodeFilterState(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case bool:
+		return []byte(strconv.FormatBool(v)), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return redisArg(v), nil
+	}
+	return json.Marshal(value)
+}
+
+func decodeFilterState(raw []byte, value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case *string:
+		*v = string(raw)
+	case *[]byte:
+		*v = raw
+	case *bool:
+		*v, err = strconv.ParseBool(string(raw))
+	case *int:
+		*v, err = strconv.Atoi(string(raw))
+	case *int64:
+		*v, err = strconv.ParseInt(string(raw), 10, 64)
+	case *uint64:
+		*v, err = strconv.ParseUint(string(raw), 10, 64)
+	case *float64:
+		*v, err = strconv.ParseFloat(string(raw), 64)
+	default:
+		err = json.Unmarshal(raw, value)
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type authDecision struct {
+	Allowed  bool     `json:"allowed"`
+	Consumer string   `json:"consumer"`
+	Scopes   []string `json:"scopes"`
+}
+
+func TestFilterState(t *testing.T) {
+	vm := NewCommonVmCtx[struct{}]("filter-state-test",
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			require.NoError(t, SetFilterStateValue("auth.allowed", true))
+			require.NoError(t, SetFilterStateValue("auth.consumer", "alice"))
+			require.NoError(t, SetFilterStateValue("auth.level", int64(3)))
+			require.NoError(t, SetFilterStateValue("auth.score", 0.75))
+			require.NoError(t, SetFilterStateValue("auth.decision", authDecision{Allowed: true, Consumer: "alice", Scopes: []string{"read"}}))
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+
+	// Values are stored as text other filters can match
+	for key, expected := range map[string]string{
+		"auth.allowed":  "true",
+		"auth.consumer": "alice",
+		"auth.level":    "3",
+		"auth.score":    "0.75",
+		"auth.decision": `{"allowed":true,"consumer":"alice","scopes":["read"]}`,
+	} {
+		raw, err := GetFilterState(key)
+		require.NoError(t, err, key)
+		assert.Equal(t, expected, string(raw), key)
+	}
+
+	allowed, err := GetFilterStateValue[bool]("auth.allowed")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	level, err := GetFilterStateValue[int64]("auth.level")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), level)
+	score, err := GetFilterStateValue[float64]("auth.score")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, score)
+	decision, err := GetFilterStateValue[authDecision]("auth.decision")
+	assert.NoError(t, err)
+	assert.Equal(t, authDecision{Allowed: true, Consumer: "alice", Scopes: []string{"read"}}, decision)
+
+	_, err = GetFilterStateValue[int]("auth.consumer")
+	assert.ErrorContains(t, err, "failed to decode filter state auth.consumer")
+	_, err = GetFilterState("auth.missing")
+	assert.ErrorContains(t, err, "failed to get filter state auth.missing")
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+// DecodeForm decodes an application/x-www-form-urlencoded body into a struct, see DecodeValues
+func DecodeForm[T any](body []byte) (T, error) {
+	var v T
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return v, configerr.New("", "a form body", err)
+	}
+	err = DecodeValues(values, &v)
+	return v, err
+}
+
+// DecodeQuery decodes the query string of a request path, e.g. HttpContext.Path(), into a struct, see DecodeValues
+func DecodeQuery[T any](path string) (T, error) {
+	var v T
+	_, query, _ := strings.Cut(path, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return v, configerr.New("", "a query string", err)
+	}
+	err = DecodeValues(values, &v)
+	return v, err
+}
+
+// DecodeValues decodes form or query values into the struct pointed to by v, field names are given
+// by form tags:
+//
+//	type TokenRequest struct {
+//		GrantType string   `form:"grant_type" required:"true"`
+//		Scopes    []string `form:"scope"`
+//		ExpiresIn int      `form:"expires_in" default:"3600"`
+//	}
+//
+// Fields without a form tag use their name and "-" skips a field. Strings, bools, numbers, time.Duration,
+// pointers to them and slices of them, filled from repeated keys, are supported, as well as embedded
+// structs. A missing field gets its default tag or fails when it is required. All failed fields are
+// returned together, each as a *configerr.Error pointing at its key, e.g. "/grant_type".
+func DecodeValues(values url.Values, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return configerr.Errorf("", "a pointer to a struct", "got %T", v)
+	}
+	var errs []error
+	decodeStruct(values, rv.Elem(), &errs)
+	return errors.Join(errs...)
+}
+
+func decodeStruct(values url.Values, v reflect.Value, errs *[]error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			decodeStruct(values, fv, errs)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		pointer := configerr.Pointer(name)
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			def, hasDefault := field.Tag.Lookup("default")
+			if !hasDefault {
+				if field.Tag.Get("required") == "true" {
+					*errs = append(*errs, configerr.Errorf(pointer, "", "required field is missing"))
+				}
+				continue
+			}
+			raw = []string{def}
+			if fv.Kind() == reflect.Slice {
+				raw = strings.Split(def, ",")
+			}
+			if err := decodeFormField(fv, raw); err != nil {
+				*errs = append(*errs, configerr.Errorf(pointer, "", "invalid default %q: %v", def, err))
+			}
+			continue
+		}
+		if err := decodeFormField(fv, raw); err != nil {
+			*errs = append(*errs, configerr.New(pointer, "", err))
+		}
+	}
+}
+
+// decodeFormField sets a field from its values, only slices take more than the first one
+func decodeFormField(v reflect.Value, raw []string) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+		for i, s := range raw {
+			if err := decodeFormField(slice.Index(i), []string{s}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := decodeFormField(elem.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	s := raw[0]
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		// A key without value, e.g. ?verbose, is true
+		if s == "" {
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
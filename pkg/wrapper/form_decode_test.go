@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+type formClient struct {
+	ClientID string `form:"client_id" required:"true"`
+}
+
+type tokenRequest struct {
+	formClient
+	GrantType string        `form:"grant_type" required:"true"`
+	Scopes    []string      `form:"scope"`
+	ExpiresIn int           `form:"expires_in" default:"3600"`
+	Timeout   time.Duration `form:"timeout" default:"5s"`
+	Ratio     *float64      `form:"ratio"`
+	Verbose   bool          `form:"verbose"`
+	Ignored   string        `form:"-"`
+	Plain     uint8
+	internal  string
+}
+
+func TestDecodeForm(t *testing.T) {
+	req, err := DecodeForm[tokenRequest]([]byte("grant_type=client_credentials&client_id=app&scope=read&scope=write&ratio=0.5&verbose&Plain=7&Ignored=x&internal=x"))
+	require.NoError(t, err)
+	ratio := 0.5
+	assert.Equal(t, tokenRequest{
+		formClient: formClient{ClientID: "app"},
+		GrantType:  "client_credentials",
+		Scopes:     []string{"read", "write"},
+		ExpiresIn:  3600,
+		Timeout:    5 * time.Second,
+		Ratio:      &ratio,
+		Verbose:    true,
+		Plain:      7,
+	}, req)
+
+	_, err = DecodeForm[tokenRequest]([]byte("expires_in=soon&Plain=300"))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, configerr.ErrInvalid)
+	assert.Contains(t, err.Error(), `invalid config at "/client_id": required field is missing`)
+	assert.Contains(t, err.Error(), `invalid config at "/grant_type": required field is missing`)
+	assert.Contains(t, err.Error(), `invalid config at "/expires_in": strconv.ParseInt: parsing "soon": invalid syntax`)
+	assert.Contains(t, err.Error(), `invalid config at "/Plain"`)
+	var cfgErr *configerr.Error
+	require.ErrorAs(t, err, &cfgErr)
+	assert.Equal(t, "/client_id", cfgErr.Pointer)
+
+	_, err = DecodeForm[tokenRequest]([]byte("a=%zz"))
+	assert.ErrorContains(t, err, `invalid config at "/", expected a form body`)
+}
+
+func TestDecodeQuery(t *testing.T) {
+	type query struct {
+		Page  int      `form:"page" default:"1"`
+		Tags  []string `form:"tag" default:"a,b"`
+		Debug bool     `form:"debug"`
+	}
+	q, err := DecodeQuery[query]("/items?page=3&debug=false")
+	require.NoError(t, err)
+	assert.Equal(t, query{Page: 3, Tags: []string{"a", "b"}}, q)
+
+	q, err = DecodeQuery[query]("/items")
+	require.NoError(t, err)
+	assert.Equal(t, query{Page: 1, Tags: []string{"a", "b"}}, q)
+
+	assert.ErrorContains(t, DecodeValues(url.Values{}, query{}), "expected a pointer to a struct")
+	var badDefault struct {
+		Page int `form:"page" default:"first"`
+	}
+	assert.ErrorContains(t, DecodeValues(url.Values{}, &badDefault), `invalid config at "/page": invalid default "first"`)
+	var unsupported struct {
+		M map[string]string `form:"m"`
+	}
+	assert.ErrorContains(t, DecodeValues(url.Values{"m": {"x"}}, &unsupported), "unsupported type map[string]string")
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// gRPC status codes used by the client, see https://grpc.io/docs/guides/status-codes/
+const (
+	GrpcStatusOK               = 0
+	GrpcStatusUnknown          = 2
+	GrpcStatusDeadlineExceeded = 4
+	GrpcStatusInternal         = 13
+	GrpcStatusUnavailable      = 14
+	GrpcStatusUnauthenticated  = 16
+)
+
+const grpcFrameHeaderSize = 5
+
+// GrpcStatus is the status of a finished gRPC call
+type GrpcStatus struct {
+	Code    int
+	Message string
+}
+
+func (s GrpcStatus) OK() bool {
+	return s.Code == GrpcStatusOK
+}
+
+func (s GrpcStatus) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.Code, s.Message)
+}
+
+// GrpcResponseCallback receives the status, the response metadata (headers and trailers) and the
+// messages of a gRPC call. Unary calls carry at most one message.
+type GrpcResponseCallback func(status GrpcStatus, metadata http.Header, messages [][]byte)
+
+// GrpcClient sends gRPC calls as HTTP/2 callouts. Since callouts buffer the whole response,
+// the messages of a server streaming call are delivered together once the stream is closed.
+type GrpcClient interface {
+	// Call sends a request message to a method given as "/package.Service/Method"
+	Call(method string, metadata [][2]string, request []byte, cb GrpcResponseCallback, timeoutMillisecond ...uint32) error
+	ClusterName() string
+}
+
+type GrpcClusterClient[C Cluster] struct {
+	cluster C
+}
+
+// NewGrpcClusterClient creates a gRPC client, the cluster must be configured for HTTP/2
+func NewGrpcClusterClient[C Cluster](cluster C) *GrpcClusterClient[C] {
+	return &GrpcClusterClient[C]{cluster: cluster}
+}
+
+func (c GrpcClusterClient[C]) Call(method string, metadata [][2]string, request []byte, cb GrpcResponseCallback, timeoutMillisecond ...uint32) error {
+	return GrpcCall(c.cluster, method, metadata, request, cb, timeoutMillisecond...)
+}
+
+func (c GrpcClusterClient[C]) ClusterName() string {
+	return c.cluster.ClusterName()
+}
+
+// GrpcCallProto sends a unary call with protobuf messages, the response is unmarshalled into response
+// before the callback is called.
+func GrpcCallProto(client GrpcClient, method string, metadata [][2]string, request, response proto.Message,
+	cb func(status GrpcStatus, metadata http.Header), timeoutMillisecond ...uint32) error {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal grpc request: %v", err)
+	}
+	return client.Call(method, metadata, data, func(status GrpcStatus, md http.Header, messages [][]byte) {
+		if status.OK() {
+			if len(messages) != 1 {
+				status = GrpcStatus{Code: GrpcStatusInternal, Message: fmt.Sprintf("unary call returned %d messages", len(messages))}
+			} else if err := proto.Unmarshal(messages[0], response); err != nil {
+				status = GrpcStatus{Code: GrpcStatusInternal, Message: fmt.Sprintf("failed to unmarshal grpc response: %v", err)}
+			}
+		}
+		cb(status, md)
+	}, timeoutMillisecond...)
+}
+
+// GrpcCall sends a gRPC call to the cluster. The timeout, 500ms by default, is also sent to the
+// server as the grpc-timeout deadline.
+func GrpcCall(cluster Cluster, method string, metadata [][2]string, request []byte, callback GrpcResponseCallback, timeoutMillisecond ...uint32) error {
+	if !strings.HasPrefix(method, "/") || strings.Count(method, "/") != 2 {
+		return fmt.Errorf("invalid grpc method: %s", method)
+	}
+	var timeout uint32 = 500
+	if len(timeoutMillisecond) > 0 {
+		timeout = timeoutMillisecond[0]
+	}
+	authority := cluster.HostName()
+	if authority == "" {
+		authority = "unknownhost"
+	}
+	headers := make([][2]string, 0, len(metadata)+7)
+	for _, h := range metadata {
+		if strings.HasPrefix(h[0], ":") {
+			continue
+		}
+		headers = append(headers, h)
+	}
+	headers = append(headers,
+		[2]string{":method", http.MethodPost},
+		[2]string{":path", method},
+		[2]string{":authority", authority},
+		[2]string{"content-type", "application/grpc"},
+		[2]string{"te", "trailers"},
+	)
+	timeout, expected, err := chargeCallout(timeout, func() {
+		log.Debugf("grpc call %s cancelled, the callouts of the request are over their maximum duration", method)
+		callback(GrpcStatus{Code: GrpcStatusDeadlineExceeded, Message: "maximum duration of the callouts of the request reached"}, http.Header{}, nil)
+	})
+	if err != nil {
+		return err
+	}
+	headers = append(headers, [2]string{"grpc-timeout", fmt.Sprintf("%dm", timeout)})
+	_, err = proxywasm.DispatchHttpCall(cluster.ClusterName(), headers, EncodeGrpcMessage(request), nil, timeout, func(numHeaders, bodySize, numTrailers int) {
+		if !expected() {
+			log.Debugf("dropping the response of cancelled grpc call %s", method)
+			return
+		}
+		respHeaders, _ := proxywasm.GetHttpCallResponseHeaders()
+		respTrailers, _ := proxywasm.GetHttpCallResponseTrailers()
+		var respBody []byte
+		if bodySize > 0 {
+			respBody, _ = proxywasm.GetHttpCallResponseBody(0, bodySize)
+		}
+		status, md, messages := parseGrpcResponse(respHeaders, respTrailers, respBody)
+		log.Debugf("grpc call %s end, status: %d, message: %s", method, status.Code, status.Message)
+		callback(status, md, messages)
+	})
+	if err != nil {
+		expected()
+		return fmt.Errorf("%w: failed to dispatch grpc call %s: %w", ErrCalloutFailed, method, err)
+	}
+	return nil
+}
+
+// parseGrpcResponse reads the status from the trailers, or from the headers of a trailers-only response
+func parseGrpcResponse(headers, trailers [][2]string, body []byte) (GrpcStatus, http.Header, [][]byte) {
+	md := make(http.Header)
+	httpStatus := 0
+	for _, h := range headers {
+		if h[0] == ":status" {
+			httpStatus, _ = strconv.Atoi(h[1])
+			continue
+		}
+		md.Add(h[0], h[1])
+	}
+	for _, h := range trailers {
+		md.Add(h[0], h[1])
+	}
+	if httpStatus == 0 {
+		return GrpcStatus{Code: GrpcStatusUnavailable, Message: "no response from upstream"}, md, nil
+	}
+	rawCode := md.Get("grpc-status")
+	if rawCode == "" {
+		if httpStatus != http.StatusOK {
+			return GrpcStatus{Code: httpStatusToGrpcCode(httpStatus), Message: fmt.Sprintf("http status %d", httpStatus)}, md, nil
+		}
+		return GrpcStatus{Code: GrpcStatusInternal, Message: "missing grpc-status"}, md, nil
+	}
+	code, err := strconv.Atoi(rawCode)
+	if err != nil {
+		return GrpcStatus{Code: GrpcStatusUnknown, Message: "invalid grpc-status: " + rawCode}, md, nil
+	}
+	message, err := url.PathUnescape(md.Get("grpc-message"))
+	if err != nil {
+		message = md.Get("grpc-message")
+	}
+	status := GrpcStatus{Code: code, Message: message}
+	messages, err := DecodeGrpcMessages(body)
+	if err != nil && status.OK() {
+		return GrpcStatus{Code: GrpcStatusInternal, Message: err.Error()}, md, nil
+	}
+	return status, md, messages
+}
+
+// httpStatusToGrpcCode maps the HTTP status of a response without grpc-status as specified by gRPC
+func httpStatusToGrpcCode(httpStatus int) int {
+	switch httpStatus {
+	case http.StatusUnauthorized:
+		return GrpcStatusUnauthenticated
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return GrpcStatusUnavailable
+	case http.StatusBadRequest:
+		return GrpcStatusInternal
+	}
+	return GrpcStatusUnknown
+}
+
+// EncodeGrpcMessage frames an uncompressed message with the gRPC length prefix
+func EncodeGrpcMessage(message []byte) []byte {
+	frame := make([]byte, grpcFrameHeaderSize+len(message))
+	binary.BigEndian.PutUint32(frame[1:grpcFrameHeaderSize], uint32(len(message)))
+	copy(frame[grpcFrameHeaderSize:], message)
+	return frame
+}
+
+// DecodeGrpcMessages splits a gRPC body into its messages, compressed messages are not supported
+func DecodeGrpcMessages(body []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(body) > 0 {
+		if len(body) < grpcFrameHeaderSize {
+			return nil, errors.New("truncated grpc frame header")
+		}
+		if body[0] != 0 {
+			return nil, errors.New("compressed grpc messages are not supported")
+		}
+		size := binary.BigEndian.Uint32(body[1:grpcFrameHeaderSize])
+		if uint32(len(body)-grpcFrameHeaderSize) < size {
+			return nil, errors.New("truncated grpc message")
+		}
+		messages = append(messages, body[grpcFrameHeaderSize:grpcFrameHeaderSize+int(size)])
+		body = body[grpcFrameHeaderSize+int(size):]
+	}
+	return messages, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestGrpcMessageFraming(t *testing.T) {
+	body := append(EncodeGrpcMessage([]byte("hello")), EncodeGrpcMessage(nil)...)
+	assert.Equal(t, []byte{0, 0, 0, 0, 5, 'h', 'e', 'l', 'l', 'o', 0, 0, 0, 0, 0}, body)
+	messages, err := DecodeGrpcMessages(body)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("hello"), {}}, messages)
+
+	_, err = DecodeGrpcMessages(body[:7])
+	assert.Error(t, err)
+	_, err = DecodeGrpcMessages([]byte{1, 0, 0, 0, 0})
+	assert.Error(t, err, "compressed messages")
+}
+
+func TestParseGrpcResponse(t *testing.T) {
+	status, md, messages := parseGrpcResponse([][2]string{{":status", "200"}, {"content-type", "application/grpc"}},
+		[][2]string{{"grpc-status", "0"}}, EncodeGrpcMessage([]byte("ok")))
+	assert.True(t, status.OK())
+	assert.Equal(t, "application/grpc", md.Get("content-type"))
+	assert.Equal(t, [][]byte{[]byte("ok")}, messages)
+
+	// Trailers-only responses carry the status in the headers
+	status, _, messages = parseGrpcResponse([][2]string{{":status", "200"}, {"grpc-status", "5"}, {"grpc-message", "user%20not%20found"}}, nil, nil)
+	assert.Equal(t, GrpcStatus{Code: 5, Message: "user not found"}, status)
+	assert.Empty(t, messages)
+
+	status, _, _ = parseGrpcResponse([][2]string{{":status", "503"}}, nil, nil)
+	assert.Equal(t, GrpcStatusUnavailable, status.Code)
+	status, _, _ = parseGrpcResponse(nil, nil, nil)
+	assert.Equal(t, GrpcStatusUnavailable, status.Code, "no response")
+	status, _, _ = parseGrpcResponse([][2]string{{":status", "200"}}, nil, nil)
+	assert.Equal(t, GrpcStatusInternal, status.Code, "missing grpc-status")
+}
+
+func TestGrpcCall(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("grpc-client-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	client := NewGrpcClusterClient(FQDNCluster{FQDN: "auth.default.svc.cluster.local", Port: 9090})
+	assert.Error(t, client.Call("Check", nil, nil, func(GrpcStatus, http.Header, [][]byte) {}), "invalid method")
+
+	var status GrpcStatus
+	response := &wrapperspb.StringValue{}
+	assert.NoError(t, GrpcCallProto(client, "/auth.v1.Auth/Check", [][2]string{{"x-request-id", "abc"}, {":path", "/ignored"}},
+		wrapperspb.String("token"), response, func(s GrpcStatus, md http.Header) {
+			status = s
+		}, 200))
+	callouts := host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, "outbound|9090||auth.default.svc.cluster.local", callouts[0].Upstream)
+		assert.Contains(t, callouts[0].Headers, [2]string{":path", "/auth.v1.Auth/Check"})
+		assert.Contains(t, callouts[0].Headers, [2]string{"x-request-id", "abc"})
+		assert.Contains(t, callouts[0].Headers, [2]string{"grpc-timeout", "200m"})
+		assert.NotContains(t, callouts[0].Headers, [2]string{":path", "/ignored"})
+		messages, err := DecodeGrpcMessages(callouts[0].Body)
+		assert.NoError(t, err)
+		request := &wrapperspb.StringValue{}
+		assert.NoError(t, proto.Unmarshal(messages[0], request))
+		assert.Equal(t, "token", request.GetValue())
+
+		data, _ := proto.Marshal(wrapperspb.String("alice"))
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}, {"content-type", "application/grpc"}},
+			[][2]string{{"grpc-status", "0"}}, EncodeGrpcMessage(data))
+	}
+	assert.True(t, status.OK(), status.Message)
+	assert.Equal(t, "alice", response.GetValue())
+
+	// Server streaming responses are delivered together
+	var messages [][]byte
+	assert.NoError(t, client.Call("/auth.v1.Auth/Watch", nil, nil, func(s GrpcStatus, md http.Header, m [][]byte) {
+		status, messages = s, m
+	}))
+	callouts = host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		body := append(EncodeGrpcMessage([]byte("a")), EncodeGrpcMessage([]byte("b"))...)
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}},
+			[][2]string{{"grpc-status", "14"}, {"grpc-message", "stream%20reset"}}, body)
+	}
+	assert.Equal(t, GrpcStatus{Code: GrpcStatusUnavailable, Message: "stream reset"}, status)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, messages)
+}
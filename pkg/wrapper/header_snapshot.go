@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+)
+
+const (
+	ctxKeyRequestHeaderSnapshot  = "__request_header_snapshot__"
+	ctxKeyResponseHeaderSnapshot = "__response_header_snapshot__"
+)
+
+type headerSnapshotOption[PluginConfig any] struct {
+	response bool
+	names    []string
+}
+
+func (o *headerSnapshotOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	for _, name := range o.names {
+		name = strings.ToLower(name)
+		if o.response {
+			ctx.responseHeaderSnapshot = append(ctx.responseHeaderSnapshot, name)
+		} else {
+			ctx.requestHeaderSnapshot = append(ctx.requestHeaderSnapshot, name)
+		}
+	}
+}
+
+// WithRequestHeaderSnapshot captures the given request headers before the plugin's request header
+// handler runs, so that they can be read with GetRequestHeaderSnapshot in later phases and in
+// callbacks, where the host no longer exposes the request headers.
+func WithRequestHeaderSnapshot[PluginConfig any](names ...string) CtxOption[PluginConfig] {
+	return &headerSnapshotOption[PluginConfig]{names: names}
+}
+
+// WithResponseHeaderSnapshot captures the given response headers before the plugin's response
+// header handler runs, so that they can be read with GetResponseHeaderSnapshot in later phases.
+func WithResponseHeaderSnapshot[PluginConfig any](names ...string) CtxOption[PluginConfig] {
+	return &headerSnapshotOption[PluginConfig]{response: true, names: names}
+}
+
+// GetRequestHeaderSnapshot returns a request header captured by WithRequestHeaderSnapshot.
+// Multiple values of the header are joined with commas.
+func GetRequestHeaderSnapshot(ctx HttpContext, name string) (string, bool) {
+	return getHeaderSnapshot(ctx, ctxKeyRequestHeaderSnapshot, name)
+}
+
+// GetResponseHeaderSnapshot returns a response header captured by WithResponseHeaderSnapshot.
+// Multiple values of the header are joined with commas.
+func GetResponseHeaderSnapshot(ctx HttpContext, name string) (string, bool) {
+	return getHeaderSnapshot(ctx, ctxKeyResponseHeaderSnapshot, name)
+}
+
+func getHeaderSnapshot(ctx HttpContext, key, name string) (string, bool) {
+	snapshot, _ := ctx.GetContext(key).(map[string]string)
+	value, ok := snapshot[strings.ToLower(name)]
+	return value, ok
+}
+
+// snapshotHeaders stores the selected headers in the context, absent headers are left out
+func snapshotHeaders(ctx HttpContext, key string, names []string, getHeaders func() ([][2]string, error)) {
+	if len(names) == 0 {
+		return
+	}
+	headers, err := getHeaders()
+	if err != nil {
+		return
+	}
+	snapshot := make(map[string]string, len(names))
+	for _, name := range names {
+		var values []string
+		for _, h := range headers {
+			if strings.EqualFold(h[0], name) {
+				values = append(values, h[1])
+			}
+		}
+		if len(values) > 0 {
+			snapshot[name] = strings.Join(values, ",")
+		}
+	}
+	ctx.SetContext(key, snapshot)
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) snapshotRequestHeaders() {
+	snapshotHeaders(ctx, ctxKeyRequestHeaderSnapshot, ctx.plugin.vm.requestHeaderSnapshot, proxywasm.GetHttpRequestHeaders)
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) snapshotResponseHeaders() {
+	snapshotHeaders(ctx, ctxKeyResponseHeaderSnapshot, ctx.plugin.vm.responseHeaderSnapshot, proxywasm.GetHttpResponseHeaders)
+}
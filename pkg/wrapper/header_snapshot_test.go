@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderSnapshot(t *testing.T) {
+	var requestHeaders, responseHeaders map[string]string
+	lookup := func(ctx HttpContext, get func(HttpContext, string) (string, bool), names ...string) map[string]string {
+		found := map[string]string{}
+		for _, name := range names {
+			if value, ok := get(ctx, name); ok {
+				found[name] = value
+			}
+		}
+		return found
+	}
+	vm := NewCommonVmCtx[struct{}]("header-snapshot-test",
+		WithRequestHeaderSnapshot[struct{}]("X-Tenant", "x-forwarded-for", "x-missing"),
+		WithResponseHeaderSnapshot[struct{}]("x-upstream"),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			// Changes made by the plugin must not affect the snapshot
+			proxywasm.ReplaceHttpRequestHeader("x-tenant", "changed")
+			return types.ActionContinue
+		}),
+		ProcessResponseBody(func(ctx HttpContext, config struct{}, body []byte) types.Action {
+			requestHeaders = lookup(ctx, GetRequestHeaderSnapshot, "x-tenant", "X-Forwarded-For", "x-missing")
+			responseHeaders = lookup(ctx, GetResponseHeaderSnapshot, "x-upstream", "x-tenant")
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{
+		{":authority", "example.com"}, {":path", "/"}, {":method", "GET"},
+		{"x-tenant", "acme"}, {"x-forwarded-for", "1.1.1.1"}, {"X-Forwarded-For", "2.2.2.2"},
+	}, true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-type", "application/json"}, {"x-upstream", "10.0.0.1"}}, false)
+	host.CallOnResponseBody(id, []byte(`{}`), true)
+
+	assert.Equal(t, map[string]string{"x-tenant": "acme", "X-Forwarded-For": "1.1.1.1,2.2.2.2"}, requestHeaders)
+	assert.Equal(t, map[string]string{"x-upstream": "10.0.0.1"}, responseHeaders)
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+type HeaderOp string
+
+const (
+	HeaderOpAdd     HeaderOp = "add"     // Append a value, keeping existing ones
+	HeaderOpSet     HeaderOp = "set"     // Replace all values with a single one
+	HeaderOpRemove  HeaderOp = "remove"  // Remove all values
+	HeaderOpRename  HeaderOp = "rename"  // Move all values to another header, replacing it
+	HeaderOpRewrite HeaderOp = "rewrite" // Rewrite each value by a regular expression
+)
+
+// HeaderRule is a single header transformation step.
+type HeaderRule struct {
+	Op          HeaderOp
+	Key         string
+	Value       string
+	NewKey      string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// HeaderTransformer applies an ordered list of header rules, e.g.
+//
+//	[
+//	  {"op": "rename", "key": "x-token", "newKey": "authorization"},
+//	  {"op": "rewrite", "key": "authorization", "pattern": "^(\\S+)$", "replacement": "Bearer $1"},
+//	  {"op": "set", "key": "x-gateway", "value": "higress"},
+//	  {"op": "remove", "key": "cookie"}
+//	]
+//
+// Each rule sees the headers produced by the rules before it. Header keys are matched case-insensitively.
+type HeaderTransformer struct {
+	Rules []HeaderRule
+}
+
+// ParseHeaderTransformer parses an array of header rules.
+func ParseHeaderTransformer(json gjson.Result) (*HeaderTransformer, error) {
+	if !json.Exists() {
+		return &HeaderTransformer{}, nil
+	}
+	if !json.IsArray() {
+		return nil, configerr.New("", "array", fmt.Errorf("header rules must be an array"))
+	}
+	transformer := &HeaderTransformer{}
+	for i, item := range json.Array() {
+		rule, err := parseHeaderRule(item)
+		if err != nil {
+			return nil, configerr.Prefix(configerr.Pointer(i), err)
+		}
+		transformer.Rules = append(transformer.Rules, rule)
+	}
+	return transformer, nil
+}
+
+func parseHeaderRule(json gjson.Result) (HeaderRule, error) {
+	if !json.IsObject() {
+		return HeaderRule{}, configerr.New("", "object", fmt.Errorf("header rule must be an object"))
+	}
+	rule := HeaderRule{
+		Op:          HeaderOp(json.Get("op").String()),
+		Key:         strings.ToLower(json.Get("key").String()),
+		Value:       json.Get("value").String(),
+		NewKey:      strings.ToLower(json.Get("newKey").String()),
+		Replacement: json.Get("replacement").String(),
+	}
+	if rule.Key == "" {
+		return rule, configerr.Errorf("/key", "string", "header rule key is required")
+	}
+	switch rule.Op {
+	case HeaderOpAdd, HeaderOpSet:
+		if !json.Get("value").Exists() {
+			return rule, configerr.Errorf("/value", "string", "%s header rule requires a value", rule.Op)
+		}
+	case HeaderOpRemove:
+	case HeaderOpRename:
+		if rule.NewKey == "" {
+			return rule, configerr.Errorf("/newKey", "string", "rename header rule requires a newKey")
+		}
+	case HeaderOpRewrite:
+		pattern := json.Get("pattern").String()
+		if pattern == "" {
+			return rule, configerr.Errorf("/pattern", "string", "rewrite header rule requires a pattern")
+		}
+		var err error
+		if rule.Pattern, err = regexp.Compile(pattern); err != nil {
+			return rule, configerr.Errorf("/pattern", "regular expression", "failed to compile pattern: %v", err)
+		}
+	default:
+		return rule, configerr.Errorf("/op", "one of add, set, remove, rename, rewrite", "unknown header rule op: %s", rule.Op)
+	}
+	if strings.HasPrefix(rule.Key, ":") && (rule.Op == HeaderOpRemove || rule.Op == HeaderOpRename) {
+		return rule, configerr.Errorf("/key", "regular header", "pseudo header %s can not be %sd", rule.Key, rule.Op)
+	}
+	return rule, nil
+}
+
+// Transform returns the headers after applying all rules, the input is not modified.
+func (t *HeaderTransformer) Transform(headers [][2]string) [][2]string {
+	result := make([][2]string, len(headers))
+	copy(result, headers)
+	for _, rule := range t.Rules {
+		result = rule.apply(result)
+	}
+	return result
+}
+
+func (r HeaderRule) apply(headers [][2]string) [][2]string {
+	switch r.Op {
+	case HeaderOpAdd:
+		return append(headers, [2]string{r.Key, r.Value})
+	case HeaderOpSet:
+		return append(removeHeader(headers, r.Key), [2]string{r.Key, r.Value})
+	case HeaderOpRemove:
+		return removeHeader(headers, r.Key)
+	case HeaderOpRename:
+		var values []string
+		for _, h := range headers {
+			if strings.EqualFold(h[0], r.Key) {
+				values = append(values, h[1])
+			}
+		}
+		if len(values) == 0 {
+			return headers
+		}
+		headers = removeHeader(removeHeader(headers, r.Key), r.NewKey)
+		for _, value := range values {
+			headers = append(headers, [2]string{r.NewKey, value})
+		}
+		return headers
+	case HeaderOpRewrite:
+		for i, h := range headers {
+			if strings.EqualFold(h[0], r.Key) {
+				headers[i][1] = r.Pattern.ReplaceAllString(h[1], r.Replacement)
+			}
+		}
+	}
+	return headers
+}
+
+func removeHeader(headers [][2]string, key string) [][2]string {
+	result := headers[:0]
+	for _, h := range headers {
+		if !strings.EqualFold(h[0], key) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// ApplyToRequest transforms the request headers, it should be called in the request header phase.
+func (t *HeaderTransformer) ApplyToRequest() error {
+	if len(t.Rules) == 0 {
+		return nil
+	}
+	headers, err := proxywasm.GetHttpRequestHeaders()
+	if err != nil {
+		return fmt.Errorf("failed to get request headers: %v", err)
+	}
+	if err = proxywasm.ReplaceHttpRequestHeaders(t.Transform(headers)); err != nil {
+		return fmt.Errorf("failed to replace request headers: %v", err)
+	}
+	return nil
+}
+
+// ApplyToResponse transforms the response headers, it should be called in the response header phase.
+func (t *HeaderTransformer) ApplyToResponse() error {
+	if len(t.Rules) == 0 {
+		return nil
+	}
+	headers, err := proxywasm.GetHttpResponseHeaders()
+	if err != nil {
+		return fmt.Errorf("failed to get response headers: %v", err)
+	}
+	if err = proxywasm.ReplaceHttpResponseHeaders(t.Transform(headers)); err != nil {
+		return fmt.Errorf("failed to replace response headers: %v", err)
+	}
+	return nil
+}
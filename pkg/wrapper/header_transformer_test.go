@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestHeaderTransformer(t *testing.T) {
+	transformer, err := ParseHeaderTransformer(gjson.Parse(`[
+		{"op": "rename", "key": "X-Token", "newKey": "authorization"},
+		{"op": "rewrite", "key": "authorization", "pattern": "^(\\S+)$", "replacement": "Bearer $1"},
+		{"op": "set", "key": "x-gateway", "value": "higress"},
+		{"op": "add", "key": "x-tag", "value": "b"},
+		{"op": "remove", "key": "cookie"},
+		{"op": "rewrite", "key": ":path", "pattern": "^/v1/", "replacement": "/api/"}
+	]`))
+	assert.NoError(t, err)
+
+	headers := [][2]string{
+		{":path", "/v1/users"},
+		{"x-token", "secret"},
+		{"authorization", "Basic old"},
+		{"X-Gateway", "other"},
+		{"x-tag", "a"},
+		{"Cookie", "session=1"},
+	}
+	assert.Equal(t, [][2]string{
+		{":path", "/api/users"},
+		{"x-tag", "a"},
+		{"authorization", "Bearer secret"},
+		{"x-gateway", "higress"},
+		{"x-tag", "b"},
+	}, transformer.Transform(headers))
+	assert.Equal(t, [2]string{"x-token", "secret"}, headers[1], "input headers must not be modified")
+
+	// Renaming a missing header keeps the target untouched
+	transformer, err = ParseHeaderTransformer(gjson.Parse(`[{"op": "rename", "key": "x-missing", "newKey": "x-tag"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]string{{"x-tag", "a"}}, transformer.Transform([][2]string{{"x-tag", "a"}}))
+}
+
+func TestParseHeaderTransformerErrors(t *testing.T) {
+	tests := []struct {
+		config  string
+		pointer string
+	}{
+		{`{"op": "set"}`, "/"},
+		{`[{"op": "set", "value": "v"}]`, "/0/key"},
+		{`[{"op": "remove", "key": "a"}, {"op": "set", "key": "b"}]`, "/1/value"},
+		{`[{"op": "rename", "key": "a"}]`, "/0/newKey"},
+		{`[{"op": "rewrite", "key": "a", "pattern": "("}]`, "/0/pattern"},
+		{`[{"op": "copy", "key": "a"}]`, "/0/op"},
+		{`[{"op": "remove", "key": ":path"}]`, "/0/key"},
+	}
+	for _, tt := range tests {
+		_, err := ParseHeaderTransformer(gjson.Parse(tt.config))
+		assert.ErrorContains(t, err, `"`+tt.pointer+`"`, tt.config)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
@@ -45,41 +46,68 @@ type HttpClient interface {
 
 type ClusterClient[C Cluster] struct {
 	cluster C
+	signer  RequestSigner
 }
 
-func NewClusterClient[C Cluster](cluster C) *ClusterClient[C] {
-	return &ClusterClient[C]{cluster: cluster}
+type clusterClientOptions struct {
+	signer RequestSigner
+}
+
+type ClusterClientOption func(o *clusterClientOptions)
+
+// WithRequestSigner signs every callout of the client, e.g. with a SigV4Signer. The signature covers
+// the headers and body given to the client, the headers added later such as the tracing ones are not
+// signed.
+func WithRequestSigner(signer RequestSigner) ClusterClientOption {
+	return func(o *clusterClientOptions) {
+		o.signer = signer
+	}
+}
+
+func NewClusterClient[C Cluster](cluster C, opts ...ClusterClientOption) *ClusterClient[C] {
+	var o clusterClientOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &ClusterClient[C]{cluster: cluster, signer: o.signer}
 }
 
 func (c ClusterClient[C]) Get(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodGet, rawURL, headers, nil, cb, timeoutMillisecond...)
+	return c.Call(http.MethodGet, rawURL, headers, nil, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Head(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodHead, rawURL, headers, nil, cb, timeoutMillisecond...)
+	return c.Call(http.MethodHead, rawURL, headers, nil, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Options(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodOptions, rawURL, headers, nil, cb, timeoutMillisecond...)
+	return c.Call(http.MethodOptions, rawURL, headers, nil, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Post(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodPost, rawURL, headers, body, cb, timeoutMillisecond...)
+	return c.Call(http.MethodPost, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Put(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodPut, rawURL, headers, body, cb, timeoutMillisecond...)
+	return c.Call(http.MethodPut, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Patch(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodPatch, rawURL, headers, body, cb, timeoutMillisecond...)
+	return c.Call(http.MethodPatch, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Delete(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodDelete, rawURL, headers, body, cb, timeoutMillisecond...)
+	return c.Call(http.MethodDelete, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Connect(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodConnect, rawURL, headers, body, cb, timeoutMillisecond...)
+	return c.Call(http.MethodConnect, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 func (c ClusterClient[C]) Trace(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
-	return HttpCall(c.cluster, http.MethodTrace, rawURL, headers, body, cb, timeoutMillisecond...)
+	return c.Call(http.MethodTrace, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 
 func (c ClusterClient[C]) Call(method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	if c.signer != nil {
+		signed, err := signCallout(c.signer, c.cluster, method, rawURL, headers, body)
+		if err != nil {
+			return err
+		}
+		headers = signed
+	}
 	return HttpCall(c.cluster, method, rawURL, headers, body, cb, timeoutMillisecond...)
 }
 
@@ -100,13 +128,7 @@ func HttpCall(cluster Cluster, method, rawURL string, headers [][2]string, body
 		proxywasm.LogCriticalf("invalid rawURL:%s", rawURL)
 		return err
 	}
-	authority := cluster.HostName()
-	if parsedURL.Host != "" {
-		authority = parsedURL.Host
-	}
-	if authority == "" {
-		authority = "unknownhost"
-	}
+	authority := calloutAuthority(cluster, parsedURL)
 	path := "/" + strings.TrimPrefix(parsedURL.Path, "/")
 	if parsedURL.RawQuery != "" {
 		path = fmt.Sprintf("%s?%s", path, parsedURL.RawQuery)
@@ -117,8 +139,27 @@ func HttpCall(cluster Cluster, method, rawURL string, headers [][2]string, body
 		timeout = timeoutMillisecond[0]
 	}
 	headers = append(headers, [2]string{":method", method}, [2]string{":path", path}, [2]string{":authority", authority})
-	requestID := uuid.New().String()
+	requestID := calloutID(headers)
+	calloutDone := startCalloutTiming("callout", cluster.ClusterName())
+	headers, spanDone := startCalloutSpan(headers, cluster.ClusterName())
+	timeout, expected, err := chargeCallout(timeout, func() {
+		calloutDone()
+		log.Infof("http call cancelled, id: %s, the callouts of the request are over their maximum duration", requestID)
+		spanDone(http.StatusGatewayTimeout)
+		if rejectFailedCallout(FailureCallout, ErrCalloutLimitExceeded) {
+			return
+		}
+		callback(http.StatusGatewayTimeout, http.Header{}, nil)
+	})
+	if err != nil {
+		return err
+	}
 	_, err = proxywasm.DispatchHttpCall(cluster.ClusterName(), headers, body, nil, timeout, func(numHeaders, bodySize, numTrailers int) {
+		if !expected() {
+			log.Debugf("dropping the response of cancelled http call, id: %s", requestID)
+			return
+		}
+		calloutDone()
 		respBody, err := proxywasm.GetHttpCallResponseBody(0, bodySize)
 		if err != nil {
 			proxywasm.LogDebugf("body is empty")
@@ -143,12 +184,67 @@ func HttpCall(cluster Cluster, method, rawURL string, headers [][2]string, body
 			headers.Add(h[0], h[1])
 		}
 		log.UnsafeInfof("http call end, id: %s, code: %d, normal: %t, body: %s",
-			requestID, code, normalResponse, strings.ReplaceAll(string(respBody), "\n", `\n`))
+			requestID, code, normalResponse, strings.ReplaceAll(string(log.RedactBody(respBody)), "\n", `\n`))
+		spanDone(code)
+		if !normalResponse && rejectFailedCallout(FailureCallout, fmt.Errorf("http call to %s got no response", cluster.ClusterName())) {
+			return
+		}
 		callback(code, headers, respBody)
 	})
-	if err == nil {
-		log.UnsafeInfof("http call start, id: %s, cluster: %s, method: %s, url: %s, headers: %#v, body: %s, timeout: %d",
-			requestID, cluster.ClusterName(), method, rawURL, headers, strings.ReplaceAll(string(body), "\n", `\n`), timeout)
+	if err != nil {
+		expected()
+		return fmt.Errorf("%w: failed to dispatch http call to %s: %w", ErrCalloutFailed, cluster.ClusterName(), err)
+	}
+	log.UnsafeInfof("http call start, id: %s, cluster: %s, method: %s, url: %s, headers: %#v, body: %s, timeout: %d",
+		requestID, cluster.ClusterName(), method, rawURL, log.RedactHeaders(headers), strings.ReplaceAll(string(log.RedactBody(body)), "\n", `\n`), timeout)
+	return nil
+}
+
+// calloutID returns the x-request-id carried by the callout headers so that callout logs can be
+// matched with the originating request, and generates a random ID when there is none.
+func calloutID(headers [][2]string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h[0], "x-request-id") && h[1] != "" {
+			return h[1]
+		}
+	}
+	return uuid.New().String()
+}
+
+// calloutAuthority returns the host of the URL, or that of the cluster for relative URLs
+func calloutAuthority(cluster Cluster, parsedURL *url.URL) string {
+	authority := cluster.HostName()
+	if parsedURL.Host != "" {
+		authority = parsedURL.Host
+	}
+	if authority == "" {
+		authority = "unknownhost"
+	}
+	return authority
+}
+
+// signCallout returns the headers of a callout with those added by the signer
+func signCallout(signer RequestSigner, cluster Cluster, method, rawURL string, headers [][2]string, body []byte) ([][2]string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req := &SigningRequest{
+		Method: method,
+		Host:   calloutAuthority(cluster, parsedURL),
+		Path:   "/" + strings.TrimPrefix(parsedURL.EscapedPath(), "/"),
+		Query:  parsedURL.RawQuery,
+		Body:   body,
+		Time:   time.Now(),
+	}
+	// The signer must not modify the headers of the caller
+	for _, h := range headers {
+		if h[0] != ":method" && h[0] != ":path" && h[0] != ":authority" {
+			req.Headers = append(req.Headers, h)
+		}
+	}
+	if err := signer.Sign(req); err != nil {
+		return nil, fmt.Errorf("failed to sign callout: %v", err)
 	}
-	return err
+	return req.Headers, nil
 }
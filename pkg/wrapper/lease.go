@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// vmInstanceID identifies the VM in the leases it holds and in its metrics, every VM has its own package
+// variables
+var vmInstanceID = uuid.New().String()
+
+// namedLease is the shared data value of a lease taken with HoldLease
+type namedLease struct {
+	Holder string `json:"holder"`
+	// Unix milliseconds after which the lease may be taken by another VM
+	Expiry int64 `json:"expiry"`
+}
+
+// HoldLease reports whether the VM holds the lease of the given name. A free or expired lease is taken
+// and a lease held by the VM is renewed until ttl from now, so that work every VM would otherwise repeat
+// on its ticks, like polling or keep-alive pings, is done by a single VM. The lease passes to another VM
+// once its holder stops renewing it, e.g. when the VM is destroyed.
+//
+// Usage in a tick function:
+//
+//	wrapper.RegisterTickFunc(1000, func() {
+//	    if !wrapper.HoldLease("my-plugin-poller", 3*time.Second) {
+//	        return
+//	    }
+//	    poll()
+//	})
+func HoldLease(name string, ttl time.Duration) bool {
+	key := fmt.Sprintf("%s:%s", VMLeaseKeyPrefix, name)
+	now := time.Now()
+	data, cas, err := proxywasm.GetSharedData(key)
+	if err != nil && !errors.Is(err, types.ErrorStatusNotFound) {
+		log.Errorf("Failed to get lease %s: %v", name, err)
+		return false
+	}
+	var lease namedLease
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &lease); err != nil {
+			log.Warnf("Discarding malformed lease %s: %v", name, err)
+		}
+	}
+	if lease.Holder != "" && lease.Holder != vmInstanceID && now.UnixMilli() <= lease.Expiry {
+		return false
+	}
+	if err != nil || len(data) == 0 {
+		// Only create the lease when no other VM created it in the meantime: a cas that no entry can
+		// have fails once the key exists, while cas 0 would overwrite it unconditionally
+		cas = math.MaxUint32
+	}
+	value, _ := json.Marshal(namedLease{Holder: vmInstanceID, Expiry: now.Add(ttl).UnixMilli()})
+	if err := proxywasm.SetSharedData(key, value, cas); err != nil {
+		if !errors.Is(err, types.ErrorStatusCasMismatch) {
+			log.Errorf("Failed to set lease %s: %v", name, err)
+		}
+		return false
+	}
+	return true
+}
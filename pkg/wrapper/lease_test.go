@@ -0,0 +1,49 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoldLease(t *testing.T) {
+	_, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+	self := vmInstanceID
+	defer func() { vmInstanceID = self }()
+	asVM := func(holder string) {
+		vmInstanceID = holder
+	}
+
+	asVM("vm-1")
+	assert.True(t, HoldLease("poller", time.Minute))
+	assert.True(t, HoldLease("poller", time.Minute), "the holder renews its lease")
+	assert.True(t, HoldLease("keepalive", time.Minute), "leases of other names are independent")
+
+	asVM("vm-2")
+	assert.False(t, HoldLease("poller", time.Minute), "a held lease is not taken")
+	assert.False(t, HoldLease("keepalive", time.Minute))
+
+	asVM("vm-1")
+	assert.True(t, HoldLease("poller", -time.Second), "the last renewal sets the expiry")
+	asVM("vm-2")
+	assert.True(t, HoldLease("poller", time.Minute), "an expired lease is taken over")
+	asVM("vm-1")
+	assert.False(t, HoldLease("poller", time.Minute), "the previous holder lost the lease")
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+// LogSampling limits the lines logged at a level, lines below the log level of Envoy are not counted
+type LogSampling struct {
+	Level LogLevel
+	// Every logs 1 of every N lines, 0 logs all lines
+	Every uint64
+	// PerSecond is the average number of lines logged per second, 0 is unlimited
+	PerSecond float64
+	// Burst is the number of lines logged at once over PerSecond, defaults to PerSecond
+	Burst int
+}
+
+type logSamplingOption[PluginConfig any] struct {
+	samplings []LogSampling
+}
+
+func (o *logSamplingOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	if l, ok := ctx.log.(*DefaultLog); ok {
+		l.setSampling(o.samplings...)
+	}
+}
+
+// WithLogSampling samples and rate limits the lines of the default log by level, so that debug
+// logging can be turned up in production:
+//
+//	wrapper.WithLogSampling[PluginConfig](
+//		wrapper.LogSampling{Level: wrapper.LogLevelDebug, Every: 100},
+//		wrapper.LogSampling{Level: wrapper.LogLevelInfo, PerSecond: 50},
+//	)
+//
+// Dropped lines are counted in the counter metric log.<plugin name>.<level>.dropped, and reported
+// by a line of their level before the next logged line.
+func WithLogSampling[PluginConfig any](samplings ...LogSampling) CtxOption[PluginConfig] {
+	return &logSamplingOption[PluginConfig]{samplings: samplings}
+}
+
+// logSampling are the samplers of a log by level, shared by the logs with fields derived from it
+type logSampling struct {
+	samplers     [LogLevelCritical + 1]*log.Sampler
+	droppedStats [LogLevelCritical + 1]*proxywasm.MetricCounter
+}
+
+func (l *DefaultLog) setSampling(samplings ...LogSampling) {
+	if l.sampling == nil {
+		l.sampling = &logSampling{}
+	}
+	for _, s := range samplings {
+		if s.Level > LogLevelCritical {
+			continue
+		}
+		l.sampling.samplers[s.Level] = log.NewSampler(s.Every, s.PerSecond, s.Burst)
+	}
+}
+
+// sample tells whether to log a line of the level
+func (l *DefaultLog) sample(level LogLevel) bool {
+	if l.sampling == nil || l.sampling.samplers[level] == nil {
+		return true
+	}
+	allowed, unreported := l.sampling.samplers[level].Allow()
+	if !allowed {
+		stat := l.sampling.droppedStats[level]
+		if stat == nil {
+			counter := proxywasm.DefineCounterMetric(fmt.Sprintf("log.%s.%s.dropped", l.pluginName, logLevelNames[level]))
+			stat = &counter
+			l.sampling.droppedStats[level] = stat
+		}
+		stat.Increment(1)
+		return false
+	}
+	if unreported > 0 {
+		// The dropped lines may come from logs with other fields
+		plain := &DefaultLog{pluginName: l.pluginName, pluginID: l.pluginID}
+		plain.emit(level, fmt.Sprintf("%d %s lines dropped by log sampling", unreported, logLevelNames[level]))
+	}
+	return true
+}
+
+// DroppedLines returns the number of lines of the level dropped by WithLogSampling
+func (l *DefaultLog) DroppedLines(level LogLevel) uint64 {
+	if l.sampling == nil || level > LogLevelCritical || l.sampling.samplers[level] == nil {
+		return 0
+	}
+	return l.sampling.samplers[level].Dropped()
+}
@@ -15,10 +15,15 @@
 package wrapper
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
 )
 
 type LogLevel uint32
@@ -32,12 +37,17 @@ const (
 	LogLevelCritical
 )
 
+// logLevelNames are the levels in JSON logs
+var logLevelNames = [...]string{"trace", "debug", "info", "warn", "error", "critical"}
+
 type DefaultLog struct {
 	pluginName string
 	pluginID   string
+	fields     []log.Field
+	sampling   *logSampling
 }
 
-func (l *DefaultLog) log(level LogLevel, msg string) {
+func (l *DefaultLog) enabled(level LogLevel) bool {
 	value, err := proxywasm.CallForeignFunction("get_log_level", nil)
 	var envoyLogLevel LogLevel
 	if err != nil {
@@ -45,15 +55,36 @@ func (l *DefaultLog) log(level LogLevel, msg string) {
 	} else {
 		envoyLogLevel = LogLevel(binary.LittleEndian.Uint32(value))
 	}
-	if level < envoyLogLevel {
-		return
-	}
+	return level >= envoyLogLevel
+}
+
+func requestIDForLog() string {
 	requestIDRaw, _ := proxywasm.GetProperty([]string{"x_request_id"})
 	requestID := string(requestIDRaw)
 	if requestID == "" {
 		requestID = "nil"
 	}
-	msg = fmt.Sprintf("[%s] [%s] [%s] %s", l.pluginName, l.pluginID, requestID, msg)
+	return requestID
+}
+
+func (l *DefaultLog) log(level LogLevel, msg string) {
+	if !l.enabled(level) || !l.sample(level) {
+		return
+	}
+	l.emit(level, msg)
+}
+
+// emit formats and writes a line that passed the log level and sampling
+func (l *DefaultLog) emit(level LogLevel, msg string) {
+	if log.GetFormat() == log.JSONFormat {
+		msg = l.jsonEntry(level, msg)
+	} else {
+		msg = fmt.Sprintf("[%s] [%s] [%s] %s", l.pluginName, l.pluginID, requestIDForLog(), msg) + log.FormatFields(l.fields)
+	}
+	emitLog(level, msg)
+}
+
+func emitLog(level LogLevel, msg string) {
 	switch level {
 	case LogLevelTrace:
 		proxywasm.LogTrace(msg)
@@ -71,22 +102,15 @@ func (l *DefaultLog) log(level LogLevel, msg string) {
 }
 
 func (l *DefaultLog) logFormat(level LogLevel, format string, args ...interface{}) {
-	value, err := proxywasm.CallForeignFunction("get_log_level", nil)
-	var envoyLogLevel LogLevel
-	if err != nil {
-		envoyLogLevel = LogLevelTrace
-	} else {
-		envoyLogLevel = LogLevel(binary.LittleEndian.Uint32(value))
-	}
-	if level < envoyLogLevel {
+	if !l.enabled(level) || !l.sample(level) {
 		return
 	}
-	requestIDRaw, _ := proxywasm.GetProperty([]string{"x_request_id"})
-	requestID := string(requestIDRaw)
-	if requestID == "" {
-		requestID = "nil"
+	if log.GetFormat() == log.JSONFormat {
+		emitLog(level, l.jsonEntry(level, fmt.Sprintf(format, args...)))
+		return
 	}
-	format = fmt.Sprintf("[%s] [%s] [%s] %s", l.pluginName, l.pluginID, requestID, format)
+	format = fmt.Sprintf("[%s] [%s] [%s] %s", l.pluginName, l.pluginID, requestIDForLog(), format) +
+		strings.ReplaceAll(log.FormatFields(l.fields), "%", "%%")
 	switch level {
 	case LogLevelTrace:
 		proxywasm.LogTracef(format, args...)
@@ -103,6 +127,49 @@ func (l *DefaultLog) logFormat(level LogLevel, format string, args ...interface{
 	}
 }
 
+// jsonEntry returns the JSON log of the message, the fields of the log follow the fixed fields in order
+func (l *DefaultLog) jsonEntry(level LogLevel, msg string) string {
+	fields := []log.Field{
+		{Key: "level", Value: logLevelNames[level]},
+		{Key: "plugin", Value: l.pluginName},
+		{Key: "plugin_id", Value: l.pluginID},
+		{Key: "request_id", Value: requestIDForLog()},
+	}
+	if route, err := proxywasm.GetProperty([]string{"route_name"}); err == nil && len(route) > 0 {
+		fields = append(fields, log.Field{Key: "route", Value: string(route)})
+	}
+	fields = append(fields, log.Field{Key: "msg", Value: msg})
+	fields = append(fields, l.fields...)
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		b.Write(key)
+		b.WriteByte(':')
+		value := field.Value
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			raw, _ = json.Marshal(fmt.Sprint(value))
+		}
+		b.Write(raw)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// WithFields returns a copy of the log adding the fields to every log, see log.With
+func (l *DefaultLog) WithFields(fields ...log.Field) log.Log {
+	withFields := *l
+	withFields.fields = append(append([]log.Field{}, l.fields...), fields...)
+	return &withFields
+}
+
 func (l *DefaultLog) Trace(msg string) {
 	l.log(LogLevelTrace, msg)
 }
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+func TestDefaultLogFormats(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.NoError(t, proxywasm.SetProperty([]string{"x_request_id"}, []byte("req-1")))
+
+	logger := &DefaultLog{pluginName: "test-plugin", pluginID: "nil"}
+	log.SetPluginLog(logger)
+	defer log.SetPluginLog(nil)
+
+	log.Infof("hello %s", "world")
+	log.With("consumer", "alice", "ratio", "50%").Warnf("rejected %d%%", 3)
+
+	log.SetFormat(log.JSONFormat)
+	defer log.SetFormat(log.TextFormat)
+	log.Infof("hello %s", "world")
+	require.NoError(t, proxywasm.SetProperty([]string{"route_name"}, []byte("route-a")))
+	log.With("consumer", "alice", "tokens", map[string]int{"input": 3}, "err", errors.New("boom"), "odd").Error("failed")
+
+	assert.Equal(t, []string{
+		"[test-plugin] [nil] [req-1] hello world",
+		`{"level":"info","plugin":"test-plugin","plugin_id":"nil","request_id":"req-1","msg":"hello world"}`,
+	}, host.GetInfoLogs())
+	assert.Equal(t, []string{"[test-plugin] [nil] [req-1] rejected 3% consumer=alice ratio=50%"}, host.GetWarnLogs())
+	assert.Equal(t, []string{
+		`{"level":"error","plugin":"test-plugin","plugin_id":"nil","request_id":"req-1","route":"route-a","msg":"failed","consumer":"alice","tokens":{"input":3},"err":"boom","odd":null}`,
+	}, host.GetErrorLogs())
+}
+
+func TestDefaultLogSampling(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+
+	logger := &DefaultLog{pluginName: "test-plugin", pluginID: "nil"}
+	logger.setSampling(LogSampling{Level: LogLevelDebug, Every: 3})
+	withFields := logger.WithFields(log.Field{Key: "k", Value: "v"})
+	for i := 0; i < 7; i++ {
+		withFields.Debugf("line %d", i)
+	}
+	logger.Info("info is not sampled")
+
+	assert.Equal(t, []string{
+		"[test-plugin] [nil] [nil] line 0 k=v",
+		"[test-plugin] [nil] [nil] 2 debug lines dropped by log sampling",
+		"[test-plugin] [nil] [nil] line 3 k=v",
+		"[test-plugin] [nil] [nil] 2 debug lines dropped by log sampling",
+		"[test-plugin] [nil] [nil] line 6 k=v",
+	}, host.GetDebugLogs())
+	assert.Equal(t, []string{"[test-plugin] [nil] [nil] info is not sampled"}, host.GetInfoLogs())
+	assert.Equal(t, uint64(4), logger.DroppedLines(LogLevelDebug))
+	assert.Equal(t, uint64(0), logger.DroppedLines(LogLevelInfo))
+	dropped, err := host.GetCounterMetric("log.test-plugin.debug.dropped")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), dropped)
+}
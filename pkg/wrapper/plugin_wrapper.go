@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
 	"os"
 	"runtime"
@@ -69,6 +70,7 @@ type onHttpHeadersFunc[PluginConfig any] func(context HttpContext, config Plugin
 type onHttpBodyFunc[PluginConfig any] func(context HttpContext, config PluginConfig, body []byte) types.Action
 type onHttpStreamingBodyFunc[PluginConfig any] func(context HttpContext, config PluginConfig, chunk []byte, isLastChunk bool) []byte
 type onHttpStreamDoneFunc[PluginConfig any] func(context HttpContext, config PluginConfig)
+type onHttpInformationalHeadersFunc[PluginConfig any] func(context HttpContext, config PluginConfig, statusCode int)
 
 type onPluginStartOrReload func(context PluginContext) error
 
@@ -88,10 +90,32 @@ type CommonVmCtx[PluginConfig any] struct {
 	onHttpResponseBody          onHttpBodyFunc[PluginConfig]
 	onHttpStreamingResponseBody onHttpStreamingBodyFunc[PluginConfig]
 	onHttpStreamDone            onHttpStreamDoneFunc[PluginConfig]
+	onHttpInformationalHeaders  onHttpInformationalHeadersFunc[PluginConfig]
+	responseBodyObservers       []ResponseBodyObserver
+	requestHeaderSnapshot       []string
+	responseHeaderSnapshot      []string
 	rebuildAfterRequests        uint64 // Number of requests after which to trigger rebuild
 	requestCount                uint64 // Current request count
 	rebuildMaxMem               uint64 // Maximum memory size in bytes before triggering rebuild
 	maxRequestsPerIoCycle       uint64 // Maximum concurrent requests per IO cycle (0 means not set)
+	featureFlagNamespace        string // Route metadata namespace of feature flags (empty means DefaultFeatureFlagNamespace)
+	mergeRuleConfig             bool   // Parse rule configs merged onto the global config, see WithMergedRuleConfig
+	requestTimings              bool   // Record the timings of requests, see WithRequestTimings
+	timingExport                TimingExport
+	trafficAccounting           bool            // Count the bytes of requests, see WithTrafficAccounting
+	trafficStats                *trafficStats   // Counters of the bytes of the requests, defined on first use
+	basicTelemetry              bool            // Record the sizes and latencies of requests, see EnableBasicTelemetry
+	telemetryStats              *telemetryStats // Histograms of the requests, defined on first use
+	onConfigUpdate              onConfigUpdateFunc[PluginConfig]
+	lastConfigs                 map[string]*PluginConfig // Global config of the last start of every plugin by plugin id, see OnConfigUpdate
+	onPluginWarmup              onPluginWarmupFunc[PluginConfig]
+	failurePolicy               *FailurePolicy           // Default policy of failed dependencies, see WithFailurePolicy
+	featureFailurePolicies      map[string]FailurePolicy // Policies of failed dependencies by name
+	onWebSocketFrame            onWebSocketFrameFunc[PluginConfig]
+	autoDecompressResponse      bool
+	maxDecompressedSize         int                   // Size of the largest decompressed response body, see WithMaxDecompressedSize
+	requestClassifier           *RequestClassifier    // Classifier tagging every request, see WithRequestClassifier
+	skippedRequestClasses       map[RequestClass]bool // Classes of the requests the plugin is skipped for
 }
 
 type TickFuncEntry struct {
@@ -102,6 +126,10 @@ type TickFuncEntry struct {
 
 var globalOnTickFuncs []TickFuncEntry = []TickFuncEntry{}
 
+// activeHttpContextID is the HTTP context being processed, HTTP and Redis callouts restore it in
+// their callbacks, so that the callbacks are handled for their request. Tick functions run with none.
+var activeHttpContextID uint32
+
 // Register multiple onTick functions. Parameters include:
 // 1) tickPeriod: the execution period of tickFunc, this value should be a multiple of 100
 // 2) tickFunc: the function to be executed
@@ -325,6 +353,21 @@ func ProcessResponseHeaders[PluginConfig any](f onHttpHeadersFunc[PluginConfig])
 	return &onProcessResponseHeadersOption[PluginConfig]{f: f}
 }
 
+type onProcessInformationalResponseHeadersOption[PluginConfig any] struct {
+	f onHttpInformationalHeadersFunc[PluginConfig]
+}
+
+func (o *onProcessInformationalResponseHeadersOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.onHttpInformationalHeaders = o.f
+}
+
+// ProcessInformationalResponseHeaders registers a handler for 1xx informational response headers
+// (e.g. 100 Continue, 103 Early Hints). Informational headers are never passed to the
+// ProcessResponseHeaders handler, which only sees the final response.
+func ProcessInformationalResponseHeaders[PluginConfig any](f onHttpInformationalHeadersFunc[PluginConfig]) CtxOption[PluginConfig] {
+	return &onProcessInformationalResponseHeadersOption[PluginConfig]{f: f}
+}
+
 type onProcessResponseBodyOption[PluginConfig any] struct {
 	f    onHttpBodyFunc[PluginConfig]
 	oldF oldOnHttpBodyFunc[PluginConfig]
@@ -432,6 +475,28 @@ func EnableSafeLog[PluginConfig any]() CtxOption[PluginConfig] {
 	return &safeLogOption[PluginConfig]{}
 }
 
+type logRedactionOption[PluginConfig any] struct {
+	redaction log.Redaction
+}
+
+func (o *logRedactionOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	log.SetRedaction(&o.redaction)
+}
+
+// WithLogRedaction masks sensitive values in the logs of HTTP and route calls and in the user attributes
+// written to the access log. EnableSafeLog still downgrades the call logs to Debug level:
+//
+//	wrapper.WithLogRedaction[PluginConfig](log.Redaction{
+//		Headers:   []string{"authorization", "x-api-key"},
+//		BodyPaths: []string{"api_key", "messages.#.content"},
+//		Patterns:  []*regexp.Regexp{regexp.MustCompile(`sk-[A-Za-z0-9]{20,}`)},
+//	})
+//
+// Masked values keep their first characters, e.g. "sk-***". Use log.NewRedaction to build it from the plugin config.
+func WithLogRedaction[PluginConfig any](redaction log.Redaction) CtxOption[PluginConfig] {
+	return &logRedactionOption[PluginConfig]{redaction: redaction}
+}
+
 type rebuildOption[PluginConfig any] struct {
 	rebuildAfterRequests uint64
 }
@@ -520,7 +585,7 @@ func parseEmptyPluginConfig[PluginConfig any](PluginContext, []byte, *PluginConf
 }
 
 func NewCommonVmCtx[PluginConfig any](pluginName string, options ...CtxOption[PluginConfig]) *CommonVmCtx[PluginConfig] {
-	logger := &DefaultLog{pluginName, "nil"}
+	logger := &DefaultLog{pluginName: pluginName, pluginID: "nil"}
 	opts := []CtxOption[PluginConfig]{WithLogger[PluginConfig](logger)}
 	for _, opt := range options {
 		if opt == nil {
@@ -568,6 +633,10 @@ type CommonPluginCtx[PluginConfig any] struct {
 	fingerPrint        string
 	ruleLevelIsolation bool
 	isLeader           bool
+	warmup             pluginWarmup
+	// Id of the plugin in the configuration, the plugin contexts of successive configurations of a plugin
+	// share it
+	pluginID string
 }
 
 type Lease struct {
@@ -691,6 +760,7 @@ func (ctx *CommonPluginCtx[PluginConfig]) OnPluginStart(int) types.OnPluginStart
 			return types.OnPluginStartStatusFailed
 		}
 		pluginID := gjson.GetBytes(data, PluginIDKey).String()
+		ctx.pluginID = pluginID
 		if pluginID != "" {
 			ctx.vm.log.ResetID(pluginID)
 			data, _ = sjson.DeleteBytes([]byte(data), PluginIDKey)
@@ -703,6 +773,20 @@ func (ctx *CommonPluginCtx[PluginConfig]) OnPluginStart(int) types.OnPluginStart
 			return ctx.vm.parseRuleConfig(ctx, []byte(js.Raw), global, cfg)
 		}
 	}
+	if ctx.vm.mergeRuleConfig {
+		globalConfig, _ := sjson.Delete(jsonData.Raw, matcher.RULES_KEY)
+		parseRuleConfig := parseOverrideConfig
+		parseOverrideConfig = func(js gjson.Result, global PluginConfig, cfg *PluginConfig) error {
+			merged, err := MergeConfigJSON([]byte(globalConfig), []byte(js.Raw))
+			if err != nil {
+				return err
+			}
+			if parseRuleConfig != nil {
+				return parseRuleConfig(gjson.ParseBytes(merged), global, cfg)
+			}
+			return ctx.vm.parseConfig(ctx, merged, cfg)
+		}
+	}
 	err = ctx.ParseRuleConfig(ctx, jsonData,
 		func(js gjson.Result, cfg *PluginConfig) error {
 			return ctx.vm.parseConfig(ctx, []byte(js.Raw), cfg)
@@ -714,6 +798,12 @@ func (ctx *CommonPluginCtx[PluginConfig]) OnPluginStart(int) types.OnPluginStart
 		log.Error("plugin start failed")
 		return types.OnPluginStartStatusFailed
 	}
+	if err := ctx.notifyConfigUpdate(); err != nil {
+		log.Errorf("config update hook failed: %v", err)
+		log.Error("plugin start failed")
+		return types.OnPluginStartStatusFailed
+	}
+	ctx.startWarmup()
 	if globalOnTickFuncs != nil {
 		ctx.onTickFuncs = globalOnTickFuncs
 		if err := proxywasm.SetTickPeriodMilliSeconds(100); err != nil {
@@ -727,6 +817,10 @@ func (ctx *CommonPluginCtx[PluginConfig]) OnPluginStart(int) types.OnPluginStart
 }
 
 func (ctx *CommonPluginCtx[PluginConfig]) OnTick() {
+	// Tick functions do not run on behalf of a request, the last request processed must not be charged
+	// for their callouts
+	activeHttpContextID = 0
+	cancelExpiredCallouts()
 	for i := range ctx.onTickFuncs {
 		currentTimeStamp := time.Now().UnixMilli()
 		if currentTimeStamp-ctx.onTickFuncs[i].lastExecuted >= ctx.onTickFuncs[i].tickPeriod {
@@ -736,6 +830,36 @@ func (ctx *CommonPluginCtx[PluginConfig]) OnTick() {
 	}
 }
 
+// RunInContext runs f in the context of the request of ctx, so that a tick function can use the host
+// calls of a request, e.g. to inject data into its response, then sets the previous context back. It
+// fails when the host does not know the request anymore.
+func RunInContext(ctx HttpContext, f func()) error {
+	request, ok := ctx.(interface{ httpContextID() uint32 })
+	if !ok {
+		return errors.New("not an http context of the wrapper")
+	}
+	contextID := request.httpContextID()
+	if err := proxywasm.SetEffectiveContext(contextID); err != nil {
+		return err
+	}
+	previous := activeHttpContextID
+	activeHttpContextID = contextID
+	defer func() {
+		if previous != 0 && previous != contextID {
+			if err := proxywasm.SetEffectiveContext(previous); err != nil {
+				log.Debugf("failed to restore context %d: %v", previous, err)
+			}
+		}
+		activeHttpContextID = previous
+	}()
+	f()
+	return nil
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) httpContextID() uint32 {
+	return ctx.contextID
+}
+
 func (ctx *CommonPluginCtx[PluginConfig]) NewHttpContext(contextID uint32) types.HttpContext {
 	httpCtx := &CommonHttpCtx[PluginConfig]{
 		plugin:        ctx,
@@ -746,7 +870,7 @@ func (ctx *CommonPluginCtx[PluginConfig]) NewHttpContext(contextID uint32) types
 	if ctx.vm.onHttpRequestBody != nil || ctx.vm.onHttpStreamingRequestBody != nil {
 		httpCtx.needRequestBody = true
 	}
-	if ctx.vm.onHttpResponseBody != nil || ctx.vm.onHttpStreamingResponseBody != nil {
+	if ctx.vm.onHttpResponseBody != nil || ctx.vm.onHttpStreamingResponseBody != nil || len(ctx.vm.responseBodyObservers) > 0 {
 		httpCtx.needResponseBody = true
 	}
 	if ctx.vm.onHttpStreamingRequestBody != nil {
@@ -755,6 +879,17 @@ func (ctx *CommonPluginCtx[PluginConfig]) NewHttpContext(contextID uint32) types
 	if ctx.vm.onHttpStreamingResponseBody != nil {
 		httpCtx.streamingResponseBody = true
 	}
+	if ctx.vm.requestTimings {
+		httpCtx.timings = &requestTimings{export: ctx.vm.timingExport, setAttribute: httpCtx.SetUserAttribute}
+		timedRequests[contextID] = httpCtx.timings
+	}
+	if ctx.vm.trafficAccounting || ctx.vm.basicTelemetry {
+		httpCtx.traffic = newTrafficAccounting()
+	}
+	if ctx.vm.basicTelemetry {
+		httpCtx.telemetry = &requestTelemetry{}
+		telemetryRequests[contextID] = httpCtx.telemetry
+	}
 	return httpCtx
 }
 
@@ -790,6 +925,27 @@ type CommonHttpCtx[PluginConfig any] struct {
 	// Cached response headers from the header phase
 	responseContentType     string
 	responseContentEncoding string
+	// Feature flags of the matched route, created on first use
+	featureFlags *routeFlagSet
+	// Timings of the request, nil unless WithRequestTimings is used
+	timings *requestTimings
+	// Bytes of the request and its response, nil unless WithTrafficAccounting or EnableBasicTelemetry is used
+	traffic *trafficAccounting
+	// Latencies of the request, nil unless EnableBasicTelemetry is used
+	telemetry *requestTelemetry
+	// Trace context of the request and the attributes and events of its span
+	trace requestTrace
+	// Frames of an upgraded WebSocket connection, nil unless ProcessWebSocketFrame is used
+	websocket *webSocketStream
+	// Set by EnableAutoDecompressResponse, decompressResponse is the encoding the body is decompressed from
+	autoDecompressResponse bool
+	decompressResponse     string
+	// Consumer of the request, read from the x-mse-consumer header on first use unless set by SetConsumer
+	consumer       *Consumer
+	consumerLoaded bool
+	// TLS details of the downstream connection, read on first use
+	downstreamTLS       *DownstreamTLS
+	downstreamTLSLoaded bool
 }
 
 func (ctx *CommonHttpCtx[PluginConfig]) GetExecutionPhase() iface.HTTPExecutionPhase {
@@ -843,6 +999,7 @@ func (ctx *CommonHttpCtx[PluginConfig]) WriteUserAttributeToLogWithKey(key strin
 	}
 	// e.g. {"field1":"value1","field2":2,"field3":"value3"}
 	jsonStr, _ := json.Marshal(newAttributeMap)
+	jsonStr = log.RedactBody(jsonStr)
 	// e.g. {\"field1\":\"value1\",\"field2\":2,\"field3\":\"value3\"}
 	marshalledJsonStr := MarshalStr(string(jsonStr))
 	if err := proxywasm.SetProperty([]string{key}, []byte(marshalledJsonStr)); err != nil {
@@ -854,18 +1011,9 @@ func (ctx *CommonHttpCtx[PluginConfig]) WriteUserAttributeToLogWithKey(key strin
 
 func (ctx *CommonHttpCtx[PluginConfig]) WriteUserAttributeToTrace() error {
 	for k, v := range ctx.userAttribute {
-		traceSpanTag := TraceSpanTagPrefix + k
-		traceSpanValue := fmt.Sprint(v)
-		var err error
-		if traceSpanValue != "" {
-			err = proxywasm.SetProperty([]string{traceSpanTag}, []byte(traceSpanValue))
-		} else {
-			err = fmt.Errorf("value of %s is empty", traceSpanTag)
-		}
-		if err != nil {
-			ctx.plugin.vm.log.Warnf("Failed to set trace attribute - %s: %s, error message: %v", traceSpanTag, traceSpanValue, err)
-		}
+		ctx.setSpanTag(k, fmt.Sprint(v))
 	}
+	ctx.writeSpanToTrace()
 	return nil
 }
 
@@ -1009,14 +1157,37 @@ func (ctx *CommonHttpCtx[PluginConfig]) IsBinaryResponseBody() bool {
 		strings.Contains(ctx.responseContentType, "grpc") {
 		return true
 	}
-	return ctx.responseContentEncoding != ""
+	return ctx.responseContentEncoding != "" && ctx.responseDecoding() == ""
+}
+
+// FeatureFlags returns the feature flags configured in the metadata of the matched route.
+// They are read on first use and cached for the lifetime of the request.
+func (ctx *CommonHttpCtx[PluginConfig]) FeatureFlags() iface.FlagSet {
+	if ctx.featureFlags == nil {
+		ctx.featureFlags = newRouteFlagSet(ctx.plugin.vm.featureFlagNamespace)
+	}
+	return ctx.featureFlags
 }
 
-func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestHeaders(numHeaders int, endOfStream bool) types.Action {
+// EffectiveConfig returns the config the handlers of the request are called with, nil before the
+// config is matched.
+func (ctx *CommonHttpCtx[PluginConfig]) EffectiveConfig() any {
+	if ctx.config == nil {
+		return nil
+	}
+	return *ctx.config
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestHeaders(numHeaders int, endOfStream bool) (action types.Action) {
 	defer recoverFunc()
+	activeHttpContextID = ctx.contextID
+	defer ctx.startTiming(TimingRequestHeaders)()
+	telemetryDone := ctx.startTelemetry(true, true)
+	defer func() { telemetryDone(action, endOfStream) }()
 	ctx.executionPhase = iface.DecodeHeader
 	// Track if endOfStream was received in the header phase
 	ctx.requestHeaderEndOfStream = endOfStream
+	ctx.countRequestHeadersIn()
 
 	// Cache request pseudo-headers for later access outside of header phase
 	ctx.scheme, _ = proxywasm.GetHttpRequestHeader(":scheme")
@@ -1029,6 +1200,8 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestHeaders(numHeaders int, end
 	ctx.requestUpgrade, _ = proxywasm.GetHttpRequestHeader("upgrade")
 	ctx.requestContentType, _ = proxywasm.GetHttpRequestHeader("content-type")
 	ctx.requestContentEncoding, _ = proxywasm.GetHttpRequestHeader("content-encoding")
+	ctx.snapshotRequestHeaders()
+	ctx.startTrace()
 
 	requestID, _ := proxywasm.GetHttpRequestHeader("x-request-id")
 	_ = proxywasm.SetProperty([]string{"x_request_id"}, []byte(requestID))
@@ -1063,9 +1236,17 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestHeaders(numHeaders int, end
 		}
 	}
 
+	// Probes and other requests of the skipped classes are left alone before the config is matched
+	if ctx.classifyRequest() {
+		return types.ActionContinue
+	}
+
 	config, err := ctx.plugin.GetMatchConfig()
 	if err != nil {
 		ctx.plugin.vm.log.Errorf("get match config failed, err:%v", err)
+		if ctx.applyFailurePolicy(FailureConfig, ctx.failurePolicy(FailureConfig, false)) {
+			return types.ActionPause
+		}
 		return types.ActionContinue
 	}
 	if config == nil {
@@ -1079,6 +1260,18 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestHeaders(numHeaders int, end
 	if ctx.IsWebsocket() {
 		ctx.needRequestBody = false
 		ctx.needResponseBody = false
+		if ctx.plugin.vm.onWebSocketFrame != nil {
+			ctx.websocket = &webSocketStream{}
+		}
+	}
+	if ctx.plugin.vm.failurePolicy != nil {
+		failingRequests[ctx.contextID] = ctx
+		if !ctx.plugin.IsWarmedUp() && ctx.HandleFailure(FailureWarmup, errNotWarmedUp) == FailClosed {
+			return types.ActionPause
+		}
+	}
+	if ctx.plugin.vm.autoDecompressResponse {
+		ctx.EnableAutoDecompressResponse()
 	}
 	if ctx.plugin.vm.onHttpRequestHeaders == nil {
 		return types.ActionContinue
@@ -1086,12 +1279,20 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestHeaders(numHeaders int, end
 	return ctx.plugin.vm.onHttpRequestHeaders(ctx, *config)
 }
 
-func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestBody(bodySize int, endOfStream bool) types.Action {
+func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestBody(bodySize int, endOfStream bool) (action types.Action) {
 	defer recoverFunc()
+	activeHttpContextID = ctx.contextID
+	defer ctx.startTiming(TimingRequestBody)()
+	telemetryDone := ctx.startTelemetry(true, false)
+	defer func() { telemetryDone(action, endOfStream) }()
+	defer ctx.countRequestBody(bodySize, &action)
 	ctx.executionPhase = iface.DecodeData
 	if ctx.config == nil {
 		return types.ActionContinue
 	}
+	if ctx.websocket != nil {
+		return ctx.onWebSocketData(true, bodySize, endOfStream)
+	}
 	if !ctx.needRequestBody {
 		return types.ActionContinue
 	}
@@ -1103,6 +1304,7 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestBody(bodySize int, endOfStr
 			ctx.plugin.vm.log.Warnf("replace request body chunk failed: %v", err)
 			return types.ActionContinue
 		}
+		ctx.countReplacedRequestChunk(len(modifiedChunk))
 		return types.ActionContinue
 	}
 	if ctx.plugin.vm.onHttpRequestBody != nil {
@@ -1120,15 +1322,33 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpRequestBody(bodySize int, endOfStr
 	return types.ActionContinue
 }
 
-func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseHeaders(numHeaders int, endOfStream bool) types.Action {
+func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseHeaders(numHeaders int, endOfStream bool) (action types.Action) {
 	defer recoverFunc()
+	activeHttpContextID = ctx.contextID
+	defer ctx.startTiming(TimingResponseHeaders)()
+	telemetryDone := ctx.startTelemetry(false, true)
+	defer func() { telemetryDone(action, endOfStream) }()
+	// Informational responses precede the final response headers, so they must not be
+	// mistaken for them by the plugin or change the cached response state
+	if status, err := proxywasm.GetHttpResponseHeader(":status"); err == nil {
+		if statusCode, err := strconv.Atoi(status); err == nil && IsInformationalStatus(statusCode) {
+			if ctx.config != nil && ctx.plugin.vm.onHttpInformationalHeaders != nil {
+				ctx.plugin.vm.onHttpInformationalHeaders(ctx, *ctx.config, statusCode)
+			}
+			return types.ActionContinue
+		}
+	}
 	ctx.executionPhase = iface.EncodeHeader
 	// Track if endOfStream was received in the header phase
 	ctx.responseHeaderEndOfStream = endOfStream
+	ctx.countRequestHeadersOut()
+	ctx.countResponseHeadersIn()
+	ctx.telemetryResponseHeaders()
 
 	// Cache response headers for later access outside of header phase
 	ctx.responseContentType, _ = proxywasm.GetHttpResponseHeader("content-type")
 	ctx.responseContentEncoding, _ = proxywasm.GetHttpResponseHeader("content-encoding")
+	ctx.snapshotResponseHeaders()
 
 	if ctx.config == nil {
 		return types.ActionContinue
@@ -1152,17 +1372,32 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseHeaders(numHeaders int, en
 		return types.HeaderStopIteration
 	}
 	if ctx.plugin.vm.onHttpResponseHeaders == nil {
+		if ctx.prepareResponseDecompression() {
+			return types.HeaderStopIteration
+		}
 		return types.ActionContinue
 	}
-	return ctx.plugin.vm.onHttpResponseHeaders(ctx, *ctx.config)
+	action = ctx.plugin.vm.onHttpResponseHeaders(ctx, *ctx.config)
+	if ctx.prepareResponseDecompression() && action == types.ActionContinue {
+		return types.HeaderStopIteration
+	}
+	return action
 }
 
-func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseBody(bodySize int, endOfStream bool) types.Action {
+func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseBody(bodySize int, endOfStream bool) (action types.Action) {
 	defer recoverFunc()
+	activeHttpContextID = ctx.contextID
+	defer ctx.startTiming(TimingResponseBody)()
+	telemetryDone := ctx.startTelemetry(false, false)
+	defer func() { telemetryDone(action, endOfStream) }()
+	defer ctx.countResponseBody(bodySize, &action)
 	ctx.executionPhase = iface.EncodeData
 	if ctx.config == nil {
 		return types.ActionContinue
 	}
+	if ctx.websocket != nil {
+		return ctx.onWebSocketData(false, bodySize, endOfStream)
+	}
 	if !ctx.needResponseBody {
 		return types.ActionContinue
 	}
@@ -1185,6 +1420,7 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseBody(bodySize int, endOfSt
 		ctx.responseCallback(statusCode, headers, body)
 		return types.ActionContinue
 	}
+	ctx.observeResponseBody(bodySize, endOfStream)
 	if ctx.plugin.vm.onHttpStreamingResponseBody != nil && ctx.streamingResponseBody {
 		chunk, _ := proxywasm.GetHttpResponseBody(0, bodySize)
 		modifiedChunk := ctx.plugin.vm.onHttpStreamingResponseBody(ctx, *ctx.config, chunk, endOfStream)
@@ -1193,6 +1429,7 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseBody(bodySize int, endOfSt
 			ctx.plugin.vm.log.Warnf("replace response body chunk failed: %v", err)
 			return types.ActionContinue
 		}
+		ctx.countReplacedResponseChunk(len(modifiedChunk))
 		if ctx.pauseStreamingResponse {
 			return types.DataStopIterationNoBuffer
 		}
@@ -1207,6 +1444,12 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseBody(bodySize int, endOfSt
 			ctx.plugin.vm.log.Warnf("get response body failed: %v", err)
 			return types.ActionContinue
 		}
+		if ctx.decompressResponse != "" {
+			if body, err = ctx.decompressResponseBody(body); err != nil {
+				ctx.plugin.vm.log.Warnf("decompress %s response body failed: %v", ctx.decompressResponse, err)
+				return types.ActionContinue
+			}
+		}
 		return ctx.plugin.vm.onHttpResponseBody(ctx, *ctx.config, body)
 	}
 	return types.ActionContinue
@@ -1215,9 +1458,21 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpResponseBody(bodySize int, endOfSt
 func (ctx *CommonHttpCtx[PluginConfig]) OnHttpStreamDone() {
 	ctx.executionPhase = iface.Done
 	defer recoverFunc()
+	activeHttpContextID = ctx.contextID
+	defer ctx.finishTimings()
+	defer delete(tracedRequests, ctx.contextID)
+	defer delete(limitedRequests, ctx.contextID)
+	defer delete(failingRequests, ctx.contextID)
+	ctx.finishTraffic()
+	ctx.finishTelemetry()
 	if ctx.config == nil {
 		return
 	}
+	for _, observer := range ctx.plugin.vm.responseBodyObservers {
+		if observer.OnDone != nil {
+			observer.OnDone(ctx)
+		}
+	}
 	if ctx.plugin.vm.onHttpStreamDone == nil {
 		return
 	}
@@ -1225,13 +1480,26 @@ func (ctx *CommonHttpCtx[PluginConfig]) OnHttpStreamDone() {
 }
 
 // This RouteCall must only be invoked during the request body phase, and it requires that stopIteration has been returned during the request header phase.
+// It fails with ErrPauseNotAllowed once the response is being processed. It counts against the limits set with LimitCallouts,
+// the upstream timeout of the route is cut to their remaining duration.
 func (ctx *CommonHttpCtx[PluginConfig]) RouteCall(method, rawURL string, headers [][2]string, body []byte, callback iface.RouteResponseCallback) error {
+	if ctx.executionPhase > iface.DecodeData {
+		return fmt.Errorf("%w: route call after the request phases", ErrPauseNotAllowed)
+	}
+	// The request goes upstream, it cannot be cancelled and ends with the upstream timeout
+	timeout, _, err := chargeCallout(math.MaxUint32, nil)
+	if err != nil {
+		return err
+	}
+	if timeout < math.MaxUint32 {
+		proxywasm.ReplaceHttpRequestHeader("x-envoy-upstream-rq-timeout-ms", strconv.FormatUint(uint64(timeout), 10))
+	}
 	proxywasm.RemoveHttpRequestHeader("Accept-Encoding")
 	proxywasm.RemoveHttpRequestHeader("Content-Length")
-	requestID := uuid.New().String()
+	requestID := calloutID(headers)
 	ctx.responseCallback = func(statusCode int, responseHeaders [][2]string, responseBody []byte) {
 		callback(statusCode, responseHeaders, responseBody)
-		log.UnsafeInfof("route call end, id:%s, code:%d, headers:%#v, body:%s", requestID, statusCode, responseHeaders, strings.ReplaceAll(string(responseBody), "\n", `\n`))
+		log.UnsafeInfof("route call end, id:%s, code:%d, headers:%#v, body:%s", requestID, statusCode, log.RedactHeaders(responseHeaders), strings.ReplaceAll(string(log.RedactBody(responseBody)), "\n", `\n`))
 	}
 	originalMethod, _ := proxywasm.GetHttpRequestHeader(":method")
 	originalPath, _ := proxywasm.GetHttpRequestHeader(":path")
@@ -1266,7 +1534,7 @@ func (ctx *CommonHttpCtx[PluginConfig]) RouteCall(method, rawURL string, headers
 	proxywasm.ReplaceHttpRequestBody(body)
 	reqHeaders, _ := proxywasm.GetHttpRequestHeaders()
 	clusterName, _ := proxywasm.GetProperty([]string{"cluster_name"})
-	log.UnsafeInfof("route call start, id:%s, method:%s, url:%s, cluster:%s, headers:%#v, body:%s", requestID, method, rawURL, clusterName, reqHeaders, strings.ReplaceAll(string(body), "\n", `\n`))
+	log.UnsafeInfof("route call start, id:%s, method:%s, url:%s, cluster:%s, headers:%#v, body:%s", requestID, method, rawURL, clusterName, log.RedactHeaders(reqHeaders), strings.ReplaceAll(string(log.RedactBody(body)), "\n", `\n`))
 	return nil
 }
 
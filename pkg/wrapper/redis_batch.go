@@ -0,0 +1,146 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+
+	"github.com/tidwall/resp"
+)
+
+var errRedisTxAborted = errors.New("EXECABORT Transaction discarded")
+
+// RedisBatcher is implemented by the Redis clients that can send several commands with a single callout,
+// like RedisClusterClient. It is not part of RedisClient so that other implementations keep compiling,
+// check for it with a type assertion:
+//
+//	if batcher, ok := client.(wrapper.RedisBatcher); ok {
+//	    batch := batcher.Pipeline()
+//	    ...
+//	}
+type RedisBatcher interface {
+	// Pipeline starts a batch whose commands are sent back to back, each one runs on its own
+	Pipeline() *RedisBatch
+	// Tx starts a batch whose commands run atomically in a MULTI/EXEC transaction
+	Tx() *RedisBatch
+}
+
+// RedisBatch sends several commands with a single Redis callout, see RedisBatcher. All commands go to the
+// shard of the first key of the batch, so when the keys are sharded they must share a {hash tag}, and
+// the Redis upstream must pass the commands of a query through to a single server, a proxy that does not
+// support MULTI can only be used with pipelines.
+type RedisBatch struct {
+	send      func(query []byte, key []interface{}, replies int, callback func(responses []resp.Value)) error
+	tx        bool
+	commands  [][]interface{}
+	callbacks []RedisResponseCallback
+}
+
+// Command adds a command, the callback receives its reply
+func (b *RedisBatch) Command(cmds []interface{}, callback RedisResponseCallback) *RedisBatch {
+	b.commands = append(b.commands, cmds)
+	b.callbacks = append(b.callbacks, callback)
+	return b
+}
+
+// Len returns the number of commands in the batch
+func (b *RedisBatch) Len() int {
+	return len(b.commands)
+}
+
+// Exec sends the batch. If the callout fails, every callback receives its error. When a command of a
+// transaction is rejected by Redis, e.g. for a wrong number of arguments, the transaction is discarded:
+// the callback of the command receives the rejection and the others an EXECABORT error. Like in Redis,
+// a command failing while the transaction runs does not stop the others.
+func (b *RedisBatch) Exec() error {
+	if len(b.commands) == 0 {
+		return errors.New("redis batch is empty")
+	}
+	var query []byte
+	var key []interface{}
+	if b.tx {
+		query = respString([]interface{}{"multi"})
+	}
+	for _, cmds := range b.commands {
+		if len(cmds) == 0 {
+			return errors.New("redis batch contains an empty command")
+		}
+		if key == nil && len(cmds) > 1 {
+			key = cmds
+		}
+		query = append(query, respString(cmds)...)
+	}
+	callbacks := b.callbacks
+	if !b.tx {
+		return b.send(query, key, len(callbacks), func(responses []resp.Value) {
+			for i, callback := range callbacks {
+				if callback != nil {
+					callback(responses[i])
+				}
+			}
+		})
+	}
+	query = append(query, respString([]interface{}{"exec"})...)
+	return b.send(query, key, len(callbacks)+2, func(responses []resp.Value) {
+		dispatchRedisTxResponses(responses, callbacks)
+	})
+}
+
+// dispatchRedisTxResponses passes the replies of a transaction to the callbacks of its commands, the
+// responses are the reply to MULTI, the replies to the queued commands and the reply to EXEC
+func dispatchRedisTxResponses(responses []resp.Value, callbacks []RedisResponseCallback) {
+	queued := responses[1 : len(responses)-1]
+	exec := responses[len(responses)-1]
+	replies := exec.Array()
+	for i, callback := range callbacks {
+		if callback == nil {
+			continue
+		}
+		switch {
+		case responses[0].Error() != nil:
+			callback(responses[0])
+		case queued[i].Error() != nil:
+			callback(queued[i])
+		case exec.Error() != nil:
+			callback(exec)
+		case exec.Type() == resp.Array && i < len(replies):
+			callback(replies[i])
+		default:
+			callback(resp.ErrorValue(errRedisTxAborted))
+		}
+	}
+}
+
+func (c *RedisClusterClient[C]) sendBatch(query []byte, key []interface{}, replies int, callback func(responses []resp.Value)) error {
+	if err := c.checkReadyFunc(); err != nil {
+		return err
+	}
+	primary := Cluster(c.cluster)
+	if key != nil {
+		// Batches may write, they are never sent to a replica
+		primary, _ = c.route(key)
+	}
+	return redisQueryInternal(primary, query, replies, callback, &c.ready, c.checkReadyFunc)
+}
+
+// Pipeline implements RedisBatcher
+func (c *RedisClusterClient[C]) Pipeline() *RedisBatch {
+	return &RedisBatch{send: c.sendBatch}
+}
+
+// Tx implements RedisBatcher
+func (c *RedisClusterClient[C]) Tx() *RedisBatch {
+	return &RedisBatch{send: c.sendBatch, tx: true}
+}
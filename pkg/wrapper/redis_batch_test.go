@@ -0,0 +1,135 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/resp"
+)
+
+func TestRedisBatch(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("redis-batch-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	var client RedisClient = NewRedisClusterClient(FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	assert.NoError(t, client.Init("", "", 1000))
+	batcher, ok := client.(RedisBatcher)
+	assert.True(t, ok, "the cluster client sends batches")
+	queryOf := func(query []byte) [][]string {
+		var commands [][]string
+		rd := resp.NewReader(bytes.NewReader(query))
+		for {
+			value, _, err := rd.ReadValue()
+			if err != nil {
+				return commands
+			}
+			var args []string
+			for _, v := range value.Array() {
+				args = append(args, v.String())
+			}
+			commands = append(commands, args)
+		}
+	}
+	marshal := func(values ...resp.Value) []byte {
+		var response []byte
+		for _, v := range values {
+			data, _ := v.MarshalRESP()
+			response = append(response, data...)
+		}
+		return response
+	}
+
+	replies := make([]resp.Value, 3)
+	batch := batcher.Tx()
+	for i, cmds := range [][]interface{}{{"incr", "{user1}:count"}, {"hincrby", "{user1}:tokens", "total", "abc"}, {"expire", "{user1}:count", 60}} {
+		i := i
+		batch.Command(cmds, func(response resp.Value) {
+			replies[i] = response
+		})
+	}
+	assert.Equal(t, 3, batch.Len())
+	assert.NoError(t, batch.Exec())
+
+	callouts := host.GetRedisCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, [][]string{{"multi"}, {"incr", "{user1}:count"}, {"hincrby", "{user1}:tokens", "total", "abc"},
+			{"expire", "{user1}:count", "60"}, {"exec"}}, queryOf(callouts[0].Query))
+
+		// A command failing while the transaction runs does not stop the others
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, marshal(resp.SimpleStringValue("OK"),
+			resp.SimpleStringValue("QUEUED"), resp.SimpleStringValue("QUEUED"), resp.SimpleStringValue("QUEUED"),
+			resp.ArrayValue([]resp.Value{
+				resp.IntegerValue(1),
+				resp.ErrorValue(errors.New("ERR value is not an integer or out of range")),
+				resp.IntegerValue(1),
+			})))
+	}
+	assert.Equal(t, 1, replies[0].Integer())
+	assert.EqualError(t, replies[1].Error(), "ERR value is not an integer or out of range")
+	assert.Equal(t, 1, replies[2].Integer())
+
+	// A command rejected when queued discards the transaction
+	replies = make([]resp.Value, 2)
+	assert.NoError(t, batcher.Tx().
+		Command([]interface{}{"set", "{user1}:a"}, func(response resp.Value) { replies[0] = response }).
+		Command([]interface{}{"incr", "{user1}:b"}, func(response resp.Value) { replies[1] = response }).
+		Exec())
+	callouts = host.GetRedisCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, marshal(resp.SimpleStringValue("OK"),
+			resp.ErrorValue(errors.New("ERR wrong number of arguments for 'set' command")), resp.SimpleStringValue("QUEUED"),
+			resp.ErrorValue(errors.New("EXECABORT Transaction discarded because of previous errors."))))
+	}
+	assert.EqualError(t, replies[0].Error(), "ERR wrong number of arguments for 'set' command")
+	assert.ErrorContains(t, replies[1].Error(), "EXECABORT")
+
+	// Commands of a pipeline get their own replies
+	replies = make([]resp.Value, 2)
+	assert.NoError(t, batcher.Pipeline().
+		Command([]interface{}{"get", "a"}, func(response resp.Value) { replies[0] = response }).
+		Command([]interface{}{"get", "b"}, func(response resp.Value) { replies[1] = response }).
+		Exec())
+	callouts = host.GetRedisCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Equal(t, [][]string{{"get", "a"}, {"get", "b"}}, queryOf(callouts[0].Query))
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, marshal(resp.StringValue("1"), resp.NullValue()))
+	}
+	assert.Equal(t, "1", replies[0].String())
+	assert.True(t, replies[1].IsNull())
+
+	// Errors of the callout are passed to every command, and so is a truncated response
+	for _, status := range []int32{1, 0} {
+		replies = make([]resp.Value, 2)
+		assert.NoError(t, batcher.Pipeline().
+			Command([]interface{}{"get", "a"}, func(response resp.Value) { replies[0] = response }).
+			Command([]interface{}{"get", "b"}, func(response resp.Value) { replies[1] = response }).
+			Exec())
+		callouts = host.GetRedisCalloutAttributesFromContext(id)
+		if assert.Len(t, callouts, 1) {
+			host.CallOnRedisCallResponse(callouts[0].CalloutID, status, marshal(resp.StringValue("1")))
+		}
+		assert.Error(t, replies[1].Error(), status)
+	}
+	assert.Error(t, batcher.Pipeline().Exec(), "empty batch")
+}
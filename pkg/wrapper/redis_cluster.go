@@ -0,0 +1,244 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/resp"
+)
+
+// redisHashSlots is the number of hash slots of Redis Cluster
+const redisHashSlots = 16384
+
+var errRedisConnect = errors.New("cannot connect to redis cluster")
+
+// maxRedisRedirects is the number of times a command is sent again to another upstream, after a MOVED
+// redirection or when its primary cannot be reached
+const maxRedisRedirects = 2
+
+// redisReadCommands are the commands that may be served by a replica
+var redisReadCommands = map[string]bool{
+	"exists": true, "get": true, "mget": true, "strlen": true, "ttl": true, "pttl": true, "type": true,
+	"llen": true, "lindex": true, "lrange": true,
+	"hexists": true, "hlen": true, "hget": true, "hmget": true, "hkeys": true, "hvals": true, "hgetall": true,
+	"scard": true, "sismember": true, "smembers": true, "sdiff": true, "sinter": true, "sunion": true,
+	"zcard": true, "zcount": true, "zscore": true, "zrank": true, "zrevrank": true, "zrange": true, "zrevrange": true,
+}
+
+// WithRedisCluster shards the keys over several primaries: the cluster of the client is the first
+// shard, followed by the given clusters. Every command goes to the shard of the hash slot of its
+// first key, so the keys of a multi-key command, Eval or batch must share a {hash tag}. Changing the
+// shards moves most keys to another shard.
+//
+// When the upstreams are the nodes of a Redis Cluster, the slots the nodes answer with a MOVED
+// redirection for, e.g. after a failover or a resharding, are remembered and the command is sent again
+// to the upstream of the node the redirection names. The upstream is found by the host name of the node,
+// so the nodes must announce the host names of the upstreams, see cluster-announce-hostname and
+// cluster-preferred-endpoint-type. Redirections to other nodes are returned to the callback.
+func WithRedisCluster(shards ...Cluster) optionFunc {
+	return func(o *redisOption) {
+		o.shards = shards
+	}
+}
+
+// WithReadFromReplica sends read-only commands to the replicas of the primaries, given in the order
+// of the shards. When a replica cannot be reached, the command fails over to its primary. Reads from
+// a replica may return stale data.
+func WithReadFromReplica(replicas ...Cluster) optionFunc {
+	return func(o *redisOption) {
+		o.replicas = replicas
+	}
+}
+
+// upstreams returns the primaries followed by the replicas
+func (c *RedisClusterClient[C]) upstreams() []Cluster {
+	upstreams := []Cluster{c.cluster}
+	upstreams = append(upstreams, c.option.shards...)
+	return append(upstreams, c.option.replicas...)
+}
+
+// route returns the primary of the command and the replica to read from, nil for writes or
+// shards without a replica
+func (c *RedisClusterClient[C]) route(cmds []interface{}) (Cluster, Cluster) {
+	shard := 0
+	if n := len(c.option.shards) + 1; n > 1 {
+		if key, ok := redisCommandKey(cmds); ok {
+			shard = int(redisHashSlot(key)) * n / redisHashSlots
+		}
+	}
+	var primary Cluster = c.cluster
+	if shard > 0 {
+		primary = c.option.shards[shard-1]
+	}
+	if len(c.movedSlots) > 0 {
+		if key, ok := redisCommandKey(cmds); ok {
+			if moved, ok := c.movedSlots[redisHashSlot(key)]; ok {
+				// The topology of the node taking over the slot is unknown, it is read from as well
+				return moved, nil
+			}
+		}
+	}
+	if shard >= len(c.option.replicas) || !redisReadCommands[strings.ToLower(string(redisArg(cmds[0])))] {
+		return primary, nil
+	}
+	return primary, c.option.replicas[shard]
+}
+
+// call sends the command to its upstream
+func (c *RedisClusterClient[C]) call(cmds []interface{}, callback RedisResponseCallback) error {
+	primary, replica := c.route(cmds)
+	target := primary
+	if replica != nil {
+		target = replica
+	}
+	return c.send(cmds, respString(cmds), target, callback, 0)
+}
+
+// send sends the query of the command to the target, and again to another upstream when the target
+// redirects it or cannot be reached
+func (c *RedisClusterClient[C]) send(cmds []interface{}, query []byte, target Cluster, callback RedisResponseCallback, redirects int) error {
+	return redisCallInternal(target, query, func(response resp.Value) {
+		if redirects < maxRedisRedirects {
+			if next := c.redirect(cmds, target, response); next != nil {
+				if err := c.send(cmds, query, next, callback, redirects+1); err == nil {
+					return
+				}
+			}
+		}
+		if callback != nil {
+			callback(response)
+		}
+	}, &c.ready, c.checkReadyFunc)
+}
+
+// redirect returns the upstream to send a command to again after the response of the target, nil if the
+// response is final
+func (c *RedisClusterClient[C]) redirect(cmds []interface{}, target Cluster, response resp.Value) Cluster {
+	err := response.Error()
+	if err == nil {
+		return nil
+	}
+	primary, replica := c.route(cmds)
+	if err.Error() == errRedisConnect.Error() {
+		switch {
+		case replica != nil && target.ClusterName() == replica.ClusterName():
+			proxywasm.LogWarnf("redis replica %s cannot be reached, reading from primary %s", replica.ClusterName(), primary.ClusterName())
+			return primary
+		case target.ClusterName() == primary.ClusterName():
+			// The replica of the shard may have been promoted, it redirects the command otherwise
+			if replica := c.replicaOf(primary); replica != nil {
+				proxywasm.LogWarnf("redis primary %s cannot be reached, trying replica %s", primary.ClusterName(), replica.ClusterName())
+				return replica
+			}
+		}
+		return nil
+	}
+	// MOVED <slot> <host>:<port>
+	fields := strings.Fields(err.Error())
+	if len(fields) != 3 || fields[0] != "MOVED" {
+		return nil
+	}
+	slot, parseErr := strconv.ParseUint(fields[1], 10, 16)
+	moved := c.upstreamAt(fields[2])
+	if parseErr != nil || moved == nil {
+		proxywasm.LogWarnf("redis slot %s moved to %s, which is not an upstream of the client", fields[1], fields[2])
+		return nil
+	}
+	proxywasm.LogInfof("redis slot %d moved to %s", slot, moved.ClusterName())
+	if c.movedSlots == nil {
+		c.movedSlots = make(map[uint16]Cluster)
+	}
+	c.movedSlots[uint16(slot)] = moved
+	return moved
+}
+
+// replicaOf returns the replica of a primary, nil if it has none
+func (c *RedisClusterClient[C]) replicaOf(primary Cluster) Cluster {
+	primaries := append([]Cluster{c.cluster}, c.option.shards...)
+	for i, p := range primaries {
+		if p.ClusterName() == primary.ClusterName() && i < len(c.option.replicas) {
+			return c.option.replicas[i]
+		}
+	}
+	return nil
+}
+
+// upstreamAt returns the upstream of the node at the address of a redirection, matched by host name and,
+// when several upstreams have the host name, by the port in the cluster name
+func (c *RedisClusterClient[C]) upstreamAt(addr string) Cluster {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	var match Cluster
+	for _, upstream := range c.upstreams() {
+		if !strings.EqualFold(upstream.HostName(), host) {
+			continue
+		}
+		if strings.Contains(upstream.ClusterName(), "|"+port+"|") {
+			return upstream
+		}
+		if match == nil {
+			match = upstream
+		}
+	}
+	return match
+}
+
+// redisCommandKey returns the first key of a command, the keys of eval follow the number of keys
+func redisCommandKey(cmds []interface{}) ([]byte, bool) {
+	switch strings.ToLower(string(redisArg(cmds[0]))) {
+	case "eval", "evalsha":
+		if len(cmds) < 4 || string(redisArg(cmds[2])) == "0" {
+			return nil, false
+		}
+		return redisArg(cmds[3]), true
+	}
+	if len(cmds) < 2 {
+		return nil, false
+	}
+	return redisArg(cmds[1]), true
+}
+
+// redisHashSlot returns the Redis Cluster hash slot of the key, only the {hash tag} is hashed if the key has one
+func redisHashSlot(key []byte) uint16 {
+	if start := strings.IndexByte(string(key), '{'); start >= 0 {
+		if end := strings.IndexByte(string(key[start+1:]), '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % redisHashSlots
+}
+
+// crc16 is the CRC-16/XMODEM checksum used by Redis Cluster
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
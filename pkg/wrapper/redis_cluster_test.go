@@ -0,0 +1,161 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/resp"
+)
+
+func TestRedisHashSlot(t *testing.T) {
+	assert.Equal(t, uint16(0x31c3), crc16([]byte("123456789")))
+	assert.Equal(t, uint16(12182), redisHashSlot([]byte("foo")))
+	assert.Equal(t, uint16(5061), redisHashSlot([]byte("bar")))
+	assert.Equal(t, redisHashSlot([]byte("user")), redisHashSlot([]byte("{user}:profile")))
+	assert.Equal(t, redisHashSlot([]byte("{}x")), crc16([]byte("{}x"))%redisHashSlots)
+}
+
+func TestRedisClusterRouting(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("redis-cluster-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	primaryA := FQDNCluster{FQDN: "redis-a.example.com", Port: 6379}
+	primaryB := FQDNCluster{FQDN: "redis-b.example.com", Port: 6379}
+	replicaA := FQDNCluster{FQDN: "redis-a-replica.example.com", Port: 6379}
+	c := NewRedisClusterClient(primaryA)
+	require.NoError(t, c.Init("", "", 1000, WithRedisCluster(primaryB), WithReadFromReplica(replicaA)))
+	require.True(t, c.Ready())
+
+	upstreamOf := func(call func() error) string {
+		require.NoError(t, call())
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, []byte("+OK\r\n"))
+		return callouts[0].Upstream
+	}
+
+	// "bar" hashes to the first half of the slots, "foo" to the second
+	assert.Equal(t, primaryA.ClusterName(), upstreamOf(func() error { return c.Set("bar", 1, nil) }))
+	assert.Equal(t, primaryB.ClusterName(), upstreamOf(func() error { return c.Set("foo", 1, nil) }))
+	assert.Equal(t, replicaA.ClusterName(), upstreamOf(func() error { return c.Get("bar", nil) }))
+	// The second shard has no replica
+	assert.Equal(t, primaryB.ClusterName(), upstreamOf(func() error { return c.Get("foo", nil) }))
+	assert.Equal(t, primaryB.ClusterName(), upstreamOf(func() error { return c.Do(nil, "GET", "{foo}:1") }))
+	assert.Equal(t, primaryB.ClusterName(), upstreamOf(func() error { return c.Eval("return 1", 1, []interface{}{"foo"}, nil, nil) }))
+	assert.Equal(t, primaryA.ClusterName(), upstreamOf(func() error { return c.Eval("return 1", 0, nil, nil, nil) }))
+	assert.Equal(t, primaryA.ClusterName(), upstreamOf(func() error { return c.Do(nil, "ping") }))
+	assert.Equal(t, primaryB.ClusterName(), upstreamOf(func() error {
+		return c.Pipeline().Command([]interface{}{"get", "{foo}:1"}, nil).Command([]interface{}{"get", "{foo}:2"}, nil).Exec()
+	}))
+
+	t.Run("failover to primary", func(t *testing.T) {
+		var response resp.Value
+		require.NoError(t, c.Get("bar", func(r resp.Value) { response = r }))
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		assert.Equal(t, replicaA.ClusterName(), callouts[0].Upstream)
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 1, nil)
+
+		callouts = host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		assert.Equal(t, primaryA.ClusterName(), callouts[0].Upstream)
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, []byte("$1\r\nv\r\n"))
+		assert.Equal(t, "v", response.String())
+	})
+
+	t.Run("replica errors are returned", func(t *testing.T) {
+		var response resp.Value
+		require.NoError(t, c.Get("bar", func(r resp.Value) { response = r }))
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"))
+		assert.Empty(t, host.GetRedisCalloutAttributesFromContext(id))
+		assert.ErrorContains(t, response.Error(), "WRONGTYPE")
+	})
+}
+
+func TestRedisClusterRedirect(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("redis-redirect-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	primaryA := FQDNCluster{FQDN: "redis-a.example.com", Port: 6379}
+	primaryB := FQDNCluster{FQDN: "redis-b.example.com", Port: 6379}
+	replicaA := FQDNCluster{FQDN: "redis-a-replica.example.com", Port: 6379}
+	c := NewRedisClusterClient(primaryA)
+	require.NoError(t, c.Init("", "", 1000, WithRedisCluster(primaryB), WithReadFromReplica(replicaA)))
+
+	// respond answers the single pending callout and returns its upstream
+	respond := func(status int32, response string) string {
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		upstream := callouts[0].Upstream
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, status, []byte(response))
+		return upstream
+	}
+
+	t.Run("failover of a primary", func(t *testing.T) {
+		var response resp.Value
+		require.NoError(t, c.Set("bar", 1, func(r resp.Value) { response = r }))
+		assert.Equal(t, primaryA.ClusterName(), respond(1, ""))
+		assert.Equal(t, replicaA.ClusterName(), respond(0, "+OK\r\n"), "the replica may have been promoted")
+		assert.Equal(t, "OK", response.String())
+	})
+
+	t.Run("moved slot", func(t *testing.T) {
+		var response resp.Value
+		require.NoError(t, c.Set("bar", 1, func(r resp.Value) { response = r }))
+		assert.Equal(t, primaryA.ClusterName(), respond(0, "-MOVED 5061 redis-a-replica.example.com:6379\r\n"))
+		assert.Equal(t, replicaA.ClusterName(), respond(0, "+OK\r\n"))
+		assert.Equal(t, "OK", response.String())
+
+		// The slot map is refreshed, other keys of the shard stay on their primary
+		require.NoError(t, c.Set("{bar}:1", 1, nil))
+		assert.Equal(t, replicaA.ClusterName(), respond(0, "+OK\r\n"))
+		require.NoError(t, c.Get("bar", nil))
+		assert.Equal(t, replicaA.ClusterName(), respond(0, "$1\r\n1\r\n"))
+		require.NoError(t, c.Set("baz", 1, nil))
+		assert.Equal(t, primaryA.ClusterName(), respond(0, "+OK\r\n"))
+	})
+
+	t.Run("redirections are limited", func(t *testing.T) {
+		var response resp.Value
+		require.NoError(t, c.Set("foo", 1, func(r resp.Value) { response = r }))
+		assert.Equal(t, primaryB.ClusterName(), respond(0, "-MOVED 12182 redis-a.example.com:6379\r\n"))
+		assert.Equal(t, primaryA.ClusterName(), respond(0, "-MOVED 12182 redis-b.example.com:6379\r\n"))
+		assert.Equal(t, primaryB.ClusterName(), respond(0, "-MOVED 12182 redis-a.example.com:6379\r\n"))
+		assert.Empty(t, host.GetRedisCalloutAttributesFromContext(id))
+		assert.ErrorContains(t, response.Error(), "MOVED")
+	})
+
+	t.Run("moved to an unknown node", func(t *testing.T) {
+		var response resp.Value
+		require.NoError(t, c.Set("qux", 1, func(r resp.Value) { response = r }))
+		respond(0, "-MOVED 1 10.0.0.9:6379\r\n")
+		assert.Empty(t, host.GetRedisCalloutAttributesFromContext(id))
+		assert.ErrorContains(t, response.Error(), "MOVED")
+	})
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// redisRateLimitScript counts a hit in every window unless one of them is exhausted. ARGV holds the
+// limit and the length in milliseconds of every window. It returns whether the hit is allowed, the
+// index of the exhausted window or 0, followed by the count and the milliseconds to the reset of
+// every window.
+const redisRateLimitScript = `local counts = {}
+for i, key in ipairs(KEYS) do
+  counts[i] = tonumber(redis.call('GET', key) or '0')
+end
+local exhausted = 0
+for i = 1, #KEYS do
+  if counts[i] >= tonumber(ARGV[2 * i - 1]) then
+    exhausted = i
+    break
+  end
+end
+local result = {exhausted == 0 and 1 or 0, exhausted}
+for i, key in ipairs(KEYS) do
+  if exhausted == 0 then
+    counts[i] = redis.call('INCR', key)
+    if counts[i] == 1 then
+      redis.call('PEXPIRE', key, ARGV[2 * i])
+    end
+  end
+  result[#result + 1] = counts[i]
+  result[#result + 1] = redis.call('PTTL', key)
+end
+return result`
+
+// RateLimitWindow is a fixed window limit, e.g. 100 hits per minute
+type RateLimitWindow struct {
+	// Key of the counter, the start of the current window is appended to it
+	Key    string
+	Limit  int64
+	Window time.Duration
+}
+
+// RateLimitResult is the state of the windows of a hit
+type RateLimitResult struct {
+	Allowed bool
+	// Exhausted is the index of the window whose limit rejected the hit, -1 if it is allowed
+	Exhausted int
+	// Counts are the hits of every window, including this one if it is allowed
+	Counts []int64
+	// Resets are the times until every window starts over
+	Resets []time.Duration
+}
+
+// RateLimit counts a hit in all windows at once, unless the limit of one of them is reached. Every
+// window is a Redis counter expiring at its end, so the limits are shared by all gateway instances.
+// With Redis Cluster, the keys must share a {hash tag}.
+func (c *RedisClusterClient[C]) RateLimit(windows []RateLimitWindow, callback func(result RateLimitResult, err error)) error {
+	if len(windows) == 0 {
+		return errors.New("rate limit has no window")
+	}
+	now := time.Now()
+	keys := make([]interface{}, len(windows))
+	args := make([]interface{}, 0, 2*len(windows))
+	for i, w := range windows {
+		if w.Window < time.Millisecond {
+			return fmt.Errorf("invalid rate limit window of %s: %s", w.Key, w.Window)
+		}
+		keys[i] = w.Key + ":" + strconv.FormatInt(now.UnixMilli()/w.Window.Milliseconds(), 10)
+		args = append(args, w.Limit, w.Window.Milliseconds())
+	}
+	return c.Eval(redisRateLimitScript, len(keys), keys, args, func(response resp.Value) {
+		result, err := parseRateLimitResult(response, windows, now)
+		callback(result, err)
+	})
+}
+
+func parseRateLimitResult(response resp.Value, windows []RateLimitWindow, now time.Time) (RateLimitResult, error) {
+	if err := response.Error(); err != nil {
+		return RateLimitResult{}, err
+	}
+	values := response.Array()
+	if len(values) != 2+2*len(windows) {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit reply: %s", response.String())
+	}
+	result := RateLimitResult{
+		Allowed:   values[0].Integer() == 1,
+		Exhausted: values[1].Integer() - 1,
+		Counts:    make([]int64, len(windows)),
+		Resets:    make([]time.Duration, len(windows)),
+	}
+	for i, w := range windows {
+		result.Counts[i] = int64(values[2+2*i].Integer())
+		reset := time.Duration(values[3+2*i].Integer()) * time.Millisecond
+		if reset < 0 {
+			// The counter of a rejected hit may not exist, the window ends on schedule
+			window := w.Window.Milliseconds()
+			reset = time.Duration(window-now.UnixMilli()%window) * time.Millisecond
+		}
+		result.Resets[i] = reset
+	}
+	return result, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/resp"
+)
+
+func TestRedisRateLimit(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("redis-ratelimit-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	client := NewRedisClusterClient(FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	require.NoError(t, client.Init("", "", 1000))
+	assert.Error(t, client.RateLimit(nil, nil))
+	assert.Error(t, client.RateLimit([]RateLimitWindow{{Key: "k", Limit: 1}}, nil))
+
+	windows := []RateLimitWindow{
+		{Key: "{alice}:m", Limit: 10, Window: time.Minute},
+		{Key: "{alice}:d", Limit: 100, Window: 24 * time.Hour},
+	}
+	reply := func(values ...int) []byte {
+		array := make([]resp.Value, len(values))
+		for i, v := range values {
+			array[i] = resp.IntegerValue(v)
+		}
+		b, _ := resp.ArrayValue(array).MarshalRESP()
+		return b
+	}
+	var result RateLimitResult
+	var resultErr error
+	hit := func(response []byte) {
+		require.NoError(t, client.RateLimit(windows, func(r RateLimitResult, err error) {
+			result, resultErr = r, err
+		}))
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		require.Len(t, callouts, 1)
+		values, _, err := resp.NewReader(bytes.NewReader(callouts[0].Query)).ReadValue()
+		require.NoError(t, err)
+		var args []string
+		for _, v := range values.Array() {
+			args = append(args, v.String())
+		}
+		minute := strconv.FormatInt(time.Now().Unix()/60, 10)
+		require.Len(t, args, 9)
+		assert.Equal(t, []string{"eval", redisRateLimitScript, "2"}, args[:3])
+		assert.Equal(t, "{alice}:m:"+minute, args[3])
+		assert.True(t, strings.HasPrefix(args[4], "{alice}:d:"))
+		assert.Equal(t, []string{"10", "60000", "100", "86400000"}, args[5:])
+		host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, response)
+	}
+
+	hit(reply(1, 0, 3, 59000, 42, 3600000))
+	require.NoError(t, resultErr)
+	assert.Equal(t, RateLimitResult{Allowed: true, Exhausted: -1, Counts: []int64{3, 42}, Resets: []time.Duration{59 * time.Second, time.Hour}}, result)
+
+	// The counter of the minute does not exist yet when the day is exhausted
+	hit(reply(0, 2, 0, -2, 100, 3600000))
+	require.NoError(t, resultErr)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 1, result.Exhausted)
+	assert.Greater(t, result.Resets[0], time.Duration(0))
+	assert.LessOrEqual(t, result.Resets[0], time.Minute)
+
+	hit(reply(1, 0))
+	assert.ErrorContains(t, resultErr, "unexpected rate limit reply")
+}
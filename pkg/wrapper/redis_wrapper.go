@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +37,8 @@ type RedisClient interface {
 	Ready() bool
 	// with this function, you can call redis as if you are using redis-cli
 	Command(cmds []interface{}, callback RedisResponseCallback) error
+	// Do sends a command given as its arguments, e.g. Do(callback, "incrby", key, 5)
+	Do(callback RedisResponseCallback, args ...interface{}) error
 	Eval(script string, numkeys int, keys, args []interface{}, callback RedisResponseCallback) error
 
 	// Key
@@ -113,6 +116,8 @@ type RedisClusterClient[C Cluster] struct {
 	ready          bool
 	checkReadyFunc func() error
 	option         redisOption
+	// Upstreams of the slots redirected with MOVED, see WithRedisCluster
+	movedSlots map[uint16]Cluster
 }
 
 type redisOption struct {
@@ -121,6 +126,11 @@ type redisOption struct {
 	maxBufferSizeBeforeFlush    int  // in bytes, default 1024 bytes when not set
 	bufferFlushTimeoutSet       bool // flag to indicate if bufferFlushTimeout was explicitly set
 	maxBufferSizeBeforeFlushSet bool // flag to indicate if maxBufferSizeBeforeFlush was explicitly set
+
+	// further primaries besides the cluster of the client, see WithRedisCluster
+	shards []Cluster
+	// replicas of the primaries in the same order, see WithReadFromReplica
+	replicas []Cluster
 }
 
 type optionFunc func(*redisOption)
@@ -161,7 +171,7 @@ func NewRedisClusterClient[C Cluster](cluster C) *RedisClusterClient[C] {
 	return &RedisClusterClient[C]{
 		cluster: cluster,
 		checkReadyFunc: func() error {
-			return errors.New("redis client is not ready, please call Init() first")
+			return fmt.Errorf("%w: redis client is not ready, please call Init() first", ErrCalloutFailed)
 		},
 	}
 }
@@ -171,38 +181,85 @@ func RedisCall(cluster Cluster, respQuery []byte, callback RedisResponseCallback
 }
 
 func redisCallInternal(cluster Cluster, respQuery []byte, callback RedisResponseCallback, readyPtr *bool, checkReadyFunc func() error) error {
+	return redisQueryInternal(cluster, respQuery, 1, func(responses []resp.Value) {
+		if callback != nil {
+			callback(responses[0])
+		}
+	}, readyPtr, checkReadyFunc)
+}
+
+// redisQueryInternal sends a query of one or more commands and passes the given number of replies to the
+// callback. When the callout fails, or the response has fewer replies, the missing replies are errors.
+func redisQueryInternal(cluster Cluster, respQuery []byte, replies int, callback func(responses []resp.Value), readyPtr *bool, checkReadyFunc func() error) error {
 	requestID := uuid.New().String()
-	_, err := proxywasm.DispatchRedisCall(
+	calloutDone := startCalloutTiming("redis", cluster.ClusterName())
+	_, expected, err := chargeCallout(0, func() {
+		calloutDone()
+		proxywasm.LogDebugf("redis call cancelled, request-id: %s, the callouts of the request are over their maximum duration", requestID)
+		if rejectFailedCallout(FailureRedis, ErrCalloutLimitExceeded) {
+			return
+		}
+		if callback != nil {
+			responseValues := make([]resp.Value, replies)
+			for i := range responseValues {
+				responseValues[i] = resp.ErrorValue(ErrCalloutLimitExceeded)
+			}
+			callback(responseValues)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	_, err = proxywasm.DispatchRedisCall(
 		cluster.ClusterName(),
 		respQuery,
 		func(status int, responseSize int) {
+			if !expected() {
+				proxywasm.LogDebugf("dropping the response of cancelled redis call, request-id: %s", requestID)
+				return
+			}
+			calloutDone()
 			response, err := proxywasm.GetRedisCallResponse(0, responseSize)
-			var responseValue resp.Value
+			responseValues := make([]resp.Value, 0, replies)
+			var failure error
 			if status != 0 {
 				proxywasm.LogCriticalf("Error occurred while calling redis, it seems cannot connect to the redis cluster. request-id: %s", requestID)
-				responseValue = resp.ErrorValue(fmt.Errorf("cannot connect to redis cluster"))
+				if rejectFailedCallout(FailureRedis, errRedisConnect) {
+					return
+				}
+				failure = errRedisConnect
+			} else if err != nil {
+				proxywasm.LogCriticalf("failed to get redis response body, request-id: %s, error: %v", requestID, err)
+				failure = fmt.Errorf("cannot get redis response")
 			} else {
-				if err != nil {
-					proxywasm.LogCriticalf("failed to get redis response body, request-id: %s, error: %v", requestID, err)
-					responseValue = resp.ErrorValue(fmt.Errorf("cannot get redis response"))
-				} else {
-					rd := resp.NewReader(bytes.NewReader(response))
+				rd := resp.NewReader(bytes.NewReader(response))
+				for len(responseValues) < replies {
 					value, _, err := rd.ReadValue()
-					if err != nil && err != io.EOF {
+					if err == io.EOF && replies == 1 {
+						// An empty response is an empty reply
+						responseValues = append(responseValues, value)
+						break
+					}
+					if err != nil {
 						proxywasm.LogCriticalf("failed to read redis response body, request-id: %s, error: %v", requestID, err)
-						responseValue = resp.ErrorValue(fmt.Errorf("cannot read redis response"))
-					} else {
-						responseValue = value
-						proxywasm.LogDebugf("redis call end, request-id: %s, respQuery: %s, respValue: %s",
-							requestID, base64.StdEncoding.EncodeToString([]byte(respQuery)), base64.StdEncoding.EncodeToString(response))
+						failure = fmt.Errorf("cannot read redis response")
+						break
 					}
+					responseValues = append(responseValues, value)
+				}
+				if failure == nil {
+					proxywasm.LogDebugf("redis call end, request-id: %s, respQuery: %s, respValue: %s",
+						requestID, base64.StdEncoding.EncodeToString([]byte(respQuery)), base64.StdEncoding.EncodeToString(response))
 				}
 			}
+			for len(responseValues) < replies {
+				responseValues = append(responseValues, resp.ErrorValue(failure))
+			}
 
 			// Check for NOAUTH error and retry if possible
 			shouldInvokeCallback := true
-			if responseValue.Error() != nil && readyPtr != nil && checkReadyFunc != nil {
-				errMsg := responseValue.Error().Error()
+			if responseValues[0].Error() != nil && readyPtr != nil && checkReadyFunc != nil {
+				errMsg := responseValues[0].Error().Error()
 				if bytes.Contains([]byte(errMsg), []byte("NOAUTH Authentication required")) {
 					proxywasm.LogWarnf("redis authentication required, request-id: %s, marking client as not ready and attempting re-authentication", requestID)
 					*readyPtr = false
@@ -211,7 +268,7 @@ func redisCallInternal(cluster Cluster, respQuery []byte, callback RedisResponse
 					if err := checkReadyFunc(); err == nil {
 						proxywasm.LogInfof("redis re-authentication successful, retrying request, request-id: %s", requestID)
 						// Retry the Redis call
-						retryErr := redisCallInternal(cluster, respQuery, callback, nil, nil)
+						retryErr := redisQueryInternal(cluster, respQuery, replies, callback, nil, nil)
 						if retryErr != nil {
 							// Retry dispatch failed, fall through to invoke callback with original error
 							proxywasm.LogErrorf("redis retry dispatch failed, request-id: %s, error: %v", requestID, retryErr)
@@ -226,28 +283,77 @@ func redisCallInternal(cluster Cluster, respQuery []byte, callback RedisResponse
 			}
 
 			if shouldInvokeCallback && callback != nil {
-				callback(responseValue)
+				callback(responseValues)
 			}
 		})
 	if err != nil {
+		expected()
 		proxywasm.LogCriticalf("redis call failed, request-id: %s, error: %v", requestID, err)
-	} else {
-		proxywasm.LogDebugf("redis call start, request-id: %s, respQuery: %s", requestID, base64.StdEncoding.EncodeToString([]byte(respQuery)))
+		return fmt.Errorf("%w: failed to dispatch redis call to %s: %w", ErrCalloutFailed, cluster.ClusterName(), err)
 	}
-	return err
+	proxywasm.LogDebugf("redis call start, request-id: %s, respQuery: %s", requestID, base64.StdEncoding.EncodeToString([]byte(respQuery)))
+	return nil
 }
 
 func respString(args []interface{}) []byte {
 	var buf bytes.Buffer
 	wr := resp.NewWriter(&buf)
-	arr := make([]resp.Value, 0)
+	arr := make([]resp.Value, 0, len(args))
 	for _, arg := range args {
-		arr = append(arr, resp.StringValue(fmt.Sprint(arg)))
+		arr = append(arr, resp.BytesValue(redisArg(arg)))
 	}
 	wr.WriteArray(arr)
 	return buf.Bytes()
 }
 
+// redisArg encodes a command argument as a bulk string. Numbers are written in the plain decimal
+// form Redis parses, e.g. a float64 of 1e21 is sent as 1000000000000000000000, bools are sent as
+// 1 and 0, and []byte is sent as is.
+func redisArg(arg interface{}) []byte {
+	switch v := arg.(type) {
+	case nil:
+		return []byte{}
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case uint:
+		return strconv.AppendUint(nil, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(nil, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(nil, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(nil, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(nil, v, 10)
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64)
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	case resp.Value:
+		return v.Bytes()
+	case fmt.Stringer:
+		return []byte(v.String())
+	}
+	return []byte(fmt.Sprint(arg))
+}
+
 func (c *RedisClusterClient[C]) Ready() bool {
 	return c.ready
 }
@@ -258,8 +364,6 @@ func (c *RedisClusterClient[C]) Init(username, password string, timeout int64, o
 		opt(&c.option)
 	}
 
-	clusterName := c.cluster.ClusterName()
-
 	// Build query parameters based on options
 	params := make([]string, 0, 3)
 
@@ -286,9 +390,18 @@ func (c *RedisClusterClient[C]) Init(username, password string, timeout int64, o
 	}
 	params = append(params, fmt.Sprintf("max_buffer_size_before_flush=%d", bufferSize))
 
-	// Append all parameters to cluster name
-	if len(params) > 0 {
-		clusterName = fmt.Sprintf("%s?%s", clusterName, strings.Join(params, "&"))
+	// Every upstream is initialized with the same parameters appended to its cluster name
+	initUpstreams := func() error {
+		for _, cluster := range c.upstreams() {
+			clusterName := cluster.ClusterName()
+			if len(params) > 0 {
+				clusterName = fmt.Sprintf("%s?%s", clusterName, strings.Join(params, "&"))
+			}
+			if err := proxywasm.RedisInit(clusterName, username, password, uint32(timeout)); err != nil {
+				return fmt.Errorf("failed to init redis cluster %s: %v", cluster.ClusterName(), err)
+			}
+		}
+		return nil
 	}
 
 	// Always set checkReadyFunc to support re-authentication
@@ -296,7 +409,7 @@ func (c *RedisClusterClient[C]) Init(username, password string, timeout int64, o
 		if c.ready {
 			return nil
 		}
-		initErr := proxywasm.RedisInit(clusterName, username, password, uint32(timeout))
+		initErr := initUpstreams()
 		if initErr != nil {
 			proxywasm.LogErrorf("failed to re-authenticate redis: %v", initErr)
 			return initErr
@@ -306,7 +419,7 @@ func (c *RedisClusterClient[C]) Init(username, password string, timeout int64, o
 		return nil
 	}
 
-	err := proxywasm.RedisInit(clusterName, username, password, uint32(timeout))
+	err := initUpstreams()
 	if err != nil {
 		proxywasm.LogWarnf("failed to init redis: %v, will retry later", err)
 		c.ready = false
@@ -317,10 +430,17 @@ func (c *RedisClusterClient[C]) Init(username, password string, timeout int64, o
 }
 
 func (c *RedisClusterClient[C]) Command(cmds []interface{}, callback RedisResponseCallback) error {
+	if len(cmds) == 0 {
+		return errors.New("redis command is empty")
+	}
 	if err := c.checkReadyFunc(); err != nil {
 		return err
 	}
-	return redisCallInternal(c.cluster, respString(cmds), callback, &c.ready, c.checkReadyFunc)
+	return c.call(cmds, callback)
+}
+
+func (c *RedisClusterClient[C]) Do(callback RedisResponseCallback, args ...interface{}) error {
+	return c.Command(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Eval(script string, numkeys int, keys, args []interface{}, callback RedisResponseCallback) error {
@@ -333,7 +453,7 @@ func (c *RedisClusterClient[C]) Eval(script string, numkeys int, keys, args []in
 	params = append(params, numkeys)
 	params = append(params, keys...)
 	params = append(params, args...)
-	return redisCallInternal(c.cluster, respString(params), callback, &c.ready, c.checkReadyFunc)
+	return c.call(params, callback)
 }
 
 // Key
@@ -344,7 +464,7 @@ func (c *RedisClusterClient[C]) Del(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "del")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Exists(key string, callback RedisResponseCallback) error {
@@ -354,7 +474,7 @@ func (c *RedisClusterClient[C]) Exists(key string, callback RedisResponseCallbac
 	args := make([]interface{}, 0)
 	args = append(args, "exists")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Expire(key string, ttl int, callback RedisResponseCallback) error {
@@ -365,7 +485,7 @@ func (c *RedisClusterClient[C]) Expire(key string, ttl int, callback RedisRespon
 	args = append(args, "expire")
 	args = append(args, key)
 	args = append(args, ttl)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Persist(key string, callback RedisResponseCallback) error {
@@ -375,7 +495,7 @@ func (c *RedisClusterClient[C]) Persist(key string, callback RedisResponseCallba
 	args := make([]interface{}, 0)
 	args = append(args, "persist")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 // String
@@ -386,7 +506,7 @@ func (c *RedisClusterClient[C]) Get(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "get")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Set(key string, value interface{}, callback RedisResponseCallback) error {
@@ -397,7 +517,7 @@ func (c *RedisClusterClient[C]) Set(key string, value interface{}, callback Redi
 	args = append(args, "set")
 	args = append(args, key)
 	args = append(args, value)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SetEx(key string, value interface{}, ttl int, callback RedisResponseCallback) error {
@@ -410,7 +530,7 @@ func (c *RedisClusterClient[C]) SetEx(key string, value interface{}, ttl int, ca
 	args = append(args, value)
 	args = append(args, "ex")
 	args = append(args, ttl)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SetNX(key string, value interface{}, ttl int, callback RedisResponseCallback) error {
@@ -426,7 +546,7 @@ func (c *RedisClusterClient[C]) SetNX(key string, value interface{}, ttl int, ca
 		args = append(args, "ex")
 		args = append(args, ttl)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) MGet(keys []string, callback RedisResponseCallback) error {
@@ -438,7 +558,7 @@ func (c *RedisClusterClient[C]) MGet(keys []string, callback RedisResponseCallba
 	for _, k := range keys {
 		args = append(args, k)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) MSet(kvMap map[string]interface{}, callback RedisResponseCallback) error {
@@ -451,7 +571,7 @@ func (c *RedisClusterClient[C]) MSet(kvMap map[string]interface{}, callback Redi
 		args = append(args, k)
 		args = append(args, v)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Incr(key string, callback RedisResponseCallback) error {
@@ -461,7 +581,7 @@ func (c *RedisClusterClient[C]) Incr(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "incr")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) Decr(key string, callback RedisResponseCallback) error {
@@ -471,7 +591,7 @@ func (c *RedisClusterClient[C]) Decr(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "decr")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) IncrBy(key string, delta int, callback RedisResponseCallback) error {
@@ -482,7 +602,7 @@ func (c *RedisClusterClient[C]) IncrBy(key string, delta int, callback RedisResp
 	args = append(args, "incrby")
 	args = append(args, key)
 	args = append(args, delta)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) DecrBy(key string, delta int, callback RedisResponseCallback) error {
@@ -493,7 +613,7 @@ func (c *RedisClusterClient[C]) DecrBy(key string, delta int, callback RedisResp
 	args = append(args, "decrby")
 	args = append(args, key)
 	args = append(args, delta)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 // List
@@ -504,7 +624,7 @@ func (c *RedisClusterClient[C]) LLen(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "llen")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) RPush(key string, vals []interface{}, callback RedisResponseCallback) error {
@@ -517,7 +637,7 @@ func (c *RedisClusterClient[C]) RPush(key string, vals []interface{}, callback R
 	for _, val := range vals {
 		args = append(args, val)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) RPop(key string, callback RedisResponseCallback) error {
@@ -527,7 +647,7 @@ func (c *RedisClusterClient[C]) RPop(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "rpop")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LPush(key string, vals []interface{}, callback RedisResponseCallback) error {
@@ -540,7 +660,7 @@ func (c *RedisClusterClient[C]) LPush(key string, vals []interface{}, callback R
 	for _, val := range vals {
 		args = append(args, val)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LPop(key string, callback RedisResponseCallback) error {
@@ -550,7 +670,7 @@ func (c *RedisClusterClient[C]) LPop(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "lpop")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LIndex(key string, index int, callback RedisResponseCallback) error {
@@ -561,7 +681,7 @@ func (c *RedisClusterClient[C]) LIndex(key string, index int, callback RedisResp
 	args = append(args, "lindex")
 	args = append(args, key)
 	args = append(args, index)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LRange(key string, start, stop int, callback RedisResponseCallback) error {
@@ -573,7 +693,7 @@ func (c *RedisClusterClient[C]) LRange(key string, start, stop int, callback Red
 	args = append(args, key)
 	args = append(args, start)
 	args = append(args, stop)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LRem(key string, count int, value interface{}, callback RedisResponseCallback) error {
@@ -585,7 +705,7 @@ func (c *RedisClusterClient[C]) LRem(key string, count int, value interface{}, c
 	args = append(args, key)
 	args = append(args, count)
 	args = append(args, value)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LInsertBefore(key string, pivot, value interface{}, callback RedisResponseCallback) error {
@@ -598,7 +718,7 @@ func (c *RedisClusterClient[C]) LInsertBefore(key string, pivot, value interface
 	args = append(args, "before")
 	args = append(args, pivot)
 	args = append(args, value)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) LInsertAfter(key string, pivot, value interface{}, callback RedisResponseCallback) error {
@@ -611,7 +731,7 @@ func (c *RedisClusterClient[C]) LInsertAfter(key string, pivot, value interface{
 	args = append(args, "after")
 	args = append(args, pivot)
 	args = append(args, value)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 // Hash
@@ -623,7 +743,7 @@ func (c *RedisClusterClient[C]) HExists(key, field string, callback RedisRespons
 	args = append(args, "hexists")
 	args = append(args, key)
 	args = append(args, field)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HDel(key string, fields []string, callback RedisResponseCallback) error {
@@ -636,7 +756,7 @@ func (c *RedisClusterClient[C]) HDel(key string, fields []string, callback Redis
 	for _, field := range fields {
 		args = append(args, field)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HLen(key string, callback RedisResponseCallback) error {
@@ -646,7 +766,7 @@ func (c *RedisClusterClient[C]) HLen(key string, callback RedisResponseCallback)
 	args := make([]interface{}, 0)
 	args = append(args, "hlen")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HGet(key, field string, callback RedisResponseCallback) error {
@@ -657,7 +777,7 @@ func (c *RedisClusterClient[C]) HGet(key, field string, callback RedisResponseCa
 	args = append(args, "hget")
 	args = append(args, key)
 	args = append(args, field)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HSet(key, field string, value interface{}, callback RedisResponseCallback) error {
@@ -669,7 +789,7 @@ func (c *RedisClusterClient[C]) HSet(key, field string, value interface{}, callb
 	args = append(args, key)
 	args = append(args, field)
 	args = append(args, value)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HMGet(key string, fields []string, callback RedisResponseCallback) error {
@@ -682,7 +802,7 @@ func (c *RedisClusterClient[C]) HMGet(key string, fields []string, callback Redi
 	for _, field := range fields {
 		args = append(args, field)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HMSet(key string, kvMap map[string]interface{}, callback RedisResponseCallback) error {
@@ -696,7 +816,7 @@ func (c *RedisClusterClient[C]) HMSet(key string, kvMap map[string]interface{},
 		args = append(args, k)
 		args = append(args, v)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HKeys(key string, callback RedisResponseCallback) error {
@@ -706,7 +826,7 @@ func (c *RedisClusterClient[C]) HKeys(key string, callback RedisResponseCallback
 	args := make([]interface{}, 0)
 	args = append(args, "hkeys")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HVals(key string, callback RedisResponseCallback) error {
@@ -716,7 +836,7 @@ func (c *RedisClusterClient[C]) HVals(key string, callback RedisResponseCallback
 	args := make([]interface{}, 0)
 	args = append(args, "hvals")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HGetAll(key string, callback RedisResponseCallback) error {
@@ -726,7 +846,7 @@ func (c *RedisClusterClient[C]) HGetAll(key string, callback RedisResponseCallba
 	args := make([]interface{}, 0)
 	args = append(args, "hgetall")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HIncrBy(key, field string, delta int, callback RedisResponseCallback) error {
@@ -738,7 +858,7 @@ func (c *RedisClusterClient[C]) HIncrBy(key, field string, delta int, callback R
 	args = append(args, key)
 	args = append(args, field)
 	args = append(args, delta)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) HIncrByFloat(key, field string, delta float64, callback RedisResponseCallback) error {
@@ -750,7 +870,7 @@ func (c *RedisClusterClient[C]) HIncrByFloat(key, field string, delta float64, c
 	args = append(args, key)
 	args = append(args, field)
 	args = append(args, delta)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 // Set
@@ -761,7 +881,7 @@ func (c *RedisClusterClient[C]) SCard(key string, callback RedisResponseCallback
 	args := make([]interface{}, 0)
 	args = append(args, "scard")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SAdd(key string, vals []interface{}, callback RedisResponseCallback) error {
@@ -774,7 +894,7 @@ func (c *RedisClusterClient[C]) SAdd(key string, vals []interface{}, callback Re
 	for _, val := range vals {
 		args = append(args, val)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SRem(key string, vals []interface{}, callback RedisResponseCallback) error {
@@ -787,7 +907,7 @@ func (c *RedisClusterClient[C]) SRem(key string, vals []interface{}, callback Re
 	for _, val := range vals {
 		args = append(args, val)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SIsMember(key string, value interface{}, callback RedisResponseCallback) error {
@@ -798,7 +918,7 @@ func (c *RedisClusterClient[C]) SIsMember(key string, value interface{}, callbac
 	args = append(args, "sismember")
 	args = append(args, key)
 	args = append(args, value)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SMembers(key string, callback RedisResponseCallback) error {
@@ -808,7 +928,7 @@ func (c *RedisClusterClient[C]) SMembers(key string, callback RedisResponseCallb
 	args := make([]interface{}, 0)
 	args = append(args, "smembers")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SDiff(key1, key2 string, callback RedisResponseCallback) error {
@@ -819,7 +939,7 @@ func (c *RedisClusterClient[C]) SDiff(key1, key2 string, callback RedisResponseC
 	args = append(args, "sdiff")
 	args = append(args, key1)
 	args = append(args, key2)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SDiffStore(destination, key1, key2 string, callback RedisResponseCallback) error {
@@ -831,7 +951,7 @@ func (c *RedisClusterClient[C]) SDiffStore(destination, key1, key2 string, callb
 	args = append(args, destination)
 	args = append(args, key1)
 	args = append(args, key2)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SInter(key1, key2 string, callback RedisResponseCallback) error {
@@ -842,7 +962,7 @@ func (c *RedisClusterClient[C]) SInter(key1, key2 string, callback RedisResponse
 	args = append(args, "sinter")
 	args = append(args, key1)
 	args = append(args, key2)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SInterStore(destination, key1, key2 string, callback RedisResponseCallback) error {
@@ -854,7 +974,7 @@ func (c *RedisClusterClient[C]) SInterStore(destination, key1, key2 string, call
 	args = append(args, destination)
 	args = append(args, key1)
 	args = append(args, key2)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SUnion(key1, key2 string, callback RedisResponseCallback) error {
@@ -865,7 +985,7 @@ func (c *RedisClusterClient[C]) SUnion(key1, key2 string, callback RedisResponse
 	args = append(args, "sunion")
 	args = append(args, key1)
 	args = append(args, key2)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) SUnionStore(destination, key1, key2 string, callback RedisResponseCallback) error {
@@ -877,7 +997,7 @@ func (c *RedisClusterClient[C]) SUnionStore(destination, key1, key2 string, call
 	args = append(args, destination)
 	args = append(args, key1)
 	args = append(args, key2)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 // ZSet
@@ -888,7 +1008,7 @@ func (c *RedisClusterClient[C]) ZCard(key string, callback RedisResponseCallback
 	args := make([]interface{}, 0)
 	args = append(args, "zcard")
 	args = append(args, key)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZAdd(key string, msMap map[string]interface{}, callback RedisResponseCallback) error {
@@ -902,7 +1022,7 @@ func (c *RedisClusterClient[C]) ZAdd(key string, msMap map[string]interface{}, c
 		args = append(args, s)
 		args = append(args, m)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZCount(key string, min interface{}, max interface{}, callback RedisResponseCallback) error {
@@ -914,7 +1034,7 @@ func (c *RedisClusterClient[C]) ZCount(key string, min interface{}, max interfac
 	args = append(args, key)
 	args = append(args, min)
 	args = append(args, max)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZIncrBy(key string, member string, delta interface{}, callback RedisResponseCallback) error {
@@ -926,7 +1046,7 @@ func (c *RedisClusterClient[C]) ZIncrBy(key string, member string, delta interfa
 	args = append(args, key)
 	args = append(args, delta)
 	args = append(args, member)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZScore(key, member string, callback RedisResponseCallback) error {
@@ -937,7 +1057,7 @@ func (c *RedisClusterClient[C]) ZScore(key, member string, callback RedisRespons
 	args = append(args, "zscore")
 	args = append(args, key)
 	args = append(args, member)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZRank(key, member string, callback RedisResponseCallback) error {
@@ -948,7 +1068,7 @@ func (c *RedisClusterClient[C]) ZRank(key, member string, callback RedisResponse
 	args = append(args, "zrank")
 	args = append(args, key)
 	args = append(args, member)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZRevRank(key, member string, callback RedisResponseCallback) error {
@@ -959,7 +1079,7 @@ func (c *RedisClusterClient[C]) ZRevRank(key, member string, callback RedisRespo
 	args = append(args, "zrevrank")
 	args = append(args, key)
 	args = append(args, member)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZRem(key string, members []string, callback RedisResponseCallback) error {
@@ -972,7 +1092,7 @@ func (c *RedisClusterClient[C]) ZRem(key string, members []string, callback Redi
 	for _, m := range members {
 		args = append(args, m)
 	}
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZRange(key string, start, stop int, callback RedisResponseCallback) error {
@@ -984,7 +1104,7 @@ func (c *RedisClusterClient[C]) ZRange(key string, start, stop int, callback Red
 	args = append(args, key)
 	args = append(args, start)
 	args = append(args, stop)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
 
 func (c *RedisClusterClient[C]) ZRevRange(key string, start, stop int, callback RedisResponseCallback) error {
@@ -996,5 +1116,5 @@ func (c *RedisClusterClient[C]) ZRevRange(key string, start, stop int, callback
 	args = append(args, key)
 	args = append(args, start)
 	args = append(args, stop)
-	return redisCallInternal(c.cluster, respString(args), callback, &c.ready, c.checkReadyFunc)
+	return c.call(args, callback)
 }
@@ -0,0 +1,145 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/resp"
+)
+
+// respCommand builds the RESP array of bulk strings a command is expected to be sent as
+func respCommand(args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+func TestRedisArg(t *testing.T) {
+	for _, tc := range []struct {
+		arg      interface{}
+		expected string
+	}{
+		{"value", "value"},
+		{[]byte("raw\x00bytes"), "raw\x00bytes"},
+		{-5, "-5"},
+		{int64(9007199254740993), "9007199254740993"},
+		{uint32(7), "7"},
+		{1.5, "1.5"},
+		{1e21, "1000000000000000000000"},
+		{float32(0.1), "0.1"},
+		{true, "1"},
+		{false, "0"},
+		{nil, ""},
+		{resp.StringValue("v"), "v"},
+	} {
+		assert.Equal(t, tc.expected, string(redisArg(tc.arg)), "%#v", tc.arg)
+	}
+}
+
+func TestRedisCommands(t *testing.T) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(NewCommonVmCtx[struct{}]("redis-commands-test")))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	host.StartPlugin()
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	c := NewRedisClusterClient(FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+	assert.Error(t, c.Get("k", nil), "not initialized")
+	assert.NoError(t, c.Init("", "", 1000))
+	assert.Error(t, c.Command(nil, nil))
+
+	for _, tc := range []struct {
+		call     func() error
+		expected []string
+	}{
+		{func() error { return c.Command([]interface{}{"ping"}, nil) }, []string{"ping"}},
+		{func() error { return c.Do(nil, "incrbyfloat", "k", 0.25) }, []string{"incrbyfloat", "k", "0.25"}},
+		{func() error { return c.Eval("return 1", 1, []interface{}{"k"}, []interface{}{10, true}, nil) }, []string{"eval", "return 1", "1", "k", "10", "1"}},
+		{func() error { return c.Del("k", nil) }, []string{"del", "k"}},
+		{func() error { return c.Exists("k", nil) }, []string{"exists", "k"}},
+		{func() error { return c.Expire("k", 60, nil) }, []string{"expire", "k", "60"}},
+		{func() error { return c.Persist("k", nil) }, []string{"persist", "k"}},
+		{func() error { return c.Get("k", nil) }, []string{"get", "k"}},
+		{func() error { return c.Set("k", []byte("v"), nil) }, []string{"set", "k", "v"}},
+		{func() error { return c.SetEx("k", 1, 60, nil) }, []string{"set", "k", "1", "ex", "60"}},
+		{func() error { return c.SetNX("k", "v", 0, nil) }, []string{"set", "k", "v", "nx"}},
+		{func() error { return c.SetNX("k", "v", 60, nil) }, []string{"set", "k", "v", "nx", "ex", "60"}},
+		{func() error { return c.MGet([]string{"a", "b"}, nil) }, []string{"mget", "a", "b"}},
+		{func() error { return c.MSet(map[string]interface{}{"a": int64(1)}, nil) }, []string{"mset", "a", "1"}},
+		{func() error { return c.Incr("k", nil) }, []string{"incr", "k"}},
+		{func() error { return c.Decr("k", nil) }, []string{"decr", "k"}},
+		{func() error { return c.IncrBy("k", -3, nil) }, []string{"incrby", "k", "-3"}},
+		{func() error { return c.DecrBy("k", 3, nil) }, []string{"decrby", "k", "3"}},
+		{func() error { return c.LLen("k", nil) }, []string{"llen", "k"}},
+		{func() error { return c.RPush("k", []interface{}{"a", 1}, nil) }, []string{"rpush", "k", "a", "1"}},
+		{func() error { return c.RPop("k", nil) }, []string{"rpop", "k"}},
+		{func() error { return c.LPush("k", []interface{}{"a"}, nil) }, []string{"lpush", "k", "a"}},
+		{func() error { return c.LPop("k", nil) }, []string{"lpop", "k"}},
+		{func() error { return c.LIndex("k", -1, nil) }, []string{"lindex", "k", "-1"}},
+		{func() error { return c.LRange("k", 0, -1, nil) }, []string{"lrange", "k", "0", "-1"}},
+		{func() error { return c.LRem("k", 2, "v", nil) }, []string{"lrem", "k", "2", "v"}},
+		{func() error { return c.LInsertBefore("k", "p", "v", nil) }, []string{"linsert", "k", "before", "p", "v"}},
+		{func() error { return c.LInsertAfter("k", "p", "v", nil) }, []string{"linsert", "k", "after", "p", "v"}},
+		{func() error { return c.HExists("k", "f", nil) }, []string{"hexists", "k", "f"}},
+		{func() error { return c.HDel("k", []string{"f", "g"}, nil) }, []string{"hdel", "k", "f", "g"}},
+		{func() error { return c.HLen("k", nil) }, []string{"hlen", "k"}},
+		{func() error { return c.HGet("k", "f", nil) }, []string{"hget", "k", "f"}},
+		{func() error { return c.HSet("k", "f", 2.5, nil) }, []string{"hset", "k", "f", "2.5"}},
+		{func() error { return c.HMGet("k", []string{"f"}, nil) }, []string{"hmget", "k", "f"}},
+		{func() error { return c.HMSet("k", map[string]interface{}{"f": "v"}, nil) }, []string{"hmset", "k", "f", "v"}},
+		{func() error { return c.HKeys("k", nil) }, []string{"hkeys", "k"}},
+		{func() error { return c.HVals("k", nil) }, []string{"hvals", "k"}},
+		{func() error { return c.HGetAll("k", nil) }, []string{"hgetall", "k"}},
+		{func() error { return c.HIncrBy("k", "f", 5, nil) }, []string{"hincrby", "k", "f", "5"}},
+		{func() error { return c.HIncrByFloat("k", "f", 1e-7, nil) }, []string{"hincrbyfloat", "k", "f", "0.0000001"}},
+		{func() error { return c.SCard("k", nil) }, []string{"scard", "k"}},
+		{func() error { return c.SAdd("k", []interface{}{"a"}, nil) }, []string{"sadd", "k", "a"}},
+		{func() error { return c.SRem("k", []interface{}{"a"}, nil) }, []string{"srem", "k", "a"}},
+		{func() error { return c.SIsMember("k", "a", nil) }, []string{"sismember", "k", "a"}},
+		{func() error { return c.SMembers("k", nil) }, []string{"smembers", "k"}},
+		{func() error { return c.SDiff("a", "b", nil) }, []string{"sdiff", "a", "b"}},
+		{func() error { return c.SDiffStore("d", "a", "b", nil) }, []string{"sdiffstore", "d", "a", "b"}},
+		{func() error { return c.SInter("a", "b", nil) }, []string{"sinter", "a", "b"}},
+		{func() error { return c.SInterStore("d", "a", "b", nil) }, []string{"sinterstore", "d", "a", "b"}},
+		{func() error { return c.SUnion("a", "b", nil) }, []string{"sunion", "a", "b"}},
+		{func() error { return c.SUnionStore("d", "a", "b", nil) }, []string{"sunionstore", "d", "a", "b"}},
+		{func() error { return c.ZCard("k", nil) }, []string{"zcard", "k"}},
+		{func() error { return c.ZAdd("k", map[string]interface{}{"m": 1.5}, nil) }, []string{"zadd", "k", "1.5", "m"}},
+		{func() error { return c.ZCount("k", "-inf", 10, nil) }, []string{"zcount", "k", "-inf", "10"}},
+		{func() error { return c.ZIncrBy("k", "m", 2, nil) }, []string{"zincrby", "k", "2", "m"}},
+		{func() error { return c.ZScore("k", "m", nil) }, []string{"zscore", "k", "m"}},
+		{func() error { return c.ZRank("k", "m", nil) }, []string{"zrank", "k", "m"}},
+		{func() error { return c.ZRevRank("k", "m", nil) }, []string{"zrevrank", "k", "m"}},
+		{func() error { return c.ZRem("k", []string{"m"}, nil) }, []string{"zrem", "k", "m"}},
+		{func() error { return c.ZRange("k", 0, 10, nil) }, []string{"zrange", "k", "0", "10"}},
+		{func() error { return c.ZRevRange("k", 0, 10, nil) }, []string{"zrevrange", "k", "0", "10"}},
+	} {
+		assert.NoError(t, tc.call(), tc.expected[0])
+		callouts := host.GetRedisCalloutAttributesFromContext(id)
+		if assert.Len(t, callouts, 1, tc.expected[0]) {
+			assert.Equal(t, respCommand(tc.expected...), string(callouts[0].Query), tc.expected[0])
+			host.CallOnRedisCallResponse(callouts[0].CalloutID, 0, []byte("+OK\r\n"))
+		}
+	}
+}
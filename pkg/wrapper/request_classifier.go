@@ -0,0 +1,339 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+// RequestClass tells what kind of client sent a request
+type RequestClass string
+
+const (
+	RequestClassNormal      RequestClass = "normal"       // No rule of the classifier matched
+	RequestClassHealthCheck RequestClass = "health-check" // Probe of a load balancer or an orchestrator
+	RequestClassBot         RequestClass = "bot"          // Crawler or other automated client
+	RequestClassInternal    RequestClass = "internal"     // Call between services of the same deployment
+
+	// RequestClassAttribute is the user attribute holding the class of a classified request, requests of
+	// the normal class do not set it
+	RequestClassAttribute = "request_class"
+
+	ctxKeyRequestClass = "__request_class__"
+)
+
+// ClassifierRule tags the requests it matches with its class. The conditions of a rule that are set must
+// all match, a condition with several values matches when any of them does.
+type ClassifierRule struct {
+	Class RequestClass
+	// UserAgents are regular expressions matched against the user-agent header
+	UserAgents []*regexp.Regexp
+	// PathPrefixes are matched against the path by segment, "/healthz" matches "/healthz/ready" and
+	// "/healthz?full=1" but not "/healthzz". A prefix ending with a slash matches any path below it.
+	PathPrefixes []string
+	// Headers are regular expressions matched against request headers by lower-case name, a nil
+	// expression matches any value of a present header
+	Headers map[string]*regexp.Regexp
+	// Sources are the ranges of the source address of the connection, i.e. of the downstream peer
+	// and not of an address forwarded in a header
+	Sources *CIDRSet
+}
+
+// Spoofable tells whether a client can send requests the rule matches at will: the user agent, the
+// path and the headers are all set by the client, only the source address of the connection is not.
+func (r *ClassifierRule) Spoofable() bool {
+	return r.Sources == nil || r.Sources.Len() == 0
+}
+
+// RequestClassifier tags requests as health checks, bots or internal calls early, so that plugins can skip
+// expensive processing for them, e.g. in a plugin config:
+//
+//	[
+//	  {"class": "health-check", "pathPrefixes": ["/healthz"], "userAgents": ["^kube-probe/"]},
+//	  {"class": "bot", "userAgents": ["(?i)bot\\b|crawler|spider"]},
+//	  {"class": "internal", "headers": {"x-source": "^billing$"}, "sources": ["10.0.0.0/8"]}
+//	]
+//
+// The first rule matching a request sets its class. Classes are free-form, other than the predefined ones.
+//
+// Every condition but sources is on data the client chooses: anyone can send a kube-probe user agent,
+// a health check path or an internal header. The class of a request matched by such a spoofable rule
+// is a hint for telemetry, sampling or rate limits, never a reason to trust the request.
+type RequestClassifier struct {
+	Rules []ClassifierRule
+}
+
+// DefaultRequestClassifier returns a classifier of the probes of common load balancers and orchestrators,
+// and of the clients that announce themselves as bots. Its rules are spoofable, see RequestClassifier.
+func DefaultRequestClassifier() *RequestClassifier {
+	return &RequestClassifier{Rules: []ClassifierRule{
+		{
+			Class:      RequestClassHealthCheck,
+			UserAgents: []*regexp.Regexp{regexp.MustCompile(`^(kube-probe|ELB-HealthChecker|GoogleHC|Consul Health Check|Envoy/HC)`)},
+		},
+		{
+			Class:        RequestClassHealthCheck,
+			PathPrefixes: []string{"/healthz", "/readyz", "/livez"},
+		},
+		{
+			Class:      RequestClassBot,
+			UserAgents: []*regexp.Regexp{regexp.MustCompile(`(?i)bot\b|crawler|spider|slurp`)},
+		},
+	}}
+}
+
+// ParseRequestClassifier parses an array of classifier rules.
+func ParseRequestClassifier(json gjson.Result) (*RequestClassifier, error) {
+	if !json.Exists() {
+		return &RequestClassifier{}, nil
+	}
+	if !json.IsArray() {
+		return nil, configerr.New("", "array", fmt.Errorf("classifier rules must be an array"))
+	}
+	classifier := &RequestClassifier{}
+	for i, item := range json.Array() {
+		rule, err := parseClassifierRule(item)
+		if err != nil {
+			return nil, configerr.Prefix(configerr.Pointer(i), err)
+		}
+		classifier.Rules = append(classifier.Rules, rule)
+	}
+	return classifier, nil
+}
+
+func parseClassifierRule(json gjson.Result) (ClassifierRule, error) {
+	if !json.IsObject() {
+		return ClassifierRule{}, configerr.New("", "object", fmt.Errorf("classifier rule must be an object"))
+	}
+	rule := ClassifierRule{Class: RequestClass(json.Get("class").String())}
+	if rule.Class == "" {
+		return rule, configerr.Errorf("/class", "string", "classifier rule class is required")
+	}
+	for i, pattern := range json.Get("userAgents").Array() {
+		re, err := regexp.Compile(pattern.String())
+		if err != nil {
+			return rule, configerr.Errorf(configerr.Pointer("userAgents", i), "regular expression", "failed to compile pattern: %v", err)
+		}
+		rule.UserAgents = append(rule.UserAgents, re)
+	}
+	for i, prefix := range json.Get("pathPrefixes").Array() {
+		if !strings.HasPrefix(prefix.String(), "/") {
+			return rule, configerr.Errorf(configerr.Pointer("pathPrefixes", i), "path starting with /", "invalid path prefix: %s", prefix.String())
+		}
+		rule.PathPrefixes = append(rule.PathPrefixes, prefix.String())
+	}
+	if sources := json.Get("sources"); sources.Exists() {
+		var cidrs []string
+		for _, source := range sources.Array() {
+			cidrs = append(cidrs, source.String())
+		}
+		set, err := NewCIDRSet(cidrs...)
+		if err != nil {
+			return rule, configerr.Prefix("/sources", err)
+		}
+		rule.Sources = set
+	}
+	var err error
+	json.Get("headers").ForEach(func(name, pattern gjson.Result) bool {
+		if rule.Headers == nil {
+			rule.Headers = make(map[string]*regexp.Regexp)
+		}
+		var re *regexp.Regexp
+		if pattern.String() != "" {
+			if re, err = regexp.Compile(pattern.String()); err != nil {
+				err = configerr.Errorf(configerr.Pointer("headers", name.String()), "regular expression", "failed to compile pattern: %v", err)
+				return false
+			}
+		}
+		rule.Headers[strings.ToLower(name.String())] = re
+		return true
+	})
+	if err != nil {
+		return rule, err
+	}
+	if len(rule.UserAgents) == 0 && len(rule.PathPrefixes) == 0 && len(rule.Headers) == 0 && rule.Spoofable() {
+		return rule, configerr.Errorf("", "userAgents, pathPrefixes, headers or sources", "classifier rule %s has no condition", rule.Class)
+	}
+	return rule, nil
+}
+
+// Classify returns the class of the current request, RequestClassNormal when no rule matches. It only reads
+// the request headers, so it must be called in the request header phase.
+func (c *RequestClassifier) Classify() RequestClass {
+	class, _ := c.classify()
+	return class
+}
+
+// classify returns the class of the current request and the rule that matched it, nil when none did
+func (c *RequestClassifier) classify() (RequestClass, *ClassifierRule) {
+	if len(c.Rules) == 0 {
+		return RequestClassNormal, nil
+	}
+	headers, _ := proxywasm.GetHttpRequestHeaders()
+	var userAgent, path string
+	for _, h := range headers {
+		switch strings.ToLower(h[0]) {
+		case "user-agent":
+			userAgent = h[1]
+		case ":path":
+			path = h[1]
+		}
+	}
+	source := ""
+	for i := range c.Rules {
+		if !c.Rules[i].Spoofable() {
+			address, _ := proxywasm.GetProperty([]string{"source", "address"})
+			source = string(address)
+			break
+		}
+	}
+	for i := range c.Rules {
+		if rule := &c.Rules[i]; rule.matches(userAgent, path, source, headers) {
+			return rule.Class, rule
+		}
+	}
+	return RequestClassNormal, nil
+}
+
+func (r *ClassifierRule) matches(userAgent, path, source string, headers [][2]string) bool {
+	if !r.Spoofable() && !r.Sources.Contains(source) {
+		return false
+	}
+	if len(r.UserAgents) > 0 && !anyPatternMatches(r.UserAgents, userAgent) {
+		return false
+	}
+	if len(r.PathPrefixes) > 0 && !anyPathPrefixMatches(r.PathPrefixes, path) {
+		return false
+	}
+	for name, pattern := range r.Headers {
+		found := false
+		for _, h := range headers {
+			if strings.EqualFold(h[0], name) && (pattern == nil || pattern.MatchString(h[1])) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func anyPatternMatches(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyPathPrefixMatches(prefixes []string, path string) bool {
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if len(path) == len(prefix) || strings.HasSuffix(prefix, "/") {
+			return true
+		}
+		if next := path[len(prefix)]; next == '/' || next == '?' {
+			return true
+		}
+	}
+	return false
+}
+
+// Tag classifies the current request and records its class, which is then returned by GetRequestClass and
+// written to the user attribute RequestClassAttribute unless it is RequestClassNormal
+func (c *RequestClassifier) Tag(ctx HttpContext) RequestClass {
+	class, _ := c.tag(ctx)
+	return class
+}
+
+func (c *RequestClassifier) tag(ctx HttpContext) (RequestClass, *ClassifierRule) {
+	class, rule := c.classify()
+	ctx.SetContext(ctxKeyRequestClass, class)
+	if class != RequestClassNormal {
+		ctx.SetUserAttribute(RequestClassAttribute, string(class))
+	}
+	return class, rule
+}
+
+// GetRequestClass returns the class recorded by WithRequestClassifier or RequestClassifier.Tag,
+// RequestClassNormal for requests that were not classified
+func GetRequestClass(ctx HttpContext) RequestClass {
+	if class, ok := ctx.GetContext(ctxKeyRequestClass).(RequestClass); ok {
+		return class
+	}
+	return RequestClassNormal
+}
+
+type requestClassifierOption[PluginConfig any] struct {
+	classifier *RequestClassifier
+	skip       []RequestClass
+}
+
+func (o *requestClassifierOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.requestClassifier = o.classifier
+	ctx.skippedRequestClasses = make(map[RequestClass]bool, len(o.skip))
+	for _, class := range o.skip {
+		ctx.skippedRequestClasses[class] = true
+	}
+}
+
+// WithRequestClassifier tags every request with the classifier before the request header handler runs, e.g.
+//
+//	probes, _ := wrapper.NewCIDRSet("10.0.0.0/8")
+//	classifier := &wrapper.RequestClassifier{Rules: []wrapper.ClassifierRule{
+//		{Class: wrapper.RequestClassHealthCheck, PathPrefixes: []string{"/healthz"}, Sources: probes},
+//	}}
+//	wrapper.WithRequestClassifier[PluginConfig](classifier, wrapper.RequestClassHealthCheck)
+//
+// Requests of the skipped classes pass through the plugin, none of its handlers is called for them. Skipping
+// a plugin lets a request through unchecked, so a request is only skipped when the rule that matched it is
+// not spoofable, i.e. it has sources: a client could otherwise bypass an authentication or a rate limit
+// plugin by sending a bot user agent or a health check path. Requests matched by a spoofable rule are
+// tagged with their class but not skipped. The class of other requests is returned by GetRequestClass in
+// every phase.
+func WithRequestClassifier[PluginConfig any](classifier *RequestClassifier, skip ...RequestClass) CtxOption[PluginConfig] {
+	return &requestClassifierOption[PluginConfig]{classifier: classifier, skip: skip}
+}
+
+// classifyRequest tags the request with the classifier of the VM, it returns true when the plugin skips the
+// request
+func (ctx *CommonHttpCtx[PluginConfig]) classifyRequest() bool {
+	if ctx.plugin.vm.requestClassifier == nil {
+		return false
+	}
+	class, rule := ctx.plugin.vm.requestClassifier.tag(ctx)
+	if class == RequestClassNormal {
+		return false
+	}
+	skipped := ctx.plugin.vm.skippedRequestClasses[class]
+	if skipped && rule.Spoofable() {
+		ctx.plugin.vm.log.Debugf("request classified as %s by a spoofable rule, not skipped", class)
+		return false
+	}
+	ctx.plugin.vm.log.Debugf("request classified as %s, skipped: %t", class, skipped)
+	return skipped
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseRequestClassifier(t *testing.T) {
+	classifier, err := ParseRequestClassifier(gjson.Parse(`[
+		{"class": "health-check", "pathPrefixes": ["/healthz", "/status/"], "userAgents": ["^kube-probe/", "^curl/"]},
+		{"class": "internal", "headers": {"X-Internal-Token": "", "x-source": "^billing$"}},
+		{"class": "internal", "sources": ["10.0.0.0/8", "fd00::1"]}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, classifier.Rules, 3)
+	assert.Contains(t, classifier.Rules[1].Headers, "x-internal-token")
+	assert.True(t, classifier.Rules[1].Spoofable())
+	assert.False(t, classifier.Rules[2].Spoofable())
+	assert.True(t, classifier.Rules[2].Sources.Contains("10.1.2.3:5000"))
+
+	for path, expected := range map[string]bool{
+		"/healthz": true, "/healthz/ready": true, "/healthz?full=1": true, "/healthzz": false,
+		"/status/": true, "/status/db": true, "/status": false, "/api": false,
+	} {
+		assert.Equal(t, expected, anyPathPrefixMatches(classifier.Rules[0].PathPrefixes, path), path)
+	}
+
+	for config, message := range map[string]string{
+		`{}`:                        `invalid config at "/", expected array`,
+		`[{"userAgents": ["bot"]}]`: `invalid config at "/0/class"`,
+		`[{"class": "bot"}]`:        `invalid config at "/0", expected userAgents, pathPrefixes, headers or sources`,
+		`[{"class": "bot", "sources": ["10.0.0.0/33"]}]`:  `invalid config at "/0/sources/0"`,
+		`[{"class": "bot", "userAgents": ["("]}]`:         `invalid config at "/0/userAgents/0"`,
+		`[{"class": "bot", "pathPrefixes": ["healthz"]}]`: `invalid config at "/0/pathPrefixes/0"`,
+		`[{"class": "bot", "headers": {"x-bot": "[a-"}}]`: `invalid config at "/0/headers/x-bot"`,
+	} {
+		_, err := ParseRequestClassifier(gjson.Parse(config))
+		assert.ErrorContains(t, err, message, config)
+	}
+}
+
+func TestWithRequestClassifier(t *testing.T) {
+	var handled []RequestClass
+	var attribute interface{}
+	classifier := DefaultRequestClassifier()
+	probes, err := NewCIDRSet("10.0.0.0/8")
+	require.NoError(t, err)
+	classifier.Rules = append([]ClassifierRule{{Class: RequestClassHealthCheck, PathPrefixes: []string{"/healthz"}, Sources: probes}}, classifier.Rules...)
+	vm := NewCommonVmCtx[struct{}]("classifier-test",
+		WithRequestClassifier[struct{}](classifier, RequestClassHealthCheck),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			handled = append(handled, GetRequestClass(ctx))
+			attribute = ctx.GetUserAttribute(RequestClassAttribute)
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	request := func(source, path, userAgent string) {
+		require.NoError(t, host.SetProperty([]string{"source", "address"}, []byte(source+":43210")))
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", path}, {"user-agent", userAgent}}, true)
+		host.CompleteHttpContext(id)
+	}
+
+	request("10.0.0.2", "/healthz", "curl/8.0")
+	assert.Empty(t, handled, "health checks from the probe network skip the plugin")
+
+	// Spoofable rules tag requests without skipping the plugin
+	request("1.1.1.1", "/healthz", "curl/8.0")
+	request("10.0.0.2", "/", "kube-probe/1.29")
+	assert.Equal(t, []RequestClass{RequestClassHealthCheck, RequestClassHealthCheck}, handled)
+	assert.Equal(t, "health-check", attribute)
+
+	handled = nil
+	request("1.1.1.1", "/products", "Mozilla/5.0 (compatible; Googlebot/2.1)")
+	assert.Equal(t, []RequestClass{RequestClassBot}, handled)
+	assert.Equal(t, "bot", attribute)
+
+	request("1.1.1.1", "/products", "Mozilla/5.0")
+	assert.Equal(t, []RequestClass{RequestClassBot, RequestClassNormal}, handled)
+	assert.Nil(t, attribute)
+}
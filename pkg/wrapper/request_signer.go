@@ -0,0 +1,229 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	hmacAlgorithm   = "HMAC-SHA256"
+	signingDateTime = "20060102T150405Z"
+)
+
+// SigningRequest is a callout to sign. Sign adds its headers to Headers, which never contain the
+// :method, :path and :authority pseudo headers.
+type SigningRequest struct {
+	Method string
+	Host   string
+	// Path is the escaped path of the URL
+	Path string
+	// Query is the raw query of the URL
+	Query   string
+	Headers [][2]string
+	Body    []byte
+	Time    time.Time
+}
+
+// RequestSigner signs the callouts of a ClusterClient, e.g. with SigV4Signer, HMACSigner or WebhookSigner.
+type RequestSigner interface {
+	Sign(req *SigningRequest) error
+}
+
+// SigV4Signer signs callouts with AWS Signature Version 4, for S3, Bedrock and the services
+// compatible with it such as OSS.
+type SigV4Signer struct {
+	AccessKey string
+	SecretKey string
+	// SessionToken is the token of temporary credentials, sent as x-amz-security-token
+	SessionToken string
+	Region       string
+	Service      string
+}
+
+// Sign adds the x-amz-date, x-amz-security-token, x-amz-content-sha256 (for S3) and Authorization headers
+func (s *SigV4Signer) Sign(req *SigningRequest) error {
+	if s.AccessKey == "" || s.SecretKey == "" || s.Region == "" || s.Service == "" {
+		return errors.New("sigv4 signer requires an access key, a secret key, a region and a service")
+	}
+	dateTime := req.Time.UTC().Format(signingDateTime)
+	date := dateTime[:8]
+	payloadHash := sha256Hex(req.Body)
+	req.setHeader("x-amz-date", dateTime)
+	if s.SessionToken != "" {
+		req.setHeader("x-amz-security-token", s.SessionToken)
+	}
+	path := req.Path
+	if s.Service == "s3" {
+		req.setHeader("x-amz-content-sha256", payloadHash)
+	} else {
+		// The services other than S3 expect the escaped path to be escaped once more
+		path = uriEscape(path, false)
+	}
+	signed, canonicalHeaders := req.canonicalHeaders(func(name string) bool {
+		return strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "content-md5"
+	})
+	canonicalRequest := strings.Join([]string{req.Method, canonicalPath(path), canonicalQuery(req.Query),
+		canonicalHeaders, signed, payloadHash}, "\n")
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{sigV4Algorithm, dateTime, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.setHeader("authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, s.AccessKey, scope, signed, signature))
+	return nil
+}
+
+// HMACSigner signs callouts with HMAC-SHA256 over a canonical request, for the APIs that follow
+// SigV4 without its credential scope. The string to sign is
+//
+//	HMAC-SHA256\n<x-date>\n<hex sha256 of the canonical request>
+//
+// and the canonical request is built as for SigV4, from the method, path, sorted query, signed
+// headers and hex sha256 of the body. The Authorization header is
+//
+//	HMAC-SHA256 Credential=<KeyID>, SignedHeaders=<headers>, Signature=<hex signature>
+type HMACSigner struct {
+	KeyID  string
+	Secret string
+	// SignedHeaders are the headers signed besides host and x-date, when the callout has them
+	SignedHeaders []string
+}
+
+// Sign adds the x-date and Authorization headers
+func (s *HMACSigner) Sign(req *SigningRequest) error {
+	if s.KeyID == "" || s.Secret == "" {
+		return errors.New("hmac signer requires a key id and a secret")
+	}
+	dateTime := req.Time.UTC().Format(signingDateTime)
+	req.setHeader("x-date", dateTime)
+	signed, canonicalHeaders := req.canonicalHeaders(func(name string) bool {
+		if name == "x-date" {
+			return true
+		}
+		for _, h := range s.SignedHeaders {
+			if strings.EqualFold(h, name) {
+				return true
+			}
+		}
+		return false
+	})
+	canonicalRequest := strings.Join([]string{req.Method, canonicalPath(req.Path), canonicalQuery(req.Query),
+		canonicalHeaders, signed, sha256Hex(req.Body)}, "\n")
+	stringToSign := strings.Join([]string{hmacAlgorithm, dateTime, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signature := hex.EncodeToString(hmacSHA256([]byte(s.Secret), stringToSign))
+	req.setHeader("authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s",
+		hmacAlgorithm, s.KeyID, signed, signature))
+	return nil
+}
+
+// setHeader replaces the values of a header
+func (req *SigningRequest) setHeader(key, value string) {
+	req.Headers = append(removeHeader(req.Headers, key), [2]string{key, value})
+}
+
+// canonicalHeaders returns the sorted names of host and of the headers to sign joined with ";", and
+// their canonical form: one lowercase name:value line per header, the values of repeated headers
+// joined with ","
+func (req *SigningRequest) canonicalHeaders(sign func(name string) bool) (string, string) {
+	values := map[string][]string{"host": {req.Host}}
+	for _, h := range req.Headers {
+		name := strings.ToLower(h[0])
+		if name != "host" && sign(name) {
+			values[name] = append(values[name], strings.Join(strings.Fields(h[1]), " "))
+		}
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.Join(values[name], ",") + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// canonicalQuery returns the query parameters escaped and sorted by name, then value
+func canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	// ParseQuery keeps the parameters that parse, like the server would
+	values, _ := url.ParseQuery(rawQuery)
+	params := make([][2]string, 0, len(values))
+	for name, vs := range values {
+		for _, v := range vs {
+			params = append(params, [2]string{uriEscape(name, true), uriEscape(v, true)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEscape escapes every byte but the unreserved characters, and "/" unless escapeSlash is set
+func uriEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !escapeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func signedHeader(headers [][2]string, key string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h[0], key) {
+			return h[1]
+		}
+	}
+	return ""
+}
+
+func TestSigV4Signer(t *testing.T) {
+	// The requests of the AWS SigV4 test suite
+	signer := &SigV4Signer{
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:    "us-east-1",
+		Service:   "service",
+	}
+	signingTime := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		query     string
+		signature string
+	}{
+		{"get-vanilla", "", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &SigningRequest{Method: "GET", Host: "example.amazonaws.com", Path: "/", Query: tt.query, Time: signingTime}
+			assert.NoError(t, signer.Sign(req))
+			assert.Equal(t, "20150830T123600Z", signedHeader(req.Headers, "x-amz-date"))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders=host;x-amz-date, Signature="+tt.signature, signedHeader(req.Headers, "authorization"))
+		})
+	}
+
+	t.Run("s3", func(t *testing.T) {
+		s3 := &SigV4Signer{AccessKey: "ak", SecretKey: "sk", SessionToken: "token", Region: "us-east-1", Service: "s3"}
+		req := &SigningRequest{Method: "PUT", Host: "bucket.s3.amazonaws.com", Path: "/a%20b.txt", Body: []byte("hello"),
+			Headers: [][2]string{{"Authorization", "stale"}, {"Content-Type", "text/plain"}}, Time: signingTime}
+		assert.NoError(t, s3.Sign(req))
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", signedHeader(req.Headers, "x-amz-content-sha256"))
+		assert.Equal(t, "token", signedHeader(req.Headers, "x-amz-security-token"))
+		authorization := signedHeader(req.Headers, "authorization")
+		assert.Contains(t, authorization, "SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token,")
+		assert.NotContains(t, req.Headers, [2]string{"Authorization", "stale"})
+	})
+
+	t.Run("missing credentials", func(t *testing.T) {
+		assert.Error(t, (&SigV4Signer{Region: "us-east-1", Service: "bedrock"}).Sign(&SigningRequest{}))
+	})
+}
+
+func TestHMACSigner(t *testing.T) {
+	signer := &HMACSigner{KeyID: "key-1", Secret: "secret", SignedHeaders: []string{"Content-Type"}}
+	signingTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sign := func(body string) string {
+		req := &SigningRequest{Method: "POST", Host: "api.example.com", Path: "/v1/chat", Query: "b=2&a=1",
+			Headers: [][2]string{{"Content-Type", "application/json"}, {"X-Other", "1"}}, Body: []byte(body), Time: signingTime}
+		assert.NoError(t, signer.Sign(req))
+		assert.Equal(t, "20240102T030405Z", signedHeader(req.Headers, "x-date"))
+		return signedHeader(req.Headers, "authorization")
+	}
+	authorization := sign(`{}`)
+	assert.True(t, strings.HasPrefix(authorization, "HMAC-SHA256 Credential=key-1, SignedHeaders=content-type;host;x-date, Signature="), authorization)
+	assert.Equal(t, authorization, sign(`{}`))
+	assert.NotEqual(t, authorization, sign(`{"a":1}`), "the body is signed")
+
+	assert.Error(t, (&HMACSigner{KeyID: "key-1"}).Sign(&SigningRequest{}))
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	assert.Equal(t, "", canonicalQuery(""))
+	assert.Equal(t, "a=1&a=2&a-b=3&c=x%20y%2Fz", canonicalQuery("c=x+y/z&a=2&a-b=3&a=1"))
+	assert.Equal(t, "/a%2520b/c", uriEscape("/a%20b/c", false))
+}
+
+func TestClusterClientWithRequestSigner(t *testing.T) {
+	type signerConfig struct {
+		client *ClusterClient[FQDNCluster]
+	}
+	var status int
+	vm := NewCommonVmCtx("request-signer-test",
+		ParseConfig(func(json gjson.Result, config *signerConfig) error {
+			config.client = NewClusterClient(FQDNCluster{FQDN: "bedrock.dns", Host: "bedrock-runtime.us-east-1.amazonaws.com", Port: 443},
+				WithRequestSigner(&SigV4Signer{AccessKey: "ak", SecretKey: "sk", Region: "us-east-1", Service: "bedrock"}))
+			return nil
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config signerConfig) types.Action {
+			headers := [][2]string{{"Content-Type", "application/json"}}
+			config.client.Post("/model/claude/invoke", headers, []byte(`{}`), func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+				status = statusCode
+			})
+			assert.Len(t, headers, 1, "the headers of the caller are not modified")
+			return types.ActionPause
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	callouts := host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		headers := callouts[0].Headers
+		assert.Contains(t, headers, [2]string{":authority", "bedrock-runtime.us-east-1.amazonaws.com"})
+		assert.NotEmpty(t, signedHeader(headers, "x-amz-date"))
+		assert.Contains(t, signedHeader(headers, "authorization"), "/us-east-1/bedrock/aws4_request, SignedHeaders=content-type;host;x-amz-date,")
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	}
+	assert.Equal(t, 200, status)
+}
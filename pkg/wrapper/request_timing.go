@@ -0,0 +1,173 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+const (
+	// TimingsAttribute is the user attribute holding the timings of the request in milliseconds by phase,
+	// e.g. {"request_headers":0.05,"callout:outbound|80||auth.example.com":12.3}
+	TimingsAttribute = "timings"
+
+	TimingRequestHeaders  = "request_headers"
+	TimingRequestBody     = "request_body"
+	TimingResponseHeaders = "response_headers"
+	TimingResponseBody    = "response_body"
+)
+
+// TimingExport selects where the timings of a request are reported besides TimingsAttribute
+type TimingExport int
+
+const (
+	// LogTimings logs the timings of every request when it is done
+	LogTimings TimingExport = 1 << iota
+	// TraceTimings adds every timing to the trace span as the tag trace_span_tag.timing.<phase>
+	TraceTimings
+)
+
+type requestTimingsOption[PluginConfig any] struct {
+	export TimingExport
+}
+
+func (o *requestTimingsOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.requestTimings = true
+	ctx.timingExport = o.export
+}
+
+// WithRequestTimings records the time spent in every phase of a request and waiting for each of its
+// HTTP and Redis callouts, available with HttpContext.GetTimings and in the user attribute
+// TimingsAttribute, so that they end up in the access log with WriteUserAttributeToLog.
+func WithRequestTimings[PluginConfig any](export ...TimingExport) CtxOption[PluginConfig] {
+	o := &requestTimingsOption[PluginConfig]{}
+	for _, e := range export {
+		o.export |= e
+	}
+	return o
+}
+
+// requestTimings are the timings of a request
+type requestTimings struct {
+	timings []iface.PhaseTiming
+	// The value of TimingsAttribute, updated in place as the timings are recorded
+	attribute    map[string]float64
+	export       TimingExport
+	setAttribute func(key string, value interface{})
+}
+
+// timedRequests are the requests of plugins using WithRequestTimings by context id, used to time
+// the callouts made by the package level HttpCall and Redis functions
+var timedRequests = map[uint32]*requestTimings{}
+
+// record adds the duration to the phase, a unique phase gets a new entry if the name is taken
+func (t *requestTimings) record(name string, duration time.Duration, unique bool) {
+	if unique {
+		base := name
+		for n := 2; t.index(name) >= 0; n++ {
+			name = fmt.Sprintf("%s#%d", base, n)
+		}
+	}
+	i := t.index(name)
+	if i < 0 {
+		t.timings = append(t.timings, iface.PhaseTiming{Name: name})
+		i = len(t.timings) - 1
+	}
+	t.timings[i].Duration += duration
+	if t.attribute == nil {
+		t.attribute = make(map[string]float64)
+	}
+	t.attribute[name] = durationMillis(t.timings[i].Duration)
+	// Set again in case the plugin replaced the user attributes with SetUserAttributeMap
+	t.setAttribute(TimingsAttribute, t.attribute)
+	if t.export&TraceTimings != 0 {
+		_ = proxywasm.SetProperty([]string{TraceSpanTagPrefix + "timing." + name}, []byte(strconv.FormatFloat(durationMillis(t.timings[i].Duration), 'f', -1, 64)))
+	}
+}
+
+func (t *requestTimings) index(name string) int {
+	for i, timing := range t.timings {
+		if timing.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *requestTimings) String() string {
+	parts := make([]string, 0, len(t.timings))
+	for _, timing := range t.timings {
+		parts = append(parts, fmt.Sprintf("%s=%s", timing.Name, timing.Duration))
+	}
+	return strings.Join(parts, " ")
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// startTiming starts timing a phase of the request, the returned function ends it
+func (ctx *CommonHttpCtx[PluginConfig]) startTiming(name string) func() {
+	if ctx.timings == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		ctx.timings.record(name, time.Since(start), false)
+	}
+}
+
+// finishTimings logs the timings of a done request
+func (ctx *CommonHttpCtx[PluginConfig]) finishTimings() {
+	if ctx.timings == nil {
+		return
+	}
+	delete(timedRequests, ctx.contextID)
+	if ctx.timings.export&LogTimings != 0 {
+		ctx.plugin.vm.log.Infof("request timings: %s", ctx.timings)
+	}
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) GetTimings() []iface.PhaseTiming {
+	if ctx.timings == nil {
+		return nil
+	}
+	return ctx.timings.timings
+}
+
+// startCalloutTiming starts timing a callout made in the context of the active request, the
+// returned function is called when the response arrives and makes the request active again
+func startCalloutTiming(kind, clusterName string) func() {
+	contextID := activeHttpContextID
+	timings := timedRequests[contextID]
+	telemetry := telemetryRequests[contextID]
+	start := time.Now()
+	return func() {
+		activeHttpContextID = contextID
+		if timings != nil {
+			timings.record(kind+":"+clusterName, time.Since(start), true)
+		}
+		if telemetry != nil {
+			telemetry.calloutDone()
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/resp"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+func TestRequestTimings(t *testing.T) {
+	var timings []iface.PhaseTiming
+	var attribute interface{}
+	client := NewClusterClient(FQDNCluster{FQDN: "auth.example.com", Port: 80})
+	vm := NewCommonVmCtx[struct{}]("request-timings-test",
+		WithRequestTimings[struct{}](LogTimings, TraceTimings),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			for _, path := range []string{"/a", "/b"} {
+				client.Get(path, nil, func(int, http.Header, []byte) {
+					proxywasm.ResumeHttpRequest()
+				})
+			}
+			return types.ActionPause
+		}),
+		ProcessResponseBody(func(ctx HttpContext, config struct{}, body []byte) types.Action {
+			time.Sleep(time.Millisecond)
+			return types.ActionContinue
+		}),
+		ProcessStreamDone(func(ctx HttpContext, config struct{}) {
+			timings = ctx.GetTimings()
+			attribute = ctx.GetUserAttribute(TimingsAttribute)
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	for _, callout := range host.GetCalloutAttributesFromContext(id) {
+		host.CallOnHttpCallResponse(callout.CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	}
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, false)
+	host.CallOnResponseBody(id, []byte("a"), false)
+	host.CallOnResponseBody(id, []byte("b"), true)
+	host.CompleteHttpContext(id)
+
+	var names []string
+	for _, timing := range timings {
+		names = append(names, timing.Name)
+	}
+	cluster := "outbound|80||auth.example.com"
+	assert.Equal(t, []string{TimingRequestHeaders, "callout:" + cluster, "callout:" + cluster + "#2", TimingResponseHeaders, TimingResponseBody}, names)
+	// The chunks of the response body add up to a single phase
+	assert.GreaterOrEqual(t, timings[4].Duration, time.Millisecond)
+
+	require.IsType(t, map[string]float64{}, attribute)
+	assert.Len(t, attribute, 5)
+	assert.GreaterOrEqual(t, attribute.(map[string]float64)[TimingResponseBody], 1.0)
+
+	span, err := host.GetProperty([]string{TraceSpanTagPrefix + "timing." + TimingResponseBody})
+	require.NoError(t, err)
+	assert.NotEmpty(t, span)
+	var logged bool
+	for _, l := range host.GetInfoLogs() {
+		logged = logged || strings.Contains(l, "request timings: request_headers=")
+	}
+	assert.True(t, logged)
+	assert.Empty(t, timedRequests)
+}
+
+func TestCalloutTimingContext(t *testing.T) {
+	type timingConfig struct {
+		redis RedisClient
+	}
+	client := NewClusterClient(FQDNCluster{FQDN: "auth.example.com", Port: 80})
+	tickClient := NewClusterClient(FQDNCluster{FQDN: "tick.example.com", Port: 80})
+	vm := NewCommonVmCtx("callout-timing-context-test",
+		WithRequestTimings[timingConfig](),
+		ParseConfig(func(json gjson.Result, config *timingConfig) error {
+			config.redis = NewRedisClusterClient(FQDNCluster{FQDN: "redis.example.com", Port: 6379})
+			RegisterTickFunc(100, func() {
+				tickClient.Get("/tick", nil, func(int, http.Header, []byte) {})
+			})
+			return config.redis.Init("", "", 1000)
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config timingConfig) types.Action {
+			config.redis.Get("key", func(resp.Value) {
+				client.Get("/check", nil, func(int, http.Header, []byte) {
+					proxywasm.ResumeHttpRequest()
+				})
+			})
+			return types.ActionPause
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	first, second := host.InitializeHttpContext(), host.InitializeHttpContext()
+	host.CallOnRequestHeaders(first, [][2]string{{":authority", "example.com"}, {":path", "/first"}}, true)
+	host.CallOnRequestHeaders(second, [][2]string{{":authority", "example.com"}, {":path", "/second"}}, true)
+	names := func(id uint32) []string {
+		var names []string
+		for _, timing := range timedRequests[id].timings {
+			names = append(names, timing.Name)
+		}
+		return names
+	}
+
+	host.Tick()
+	callouts := host.GetCalloutAttributesFromContext(proxytest.PluginContextID)
+	require.Len(t, callouts, 1)
+	host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	assert.Equal(t, []string{TimingRequestHeaders}, names(second), "the callout of the tick is not timed for the last request")
+
+	redisCallouts := host.GetRedisCalloutAttributesFromContext(first)
+	require.Len(t, redisCallouts, 1)
+	host.CallOnRedisCallResponse(redisCallouts[0].CalloutID, 0, []byte("$1\r\nv\r\n"))
+	callouts = host.GetCalloutAttributesFromContext(first)
+	require.Len(t, callouts, 1, "the redis callback runs in the context of its request")
+	host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	assert.Equal(t, []string{TimingRequestHeaders, "redis:outbound|6379||redis.example.com", "callout:outbound|80||auth.example.com"}, names(first))
+	assert.Equal(t, []string{TimingRequestHeaders}, names(second))
+}
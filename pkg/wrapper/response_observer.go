@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+)
+
+// ResponseBodyObserver receives the response body without being able to modify it, which allows
+// shared helpers to hook into the body phase regardless of how the plugin itself processes it.
+type ResponseBodyObserver struct {
+	// OnChunk is called with each chunk before the plugin sees it. When the plugin buffers the
+	// response body, it is called once with the whole body instead.
+	OnChunk func(context HttpContext, chunk []byte, isLastChunk bool)
+	// OnDone is called when the stream is done, before the plugin's stream done callback.
+	OnDone func(context HttpContext)
+}
+
+type observeResponseBodyOption[PluginConfig any] struct {
+	observer ResponseBodyObserver
+}
+
+func (o *observeResponseBodyOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.responseBodyObservers = append(ctx.responseBodyObservers, o.observer)
+}
+
+// ObserveResponseBody registers an observer of the response body. It can be combined with any of
+// the response body options, and registering several observers is allowed.
+// Observers are skipped for requests whose response body is not read, see DontReadResponseBody.
+func ObserveResponseBody[PluginConfig any](observer ResponseBodyObserver) CtxOption[PluginConfig] {
+	return &observeResponseBodyOption[PluginConfig]{observer: observer}
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) observeResponseBody(bodySize int, endOfStream bool) {
+	if len(ctx.plugin.vm.responseBodyObservers) == 0 {
+		return
+	}
+	streaming := ctx.plugin.vm.onHttpStreamingResponseBody != nil && ctx.streamingResponseBody
+	if !streaming && ctx.plugin.vm.onHttpResponseBody != nil && !endOfStream {
+		// The body is buffered for the plugin, observe it as a whole at the end of stream
+		return
+	}
+	var body []byte
+	if bodySize > 0 {
+		var err error
+		if body, err = proxywasm.GetHttpResponseBody(0, bodySize); err != nil {
+			ctx.plugin.vm.log.Warnf("get response body for observers failed: %v", err)
+			return
+		}
+	}
+	for _, observer := range ctx.plugin.vm.responseBodyObservers {
+		if observer.OnChunk != nil {
+			observer.OnChunk(ctx, body, endOfStream)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = time.Second
+)
+
+// ErrRetryTimeout is returned for attempts of a RetryClient that would start once its retry budget is used up
+var ErrRetryTimeout = fmt.Errorf("%w: retry budget is used up", ErrCalloutFailed)
+
+// RetryClient retries the callouts of another HttpClient with exponential backoff. Backoff delays
+// are served by onTick, so they have a granularity of 100ms. Every method is retried, including
+// non-idempotent ones, so only wrap clients of services where that is safe.
+type RetryClient struct {
+	client      HttpClient
+	maxAttempts int
+	isRetryable func(statusCode int) bool
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	budget      time.Duration
+	delayed     []delayedCallout
+}
+
+type delayedCallout struct {
+	due       time.Time
+	contextID uint32
+	dispatch  func()
+}
+
+type RetryOption func(c *RetryClient)
+
+// WithMaxAttempts sets the number of attempts including the first one, default 3.
+func WithMaxAttempts(maxAttempts int) RetryOption {
+	return func(c *RetryClient) {
+		c.maxAttempts = maxAttempts
+	}
+}
+
+// WithRetryStatus sets which response status codes are retried, default 429, 502, 503 and 504.
+func WithRetryStatus(isRetryable func(statusCode int) bool) RetryOption {
+	return func(c *RetryClient) {
+		c.isRetryable = isRetryable
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled for every further retry up to maxBackoff,
+// default 100ms and 1s. A zero base retries right away.
+func WithBackoff(base, maxBackoff time.Duration) RetryOption {
+	return func(c *RetryClient) {
+		c.baseBackoff = base
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithRetryBudget limits the time spent on all attempts of a callout. The timeout of every attempt is
+// cut to the remaining budget, and no retry is made once the budget is used up: a retry whose backoff ends
+// too late is not scheduled, and one dispatched too late fails with ErrRetryTimeout, in both cases the
+// callback receives the response of the last attempt. Default unlimited.
+func WithRetryBudget(budget time.Duration) RetryOption {
+	return func(c *RetryClient) {
+		c.budget = budget
+	}
+}
+
+// NewRetryClient wraps a client with retries. It must be created in the config phase, since the
+// onTick function serving backoff delays can only be registered there.
+func NewRetryClient(client HttpClient, opts ...RetryOption) *RetryClient {
+	c := &RetryClient{
+		client:      client,
+		maxAttempts: defaultRetryMaxAttempts,
+		isRetryable: func(statusCode int) bool {
+			switch statusCode {
+			case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				return true
+			}
+			return false
+		},
+		baseBackoff: defaultRetryBaseBackoff,
+		maxBackoff:  defaultRetryMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.baseBackoff > 0 {
+		RegisterTickFunc(100, c.dispatchDue)
+	}
+	return c
+}
+
+func (c *RetryClient) Get(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodGet, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Head(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodHead, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Options(rawURL string, headers [][2]string, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodOptions, rawURL, headers, nil, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Post(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPost, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Put(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPut, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Patch(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodPatch, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Delete(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodDelete, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Connect(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodConnect, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+func (c *RetryClient) Trace(rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	return c.Call(http.MethodTrace, rawURL, headers, body, cb, timeoutMillisecond...)
+}
+
+// Call sends the callout, retrying it while the response status is retryable. The callback receives
+// the response of the last attempt.
+func (c *RetryClient) Call(method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeoutMillisecond ...uint32) error {
+	var timeout uint32 = 500
+	if len(timeoutMillisecond) > 0 {
+		timeout = timeoutMillisecond[0]
+	}
+	var deadline time.Time
+	if c.budget > 0 {
+		deadline = time.Now().Add(c.budget)
+	}
+	return c.attempt(1, deadline, method, rawURL, headers, body, cb, timeout)
+}
+
+func (c *RetryClient) ClusterName() string {
+	return c.client.ClusterName()
+}
+
+func (c *RetryClient) attempt(n int, deadline time.Time, method, rawURL string, headers [][2]string, body []byte, cb ResponseCallback, timeout uint32) error {
+	attemptTimeout := timeout
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining <= 0 {
+			return ErrRetryTimeout
+		}
+		if remaining < int64(attemptTimeout) {
+			attemptTimeout = uint32(remaining)
+		}
+	}
+	// HttpCall modifies the headers in place, every attempt needs its own copy
+	attemptHeaders := append([][2]string(nil), headers...)
+	return c.client.Call(method, rawURL, attemptHeaders, body, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+		if !c.isRetryable(statusCode) || n >= c.maxAttempts {
+			cb(statusCode, responseHeaders, responseBody)
+			return
+		}
+		backoff := c.backoff(n)
+		if !deadline.IsZero() && !time.Now().Add(backoff).Before(deadline) {
+			log.Debugf("retry budget of %s %s is used up after %d attempts", method, rawURL, n)
+			cb(statusCode, responseHeaders, responseBody)
+			return
+		}
+		log.Debugf("retrying %s %s after status %d in %s", method, rawURL, statusCode, backoff)
+		retry := func() {
+			if err := c.attempt(n+1, deadline, method, rawURL, headers, body, cb, timeout); err != nil {
+				log.Warnf("failed to dispatch retry of %s %s: %v", method, rawURL, err)
+				cb(statusCode, responseHeaders, responseBody)
+			}
+		}
+		if backoff <= 0 {
+			retry()
+			return
+		}
+		c.delayed = append(c.delayed, delayedCallout{due: time.Now().Add(backoff), contextID: activeHttpContextID, dispatch: retry})
+	}, attemptTimeout)
+}
+
+func (c *RetryClient) backoff(attempt int) time.Duration {
+	backoff := c.baseBackoff
+	for i := 1; i < attempt && backoff < c.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > c.maxBackoff {
+		backoff = c.maxBackoff
+	}
+	return backoff
+}
+
+// dispatchDue sends the retries whose backoff is over in the context of their requests,
+// retries of requests that are already gone are dropped
+func (c *RetryClient) dispatchDue() {
+	now := time.Now()
+	remaining := c.delayed[:0]
+	var due []delayedCallout
+	for _, d := range c.delayed {
+		if now.Before(d.due) {
+			remaining = append(remaining, d)
+		} else {
+			due = append(due, d)
+		}
+	}
+	c.delayed = remaining
+	for _, d := range due {
+		if err := proxywasm.SetEffectiveContext(d.contextID); err != nil {
+			log.Debugf("dropping retry of finished request, context %d: %v", d.contextID, err)
+			continue
+		}
+		activeHttpContextID = d.contextID
+		d.dispatch()
+	}
+}
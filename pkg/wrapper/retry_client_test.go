@@ -0,0 +1,135 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestRetryClientBackoff(t *testing.T) {
+	c := NewRetryClient(nil, WithBackoff(100*time.Millisecond, 300*time.Millisecond))
+	assert.Equal(t, 100*time.Millisecond, c.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, c.backoff(2))
+	assert.Equal(t, 300*time.Millisecond, c.backoff(3))
+	assert.Equal(t, 300*time.Millisecond, c.backoff(10))
+}
+
+func TestRetryClient(t *testing.T) {
+	type retryConfig struct {
+		client *RetryClient
+	}
+	var status int
+	var body string
+	vm := NewCommonVmCtx("retry-client-test",
+		ParseConfig(func(json gjson.Result, config *retryConfig) error {
+			config.client = NewRetryClient(NewClusterClient(FQDNCluster{FQDN: "api.example.com", Port: 80}),
+				WithBackoff(time.Millisecond, 10*time.Millisecond), WithRetryBudget(time.Minute))
+			return nil
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config retryConfig) types.Action {
+			config.client.Post("/v1/embeddings", [][2]string{{"Content-Type", "application/json"}}, []byte(`{}`), func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+				status, body = statusCode, string(responseBody)
+			}, 1000)
+			return types.ActionPause
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	callouts := host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Contains(t, callouts[0].Headers, [2]string{"Content-Type", "application/json"})
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "503"}}, nil, []byte("unavailable"))
+	}
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id), "retry waits for the backoff")
+	time.Sleep(2 * time.Millisecond)
+	host.Tick()
+	callouts = host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		assert.Contains(t, callouts[0].Headers, [2]string{":path", "/v1/embeddings"})
+		assert.Equal(t, "{}", string(callouts[0].Body))
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, []byte("ok"))
+	}
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "ok", body)
+
+	// The response of the last attempt is returned
+	status = 0
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			// onTick functions run every 100ms at most
+			time.Sleep(100 * time.Millisecond)
+			host.Tick()
+		}
+		callouts = host.GetCalloutAttributesFromContext(id)
+		if assert.Len(t, callouts, 1, i) {
+			host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "429"}}, nil, nil)
+		}
+	}
+	assert.Equal(t, 429, status)
+	time.Sleep(100 * time.Millisecond)
+	host.Tick()
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id))
+}
+
+func TestRetryClientBudget(t *testing.T) {
+	type retryConfig struct {
+		client *RetryClient
+	}
+	var status int
+	vm := NewCommonVmCtx("retry-budget-test",
+		ParseConfig(func(json gjson.Result, config *retryConfig) error {
+			config.client = NewRetryClient(NewClusterClient(FQDNCluster{FQDN: "api.example.com", Port: 80}),
+				WithBackoff(time.Millisecond, time.Millisecond), WithRetryBudget(50*time.Millisecond))
+			return nil
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config retryConfig) types.Action {
+			config.client.Get("/v1/models", nil, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+				status = statusCode
+			}, 1000)
+			return types.ActionPause
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+
+	callouts := host.GetCalloutAttributesFromContext(id)
+	if assert.Len(t, callouts, 1) {
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "503"}}, nil, nil)
+	}
+	// The retry is due within the budget, but the tick dispatching it comes after the budget is used up
+	time.Sleep(60 * time.Millisecond)
+	host.Tick()
+	assert.Empty(t, host.GetCalloutAttributesFromContext(id), "no attempt is made once the budget is used up")
+	assert.Equal(t, 503, status)
+
+	err := (&RetryClient{}).attempt(2, time.Now().Add(-time.Second), http.MethodGet, "/v1/models", nil, nil, nil, 1000)
+	assert.ErrorIs(t, err, ErrRetryTimeout)
+	assert.ErrorIs(t, err, ErrCalloutFailed)
+}
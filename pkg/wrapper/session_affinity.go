@@ -0,0 +1,137 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+const defaultSessionHashHeader = "x-higress-session-hash"
+
+// SessionAffinity sends the requests of a session to the same upstream replica, e.g.
+//
+//	{"header": "mcp-session-id", "cookie": "session", "endpoints": ["10.0.0.1:8080", "10.0.0.2:8080"]}
+//
+// The session key is read from the header, or else from the cookie. A digest of the key is set as
+// HashHeader, for routes that hash on it with a ring hash or maglev load balancer. If Endpoints are
+// set, the key is also mapped to one of them by rendezvous hashing and set as the upstream override
+// host, so that only the sessions of a removed endpoint move.
+type SessionAffinity struct {
+	Header     string
+	Cookie     string
+	HashHeader string
+	Endpoints  []string
+}
+
+// ParseSessionAffinity parses the session affinity config, a header or a cookie is required.
+func ParseSessionAffinity(json gjson.Result) (*SessionAffinity, error) {
+	if !json.IsObject() {
+		return nil, configerr.New("", "object", fmt.Errorf("session affinity must be an object"))
+	}
+	a := &SessionAffinity{
+		Header:     strings.ToLower(json.Get("header").String()),
+		Cookie:     json.Get("cookie").String(),
+		HashHeader: strings.ToLower(json.Get("hashHeader").String()),
+	}
+	if a.Header == "" && a.Cookie == "" {
+		return nil, configerr.Errorf("/header", "string", "session affinity requires a header or a cookie")
+	}
+	if a.HashHeader == "" {
+		a.HashHeader = defaultSessionHashHeader
+	}
+	for i, endpoint := range json.Get("endpoints").Array() {
+		if _, _, err := net.SplitHostPort(endpoint.String()); err != nil {
+			return nil, configerr.Errorf(configerr.Pointer("endpoints", i), "ip:port", "invalid endpoint %s: %v", endpoint.String(), err)
+		}
+		a.Endpoints = append(a.Endpoints, endpoint.String())
+	}
+	return a, nil
+}
+
+// SessionKey returns the session key of request headers, empty if the request has none
+func (a *SessionAffinity) SessionKey(headers [][2]string) string {
+	var cookies []string
+	for _, h := range headers {
+		name := strings.ToLower(h[0])
+		if a.Header != "" && name == a.Header && h[1] != "" {
+			return h[1]
+		}
+		if name == "cookie" {
+			cookies = append(cookies, h[1])
+		}
+	}
+	if a.Cookie == "" {
+		return ""
+	}
+	for _, cookie := range cookies {
+		for _, pair := range strings.Split(cookie, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && name == a.Cookie && value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// Endpoint returns the endpoint of a session key, empty if there are no endpoints
+func (a *SessionAffinity) Endpoint(key string) string {
+	best, bestScore := "", uint64(0)
+	for _, endpoint := range a.Endpoints {
+		sum := sha256.Sum256([]byte(endpoint + "\x00" + key))
+		if score := binary.BigEndian.Uint64(sum[:8]); best == "" || score > bestScore {
+			best, bestScore = endpoint, score
+		}
+	}
+	return best
+}
+
+// Apply pins the current request to the replica of its session, it should be called in the request
+// header phase. It returns the session key, empty if the request has none and is not pinned.
+func (a *SessionAffinity) Apply() (string, error) {
+	headers, err := proxywasm.GetHttpRequestHeaders()
+	if err != nil {
+		return "", fmt.Errorf("failed to get request headers: %v", err)
+	}
+	key := a.SessionKey(headers)
+	if key == "" {
+		// Clients must not pick a replica with a hash header of their own
+		if err := proxywasm.RemoveHttpRequestHeader(a.HashHeader); err != nil {
+			return "", fmt.Errorf("failed to remove %s: %v", a.HashHeader, err)
+		}
+		return "", nil
+	}
+	// The key itself is a credential for some backends, only its digest is sent
+	sum := sha256.Sum256([]byte(key))
+	if err := proxywasm.ReplaceHttpRequestHeader(a.HashHeader, hex.EncodeToString(sum[:16])); err != nil {
+		return key, fmt.Errorf("failed to set %s: %v", a.HashHeader, err)
+	}
+	if endpoint := a.Endpoint(key); endpoint != "" {
+		if err := proxywasm.SetUpstreamOverrideHost([]byte(endpoint)); err != nil {
+			return key, fmt.Errorf("failed to set upstream override host %s: %v", endpoint, err)
+		}
+	}
+	return key, nil
+}
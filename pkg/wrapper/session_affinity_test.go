@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+func TestParseSessionAffinity(t *testing.T) {
+	a, err := ParseSessionAffinity(gjson.Parse(`{"header": "Mcp-Session-Id", "endpoints": ["10.0.0.1:8080"]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &SessionAffinity{Header: "mcp-session-id", HashHeader: defaultSessionHashHeader, Endpoints: []string{"10.0.0.1:8080"}}, a)
+
+	var cfgErr *configerr.Error
+	_, err = ParseSessionAffinity(gjson.Parse(`{"hashHeader": "x-hash"}`))
+	if assert.ErrorAs(t, err, &cfgErr) {
+		assert.Equal(t, "/header", cfgErr.Pointer)
+	}
+	_, err = ParseSessionAffinity(gjson.Parse(`{"cookie": "session", "endpoints": ["10.0.0.1"]}`))
+	if assert.ErrorAs(t, err, &cfgErr) {
+		assert.Equal(t, "/endpoints/0", cfgErr.Pointer)
+	}
+}
+
+func TestSessionAffinitySessionKey(t *testing.T) {
+	a := &SessionAffinity{Header: "mcp-session-id", Cookie: "session"}
+	assert.Equal(t, "abc", a.SessionKey([][2]string{{"Mcp-Session-Id", "abc"}, {"cookie", "session=def"}}))
+	assert.Equal(t, "def", a.SessionKey([][2]string{{"cookie", "theme=dark"}, {"cookie", "lang=en; session=def"}}))
+	assert.Equal(t, "", a.SessionKey([][2]string{{"cookie", "sessions=def; session="}}))
+	assert.Equal(t, "", (&SessionAffinity{Header: "mcp-session-id"}).SessionKey([][2]string{{"cookie", "session=def"}}))
+}
+
+func TestSessionAffinityEndpoint(t *testing.T) {
+	a := &SessionAffinity{Endpoints: []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}}
+	assert.Equal(t, "", (&SessionAffinity{}).Endpoint("s"))
+	counts := map[string]int{}
+	moved := 0
+	smaller := &SessionAffinity{Endpoints: a.Endpoints[:2]}
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("session-%d", i)
+		endpoint := a.Endpoint(key)
+		assert.Equal(t, endpoint, a.Endpoint(key))
+		counts[endpoint]++
+		if smaller.Endpoint(key) != endpoint {
+			moved++
+			assert.Equal(t, "10.0.0.3:80", endpoint, "only the sessions of the removed endpoint move")
+		}
+	}
+	assert.Len(t, counts, 3)
+	assert.Equal(t, counts["10.0.0.3:80"], moved)
+}
+
+func TestSessionAffinityApply(t *testing.T) {
+	var key string
+	vm := NewCommonVmCtx("session-affinity-test",
+		ParseConfig(func(json gjson.Result, config *SessionAffinity) error {
+			a, err := ParseSessionAffinity(json)
+			if err == nil {
+				*config = *a
+			}
+			return err
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config SessionAffinity) types.Action {
+			var err error
+			key, err = config.Apply()
+			assert.NoError(t, err)
+			return types.ActionContinue
+		}))
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).
+		WithPluginConfiguration([]byte(`{"header": "mcp-session-id"}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	assert.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/mcp"}, {"mcp-session-id", "abc"}}, false)
+	assert.Equal(t, "abc", key)
+	var hash string
+	for _, h := range host.GetCurrentRequestHeaders(id) {
+		if h[0] == defaultSessionHashHeader {
+			hash = h[1]
+		}
+	}
+	assert.Len(t, hash, 32)
+	assert.NotContains(t, hash, "abc")
+
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/mcp"}, {defaultSessionHashHeader, "spoofed"}}, false)
+	assert.Equal(t, "", key)
+	for _, h := range host.GetCurrentRequestHeaders(id) {
+		assert.NotEqual(t, defaultSessionHashHeader, h[0])
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+const sseDecoderContextKey = "__sse_decoder__"
+
+// SSEEvent is an event of a text/event-stream body
+type SSEEvent struct {
+	ID    string
+	Event string
+	// Data is the data of the event, the values of several data lines are joined with \n
+	Data string
+	// HasData tells whether the event has data lines, as an event with empty data is still dispatched
+	HasData bool
+	// Retry is the reconnection time in milliseconds, 0 if the event has none
+	Retry int
+	// Comment is the text of the comment lines of the event, e.g. keep-alive comments, joined with \n
+	Comment string
+}
+
+// IsComment tells whether the event only holds comments
+func (e *SSEEvent) IsComment() bool {
+	return e.ID == "" && e.Event == "" && e.Data == "" && !e.HasData && e.Retry == 0
+}
+
+// Encode encodes the event, terminated by a blank line
+func (e *SSEEvent) Encode() []byte {
+	var b bytes.Buffer
+	writeSSEField(&b, "", e.Comment)
+	writeSSEField(&b, "id", e.ID)
+	writeSSEField(&b, "event", e.Event)
+	if e.Retry > 0 {
+		writeSSEField(&b, "retry", strconv.Itoa(e.Retry))
+	}
+	if e.HasData || e.Data != "" {
+		writeSSELines(&b, "data", e.Data)
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func writeSSEField(b *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	writeSSELines(b, name, value)
+}
+
+func writeSSELines(b *bytes.Buffer, name, value string) {
+	for _, line := range strings.Split(value, "\n") {
+		b.WriteString(name)
+		b.WriteByte(':')
+		if line != "" {
+			b.WriteByte(' ')
+			b.WriteString(line)
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// SSEDecoder parses a text/event-stream body chunk by chunk. An event split across chunks is held
+// until the rest of it arrives, so every event is delivered whole. Usage in onHttpStreamingResponseBody:
+//
+//	var encoder wrapper.SSEEncoder
+//	wrapper.GetSSEDecoder(ctx).Decode(chunk, isLastChunk, func(event *wrapper.SSEEvent) {
+//		event.Data = strings.ReplaceAll(event.Data, "secret", "***")
+//		encoder.Encode(event)
+//	})
+//	return encoder.Bytes()
+type SSEDecoder struct {
+	pending []byte
+}
+
+// GetSSEDecoder returns the decoder of the response of the current request, created on first use
+func GetSSEDecoder(ctx HttpContext) *SSEDecoder {
+	if d, ok := ctx.GetContext(sseDecoderContextKey).(*SSEDecoder); ok {
+		return d
+	}
+	d := &SSEDecoder{}
+	ctx.SetContext(sseDecoderContextKey, d)
+	return d
+}
+
+// Decode calls onEvent with every event completed by the chunk. Events with only comments are
+// delivered too, so that they can be re-emitted. On the last chunk, an event without the final blank
+// line is delivered as well.
+func (d *SSEDecoder) Decode(chunk []byte, isLastChunk bool, onEvent func(event *SSEEvent)) {
+	data := append(d.pending, chunk...)
+	d.pending = nil
+	// A CR at the end of the chunk may be followed by the LF of the same line break
+	if !isLastChunk && len(data) > 0 && data[len(data)-1] == '\r' {
+		d.pending = []byte{'\r'}
+		data = data[:len(data)-1]
+	}
+	data = UnifySSEChunk(data)
+	for {
+		end := bytes.Index(data, sseEventSeparator)
+		if end < 0 {
+			break
+		}
+		if event, ok := parseSSEEvent(data[:end]); ok {
+			onEvent(event)
+		}
+		data = data[end+len(sseEventSeparator):]
+	}
+	if isLastChunk {
+		if event, ok := parseSSEEvent(bytes.TrimRight(data, "\n")); ok {
+			onEvent(event)
+		}
+		return
+	}
+	d.pending = append(bytes.Clone(data), d.pending...)
+}
+
+// Pending returns the bytes of the event not complete yet
+func (d *SSEDecoder) Pending() []byte {
+	return d.pending
+}
+
+var sseEventSeparator = []byte("\n\n")
+
+// parseSSEEvent parses the lines of an event, false if it has no fields
+func parseSSEEvent(block []byte) (*SSEEvent, bool) {
+	if len(block) == 0 {
+		return nil, false
+	}
+	event := &SSEEvent{}
+	var data, comments []string
+	found := false
+	for _, line := range strings.Split(string(block), "\n") {
+		if line == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		found = true
+		switch name {
+		case "":
+			comments = append(comments, value)
+		case "data":
+			data = append(data, value)
+		case "event":
+			event.Event = value
+		case "id":
+			event.ID = value
+		case "retry":
+			event.Retry, _ = strconv.Atoi(value)
+		}
+	}
+	event.Data = strings.Join(data, "\n")
+	event.HasData = len(data) > 0
+	event.Comment = strings.Join(comments, "\n")
+	return event, found
+}
+
+// SSEEncoder collects the events re-emitted for a chunk
+type SSEEncoder struct {
+	buf bytes.Buffer
+}
+
+// Encode appends the event
+func (e *SSEEncoder) Encode(event *SSEEvent) {
+	e.buf.Write(event.Encode())
+}
+
+// Bytes returns the encoded events and resets the encoder
+func (e *SSEEncoder) Bytes() []byte {
+	out := bytes.Clone(e.buf.Bytes())
+	e.buf.Reset()
+	return out
+}
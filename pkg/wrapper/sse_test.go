@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const sseTestStream = ": keep-alive\r\n\r\n" +
+	"id: 1\r\nevent: message\r\ndata: {\"a\":1}\r\n\r\n" +
+	"retry: 3000\ndata: line one\ndata:line two\n\n" +
+	"event: ping\ndata:\n\n" +
+	"data: [DONE]"
+
+func TestSSEDecoderChunkBoundaries(t *testing.T) {
+	expected := []SSEEvent{
+		{Comment: "keep-alive"},
+		{ID: "1", Event: "message", Data: `{"a":1}`, HasData: true},
+		{Retry: 3000, Data: "line one\nline two", HasData: true},
+		{Event: "ping", HasData: true},
+		{Data: "[DONE]", HasData: true},
+	}
+	// Every split of the stream in two chunks delivers the same events
+	for i := 0; i <= len(sseTestStream); i++ {
+		var events []SSEEvent
+		d := &SSEDecoder{}
+		collect := func(event *SSEEvent) { events = append(events, *event) }
+		d.Decode([]byte(sseTestStream[:i]), false, collect)
+		d.Decode([]byte(sseTestStream[i:]), true, collect)
+		require.Equal(t, expected, events, "split at %d", i)
+		assert.Empty(t, d.Pending())
+	}
+}
+
+func TestSSEEventEncode(t *testing.T) {
+	event := &SSEEvent{ID: "7", Event: "delta", Data: "a\nb", HasData: true, Retry: 10}
+	assert.Equal(t, "id: 7\nevent: delta\nretry: 10\ndata: a\ndata: b\n\n", string(event.Encode()))
+	// Empty data is kept, the event is still dispatched by clients
+	assert.Equal(t, "data:\n\n", string((&SSEEvent{HasData: true}).Encode()))
+	assert.Equal(t, "data:\ndata:\n\n", string((&SSEEvent{Data: "\n", HasData: true}).Encode()))
+	assert.False(t, (&SSEEvent{HasData: true}).IsComment())
+	assert.Equal(t, ": ping\n\n", string((&SSEEvent{Comment: "ping"}).Encode()))
+	assert.True(t, (&SSEEvent{Comment: "ping"}).IsComment())
+
+	var decoded []SSEEvent
+	(&SSEDecoder{}).Decode(event.Encode(), true, func(e *SSEEvent) { decoded = append(decoded, *e) })
+	assert.Equal(t, []SSEEvent{*event}, decoded)
+}
+
+func TestSSEDecoderStreamingResponse(t *testing.T) {
+	vm := NewCommonVmCtx("sse-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessStreamingResponseBody(func(ctx HttpContext, config struct{}, chunk []byte, isLastChunk bool) []byte {
+			var encoder SSEEncoder
+			GetSSEDecoder(ctx).Decode(chunk, isLastChunk, func(event *SSEEvent) {
+				if event.IsComment() {
+					return
+				}
+				event.Data = strings.ToUpper(event.Data)
+				encoder.Encode(event)
+			})
+			return encoder.Bytes()
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}, {"content-type", "text/event-stream"}}, false)
+	var out []string
+	host.CallOnResponseBody(id, []byte(sseTestStream[:40]), false)
+	out = append(out, string(host.GetCurrentResponseBody(id)))
+	host.CallOnResponseBody(id, []byte(sseTestStream[40:]), true)
+	out = append(out, string(host.GetCurrentResponseBody(id)))
+	host.CompleteHttpContext(id)
+
+	assert.Equal(t, []string{
+		"",
+		"id: 1\nevent: message\ndata: {\"A\":1}\n\nretry: 3000\ndata: LINE ONE\ndata: LINE TWO\n\nevent: ping\ndata:\n\ndata: [DONE]\n\n",
+	}, out)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+const streamPauserContextKey = "__stream_pauser__"
+
+// injectEncodedData forwards response data downstream; replaced in tests
+var injectEncodedData = proxywasm.InjectEncodedDataToFilterChain
+
+// StreamPauserOptions configures when a StreamPauser holds back response data
+type StreamPauserOptions struct {
+	// MaxPendingCallouts pauses the stream while at least this many callouts are pending. Defaults to 1.
+	MaxPendingCallouts int
+	// MaxBufferedBytes bounds the data held back while paused. When it is exceeded the buffered data
+	// is released even though callouts are pending, so a slow callout cannot exhaust VM memory.
+	// 0 means no limit.
+	MaxBufferedBytes int
+}
+
+// StreamPauser builds on NeedPauseStreamingResponse to hold back streaming response chunks while
+// callouts are pending, and releases them in order through InjectEncodedDataToFilterChain once the
+// callouts complete. Plugin authors only report chunks and callouts; the pauser decides when data
+// flows, so no stream action has to be returned by hand.
+//
+// Usage:
+//
+//	// onHttpResponseHeaders
+//	wrapper.NewStreamPauser(ctx, wrapper.StreamPauserOptions{MaxBufferedBytes: 1 << 20})
+//
+//	// onHttpStreamingResponseBody
+//	pauser := wrapper.GetStreamPauser(ctx)
+//	pauser.Hold()
+//	client.Post(url, headers, chunk, func(statusCode int, responseHeaders http.Header, responseBody []byte) {
+//		defer pauser.Release()
+//		...
+//	})
+//	return pauser.Write(chunk, endOfStream)
+type StreamPauser struct {
+	ctx            HttpContext
+	options        StreamPauserOptions
+	pending        int
+	bufferedBytes  int
+	endOfStream    bool
+	finished       bool
+	overflowLogged bool
+}
+
+// NewStreamPauser pauses the streaming response of the current request and returns the pauser
+// managing it. It must be called before the response body phase, e.g. in onHttpResponseHeaders,
+// and the plugin must process the response with onHttpStreamingResponseBody.
+func NewStreamPauser(ctx HttpContext, options StreamPauserOptions) *StreamPauser {
+	if options.MaxPendingCallouts <= 0 {
+		options.MaxPendingCallouts = 1
+	}
+	ctx.NeedPauseStreamingResponse()
+	p := &StreamPauser{ctx: ctx, options: options}
+	ctx.SetContext(streamPauserContextKey, p)
+	return p
+}
+
+// GetStreamPauser returns the pauser created for the current request, or nil
+func GetStreamPauser(ctx HttpContext) *StreamPauser {
+	p, _ := ctx.GetContext(streamPauserContextKey).(*StreamPauser)
+	return p
+}
+
+// Write queues a response chunk and releases queued data unless the stream is paused. Its result
+// is meant to be returned from onHttpStreamingResponseBody: the chunk is always forwarded through
+// the pauser, so nothing is returned to the filter chain directly.
+func (p *StreamPauser) Write(chunk []byte, endOfStream bool) []byte {
+	if p.finished {
+		return nil
+	}
+	if len(chunk) > 0 {
+		p.ctx.PushBuffer(chunk)
+		p.bufferedBytes += len(chunk)
+	}
+	p.endOfStream = p.endOfStream || endOfStream
+	p.flush()
+	return nil
+}
+
+// Hold registers a pending callout; the stream pauses once MaxPendingCallouts callouts are pending.
+func (p *StreamPauser) Hold() {
+	p.pending++
+}
+
+// Release completes a pending callout and resumes the stream when it is no longer paused.
+// It is typically deferred in the callout's response callback.
+func (p *StreamPauser) Release() {
+	if p.pending > 0 {
+		p.pending--
+	}
+	p.flush()
+}
+
+// Paused reports whether response data is currently held back
+func (p *StreamPauser) Paused() bool {
+	return p.pending >= p.options.MaxPendingCallouts
+}
+
+// PendingCallouts returns the number of callouts the stream is waiting for
+func (p *StreamPauser) PendingCallouts() int {
+	return p.pending
+}
+
+// BufferedBytes returns the size of the response data held back
+func (p *StreamPauser) BufferedBytes() int {
+	return p.bufferedBytes
+}
+
+func (p *StreamPauser) flush() {
+	if p.finished {
+		return
+	}
+	if p.Paused() {
+		if p.options.MaxBufferedBytes <= 0 || p.bufferedBytes <= p.options.MaxBufferedBytes {
+			return
+		}
+		if !p.overflowLogged {
+			log.Warnf("streaming response buffer exceeds %d bytes with %d pending callouts, releasing buffered data",
+				p.options.MaxBufferedBytes, p.pending)
+			p.overflowLogged = true
+		}
+	}
+	var data []byte
+	for p.ctx.BufferQueueSize() > 0 {
+		data = append(data, p.ctx.PopBuffer()...)
+	}
+	p.bufferedBytes = 0
+	// The end of stream is only signalled once every callout has completed
+	endOfStream := p.endOfStream && p.pending == 0
+	if len(data) == 0 && !endOfStream {
+		return
+	}
+	if err := injectEncodedData(data, endOfStream); err != nil {
+		log.Warnf("inject streaming response data failed: %v", err)
+	} else if counter, ok := p.ctx.(interface{ countInjectedResponseBody(int) }); ok {
+		counter.countInjectedResponseBody(len(data))
+	}
+	p.finished = endOfStream
+}
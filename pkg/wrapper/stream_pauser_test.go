@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/higress-group/wasm-go/pkg/log"
+)
+
+type injectedData struct {
+	data        string
+	endOfStream bool
+}
+
+func newTestStreamPauser(t *testing.T, options StreamPauserOptions) (*StreamPauser, *[]injectedData) {
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption())
+	t.Cleanup(reset)
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	log.SetPluginLog(&DefaultLog{pluginName: "stream-pauser-test"})
+
+	var injected []injectedData
+	original := injectEncodedData
+	injectEncodedData = func(body []byte, endStream bool) error {
+		injected = append(injected, injectedData{string(body), endStream})
+		return nil
+	}
+	t.Cleanup(func() { injectEncodedData = original })
+
+	ctx := &CommonHttpCtx[struct{}]{userContext: map[string]interface{}{}}
+	pauser := NewStreamPauser(ctx, options)
+	assert.True(t, ctx.pauseStreamingResponse)
+	assert.Same(t, pauser, GetStreamPauser(ctx))
+	return pauser, &injected
+}
+
+func TestStreamPauserPassThrough(t *testing.T) {
+	pauser, injected := newTestStreamPauser(t, StreamPauserOptions{})
+
+	assert.Nil(t, pauser.Write([]byte("data: 1\n\n"), false))
+	assert.Nil(t, pauser.Write([]byte("data: 2\n\n"), true))
+	assert.Equal(t, []injectedData{{"data: 1\n\n", false}, {"data: 2\n\n", true}}, *injected)
+
+	// Writes after the end of stream are ignored
+	pauser.Write([]byte("late"), true)
+	assert.Len(t, *injected, 2)
+}
+
+func TestStreamPauserHoldsWhilePending(t *testing.T) {
+	pauser, injected := newTestStreamPauser(t, StreamPauserOptions{MaxPendingCallouts: 2})
+
+	pauser.Hold()
+	pauser.Write([]byte("a"), false)
+	assert.False(t, pauser.Paused())
+	assert.Equal(t, []injectedData{{"a", false}}, *injected)
+
+	pauser.Hold()
+	assert.True(t, pauser.Paused())
+	pauser.Write([]byte("b"), false)
+	pauser.Write([]byte("c"), true)
+	assert.Equal(t, 2, pauser.BufferedBytes())
+	assert.Len(t, *injected, 1)
+
+	// Resuming releases the buffered chunks in order, but the stream only ends with the last callout
+	pauser.Release()
+	assert.Equal(t, []injectedData{{"a", false}, {"bc", false}}, *injected)
+	pauser.Release()
+	assert.Equal(t, []injectedData{{"a", false}, {"bc", false}, {"", true}}, *injected)
+	assert.Equal(t, 0, pauser.PendingCallouts())
+}
+
+func TestStreamPauserReleasesOnBufferLimit(t *testing.T) {
+	pauser, injected := newTestStreamPauser(t, StreamPauserOptions{MaxBufferedBytes: 4})
+
+	pauser.Hold()
+	pauser.Write([]byte("abc"), false)
+	assert.Empty(t, *injected)
+	pauser.Write([]byte("de"), false)
+	assert.Equal(t, []injectedData{{"abcde", false}}, *injected)
+	assert.Equal(t, 0, pauser.BufferedBytes())
+
+	pauser.Write([]byte("f"), true)
+	pauser.Release()
+	assert.Equal(t, []injectedData{{"abcde", false}, {"f", true}}, *injected)
+}
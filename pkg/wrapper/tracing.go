@@ -0,0 +1,275 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+)
+
+const (
+	TraceparentHeader    = "traceparent"
+	B3Header             = "b3"
+	B3TraceIDHeader      = "x-b3-traceid"
+	B3SpanIDHeader       = "x-b3-spanid"
+	B3ParentSpanIDHeader = "x-b3-parentspanid"
+	B3SampledHeader      = "x-b3-sampled"
+	B3FlagsHeader        = "x-b3-flags"
+	TracestateHeader     = "tracestate"
+
+	// SpanEventsTag is the span tag holding the events added with HttpContext.AddSpanEvent as a JSON array
+	SpanEventsTag = "events"
+	// CalloutSpanEvent is the span event recorded for every HTTP callout of a traced request
+	CalloutSpanEvent = "callout"
+)
+
+// TraceFormat is the propagation format of a trace context
+type TraceFormat int
+
+const (
+	TraceFormatNone TraceFormat = iota
+	// TraceFormatW3C is the traceparent header of W3C Trace Context
+	TraceFormatW3C
+	// TraceFormatB3 is the single b3 header of Zipkin
+	TraceFormatB3
+	// TraceFormatB3Multi are the x-b3-* headers of Zipkin
+	TraceFormatB3Multi
+)
+
+// TraceContext is the trace context propagated with a request
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+	Format  TraceFormat
+}
+
+// ParseTraceContext reads the trace context of headers, traceparent is preferred over b3 headers
+func ParseTraceContext(headers [][2]string) (TraceContext, bool) {
+	return parseTraceContext(func(name string) string {
+		for _, h := range headers {
+			if strings.EqualFold(h[0], name) {
+				return h[1]
+			}
+		}
+		return ""
+	})
+}
+
+func parseTraceContext(get func(name string) string) (TraceContext, bool) {
+	// version-traceid-spanid-flags
+	if parts := strings.Split(strings.TrimSpace(get(TraceparentHeader)), "-"); len(parts) >= 4 {
+		tc := TraceContext{TraceID: parts[1], SpanID: parts[2], Format: TraceFormatW3C}
+		if len(parts[0]) == 2 && parts[0] != "ff" && isTraceID(tc.TraceID, 32) && isTraceID(tc.SpanID, 16) && len(parts[3]) == 2 {
+			tc.Sampled = isHex(parts[3]) && (hexValue(parts[3][1])&1) == 1
+			return tc, true
+		}
+	}
+	// traceid-spanid[-sampled[-parentspanid]], a lone sampling decision has no context
+	if parts := strings.Split(strings.TrimSpace(get(B3Header)), "-"); len(parts) >= 2 {
+		tc := TraceContext{TraceID: parts[0], SpanID: parts[1], Format: TraceFormatB3}
+		if (isTraceID(tc.TraceID, 16) || isTraceID(tc.TraceID, 32)) && isTraceID(tc.SpanID, 16) {
+			tc.Sampled = len(parts) < 3 || parts[2] == "1" || parts[2] == "d"
+			return tc, true
+		}
+	}
+	tc := TraceContext{TraceID: get(B3TraceIDHeader), SpanID: get(B3SpanIDHeader), Format: TraceFormatB3Multi}
+	if (isTraceID(tc.TraceID, 16) || isTraceID(tc.TraceID, 32)) && isTraceID(tc.SpanID, 16) {
+		sampled := get(B3SampledHeader)
+		tc.Sampled = sampled == "" || sampled == "1" || strings.EqualFold(sampled, "true") || get(B3FlagsHeader) == "1"
+		return tc, true
+	}
+	return TraceContext{}, false
+}
+
+// isTraceID reports whether id is an id of n lowercase hex digits that are not all zero
+func isTraceID(id string, n int) bool {
+	return len(id) == n && isHex(id) && strings.Trim(id, "0") != ""
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if hexValue(s[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func hexValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	}
+	return -1
+}
+
+// Headers returns the headers propagating the context in its format, parentSpanID is only sent with x-b3-* headers
+func (tc TraceContext) Headers(parentSpanID string) [][2]string {
+	sampled := "0"
+	if tc.Sampled {
+		sampled = "1"
+	}
+	switch tc.Format {
+	case TraceFormatW3C:
+		return [][2]string{{TraceparentHeader, fmt.Sprintf("00-%s-%s-0%s", tc.TraceID, tc.SpanID, sampled)}}
+	case TraceFormatB3:
+		return [][2]string{{B3Header, fmt.Sprintf("%s-%s-%s", tc.TraceID, tc.SpanID, sampled)}}
+	case TraceFormatB3Multi:
+		headers := [][2]string{{B3TraceIDHeader, tc.TraceID}, {B3SpanIDHeader, tc.SpanID}, {B3SampledHeader, sampled}}
+		if parentSpanID != "" {
+			headers = append(headers, [2]string{B3ParentSpanIDHeader, parentSpanID})
+		}
+		return headers
+	}
+	return nil
+}
+
+type spanEvent struct {
+	Name         string                 `json:"name"`
+	TimeUnixNano int64                  `json:"time_unix_nano"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// traceHeaders are the headers propagating a trace context, in every format
+var traceHeaders = []string{TraceparentHeader, TracestateHeader, B3Header, B3TraceIDHeader, B3SpanIDHeader,
+	B3ParentSpanIDHeader, B3SampledHeader, B3FlagsHeader}
+
+// requestTrace is the trace context of a request and what plugins added to its span
+type requestTrace struct {
+	context TraceContext
+	// The trace headers of the request as received, propagated to its callouts
+	headers    [][2]string
+	attributes map[string]interface{}
+	events     []spanEvent
+}
+
+// tracedRequests are the requests carrying a trace context by context id, used to trace the callouts
+// made by the package level HttpCall
+var tracedRequests = map[uint32]*requestTrace{}
+
+func (t *requestTrace) addEvent(name string, attributes map[string]interface{}) {
+	t.events = append(t.events, spanEvent{Name: name, TimeUnixNano: time.Now().UnixNano(), Attributes: attributes})
+}
+
+// startCalloutSpan adds the trace headers of the active request, unchanged, to the headers of a callout,
+// the returned function records the callout as a span event when it completes. The wrapper does not
+// report spans of its own, a span id it made up would be the parent of spans nobody knows.
+func startCalloutSpan(headers [][2]string, cluster string) ([][2]string, func(statusCode int)) {
+	trace := tracedRequests[activeHttpContextID]
+	if trace == nil {
+		return headers, func(int) {}
+	}
+	propagate := true
+	for _, h := range headers {
+		if strings.EqualFold(h[0], TraceparentHeader) || strings.EqualFold(h[0], B3Header) || strings.EqualFold(h[0], B3TraceIDHeader) {
+			// The plugin propagates the trace itself
+			propagate = false
+		}
+	}
+	if propagate {
+		headers = append(headers, trace.headers...)
+	}
+	start := time.Now()
+	return headers, func(statusCode int) {
+		trace.addEvent(CalloutSpanEvent, map[string]interface{}{
+			"cluster":     cluster,
+			"status_code": statusCode,
+			"duration_ms": durationMillis(time.Since(start)),
+		})
+	}
+}
+
+// startTrace reads the trace context of the request headers
+func (ctx *CommonHttpCtx[PluginConfig]) startTrace() {
+	tc, ok := parseTraceContext(func(name string) string {
+		value, _ := proxywasm.GetHttpRequestHeader(name)
+		return value
+	})
+	if !ok {
+		return
+	}
+	ctx.trace.context = tc
+	ctx.trace.headers = nil
+	for _, name := range traceHeaders {
+		if value, _ := proxywasm.GetHttpRequestHeader(name); value != "" {
+			ctx.trace.headers = append(ctx.trace.headers, [2]string{name, value})
+		}
+	}
+	tracedRequests[ctx.contextID] = &ctx.trace
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) TraceID() string {
+	return ctx.trace.context.TraceID
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) SpanID() string {
+	return ctx.trace.context.SpanID
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) SetSpanAttribute(key string, value interface{}) {
+	if ctx.trace.attributes == nil {
+		ctx.trace.attributes = map[string]interface{}{}
+	}
+	ctx.trace.attributes[key] = value
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) AddSpanEvent(name string, attributes map[string]interface{}) {
+	ctx.trace.addEvent(name, attributes)
+}
+
+// writeSpanToTrace sets the span attributes and events as span tags
+func (ctx *CommonHttpCtx[PluginConfig]) writeSpanToTrace() {
+	for k, v := range ctx.trace.attributes {
+		ctx.setSpanTag(k, spanTagValue(v))
+	}
+	if len(ctx.trace.events) > 0 {
+		events, _ := json.Marshal(ctx.trace.events)
+		ctx.setSpanTag(SpanEventsTag, string(events))
+	}
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) setSpanTag(key, value string) {
+	traceSpanTag := TraceSpanTagPrefix + key
+	var err error
+	if value != "" {
+		err = proxywasm.SetProperty([]string{traceSpanTag}, []byte(value))
+	} else {
+		err = fmt.Errorf("value of %s is empty", traceSpanTag)
+	}
+	if err != nil {
+		ctx.plugin.vm.log.Warnf("Failed to set trace attribute - %s: %s, error message: %v", traceSpanTag, value, err)
+	}
+}
+
+// spanTagValue formats scalars like fmt.Print and other values as JSON
+func spanTagValue(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, fmt.Stringer, error:
+		return fmt.Sprint(v)
+	}
+	if b, err := json.Marshal(v); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers [][2]string
+		want    TraceContext
+		ok      bool
+	}{
+		{"traceparent", [][2]string{{"Traceparent", "00-" + testTraceID + "-" + testSpanID + "-01"}},
+			TraceContext{testTraceID, testSpanID, true, TraceFormatW3C}, true},
+		{"traceparent not sampled", [][2]string{{"traceparent", "00-" + testTraceID + "-" + testSpanID + "-00"}},
+			TraceContext{testTraceID, testSpanID, false, TraceFormatW3C}, true},
+		{"traceparent preferred", [][2]string{{"b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1"}, {"traceparent", "00-" + testTraceID + "-" + testSpanID + "-01"}},
+			TraceContext{testTraceID, testSpanID, true, TraceFormatW3C}, true},
+		{"invalid traceparent falls back", [][2]string{{"traceparent", "00-" + testTraceID + "-0000000000000000-01"}, {"b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0"}},
+			TraceContext{"80f198ee56343ba864fe8b2a57d3eff7", "e457b5a2e4d86bd1", false, TraceFormatB3}, true},
+		{"b3 64 bit trace id", [][2]string{{"b3", "a3ce929d0e0e4736-00f067aa0ba902b7-d-e457b5a2e4d86bd1"}},
+			TraceContext{"a3ce929d0e0e4736", testSpanID, true, TraceFormatB3}, true},
+		{"b3 sampling decision only", [][2]string{{"b3", "0"}}, TraceContext{}, false},
+		{"x-b3 headers", [][2]string{{"x-b3-traceid", testTraceID}, {"x-b3-spanid", testSpanID}},
+			TraceContext{testTraceID, testSpanID, true, TraceFormatB3Multi}, true},
+		{"x-b3 not sampled", [][2]string{{"x-b3-traceid", testTraceID}, {"x-b3-spanid", testSpanID}, {"x-b3-sampled", "0"}},
+			TraceContext{testTraceID, testSpanID, false, TraceFormatB3Multi}, true},
+		{"uppercase", [][2]string{{"traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01"}}, TraceContext{}, false},
+		{"none", [][2]string{{"x-request-id", "1"}}, TraceContext{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseTraceContext(tt.headers)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTraceContextHeaders(t *testing.T) {
+	tc := TraceContext{testTraceID, testSpanID, true, TraceFormatW3C}
+	assert.Equal(t, [][2]string{{"traceparent", "00-" + testTraceID + "-" + testSpanID + "-01"}}, tc.Headers(""))
+
+	parsed, ok := ParseTraceContext(tc.Headers(""))
+	require.True(t, ok)
+	assert.Equal(t, tc, parsed)
+
+	tc.Format, tc.Sampled = TraceFormatB3, false
+	assert.Equal(t, [][2]string{{"b3", testTraceID + "-" + testSpanID + "-0"}}, tc.Headers(""))
+	tc.Format = TraceFormatB3Multi
+	assert.Equal(t, [][2]string{{"x-b3-traceid", testTraceID}, {"x-b3-spanid", testSpanID}, {"x-b3-sampled", "0"}, {"x-b3-parentspanid", "e457b5a2e4d86bd1"}}, tc.Headers("e457b5a2e4d86bd1"))
+	assert.Nil(t, TraceContext{}.Headers(""))
+}
+
+func TestRequestTracing(t *testing.T) {
+	var traceID, spanID string
+	client := NewClusterClient(FQDNCluster{FQDN: "auth.example.com", Port: 80})
+	vm := NewCommonVmCtx[struct{}]("tracing-test",
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			traceID, spanID = ctx.TraceID(), ctx.SpanID()
+			ctx.SetSpanAttribute("consumer", "alice")
+			ctx.SetSpanAttribute("tokens", map[string]int{"input": 3})
+			ctx.SetUserAttribute("model", "qwen")
+			client.Get("/check", nil, func(int, http.Header, []byte) {
+				ctx.AddSpanEvent("auth.checked", map[string]interface{}{"allowed": true})
+				proxywasm.ResumeHttpRequest()
+			})
+			return types.ActionPause
+		}),
+		ProcessStreamDone(func(ctx HttpContext, config struct{}) {
+			_ = ctx.WriteUserAttributeToTrace()
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{
+		{":authority", "example.com"}, {":path", "/"},
+		{"traceparent", "00-" + testTraceID + "-" + testSpanID + "-03"},
+		{"tracestate", "vendor=value"},
+	}, true)
+	assert.Equal(t, testTraceID, traceID)
+	assert.Equal(t, testSpanID, spanID)
+
+	callouts := host.GetCalloutAttributesFromContext(id)
+	require.Len(t, callouts, 1)
+	assert.Contains(t, callouts[0].Headers, [2]string{"traceparent", "00-" + testTraceID + "-" + testSpanID + "-03"}, "the trace context is propagated unchanged")
+	assert.Contains(t, callouts[0].Headers, [2]string{"tracestate", "vendor=value"})
+	host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "403"}}, nil, nil)
+	host.CompleteHttpContext(id)
+
+	tag := func(name string) string {
+		value, err := host.GetProperty([]string{TraceSpanTagPrefix + name})
+		require.NoError(t, err)
+		return string(value)
+	}
+	assert.Equal(t, "qwen", tag("model"))
+	assert.Equal(t, "alice", tag("consumer"))
+	assert.JSONEq(t, `{"input":3}`, tag("tokens"))
+	events := gjson.Parse(tag(SpanEventsTag))
+	require.Len(t, events.Array(), 2)
+	assert.Equal(t, CalloutSpanEvent, events.Get("0.name").String())
+	assert.Equal(t, "outbound|80||auth.example.com", events.Get("0.attributes.cluster").String())
+	assert.Equal(t, int64(403), events.Get("0.attributes.status_code").Int())
+	assert.False(t, events.Get("0.attributes.span_id").Exists())
+	assert.Equal(t, "auth.checked", events.Get("1.name").String())
+	assert.True(t, events.Get("1.attributes.allowed").Bool())
+	assert.Positive(t, events.Get("1.time_unix_nano").Int())
+	assert.Empty(t, tracedRequests)
+
+	// Callouts of requests without a trace context are left untouched
+	id = host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+	assert.Empty(t, traceID)
+	callouts = host.GetCalloutAttributesFromContext(id)
+	require.Len(t, callouts, 1)
+	_, ok := ParseTraceContext(callouts[0].Headers)
+	assert.False(t, ok)
+}
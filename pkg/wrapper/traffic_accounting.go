@@ -0,0 +1,227 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+// TrafficAttribute is the user attribute holding the sizes of a done request in bytes, e.g.
+// {"request_headers_in":412,"request_body_in":1024,"request_body_out":980,...}
+const TrafficAttribute = "traffic"
+
+type trafficAccountingOption[PluginConfig any] struct{}
+
+func (o *trafficAccountingOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.trafficAccounting = true
+}
+
+// WithTrafficAccounting counts the bytes of the headers and bodies of every request and of its response,
+// as received by the plugin and as forwarded after its transformations, for traffic-based billing. The
+// sizes of a request are available with HttpContext.GetTrafficSize and in the user attribute
+// TrafficAttribute once the stream is done, before onHttpStreamDone is called. The totals of the VM are
+// added to the counter metrics traffic.<plugin name>.<request|response>_<in|out>_bytes.
+//
+// A body replaced after the plugin paused it, e.g. in the callback of a callout, is counted with the
+// size it had when its phase returned.
+func WithTrafficAccounting[PluginConfig any]() CtxOption[PluginConfig] {
+	return &trafficAccountingOption[PluginConfig]{}
+}
+
+// trafficStats are the counters of the bytes of the requests of a VM
+type trafficStats struct {
+	requestIn   proxywasm.MetricCounter
+	requestOut  proxywasm.MetricCounter
+	responseIn  proxywasm.MetricCounter
+	responseOut proxywasm.MetricCounter
+}
+
+func newTrafficStats(pluginName string) *trafficStats {
+	define := func(name string) proxywasm.MetricCounter {
+		return proxywasm.DefineCounterMetric(fmt.Sprintf("traffic.%s.%s_bytes", pluginName, name))
+	}
+	return &trafficStats{
+		requestIn:   define("request_in"),
+		requestOut:  define("request_out"),
+		responseIn:  define("response_in"),
+		responseOut: define("response_out"),
+	}
+}
+
+// trafficAccounting counts the bytes of a request
+type trafficAccounting struct {
+	size iface.TrafficSize
+	// Bytes of the body counted as received that are still buffered by the host
+	requestBuffered  int
+	responseBuffered int
+	// Size of the chunk a streaming body handler replaced the current chunk with, -1 when it did not
+	requestReplaced  int
+	responseReplaced int
+	// Whether the forwarded headers are counted
+	requestHeadersOut  bool
+	responseHeadersOut bool
+}
+
+func newTrafficAccounting() *trafficAccounting {
+	return &trafficAccounting{requestReplaced: -1, responseReplaced: -1}
+}
+
+// countBody counts a body chunk: bodySize includes the data buffered by the previous calls the plugin
+// paused, and the forwarded data is counted when the plugin lets it through. The body is never read
+// back from the host, the forwarded size is the size of the replacement of a streamed chunk, bodySize
+// otherwise.
+func countBody(in, out *int64, buffered, replaced *int, bodySize int, action types.Action) {
+	*in += int64(bodySize - *buffered)
+	forwarded := bodySize
+	if *replaced >= 0 {
+		forwarded, *replaced = *replaced, -1
+	}
+	switch action {
+	case types.ActionPause:
+		*buffered = bodySize
+	case types.DataStopIterationNoBuffer:
+		*buffered = 0
+	default:
+		*buffered = 0
+		*out += int64(forwarded)
+	}
+}
+
+func headersSize(headers [][2]string) int64 {
+	var size int64
+	for _, h := range headers {
+		size += int64(len(h[0]) + len(h[1]))
+	}
+	return size
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) countRequestHeadersIn() {
+	if ctx.traffic == nil {
+		return
+	}
+	headers, _ := proxywasm.GetHttpRequestHeaders()
+	ctx.traffic.size.RequestHeadersIn = headersSize(headers)
+}
+
+// countRequestHeadersOut counts the request headers once they can no longer be changed
+func (ctx *CommonHttpCtx[PluginConfig]) countRequestHeadersOut() {
+	if ctx.traffic == nil || ctx.traffic.requestHeadersOut {
+		return
+	}
+	headers, _ := proxywasm.GetHttpRequestHeaders()
+	ctx.traffic.size.RequestHeadersOut = headersSize(headers)
+	ctx.traffic.requestHeadersOut = true
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) countResponseHeadersIn() {
+	if ctx.traffic == nil {
+		return
+	}
+	headers, _ := proxywasm.GetHttpResponseHeaders()
+	ctx.traffic.size.ResponseHeadersIn = headersSize(headers)
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) countResponseHeadersOut() {
+	if ctx.traffic == nil || ctx.traffic.responseHeadersOut {
+		return
+	}
+	headers, _ := proxywasm.GetHttpResponseHeaders()
+	ctx.traffic.size.ResponseHeadersOut = headersSize(headers)
+	ctx.traffic.responseHeadersOut = true
+}
+
+// countRequestBody counts a request body chunk after the plugin processed it
+func (ctx *CommonHttpCtx[PluginConfig]) countRequestBody(bodySize int, action *types.Action) {
+	if ctx.traffic == nil {
+		return
+	}
+	t := ctx.traffic
+	countBody(&t.size.RequestBodyIn, &t.size.RequestBodyOut, &t.requestBuffered, &t.requestReplaced, bodySize, *action)
+}
+
+// countResponseBody counts a response body chunk after the plugin processed it
+func (ctx *CommonHttpCtx[PluginConfig]) countResponseBody(bodySize int, action *types.Action) {
+	if ctx.traffic == nil {
+		return
+	}
+	t := ctx.traffic
+	countBody(&t.size.ResponseBodyIn, &t.size.ResponseBodyOut, &t.responseBuffered, &t.responseReplaced, bodySize, *action)
+}
+
+// countReplacedRequestChunk records the size of the chunk a streaming request body handler replaced the current one with
+func (ctx *CommonHttpCtx[PluginConfig]) countReplacedRequestChunk(size int) {
+	if ctx.traffic != nil {
+		ctx.traffic.requestReplaced = size
+	}
+}
+
+// countReplacedResponseChunk records the size of the chunk a streaming response body handler replaced the current one with
+func (ctx *CommonHttpCtx[PluginConfig]) countReplacedResponseChunk(size int) {
+	if ctx.traffic != nil {
+		ctx.traffic.responseReplaced = size
+	}
+}
+
+// countInjectedResponseBody counts response data the plugin forwards by itself, e.g. through a StreamPauser
+func (ctx *CommonHttpCtx[PluginConfig]) countInjectedResponseBody(size int) {
+	if ctx.traffic != nil {
+		ctx.traffic.size.ResponseBodyOut += int64(size)
+	}
+}
+
+// finishTraffic counts the forwarded headers of a done request, and with WithTrafficAccounting sets its traffic
+// attribute and adds its sizes to the metrics of the VM
+func (ctx *CommonHttpCtx[PluginConfig]) finishTraffic() {
+	if ctx.traffic == nil {
+		return
+	}
+	ctx.countRequestHeadersOut()
+	ctx.countResponseHeadersOut()
+	if !ctx.plugin.vm.trafficAccounting {
+		return
+	}
+	size := ctx.traffic.size
+	ctx.SetUserAttribute(TrafficAttribute, map[string]int64{
+		"request_headers_in":   size.RequestHeadersIn,
+		"request_headers_out":  size.RequestHeadersOut,
+		"request_body_in":      size.RequestBodyIn,
+		"request_body_out":     size.RequestBodyOut,
+		"response_headers_in":  size.ResponseHeadersIn,
+		"response_headers_out": size.ResponseHeadersOut,
+		"response_body_in":     size.ResponseBodyIn,
+		"response_body_out":    size.ResponseBodyOut,
+	})
+	vm := ctx.plugin.vm
+	if vm.trafficStats == nil {
+		vm.trafficStats = newTrafficStats(vm.pluginName)
+	}
+	vm.trafficStats.requestIn.Increment(uint64(size.RequestHeadersIn + size.RequestBodyIn))
+	vm.trafficStats.requestOut.Increment(uint64(size.RequestHeadersOut + size.RequestBodyOut))
+	vm.trafficStats.responseIn.Increment(uint64(size.ResponseHeadersIn + size.ResponseBodyIn))
+	vm.trafficStats.responseOut.Increment(uint64(size.ResponseHeadersOut + size.ResponseBodyOut))
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) GetTrafficSize() *iface.TrafficSize {
+	if ctx.traffic == nil || !ctx.plugin.vm.trafficAccounting {
+		return nil
+	}
+	size := ctx.traffic.size
+	return &size
+}
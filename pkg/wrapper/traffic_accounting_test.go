@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/higress-group/wasm-go/pkg/iface"
+)
+
+func TestTrafficAccounting(t *testing.T) {
+	var size *iface.TrafficSize
+	var attribute interface{}
+	vm := NewCommonVmCtx[struct{}]("traffic-test",
+		WithTrafficAccounting[struct{}](),
+		ProcessRequestHeaders(func(ctx HttpContext, config struct{}) types.Action {
+			_ = proxywasm.AddHttpRequestHeader("x-tenant", "acme")
+			return types.ActionContinue
+		}),
+		ProcessRequestBody(func(ctx HttpContext, config struct{}, body []byte) types.Action {
+			_ = proxywasm.ReplaceHttpRequestBody(bytes.ToUpper(body[:4]))
+			return types.ActionContinue
+		}),
+		ProcessStreamingResponseBody(func(ctx HttpContext, config struct{}, chunk []byte, endOfStream bool) []byte {
+			return append(chunk, chunk...)
+		}),
+		ProcessStreamDone(func(ctx HttpContext, config struct{}) {
+			size = ctx.GetTrafficSize()
+			attribute = ctx.GetUserAttribute(TrafficAttribute)
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, false)
+	// The first chunk is buffered by the body handler and counted once
+	host.CallOnRequestBody(id, []byte("hello "), false)
+	host.CallOnRequestBody(id, []byte("world"), true)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "200"}}, false)
+	host.CallOnResponseBody(id, []byte("abc"), false)
+	host.CallOnResponseBody(id, []byte("de"), true)
+	host.CompleteHttpContext(id)
+
+	require.NotNil(t, size)
+	assert.Equal(t, iface.TrafficSize{
+		RequestHeadersIn:  int64(len(":authority" + "example.com" + ":path" + "/")),
+		RequestHeadersOut: int64(len(":authority" + "example.com" + ":path" + "/" + "x-tenant" + "acme")),
+		RequestBodyIn:     11,
+		// The replaced buffered body is not read back, unlike the streamed chunks
+		RequestBodyOut:     11,
+		ResponseHeadersIn:  int64(len(":status" + "200")),
+		ResponseHeadersOut: int64(len(":status" + "200")),
+		ResponseBodyIn:     5,
+		ResponseBodyOut:    10,
+	}, *size)
+	assert.Equal(t, int64(11), attribute.(map[string]int64)["request_body_out"])
+
+	requestOut, err := host.GetCounterMetric("traffic.traffic-test.request_out_bytes")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(size.RequestHeadersOut+11), requestOut)
+	responseIn, err := host.GetCounterMetric("traffic.traffic-test.response_in_bytes")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(size.ResponseHeadersIn+5), responseIn)
+}
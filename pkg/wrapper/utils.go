@@ -3,6 +3,8 @@ package wrapper
 import (
 	"bytes"
 	"encoding/json"
+	"strconv"
+	"strings"
 
 	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
 	"github.com/tidwall/gjson"
@@ -51,6 +53,94 @@ func GetValueFromBody(data []byte, paths []string) *gjson.Result {
 	return nil
 }
 
+// JsonPath joins keys into a gjson path, escaping dots, wildcards and other special characters
+// so that each key is matched literally, e.g. JsonPath("headers", "x.request.id") is `headers.x\.request\.id`.
+func JsonPath(keys ...string) string {
+	escaped := make([]string, len(keys))
+	for i, key := range keys {
+		escaped[i] = gjson.Escape(key)
+	}
+	return strings.Join(escaped, ".")
+}
+
+// GetValueFromBodyByKeys is like GetValueFromBody, but each candidate is a list of literal keys.
+func GetValueFromBodyByKeys(data []byte, candidates ...[]string) *gjson.Result {
+	for _, keys := range candidates {
+		obj := gjson.GetBytes(data, JsonPath(keys...))
+		if obj.Exists() {
+			return &obj
+		}
+	}
+	return nil
+}
+
+// GetStringFromBody returns the first value among paths that can be used as a string.
+// Numbers and booleans are formatted, while null, objects and arrays are skipped.
+func GetStringFromBody(data []byte, paths []string) (string, bool) {
+	for _, path := range paths {
+		obj := gjson.GetBytes(data, path)
+		switch obj.Type {
+		case gjson.String, gjson.Number, gjson.True, gjson.False:
+			return obj.String(), true
+		}
+	}
+	return "", false
+}
+
+// GetIntFromBody returns the first value among paths that can be coerced to an integer,
+// numeric strings such as "42" are accepted.
+func GetIntFromBody(data []byte, paths []string) (int64, bool) {
+	for _, path := range paths {
+		obj := gjson.GetBytes(data, path)
+		switch obj.Type {
+		case gjson.Number:
+			if i, err := strconv.ParseInt(obj.Raw, 10, 64); err == nil {
+				return i, true
+			}
+			return obj.Int(), true
+		case gjson.String:
+			if i, err := strconv.ParseInt(strings.TrimSpace(obj.Str), 10, 64); err == nil {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// GetFloatFromBody returns the first value among paths that can be coerced to a float,
+// numeric strings such as "0.5" are accepted.
+func GetFloatFromBody(data []byte, paths []string) (float64, bool) {
+	for _, path := range paths {
+		obj := gjson.GetBytes(data, path)
+		switch obj.Type {
+		case gjson.Number:
+			return obj.Num, true
+		case gjson.String:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(obj.Str), 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// GetBoolFromBody returns the first value among paths that can be coerced to a boolean,
+// strings such as "true" or "0" are accepted.
+func GetBoolFromBody(data []byte, paths []string) (bool, bool) {
+	for _, path := range paths {
+		obj := gjson.GetBytes(data, path)
+		switch obj.Type {
+		case gjson.True, gjson.False:
+			return obj.Bool(), true
+		case gjson.String:
+			if b, err := strconv.ParseBool(strings.TrimSpace(obj.Str)); err == nil {
+				return b, true
+			}
+		}
+	}
+	return false, false
+}
+
 func UnifySSEChunk(data []byte) []byte {
 	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
 	data = bytes.ReplaceAll(data, []byte("\r"), []byte("\n"))
@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetValueFromBodyByKeys(t *testing.T) {
+	body := []byte(`{"headers":{"x.request.id":"abc","a*":"star"},"x":{"request":{"id":"nested"}}}`)
+
+	assert.Equal(t, `headers.x\.request\.id`, JsonPath("headers", "x.request.id"))
+	assert.Equal(t, "abc", GetValueFromBodyByKeys(body, []string{"headers", "x.request.id"}).String())
+	assert.Equal(t, "star", GetValueFromBodyByKeys(body, []string{"missing"}, []string{"headers", "a*"}).String())
+	assert.Nil(t, GetValueFromBodyByKeys(body, []string{"headers", "x"}))
+}
+
+func TestGetTypedValueFromBody(t *testing.T) {
+	body := []byte(`{"count":"42","big":9007199254740993,"ratio":"0.5","flag":"true","obj":{},"empty":null,"num":3}`)
+
+	i, ok := GetIntFromBody(body, []string{"missing", "obj", "count"})
+	assert.True(t, ok)
+	assert.Equal(t, int64(42), i)
+	i, _ = GetIntFromBody(body, []string{"big"})
+	assert.Equal(t, int64(9007199254740993), i)
+	_, ok = GetIntFromBody(body, []string{"ratio", "flag"})
+	assert.False(t, ok)
+
+	f, ok := GetFloatFromBody(body, []string{"empty", "ratio"})
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, f)
+
+	b, ok := GetBoolFromBody(body, []string{"count", "flag"})
+	assert.True(t, ok)
+	assert.True(t, b)
+
+	s, ok := GetStringFromBody(body, []string{"obj", "empty", "num"})
+	assert.True(t, ok)
+	assert.Equal(t, "3", s)
+	_, ok = GetStringFromBody(body, []string{"obj"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import "time"
+
+const (
+	// WarmupRetryPeriod is the period in milliseconds of the retries of a failed warm-up
+	WarmupRetryPeriod = 5000
+	// WarmupTimeout is the time in milliseconds after which a warm-up that did not call done fails, e.g.
+	// when one of its callouts never calls back
+	WarmupTimeout = 10000
+)
+
+type onPluginWarmupFunc[PluginConfig any] func(context PluginContext, config PluginConfig, done func(err error))
+
+type pluginWarmupOption[PluginConfig any] struct {
+	f onPluginWarmupFunc[PluginConfig]
+}
+
+func (o *pluginWarmupOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.onPluginWarmup = o.f
+}
+
+// OnPluginWarmup registers a callback run after the plugin config is parsed successfully, to pre-fetch
+// data with callouts before serving traffic, e.g. JWKS, model lists or the tools of backends:
+//
+//	wrapper.OnPluginWarmup(func(ctx wrapper.PluginContext, config PluginConfig, done func(error)) {
+//		err := config.client.Get("/jwks", nil, func(statusCode int, _ http.Header, body []byte) {
+//			if statusCode != http.StatusOK {
+//				done(fmt.Errorf("failed to fetch jwks: status %d", statusCode))
+//				return
+//			}
+//			config.keys.Store(body)
+//			done(nil)
+//		})
+//		if err != nil {
+//			done(err)
+//		}
+//	})
+//
+// It receives the global config, the zero value for plugins only configured with _rules_. The plugin
+// is ready, see HttpContext.IsWarmedUp, once done is called without error. A failed warm-up is logged
+// and retried every WarmupRetryPeriod milliseconds, a warm-up that did not call done within WarmupTimeout
+// milliseconds fails and a later call of its done is ignored. A new configuration pushed to the VM runs the
+// warm-up again, the plugin is not ready until it is done. Requests are served meanwhile, handlers
+// decide what to do before the plugin is ready.
+func OnPluginWarmup[PluginConfig any](f func(context PluginContext, config PluginConfig, done func(err error))) CtxOption[PluginConfig] {
+	return &pluginWarmupOption[PluginConfig]{f: f}
+}
+
+// pluginWarmup is the state of the warm-up of the current configuration
+type pluginWarmup struct {
+	ready   bool
+	pending bool
+	// When the pending warm-up started
+	startedAt time.Time
+	// attempt tells apart successive warm-ups, those of earlier configurations and those that timed out
+	attempt int
+}
+
+// startWarmup runs the warm-up of a newly parsed configuration, and registers its retries
+func (ctx *CommonPluginCtx[PluginConfig]) startWarmup() {
+	if ctx.vm.onPluginWarmup == nil {
+		return
+	}
+	ctx.warmup.ready = false
+	ctx.warmup.pending = false
+	RegisterTickFunc(WarmupRetryPeriod, ctx.tickWarmup)
+	ctx.runWarmup()
+}
+
+// tickWarmup fails a warm-up that timed out, or retries a failed one
+func (ctx *CommonPluginCtx[PluginConfig]) tickWarmup() {
+	if ctx.warmup.ready {
+		return
+	}
+	if !ctx.warmup.pending {
+		ctx.runWarmup()
+		return
+	}
+	if time.Since(ctx.warmup.startedAt) >= WarmupTimeout*time.Millisecond {
+		ctx.warmup.pending = false
+		ctx.warmup.attempt++
+		ctx.vm.log.Warnf("plugin warm-up failed, not done after %dms, retrying in %dms", WarmupTimeout, WarmupRetryPeriod)
+	}
+}
+
+func (ctx *CommonPluginCtx[PluginConfig]) runWarmup() {
+	ctx.warmup.attempt++
+	attempt := ctx.warmup.attempt
+	ctx.warmup.pending = true
+	ctx.warmup.startedAt = time.Now()
+	config, _ := ctx.GetGlobalConfig()
+	// Callouts of the warm-up are not made on behalf of a request
+	activeHttpContextID = 0
+	ctx.vm.onPluginWarmup(ctx, config, func(err error) {
+		if attempt != ctx.warmup.attempt || !ctx.warmup.pending {
+			return
+		}
+		ctx.warmup.pending = false
+		if err != nil {
+			ctx.vm.log.Warnf("plugin warm-up failed, retrying in %dms: %v", WarmupRetryPeriod, err)
+			return
+		}
+		ctx.warmup.ready = true
+		ctx.vm.log.Info("plugin warm-up done")
+	})
+}
+
+func (ctx *CommonPluginCtx[PluginConfig]) IsWarmedUp() bool {
+	return ctx.vm.onPluginWarmup == nil || ctx.warmup.ready
+}
+
+func (ctx *CommonHttpCtx[PluginConfig]) IsWarmedUp() bool {
+	return ctx.plugin.IsWarmedUp()
+}
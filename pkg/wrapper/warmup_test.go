@@ -0,0 +1,155 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+type warmupTestConfig struct {
+	path string
+	keys string
+}
+
+func TestOnPluginWarmup(t *testing.T) {
+	var warmedUp []bool
+	var keys string
+	client := NewClusterClient(FQDNCluster{FQDN: "jwks.example.com", Port: 80})
+	vm := NewCommonVmCtx("warmup-test",
+		ParseConfig(func(json gjson.Result, config *warmupTestConfig) error {
+			config.path = json.Get("path").String()
+			return nil
+		}),
+		OnPluginWarmup(func(ctx PluginContext, config warmupTestConfig, done func(error)) {
+			err := client.Get(config.path, nil, func(statusCode int, _ http.Header, body []byte) {
+				if statusCode != http.StatusOK {
+					done(fmt.Errorf("status %d", statusCode))
+					return
+				}
+				keys = string(body)
+				done(nil)
+			})
+			if err != nil {
+				done(err)
+			}
+		}),
+		ProcessRequestHeaders(func(ctx HttpContext, config warmupTestConfig) types.Action {
+			warmedUp = append(warmedUp, ctx.IsWarmedUp())
+			return types.ActionContinue
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{"path":"/jwks"}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	request := func() {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{{":authority", "example.com"}, {":path", "/"}}, true)
+		host.CompleteHttpContext(id)
+	}
+	respond := func(status string, body string) {
+		callouts := host.GetCalloutAttributesFromContext(proxytest.PluginContextID)
+		require.Len(t, callouts, 1)
+		assert.Equal(t, "/jwks", headerValue(callouts[0].Headers, ":path"))
+		host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", status}}, nil, []byte(body))
+	}
+
+	request()
+	respond("503", "")
+	request()
+	// A failed warm-up is retried on tick
+	host.Tick()
+	respond("200", "keys")
+	request()
+	host.Tick()
+	assert.Empty(t, host.GetCalloutAttributesFromContext(proxytest.PluginContextID))
+
+	assert.Equal(t, []bool{false, false, true}, warmedUp)
+	assert.Equal(t, "keys", keys)
+}
+
+func TestOnPluginWarmupTimeout(t *testing.T) {
+	var plugin *CommonPluginCtx[warmupTestConfig]
+	var attempts int
+	client := NewClusterClient(FQDNCluster{FQDN: "jwks.example.com", Port: 80})
+	vm := NewCommonVmCtx("warmup-timeout-test",
+		ParseConfig(func(json gjson.Result, config *warmupTestConfig) error {
+			return nil
+		}),
+		OnPluginWarmup(func(ctx PluginContext, config warmupTestConfig, done func(error)) {
+			plugin = ctx.(*CommonPluginCtx[warmupTestConfig])
+			attempts++
+			_ = client.Get("/jwks", nil, func(int, http.Header, []byte) {
+				done(nil)
+			})
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+	// tick runs the tick functions as if their period was over
+	tick := func() {
+		for i := range plugin.onTickFuncs {
+			plugin.onTickFuncs[i].lastExecuted = 0
+		}
+		host.Tick()
+	}
+
+	lost := host.GetCalloutAttributesFromContext(proxytest.PluginContextID)
+	require.Len(t, lost, 1)
+	lostID := lost[0].CalloutID
+	tick()
+	assert.True(t, plugin.warmup.pending, "the warm-up waits for its callout until the timeout")
+	plugin.warmup.startedAt = time.Now().Add(-WarmupTimeout * time.Millisecond)
+	tick()
+	assert.False(t, plugin.warmup.pending)
+	assert.False(t, plugin.IsWarmedUp())
+	assert.Equal(t, 1, attempts, "the timed out warm-up is retried on the next tick")
+
+	host.CallOnHttpCallResponse(lostID, [][2]string{{":status", "200"}}, nil, nil)
+	assert.False(t, plugin.IsWarmedUp(), "the timed out warm-up cannot complete")
+
+	tick()
+	assert.Equal(t, 2, attempts)
+	callouts := host.GetCalloutAttributesFromContext(proxytest.PluginContextID)
+	require.Len(t, callouts, 1)
+	host.CallOnHttpCallResponse(callouts[0].CalloutID, [][2]string{{":status", "200"}}, nil, nil)
+	assert.True(t, plugin.IsWarmedUp())
+}
+
+func TestIsWarmedUpWithoutWarmup(t *testing.T) {
+	ctx := &CommonPluginCtx[struct{}]{vm: NewCommonVmCtx[struct{}]("warmup-test")}
+	assert.True(t, ctx.IsWarmedUp())
+}
+
+func headerValue(headers [][2]string, name string) string {
+	for _, h := range headers {
+		if h[0] == name {
+			return h[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+const (
+	defaultWebhookSignatureHeader = "x-signature"
+	defaultWebhookTimestampHeader = "x-timestamp"
+	defaultWebhookTolerance       = 5 * time.Minute
+	webhookSignaturePrefix        = "sha256="
+)
+
+var (
+	// ErrWebhookSignature is returned for webhooks without a valid signature
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	// ErrWebhookTimestamp is returned for webhooks without a timestamp within the tolerance
+	ErrWebhookTimestamp = errors.New("invalid webhook timestamp")
+)
+
+// WebhookSignature returns the signature of a webhook, sha256= followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>"
+func WebhookSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookSigner signs the callouts forwarding events, so that the receivers can verify them with a
+// WebhookVerifier. It sets the timestamp header to the unix seconds and the signature header to the
+// WebhookSignature of the body.
+type WebhookSigner struct {
+	Secret []byte
+	// SignatureHeader is the header of the signature, default x-signature
+	SignatureHeader string
+	// TimestampHeader is the header of the timestamp, default x-timestamp
+	TimestampHeader string
+}
+
+// Sign adds the timestamp and signature headers
+func (s *WebhookSigner) Sign(req *SigningRequest) error {
+	if len(s.Secret) == 0 {
+		return errors.New("webhook signer requires a secret")
+	}
+	signatureHeader, timestampHeader := webhookHeaders(s.SignatureHeader, s.TimestampHeader)
+	timestamp := strconv.FormatInt(req.Time.Unix(), 10)
+	req.setHeader(timestampHeader, timestamp)
+	req.setHeader(signatureHeader, WebhookSignature(s.Secret, timestamp, req.Body))
+	return nil
+}
+
+// WebhookVerifier verifies the signatures of inbound webhooks, e.g.
+//
+//	{"secrets": ["new-secret", "old-secret"], "signatureHeader": "x-signature", "timestampHeader": "x-timestamp", "tolerance": 300}
+//
+// Any of the secrets may have signed the webhook, so that they can be rotated. The timestamp must be
+// within tolerance seconds of now, default 300, for signed webhooks not to be replayed later.
+type WebhookVerifier struct {
+	Secrets         [][]byte
+	SignatureHeader string
+	TimestampHeader string
+	Tolerance       time.Duration
+
+	now func() time.Time
+}
+
+// ParseWebhookVerifier parses the webhook verification config, at least one secret is required.
+func ParseWebhookVerifier(json gjson.Result) (*WebhookVerifier, error) {
+	if !json.IsObject() {
+		return nil, configerr.New("", "object", fmt.Errorf("webhook verification must be an object"))
+	}
+	v := &WebhookVerifier{Tolerance: defaultWebhookTolerance}
+	v.SignatureHeader, v.TimestampHeader = webhookHeaders(json.Get("signatureHeader").String(), json.Get("timestampHeader").String())
+	for i, secret := range json.Get("secrets").Array() {
+		if secret.String() == "" {
+			return nil, configerr.Errorf(configerr.Pointer("secrets", i), "non-empty string", "secret is empty")
+		}
+		v.Secrets = append(v.Secrets, []byte(secret.String()))
+	}
+	if len(v.Secrets) == 0 {
+		return nil, configerr.Errorf("/secrets", "non-empty array of strings", "webhook verification requires a secret")
+	}
+	if tolerance := json.Get("tolerance"); tolerance.Exists() {
+		if tolerance.Type != gjson.Number || tolerance.Int() <= 0 {
+			return nil, configerr.Errorf("/tolerance", "positive seconds", "got %s", tolerance.Raw)
+		}
+		v.Tolerance = time.Duration(tolerance.Int()) * time.Second
+	}
+	return v, nil
+}
+
+// Verify checks the signature of a webhook with its request headers and body. It returns
+// ErrWebhookTimestamp or ErrWebhookSignature for webhooks that must be rejected.
+func (v *WebhookVerifier) Verify(headers [][2]string, body []byte) error {
+	signatureHeader, timestampHeader := webhookHeaders(v.SignatureHeader, v.TimestampHeader)
+	var timestamp string
+	var signatures []string
+	for _, h := range headers {
+		switch strings.ToLower(h[0]) {
+		case timestampHeader:
+			timestamp = h[1]
+		case signatureHeader:
+			// Senders that rotate their secret may send a signature per secret
+			for _, signature := range strings.Split(h[1], ",") {
+				signatures = append(signatures, strings.TrimSpace(signature))
+			}
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrWebhookTimestamp, timestamp)
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	tolerance := v.Tolerance
+	if tolerance <= 0 {
+		tolerance = defaultWebhookTolerance
+	}
+	if age := now().Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: %s is not within %s of now", ErrWebhookTimestamp, timestamp, tolerance)
+	}
+	for _, secret := range v.Secrets {
+		expected := WebhookSignature(secret, timestamp, body)
+		for _, signature := range signatures {
+			if !strings.HasPrefix(signature, webhookSignaturePrefix) {
+				signature = webhookSignaturePrefix + signature
+			}
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return nil
+			}
+		}
+	}
+	return ErrWebhookSignature
+}
+
+func webhookHeaders(signatureHeader, timestampHeader string) (string, string) {
+	if signatureHeader == "" {
+		signatureHeader = defaultWebhookSignatureHeader
+	}
+	if timestampHeader == "" {
+		timestampHeader = defaultWebhookTimestampHeader
+	}
+	return strings.ToLower(signatureHeader), strings.ToLower(timestampHeader)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+
+	"github.com/higress-group/wasm-go/pkg/configerr"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	// echo -n '1700000000.{"event":"ping"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=4d39bd2442f073b6bc62e95d0297ce25475582a17389ab860abdc778fe1d9f77",
+		WebhookSignature([]byte("secret"), "1700000000", []byte(`{"event":"ping"}`)))
+	assert.NotEqual(t, WebhookSignature([]byte("secret"), "1700000000", []byte("a")), WebhookSignature([]byte("secret"), "1700000001", []byte("a")))
+}
+
+func TestWebhookSignerAndVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer := &WebhookSigner{Secret: []byte("new-secret")}
+	req := &SigningRequest{Method: "POST", Host: "hooks.example.com", Path: "/events", Body: []byte(`{"event":"ping"}`),
+		Headers: [][2]string{{"Content-Type", "application/json"}, {"X-Signature", "stale"}}, Time: now}
+	assert.NoError(t, signer.Sign(req))
+	assert.Equal(t, "1700000000", signedHeader(req.Headers, "x-timestamp"))
+	signature := signedHeader(req.Headers, "x-signature")
+	assert.Equal(t, WebhookSignature([]byte("new-secret"), "1700000000", req.Body), signature)
+
+	verifier, err := ParseWebhookVerifier(gjson.Parse(`{"secrets": ["new-secret", "old-secret"], "tolerance": 60}`))
+	assert.NoError(t, err)
+	verifier.now = func() time.Time { return now.Add(30 * time.Second) }
+	assert.NoError(t, verifier.Verify(req.Headers, req.Body))
+
+	// The old secret still verifies, and the prefix is optional
+	oldSignature := WebhookSignature([]byte("old-secret"), "1700000000", req.Body)
+	assert.NoError(t, verifier.Verify([][2]string{{"X-Timestamp", "1700000000"}, {"X-Signature", strings.TrimPrefix(oldSignature, "sha256=")}}, req.Body))
+	assert.NoError(t, verifier.Verify([][2]string{{"X-Timestamp", "1700000000"}, {"X-Signature", "sha256=00, " + oldSignature}}, req.Body))
+
+	assert.ErrorIs(t, verifier.Verify(req.Headers, []byte(`{"event":"pong"}`)), ErrWebhookSignature)
+	assert.ErrorIs(t, verifier.Verify([][2]string{{"X-Timestamp", "1700000000"}}, req.Body), ErrWebhookSignature)
+	assert.ErrorIs(t, verifier.Verify([][2]string{{"X-Signature", signature}}, req.Body), ErrWebhookTimestamp)
+	verifier.now = func() time.Time { return now.Add(2 * time.Minute) }
+	assert.ErrorIs(t, verifier.Verify(req.Headers, req.Body), ErrWebhookTimestamp)
+
+	custom := &WebhookSigner{Secret: []byte("s"), SignatureHeader: "X-Hub-Signature-256", TimestampHeader: "X-Hub-Timestamp"}
+	assert.NoError(t, custom.Sign(req))
+	assert.NotEmpty(t, signedHeader(req.Headers, "x-hub-signature-256"))
+	assert.Error(t, (&WebhookSigner{}).Sign(req))
+}
+
+func TestParseWebhookVerifier(t *testing.T) {
+	v, err := ParseWebhookVerifier(gjson.Parse(`{"secrets": ["s"], "signatureHeader": "X-Sig"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "x-sig", v.SignatureHeader)
+	assert.Equal(t, defaultWebhookTimestampHeader, v.TimestampHeader)
+	assert.Equal(t, defaultWebhookTolerance, v.Tolerance)
+
+	for config, pointer := range map[string]string{
+		`{}`:                                 "/secrets",
+		`{"secrets": [""]}`:                  "/secrets/0",
+		`{"secrets": ["s"], "tolerance": 0}`: "/tolerance",
+	} {
+		var cfgErr *configerr.Error
+		_, err := ParseWebhookVerifier(gjson.Parse(config))
+		if assert.ErrorAs(t, err, &cfgErr, config) {
+			assert.Equal(t, pointer, cfgErr.Pointer, config)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+)
+
+// WebSocketOpcode is the opcode of a WebSocket frame (RFC 6455)
+type WebSocketOpcode byte
+
+const (
+	WebSocketContinuation WebSocketOpcode = 0x0
+	WebSocketText         WebSocketOpcode = 0x1
+	WebSocketBinary       WebSocketOpcode = 0x2
+	WebSocketClose        WebSocketOpcode = 0x8
+	WebSocketPing         WebSocketOpcode = 0x9
+	WebSocketPong         WebSocketOpcode = 0xA
+)
+
+// maxWebSocketFrameSize is the size of the largest frame buffered to be processed, the traffic of a
+// connection with a larger frame is passed through unprocessed
+const maxWebSocketFrameSize = 16 << 20
+
+var errWebSocketFrameTooLarge = fmt.Errorf("%w: websocket frame too large", ErrLimitExceeded)
+
+// WebSocketFrame is a frame of an upgraded WebSocket connection, with its payload unmasked
+type WebSocketFrame struct {
+	Fin     bool
+	Opcode  WebSocketOpcode
+	Payload []byte
+	// FromClient tells the direction of the frame, frames sent by the client are masked on the wire
+	FromClient bool
+	// MaskKey is the key the frame is masked with when it is encoded, frames from the client get a random key if it is nil
+	MaskKey []byte
+}
+
+// IsControl tells whether the frame is a close, ping or pong frame
+func (f *WebSocketFrame) IsControl() bool {
+	return f.Opcode >= WebSocketClose
+}
+
+// CloseCode returns the status code and reason of a close frame, 1005 (no status) if it has none
+func (f *WebSocketFrame) CloseCode() (uint16, string) {
+	if f.Opcode != WebSocketClose || len(f.Payload) < 2 {
+		return 1005, ""
+	}
+	return binary.BigEndian.Uint16(f.Payload), string(f.Payload[2:])
+}
+
+// NewWebSocketCloseFrame creates a close frame with the status code and reason
+func NewWebSocketCloseFrame(code uint16, reason string, fromClient bool) WebSocketFrame {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	return WebSocketFrame{Fin: true, Opcode: WebSocketClose, Payload: append(payload, reason...), FromClient: fromClient}
+}
+
+// ParseWebSocketFrames parses the complete frames at the start of the data, and returns the bytes of
+// the frame that is not complete yet
+func ParseWebSocketFrames(data []byte, fromClient bool) ([]WebSocketFrame, []byte, error) {
+	var frames []WebSocketFrame
+	for len(data) >= 2 {
+		masked := data[1]&0x80 != 0
+		length := uint64(data[1] & 0x7F)
+		header := 2
+		switch length {
+		case 126:
+			if len(data) < 4 {
+				return frames, data, nil
+			}
+			length = uint64(binary.BigEndian.Uint16(data[2:4]))
+			header = 4
+		case 127:
+			if len(data) < 10 {
+				return frames, data, nil
+			}
+			length = binary.BigEndian.Uint64(data[2:10])
+			header = 10
+		}
+		if length > maxWebSocketFrameSize {
+			return frames, data, fmt.Errorf("%w: %d bytes", errWebSocketFrameTooLarge, length)
+		}
+		var maskKey []byte
+		if masked {
+			if len(data) < header+4 {
+				return frames, data, nil
+			}
+			maskKey = append([]byte(nil), data[header:header+4]...)
+			header += 4
+		}
+		if uint64(len(data)-header) < length {
+			return frames, data, nil
+		}
+		payload := append([]byte(nil), data[header:header+int(length)]...)
+		maskWebSocketPayload(payload, maskKey)
+		frames = append(frames, WebSocketFrame{
+			Fin:        data[0]&0x80 != 0,
+			Opcode:     WebSocketOpcode(data[0] & 0x0F),
+			Payload:    payload,
+			FromClient: fromClient,
+			MaskKey:    maskKey,
+		})
+		data = data[header+int(length):]
+	}
+	return frames, data, nil
+}
+
+// EncodeWebSocketFrame encodes the frame as sent on the wire
+func EncodeWebSocketFrame(frame WebSocketFrame) []byte {
+	first := byte(frame.Opcode & 0x0F)
+	if frame.Fin {
+		first |= 0x80
+	}
+	out := []byte{first}
+	var maskBit byte
+	maskKey := frame.MaskKey
+	if frame.FromClient {
+		maskBit = 0x80
+		if len(maskKey) != 4 {
+			maskKey = binary.BigEndian.AppendUint32(nil, rand.Uint32())
+		}
+	}
+	length := len(frame.Payload)
+	switch {
+	case length < 126:
+		out = append(out, maskBit|byte(length))
+	case length <= 0xFFFF:
+		out = append(out, maskBit|126)
+		out = binary.BigEndian.AppendUint16(out, uint16(length))
+	default:
+		out = append(out, maskBit|127)
+		out = binary.BigEndian.AppendUint64(out, uint64(length))
+	}
+	if !frame.FromClient {
+		return append(out, frame.Payload...)
+	}
+	out = append(out, maskKey...)
+	payload := append([]byte(nil), frame.Payload...)
+	maskWebSocketPayload(payload, maskKey)
+	return append(out, payload...)
+}
+
+func maskWebSocketPayload(payload, maskKey []byte) {
+	if len(maskKey) != 4 {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= maskKey[i%4]
+	}
+}
+
+type onWebSocketFrameFunc[PluginConfig any] func(context HttpContext, config PluginConfig, frame *WebSocketFrame) bool
+
+type onProcessWebSocketFrameOption[PluginConfig any] struct {
+	f onWebSocketFrameFunc[PluginConfig]
+}
+
+func (o *onProcessWebSocketFrameOption[PluginConfig]) Apply(ctx *CommonVmCtx[PluginConfig]) {
+	ctx.onWebSocketFrame = o.f
+}
+
+// ProcessWebSocketFrame observes and modifies the frames of upgraded WebSocket connections in both
+// directions, e.g. the events of realtime APIs. The frame can be changed in place, returning false
+// drops it. Fragmented messages are passed frame by frame. The body handlers of the plugin are not
+// called for WebSocket connections. A frame larger than 16MB stops the processing of its direction of
+// the connection, whose traffic is then passed through.
+func ProcessWebSocketFrame[PluginConfig any](f func(context HttpContext, config PluginConfig, frame *WebSocketFrame) bool) CtxOption[PluginConfig] {
+	return &onProcessWebSocketFrameOption[PluginConfig]{f: f}
+}
+
+// webSocketStream holds the bytes of the frames not complete yet of both directions, and whether the
+// traffic of a direction is passed through after a frame too large to be processed
+type webSocketStream struct {
+	pending     [2][]byte
+	passthrough [2]bool
+}
+
+// onWebSocketData processes the frames of a chunk of the request or response body of an upgraded connection.
+// The bytes of a frame not complete at the end of the stream are forwarded as they are.
+func (ctx *CommonHttpCtx[PluginConfig]) onWebSocketData(fromClient bool, bodySize int, endOfStream bool) types.Action {
+	get, replace := proxywasm.GetHttpResponseBody, proxywasm.ReplaceHttpResponseBody
+	direction := 0
+	if fromClient {
+		get, replace = proxywasm.GetHttpRequestBody, proxywasm.ReplaceHttpRequestBody
+		direction = 1
+	}
+	if ctx.websocket.passthrough[direction] {
+		return types.ActionContinue
+	}
+	chunk, _ := get(0, bodySize)
+	data := append(ctx.websocket.pending[direction], chunk...)
+	frames, rest, err := ParseWebSocketFrames(data, fromClient)
+	ctx.websocket.pending[direction] = append([]byte(nil), rest...)
+	var out []byte
+	for i := range frames {
+		if ctx.plugin.vm.onWebSocketFrame(ctx, *ctx.config, &frames[i]) {
+			out = append(out, EncodeWebSocketFrame(frames[i])...)
+		}
+	}
+	if err != nil {
+		ctx.plugin.vm.log.Warnf("websocket frames are passed through: %v", err)
+		ctx.websocket.passthrough[direction] = true
+		out = append(out, rest...)
+		ctx.websocket.pending[direction] = nil
+	} else if endOfStream && len(rest) > 0 {
+		ctx.plugin.vm.log.Warnf("websocket stream ended with %d bytes of an incomplete frame, forwarding them unprocessed", len(rest))
+		out = append(out, rest...)
+		ctx.websocket.pending[direction] = nil
+	}
+	if err := replace(out); err != nil {
+		ctx.plugin.vm.log.Warnf("replace websocket frames failed: %v", err)
+	}
+	return types.ActionContinue
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2022 Alibaba Group Holding Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrapper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/proxytest"
+	"github.com/higress-group/proxy-wasm-go-sdk/proxywasm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestWebSocketFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame WebSocketFrame
+	}{
+		{"unmasked text", WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("hello")}},
+		{"masked text", WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("hello"), FromClient: true, MaskKey: []byte{1, 2, 3, 4}}},
+		{"16 bit length", WebSocketFrame{Fin: true, Opcode: WebSocketBinary, Payload: bytes.Repeat([]byte{7}, 300)}},
+		{"64 bit length", WebSocketFrame{Opcode: WebSocketBinary, Payload: bytes.Repeat([]byte{7}, 70000), FromClient: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := EncodeWebSocketFrame(tt.frame)
+			frames, rest, err := ParseWebSocketFrames(encoded, tt.frame.FromClient)
+			require.NoError(t, err)
+			assert.Empty(t, rest)
+			require.Len(t, frames, 1)
+			assert.Equal(t, tt.frame.Fin, frames[0].Fin)
+			assert.Equal(t, tt.frame.Opcode, frames[0].Opcode)
+			assert.Equal(t, tt.frame.Payload, frames[0].Payload)
+			assert.Equal(t, tt.frame.FromClient, frames[0].MaskKey != nil)
+		})
+	}
+}
+
+func TestParseWebSocketFramesIncomplete(t *testing.T) {
+	first := EncodeWebSocketFrame(WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("one")})
+	second := EncodeWebSocketFrame(WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("two")})
+	data := append(append([]byte(nil), first...), second[:3]...)
+
+	frames, rest, err := ParseWebSocketFrames(data, false)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, "one", string(frames[0].Payload))
+	assert.Equal(t, second[:3], rest)
+
+	frames, rest, err = ParseWebSocketFrames(append(rest, second[3:]...), false)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, "two", string(frames[0].Payload))
+	assert.Empty(t, rest)
+
+	_, _, err = ParseWebSocketFrames([]byte{0x82, 127, 0, 0, 0, 0, 0x10, 0, 0, 0}, false)
+	assert.ErrorIs(t, err, errWebSocketFrameTooLarge)
+}
+
+func TestWebSocketCloseCode(t *testing.T) {
+	frame := NewWebSocketCloseFrame(1008, "policy violation", false)
+	code, reason := frame.CloseCode()
+	assert.Equal(t, uint16(1008), code)
+	assert.Equal(t, "policy violation", reason)
+	assert.True(t, frame.IsControl())
+
+	code, _ = (&WebSocketFrame{Opcode: WebSocketClose}).CloseCode()
+	assert.Equal(t, uint16(1005), code)
+}
+
+func TestProcessWebSocketFrame(t *testing.T) {
+	var closeCode uint16
+	vm := NewCommonVmCtx("websocket-test",
+		ParseConfig(func(json gjson.Result, config *struct{}) error { return nil }),
+		ProcessWebSocketFrame(func(ctx HttpContext, config struct{}, frame *WebSocketFrame) bool {
+			switch {
+			case frame.Opcode == WebSocketClose:
+				closeCode, _ = frame.CloseCode()
+			case string(frame.Payload) == "drop":
+				return false
+			case frame.Opcode == WebSocketText:
+				frame.Payload = []byte(strings.ToUpper(string(frame.Payload)))
+			}
+			return true
+		}),
+	)
+	host, reset := proxytest.NewHostEmulator(proxytest.NewEmulatorOption().WithVMContext(vm).WithPluginConfiguration([]byte(`{}`)))
+	defer reset()
+	host.RegisterForeignFunction("get_log_level", func([]byte) []byte { return make([]byte, 4) })
+	require.Equal(t, types.OnPluginStartStatusOK, host.StartPlugin())
+
+	id := host.InitializeHttpContext()
+	host.CallOnRequestHeaders(id, [][2]string{
+		{":authority", "example.com"}, {":method", "GET"}, {":path", "/realtime"},
+		{"connection", "Upgrade"}, {"upgrade", "websocket"},
+	}, false)
+	host.CallOnResponseHeaders(id, [][2]string{{":status", "101"}}, false)
+
+	hello := EncodeWebSocketFrame(WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("hello"), FromClient: true})
+	drop := EncodeWebSocketFrame(WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("drop"), FromClient: true})
+	action := host.CallOnRequestBody(id, append(append([]byte(nil), drop...), hello[:4]...), false)
+	assert.Equal(t, types.ActionContinue, action)
+	host.CallOnRequestBody(id, hello[4:], false)
+	frames, rest, err := ParseWebSocketFrames(host.GetCurrentRequestBody(id), true)
+	require.NoError(t, err)
+	assert.Empty(t, rest)
+	require.Len(t, frames, 1)
+	assert.Equal(t, "HELLO", string(frames[0].Payload))
+	assert.NotNil(t, frames[0].MaskKey)
+
+	host.CallOnResponseBody(id, EncodeWebSocketFrame(NewWebSocketCloseFrame(1000, "bye", false)), true)
+	frames, _, err = ParseWebSocketFrames(host.GetCurrentResponseBody(id), false)
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	assert.Equal(t, uint16(1000), closeCode)
+	host.CompleteHttpContext(id)
+
+	t.Run("frame too large", func(t *testing.T) {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{
+			{":authority", "example.com"}, {":method", "GET"}, {":path", "/realtime"},
+			{"connection", "Upgrade"}, {"upgrade", "websocket"},
+		}, false)
+		host.CallOnResponseHeaders(id, [][2]string{{":status", "101"}}, false)
+		reply := EncodeWebSocketFrame(WebSocketFrame{Fin: true, Opcode: WebSocketText, Payload: []byte("reply")})
+		host.CallOnResponseBody(id, reply[:3], false)
+
+		large := []byte{0x82, 0xFF, 0, 0, 0, 0, 0x10, 0, 0, 0, 1, 2, 3, 4}
+		host.CallOnRequestBody(id, large, false)
+		assert.Equal(t, large, host.GetCurrentRequestBody(id), "the direction of the large frame is passed through")
+		host.CallOnRequestBody(id, hello, false)
+		assert.Equal(t, hello, host.GetCurrentRequestBody(id))
+
+		host.CallOnResponseBody(id, reply[3:], false)
+		frames, _, err := ParseWebSocketFrames(host.GetCurrentResponseBody(id), false)
+		require.NoError(t, err)
+		require.Len(t, frames, 1, "the other direction keeps its pending bytes")
+		assert.Equal(t, "REPLY", string(frames[0].Payload))
+		host.CompleteHttpContext(id)
+	})
+
+	t.Run("incomplete frame at end of stream", func(t *testing.T) {
+		id := host.InitializeHttpContext()
+		host.CallOnRequestHeaders(id, [][2]string{
+			{":authority", "example.com"}, {":method", "GET"}, {":path", "/realtime"},
+			{"connection", "Upgrade"}, {"upgrade", "websocket"},
+		}, false)
+		host.CallOnResponseHeaders(id, [][2]string{{":status", "101"}}, false)
+		host.CallOnRequestBody(id, hello[:4], false)
+		assert.Empty(t, host.GetCurrentRequestBody(id))
+		host.CallOnRequestBody(id, hello[4:6], true)
+		assert.Equal(t, hello[:6], host.GetCurrentRequestBody(id), "the pending bytes are forwarded")
+		host.CompleteHttpContext(id)
+	})
+}